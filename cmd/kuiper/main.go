@@ -1068,6 +1068,50 @@ func main() {
 				},
 			},
 		},
+		{
+			Name:    "explain",
+			Aliases: []string{"explain"},
+			Usage:   "explain rule [$rule_json | -f $rule_def_file]",
+			Subcommands: []cli.Command{
+				{
+					Name:  "rule",
+					Usage: "explain rule [$rule_json | -f $rule_def_file]",
+					Flags: []cli.Flag{
+						cli.StringFlag{
+							Name:     "file, f",
+							Usage:    "the location of rule definition file",
+							FilePath: "/home/myrule.txt",
+						},
+					},
+					Action: func(c *cli.Context) error {
+						var rjson string
+						if sfile := c.String("file"); sfile != "" {
+							rule, err := readDef(sfile, "rule")
+							if err != nil {
+								fmt.Printf("%s", err)
+								return nil
+							}
+							rjson = string(rule)
+						} else {
+							if len(c.Args()) != 1 {
+								fmt.Printf("Expect rule json.\nBut found %d args:%s.\n", len(c.Args()), c.Args())
+								return nil
+							}
+							rjson = c.Args()[0]
+						}
+						var reply string
+						args := &model.RPCArgDesc{Json: rjson}
+						err = client.Call("Server.ExplainRule", args, &reply)
+						if err != nil {
+							fmt.Println(err)
+						} else {
+							fmt.Println(reply)
+						}
+						return nil
+					},
+				},
+			},
+		},
 		{
 			Name:    "register",
 			Aliases: []string{"register"},
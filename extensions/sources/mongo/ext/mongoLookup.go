@@ -0,0 +1,202 @@
+// Copyright 2023 EMQ Technologies Co., Ltd.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mongo
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+
+	"github.com/lf-edge/ekuiper/internal/conf"
+	"github.com/lf-edge/ekuiper/pkg/api"
+	"github.com/lf-edge/ekuiper/pkg/cast"
+)
+
+type mongoLookupConfig struct {
+	Url      string `json:"url"`
+	Database string `json:"database"`
+	// KeyFields maps the lookup keys to the document fields. The keys not mapped are the fields of the same name
+	KeyFields map[string]string `json:"keyFields"`
+	// Timeout is the timeout in milliseconds of each query
+	Timeout int `json:"timeout"`
+}
+
+// mongoLookupSource queries the documents of the collection by the lookup values. The datasource is the collection
+type mongoLookupSource struct {
+	cfg        *mongoLookupConfig
+	collection string
+	client     *mongo.Client
+	coll       *mongo.Collection
+}
+
+func GetLookup() api.LookupSource {
+	return &mongoLookupSource{}
+}
+
+func (s *mongoLookupSource) Configure(datasource string, props map[string]interface{}) error {
+	cfg := &mongoLookupConfig{Timeout: 5000}
+	err := cast.MapToStruct(props, cfg)
+	if err != nil {
+		return fmt.Errorf("read properties %v fail with error: %v", props, err)
+	}
+	if cfg.Url == "" {
+		return fmt.Errorf("property url is required")
+	}
+	if cfg.Database == "" {
+		return fmt.Errorf("property database is required")
+	}
+	if datasource == "" {
+		return fmt.Errorf("the datasource must be the collection name")
+	}
+	if cfg.Timeout <= 0 {
+		return fmt.Errorf("invalid timeout %d, must be positive", cfg.Timeout)
+	}
+	s.cfg = cfg
+	s.collection = datasource
+	return nil
+}
+
+// Open fetches the shared client of the url
+func (s *mongoLookupSource) Open(ctx api.StreamContext) error {
+	ctx.GetLogger().Debugf("Opening mongo lookup source")
+	c, err := globalPool.getOrCreate(ctx, s.cfg.Url)
+	if err != nil {
+		return fmt.Errorf("fail to connect to mongo: %v", err)
+	}
+	s.client = c
+	s.coll = c.Database(s.cfg.Database).Collection(s.collection)
+	return nil
+}
+
+func (s *mongoLookupSource) Lookup(ctx api.StreamContext, fields []string, keys []string, values []interface{}) ([]api.SourceTuple, error) {
+	ctx.GetLogger().Debug("Start to lookup documents")
+	return s.find(ctx, s.filter(keys, values), fields)
+}
+
+// Scan queries all the documents of the collection
+func (s *mongoLookupSource) Scan(ctx api.StreamContext, fields []string) ([]api.SourceTuple, error) {
+	return s.find(ctx, bson.D{}, fields)
+}
+
+func (s *mongoLookupSource) find(ctx api.StreamContext, filter bson.D, fields []string) ([]api.SourceTuple, error) {
+	rcvTime := conf.GetNow()
+	tctx, cancel := context.WithTimeout(ctx, time.Duration(s.cfg.Timeout)*time.Millisecond)
+	defer cancel()
+	opts := options.Find()
+	if p := projection(fields); p != nil {
+		opts.SetProjection(p)
+	}
+	ctx.GetLogger().Debugf("Query is %v", filter)
+	cursor, err := s.coll.Find(tctx, filter, opts)
+	if err != nil {
+		return nil, fmt.Errorf("fail to query collection %s: %v", s.collection, err)
+	}
+	var docs []bson.M
+	if err := cursor.All(tctx, &docs); err != nil {
+		return nil, fmt.Errorf("fail to read the documents of collection %s: %v", s.collection, err)
+	}
+	result := make([]api.SourceTuple, 0, len(docs))
+	for _, d := range docs {
+		result = append(result, api.NewDefaultSourceTupleWithTime(convertDoc(d), nil, rcvTime))
+	}
+	return result, nil
+}
+
+// filter matches the mapped document fields of the keys by equality
+func (s *mongoLookupSource) filter(keys []string, values []interface{}) bson.D {
+	filter := make(bson.D, 0, len(keys))
+	for i, k := range keys {
+		f := k
+		if m, ok := s.cfg.KeyFields[k]; ok {
+			f = m
+		}
+		filter = append(filter, bson.E{Key: f, Value: values[i]})
+	}
+	return filter
+}
+
+// projection selects the fields. The _id field is returned by mongo by default, so it is excluded if not selected
+func projection(fields []string) bson.D {
+	if len(fields) == 0 {
+		return nil
+	}
+	p := make(bson.D, 0, len(fields)+1)
+	hasId := false
+	for _, f := range fields {
+		if f == "_id" {
+			hasId = true
+		}
+		p = append(p, bson.E{Key: f, Value: 1})
+	}
+	if !hasId {
+		p = append(p, bson.E{Key: "_id", Value: 0})
+	}
+	return p
+}
+
+// convertDoc converts the bson types to the types of eKuiper. The object id is converted to its hex string
+func convertDoc(d map[string]interface{}) map[string]interface{} {
+	m := make(map[string]interface{}, len(d))
+	for k, v := range d {
+		m[k] = convertValue(v)
+	}
+	return m
+}
+
+func convertValue(v interface{}) interface{} {
+	switch vt := v.(type) {
+	case bson.M:
+		return convertDoc(vt)
+	case bson.D:
+		return convertDoc(vt.Map())
+	case bson.A:
+		return convertArray(vt)
+	case []interface{}:
+		return convertArray(vt)
+	case primitive.ObjectID:
+		return vt.Hex()
+	case primitive.DateTime:
+		return vt.Time()
+	case primitive.Timestamp:
+		return time.Unix(int64(vt.T), 0)
+	case primitive.Decimal128:
+		return vt.String()
+	case primitive.Binary:
+		return vt.Data
+	default:
+		return v
+	}
+}
+
+func convertArray(a []interface{}) []interface{} {
+	r := make([]interface{}, len(a))
+	for i, e := range a {
+		r[i] = convertValue(e)
+	}
+	return r
+}
+
+func (s *mongoLookupSource) Close(ctx api.StreamContext) error {
+	ctx.GetLogger().Debugf("Closing mongo lookup source")
+	if s.client == nil {
+		return nil
+	}
+	return globalPool.release(ctx, s.cfg.Url)
+}
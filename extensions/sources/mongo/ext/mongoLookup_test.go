@@ -0,0 +1,65 @@
+// Copyright 2023 EMQ Technologies Co., Ltd.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mongo
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestConfigure(t *testing.T) {
+	s := &mongoLookupSource{}
+	err := s.Configure("devices", map[string]interface{}{"database": "test"})
+	require.EqualError(t, err, "property url is required")
+	err = s.Configure("devices", map[string]interface{}{"url": "mongodb://localhost:27017"})
+	require.EqualError(t, err, "property database is required")
+	err = s.Configure("devices", map[string]interface{}{
+		"url":       "mongodb://localhost:27017",
+		"database":  "test",
+		"keyFields": map[string]interface{}{"deviceId": "device.id"},
+	})
+	require.NoError(t, err)
+	require.Equal(t, bson.D{{Key: "device.id", Value: 1}, {Key: "region", Value: "east"}},
+		s.filter([]string{"deviceId", "region"}, []interface{}{1, "east"}))
+}
+
+func TestProjection(t *testing.T) {
+	require.Nil(t, projection(nil))
+	require.Equal(t, bson.D{{Key: "name", Value: 1}, {Key: "_id", Value: 0}}, projection([]string{"name"}))
+	require.Equal(t, bson.D{{Key: "_id", Value: 1}, {Key: "name", Value: 1}}, projection([]string{"_id", "name"}))
+}
+
+func TestConvertDoc(t *testing.T) {
+	id := primitive.NewObjectID()
+	now := time.UnixMilli(time.Now().UnixMilli())
+	doc := bson.M{
+		"_id":     id,
+		"name":    "device1",
+		"created": primitive.NewDateTimeFromTime(now),
+		"tags":    bson.A{"a", bson.M{"b": id}},
+		"meta":    bson.D{{Key: "region", Value: "east"}},
+	}
+	require.Equal(t, map[string]interface{}{
+		"_id":     id.Hex(),
+		"name":    "device1",
+		"created": now,
+		"tags":    []interface{}{"a", map[string]interface{}{"b": id.Hex()}},
+		"meta":    map[string]interface{}{"region": "east"},
+	}, convertDoc(doc))
+}
@@ -0,0 +1,81 @@
+// Copyright 2023 EMQ Technologies Co., Ltd.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mongo
+
+import (
+	"context"
+	"sync"
+
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+
+	"github.com/lf-edge/ekuiper/internal/conf"
+)
+
+// globalPool maintains the clients by the url. A mongo client is a connection pool itself, so the lookup tables of the
+// same url share the client and the connections. The pool size could be set by the maxPoolSize option of the url
+var globalPool = newClientPool()
+
+type clientPool struct {
+	sync.Mutex
+	// url -> client
+	clients map[string]*mongo.Client
+	// url -> reference count
+	refs map[string]int
+}
+
+func newClientPool() *clientPool {
+	return &clientPool{
+		clients: map[string]*mongo.Client{},
+		refs:    map[string]int{},
+	}
+}
+
+func (p *clientPool) getOrCreate(ctx context.Context, url string) (*mongo.Client, error) {
+	p.Lock()
+	defer p.Unlock()
+	if c, ok := p.clients[url]; ok {
+		p.refs[url]++
+		return c, nil
+	}
+	c, err := mongo.Connect(ctx, options.Client().ApplyURI(url))
+	if err != nil {
+		return nil, err
+	}
+	// the url is not logged since it could contain the password
+	conf.Log.Infof("create new mongo client")
+	p.clients[url] = c
+	p.refs[url] = 1
+	return c, nil
+}
+
+func (p *clientPool) release(ctx context.Context, url string) error {
+	p.Lock()
+	defer p.Unlock()
+	count, ok := p.refs[url]
+	if !ok {
+		return nil
+	}
+	count--
+	if count > 0 {
+		p.refs[url] = count
+		return nil
+	}
+	c := p.clients[url]
+	delete(p.clients, url)
+	delete(p.refs, url)
+	conf.Log.Infof("drop mongo client")
+	return c.Disconnect(ctx)
+}
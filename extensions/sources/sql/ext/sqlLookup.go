@@ -78,25 +78,187 @@ func (s *sqlLookupSource) Lookup(ctx api.StreamContext, fields []string, keys []
 		if i > 0 {
 			query += " AND "
 		}
-		switch v := values[i].(type) {
-		case string:
-			query += fmt.Sprintf("`%s` = '%s'", k, v)
-		default:
-			query += fmt.Sprintf("`%s` = %v", k, v)
+		query += condition(k, values[i])
+	}
+	ctx.GetLogger().Debugf("Query is %s", query)
+	var result []api.SourceTuple
+	err := s.query(query, func(data map[string]interface{}) {
+		result = append(result, api.NewDefaultSourceTupleWithTime(data, nil, rcvTime))
+	})
+	if err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// Scan queries all the rows of the table
+func (s *sqlLookupSource) LookupRange(ctx api.StreamContext, fields []string, keys []string, values []interface{}, ranges []api.LookupRange) ([]api.SourceTuple, error) {
+	rcvTime := conf.GetNow()
+	query := "SELECT "
+	if len(fields) == 0 {
+		query += "*"
+	} else {
+		for i, f := range fields {
+			if i > 0 {
+				query += ","
+			}
+			query += f
+		}
+	}
+	query += fmt.Sprintf(" FROM %s WHERE ", s.table)
+	for i, k := range keys {
+		if i > 0 {
+			query += " AND "
+		}
+		query += condition(k, values[i])
+	}
+	for i, r := range ranges {
+		if i > 0 || len(keys) > 0 {
+			query += " AND "
+		}
+		query += fmt.Sprintf("`%s` %s %s", r.Field, r.Op, literal(r.Value))
+	}
+	ctx.GetLogger().Debugf("Range query is %s", query)
+	var result []api.SourceTuple
+	err := s.query(query, func(data map[string]interface{}) {
+		result = append(result, api.NewDefaultSourceTupleWithTime(data, nil, rcvTime))
+	})
+	if err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+func (s *sqlLookupSource) Scan(ctx api.StreamContext, fields []string) ([]api.SourceTuple, error) {
+	rcvTime := conf.GetNow()
+	query := "SELECT "
+	if len(fields) == 0 {
+		query += "*"
+	} else {
+		for i, f := range fields {
+			if i > 0 {
+				query += ","
+			}
+			query += f
+		}
+	}
+	query += " FROM " + s.table
+	ctx.GetLogger().Debugf("Scan query is %s", query)
+	var result []api.SourceTuple
+	err := s.query(query, func(data map[string]interface{}) {
+		result = append(result, api.NewDefaultSourceTupleWithTime(data, nil, rcvTime))
+	})
+	if err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// LookupBatch queries the values in one statement by IN for a single key or OR for multiple keys. The keys are also
+// selected to dispatch the rows to the values, and then removed if not in the fields
+func (s *sqlLookupSource) LookupBatch(ctx api.StreamContext, fields []string, keys []string, values [][]interface{}) ([][]api.SourceTuple, error) {
+	ctx.GetLogger().Debugf("Start to batch lookup %d values", len(values))
+	rcvTime := conf.GetNow()
+	query := "SELECT "
+	var extra []string
+	if len(fields) == 0 {
+		query += "*"
+	} else {
+		selected := make(map[string]bool, len(fields))
+		for i, f := range fields {
+			if i > 0 {
+				query += ","
+			}
+			query += f
+			selected[f] = true
+		}
+		for _, k := range keys {
+			if !selected[k] {
+				query += "," + k
+				extra = append(extra, k)
+			}
+		}
+	}
+	query += fmt.Sprintf(" FROM %s WHERE ", s.table)
+	if len(keys) == 1 {
+		query += fmt.Sprintf("`%s` IN (", keys[0])
+		for i, v := range values {
+			if i > 0 {
+				query += ","
+			}
+			query += literal(v[0])
+		}
+		query += ")"
+	} else {
+		for i, v := range values {
+			if i > 0 {
+				query += " OR "
+			}
+			query += "("
+			for j, k := range keys {
+				if j > 0 {
+					query += " AND "
+				}
+				query += condition(k, v[j])
+			}
+			query += ")"
 		}
 	}
 	ctx.GetLogger().Debugf("Query is %s", query)
-	rows, err := s.db.Query(query)
+	// the values are compared by the string format to tolerate the different number types of the database and the rule
+	index := make(map[string][]int, len(values))
+	for i, v := range values {
+		k := fmt.Sprintf("%v", v)
+		index[k] = append(index[k], i)
+	}
+	result := make([][]api.SourceTuple, len(values))
+	for i := range result {
+		result[i] = []api.SourceTuple{}
+	}
+	err := s.query(query, func(data map[string]interface{}) {
+		kv := make([]interface{}, len(keys))
+		for i, k := range keys {
+			kv[i] = data[k]
+		}
+		for _, k := range extra {
+			delete(data, k)
+		}
+		for _, i := range index[fmt.Sprintf("%v", kv)] {
+			result[i] = append(result[i], api.NewDefaultSourceTupleWithTime(data, nil, rcvTime))
+		}
+	})
 	if err != nil {
 		return nil, err
 	}
+	return result, nil
+}
+
+func condition(k string, v interface{}) string {
+	return fmt.Sprintf("`%s` = %s", k, literal(v))
+}
+
+func literal(v interface{}) string {
+	switch vt := v.(type) {
+	case string:
+		return fmt.Sprintf("'%s'", vt)
+	default:
+		return fmt.Sprintf("%v", vt)
+	}
+}
+
+// query runs the query and calls f with each row
+func (s *sqlLookupSource) query(query string, f func(data map[string]interface{})) error {
+	rows, err := s.db.Query(query)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
 	cols, _ := rows.Columns()
 
 	types, err := rows.ColumnTypes()
 	if err != nil {
-		return nil, err
+		return err
 	}
-	var result []api.SourceTuple
 	for rows.Next() {
 		data := make(map[string]interface{})
 		columns := make([]interface{}, len(cols))
@@ -104,12 +266,12 @@ func (s *sqlLookupSource) Lookup(ctx api.StreamContext, fields []string, keys []
 
 		err := rows.Scan(columns...)
 		if err != nil {
-			return nil, err
+			return err
 		}
 		scanIntoMap(data, columns, cols)
-		result = append(result, api.NewDefaultSourceTupleWithTime(data, nil, rcvTime))
+		f(data)
 	}
-	return result, nil
+	return nil
 }
 
 func (s *sqlLookupSource) Close(ctx api.StreamContext) error {
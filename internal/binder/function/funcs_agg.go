@@ -15,6 +15,7 @@
 package function
 
 import (
+	"container/heap"
 	"fmt"
 
 	"github.com/montanaflynn/stats"
@@ -340,6 +341,35 @@ func registerAggFunc() {
 		val:   ValidateTwoNumberArg,
 		check: returnNilIfHasAnyNil,
 	}
+	builtins["topn"] = builtinFunc{
+		fType: ast.FuncTypeAgg,
+		exec: func(ctx api.FunctionContext, args []interface{}) (interface{}, bool) {
+			arg0 := args[0].([]interface{})
+			if len(arg0) == 0 {
+				return nil, true
+			}
+			arg1 := args[1].([]interface{})
+			n, err := cast.ToInt(getFirstValidArg(arg1), cast.CONVERT_SAMEKIND)
+			if err != nil || n <= 0 {
+				return fmt.Errorf("the second parameter requires positive int but found %[1]T(%[1]v)", getFirstValidArg(arg1)), false
+			}
+			r, err := topN(arg0, n)
+			if err != nil {
+				return err, false
+			}
+			return r, true
+		},
+		val: func(_ api.FunctionContext, args []ast.Expr) error {
+			if err := ValidateLen(2, len(args)); err != nil {
+				return err
+			}
+			if il, ok := args[1].(*ast.IntegerLiteral); !ok || il.Val <= 0 {
+				return ProduceErrInfo(1, "positive int")
+			}
+			return nil
+		},
+		check: returnNilIfHasAnyNil,
+	}
 	builtins["last_value"] = builtinFunc{
 		fType: ast.FuncTypeAgg,
 		exec: func(ctx api.FunctionContext, args []interface{}) (interface{}, bool) {
@@ -379,3 +409,79 @@ func registerAggFunc() {
 		check: returnNilIfHasAnyNil,
 	}
 }
+
+// topNItem is a value of the group with its index to keep the arrival order of the equal values
+type topNItem struct {
+	v     interface{}
+	f     float64
+	s     string
+	isStr bool
+	idx   int
+}
+
+// less puts the later one of the equal values first so that the earlier one is kept
+func (a topNItem) less(b topNItem) bool {
+	if a.isStr {
+		if a.s != b.s {
+			return a.s < b.s
+		}
+	} else if a.f != b.f {
+		return a.f < b.f
+	}
+	return a.idx > b.idx
+}
+
+// topNHeap is a min heap of the largest items so far whose root is the first to be replaced
+type topNHeap []topNItem
+
+func (h topNHeap) Len() int { return len(h) }
+
+func (h topNHeap) Less(i, j int) bool { return h[i].less(h[j]) }
+
+func (h topNHeap) Swap(i, j int) { h[i], h[j] = h[j], h[i] }
+
+func (h *topNHeap) Push(x interface{}) { *h = append(*h, x.(topNItem)) }
+
+func (h *topNHeap) Pop() interface{} {
+	old := *h
+	n := len(old)
+	x := old[n-1]
+	*h = old[:n-1]
+	return x
+}
+
+// topN returns the n largest values in descending order. It keeps only n values in a heap while scanning the values
+// instead of sorting all of them. The values must be all numbers or all strings, and the nil values are ignored.
+func topN(values []interface{}, n int) ([]interface{}, error) {
+	h := make(topNHeap, 0, n)
+	for i, v := range values {
+		if v == nil {
+			continue
+		}
+		item := topNItem{v: v, idx: i}
+		if s, ok := v.(string); ok {
+			item.s = s
+			item.isStr = true
+		} else {
+			f, err := cast.ToFloat64(v, cast.CONVERT_SAMEKIND)
+			if err != nil {
+				return nil, fmt.Errorf("requires number or string but found %[1]T(%[1]v)", v)
+			}
+			item.f = f
+		}
+		if len(h) > 0 && h[0].isStr != item.isStr {
+			return nil, fmt.Errorf("requires the values of the same type but found %v and %v", h[0].v, v)
+		}
+		if len(h) < n {
+			heap.Push(&h, item)
+		} else if h[0].less(item) {
+			h[0] = item
+			heap.Fix(&h, 0)
+		}
+	}
+	result := make([]interface{}, len(h))
+	for i := len(result) - 1; i >= 0; i-- {
+		result[i] = heap.Pop(&h).(topNItem).v
+	}
+	return result, nil
+}
@@ -627,3 +627,49 @@ func TestLastValueValidation(t *testing.T) {
 		}
 	}
 }
+
+func TestTopN(t *testing.T) {
+	f, ok := builtins["topn"]
+	require.True(t, ok)
+	contextLogger := conf.Log.WithField("rule", "testExec")
+	ctx := kctx.WithValue(kctx.Background(), kctx.LoggerKey, contextLogger)
+	tempStore, _ := state.CreateStore("mockRule0", api.AtMostOnce)
+	fctx := kctx.NewDefaultFuncContext(ctx.WithMeta("mockRule0", "test", tempStore), 2)
+	tests := []struct {
+		values []interface{}
+		n      int
+		result interface{}
+	}{
+		{
+			values: []interface{}{3, 1.5, nil, 7, 3.0, 5},
+			n:      3,
+			result: []interface{}{7, 5, 3},
+		}, {
+			values: []interface{}{"b", "c", "a"},
+			n:      5,
+			result: []interface{}{"c", "b", "a"},
+		}, {
+			values: []interface{}{1, "a"},
+			n:      2,
+			result: fmt.Errorf("requires the values of the same type but found 1 and a"),
+		}, {
+			values: []interface{}{true},
+			n:      1,
+			result: fmt.Errorf("requires number or string but found bool(true)"),
+		}, {
+			values: []interface{}{},
+			n:      1,
+			result: nil,
+		},
+	}
+	for i, tt := range tests {
+		n := make([]interface{}, len(tt.values))
+		for j := range n {
+			n[j] = tt.n
+		}
+		r, _ := f.exec(fctx, []interface{}{tt.values, n})
+		require.Equal(t, tt.result, r, i)
+	}
+	require.NoError(t, f.val(nil, []ast.Expr{&ast.FieldRef{Name: "foo"}, &ast.IntegerLiteral{Val: 3}}))
+	require.EqualError(t, f.val(nil, []ast.Expr{&ast.FieldRef{Name: "foo"}, &ast.IntegerLiteral{Val: 0}}), "Expect positive int type for parameter 2")
+}
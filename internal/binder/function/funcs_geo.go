@@ -0,0 +1,312 @@
+// Copyright 2023 EMQ Technologies Co., Ltd.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package function
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"sync"
+
+	"github.com/lf-edge/ekuiper/pkg/api"
+	"github.com/lf-edge/ekuiper/pkg/ast"
+	"github.com/lf-edge/ekuiper/pkg/cast"
+)
+
+// earthRadius is the mean radius of the earth in meters
+const earthRadius = 6371008.8
+
+// geoCacheSize is the max count of the GeoJSON strings to cache their parsed geometries
+const geoCacheSize = 1024
+
+// geoPoint is the longitude and the latitude of a point
+type geoPoint [2]float64
+
+// geometry is a point or the polygons parsed from GeoJSON. The first ring of a polygon is the exterior, and the
+// others are the holes
+type geometry struct {
+	point    *geoPoint
+	polygons [][][]geoPoint
+}
+
+// geoCache caches the geometries parsed from the GeoJSON strings, such as the geofences of a table which are
+// evaluated against each event of the stream in a join
+var geoCache = struct {
+	sync.RWMutex
+	m map[string]*geometry
+}{m: make(map[string]*geometry)}
+
+func registerGeoFunc() {
+	builtins["st_point"] = builtinFunc{
+		fType: ast.FuncTypeScalar,
+		exec: func(ctx api.FunctionContext, args []interface{}) (interface{}, bool) {
+			p, err := toGeoPoint(args)
+			if err != nil {
+				return err, false
+			}
+			return map[string]interface{}{"type": "Point", "coordinates": []interface{}{p[0], p[1]}}, true
+		},
+		val:   ValidateTwoNumberArg,
+		check: returnNilIfHasAnyNil,
+	}
+	builtins["st_distance"] = builtinFunc{
+		fType: ast.FuncTypeScalar,
+		exec: func(ctx api.FunctionContext, args []interface{}) (interface{}, bool) {
+			a, err := toGeometry(args[0])
+			if err != nil {
+				return err, false
+			}
+			b, err := toGeometry(args[1])
+			if err != nil {
+				return err, false
+			}
+			if a.point == nil || b.point == nil {
+				return fmt.Errorf("st_distance only supports two points"), false
+			}
+			return haversine(*a.point, *b.point), true
+		},
+		val: func(_ api.FunctionContext, args []ast.Expr) error {
+			return ValidateLen(2, len(args))
+		},
+		check: returnNilIfHasAnyNil,
+	}
+	builtins["st_within"] = builtinFunc{
+		fType: ast.FuncTypeScalar,
+		exec: func(ctx api.FunctionContext, args []interface{}) (interface{}, bool) {
+			return within("st_within", args[0], args[1])
+		},
+		val: func(_ api.FunctionContext, args []ast.Expr) error {
+			return ValidateLen(2, len(args))
+		},
+		check: returnNilIfHasAnyNil,
+	}
+	builtins["st_contains"] = builtinFunc{
+		fType: ast.FuncTypeScalar,
+		exec: func(ctx api.FunctionContext, args []interface{}) (interface{}, bool) {
+			return within("st_contains", args[1], args[0])
+		},
+		val: func(_ api.FunctionContext, args []ast.Expr) error {
+			return ValidateLen(2, len(args))
+		},
+		check: returnNilIfHasAnyNil,
+	}
+}
+
+// within returns whether the point is inside the polygons
+func within(name string, point, polygons interface{}) (interface{}, bool) {
+	p, err := toGeometry(point)
+	if err != nil {
+		return err, false
+	}
+	g, err := toGeometry(polygons)
+	if err != nil {
+		return err, false
+	}
+	if p.point == nil || g.point != nil {
+		return fmt.Errorf("%s only supports a point and the polygons", name), false
+	}
+	return g.contains(*p.point), true
+}
+
+// toGeometry converts the GeoJSON object or string, or the array of [longitude, latitude] to the geometry
+func toGeometry(v interface{}) (*geometry, error) {
+	switch t := v.(type) {
+	case string:
+		geoCache.RLock()
+		g, ok := geoCache.m[t]
+		geoCache.RUnlock()
+		if ok {
+			return g, nil
+		}
+		var m map[string]interface{}
+		if err := json.Unmarshal([]byte(t), &m); err != nil {
+			return nil, fmt.Errorf("invalid GeoJSON %s: %v", t, err)
+		}
+		g, err := geoObject(m)
+		if err != nil {
+			return nil, err
+		}
+		geoCache.Lock()
+		if len(geoCache.m) >= geoCacheSize {
+			geoCache.m = make(map[string]*geometry)
+		}
+		geoCache.m[t] = g
+		geoCache.Unlock()
+		return g, nil
+	case map[string]interface{}:
+		return geoObject(t)
+	case []interface{}:
+		p, err := toGeoPoint(t)
+		if err != nil {
+			return nil, err
+		}
+		return &geometry{point: &p}, nil
+	default:
+		return nil, fmt.Errorf("invalid geometry %v, expect GeoJSON object or string, or [longitude, latitude]", v)
+	}
+}
+
+func geoObject(m map[string]interface{}) (*geometry, error) {
+	typ, _ := m["type"].(string)
+	switch typ {
+	case "Point":
+		c, ok := m["coordinates"].([]interface{})
+		if !ok {
+			return nil, fmt.Errorf("invalid GeoJSON Point coordinates %v", m["coordinates"])
+		}
+		p, err := toGeoPoint(c)
+		if err != nil {
+			return nil, err
+		}
+		return &geometry{point: &p}, nil
+	case "Polygon":
+		p, err := toGeoPolygon(m["coordinates"])
+		if err != nil {
+			return nil, err
+		}
+		return &geometry{polygons: [][][]geoPoint{p}}, nil
+	case "MultiPolygon":
+		cs, ok := m["coordinates"].([]interface{})
+		if !ok {
+			return nil, fmt.Errorf("invalid GeoJSON MultiPolygon coordinates %v", m["coordinates"])
+		}
+		g := &geometry{}
+		for _, c := range cs {
+			p, err := toGeoPolygon(c)
+			if err != nil {
+				return nil, err
+			}
+			g.polygons = append(g.polygons, p)
+		}
+		return g, nil
+	case "Feature":
+		gm, ok := m["geometry"].(map[string]interface{})
+		if !ok {
+			return nil, fmt.Errorf("invalid GeoJSON Feature geometry %v", m["geometry"])
+		}
+		return geoObject(gm)
+	case "FeatureCollection":
+		fs, ok := m["features"].([]interface{})
+		if !ok {
+			return nil, fmt.Errorf("invalid GeoJSON FeatureCollection features %v", m["features"])
+		}
+		g := &geometry{}
+		for _, f := range fs {
+			fm, ok := f.(map[string]interface{})
+			if !ok {
+				return nil, fmt.Errorf("invalid GeoJSON Feature %v", f)
+			}
+			fg, err := geoObject(fm)
+			if err != nil {
+				return nil, err
+			}
+			if fg.point != nil {
+				return nil, fmt.Errorf("GeoJSON FeatureCollection only supports the polygons")
+			}
+			g.polygons = append(g.polygons, fg.polygons...)
+		}
+		return g, nil
+	default:
+		return nil, fmt.Errorf("unsupported GeoJSON type %q, expect Point, Polygon, MultiPolygon, Feature or FeatureCollection", typ)
+	}
+}
+
+// toGeoPoint converts the coordinates of [longitude, latitude] to a point. The altitude is ignored if any
+func toGeoPoint(c []interface{}) (geoPoint, error) {
+	var p geoPoint
+	if len(c) < 2 {
+		return p, fmt.Errorf("invalid point %v, expect [longitude, latitude]", c)
+	}
+	for i := range p {
+		v, err := cast.ToFloat64(c[i], cast.CONVERT_SAMEKIND)
+		if err != nil {
+			return p, fmt.Errorf("invalid point %v, expect [longitude, latitude]", c)
+		}
+		p[i] = v
+	}
+	if p[0] < -180 || p[0] > 180 || p[1] < -90 || p[1] > 90 {
+		return p, fmt.Errorf("invalid point %v, the longitude must be in [-180, 180] and the latitude must be in [-90, 90]", c)
+	}
+	return p, nil
+}
+
+func toGeoPolygon(v interface{}) ([][]geoPoint, error) {
+	rings, ok := v.([]interface{})
+	if !ok || len(rings) == 0 {
+		return nil, fmt.Errorf("invalid GeoJSON Polygon coordinates %v", v)
+	}
+	result := make([][]geoPoint, 0, len(rings))
+	for _, r := range rings {
+		ps, ok := r.([]interface{})
+		if !ok || len(ps) < 3 {
+			return nil, fmt.Errorf("invalid ring %v of polygon, expect at least 3 points", r)
+		}
+		ring := make([]geoPoint, 0, len(ps))
+		for _, pv := range ps {
+			c, ok := pv.([]interface{})
+			if !ok {
+				return nil, fmt.Errorf("invalid point %v, expect [longitude, latitude]", pv)
+			}
+			p, err := toGeoPoint(c)
+			if err != nil {
+				return nil, err
+			}
+			ring = append(ring, p)
+		}
+		result = append(result, ring)
+	}
+	return result, nil
+}
+
+// contains checks whether the point is inside any polygon and not in its holes
+func (g *geometry) contains(p geoPoint) bool {
+	for _, polygon := range g.polygons {
+		if !inRing(polygon[0], p) {
+			continue
+		}
+		inHole := false
+		for _, hole := range polygon[1:] {
+			if inRing(hole, p) {
+				inHole = true
+				break
+			}
+		}
+		if !inHole {
+			return true
+		}
+	}
+	return false
+}
+
+// inRing checks whether the point is inside the ring by ray casting on the plane of longitude and latitude
+func inRing(ring []geoPoint, p geoPoint) bool {
+	in := false
+	for i, j := 0, len(ring)-1; i < len(ring); j, i = i, i+1 {
+		a, b := ring[i], ring[j]
+		if (a[1] > p[1]) != (b[1] > p[1]) && p[0] < (b[0]-a[0])*(p[1]-a[1])/(b[1]-a[1])+a[0] {
+			in = !in
+		}
+	}
+	return in
+}
+
+// haversine returns the great-circle distance of the two points in meters
+func haversine(a, b geoPoint) float64 {
+	lat1, lat2 := a[1]*math.Pi/180, b[1]*math.Pi/180
+	dLat := lat2 - lat1
+	dLng := (b[0] - a[0]) * math.Pi / 180
+	h := math.Sin(dLat/2)*math.Sin(dLat/2) + math.Cos(lat1)*math.Cos(lat2)*math.Sin(dLng/2)*math.Sin(dLng/2)
+	return 2 * earthRadius * math.Asin(math.Sqrt(h))
+}
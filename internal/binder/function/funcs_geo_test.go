@@ -0,0 +1,138 @@
+// Copyright 2023 EMQ Technologies Co., Ltd.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package function
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/lf-edge/ekuiper/internal/conf"
+	kctx "github.com/lf-edge/ekuiper/internal/topo/context"
+	"github.com/lf-edge/ekuiper/internal/topo/state"
+	"github.com/lf-edge/ekuiper/pkg/api"
+)
+
+func TestGeoFunctions(t *testing.T) {
+	contextLogger := conf.Log.WithField("rule", "testExec")
+	ctx := kctx.WithValue(kctx.Background(), kctx.LoggerKey, contextLogger)
+	tempStore, _ := state.CreateStore("mockRule0", api.AtMostOnce)
+	fctx := kctx.NewDefaultFuncContext(ctx.WithMeta("mockRule0", "test", tempStore), 2)
+	square := `{"type":"Polygon","coordinates":[[[0,0],[10,0],[10,10],[0,10],[0,0]],[[4,4],[6,4],[6,6],[4,6],[4,4]]]}`
+	fences := map[string]interface{}{
+		"type": "FeatureCollection",
+		"features": []interface{}{
+			map[string]interface{}{"type": "Feature", "properties": map[string]interface{}{"name": "a"}, "geometry": map[string]interface{}{
+				"type":        "MultiPolygon",
+				"coordinates": []interface{}{[]interface{}{[]interface{}{[]interface{}{20, 20}, []interface{}{30, 20}, []interface{}{25, 30}, []interface{}{20, 20}}}},
+			}},
+		},
+	}
+	tests := []struct {
+		name   string
+		args   []interface{}
+		result interface{}
+	}{
+		{ // 0
+			name:   "st_point",
+			args:   []interface{}{116.4, 39.9},
+			result: map[string]interface{}{"type": "Point", "coordinates": []interface{}{116.4, 39.9}},
+		},
+		{ // 1
+			name:   "st_point",
+			args:   []interface{}{39.9, 116.4},
+			result: errors.New("invalid point [39.9 116.4], the longitude must be in [-180, 180] and the latitude must be in [-90, 90]"),
+		},
+		{ // 2
+			name:   "st_within",
+			args:   []interface{}{[]interface{}{2, 3}, square},
+			result: true,
+		},
+		{ // 3 in the hole
+			name:   "st_within",
+			args:   []interface{}{[]interface{}{5, 5}, square},
+			result: false,
+		},
+		{ // 4
+			name:   "st_within",
+			args:   []interface{}{map[string]interface{}{"type": "Point", "coordinates": []interface{}{12.0, 5.0}}, square},
+			result: false,
+		},
+		{ // 5
+			name:   "st_contains",
+			args:   []interface{}{fences, []interface{}{25, 22}},
+			result: true,
+		},
+		{ // 6
+			name:   "st_contains",
+			args:   []interface{}{fences, []interface{}{2, 3}},
+			result: false,
+		},
+		{ // 7
+			name:   "st_within",
+			args:   []interface{}{square, []interface{}{2, 3}},
+			result: errors.New("st_within only supports a point and the polygons"),
+		},
+		{ // 8
+			name:   "st_within",
+			args:   []interface{}{[]interface{}{2, 3}, `{"type":"LineString","coordinates":[[0,0],[1,1]]}`},
+			result: errors.New("unsupported GeoJSON type \"LineString\", expect Point, Polygon, MultiPolygon, Feature or FeatureCollection"),
+		},
+		{ // 9
+			name:   "st_within",
+			args:   []interface{}{[]interface{}{2, 3}, 12},
+			result: errors.New("invalid geometry 12, expect GeoJSON object or string, or [longitude, latitude]"),
+		},
+		{ // 10
+			name:   "st_distance",
+			args:   []interface{}{[]interface{}{0, 0}, `{"type":"Point","coordinates":[0,1]}`},
+			result: 111195.0802335329,
+		},
+		{ // 11
+			name:   "st_distance",
+			args:   []interface{}{[]interface{}{0, 0}, square},
+			result: errors.New("st_distance only supports two points"),
+		},
+	}
+	for i, tt := range tests {
+		f, ok := builtins[tt.name]
+		require.True(t, ok)
+		result, _ := f.exec(fctx, tt.args)
+		if r, ok := result.(float64); ok {
+			require.InDelta(t, tt.result, r, 1e-6, "case %d", i)
+		} else {
+			require.Equal(t, tt.result, result, "case %d", i)
+		}
+	}
+	// the parsed GeoJSON string is cached
+	_, ok := geoCache.m[square]
+	require.True(t, ok)
+}
+
+func TestGeoFunctionsNil(t *testing.T) {
+	oldBuiltins := builtins
+	defer func() {
+		builtins = oldBuiltins
+	}()
+	builtins = map[string]builtinFunc{}
+	registerGeoFunc()
+	for name, function := range builtins {
+		r, b := function.check([]interface{}{nil})
+		require.True(t, b, fmt.Sprintf("%v failed", name))
+		require.Nil(t, r, fmt.Sprintf("%v failed", name))
+	}
+}
@@ -56,6 +56,7 @@ func init() {
 	registerDateTimeFunc()
 	registerGlobalAggFunc()
 	registerWindowFunc()
+	registerGeoFunc()
 }
 
 //var funcWithAsteriskSupportMap = map[string]string{
@@ -79,6 +80,15 @@ var windowFuncs = map[string]struct{}{
 	"row_number": {},
 }
 
+// frameFuncs are the aggregate functions which can be calculated over a ROWS frame like an analytic function
+var frameFuncs = map[string]struct{}{
+	"avg":   {},
+	"count": {},
+	"max":   {},
+	"min":   {},
+	"sum":   {},
+}
+
 const AnalyticPrefix = "$$a"
 
 func IsWindowFunc(name string) bool {
@@ -91,6 +101,11 @@ func IsAnalyticFunc(name string) bool {
 	return ok
 }
 
+func IsFrameFunc(name string) bool {
+	_, ok := frameFuncs[name]
+	return ok
+}
+
 type Manager struct{}
 
 // Function the name is converted to lowercase if needed during parsing
@@ -18,6 +18,7 @@ import (
 	"github.com/lf-edge/ekuiper/internal/io/file"
 	"github.com/lf-edge/ekuiper/internal/io/http"
 	"github.com/lf-edge/ekuiper/internal/io/memory"
+	"github.com/lf-edge/ekuiper/internal/io/mocklookup"
 	"github.com/lf-edge/ekuiper/internal/io/mqtt"
 	"github.com/lf-edge/ekuiper/internal/io/neuron"
 	"github.com/lf-edge/ekuiper/internal/io/sink"
@@ -51,8 +52,10 @@ var (
 		"file":        func() api.Sink { return file.File() },
 	}
 	lookupSources = map[string]NewLookupSourceFunc{
-		"memory":   func() api.LookupSource { return memory.GetLookupSource() },
-		"httppull": func() api.LookupSource { return http.GetLookUpSource() },
+		"memory":     func() api.LookupSource { return memory.GetLookupSource() },
+		"httppull":   func() api.LookupSource { return http.GetLookUpSource() },
+		"httpLookup": http.GetRestLookupSource,
+		"mockLookup": mocklookup.GetLookupSource,
 	}
 )
 
@@ -25,4 +25,8 @@ func TestLookupSources(t *testing.T) {
 	require.True(t, ok)
 	_, ok = lookupSources["httppull"]
 	require.True(t, ok)
+	_, ok = lookupSources["httpLookup"]
+	require.True(t, ok)
+	_, ok = lookupSources["grpcLookup"]
+	require.True(t, ok)
 }
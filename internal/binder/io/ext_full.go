@@ -22,6 +22,7 @@ import (
 	influx2 "github.com/lf-edge/ekuiper/extensions/sinks/influx2/ext"
 	kafka "github.com/lf-edge/ekuiper/extensions/sinks/kafka/ext"
 	sqlSink "github.com/lf-edge/ekuiper/extensions/sinks/sql/ext"
+	mongo "github.com/lf-edge/ekuiper/extensions/sources/mongo/ext"
 	random "github.com/lf-edge/ekuiper/extensions/sources/random/ext"
 	sql "github.com/lf-edge/ekuiper/extensions/sources/sql/ext"
 	video "github.com/lf-edge/ekuiper/extensions/sources/video/ext"
@@ -33,6 +34,7 @@ func init() {
 	sources["video"] = func() api.Source { return video.GetSource() }
 	sources["sql"] = func() api.Source { return sql.GetSource() }
 	lookupSources["sql"] = func() api.LookupSource { return sql.GetLookup() }
+	lookupSources["mongo"] = func() api.LookupSource { return mongo.GetLookup() }
 	sinks["image"] = func() api.Sink { return image.GetSink() }
 	sinks["influx"] = func() api.Sink { return influx.GetSink() }
 	sinks["influx2"] = func() api.Sink { return influx2.GetSink() }
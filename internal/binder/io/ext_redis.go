@@ -19,6 +19,7 @@ package io
 import (
 	"github.com/lf-edge/ekuiper/internal/io/redis"
 	"github.com/lf-edge/ekuiper/internal/io/redis/pubsub"
+	"github.com/lf-edge/ekuiper/internal/topo/lookup/cache"
 	"github.com/lf-edge/ekuiper/pkg/api"
 )
 
@@ -27,4 +28,5 @@ func init() {
 	sinks["redis"] = func() api.Sink { return redis.GetSink() }
 	sinks["redisPub"] = func() api.Sink { return pubsub.RedisPub() }
 	sources["redisSub"] = func() api.Source { return pubsub.RedisSub() }
+	cache.RegisterBackend("redis", redis.NewCacheBackend)
 }
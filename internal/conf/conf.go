@@ -184,6 +184,8 @@ type KuiperConf struct {
 	Rule   api.RuleOption
 	Sink   *SinkConf
 	Source *SourceConf
+	// Lookup is the default lookup table options which can be overridden by the lookup props of each source
+	Lookup map[string]interface{}
 	Store  struct {
 		Type         string `yaml:"type"`
 		ExtStateType string `yaml:"extStateType"`
@@ -390,6 +392,28 @@ func ValidateRuleOption(option *api.RuleOption) error {
 		Log.Warnf("lateTol is negative, set to 1000")
 		errs = errors.Join(errs, errors.New("invalidLateTol:lateTol must be greater than 0"))
 	}
+	if option.AllowedLateness < 0 {
+		option.AllowedLateness = 0
+		Log.Warnf("allowedLateness is negative, set to 0")
+		errs = errors.Join(errs, errors.New("invalidAllowedLateness:allowedLateness must not be negative"))
+	}
+	if option.IdleTimeout < 0 {
+		option.IdleTimeout = 0
+		Log.Warnf("idleTimeout is negative, set to 0")
+		errs = errors.Join(errs, errors.New("invalidIdleTimeout:idleTimeout must not be negative"))
+	}
+	switch option.GapFill {
+	case "", "null", "previous", "linear":
+	default:
+		Log.Warnf("gapFill %s is invalid, set to empty", option.GapFill)
+		option.GapFill = ""
+		errs = errors.Join(errs, errors.New("invalidGapFill:gapFill must be null, previous or linear"))
+	}
+	if option.GapFillMaxGap < 0 {
+		option.GapFillMaxGap = 0
+		Log.Warnf("gapFillMaxGap is negative, set to 0")
+		errs = errors.Join(errs, errors.New("invalidGapFillMaxGap:gapFillMaxGap must not be negative"))
+	}
 	if option.Restart != nil {
 		if option.Restart.Multiplier <= 0 {
 			option.Restart.Multiplier = 2
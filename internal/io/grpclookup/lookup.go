@@ -0,0 +1,241 @@
+// Copyright 2023 EMQ Technologies Co., Ltd.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package grpclookup
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/jhump/protoreflect/desc"
+	"github.com/jhump/protoreflect/desc/protoparse"
+	"github.com/jhump/protoreflect/dynamic"
+	"github.com/jhump/protoreflect/dynamic/grpcdynamic"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/status"
+
+	"github.com/lf-edge/ekuiper/internal/conf"
+	"github.com/lf-edge/ekuiper/internal/converter/protobuf"
+	"github.com/lf-edge/ekuiper/pkg/api"
+	"github.com/lf-edge/ekuiper/pkg/cast"
+)
+
+var protoParser *protoparse.Parser
+
+func init() {
+	etcDir, _ := conf.GetLoc("etc/schemas/protobuf/")
+	dataDir, _ := conf.GetLoc("data/schemas/protobuf/")
+	protoParser = &protoparse.Parser{ImportPaths: []string{etcDir, dataDir}}
+}
+
+type lookupConf struct {
+	// Address is the host:port of the gRPC server
+	Address string `json:"address"`
+	// ProtoFile is the proto file defining the service, relative to the protobuf schema folders
+	ProtoFile string `json:"protoFile"`
+	// Service is the full name of the service. It can be omitted if the proto file defines only one service
+	Service string `json:"service"`
+	// KeyFields maps the lookup keys to the request fields. The keys not mapped are set to the fields of the same name
+	KeyFields map[string]string `json:"keyFields"`
+	// ResultField is the response field of the rows, which is a message or a repeated message. If not set, the
+	// response message is the row
+	ResultField string `json:"resultField"`
+	// Timeout is the timeout in milliseconds of each call
+	Timeout int `json:"timeout"`
+}
+
+// lookupSource calls a unary method of a gRPC service for each lookup. The datasource is the method name. The lookup
+// values are set to the request fields, and the response is decoded into the rows
+type lookupSource struct {
+	c      *lookupConf
+	method *desc.MethodDescriptor
+	fc     *protobuf.FieldConverter
+	conn   *grpc.ClientConn
+	stub   grpcdynamic.Stub
+}
+
+func GetLookupSource() api.LookupSource {
+	return &lookupSource{}
+}
+
+func (s *lookupSource) Configure(datasource string, props map[string]interface{}) error {
+	c := &lookupConf{Timeout: 5000}
+	if err := cast.MapToStruct(props, c); err != nil {
+		return fmt.Errorf("read properties %v fail with error: %v", props, err)
+	}
+	if c.Address == "" {
+		return fmt.Errorf("address is required")
+	}
+	if c.ProtoFile == "" {
+		return fmt.Errorf("protoFile is required")
+	}
+	if datasource == "" {
+		return fmt.Errorf("the datasource must be the method name")
+	}
+	if c.Timeout <= 0 {
+		return fmt.Errorf("invalid timeout %d, must be positive", c.Timeout)
+	}
+	fds, err := protoParser.ParseFiles(c.ProtoFile)
+	if err != nil {
+		return fmt.Errorf("parse proto file %s failed: %s", c.ProtoFile, err)
+	}
+	var sd *desc.ServiceDescriptor
+	if c.Service != "" {
+		sd = fds[0].FindService(c.Service)
+		if sd == nil {
+			return fmt.Errorf("service %s not found in proto file %s", c.Service, c.ProtoFile)
+		}
+	} else {
+		services := fds[0].GetServices()
+		if len(services) != 1 {
+			return fmt.Errorf("service is required since proto file %s defines %d services", c.ProtoFile, len(services))
+		}
+		sd = services[0]
+	}
+	md := sd.FindMethodByName(datasource)
+	if md == nil {
+		return fmt.Errorf("method %s not found in service %s", datasource, sd.GetFullyQualifiedName())
+	}
+	if md.IsClientStreaming() || md.IsServerStreaming() {
+		return fmt.Errorf("method %s must be unary", datasource)
+	}
+	if c.ResultField != "" {
+		f := md.GetOutputType().FindFieldByName(c.ResultField)
+		if f == nil {
+			return fmt.Errorf("resultField %s not found in message %s", c.ResultField, md.GetOutputType().GetFullyQualifiedName())
+		}
+		if f.GetMessageType() == nil || f.IsMap() {
+			return fmt.Errorf("resultField %s must be a message or a repeated message", c.ResultField)
+		}
+	}
+	s.c = c
+	s.method = md
+	s.fc = protobuf.GetFieldConverter()
+	conf.Log.Infof("Initialized grpc lookup table with method %s and configurations %#v.", md.GetFullyQualifiedName(), c)
+	return nil
+}
+
+// Open creates the connection which connects in background and reconnects automatically, so that the rule can start
+// before the service is available
+func (s *lookupSource) Open(ctx api.StreamContext) error {
+	ctx.GetLogger().Infof("Opening grpc lookup source to %s", s.c.Address)
+	conn, err := grpc.DialContext(ctx, s.c.Address, grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		return fmt.Errorf("fail to connect to %s: %v", s.c.Address, err)
+	}
+	s.conn = conn
+	s.stub = grpcdynamic.NewStubWithMessageFactory(conn, dynamic.NewMessageFactoryWithDefaults())
+	return nil
+}
+
+// Lookup calls the method with the request of the lookup values. A response of status NotFound means no row
+func (s *lookupSource) Lookup(ctx api.StreamContext, _ []string, keys []string, values []interface{}) ([]api.SourceTuple, error) {
+	req, err := s.request(keys, values)
+	if err != nil {
+		return nil, err
+	}
+	tctx, cancel := context.WithTimeout(ctx, time.Duration(s.c.Timeout)*time.Millisecond)
+	defer cancel()
+	resp, err := s.stub.InvokeRpc(tctx, s.method, req)
+	if err != nil {
+		if status.Code(err) == codes.NotFound {
+			return []api.SourceTuple{}, nil
+		}
+		return nil, fmt.Errorf("fail to invoke method %s: %v", s.method.GetName(), err)
+	}
+	dm, err := dynamic.AsDynamicMessage(resp)
+	if err != nil {
+		return nil, fmt.Errorf("fail to parse the response of method %s: %v", s.method.GetName(), err)
+	}
+	rows, err := s.rows(s.fc.DecodeMessage(dm, s.method.GetOutputType()))
+	if err != nil {
+		return nil, err
+	}
+	rcvTime := conf.GetNow()
+	results := make([]api.SourceTuple, 0, len(rows))
+	for _, r := range rows {
+		results = append(results, api.NewDefaultSourceTupleWithTime(r, nil, rcvTime))
+	}
+	return results, nil
+}
+
+// request builds the request message by setting the lookup values to the mapped fields
+func (s *lookupSource) request(keys []string, values []interface{}) (*dynamic.Message, error) {
+	it := s.method.GetInputType()
+	req := dynamic.NewMessage(it)
+	for i, k := range keys {
+		fn := k
+		if m, ok := s.c.KeyFields[k]; ok {
+			fn = m
+		}
+		f := it.FindFieldByName(fn)
+		if f == nil {
+			return nil, fmt.Errorf("request message %s has no field %s for lookup key %s", it.GetFullyQualifiedName(), fn, k)
+		}
+		if values[i] == nil {
+			continue
+		}
+		v, err := s.fc.EncodeField(f, values[i])
+		if err != nil {
+			return nil, fmt.Errorf("fail to set lookup key %s to field %s: %v", k, fn, err)
+		}
+		if err := req.TrySetField(f, v); err != nil {
+			return nil, fmt.Errorf("fail to set lookup key %s to field %s: %v", k, fn, err)
+		}
+	}
+	return req, nil
+}
+
+// rows extracts the rows from the decoded response by the result field
+func (s *lookupSource) rows(resp interface{}) ([]map[string]interface{}, error) {
+	r := resp
+	if s.c.ResultField != "" {
+		m, ok := resp.(map[string]interface{})
+		if !ok {
+			return nil, fmt.Errorf("the response of method %s must be a message but got %v", s.method.GetName(), resp)
+		}
+		r = m[s.c.ResultField]
+	}
+	switch rt := r.(type) {
+	case nil:
+		return nil, nil
+	case map[string]interface{}:
+		return []map[string]interface{}{rt}, nil
+	case []map[string]interface{}:
+		return rt, nil
+	case []interface{}:
+		rows := make([]map[string]interface{}, 0, len(rt))
+		for _, e := range rt {
+			m, ok := e.(map[string]interface{})
+			if !ok {
+				return nil, fmt.Errorf("the result of method %s must be rows but got %v", s.method.GetName(), e)
+			}
+			rows = append(rows, m)
+		}
+		return rows, nil
+	default:
+		return nil, fmt.Errorf("the result of method %s must be rows but got %v", s.method.GetName(), r)
+	}
+}
+
+func (s *lookupSource) Close(ctx api.StreamContext) error {
+	ctx.GetLogger().Infof("Closing grpc lookup source")
+	if s.conn != nil {
+		return s.conn.Close()
+	}
+	return nil
+}
@@ -0,0 +1,217 @@
+// Copyright 2023 EMQ Technologies Co., Ltd.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package grpclookup
+
+import (
+	gocontext "context"
+	"net"
+	"testing"
+
+	"github.com/jhump/protoreflect/desc"
+	"github.com/jhump/protoreflect/desc/protoparse"
+	"github.com/jhump/protoreflect/dynamic"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/lf-edge/ekuiper/internal/topo/context"
+)
+
+var devices = []map[string]interface{}{
+	{"id": int64(1), "name": "device1", "region": "east"},
+	{"id": int64(2), "name": "device2", "region": "west"},
+	{"id": int64(3), "name": "device3", "region": "east"},
+}
+
+func newDevice(md *desc.MessageDescriptor, d map[string]interface{}) *dynamic.Message {
+	m := dynamic.NewMessage(md)
+	for k, v := range d {
+		m.SetFieldByName(k, v)
+	}
+	return m
+}
+
+// mockServer serves the test service with dynamic messages
+func mockServer(t *testing.T) string {
+	fds, err := protoParser.ParseFiles("lookup.proto")
+	require.NoError(t, err)
+	sd := fds[0].FindService("lookup.DeviceService")
+	get := sd.FindMethodByName("GetDevice")
+	list := sd.FindMethodByName("ListDevices")
+	s := grpc.NewServer()
+	s.RegisterService(&grpc.ServiceDesc{
+		ServiceName: sd.GetFullyQualifiedName(),
+		HandlerType: (*interface{})(nil),
+		Methods: []grpc.MethodDesc{
+			{
+				MethodName: get.GetName(),
+				Handler: func(_ interface{}, _ gocontext.Context, dec func(interface{}) error, _ grpc.UnaryServerInterceptor) (interface{}, error) {
+					req := dynamic.NewMessage(get.GetInputType())
+					if err := dec(req); err != nil {
+						return nil, err
+					}
+					id := req.GetFieldByName("id").(int64)
+					for _, d := range devices {
+						if d["id"] == id {
+							return newDevice(get.GetOutputType(), d), nil
+						}
+					}
+					return nil, status.Errorf(codes.NotFound, "device %d not found", id)
+				},
+			}, {
+				MethodName: list.GetName(),
+				Handler: func(_ interface{}, _ gocontext.Context, dec func(interface{}) error, _ grpc.UnaryServerInterceptor) (interface{}, error) {
+					req := dynamic.NewMessage(list.GetInputType())
+					if err := dec(req); err != nil {
+						return nil, err
+					}
+					region := req.GetFieldByName("region").(string)
+					resp := dynamic.NewMessage(list.GetOutputType())
+					for _, d := range devices {
+						if d["region"] == region {
+							resp.AddRepeatedFieldByName("devices", newDevice(get.GetOutputType(), d))
+						}
+					}
+					return resp, nil
+				},
+			},
+		},
+	}, struct{}{})
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	go func() {
+		_ = s.Serve(lis)
+	}()
+	t.Cleanup(s.Stop)
+	return lis.Addr().String()
+}
+
+func TestLookup(t *testing.T) {
+	protoParser = &protoparse.Parser{ImportPaths: []string{"test"}}
+	addr := mockServer(t)
+	ctx := context.Background()
+	tests := []struct {
+		name       string
+		datasource string
+		props      map[string]interface{}
+		keys       []string
+		values     []interface{}
+		result     []map[string]interface{}
+	}{
+		{
+			name:       "single row",
+			datasource: "GetDevice",
+			props:      map[string]interface{}{},
+			keys:       []string{"id"},
+			values:     []interface{}{2},
+			result:     []map[string]interface{}{devices[1]},
+		}, {
+			name:       "not found",
+			datasource: "GetDevice",
+			props:      map[string]interface{}{},
+			keys:       []string{"id"},
+			values:     []interface{}{4},
+			result:     []map[string]interface{}{},
+		}, {
+			name:       "mapped key and result field",
+			datasource: "ListDevices",
+			props: map[string]interface{}{
+				"service":     "lookup.DeviceService",
+				"keyFields":   map[string]interface{}{"area": "region"},
+				"resultField": "devices",
+			},
+			keys:   []string{"area"},
+			values: []interface{}{"east"},
+			result: []map[string]interface{}{devices[0], devices[2]},
+		}, {
+			name:       "no rows",
+			datasource: "ListDevices",
+			props:      map[string]interface{}{"resultField": "devices"},
+			keys:       []string{"region"},
+			values:     []interface{}{"north"},
+			result:     []map[string]interface{}{},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.props["address"] = addr
+			tt.props["protoFile"] = "lookup.proto"
+			ls := GetLookupSource()
+			require.NoError(t, ls.Configure(tt.datasource, tt.props))
+			require.NoError(t, ls.Open(ctx))
+			defer ls.Close(ctx)
+			r, err := ls.Lookup(ctx, nil, tt.keys, tt.values)
+			require.NoError(t, err)
+			result := make([]map[string]interface{}, 0, len(r))
+			for _, st := range r {
+				result = append(result, st.Message())
+			}
+			require.Equal(t, tt.result, result)
+		})
+	}
+}
+
+func TestLookupUnknownKey(t *testing.T) {
+	protoParser = &protoparse.Parser{ImportPaths: []string{"test"}}
+	ctx := context.Background()
+	ls := GetLookupSource()
+	require.NoError(t, ls.Configure("GetDevice", map[string]interface{}{
+		"address":   "127.0.0.1:1",
+		"protoFile": "lookup.proto",
+	}))
+	require.NoError(t, ls.Open(ctx))
+	defer ls.Close(ctx)
+	_, err := ls.Lookup(ctx, nil, []string{"name"}, []interface{}{"device1"})
+	require.EqualError(t, err, "request message lookup.DeviceRequest has no field name for lookup key name")
+}
+
+func TestConfigure(t *testing.T) {
+	protoParser = &protoparse.Parser{ImportPaths: []string{"test"}}
+	tests := []struct {
+		name       string
+		datasource string
+		props      map[string]interface{}
+		err        string
+	}{
+		{
+			name:       "no address",
+			datasource: "GetDevice",
+			props:      map[string]interface{}{"protoFile": "lookup.proto"},
+			err:        "address is required",
+		}, {
+			name:       "unknown method",
+			datasource: "GetDevices",
+			props:      map[string]interface{}{"address": "127.0.0.1:1", "protoFile": "lookup.proto"},
+			err:        "method GetDevices not found in service lookup.DeviceService",
+		}, {
+			name:       "unknown service",
+			datasource: "GetDevice",
+			props:      map[string]interface{}{"address": "127.0.0.1:1", "protoFile": "lookup.proto", "service": "lookup.Unknown"},
+			err:        "service lookup.Unknown not found in proto file lookup.proto",
+		}, {
+			name:       "invalid result field",
+			datasource: "GetDevice",
+			props:      map[string]interface{}{"address": "127.0.0.1:1", "protoFile": "lookup.proto", "resultField": "name"},
+			err:        "resultField name must be a message or a repeated message",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := GetLookupSource().Configure(tt.datasource, tt.props)
+			require.EqualError(t, err, tt.err)
+		})
+	}
+}
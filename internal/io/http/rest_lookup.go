@@ -0,0 +1,161 @@
+// Copyright 2023 EMQ Technologies Co., Ltd.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package http
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/lf-edge/ekuiper/internal/conf"
+	"github.com/lf-edge/ekuiper/internal/pkg/httpx"
+	"github.com/lf-edge/ekuiper/pkg/api"
+	"github.com/lf-edge/ekuiper/pkg/cast"
+)
+
+type restLookupConf struct {
+	// ResultPath is the json path to extract the rows from the response body, such as $.data.items
+	ResultPath string `json:"resultPath"`
+}
+
+// restLookupSource sends a request for each lookup with the url, body and headers templated by the lookup values,
+// so that the lookup table is backed by a REST service querying by the keys. Unlike the httppull lookup source, the
+// rows are not filtered since the service already queries by the keys
+type restLookupSource struct {
+	*ClientConf
+	resultPath conf.JsonPathEval
+}
+
+func GetRestLookupSource() api.LookupSource {
+	return &restLookupSource{}
+}
+
+func (l *restLookupSource) Configure(datasource string, props map[string]interface{}) error {
+	conf.Log.Infof("Initialized http lookup table with configurations %#v.", props)
+	if l.ClientConf == nil {
+		l.ClientConf = &ClientConf{}
+	}
+	if err := l.InitConf(datasource, props); err != nil {
+		return err
+	}
+	// the response of each lookup is always processed
+	l.config.Incremental = false
+	c := &restLookupConf{}
+	if err := cast.MapToStruct(props, c); err != nil {
+		return fmt.Errorf("fail to parse the properties: %v", err)
+	}
+	if c.ResultPath != "" {
+		e, err := conf.GetJsonPathEval(c.ResultPath)
+		if err != nil {
+			return fmt.Errorf("invalid resultPath %s: %v", c.ResultPath, err)
+		}
+		l.resultPath = e
+	}
+	return nil
+}
+
+func (l *restLookupSource) Open(ctx api.StreamContext) error {
+	ctx.GetLogger().Infof("http lookup source is opened")
+	return nil
+}
+
+// Lookup sends the request templated by the lookup values. The template data is the map of the keys to the values,
+// along with the oAuth tokens if any. A response of 404 means no row
+func (l *restLookupSource) Lookup(ctx api.StreamContext, _ []string, keys []string, values []interface{}) ([]api.SourceTuple, error) {
+	if l.accessConf != nil && l.accessConf.ExpireInSecond > 0 &&
+		int(conf.GetNow().Sub(l.tokenLastUpdateAt).Abs().Seconds()) >= l.accessConf.ExpireInSecond {
+		ctx.GetLogger().Debugf("Refreshing token for http lookup")
+		if err := l.refresh(ctx); err != nil {
+			ctx.GetLogger().Warnf("Refresh http lookup token error: %v", err)
+		}
+	}
+	data := make(map[string]interface{}, len(l.tokens)+len(keys))
+	for k, v := range l.tokens {
+		data[k] = v
+	}
+	for i, k := range keys {
+		data[k] = values[i]
+	}
+	u, err := ctx.ParseTemplate(l.config.Url, data)
+	if err != nil {
+		return nil, fmt.Errorf("fail to parse the url template %s: %v", l.config.Url, err)
+	}
+	var body interface{}
+	if l.config.Body != "" {
+		body, err = ctx.ParseTemplate(l.config.Body, data)
+		if err != nil {
+			return nil, fmt.Errorf("fail to parse the body template %s: %v", l.config.Body, err)
+		}
+	}
+	headers, err := l.parseHeaders(ctx, data)
+	if err != nil {
+		return nil, err
+	}
+	ctx.GetLogger().Debugf("http lookup source sending request url: %s, headers: %v, body %v", u, headers, body)
+	resp, err := httpx.Send(ctx.GetLogger(), l.client, l.config.BodyType, l.config.Method, u, headers, true, body)
+	if err != nil {
+		return nil, fmt.Errorf("fail to send the lookup request to %s: %v", u, err)
+	}
+	if resp.StatusCode == http.StatusNotFound {
+		_ = resp.Body.Close()
+		return []api.SourceTuple{}, nil
+	}
+	rows, raw, err := l.parseResponse(ctx, resp, true, nil)
+	if err != nil {
+		return nil, err
+	}
+	if l.resultPath != nil {
+		rows, err = l.extract(raw)
+		if err != nil {
+			return nil, err
+		}
+	}
+	rcvTime := conf.GetNow()
+	results := make([]api.SourceTuple, 0, len(rows))
+	for _, r := range rows {
+		results = append(results, api.NewDefaultSourceTupleWithTime(r, nil, rcvTime))
+	}
+	return results, nil
+}
+
+// extract evaluates the result path against the response body. The result could be a row or a list of rows
+func (l *restLookupSource) extract(raw []byte) ([]map[string]interface{}, error) {
+	r, err := l.resultPath.Eval(string(raw))
+	if err != nil {
+		return nil, fmt.Errorf("%s: fail to extract the result path: %v", BODY_ERR, err)
+	}
+	switch rt := r.(type) {
+	case nil:
+		return nil, nil
+	case map[string]interface{}:
+		return []map[string]interface{}{rt}, nil
+	case []interface{}:
+		rows := make([]map[string]interface{}, 0, len(rt))
+		for _, e := range rt {
+			m, ok := e.(map[string]interface{})
+			if !ok {
+				return nil, fmt.Errorf("%s: the result path must be rows but got %v", BODY_ERR, e)
+			}
+			rows = append(rows, m)
+		}
+		return rows, nil
+	default:
+		return nil, fmt.Errorf("%s: the result path must be rows but got %v", BODY_ERR, r)
+	}
+}
+
+func (l *restLookupSource) Close(ctx api.StreamContext) error {
+	ctx.GetLogger().Infof("Closing http lookup table")
+	return nil
+}
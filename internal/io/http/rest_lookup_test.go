@@ -0,0 +1,124 @@
+// Copyright 2023 EMQ Technologies Co., Ltd.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package http
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/lf-edge/ekuiper/internal/topo/context"
+)
+
+func mockRestLookupServer() *httptest.Server {
+	devices := map[string][]map[string]interface{}{
+		"1": {{"id": 1, "name": "device1"}},
+		"2": {{"id": 2, "name": "device2"}, {"id": 2, "name": "device2b"}},
+	}
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer abc" {
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		id := strings.TrimPrefix(r.URL.Path, "/devices/")
+		if r.Method == http.MethodPost {
+			body, _ := io.ReadAll(r.Body)
+			m := make(map[string]interface{})
+			_ = json.Unmarshal(body, &m)
+			id = m["id"].(string)
+		}
+		d, ok := devices[id]
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		jsonOut(w, map[string]interface{}{"data": map[string]interface{}{"items": d}})
+	}))
+}
+
+func TestRestLookup(t *testing.T) {
+	server := mockRestLookupServer()
+	defer server.Close()
+	ctx := context.Background()
+	tests := []struct {
+		name  string
+		props map[string]interface{}
+		value interface{}
+		names []interface{}
+	}{
+		{
+			name: "templated url",
+			props: map[string]interface{}{
+				"url":        server.URL + "/devices/{{.id}}",
+				"headers":    map[string]interface{}{"Authorization": "Bearer abc"},
+				"resultPath": "$.data.items",
+			},
+			value: 2,
+			names: []interface{}{"device2", "device2b"},
+		}, {
+			name: "templated post body",
+			props: map[string]interface{}{
+				"url":        server.URL + "/devices",
+				"method":     "post",
+				"body":       `{"id": "{{.id}}"}`,
+				"headers":    map[string]interface{}{"Authorization": "Bearer abc"},
+				"resultPath": "$.data.items[0]",
+			},
+			value: 1,
+			names: []interface{}{"device1"},
+		}, {
+			name: "not found",
+			props: map[string]interface{}{
+				"url":        server.URL + "/devices/{{.id}}",
+				"headers":    map[string]interface{}{"Authorization": "Bearer abc"},
+				"resultPath": "$.data.items",
+			},
+			value: 3,
+		}, {
+			name: "no result path",
+			props: map[string]interface{}{
+				"url":     server.URL + "/devices/{{.id}}",
+				"headers": map[string]interface{}{"Authorization": "Bearer abc"},
+			},
+			value: 1,
+			names: []interface{}{nil},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ls := GetRestLookupSource()
+			require.NoError(t, ls.Configure("", tt.props))
+			require.NoError(t, ls.Open(ctx))
+			defer ls.Close(ctx)
+			r, err := ls.Lookup(ctx, nil, []string{"id"}, []interface{}{tt.value})
+			require.NoError(t, err)
+			var names []interface{}
+			for _, st := range r {
+				names = append(names, st.Message()["name"])
+			}
+			require.Equal(t, tt.names, names)
+		})
+	}
+	ls := GetRestLookupSource()
+	require.NoError(t, ls.Configure("", map[string]interface{}{"url": server.URL + "/devices/{{.id}}"}))
+	_, err := ls.Lookup(ctx, nil, []string{"id"}, []interface{}{1})
+	require.EqualError(t, err, "response code error: 401")
+	require.Error(t, GetRestLookupSource().Configure("", map[string]interface{}{"url": server.URL, "resultPath": "$.data["}))
+}
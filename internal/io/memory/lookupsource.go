@@ -64,6 +64,19 @@ func (s *lookupsource) Lookup(ctx api.StreamContext, _ []string, keys []string,
 	return s.table.Read(keys, values)
 }
 
+// Scan returns all the rows of the table
+func (s *lookupsource) Scan(ctx api.StreamContext, _ []string) ([]api.SourceTuple, error) {
+	ctx.GetLogger().Debugf("lookup source %s is scanning", s.topic)
+	return s.table.Scan(), nil
+}
+
+// Subscribe notifies the primary key value of each updated or deleted row of the table
+func (s *lookupsource) Subscribe(handler func(key string, value interface{})) func() {
+	return s.table.Subscribe(func(keyval interface{}) {
+		handler(s.key, keyval)
+	})
+}
+
 func (s *lookupsource) Close(ctx api.StreamContext) error {
 	ctx.GetLogger().Infof("lookup source %s is closing", s.topic)
 	return store.Unreg(s.topic, s.key)
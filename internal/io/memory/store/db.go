@@ -113,6 +113,10 @@ type Table struct {
 	// datamap is the overall data indexed by primary key
 	datamap map[interface{}]api.SourceTuple
 	cancel  context.CancelFunc
+	// subscribers are notified with the primary key value after each change
+	subMu       sync.RWMutex
+	subscribers map[int]func(keyval interface{})
+	subId       int
 }
 
 func createTable(topic string, key string) *Table {
@@ -122,18 +126,58 @@ func createTable(topic string, key string) *Table {
 
 func (t *Table) add(value api.SourceTuple) {
 	t.Lock()
-	defer t.Unlock()
 	keyval, ok := value.Message()[t.key]
 	if !ok {
 		conf.Log.Errorf("add to table %s omitted, value not found for key %s", t.topic, t.key)
 	}
 	t.datamap[keyval] = value
+	t.Unlock()
+	t.notify(keyval)
 }
 
 func (t *Table) delete(key interface{}) {
 	t.Lock()
-	defer t.Unlock()
 	delete(t.datamap, key)
+	t.Unlock()
+	t.notify(key)
+}
+
+// Subscribe registers a handler which is called with the primary key value of each changed row.
+// The handler is called synchronously by the table writer, so it must not block.
+// It returns a function to unsubscribe.
+func (t *Table) Subscribe(handler func(keyval interface{})) func() {
+	t.subMu.Lock()
+	defer t.subMu.Unlock()
+	if t.subscribers == nil {
+		t.subscribers = make(map[int]func(keyval interface{}))
+	}
+	t.subId++
+	id := t.subId
+	t.subscribers[id] = handler
+	return func() {
+		t.subMu.Lock()
+		defer t.subMu.Unlock()
+		delete(t.subscribers, id)
+	}
+}
+
+func (t *Table) notify(keyval interface{}) {
+	t.subMu.RLock()
+	defer t.subMu.RUnlock()
+	for _, h := range t.subscribers {
+		h(keyval)
+	}
+}
+
+// Scan returns all the rows of the table
+func (t *Table) Scan() []api.SourceTuple {
+	t.RLock()
+	defer t.RUnlock()
+	result := make([]api.SourceTuple, 0, len(t.datamap))
+	for _, v := range t.datamap {
+		result = append(result, v)
+	}
+	return result
 }
 
 func (t *Table) Read(keys []string, values []interface{}) ([]api.SourceTuple, error) {
@@ -86,6 +86,9 @@ func TestTable(t *testing.T) {
 	if v != nil {
 		t.Errorf("read a 1 expect nil, but got %v", v)
 	}
+	if v = tb.Scan(); len(v) != 2 {
+		t.Errorf("scan expect 2 rows, but got %v", v)
+	}
 }
 
 func TestDb(t *testing.T) {
@@ -134,3 +137,20 @@ func TestDb(t *testing.T) {
 		return
 	}
 }
+
+func TestTableSubscribe(t *testing.T) {
+	tb := createTable("topicS", "a")
+	var changed []interface{}
+	unsubscribe := tb.Subscribe(func(keyval interface{}) {
+		changed = append(changed, keyval)
+	})
+	tb.add(api.NewDefaultSourceTuple(map[string]interface{}{"a": 1, "b": "0"}, nil))
+	tb.add(api.NewDefaultSourceTuple(map[string]interface{}{"a": 2, "b": "0"}, nil))
+	tb.delete(1)
+	unsubscribe()
+	tb.add(api.NewDefaultSourceTuple(map[string]interface{}{"a": 3, "b": "0"}, nil))
+	exp := []interface{}{1, 2, 1}
+	if !reflect.DeepEqual(changed, exp) {
+		t.Errorf("expect changes %v, but got %v", exp, changed)
+	}
+}
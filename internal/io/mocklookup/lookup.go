@@ -0,0 +1,153 @@
+// Copyright 2023 EMQ Technologies Co., Ltd.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mocklookup
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+
+	"github.com/lf-edge/ekuiper/internal/conf"
+	"github.com/lf-edge/ekuiper/pkg/api"
+	"github.com/lf-edge/ekuiper/pkg/cast"
+)
+
+type lookupConf struct {
+	Data []map[string]interface{} `json:"data"`
+}
+
+// lookupSource is an in-memory lookup source which serves the static rows in the props. It is deterministic and
+// requires no external system, so it is used to test the rules with lookup tables.
+type lookupSource struct {
+	datasource string
+	data       []map[string]interface{}
+}
+
+func GetLookupSource() api.LookupSource {
+	return &lookupSource{}
+}
+
+func (s *lookupSource) Configure(datasource string, props map[string]interface{}) error {
+	c := &lookupConf{}
+	if err := cast.MapToStruct(props, c); err != nil {
+		return fmt.Errorf("read properties %v fail with error: %v", props, err)
+	}
+	s.datasource = datasource
+	s.data = c.Data
+	return nil
+}
+
+func (s *lookupSource) Open(ctx api.StreamContext) error {
+	ctx.GetLogger().Infof("mock lookup source %s is opened with %d rows", s.datasource, len(s.data))
+	return nil
+}
+
+// Lookup returns the rows whose values of all the keys equal to the values. The numbers are compared by value
+// regardless of the type, so that the int values in the rule match the float values decoded from json props.
+func (s *lookupSource) Lookup(ctx api.StreamContext, fields []string, keys []string, values []interface{}) ([]api.SourceTuple, error) {
+	return s.LookupRange(ctx, fields, keys, values, nil)
+}
+
+func (s *lookupSource) LookupRange(ctx api.StreamContext, fields []string, keys []string, values []interface{}, ranges []api.LookupRange) ([]api.SourceTuple, error) {
+	ctx.GetLogger().Debugf("mock lookup source %s is looking up keys %v with values %v and ranges %v", s.datasource, keys, values, ranges)
+	var result []api.SourceTuple
+	for _, row := range s.data {
+		if !matchRow(row, keys, values) || !inRanges(row, ranges) {
+			continue
+		}
+		msg := make(map[string]interface{}, len(row))
+		if len(fields) > 0 {
+			for _, f := range fields {
+				if v, ok := row[f]; ok {
+					msg[f] = v
+				}
+			}
+		} else {
+			for k, v := range row {
+				msg[k] = v
+			}
+		}
+		result = append(result, api.NewDefaultSourceTupleWithTime(msg, nil, conf.GetNow()))
+	}
+	return result, nil
+}
+
+// Scan returns all the rows
+func (s *lookupSource) Scan(ctx api.StreamContext, fields []string) ([]api.SourceTuple, error) {
+	return s.Lookup(ctx, fields, nil, nil)
+}
+
+func (s *lookupSource) Close(ctx api.StreamContext) error {
+	ctx.GetLogger().Infof("mock lookup source %s is closing", s.datasource)
+	return nil
+}
+
+func matchRow(row map[string]interface{}, keys []string, values []interface{}) bool {
+	for i, k := range keys {
+		v, ok := row[k]
+		if !ok || !equals(v, values[i]) {
+			return false
+		}
+	}
+	return true
+}
+
+func inRanges(row map[string]interface{}, ranges []api.LookupRange) bool {
+	for _, r := range ranges {
+		v, ok := row[r.Field]
+		if !ok || !compare(v, r.Op, r.Value) {
+			return false
+		}
+	}
+	return true
+}
+
+// compare compares the numbers by value and the others by the string format
+func compare(a interface{}, op string, b interface{}) bool {
+	var c int
+	fa, erra := cast.ToFloat64(a, cast.CONVERT_SAMEKIND)
+	fb, errb := cast.ToFloat64(b, cast.CONVERT_SAMEKIND)
+	if erra == nil && errb == nil {
+		switch {
+		case fa < fb:
+			c = -1
+		case fa > fb:
+			c = 1
+		}
+	} else {
+		c = strings.Compare(fmt.Sprintf("%v", a), fmt.Sprintf("%v", b))
+	}
+	switch op {
+	case "<":
+		return c < 0
+	case "<=":
+		return c <= 0
+	case ">":
+		return c > 0
+	case ">=":
+		return c >= 0
+	default:
+		return false
+	}
+}
+
+func equals(a, b interface{}) bool {
+	fa, erra := cast.ToFloat64(a, cast.CONVERT_SAMEKIND)
+	fb, errb := cast.ToFloat64(b, cast.CONVERT_SAMEKIND)
+	if erra == nil && errb == nil {
+		return fa == fb
+	}
+	return reflect.DeepEqual(a, b)
+}
@@ -0,0 +1,120 @@
+// Copyright 2023 EMQ Technologies Co., Ltd.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mocklookup
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/lf-edge/ekuiper/internal/conf"
+	"github.com/lf-edge/ekuiper/internal/topo/context"
+	"github.com/lf-edge/ekuiper/pkg/api"
+)
+
+func TestLookup(t *testing.T) {
+	contextLogger := conf.Log.WithField("rule", "test")
+	ctx := context.WithValue(context.Background(), context.LoggerKey, contextLogger)
+	ls := GetLookupSource()
+	err := ls.Configure("test", map[string]interface{}{
+		"data": []interface{}{
+			map[string]interface{}{"id": 1, "name": "a", "size": 10},
+			map[string]interface{}{"id": 2, "name": "b", "size": 20},
+			map[string]interface{}{"id": 2, "name": "c", "size": 30},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = ls.Open(ctx); err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		fields []string
+		keys   []string
+		values []interface{}
+		result []map[string]interface{}
+	}{
+		{
+			keys:   []string{"id"},
+			values: []interface{}{int64(1)},
+			result: []map[string]interface{}{{"id": 1, "name": "a", "size": 10}},
+		}, {
+			fields: []string{"name"},
+			keys:   []string{"id"},
+			values: []interface{}{2.0},
+			result: []map[string]interface{}{{"name": "b"}, {"name": "c"}},
+		}, {
+			fields: []string{"id", "size"},
+			keys:   []string{"id", "name"},
+			values: []interface{}{int64(2), "c"},
+			result: []map[string]interface{}{{"id": 2, "size": 30}},
+		}, {
+			keys:   []string{"name"},
+			values: []interface{}{"d"},
+		}, {
+			keys:   []string{"id"},
+			values: []interface{}{"1"},
+		},
+	}
+	for i, tt := range tests {
+		r, err := ls.Lookup(ctx, tt.fields, tt.keys, tt.values)
+		if err != nil {
+			t.Fatalf("%d: %v", i, err)
+		}
+		var result []map[string]interface{}
+		for _, st := range r {
+			result = append(result, st.Message())
+		}
+		if !reflect.DeepEqual(tt.result, result) {
+			t.Errorf("%d: expect %v but got %v", i, tt.result, result)
+		}
+	}
+	r, err := ls.(api.LookupScanner).Scan(ctx, []string{"name"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []interface{}
+	for _, st := range r {
+		names = append(names, st.Message()["name"])
+	}
+	if exp := []interface{}{"a", "b", "c"}; !reflect.DeepEqual(exp, names) {
+		t.Errorf("expect scanned names %v but got %v", exp, names)
+	}
+	r, err = ls.(api.LookupRanger).LookupRange(ctx, []string{"name"}, []string{"id"}, []interface{}{2}, []api.LookupRange{{Field: "size", Op: ">", Value: 20}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	names = nil
+	for _, st := range r {
+		names = append(names, st.Message()["name"])
+	}
+	if exp := []interface{}{"c"}; !reflect.DeepEqual(exp, names) {
+		t.Errorf("expect ranged names %v but got %v", exp, names)
+	}
+	r, err = ls.(api.LookupRanger).LookupRange(ctx, []string{"name"}, nil, nil, []api.LookupRange{{Field: "size", Op: ">=", Value: 10}, {Field: "size", Op: "<", Value: 30.0}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	names = nil
+	for _, st := range r {
+		names = append(names, st.Message()["name"])
+	}
+	if exp := []interface{}{"a", "b"}; !reflect.DeepEqual(exp, names) {
+		t.Errorf("expect ranged names %v but got %v", exp, names)
+	}
+	if err = ls.Close(ctx); err != nil {
+		t.Error(err)
+	}
+}
@@ -0,0 +1,158 @@
+// Copyright 2023 EMQ Technologies Co., Ltd.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build redisdb || !core
+
+package redis
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+
+	cnf "github.com/lf-edge/ekuiper/internal/conf"
+	"github.com/lf-edge/ekuiper/internal/topo/lookup/cache"
+	"github.com/lf-edge/ekuiper/pkg/api"
+	"github.com/lf-edge/ekuiper/pkg/cast"
+)
+
+type cacheConf struct {
+	Addr     string `json:"addr"`
+	Username string `json:"username"`
+	Password string `json:"password"`
+	Db       int    `json:"db"`
+	// KeyPrefix is prepended to the cache keys, default to ekuiper:lookup:{table}:
+	KeyPrefix string `json:"keyPrefix"`
+}
+
+// cachedTuple is the stored format of a cached source tuple
+type cachedTuple struct {
+	Message   map[string]interface{} `json:"message"`
+	Meta      map[string]interface{} `json:"meta,omitempty"`
+	Timestamp int64                  `json:"timestamp"`
+}
+
+// cacheBackend stores the lookup cache in redis so that it is shared by the instances and kept after restarts
+type cacheBackend struct {
+	cli    *redis.Client
+	prefix string
+}
+
+// NewCacheBackend creates the redis cache backend of the lookup table
+func NewCacheBackend(name string, props map[string]interface{}) (cache.Backend, error) {
+	cfg := &cacheConf{}
+	if err := cast.MapToStruct(props, cfg); err != nil {
+		return nil, err
+	}
+	if cfg.Addr == "" {
+		return nil, errors.New("redis addr is null")
+	}
+	if cfg.KeyPrefix == "" {
+		cfg.KeyPrefix = "ekuiper:lookup:" + name + ":"
+	}
+	cli := redis.NewClient(&redis.Options{
+		Addr:     cfg.Addr,
+		Username: cfg.Username,
+		Password: cfg.Password,
+		DB:       cfg.Db,
+	})
+	if err := cli.Ping(context.Background()).Err(); err != nil {
+		_ = cli.Close()
+		return nil, err
+	}
+	return &cacheBackend{cli: cli, prefix: cfg.KeyPrefix}, nil
+}
+
+func (b *cacheBackend) Get(key string) ([]api.SourceTuple, bool) {
+	res, err := b.cli.Get(context.Background(), b.prefix+key).Bytes()
+	if err != nil {
+		if err != redis.Nil {
+			cnf.Log.Warnf("redis cache get %s error: %v", key, err)
+		}
+		return nil, false
+	}
+	var cts []cachedTuple
+	if err := json.Unmarshal(res, &cts); err != nil {
+		cnf.Log.Warnf("redis cache decode %s error: %v", key, err)
+		return nil, false
+	}
+	r := make([]api.SourceTuple, 0, len(cts))
+	for _, ct := range cts {
+		r = append(r, api.NewDefaultSourceTupleWithTime(ct.Message, ct.Meta, time.UnixMilli(ct.Timestamp)))
+	}
+	return r, true
+}
+
+func (b *cacheBackend) Set(key string, value []api.SourceTuple, ttl time.Duration) {
+	data, err := encodeTuples(value)
+	if err != nil {
+		cnf.Log.Warnf("redis cache encode %s error: %v", key, err)
+		return
+	}
+	if err := b.cli.Set(context.Background(), b.prefix+key, data, ttl).Err(); err != nil {
+		cnf.Log.Warnf("redis cache set %s error: %v", key, err)
+	}
+}
+
+// SetIfAbsent stores the value only if the key does not exist for the first write wins policy
+func (b *cacheBackend) SetIfAbsent(key string, value []api.SourceTuple, ttl time.Duration) {
+	data, err := encodeTuples(value)
+	if err != nil {
+		cnf.Log.Warnf("redis cache encode %s error: %v", key, err)
+		return
+	}
+	if err := b.cli.SetNX(context.Background(), b.prefix+key, data, ttl).Err(); err != nil {
+		cnf.Log.Warnf("redis cache set %s error: %v", key, err)
+	}
+}
+
+func encodeTuples(value []api.SourceTuple) ([]byte, error) {
+	cts := make([]cachedTuple, 0, len(value))
+	for _, v := range value {
+		cts = append(cts, cachedTuple{Message: v.Message(), Meta: v.Meta(), Timestamp: v.Timestamp().UnixMilli()})
+	}
+	return json.Marshal(cts)
+}
+
+func (b *cacheBackend) Delete(key string) {
+	if err := b.cli.Del(context.Background(), b.prefix+key).Err(); err != nil {
+		cnf.Log.Warnf("redis cache delete %s error: %v", key, err)
+	}
+}
+
+// Clear deletes all the keys with the prefix
+func (b *cacheBackend) Clear() {
+	b.ClearPrefix("")
+}
+
+// ClearPrefix deletes the keys with the prefix of the namespace
+func (b *cacheBackend) ClearPrefix(prefix string) {
+	ctx := context.Background()
+	iter := b.cli.Scan(ctx, 0, b.prefix+prefix+"*", 100).Iterator()
+	for iter.Next(ctx) {
+		if err := b.cli.Del(ctx, iter.Val()).Err(); err != nil {
+			cnf.Log.Warnf("redis cache clear %s error: %v", iter.Val(), err)
+		}
+	}
+	if err := iter.Err(); err != nil {
+		cnf.Log.Warnf("redis cache clear error: %v", err)
+	}
+}
+
+func (b *cacheBackend) Close() {
+	_ = b.cli.Close()
+}
@@ -0,0 +1,98 @@
+// Copyright 2023 EMQ Technologies Co., Ltd.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build redisdb || !core
+
+package redis
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/lf-edge/ekuiper/pkg/api"
+)
+
+func TestCacheBackend(t *testing.T) {
+	if _, err := NewCacheBackend("table1", map[string]interface{}{}); err == nil {
+		t.Error("expect error for missing addr")
+	}
+	b, err := NewCacheBackend("table1", map[string]interface{}{"addr": addr})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer b.Close()
+	now := time.UnixMilli(time.Now().UnixMilli())
+	v := []api.SourceTuple{api.NewDefaultSourceTupleWithTime(map[string]interface{}{"id": 1.0, "name": "John"}, map[string]interface{}{"topic": "t1"}, now)}
+	b.Set("k1", v, 0)
+	b.Set("k2", []api.SourceTuple{}, time.Minute)
+	if !mr.Exists("ekuiper:lookup:table1:k1") {
+		t.Error("expect the key stored with the prefix of the table")
+	}
+	if ttl := mr.TTL("ekuiper:lookup:table1:k2"); ttl != time.Minute {
+		t.Errorf("expect ttl 1m but got %v", ttl)
+	}
+	if r, ok := b.Get("k1"); !ok || !reflect.DeepEqual(v, r) {
+		t.Errorf("expect %v but got %v", v, r)
+	}
+	if r, ok := b.Get("k2"); !ok || len(r) != 0 {
+		t.Errorf("expect the cached empty result but got %v, %v", r, ok)
+	}
+	b.Delete("k1")
+	if _, ok := b.Get("k1"); ok {
+		t.Error("k1 should be deleted")
+	}
+	b.Set("k1", v, 0)
+	b.Clear()
+	if mr.Exists("ekuiper:lookup:table1:k1") || mr.Exists("ekuiper:lookup:table1:k2") {
+		t.Error("expect all the keys of the table cleared")
+	}
+	if !mr.Exists("1") {
+		t.Error("expect the other keys kept")
+	}
+}
+
+func TestCacheBackendClearPrefix(t *testing.T) {
+	b, err := NewCacheBackend("table2", map[string]interface{}{"addr": addr})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer b.Close()
+	v := []api.SourceTuple{api.NewDefaultSourceTuple(map[string]interface{}{"id": 1.0}, nil)}
+	b.Set("k1", v, 0)
+	b.Set("test:k1", v, 0)
+	b.(*cacheBackend).ClearPrefix("test:")
+	if mr.Exists("ekuiper:lookup:table2:test:k1") {
+		t.Error("expect the keys of the namespace cleared")
+	}
+	if !mr.Exists("ekuiper:lookup:table2:k1") {
+		t.Error("expect the keys of the other namespaces kept")
+	}
+}
+
+func TestCacheBackendSetIfAbsent(t *testing.T) {
+	b, err := NewCacheBackend("table3", map[string]interface{}{"addr": addr})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer b.Close()
+	v1 := []api.SourceTuple{api.NewDefaultSourceTupleWithTime(map[string]interface{}{"id": 1.0}, nil, time.UnixMilli(1000))}
+	v2 := []api.SourceTuple{api.NewDefaultSourceTupleWithTime(map[string]interface{}{"id": 2.0}, nil, time.UnixMilli(1000))}
+	fw := b.(*cacheBackend)
+	fw.SetIfAbsent("k1", v1, time.Minute)
+	fw.SetIfAbsent("k1", v2, time.Minute)
+	if r, ok := b.Get("k1"); !ok || !reflect.DeepEqual(v1, r) {
+		t.Errorf("expect the first write %v but got %v", v1, r)
+	}
+}
@@ -21,6 +21,8 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
+	"strings"
+	"sync"
 
 	"github.com/redis/go-redis/v9"
 
@@ -36,11 +38,16 @@ type conf struct {
 	// Optional password. Must match the password specified in the
 	Password string `json:"password,omitempty"`
 	DataType string `json:"dataType,omitempty"`
+	// NotifyChanges subscribes the keyspace notifications of the db to notify the changed keys to the lookup nodes.
+	// It requires the notify-keyspace-events of the redis server to enable the keyspace events, such as "Kg$lx"
+	NotifyChanges bool `json:"notifyChanges,omitempty"`
 }
 
 type lookupSource struct {
-	c   *conf
-	db  int
+	c  *conf
+	db int
+	// cli is released when idle and created again by the next lookup
+	sync.Mutex
 	cli *redis.Client
 }
 
@@ -66,16 +73,25 @@ func (s *lookupSource) Configure(datasource string, props map[string]interface{}
 		return errors.New("redis dataType must be string or list")
 	}
 	s.c = cfg
-	s.cli = redis.NewClient(&redis.Options{
-		Addr:     s.c.Addr,
-		Username: s.c.Username,
-		Password: s.c.Password,
-		DB:       s.db,
-	})
-	_, err = s.cli.Ping(context.Background()).Result()
+	_, err = s.client().Ping(context.Background()).Result()
 	return err
 }
 
+// client returns the redis client and creates it if released
+func (s *lookupSource) client() *redis.Client {
+	s.Lock()
+	defer s.Unlock()
+	if s.cli == nil {
+		s.cli = redis.NewClient(&redis.Options{
+			Addr:     s.c.Addr,
+			Username: s.c.Username,
+			Password: s.c.Password,
+			DB:       s.db,
+		})
+	}
+	return s.cli
+}
+
 func (s *lookupSource) Open(ctx api.StreamContext) error {
 	ctx.GetLogger().Infof("Opening redis lookup source with conf %v", s.c)
 	return nil
@@ -89,7 +105,7 @@ func (s *lookupSource) Lookup(ctx api.StreamContext, _ []string, keys []string,
 	}
 	v := fmt.Sprintf("%v", values[0])
 	if s.c.DataType == "string" {
-		res, err := s.cli.Get(ctx, v).Result()
+		res, err := s.client().Get(ctx, v).Result()
 		if err != nil {
 			if err == redis.Nil {
 				return []api.SourceTuple{}, nil
@@ -103,7 +119,7 @@ func (s *lookupSource) Lookup(ctx api.StreamContext, _ []string, keys []string,
 		}
 		return []api.SourceTuple{api.NewDefaultSourceTupleWithTime(m, nil, rcvTime)}, nil
 	} else {
-		res, err := s.cli.LRange(ctx, v, 0, -1).Result()
+		res, err := s.client().LRange(ctx, v, 0, -1).Result()
 		if err != nil {
 			if err == redis.Nil {
 				return []api.SourceTuple{}, nil
@@ -123,9 +139,112 @@ func (s *lookupSource) Lookup(ctx api.StreamContext, _ []string, keys []string,
 	}
 }
 
+// LookupBatch gets the values of the string keys by one MGET, or the lists by one pipeline
+func (s *lookupSource) LookupBatch(ctx api.StreamContext, _ []string, keys []string, values [][]interface{}) ([][]api.SourceTuple, error) {
+	rcvTime := cnf.GetNow()
+	ctx.GetLogger().Debugf("Batch lookup redis %v of %d values", keys, len(values))
+	if len(keys) != 1 {
+		return nil, fmt.Errorf("redis lookup only support one key, but got %v", keys)
+	}
+	ks := make([]string, len(values))
+	for i, v := range values {
+		ks[i] = fmt.Sprintf("%v", v[0])
+	}
+	result := make([][]api.SourceTuple, len(values))
+	if s.c.DataType == "string" {
+		res, err := s.client().MGet(ctx, ks...).Result()
+		if err != nil {
+			return nil, err
+		}
+		for i, r := range res {
+			str, ok := r.(string)
+			if !ok {
+				// the key does not exist
+				result[i] = []api.SourceTuple{}
+				continue
+			}
+			m := make(map[string]interface{})
+			if err := json.Unmarshal(cast.StringToBytes(str), &m); err != nil {
+				return nil, err
+			}
+			result[i] = []api.SourceTuple{api.NewDefaultSourceTupleWithTime(m, nil, rcvTime)}
+		}
+		return result, nil
+	}
+	cmds := make([]*redis.StringSliceCmd, len(ks))
+	_, err := s.client().Pipelined(ctx, func(p redis.Pipeliner) error {
+		for i, k := range ks {
+			cmds[i] = p.LRange(ctx, k, 0, -1)
+		}
+		return nil
+	})
+	if err != nil && err != redis.Nil {
+		return nil, err
+	}
+	for i, cmd := range cmds {
+		res, err := cmd.Result()
+		if err != nil && err != redis.Nil {
+			return nil, err
+		}
+		ret := make([]api.SourceTuple, 0, len(res))
+		for _, r := range res {
+			m := make(map[string]interface{})
+			if err := json.Unmarshal(cast.StringToBytes(r), &m); err != nil {
+				return nil, err
+			}
+			ret = append(ret, api.NewDefaultSourceTupleWithTime(m, nil, rcvTime))
+		}
+		result[i] = ret
+	}
+	return result, nil
+}
+
+// Subscribe notifies the changed redis keys by the keyspace notifications. It uses its own connection which is not
+// released when idle, so that the changes are not missed
+func (s *lookupSource) Subscribe(handler func(key string, value interface{})) func() {
+	if !s.c.NotifyChanges {
+		return nil
+	}
+	cli := redis.NewClient(&redis.Options{
+		Addr:     s.c.Addr,
+		Username: s.c.Username,
+		Password: s.c.Password,
+		DB:       s.db,
+	})
+	prefix := fmt.Sprintf("__keyspace@%d__:", s.db)
+	ps := cli.PSubscribe(context.Background(), prefix+"*")
+	ch := ps.Channel()
+	go func() {
+		for msg := range ch {
+			handler("", strings.TrimPrefix(msg.Channel, prefix))
+		}
+	}()
+	return func() {
+		_ = ps.Close()
+		_ = cli.Close()
+	}
+}
+
+// ReleaseIdle closes the connections when no rule is looking up the source
+func (s *lookupSource) ReleaseIdle(ctx api.StreamContext) error {
+	ctx.GetLogger().Infof("Releasing the idle connections of redis lookup source")
+	return s.release()
+}
+
+func (s *lookupSource) release() error {
+	s.Lock()
+	cli := s.cli
+	s.cli = nil
+	s.Unlock()
+	if cli == nil {
+		return nil
+	}
+	return cli.Close()
+}
+
 func (s *lookupSource) Close(ctx api.StreamContext) error {
 	ctx.GetLogger().Infof("Closing redis lookup source")
-	return s.cli.Close()
+	return s.release()
 }
 
 func GetLookupSource() api.LookupSource {
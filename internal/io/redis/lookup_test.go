@@ -19,6 +19,7 @@ package redis
 import (
 	"reflect"
 	"testing"
+	"time"
 
 	"github.com/alicebob/miniredis/v2"
 	"github.com/benbjohnson/clock"
@@ -154,3 +155,113 @@ func deepEqual(a []api.SourceTuple, b []api.SourceTuple) bool {
 	}
 	return true
 }
+
+func TestNotifyChanges(t *testing.T) {
+	contextLogger := econf.Log.WithField("rule", "test")
+	ctx := context.WithValue(context.Background(), context.LoggerKey, contextLogger)
+	ls := GetLookupSource()
+	err := ls.Configure("0", map[string]interface{}{"addr": addr, "datatype": "string"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if unsubscribe := ls.(api.LookupChangeNotifier).Subscribe(func(string, interface{}) {}); unsubscribe != nil {
+		t.Error("expect not to notify the changes by default")
+	}
+	ls = GetLookupSource()
+	err = ls.Configure("0", map[string]interface{}{"addr": addr, "datatype": "string", "notifyChanges": true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ls.Close(ctx)
+	changes := make(chan []interface{}, 10)
+	unsubscribe := ls.(api.LookupChangeNotifier).Subscribe(func(key string, value interface{}) {
+		changes <- []interface{}{key, value}
+	})
+	if unsubscribe == nil {
+		t.Fatal("expect to notify the changes")
+	}
+	defer unsubscribe()
+	// miniredis does not emit the keyspace events, so publish them like the redis server. Retry until subscribed
+	timeout := time.After(time.Second)
+	for {
+		mr.Publish("__keyspace@0__:1", "set")
+		select {
+		case c := <-changes:
+			if exp := []interface{}{"", "1"}; !reflect.DeepEqual(exp, c) {
+				t.Errorf("expect change %v but got %v", exp, c)
+			}
+			return
+		case <-time.After(10 * time.Millisecond):
+		case <-timeout:
+			t.Fatal("receive change timeout")
+		}
+	}
+}
+
+func TestReleaseIdle(t *testing.T) {
+	contextLogger := econf.Log.WithField("rule", "test")
+	ctx := context.WithValue(context.Background(), context.LoggerKey, contextLogger)
+	ls := GetLookupSource()
+	err := ls.Configure("0", map[string]interface{}{"addr": addr, "datatype": "string"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = ls.Open(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ls.Close(ctx)
+	err = ls.(api.LookupIdleReleaser).ReleaseIdle(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s := ls.(*lookupSource); s.cli != nil {
+		t.Error("expect the client released")
+	}
+	actual, err := ls.Lookup(ctx, []string{}, []string{"id"}, []interface{}{1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(actual) != 1 {
+		t.Errorf("expect to look up again after released but got %v", actual)
+	}
+}
+
+func TestLookupBatch(t *testing.T) {
+	contextLogger := econf.Log.WithField("rule", "test")
+	ctx := context.WithValue(context.Background(), context.LoggerKey, contextLogger)
+	tests := []struct {
+		dataType string
+		values   [][]interface{}
+	}{
+		{dataType: "string", values: [][]interface{}{{1}, {3}, {2}}},
+		{dataType: "list", values: [][]interface{}{{"group1"}, {"group4"}, {"group2"}}},
+	}
+	for _, tt := range tests {
+		ls := GetLookupSource()
+		if err := ls.Configure("0", map[string]interface{}{"addr": addr, "datatype": tt.dataType}); err != nil {
+			t.Fatal(err)
+		}
+		if err := ls.Open(ctx); err != nil {
+			t.Fatal(err)
+		}
+		actual, err := ls.(api.LookupBatcher).LookupBatch(ctx, []string{}, []string{"id"}, tt.values)
+		if err != nil {
+			t.Fatalf("%s: %v", tt.dataType, err)
+		}
+		if len(actual) != len(tt.values) {
+			t.Fatalf("%s: expect %d results but got %d", tt.dataType, len(tt.values), len(actual))
+		}
+		// the batch results are the same as the single lookups
+		for i, v := range tt.values {
+			exp, err := ls.Lookup(ctx, []string{}, []string{"id"}, v)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(exp) != len(actual[i]) || !deepEqual(exp, actual[i]) {
+				t.Errorf("%s %d: expect %v but got %v", tt.dataType, i, exp, actual[i])
+			}
+		}
+		_ = ls.Close(ctx)
+	}
+}
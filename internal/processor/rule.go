@@ -213,6 +213,11 @@ func clone(opt api.RuleOption) *api.RuleOption {
 	return &api.RuleOption{
 		IsEventTime:        opt.IsEventTime,
 		LateTol:            opt.LateTol,
+		AllowedLateness:    opt.AllowedLateness,
+		IdleTimeout:        opt.IdleTimeout,
+		WatermarkPartition: opt.WatermarkPartition,
+		GapFill:            opt.GapFill,
+		GapFillMaxGap:      opt.GapFillMaxGap,
 		Concurrency:        opt.Concurrency,
 		BufferLength:       opt.BufferLength,
 		SendMetaToSink:     opt.SendMetaToSink,
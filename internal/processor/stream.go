@@ -320,6 +320,9 @@ func printOptions(opts *ast.Options, buff *bytes.Buffer) {
 	if opts.RETAIN_SIZE != 0 {
 		buff.WriteString(fmt.Sprintf("RETAIN_SIZE: %d\n", opts.RETAIN_SIZE))
 	}
+	if opts.HISTORY_SIZE != 0 {
+		buff.WriteString(fmt.Sprintf("HISTORY_SIZE: %d\n", opts.HISTORY_SIZE))
+	}
 	if opts.SHARED {
 		buff.WriteString(fmt.Sprintf("SHARED: %v\n", opts.SHARED))
 	}
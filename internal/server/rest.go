@@ -39,6 +39,7 @@ import (
 	"github.com/lf-edge/ekuiper/internal/pkg/store"
 	"github.com/lf-edge/ekuiper/internal/processor"
 	"github.com/lf-edge/ekuiper/internal/server/middleware"
+	"github.com/lf-edge/ekuiper/internal/topo/node"
 	"github.com/lf-edge/ekuiper/internal/topo/planner"
 	"github.com/lf-edge/ekuiper/pkg/api"
 	"github.com/lf-edge/ekuiper/pkg/ast"
@@ -157,7 +158,11 @@ func createRestServer(ip string, port int, needToken bool) *http.Server {
 	r.HandleFunc("/rules/{name}/restart", restartRuleHandler).Methods(http.MethodPost)
 	r.HandleFunc("/rules/{name}/topo", getTopoRuleHandler).Methods(http.MethodGet)
 	r.HandleFunc("/rules/validate", validateRuleHandler).Methods(http.MethodPost)
+	r.HandleFunc("/rules/explain", explainRulePlanHandler).Methods(http.MethodPost)
 	r.HandleFunc("/rules/{name}/explain", explainRuleHandler).Methods(http.MethodGet)
+	r.HandleFunc("/rules/{name}/lookups/{node}/cache", lookupCacheHandler).Methods(http.MethodDelete)
+	r.HandleFunc("/rules/{name}/lookups/{node}/cache", lookupCacheOptionsHandler).Methods(http.MethodPut)
+	r.HandleFunc("/rules/{name}/lookups/{node}/debugSampling", lookupDebugSamplingHandler).Methods(http.MethodPut)
 	r.HandleFunc("/ruleset/export", exportHandler).Methods(http.MethodPost)
 	r.HandleFunc("/ruleset/import", importHandler).Methods(http.MethodPost)
 	r.HandleFunc("/configs", configurationUpdateHandler).Methods(http.MethodPatch)
@@ -650,6 +655,81 @@ func restartRuleHandler(w http.ResponseWriter, r *http.Request) {
 	fmt.Fprintf(w, "Rule %s was restarted", name)
 }
 
+// invalidate the lookup cache of a running rule
+func lookupCacheHandler(w http.ResponseWriter, r *http.Request) {
+	defer r.Body.Close()
+	vars := mux.Vars(r)
+	name := vars["name"]
+	nodeName := vars["node"]
+
+	req := struct {
+		Keys [][]interface{} `json:"keys"`
+	}{}
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		handleError(w, err, "Invalid body", logger)
+		return
+	}
+	if len(body) > 0 {
+		if err := json.Unmarshal(body, &req); err != nil {
+			handleError(w, err, "Invalid body", logger)
+			return
+		}
+	}
+	err = invalidateLookupCache(name, nodeName, req.Keys)
+	if err != nil {
+		handleError(w, err, "invalidate lookup cache error", logger)
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+	fmt.Fprintf(w, "Lookup cache of %s in rule %s was invalidated", nodeName, name)
+}
+
+// update the cache options of a lookup node in a running rule
+func lookupCacheOptionsHandler(w http.ResponseWriter, r *http.Request) {
+	defer r.Body.Close()
+	vars := mux.Vars(r)
+	name := vars["name"]
+	nodeName := vars["node"]
+
+	opts := &node.CacheOptions{}
+	if err := json.NewDecoder(r.Body).Decode(opts); err != nil {
+		handleError(w, err, "Invalid body", logger)
+		return
+	}
+	err := updateLookupCacheOptions(name, nodeName, opts)
+	if err != nil {
+		handleError(w, err, "update lookup cache options error", logger)
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+	fmt.Fprintf(w, "Cache options of lookup %s in rule %s were updated", nodeName, name)
+}
+
+// change the debug log sampling rate of a lookup node in a running rule
+func lookupDebugSamplingHandler(w http.ResponseWriter, r *http.Request) {
+	defer r.Body.Close()
+	vars := mux.Vars(r)
+	name := vars["name"]
+	nodeName := vars["node"]
+
+	req := struct {
+		Every     int `json:"every"`
+		PerSecond int `json:"perSecond"`
+	}{}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		handleError(w, err, "Invalid body", logger)
+		return
+	}
+	err := setLookupDebugSampling(name, nodeName, req.Every, req.PerSecond)
+	if err != nil {
+		handleError(w, err, "set lookup debug sampling error", logger)
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+	fmt.Fprintf(w, "Debug sampling of lookup %s in rule %s was updated", nodeName, name)
+}
+
 // get topo of a rule
 func getTopoRuleHandler(w http.ResponseWriter, r *http.Request) {
 	defer r.Body.Close()
@@ -683,6 +763,23 @@ func validateRuleHandler(w http.ResponseWriter, r *http.Request) {
 	w.Write([]byte("The rule has been successfully validated and is confirmed to be correct."))
 }
 
+// explain the plan of a rule without running it
+func explainRulePlanHandler(w http.ResponseWriter, r *http.Request) {
+	defer r.Body.Close()
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		handleError(w, err, "Invalid body", logger)
+		return
+	}
+	content, err := explainRule(string(body))
+	if err != nil {
+		handleError(w, err, "explain rule error", logger)
+		return
+	}
+	w.Header().Set(ContentType, ContentTypeJSON)
+	w.Write([]byte(content))
+}
+
 type rulesetInfo struct {
 	Content  string `json:"content"`
 	FilePath string `json:"file"`
@@ -34,6 +34,7 @@ import (
 	"github.com/lf-edge/ekuiper/internal/pkg/store"
 	"github.com/lf-edge/ekuiper/internal/processor"
 	"github.com/lf-edge/ekuiper/internal/testx"
+	"github.com/lf-edge/ekuiper/internal/topo/planner"
 	"github.com/lf-edge/ekuiper/internal/topo/rule"
 )
 
@@ -78,6 +79,7 @@ func (suite *RestTestSuite) SetupTest() {
 	r.HandleFunc("/rules/{name}/topo", getTopoRuleHandler).Methods(http.MethodGet)
 	r.HandleFunc("/rules/{name}/explain", explainRuleHandler).Methods(http.MethodGet)
 	r.HandleFunc("/rules/validate", validateRuleHandler).Methods(http.MethodPost)
+	r.HandleFunc("/rules/explain", explainRulePlanHandler).Methods(http.MethodPost)
 	r.HandleFunc("/ruleset/export", exportHandler).Methods(http.MethodPost)
 	r.HandleFunc("/ruleset/import", importHandler).Methods(http.MethodPost)
 	r.HandleFunc("/configs", configurationUpdateHandler).Methods(http.MethodPatch)
@@ -244,6 +246,20 @@ func (suite *RestTestSuite) Test_rulesManageHandler() {
 	assert.Equal(suite.T(), http.StatusUnprocessableEntity, w2.Code)
 	assert.Equal(suite.T(), expect, string(returnVal))
 
+	// explain a rule without creating it
+	ruleJson = `{"id": "rule1","sql": "select * from alert","actions": [{"log": {}}]}`
+
+	buf2 = bytes.NewBuffer([]byte(ruleJson))
+	req2, _ = http.NewRequest(http.MethodPost, "http://localhost:8080/rules/explain", buf2)
+	w2 = httptest.NewRecorder()
+	suite.r.ServeHTTP(w2, req2)
+	returnVal, _ = io.ReadAll(w2.Result().Body)
+	assert.Equal(suite.T(), http.StatusOK, w2.Code)
+	pp := &planner.PhysicalPlan{}
+	assert.NoError(suite.T(), json.Unmarshal(returnVal, pp))
+	assert.Len(suite.T(), pp.Plans, 2)
+	assert.Equal(suite.T(), []string{"source_alert"}, pp.Topo.Sources)
+
 	// create rule with trigger false
 	ruleJson = `{"id": "rule1","triggered": false,"sql": "select * from alert","actions": [{"log": {}}]}`
 
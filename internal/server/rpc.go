@@ -258,6 +258,20 @@ func (t *Server) ValidateRule(rule *model.RPCArgDesc, reply *string) error {
 	return nil
 }
 
+func (t *Server) ExplainRule(rule *model.RPCArgDesc, reply *string) error {
+	r, err := explainRule(rule.Json)
+	if err != nil {
+		return err
+	}
+	dst := &bytes.Buffer{}
+	if err = json.Indent(dst, cast.StringToBytes(r), "", "  "); err != nil {
+		*reply = r
+	} else {
+		*reply = dst.String()
+	}
+	return nil
+}
+
 func (t *Server) Import(file string, reply *string) error {
 	f, err := os.Open(file)
 	if err != nil {
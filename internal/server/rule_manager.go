@@ -23,6 +23,8 @@ import (
 	"time"
 
 	"github.com/lf-edge/ekuiper/internal/conf"
+	"github.com/lf-edge/ekuiper/internal/topo/node"
+	"github.com/lf-edge/ekuiper/internal/topo/planner"
 	"github.com/lf-edge/ekuiper/internal/topo/rule"
 	"github.com/lf-edge/ekuiper/pkg/api"
 	"github.com/lf-edge/ekuiper/pkg/cast"
@@ -351,6 +353,66 @@ func getRuleTopo(name string) (string, error) {
 	}
 }
 
+func getLookupNode(name, nodeName string) (*node.LookupNode, error) {
+	rs, ok := registry.Load(name)
+	if !ok {
+		return nil, errorx.NewWithCode(errorx.NOT_FOUND, fmt.Sprintf("Rule %s is not found", name))
+	}
+	op, running := rs.GetOperator(nodeName)
+	if !running {
+		return nil, errorx.New(fmt.Sprintf("Rule %s is not running", name))
+	}
+	if op == nil {
+		return nil, errorx.NewWithCode(errorx.NOT_FOUND, fmt.Sprintf("Lookup node %s is not found in rule %s", nodeName, name))
+	}
+	ln, ok := op.(*node.LookupNode)
+	if !ok {
+		return nil, errorx.New(fmt.Sprintf("Node %s in rule %s is not a lookup node", nodeName, name))
+	}
+	return ln, nil
+}
+
+func invalidateLookupCache(name, nodeName string, keys [][]interface{}) error {
+	ln, err := getLookupNode(name, nodeName)
+	if err != nil {
+		return err
+	}
+	return ln.InvalidateCache(keys)
+}
+
+func updateLookupCacheOptions(name, nodeName string, opts *node.CacheOptions) error {
+	ln, err := getLookupNode(name, nodeName)
+	if err != nil {
+		return err
+	}
+	return ln.UpdateCacheOptions(opts)
+}
+
+func setLookupDebugSampling(name, nodeName string, every, perSecond int) error {
+	ln, err := getLookupNode(name, nodeName)
+	if err != nil {
+		return err
+	}
+	return ln.SetDebugSampling(every, perSecond)
+}
+
+// explainRule plans the rule json without creating or starting the rule
+func explainRule(ruleJson string) (string, error) {
+	rule, err := ruleProcessor.GetRuleByJson("", ruleJson)
+	if err != nil {
+		return "", fmt.Errorf("invalid rule json: %v", err)
+	}
+	pp, err := planner.ExplainRule(rule)
+	if err != nil {
+		return "", fmt.Errorf("fail to plan rule %s: %v", rule.Id, err)
+	}
+	bs, err := json.Marshal(pp)
+	if err != nil {
+		return "", fmt.Errorf("fail to encode the plan of rule %s: %v", rule.Id, err)
+	}
+	return string(bs), nil
+}
+
 func validateRule(name, ruleJson string) (bool, error) {
 	// Validate the rule json
 	_, err := ruleProcessor.GetRuleByJson(name, ruleJson)
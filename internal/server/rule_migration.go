@@ -79,7 +79,7 @@ func ruleTraverse(rule *api.Rule, de *dependencies) {
 			return
 		}
 		// streams
-		streamsFromStmt := xsql.GetStreams(stmt)
+		streamsFromStmt := xsql.GetAllStreams(stmt)
 		for _, s := range streamsFromStmt {
 			streamStmt, err := xsql.GetDataSource(store, s)
 			if err != nil {
@@ -0,0 +1,77 @@
+// Copyright 2023 EMQ Technologies Co., Ltd.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cache
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/lf-edge/ekuiper/pkg/api"
+)
+
+// BackendMemory is the name of the default in memory backend
+const BackendMemory = "memory"
+
+// Backend is the storage of the cached lookup results other than the memory, such as redis to share the cache across
+// the instances and keep it after restarts. It must be safe to be used concurrently. As a cache, the failures of the
+// backend should be logged and treated as misses instead of failing the lookups.
+type Backend interface {
+	Get(key string) ([]api.SourceTuple, bool)
+	// Set stores the value which expires after ttl, 0 means never expire
+	Set(key string, value []api.SourceTuple, ttl time.Duration)
+	Delete(key string)
+	// Clear removes all the values stored by this backend
+	Clear()
+	Close()
+}
+
+// PrefixClearer is implemented by the backends which can clear the values of a key prefix only, so that clearing a
+// namespaced cache keeps the values of the other namespaces in the same backend
+type PrefixClearer interface {
+	ClearPrefix(prefix string)
+}
+
+// FirstWriter is implemented by the backends which can store a value only if the key is absent atomically, which is
+// required by the first write wins policy
+type FirstWriter interface {
+	SetIfAbsent(key string, value []api.SourceTuple, ttl time.Duration)
+}
+
+// BackendFactory creates a backend with the connection props. The name is the lookup table name to namespace the keys
+type BackendFactory func(name string, props map[string]interface{}) (Backend, error)
+
+var (
+	backends    = make(map[string]BackendFactory)
+	backendLock = &sync.RWMutex{}
+)
+
+// RegisterBackend registers the factory of a cache backend. It is supposed to be called in init
+func RegisterBackend(backend string, factory BackendFactory) {
+	backendLock.Lock()
+	defer backendLock.Unlock()
+	backends[backend] = factory
+}
+
+// NewBackend creates the registered backend for the lookup table
+func NewBackend(backend string, name string, props map[string]interface{}) (Backend, error) {
+	backendLock.RLock()
+	factory, ok := backends[backend]
+	backendLock.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("cache backend %s is not found", backend)
+	}
+	return factory(name, props)
+}
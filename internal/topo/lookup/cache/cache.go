@@ -16,41 +16,235 @@ package cache
 
 import (
 	"context"
+	"encoding/binary"
+	"encoding/hex"
+	"hash/fnv"
+	"hash/maphash"
+	"sort"
+	"strings"
 	"sync"
+	"sync/atomic"
+	"time"
 
 	"github.com/lf-edge/ekuiper/internal/conf"
 	"github.com/lf-edge/ekuiper/pkg/api"
 )
 
 type item struct {
-	data       []api.SourceTuple
+	data []api.SourceTuple
+	// compressed is the compressed data if the value is compressed, then data is nil
+	compressed []byte
+	// expiration is the expire time in milliseconds which is updated atomically in sliding mode
 	expiration int64
+	// ttl in milliseconds to extend the expiration on access in sliding mode
+	ttl int64
+	// check is the second hash of the original key to verify hash collision when hashing keys
+	check uint64
+	// cost is the estimated memory size in bytes, only calculated when the max bytes is set
+	cost int64
+	// accessed is the last access time in milliseconds which is updated atomically
+	accessed int64
+	// used is the sequence of the last access for the LRU eviction which is updated atomically
+	used int64
+	// created is the time in milliseconds when the item is set
+	created int64
+	// refreshing is 1 if a refresh of the stale item is running in stale while revalidate mode
+	refreshing int32
+	// ns is the namespace of the view which sets the item, only set for the views
+	ns string
+}
+
+// isMiss returns whether the item is a cached empty result
+func (it *item) isMiss() bool {
+	return len(it.data) == 0 && it.compressed == nil
+}
+
+// Options are the options to create a cache
+type Options struct {
+	// TTL is the time to live of the items, 0 means never expire. The precision is millisecond.
+	TTL time.Duration
+	// CacheMissingKey decides whether to cache the empty result
+	CacheMissingKey bool
+	// MissingKeyTTL is the time to live of the empty results, 0 means the same as TTL
+	MissingKeyTTL time.Duration
+	// HashKeys stores the fixed size hash of the keys instead of the keys to save memory for long keys
+	HashKeys bool
+	// MaxItems is the max count of the cached results, 0 means no limit. When exceeding, the least recently used items
+	// are evicted first
+	MaxItems int
+	// MaxBytes is the memory budget of the cached results, 0 means no limit. The size of each result is estimated.
+	// When exceeding, the items with the highest cost, which is the size multiplied by the idle time, are evicted first
+	MaxBytes int64
+	// Sliding extends the expiration of an item by its ttl on every hit, so the hot items never expire
+	Sliding bool
+	// StaleWhileRevalidate keeps the expired items for MaxStale so that GetOrRevalidate can serve them while refreshing
+	StaleWhileRevalidate bool
+	// MaxStale is how long an expired item can be served after its expiration. If not positive, use the ttl of the item
+	MaxStale time.Duration
+	// Backend stores the items instead of the memory if set. The memory only options such as HashKeys, MaxBytes,
+	// Sliding and StaleWhileRevalidate are not applied, and the misses are not counted. The cache closes the backend
+	Backend Backend
+	// FirstWriteWins keeps the unexpired value of a key when it is set again, such as by the concurrent lookups of the
+	// same key, so the later result is discarded. By default, the last write wins. The backend applies it only if it
+	// implements FirstWriter
+	FirstWriteWins bool
+	// Namespace is prefixed to all the keys to isolate the caches such as the test and the production rules sharing
+	// the same backend. Empty means no prefix
+	Namespace string
+	// Compression is the codec such as "zstd" to compress the cached values to save memory at the cost of CPU on
+	// every set and get. Empty means no compression. It is a memory only option
+	Compression string
+	// CompressMinBytes only compresses the values whose estimated size is at least the bytes, because compressing the
+	// small values saves little
+	CompressMinBytes int64
+	// RetainStale keeps the expired items for the duration so that GetStale can serve them, such as when the lookup
+	// source is unavailable. It is a memory only option
+	RetainStale time.Duration
 }
 
 type Cache struct {
-	expireTime      int
+	// expireTime in milliseconds
+	expireTime      int64
 	cacheMissingKey bool
-	cancel          context.CancelFunc
-	items           map[string]*item
+	// missExpireTime in milliseconds for the empty results, 0 means the same as expireTime
+	missExpireTime int64
+	backend        Backend
+	namespace      string
+	firstWriteWins bool
+	// view is whether the cache is a view sharing the store of another cache
+	view bool
+	// backendMisses are the keys of the empty results set into the backend with their expiration, 0 means never
+	// expire. They are deleted when cacheMissingKey is turned off, so that the other values of the backend are kept
+	backendMisses map[string]int64
+	// backendMissesPrune is the count of the backend misses to prune the expired ones
+	backendMissesPrune int
+	*itemStore
+}
+
+// itemStore is the items and the memory options of the cache, which are shared by the views of the cache
+type itemStore struct {
+	// useSeq is the last access sequence of the items
+	useSeq int64
+	// evictions is the count of the items evicted for the max items or the max bytes
+	evictions   int64
+	totalBytes  int64
+	maxBytes    int64
+	maxStale    int64
+	retainStale int64
+	maxItems    int
+	hashKeys    bool
+	sliding     bool
+	swr         bool
+	seed        maphash.Seed
+	cancel      context.CancelFunc
+	codec       *codec
+	compressMin int64
+	items       map[string]*item
+	// misses is the count of the cached empty results
+	misses int
 	sync.RWMutex
 }
 
+// NewCache creates a cache whose items expire in expireTime seconds
 func NewCache(expireTime int, cacheMissingKey bool) *Cache {
+	return NewCacheWithOptions(&Options{
+		TTL:             time.Duration(expireTime) * time.Second,
+		CacheMissingKey: cacheMissingKey,
+	})
+}
+
+func NewCacheWithOptions(opts *Options) *Cache {
+	expireTime := opts.TTL.Milliseconds()
+	missExpireTime := opts.MissingKeyTTL.Milliseconds()
+	if opts.MissingKeyTTL > 0 && missExpireTime == 0 {
+		missExpireTime = 1
+	}
+	if opts.Backend != nil {
+		return &Cache{expireTime: expireTime, cacheMissingKey: opts.CacheMissingKey, missExpireTime: missExpireTime, backend: opts.Backend, namespace: opts.Namespace, firstWriteWins: opts.FirstWriteWins, itemStore: &itemStore{}}
+	}
 	c := &Cache{
 		expireTime:      expireTime,
-		cacheMissingKey: cacheMissingKey,
-		items:           make(map[string]*item),
+		cacheMissingKey: opts.CacheMissingKey,
+		missExpireTime:  missExpireTime,
+		namespace:       opts.Namespace,
+		firstWriteWins:  opts.FirstWriteWins,
+		itemStore: &itemStore{
+			hashKeys:    opts.HashKeys,
+			sliding:     opts.Sliding,
+			swr:         opts.StaleWhileRevalidate,
+			maxStale:    opts.MaxStale.Milliseconds(),
+			retainStale: opts.RetainStale.Milliseconds(),
+			maxBytes:    opts.MaxBytes,
+			maxItems:    opts.MaxItems,
+			seed:        maphash.MakeSeed(),
+			items:       make(map[string]*item),
+		},
 	}
-	if expireTime > 0 {
-		ctx, cancel := context.WithCancel(context.Background())
-		c.cancel = cancel
-		go c.run(ctx)
+	if opts.Compression != "" {
+		cd, err := newCodec(opts.Compression)
+		if err != nil {
+			conf.Log.Warnf("lookup cache compression %s is not available, cache without compression: %v", opts.Compression, err)
+		} else {
+			c.codec = cd
+			c.compressMin = opts.CompressMinBytes
+		}
+	}
+	// clean up in the pace of the shorter ttl so that the short lived empty results do not linger
+	if c.cacheMissingKey && missExpireTime > 0 && (expireTime == 0 || missExpireTime < expireTime) {
+		c.startCleaner(missExpireTime * 2)
+	} else if expireTime > 0 {
+		c.startCleaner(expireTime * 2)
 	}
 	return c
 }
 
-func (c *Cache) run(ctx context.Context) {
-	ticker := conf.GetTicker(int64(c.expireTime * 2000))
+// NewView creates a cache which shares the items, the memory budget and the cleaner of the base memory cache. The view
+// has its own TTL, MissingKeyTTL, CacheMissingKey, FirstWriteWins and Namespace, and the other options of the base are
+// used. The views of the same namespace share the items, but a view does not hit the items which live longer than its
+// ttl or the empty results if it does not cache them, even if they are set by another view. Closing the view does not
+// close the base
+func NewView(base *Cache, opts *Options) *Cache {
+	expireTime := opts.TTL.Milliseconds()
+	missExpireTime := opts.MissingKeyTTL.Milliseconds()
+	if opts.MissingKeyTTL > 0 && missExpireTime == 0 {
+		missExpireTime = 1
+	}
+	return &Cache{
+		expireTime:      expireTime,
+		cacheMissingKey: opts.CacheMissingKey,
+		missExpireTime:  missExpireTime,
+		namespace:       opts.Namespace,
+		firstWriteWins:  opts.FirstWriteWins,
+		view:            true,
+		itemStore:       base.itemStore,
+	}
+}
+
+// hidden returns whether the item set by another view is out of the ttl or the empty result policy of the view. The
+// sliding items are kept alive by the hits of all the views, so they are not hidden by the age. Must be called with lock
+func (c *Cache) hidden(v *item, now int64) bool {
+	if !c.view {
+		return false
+	}
+	if v.isMiss() && !c.cacheMissingKey {
+		return true
+	}
+	ttl := c.expireTime
+	if v.isMiss() && c.missExpireTime > 0 {
+		ttl = c.missExpireTime
+	}
+	return !c.sliding && ttl > 0 && (v.ttl == 0 || v.ttl > ttl) && now-v.created > ttl
+}
+
+// startCleaner starts the routine to delete the expired items periodically
+func (c *Cache) startCleaner(interval int64) {
+	ctx, cancel := context.WithCancel(context.Background())
+	c.cancel = cancel
+	go c.run(ctx, interval)
+}
+
+func (c *Cache) run(ctx context.Context, interval int64) {
+	ticker := conf.GetTicker(interval)
 	for {
 		select {
 		case <-ticker.C:
@@ -67,39 +261,630 @@ func (c *Cache) deleteExpired() {
 	now := conf.GetNowInMilli()
 	c.Lock()
 	for k, v := range c.items {
-		if v.expiration > 0 && now > v.expiration {
-			delete(c.items, k)
+		if c.isDead(v, now) {
+			c.remove(k, v)
 		}
 	}
 	c.Unlock()
 }
 
+// isDead returns whether the item is expired and cannot be served as stale any more. Must be called with lock
+func (c *Cache) isDead(v *item, now int64) bool {
+	s := c.staleTime(v)
+	if c.retainStale > s {
+		s = c.retainStale
+	}
+	return v.expiration > 0 && now > v.expiration+s
+}
+
+// staleTime returns how long in milliseconds the expired item can be served as stale
+func (c *Cache) staleTime(v *item) int64 {
+	if !c.swr {
+		return 0
+	}
+	if c.maxStale > 0 {
+		return c.maxStale
+	}
+	return v.ttl
+}
+
+// remove deletes the item and updates the total bytes. Must be called with lock
+func (c *Cache) remove(k string, v *item) {
+	delete(c.items, k)
+	c.totalBytes -= v.cost
+	if v.isMiss() {
+		c.misses--
+	}
+}
+
+// namespaced returns the key prefixed by the namespace if any
+func (c *Cache) namespaced(key string) string {
+	if c.namespace == "" {
+		return key
+	}
+	return c.namespace + ":" + key
+}
+
+// hash returns the key to store and the check value to verify collision
+func (c *Cache) hash(key string) (string, uint64) {
+	if !c.hashKeys {
+		return key, 0
+	}
+	h := fnv.New64a()
+	_, _ = h.Write([]byte(key))
+	b := make([]byte, 8)
+	binary.BigEndian.PutUint64(b, h.Sum64())
+	return string(b), maphash.String(c.seed, key)
+}
+
+// Set caches the value with the ttl hint of the tuples if any, otherwise with the ttl of the cache
 func (c *Cache) Set(key string, value []api.SourceTuple) {
-	if (value == nil || len(value) == 0) && !c.cacheMissingKey {
+	c.SetWithTTL(key, value, hintTTL(value))
+}
+
+// SetWithTTL caches the value with a ttl overriding the ttl of the cache. If ttl is not positive, use the ttl of the cache
+func (c *Cache) SetWithTTL(key string, value []api.SourceTuple, ttl time.Duration) {
+	key = c.namespaced(key)
+	if c.backend != nil {
+		c.Lock()
+		expireTime, ok := c.expireTimeOf(value, ttl)
+		if ok {
+			c.trackBackendMiss(key, len(value) == 0, expireTime)
+		}
+		c.Unlock()
+		if !ok {
+			return
+		}
+		if fw, isFw := c.backend.(FirstWriter); isFw && c.firstWriteWins {
+			fw.SetIfAbsent(key, value, time.Duration(expireTime)*time.Millisecond)
+		} else {
+			c.backend.Set(key, value, time.Duration(expireTime)*time.Millisecond)
+		}
 		return
 	}
+	k, check := c.hash(key)
+	compressed := c.compress(key, value)
+	var cost int64
+	if c.maxBytes > 0 {
+		if compressed != nil {
+			// the slice header and the compressed bytes
+			cost = int64(len(k)) + 24 + int64(len(compressed))
+		} else {
+			cost = int64(len(k)) + EstimateSize(value)
+		}
+		if cost > c.maxBytes {
+			conf.Log.Debugf("lookup result of %s with size %d exceeds the cache max bytes, do not cache", key, cost)
+			return
+		}
+	}
+	now := conf.GetNowInMilli()
 	c.Lock()
 	defer c.Unlock()
-	if c.expireTime > 0 {
-		c.items[key] = &item{data: value, expiration: conf.GetNowInMilli() + int64(c.expireTime*1000)}
-	} else {
-		c.items[key] = &item{data: value}
+	if c.items == nil {
+		return
+	}
+	// the options are read with lock since they can be updated at runtime
+	expireTime, ok := c.expireTimeOf(value, ttl)
+	if !ok {
+		return
+	}
+	if old, ok := c.items[k]; ok {
+		// the policy is checked with the lock so that one of the concurrent sets wins atomically
+		if c.firstWriteWins && old.check == check {
+			if exp := atomic.LoadInt64(&old.expiration); exp <= 0 || now <= exp {
+				conf.Log.Debugf("lookup result of %s is already cached, discard the later one", key)
+				return
+			}
+		}
+		c.remove(k, old)
+	}
+	it := &item{data: value, check: check, cost: cost, accessed: now, created: now}
+	if c.view {
+		it.ns = c.namespace
 	}
+	c.touch(it)
+	if compressed != nil {
+		it.data, it.compressed = nil, compressed
+	}
+	if expireTime > 0 {
+		// The cache never expires by default, start the cleaner for the items with ttl
+		if c.cancel == nil {
+			c.startCleaner(expireTime * 2)
+		}
+		it.expiration = now + expireTime
+		it.ttl = expireTime
+	}
+	c.items[k] = it
+	c.totalBytes += cost
+	if it.isMiss() {
+		c.misses++
+	}
+	if c.maxBytes > 0 && c.totalBytes > c.maxBytes {
+		c.evict(now)
+	}
+	if c.maxItems > 0 && len(c.items) > c.maxItems {
+		c.evictLRU(now)
+	}
+}
+
+// touch records the access of the item for the LRU eviction
+func (c *Cache) touch(v *item) {
+	if c.maxItems > 0 {
+		atomic.StoreInt64(&v.used, atomic.AddInt64(&c.useSeq, 1))
+	}
+}
+
+// compress returns the compressed value if it should be compressed, otherwise nil
+func (c *Cache) compress(key string, value []api.SourceTuple) []byte {
+	if c.codec == nil || len(value) == 0 || EstimateSize(value) < c.compressMin {
+		return nil
+	}
+	r, err := c.codec.compress(value)
+	if err != nil {
+		conf.Log.Debugf("lookup result of %s cannot be compressed, cache it uncompressed: %v", key, err)
+		return nil
+	}
+	return r
+}
+
+// load returns the value of the item which is decompressed if needed. A corrupted item is treated as missing
+func (c *Cache) load(key string, v *item) ([]api.SourceTuple, bool) {
+	if v.compressed == nil {
+		return v.data, true
+	}
+	r, err := c.codec.decompress(v.compressed)
+	if err != nil {
+		conf.Log.Warnf("lookup cache of %s cannot be decompressed: %v", key, err)
+		return nil, false
+	}
+	return r, true
+}
+
+// expireTimeOf returns the ttl in milliseconds to cache the value and whether to cache it. Must be called with lock
+func (c *Cache) expireTimeOf(value []api.SourceTuple, ttl time.Duration) (int64, bool) {
+	if len(value) == 0 && !c.cacheMissingKey {
+		return 0, false
+	}
+	if ttl > 0 {
+		if ms := ttl.Milliseconds(); ms > 0 {
+			return ms, true
+		}
+		return 1, true
+	}
+	if len(value) == 0 && c.missExpireTime > 0 {
+		return c.missExpireTime, true
+	}
+	return c.expireTime, true
+}
+
+// SetTTL changes the ttl of the cache at runtime. It applies to the subsequent sets, the cached items keep their ttl
+func (c *Cache) SetTTL(ttl time.Duration) {
+	c.Lock()
+	defer c.Unlock()
+	c.expireTime = ttl.Milliseconds()
+}
+
+// SetCacheMissingKey changes whether to cache the empty results at runtime. When turned off, the cached empty results
+// are removed at once. For the backend, only the empty results set by this cache are deleted if they are still empty
+func (c *Cache) SetCacheMissingKey(cacheMissingKey bool) {
+	if c.backend != nil {
+		c.Lock()
+		c.cacheMissingKey = cacheMissingKey
+		var keys []string
+		if !cacheMissingKey {
+			for k := range c.backendMisses {
+				keys = append(keys, k)
+			}
+			c.backendMisses = nil
+		}
+		c.Unlock()
+		for _, k := range keys {
+			// the key may be set with a value by another cache sharing the backend
+			if v, ok := c.backend.Get(k); ok && len(v) == 0 {
+				c.backend.Delete(k)
+			}
+		}
+		return
+	}
+	c.Lock()
+	defer c.Unlock()
+	c.cacheMissingKey = cacheMissingKey
+	if cacheMissingKey {
+		return
+	}
+	for k, v := range c.items {
+		if v.isMiss() && c.owns(v) {
+			c.remove(k, v)
+		}
+	}
+}
+
+// owns returns whether the item is in the namespace of the view. All the items are owned if it is not a view
+func (c *Cache) owns(v *item) bool {
+	return !c.view || v.ns == c.namespace
+}
+
+// evict removes the expired items and then the items with the highest cost until the total bytes is under the low watermark
+// which is 90% of the max bytes to avoid evicting for every set. Must be called with lock
+func (c *Cache) evict(now int64) {
+	type candidate struct {
+		key   string
+		it    *item
+		score int64
+	}
+	candidates := make([]candidate, 0, len(c.items))
+	for k, v := range c.items {
+		if c.isDead(v, now) {
+			c.remove(k, v)
+			continue
+		}
+		idle := now - atomic.LoadInt64(&v.accessed) + 1
+		if idle < 1 {
+			idle = 1
+		}
+		candidates = append(candidates, candidate{key: k, it: v, score: idle * v.cost})
+	}
+	low := c.maxBytes / 10 * 9
+	if c.totalBytes <= low {
+		return
+	}
+	sort.Slice(candidates, func(i, j int) bool {
+		return candidates[i].score > candidates[j].score
+	})
+	for _, cd := range candidates {
+		if c.totalBytes <= low {
+			break
+		}
+		c.remove(cd.key, cd.it)
+		c.evictions++
+	}
+}
+
+// evictLRU removes the expired items and then the least recently used items until the count is under the low watermark
+// which is 90% of the max items. Must be called with lock
+func (c *Cache) evictLRU(now int64) {
+	type candidate struct {
+		key  string
+		it   *item
+		used int64
+	}
+	candidates := make([]candidate, 0, len(c.items))
+	for k, v := range c.items {
+		if c.isDead(v, now) {
+			c.remove(k, v)
+			continue
+		}
+		candidates = append(candidates, candidate{key: k, it: v, used: atomic.LoadInt64(&v.used)})
+	}
+	low := c.maxItems - c.maxItems/10
+	if len(c.items) <= low {
+		return
+	}
+	sort.Slice(candidates, func(i, j int) bool {
+		return candidates[i].used < candidates[j].used
+	})
+	for _, cd := range candidates {
+		if len(c.items) <= low {
+			break
+		}
+		c.remove(cd.key, cd.it)
+		c.evictions++
+	}
+}
+
+// Evictions returns the count of the items evicted for the max items or the max bytes, excluding the expired ones
+func (c *Cache) Evictions() int64 {
+	c.RLock()
+	defer c.RUnlock()
+	return c.evictions
+}
+
+// Size returns the estimated total bytes of the cached results. It is only calculated when the max bytes is set
+func (c *Cache) Size() int64 {
+	c.RLock()
+	defer c.RUnlock()
+	return c.totalBytes
+}
+
+// Len returns the count of the cached items including the expired ones not cleaned yet. It is 0 for the backend
+func (c *Cache) Len() int {
+	c.RLock()
+	defer c.RUnlock()
+	return len(c.items)
+}
+
+// MissCount returns the count of the cached empty results including the expired ones not cleaned yet
+func (c *Cache) MissCount() int {
+	c.RLock()
+	defer c.RUnlock()
+	return c.misses
+}
+
+// RangeMisses calls f for each unexpired cached empty result with its key and the time when the miss was cached, for diagnostics.
+// If the keys are hashed, the key is the hex string of the hash. If f returns false, the iteration stops.
+// The cache is locked for reading during the iteration, so f must not call the methods of the cache
+func (c *Cache) RangeMisses(f func(key string, missedAt time.Time) bool) {
+	c.RLock()
+	defer c.RUnlock()
+	now := conf.GetNowInMilli()
+	for k, v := range c.items {
+		if exp := atomic.LoadInt64(&v.expiration); !v.isMiss() || (exp > 0 && now > exp) || !c.owns(v) || c.hidden(v, now) {
+			continue
+		}
+		if c.hashKeys {
+			k = hex.EncodeToString([]byte(k))
+		} else {
+			k = strings.TrimPrefix(k, c.namespaced(""))
+		}
+		if !f(k, time.UnixMilli(v.created)) {
+			return
+		}
+	}
+}
+
+// EstimateSize returns the rough memory size in bytes of the lookup result
+func EstimateSize(value []api.SourceTuple) int64 {
+	// slice header
+	size := int64(24)
+	for _, t := range value {
+		// tuple struct with the timestamp
+		size += 64 + estimateValueSize(t.Message()) + estimateValueSize(t.Meta())
+	}
+	return size
+}
+
+func estimateValueSize(v interface{}) int64 {
+	switch vt := v.(type) {
+	case nil:
+		return 0
+	case string:
+		return 16 + int64(len(vt))
+	case []byte:
+		return 24 + int64(len(vt))
+	case bool, int8, uint8:
+		return 1
+	case int16, uint16:
+		return 2
+	case int32, uint32, float32:
+		return 4
+	case int, int64, uint, uint64, float64:
+		return 8
+	case map[string]interface{}:
+		// map header and buckets overhead for each entry
+		size := int64(48)
+		for k, e := range vt {
+			size += 16 + int64(len(k)) + 16 + estimateValueSize(e)
+		}
+		return size
+	case []interface{}:
+		size := int64(24)
+		for _, e := range vt {
+			size += 16 + estimateValueSize(e)
+		}
+		return size
+	case []map[string]interface{}:
+		size := int64(24)
+		for _, e := range vt {
+			size += 8 + estimateValueSize(e)
+		}
+		return size
+	default:
+		return 16
+	}
+}
+
+// hintTTL returns the min ttl hint of the tuples, 0 if no hint
+func hintTTL(value []api.SourceTuple) time.Duration {
+	var ttl time.Duration
+	for _, t := range value {
+		if h, ok := t.(api.CacheTTLHinter); ok {
+			if d := h.CacheTTL(); d > 0 && (ttl == 0 || d < ttl) {
+				ttl = d
+			}
+		}
+	}
+	return ttl
 }
 
 func (c *Cache) Get(key string) ([]api.SourceTuple, bool) {
+	key = c.namespaced(key)
+	if c.backend != nil {
+		return c.backend.Get(key)
+	}
+	k, check := c.hash(key)
 	c.RLock()
 	defer c.RUnlock()
-	if v, ok := c.items[key]; ok {
-		if v.expiration > 0 && conf.GetNowInMilli() > v.expiration {
+	if v, ok := c.items[k]; ok {
+		if v.check != check {
+			// hash collision, treat as missing
 			return nil, false
 		}
-		return v.data, true
+		now := conf.GetNowInMilli()
+		if exp := atomic.LoadInt64(&v.expiration); (exp > 0 && now > exp) || c.hidden(v, now) {
+			return nil, false
+		}
+		if c.maxBytes > 0 {
+			atomic.StoreInt64(&v.accessed, now)
+		}
+		c.touch(v)
+		if c.sliding && v.ttl > 0 {
+			atomic.StoreInt64(&v.expiration, now+v.ttl)
+		}
+		return c.load(key, v)
 	}
 	return nil, false
 }
 
+// GetStale returns the cached value of the key even if expired, as long as it is retained by the RetainStale option.
+// It also returns whether the value is stale. The backend does not retain the expired values
+func (c *Cache) GetStale(key string) ([]api.SourceTuple, bool, bool) {
+	if c.backend != nil || c.retainStale <= 0 {
+		r, ok := c.Get(key)
+		return r, ok, false
+	}
+	key = c.namespaced(key)
+	k, check := c.hash(key)
+	c.RLock()
+	defer c.RUnlock()
+	v, ok := c.items[k]
+	if !ok || v.check != check {
+		return nil, false, false
+	}
+	now := conf.GetNowInMilli()
+	exp := atomic.LoadInt64(&v.expiration)
+	if (exp > 0 && now > exp+c.retainStale) || c.hidden(v, now) {
+		return nil, false, false
+	}
+	r, ok := c.load(key, v)
+	return r, ok, ok && exp > 0 && now > exp
+}
+
+// GetOrRevalidate returns the cached value of the key like Get in stale while revalidate mode. If the item is expired
+// but still within the max stale time, the stale value is returned as a hit and the first caller triggers the refresh
+// in the background, which is supposed to look up and set the key again. Until the refresh completes, all the callers
+// get the stale value. If the refresh fails or ctx is done, the stale value is kept and the next caller triggers
+// another refresh. Once beyond the max stale time, the item is a miss so that the caller looks up synchronously and
+// gets the error. It also returns whether the value is stale
+func (c *Cache) GetOrRevalidate(ctx context.Context, key string, refresh func() error) ([]api.SourceTuple, bool, bool) {
+	if !c.swr {
+		r, ok := c.Get(key)
+		return r, ok, false
+	}
+	key = c.namespaced(key)
+	k, check := c.hash(key)
+	c.RLock()
+	v, ok := c.items[k]
+	if ok && c.hidden(v, conf.GetNowInMilli()) {
+		ok = false
+	}
+	c.RUnlock()
+	if !ok || v.check != check {
+		return nil, false, false
+	}
+	now := conf.GetNowInMilli()
+	exp := atomic.LoadInt64(&v.expiration)
+	if exp <= 0 || now <= exp {
+		if c.maxBytes > 0 {
+			atomic.StoreInt64(&v.accessed, now)
+		}
+		c.touch(v)
+		r, ok := c.load(key, v)
+		return r, ok, false
+	}
+	if now > exp+c.staleTime(v) {
+		return nil, false, false
+	}
+	r, ok := c.load(key, v)
+	if !ok {
+		return nil, false, false
+	}
+	if atomic.CompareAndSwapInt32(&v.refreshing, 0, 1) {
+		go func() {
+			err := ctx.Err()
+			if err == nil {
+				err = refresh()
+			}
+			if err != nil {
+				conf.Log.Debugf("lookup cache refresh of %s failed, keep serving the stale value: %v", key, err)
+				atomic.StoreInt32(&v.refreshing, 0)
+			}
+		}()
+	}
+	return r, true, true
+}
+
+// Delete removes the cached value of the key
+func (c *Cache) Delete(key string) {
+	key = c.namespaced(key)
+	if c.backend != nil {
+		c.Lock()
+		delete(c.backendMisses, key)
+		c.Unlock()
+		c.backend.Delete(key)
+		return
+	}
+	k, check := c.hash(key)
+	c.Lock()
+	defer c.Unlock()
+	if v, ok := c.items[k]; ok && v.check == check {
+		c.remove(k, v)
+	}
+}
+
+// Clear removes all the cached values. For a view, only the values of its namespace are removed
+func (c *Cache) Clear() {
+	if c.backend != nil {
+		c.clearBackend()
+		return
+	}
+	c.Lock()
+	defer c.Unlock()
+	// the cache is closed
+	if c.items == nil {
+		return
+	}
+	if c.view {
+		for k, v := range c.items {
+			if c.owns(v) {
+				c.remove(k, v)
+			}
+		}
+		return
+	}
+	c.items = make(map[string]*item)
+	c.totalBytes = 0
+	c.misses = 0
+}
+
+// trackBackendMiss records the key if the value set into the backend is empty. The expired keys are pruned once the
+// count doubles since the last prune. Must be called with lock
+func (c *Cache) trackBackendMiss(key string, miss bool, expireTime int64) {
+	if !miss {
+		delete(c.backendMisses, key)
+		return
+	}
+	now := conf.GetNowInMilli()
+	if c.backendMisses == nil {
+		c.backendMisses = make(map[string]int64)
+	}
+	if len(c.backendMisses) >= c.backendMissesPrune {
+		for k, exp := range c.backendMisses {
+			if exp > 0 && now > exp {
+				delete(c.backendMisses, k)
+			}
+		}
+		c.backendMissesPrune = 2*len(c.backendMisses) + 64
+	}
+	var exp int64
+	if expireTime > 0 {
+		exp = now + expireTime
+	}
+	c.backendMisses[key] = exp
+}
+
+// clearBackend clears the values of the namespace only if the backend supports, otherwise clears the whole backend
+func (c *Cache) clearBackend() {
+	c.Lock()
+	c.backendMisses = nil
+	c.Unlock()
+	if pc, ok := c.backend.(PrefixClearer); ok && c.namespace != "" {
+		pc.ClearPrefix(c.namespaced(""))
+		return
+	}
+	c.backend.Clear()
+}
+
 func (c *Cache) Close() {
+	if c.backend != nil {
+		c.backend.Close()
+		return
+	}
+	// the base is closed by its owner
+	if c.view {
+		return
+	}
+	c.Lock()
+	defer c.Unlock()
 	if c.cancel != nil {
 		c.cancel()
 	}
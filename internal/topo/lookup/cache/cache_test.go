@@ -15,7 +15,14 @@
 package cache
 
 import (
+	"context"
+	"errors"
 	"reflect"
+	"runtime"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 
@@ -120,3 +127,706 @@ func TestNoExpiration(t *testing.T) {
 		return
 	}
 }
+
+func TestDeleteAndClear(t *testing.T) {
+	c := NewCache(0, false)
+	defer c.Close()
+	v := []api.SourceTuple{api.NewDefaultSourceTuple(map[string]interface{}{"a": 1}, nil)}
+	c.Set("a", v)
+	c.Set("b", v)
+	c.Set("c", v)
+	c.Delete("a")
+	if _, ok := c.Get("a"); ok {
+		t.Error("a should not exist after delete")
+	}
+	if _, ok := c.Get("b"); !ok {
+		t.Error("b should exist")
+	}
+	c.Clear()
+	if _, ok := c.Get("b"); ok {
+		t.Error("b should not exist after clear")
+	}
+	if _, ok := c.Get("c"); ok {
+		t.Error("c should not exist after clear")
+	}
+}
+
+func TestHashKeys(t *testing.T) {
+	c := NewCacheWithOptions(&Options{HashKeys: true})
+	defer c.Close()
+	v := []api.SourceTuple{api.NewDefaultSourceTuple(map[string]interface{}{"a": 1}, nil)}
+	c.Set("https://example.com/devices/1", v)
+	r, ok := c.Get("https://example.com/devices/1")
+	if !ok || !reflect.DeepEqual(r, v) {
+		t.Errorf("expect %v but got %v", v, r)
+	}
+	if _, ok := c.Get("https://example.com/devices/2"); ok {
+		t.Error("key 2 should not exist")
+	}
+	// simulate a collision which has the same hash but different check value
+	k, _ := c.hash("https://example.com/devices/1")
+	c.items[k].check++
+	if _, ok := c.Get("https://example.com/devices/1"); ok {
+		t.Error("colliding key should be treated as missing")
+	}
+	for k := range c.items {
+		if len(k) != 8 {
+			t.Errorf("expect hashed key of 8 bytes but got %d", len(k))
+		}
+	}
+}
+
+func BenchmarkCacheKeys(b *testing.B) {
+	prefix := "[https://example.com/api/v1/organizations/emqx/projects/ekuiper/devices/"
+	for _, hashKeys := range []bool{false, true} {
+		name := "plain"
+		if hashKeys {
+			name = "hashed"
+		}
+		b.Run(name, func(b *testing.B) {
+			var before, after runtime.MemStats
+			v := []api.SourceTuple{api.NewDefaultSourceTuple(map[string]interface{}{"a": 1}, nil)}
+			runtime.GC()
+			runtime.ReadMemStats(&before)
+			c := NewCacheWithOptions(&Options{HashKeys: hashKeys})
+			for i := 0; i < b.N; i++ {
+				c.Set(prefix+strconv.Itoa(i)+"]", v)
+			}
+			runtime.GC()
+			runtime.ReadMemStats(&after)
+			b.ReportMetric(float64(int64(after.HeapAlloc)-int64(before.HeapAlloc))/float64(b.N), "heap-bytes/key")
+			c.Close()
+		})
+	}
+}
+
+func TestCompression(t *testing.T) {
+	c := NewCacheWithOptions(&Options{Compression: "zstd", CompressMinBytes: 512, MaxBytes: 1 << 20})
+	defer c.Close()
+	now := conf.GetNow()
+	small := []api.SourceTuple{api.NewDefaultSourceTupleWithTime(map[string]interface{}{"a": 1}, nil, now)}
+	var large []api.SourceTuple
+	for i := 0; i < 10; i++ {
+		large = append(large, api.NewDefaultSourceTupleWithTime(map[string]interface{}{
+			"id":     int64(i),
+			"name":   "device" + strconv.Itoa(i),
+			"desc":   strings.Repeat("a wide dimension row ", 10),
+			"tags":   []interface{}{"a", "b"},
+			"nested": map[string]interface{}{"size": 1.5, "ok": true},
+		}, map[string]interface{}{"topic": "devices"}, now))
+	}
+	c.Set("small", small)
+	c.Set("large", large)
+	if c.items["small"].compressed != nil {
+		t.Error("small value should not be compressed")
+	}
+	if it := c.items["large"]; it.compressed == nil || it.data != nil {
+		t.Error("large value should be compressed")
+	} else if it.cost >= EstimateSize(large) {
+		t.Errorf("expect the compressed cost less than %d but got %d", EstimateSize(large), it.cost)
+	}
+	for k, exp := range map[string][]api.SourceTuple{"small": small, "large": large} {
+		r, ok := c.Get(k)
+		if !ok || !reflect.DeepEqual(r, exp) {
+			t.Errorf("%s: expect %v but got %v", k, exp, r)
+		}
+	}
+	// a corrupted value is a miss
+	c.items["large"].compressed = []byte("corrupted")
+	if _, ok := c.Get("large"); ok {
+		t.Error("corrupted value should be a miss")
+	}
+	// an unknown codec disables the compression
+	uc := NewCacheWithOptions(&Options{Compression: "unknown"})
+	defer uc.Close()
+	uc.Set("large", large)
+	if uc.items["large"].compressed != nil {
+		t.Error("value should not be compressed by an unknown codec")
+	}
+}
+
+// BenchmarkCacheCompression weighs the memory saved by compressing wide rows against the CPU cost of set and get
+func BenchmarkCacheCompression(b *testing.B) {
+	row := make(map[string]interface{}, 20)
+	for i := 0; i < 20; i++ {
+		row["field"+strconv.Itoa(i)] = "value of a wide dimension row " + strconv.Itoa(i)
+	}
+	v := []api.SourceTuple{api.NewDefaultSourceTuple(row, nil)}
+	for _, codec := range []string{"", "flate", "gzip", "zlib", "zstd"} {
+		name := codec
+		if name == "" {
+			name = "none"
+		}
+		b.Run(name, func(b *testing.B) {
+			var before, after runtime.MemStats
+			runtime.GC()
+			runtime.ReadMemStats(&before)
+			c := NewCacheWithOptions(&Options{Compression: codec})
+			for i := 0; i < b.N; i++ {
+				c.Set(strconv.Itoa(i), v)
+			}
+			runtime.GC()
+			runtime.ReadMemStats(&after)
+			b.ReportMetric(float64(int64(after.HeapAlloc)-int64(before.HeapAlloc))/float64(b.N), "heap-bytes/key")
+			for i := 0; i < b.N; i++ {
+				if _, ok := c.Get(strconv.Itoa(i)); !ok {
+					b.Fatalf("key %d is missing", i)
+				}
+			}
+			c.Close()
+		})
+	}
+}
+
+func TestTTLHint(t *testing.T) {
+	c := NewCache(20, false)
+	defer c.Close()
+	clock := conf.Clock.(*clock.Mock)
+	c.Set("a", []api.SourceTuple{api.NewDefaultTTLSourceTuple(map[string]interface{}{"a": 1}, nil, 5*time.Second)})
+	c.Set("b", []api.SourceTuple{
+		api.NewDefaultSourceTupleWithTime(map[string]interface{}{"b": 1}, nil, clock.Now()),
+		api.NewDefaultTTLSourceTuple(map[string]interface{}{"b": 2}, nil, 30*time.Second),
+		api.NewDefaultTTLSourceTuple(map[string]interface{}{"b": 3}, nil, 40*time.Second),
+	})
+	c.Set("c", []api.SourceTuple{api.NewDefaultSourceTupleWithTime(map[string]interface{}{"c": 1}, nil, clock.Now())})
+	c.SetWithTTL("d", []api.SourceTuple{api.NewDefaultSourceTupleWithTime(map[string]interface{}{"d": 1}, nil, clock.Now())}, 2*time.Second)
+	clock.Add(3 * time.Second)
+	if _, ok := c.Get("d"); ok {
+		t.Error("d should expire by the explicit ttl")
+	}
+	if _, ok := c.Get("a"); !ok {
+		t.Error("a should exist")
+	}
+	clock.Add(3 * time.Second)
+	if _, ok := c.Get("a"); ok {
+		t.Error("a should expire by the ttl hint")
+	}
+	clock.Add(15 * time.Second)
+	if _, ok := c.Get("c"); ok {
+		t.Error("c should expire by the cache ttl")
+	}
+	if _, ok := c.Get("b"); !ok {
+		t.Error("b should exist by the min ttl hint")
+	}
+	clock.Add(10 * time.Second)
+	if _, ok := c.Get("b"); ok {
+		t.Error("b should expire by the min ttl hint")
+	}
+}
+
+func TestTTLHintWithoutCacheTTL(t *testing.T) {
+	c := NewCache(0, false)
+	defer c.Close()
+	clock := conf.Clock.(*clock.Mock)
+	c.Set("a", []api.SourceTuple{api.NewDefaultTTLSourceTuple(map[string]interface{}{"a": 1}, nil, 5*time.Second)})
+	c.Set("b", []api.SourceTuple{api.NewDefaultSourceTupleWithTime(map[string]interface{}{"b": 1}, nil, clock.Now())})
+	clock.Add(6 * time.Second)
+	if _, ok := c.Get("a"); ok {
+		t.Error("a should expire by the ttl hint")
+	}
+	if _, ok := c.Get("b"); !ok {
+		t.Error("b should never expire")
+	}
+}
+
+func TestMaxBytes(t *testing.T) {
+	clock := conf.Clock.(*clock.Mock)
+	small := []api.SourceTuple{api.NewDefaultSourceTupleWithTime(map[string]interface{}{"a": 1}, nil, clock.Now())}
+	large := make([]api.SourceTuple, 0, 10)
+	for i := 0; i < 10; i++ {
+		large = append(large, api.NewDefaultSourceTupleWithTime(map[string]interface{}{"a": i, "b": "a long long string value"}, nil, clock.Now()))
+	}
+	smallSize := 1 + EstimateSize(small)
+	largeSize := 1 + EstimateSize(large)
+	c := NewCacheWithOptions(&Options{MaxBytes: largeSize + smallSize*5})
+	defer c.Close()
+	c.Set("l", large)
+	for i := 0; i < 5; i++ {
+		c.Set(strconv.Itoa(i), small)
+	}
+	if c.Size() != largeSize+smallSize*5 {
+		t.Errorf("expect size %d but got %d", largeSize+smallSize*5, c.Size())
+	}
+	clock.Add(10 * time.Millisecond)
+	// Access the small ones so that the large idle one has the highest cost
+	for i := 0; i < 5; i++ {
+		if _, ok := c.Get(strconv.Itoa(i)); !ok {
+			t.Errorf("%d should exist", i)
+		}
+	}
+	clock.Add(10 * time.Millisecond)
+	c.Set("5", small)
+	if _, ok := c.Get("l"); ok {
+		t.Error("large result should be evicted")
+	}
+	for i := 0; i < 6; i++ {
+		if _, ok := c.Get(strconv.Itoa(i)); !ok {
+			t.Errorf("%d should exist", i)
+		}
+	}
+	if c.Size() > largeSize+smallSize*5 {
+		t.Errorf("size %d exceeds the max bytes", c.Size())
+	}
+	// Result larger than the budget is not cached
+	c = NewCacheWithOptions(&Options{MaxBytes: smallSize})
+	defer c.Close()
+	c.Set("l", large)
+	if _, ok := c.Get("l"); ok {
+		t.Error("result larger than max bytes should not be cached")
+	}
+	c.Delete("l")
+	c.Set("s", small)
+	c.Delete("s")
+	if c.Size() != 0 {
+		t.Errorf("expect size 0 after delete but got %d", c.Size())
+	}
+}
+
+func TestMaxItems(t *testing.T) {
+	c := NewCacheWithOptions(&Options{MaxItems: 10})
+	defer c.Close()
+	v := []api.SourceTuple{api.NewDefaultSourceTuple(map[string]interface{}{"a": 1}, nil)}
+	for i := 0; i < 10; i++ {
+		c.Set(strconv.Itoa(i), v)
+	}
+	// Access the first ones so that 2 and 3 are the least recently used
+	for _, k := range []string{"0", "1"} {
+		if _, ok := c.Get(k); !ok {
+			t.Errorf("%s should exist", k)
+		}
+	}
+	// Exceeding the max items evicts down to 90%
+	c.Set("10", v)
+	for _, k := range []string{"2", "3"} {
+		if _, ok := c.Get(k); ok {
+			t.Errorf("%s should be evicted", k)
+		}
+	}
+	for _, k := range []string{"0", "1", "4", "10"} {
+		if _, ok := c.Get(k); !ok {
+			t.Errorf("%s should exist", k)
+		}
+	}
+	if n := c.Evictions(); n != 2 {
+		t.Errorf("expect 2 evictions but got %d", n)
+	}
+	// Updating an existing key does not evict
+	c.Set("0", v)
+	if n := c.Evictions(); n != 2 {
+		t.Errorf("expect 2 evictions but got %d", n)
+	}
+}
+
+func TestMissingKeyTTL(t *testing.T) {
+	clock := conf.Clock.(*clock.Mock)
+	v := []api.SourceTuple{api.NewDefaultSourceTuple(map[string]interface{}{"a": 1}, nil)}
+	for _, ttl := range []time.Duration{0, 10 * time.Second} {
+		c := NewCacheWithOptions(&Options{TTL: ttl, CacheMissingKey: true, MissingKeyTTL: time.Second})
+		c.Set("a", v)
+		c.Set("b", nil)
+		if _, ok := c.Get("b"); !ok {
+			t.Errorf("ttl %v: b should be cached", ttl)
+		}
+		clock.Add(2 * time.Second)
+		if _, ok := c.Get("b"); ok {
+			t.Errorf("ttl %v: b should expire by the missing key ttl", ttl)
+		}
+		if _, ok := c.Get("a"); !ok {
+			t.Errorf("ttl %v: a should keep the cache ttl", ttl)
+		}
+		c.Close()
+	}
+}
+
+func TestMisses(t *testing.T) {
+	clock := conf.Clock.(*clock.Mock)
+	c := NewCache(20, true)
+	defer c.Close()
+	missedAt := clock.Now()
+	c.Set("a", nil)
+	c.Set("b", []api.SourceTuple{api.NewDefaultSourceTuple(map[string]interface{}{"a": 1}, nil)})
+	clock.Add(10 * time.Second)
+	c.Set("c", []api.SourceTuple{})
+	if n := c.MissCount(); n != 2 {
+		t.Errorf("expect 2 misses but got %d", n)
+	}
+	misses := make(map[string]time.Time)
+	c.RangeMisses(func(key string, at time.Time) bool {
+		misses[key] = at
+		return true
+	})
+	exp := map[string]time.Time{
+		"a": time.UnixMilli(missedAt.UnixMilli()),
+		"c": time.UnixMilli(missedAt.Add(10 * time.Second).UnixMilli()),
+	}
+	if !reflect.DeepEqual(exp, misses) {
+		t.Errorf("expect misses %v but got %v", exp, misses)
+	}
+	// overwrite the miss with a result
+	c.Set("a", []api.SourceTuple{api.NewDefaultSourceTuple(map[string]interface{}{"a": 1}, nil)})
+	if n := c.MissCount(); n != 1 {
+		t.Errorf("expect 1 miss after overwritten but got %d", n)
+	}
+	c.Delete("c")
+	if n := c.MissCount(); n != 0 {
+		t.Errorf("expect 0 miss after deleted but got %d", n)
+	}
+	c.Set("d", nil)
+	c.Clear()
+	if n := c.MissCount(); n != 0 {
+		t.Errorf("expect 0 miss after cleared but got %d", n)
+	}
+}
+
+func TestUpdateOptions(t *testing.T) {
+	clock := conf.Clock.(*clock.Mock)
+	c := NewCache(20, true)
+	defer c.Close()
+	v := []api.SourceTuple{api.NewDefaultSourceTuple(map[string]interface{}{"a": 1}, nil)}
+	c.Set("a", v)
+	c.Set("b", nil)
+	c.SetCacheMissingKey(false)
+	if _, ok := c.Get("b"); ok {
+		t.Error("b should be removed when not caching missing key")
+	}
+	if n := c.MissCount(); n != 0 {
+		t.Errorf("expect 0 miss but got %d", n)
+	}
+	c.Set("c", nil)
+	if _, ok := c.Get("c"); ok {
+		t.Error("c should not be cached")
+	}
+	c.SetTTL(5 * time.Second)
+	c.Set("d", v)
+	clock.Add(6 * time.Second)
+	if _, ok := c.Get("d"); ok {
+		t.Error("d should expire by the updated ttl")
+	}
+	if _, ok := c.Get("a"); !ok {
+		t.Error("a should keep the original ttl")
+	}
+	c.SetCacheMissingKey(true)
+	c.Set("c", nil)
+	if _, ok := c.Get("c"); !ok {
+		t.Error("c should be cached after caching missing key again")
+	}
+}
+
+func TestSliding(t *testing.T) {
+	c := NewCacheWithOptions(&Options{TTL: 10 * time.Second, Sliding: true})
+	defer c.Close()
+	clock := conf.Clock.(*clock.Mock)
+	c.Set("hot", []api.SourceTuple{api.NewDefaultSourceTupleWithTime(map[string]interface{}{"a": 1}, nil, clock.Now())})
+	c.Set("cold", []api.SourceTuple{api.NewDefaultSourceTupleWithTime(map[string]interface{}{"a": 2}, nil, clock.Now())})
+	for i := 0; i < 4; i++ {
+		clock.Add(6 * time.Second)
+		if _, ok := c.Get("hot"); !ok {
+			t.Fatalf("hot should be extended on access at round %d", i)
+		}
+	}
+	if _, ok := c.Get("cold"); ok {
+		t.Error("cold should expire")
+	}
+	clock.Add(11 * time.Second)
+	if _, ok := c.Get("hot"); ok {
+		t.Error("hot should expire without access")
+	}
+}
+
+func TestFirstWriteWins(t *testing.T) {
+	c := NewCacheWithOptions(&Options{TTL: 10 * time.Second, FirstWriteWins: true})
+	defer c.Close()
+	clock := conf.Clock.(*clock.Mock)
+	vs := make([][]api.SourceTuple, 8)
+	for i := range vs {
+		vs[i] = []api.SourceTuple{api.NewDefaultSourceTuple(map[string]interface{}{"a": i}, nil)}
+	}
+	var wg sync.WaitGroup
+	for _, v := range vs {
+		wg.Add(1)
+		go func(v []api.SourceTuple) {
+			defer wg.Done()
+			c.Set("a", v)
+		}(v)
+	}
+	wg.Wait()
+	first, ok := c.Get("a")
+	if !ok {
+		t.Fatal("a should exist")
+	}
+	c.Set("a", vs[0])
+	c.Set("a", vs[1])
+	if r, _ := c.Get("a"); !reflect.DeepEqual(first, r) {
+		t.Errorf("expect the first write %v kept but got %v", first, r)
+	}
+	// the expired value is replaced
+	clock.Add(11 * time.Second)
+	c.Set("a", vs[2])
+	if r, _ := c.Get("a"); !reflect.DeepEqual(vs[2], r) {
+		t.Errorf("expect %v after expiration but got %v", vs[2], r)
+	}
+	// the deleted value is replaced
+	c.Delete("a")
+	c.Set("a", vs[3])
+	if r, _ := c.Get("a"); !reflect.DeepEqual(vs[3], r) {
+		t.Errorf("expect %v after deletion but got %v", vs[3], r)
+	}
+
+	lc := NewCacheWithOptions(&Options{TTL: 10 * time.Second})
+	defer lc.Close()
+	lc.Set("a", vs[0])
+	lc.Set("a", vs[1])
+	if r, _ := lc.Get("a"); !reflect.DeepEqual(vs[1], r) {
+		t.Errorf("expect the last write %v but got %v", vs[1], r)
+	}
+}
+
+func TestStaleWhileRevalidate(t *testing.T) {
+	c := NewCacheWithOptions(&Options{TTL: 10 * time.Second, StaleWhileRevalidate: true})
+	defer c.Close()
+	clock := conf.Clock.(*clock.Mock)
+	v1 := []api.SourceTuple{api.NewDefaultSourceTupleWithTime(map[string]interface{}{"v": 1}, nil, clock.Now())}
+	v2 := []api.SourceTuple{api.NewDefaultSourceTupleWithTime(map[string]interface{}{"v": 2}, nil, clock.Now())}
+	c.Set("a", v1)
+	c.Set("b", v1)
+	clock.Add(11 * time.Second)
+
+	var loads int32
+	proceed := make(chan struct{})
+	load := func() error {
+		atomic.AddInt32(&loads, 1)
+		<-proceed
+		c.Set("a", v2)
+		return nil
+	}
+	for i := 0; i < 3; i++ {
+		r, hit, stale := c.GetOrRevalidate(context.Background(), "a", load)
+		if !hit || !stale || !reflect.DeepEqual(v1, r) {
+			t.Fatalf("round %d: expect the stale value but got %v, %v, %v", i, r, hit, stale)
+		}
+	}
+	close(proceed)
+	waitFor(t, func() bool {
+		r, ok := c.Get("a")
+		return ok && reflect.DeepEqual(v2, r)
+	})
+	if n := atomic.LoadInt32(&loads); n != 1 {
+		t.Errorf("expect the refreshes coalesced into 1 but got %d", n)
+	}
+
+	var failures int32
+	fail := func() error {
+		atomic.AddInt32(&failures, 1)
+		return errors.New("connection refused")
+	}
+	if _, hit, stale := c.GetOrRevalidate(context.Background(), "b", fail); !hit || !stale {
+		t.Errorf("expect the stale value of b but got %v, %v", hit, stale)
+	}
+	waitFor(t, func() bool {
+		_, hit, _ := c.GetOrRevalidate(context.Background(), "b", fail)
+		return hit && atomic.LoadInt32(&failures) > 1
+	})
+	// beyond the max stale time which is the ttl by default
+	clock.Add(10 * time.Second)
+	if _, hit, _ := c.GetOrRevalidate(context.Background(), "b", fail); hit {
+		t.Error("expect b to be missed beyond the max stale time")
+	}
+}
+
+// waitFor waits until the condition is met by the background routine
+func waitFor(t *testing.T, cond func() bool) {
+	for i := 0; i < 20; i++ {
+		if cond() {
+			return
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+	t.Fatal("wait for the condition timeout")
+}
+
+type mapBackend struct {
+	items  map[string][]api.SourceTuple
+	ttls   map[string]time.Duration
+	closed bool
+}
+
+func (b *mapBackend) Get(key string) ([]api.SourceTuple, bool) {
+	v, ok := b.items[key]
+	return v, ok
+}
+
+func (b *mapBackend) Set(key string, value []api.SourceTuple, ttl time.Duration) {
+	b.items[key] = value
+	b.ttls[key] = ttl
+}
+
+func (b *mapBackend) Delete(key string) {
+	delete(b.items, key)
+}
+
+func (b *mapBackend) Clear() {
+	b.items = make(map[string][]api.SourceTuple)
+}
+
+func (b *mapBackend) Close() {
+	b.closed = true
+}
+
+func TestBackend(t *testing.T) {
+	b := &mapBackend{items: make(map[string][]api.SourceTuple), ttls: make(map[string]time.Duration)}
+	RegisterBackend("map", func(_ string, _ map[string]interface{}) (Backend, error) {
+		return b, nil
+	})
+	if _, err := NewBackend("unknown", "test", nil); err == nil {
+		t.Error("expect error for unknown backend")
+	}
+	nb, err := NewBackend("map", "test", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := NewCacheWithOptions(&Options{TTL: 10 * time.Second, Backend: nb})
+	v := []api.SourceTuple{api.NewDefaultSourceTuple(map[string]interface{}{"a": 1}, nil)}
+	c.Set("a", v)
+	c.SetWithTTL("b", v, 2*time.Second)
+	c.Set("c", nil)
+	if r, ok := c.Get("a"); !ok || !reflect.DeepEqual(v, r) {
+		t.Errorf("expect a in the backend but got %v", r)
+	}
+	exp := map[string]time.Duration{"a": 10 * time.Second, "b": 2 * time.Second}
+	if !reflect.DeepEqual(exp, b.ttls) {
+		t.Errorf("expect ttls %v but got %v", exp, b.ttls)
+	}
+	c.Delete("a")
+	if _, ok := b.items["a"]; ok {
+		t.Error("a should be deleted from the backend")
+	}
+	c.Clear()
+	if len(b.items) != 0 {
+		t.Errorf("expect the backend cleared but got %v", b.items)
+	}
+	c.Close()
+	if !b.closed {
+		t.Error("expect the backend closed")
+	}
+}
+
+func TestBackendUpdateMissingKey(t *testing.T) {
+	v := []api.SourceTuple{api.NewDefaultSourceTuple(map[string]interface{}{"a": 1}, nil)}
+	b := &mapBackend{items: make(map[string][]api.SourceTuple), ttls: make(map[string]time.Duration)}
+	c := NewCacheWithOptions(&Options{CacheMissingKey: true, Backend: b})
+	other := NewCacheWithOptions(&Options{CacheMissingKey: true, Backend: b})
+	c.Set("a", v)
+	c.Set("b", nil)
+	c.Set("c", nil)
+	other.Set("d", v)
+	other.Set("e", nil)
+	// the miss is replaced by a value of another cache sharing the backend
+	other.Set("c", v)
+	c.SetCacheMissingKey(false)
+	exp := map[string][]api.SourceTuple{"a": v, "c": v, "d": v, "e": nil}
+	if !reflect.DeepEqual(exp, b.items) {
+		t.Errorf("expect only the misses of the cache deleted but got %v", b.items)
+	}
+	c.Set("f", nil)
+	if _, ok := b.items["f"]; ok {
+		t.Error("f should not be cached")
+	}
+}
+
+type prefixMapBackend struct {
+	*mapBackend
+}
+
+func (b *prefixMapBackend) ClearPrefix(prefix string) {
+	for k := range b.items {
+		if strings.HasPrefix(k, prefix) {
+			delete(b.items, k)
+		}
+	}
+}
+
+func TestNamespace(t *testing.T) {
+	v := []api.SourceTuple{api.NewDefaultSourceTuple(map[string]interface{}{"a": 1}, nil)}
+	b := &prefixMapBackend{&mapBackend{items: make(map[string][]api.SourceTuple), ttls: make(map[string]time.Duration)}}
+	prod := NewCacheWithOptions(&Options{Backend: b})
+	test := NewCacheWithOptions(&Options{Backend: b, Namespace: "test"})
+	prod.Set("a", v)
+	if _, ok := test.Get("a"); ok {
+		t.Error("expect the key of the other namespace missed")
+	}
+	test.Set("a", v)
+	test.Set("b", v)
+	if _, ok := b.items["test:a"]; !ok {
+		t.Errorf("expect the key prefixed by the namespace but got %v", b.items)
+	}
+	test.Delete("b")
+	if _, ok := b.items["test:b"]; ok {
+		t.Error("test:b should be deleted from the backend")
+	}
+	test.Clear()
+	if _, ok := prod.Get("a"); !ok || len(b.items) != 1 {
+		t.Errorf("expect only the keys of the namespace cleared but got %v", b.items)
+	}
+
+	c := NewCacheWithOptions(&Options{CacheMissingKey: true, Namespace: "test"})
+	defer c.Close()
+	c.Set("a", v)
+	c.Set("b", nil)
+	if r, ok := c.Get("a"); !ok || !reflect.DeepEqual(v, r) {
+		t.Errorf("expect a in the namespaced cache but got %v", r)
+	}
+	var misses []string
+	c.RangeMisses(func(key string, _ time.Time) bool {
+		misses = append(misses, key)
+		return true
+	})
+	if !reflect.DeepEqual([]string{"b"}, misses) {
+		t.Errorf("expect the misses without the namespace but got %v", misses)
+	}
+}
+
+func TestView(t *testing.T) {
+	mc := conf.Clock.(*clock.Mock)
+	v := []api.SourceTuple{api.NewDefaultSourceTuple(map[string]interface{}{"a": 1}, nil)}
+	base := NewCacheWithOptions(&Options{MaxItems: 10})
+	defer base.Close()
+	long := NewView(base, &Options{TTL: 20 * time.Second, CacheMissingKey: true, Namespace: "k1"})
+	short := NewView(base, &Options{TTL: 5 * time.Second, Namespace: "k1"})
+	other := NewView(base, &Options{TTL: 20 * time.Second, CacheMissingKey: true, Namespace: "k2"})
+	long.Set("a", v)
+	long.Set("b", nil)
+	if r, ok := short.Get("a"); !ok || !reflect.DeepEqual(v, r) {
+		t.Errorf("expect a set by the other view of the namespace but got %v", r)
+	}
+	if _, ok := short.Get("b"); ok {
+		t.Error("expect the empty result hidden for the view not caching it")
+	}
+	if _, ok := other.Get("a"); ok {
+		t.Error("expect a missed in the other namespace")
+	}
+	if base.Len() != 2 || other.Len() != 2 {
+		t.Errorf("expect the items stored once in the base but got %d", base.Len())
+	}
+	mc.Add(6 * time.Second)
+	if _, ok := short.Get("a"); ok {
+		t.Error("expect a hidden after the ttl of the view")
+	}
+	if _, ok := long.Get("a"); !ok {
+		t.Error("expect a kept for the view of the longer ttl")
+	}
+	// the short view sets its own ttl
+	short.Set("c", v)
+	mc.Add(6 * time.Second)
+	if _, ok := long.Get("c"); ok {
+		t.Error("expect c expired by the ttl of the view which sets it")
+	}
+	other.Set("a", v)
+	long.Clear()
+	if _, ok := other.Get("a"); !ok || base.Len() != 1 {
+		t.Errorf("expect only the items of the namespace cleared but got %d items", base.Len())
+	}
+	other.Close()
+	if _, ok := other.Get("a"); !ok {
+		t.Error("expect the base not closed by the view")
+	}
+}
@@ -0,0 +1,100 @@
+// Copyright 2023 EMQ Technologies Co., Ltd.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cache
+
+import (
+	"bytes"
+	"encoding/gob"
+	"sync"
+	"time"
+
+	"github.com/lf-edge/ekuiper/internal/compressor"
+	"github.com/lf-edge/ekuiper/pkg/api"
+	"github.com/lf-edge/ekuiper/pkg/message"
+)
+
+func init() {
+	// the composite values in the messages are encoded as interface values
+	gob.Register(map[string]interface{}{})
+	gob.Register([]interface{}{})
+	gob.Register([]map[string]interface{}{})
+	gob.Register(time.Time{})
+}
+
+type encodedTuple struct {
+	Message map[string]interface{}
+	Meta    map[string]interface{}
+	Time    time.Time
+}
+
+// codec compresses the cached values. The compressors reuse their buffers, so they are called with the lock
+type codec struct {
+	sync.Mutex
+	c message.Compressor
+	d message.Decompressor
+}
+
+func newCodec(name string) (*codec, error) {
+	c, err := compressor.GetCompressor(name)
+	if err != nil {
+		return nil, err
+	}
+	d, err := compressor.GetDecompressor(name)
+	if err != nil {
+		return nil, err
+	}
+	return &codec{c: c, d: d}, nil
+}
+
+// compress encodes the tuples and compresses the bytes. The ttl hint of the tuples is not kept,
+// so the decompressed tuples are the default source tuples
+func (cd *codec) compress(value []api.SourceTuple) ([]byte, error) {
+	ets := make([]encodedTuple, 0, len(value))
+	for _, t := range value {
+		ets = append(ets, encodedTuple{Message: t.Message(), Meta: t.Meta(), Time: t.Timestamp()})
+	}
+	var buf bytes.Buffer
+	if err := gob.NewEncoder(&buf).Encode(ets); err != nil {
+		return nil, err
+	}
+	cd.Lock()
+	defer cd.Unlock()
+	r, err := cd.c.Compress(buf.Bytes())
+	if err != nil {
+		return nil, err
+	}
+	return append([]byte(nil), r...), nil
+}
+
+func (cd *codec) decompress(data []byte) ([]api.SourceTuple, error) {
+	cd.Lock()
+	raw, err := cd.d.Decompress(data)
+	if err == nil {
+		data = append([]byte(nil), raw...)
+	}
+	cd.Unlock()
+	if err != nil {
+		return nil, err
+	}
+	var ets []encodedTuple
+	if err := gob.NewDecoder(bytes.NewReader(data)).Decode(&ets); err != nil {
+		return nil, err
+	}
+	value := make([]api.SourceTuple, 0, len(ets))
+	for _, et := range ets {
+		value = append(value, api.NewDefaultSourceTupleWithTime(et.Message, et.Meta, et.Time))
+	}
+	return value, nil
+}
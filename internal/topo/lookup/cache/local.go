@@ -0,0 +1,338 @@
+// Copyright 2023 EMQ Technologies Co., Ltd.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cache
+
+import (
+	"container/list"
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/benbjohnson/clock"
+
+	"github.com/lf-edge/ekuiper/internal/conf"
+	"github.com/lf-edge/ekuiper/internal/pkg/store"
+	"github.com/lf-edge/ekuiper/pkg/api"
+	"github.com/lf-edge/ekuiper/pkg/cast"
+	"github.com/lf-edge/ekuiper/pkg/kv"
+)
+
+// BackendLocal is the name of the backend storing the cache in the local KV store of eKuiper, such as sqlite
+const BackendLocal = "local"
+
+func init() {
+	RegisterBackend(BackendLocal, newLocalBackend)
+}
+
+type localConf struct {
+	// MaxItems is the max count of the stored results. The earliest stored results are evicted when exceeded.
+	// 0 means no limit
+	MaxItems int `json:"maxItems"`
+	// CompactInterval is the interval in milliseconds to delete the expired results from the store. 0 means never,
+	// and the expired results are only deleted when read
+	CompactInterval int64 `json:"compactInterval"`
+}
+
+// localTuple is the stored format of a cached source tuple
+type localTuple struct {
+	Message   map[string]interface{} `json:"message"`
+	Meta      map[string]interface{} `json:"meta,omitempty"`
+	Timestamp int64                  `json:"timestamp"`
+}
+
+type localEntry struct {
+	Tuples []localTuple `json:"tuples"`
+	// Expiration is the expire time in milliseconds, 0 means never expire
+	Expiration int64 `json:"expiration"`
+	// Stored is the time in milliseconds when stored, to restore the eviction order
+	Stored int64 `json:"stored"`
+}
+
+type localKey struct {
+	key        string
+	expiration int64
+}
+
+// localBackend stores the cache in the local KV store so that it survives the restarts of the device. The keys are
+// indexed in memory in the stored order, which is loaded from the store when created, to locate the expired and the
+// earliest results without scanning the store. The backend of a lookup table is shared by all the lookup nodes,
+// so the props of the first node apply, and the later nodes can only omit the props or set the same values.
+type localBackend struct {
+	sync.Mutex
+	table           string
+	store           kv.KeyValue
+	maxItems        int
+	compactInterval int64
+	order           *list.List
+	index           map[string]*list.Element
+	refs            int
+	cancel          context.CancelFunc
+}
+
+var (
+	localBackends = make(map[string]*localBackend)
+	localLock     = &sync.Mutex{}
+)
+
+func newLocalBackend(name string, props map[string]interface{}) (Backend, error) {
+	cfg := &localConf{}
+	if err := cast.MapToStruct(props, cfg); err != nil {
+		return nil, err
+	}
+	if cfg.MaxItems < 0 {
+		return nil, fmt.Errorf("invalid maxItems %d, must not be negative", cfg.MaxItems)
+	}
+	if cfg.CompactInterval < 0 {
+		return nil, fmt.Errorf("invalid compactInterval %d, must not be negative", cfg.CompactInterval)
+	}
+	table := "lookup/" + name
+	localLock.Lock()
+	defer localLock.Unlock()
+	if b, ok := localBackends[table]; ok {
+		if _, set := props["maxItems"]; set && cfg.MaxItems != b.maxItems {
+			return nil, fmt.Errorf("local cache %s is already used with maxItems %d, conflicts with %d", table, b.maxItems, cfg.MaxItems)
+		}
+		if _, set := props["compactInterval"]; set && cfg.CompactInterval != b.compactInterval {
+			return nil, fmt.Errorf("local cache %s is already used with compactInterval %d, conflicts with %d", table, b.compactInterval, cfg.CompactInterval)
+		}
+		b.Lock()
+		b.refs++
+		b.Unlock()
+		return b, nil
+	}
+	s, err := store.GetCacheKV(table)
+	if err != nil {
+		return nil, err
+	}
+	b := &localBackend{table: table, store: s, maxItems: cfg.MaxItems, compactInterval: cfg.CompactInterval, order: list.New(), index: make(map[string]*list.Element), refs: 1}
+	if err := b.load(); err != nil {
+		return nil, err
+	}
+	if cfg.CompactInterval > 0 {
+		ctx, cancel := context.WithCancel(context.Background())
+		b.cancel = cancel
+		go b.run(ctx, conf.GetTicker(cfg.CompactInterval))
+	}
+	localBackends[table] = b
+	return b, nil
+}
+
+// load indexes the stored keys in the stored order
+func (b *localBackend) load() error {
+	all, err := b.store.All()
+	if err != nil {
+		return fmt.Errorf("fail to load the local cache %s: %v", b.table, err)
+	}
+	type loaded struct {
+		localKey
+		stored int64
+	}
+	keys := make([]loaded, 0, len(all))
+	for sk, v := range all {
+		raw, err := hex.DecodeString(sk)
+		if err != nil {
+			continue
+		}
+		e := &localEntry{}
+		if err := json.Unmarshal([]byte(v), e); err != nil {
+			conf.Log.Warnf("local cache %s decode %s error: %v", b.table, raw, err)
+			continue
+		}
+		keys = append(keys, loaded{localKey: localKey{key: string(raw), expiration: e.Expiration}, stored: e.Stored})
+	}
+	sort.SliceStable(keys, func(i, j int) bool {
+		return keys[i].stored < keys[j].stored
+	})
+	for i := range keys {
+		k := keys[i].localKey
+		b.index[k.key] = b.order.PushBack(&k)
+	}
+	b.evict()
+	conf.Log.Infof("local cache %s loads %d results", b.table, len(keys))
+	return nil
+}
+
+func (b *localBackend) Get(key string) ([]api.SourceTuple, bool) {
+	b.Lock()
+	defer b.Unlock()
+	el, ok := b.index[key]
+	if !ok {
+		return nil, false
+	}
+	if lk := el.Value.(*localKey); lk.expiration > 0 && lk.expiration <= conf.GetNowInMilli() {
+		b.remove(el)
+		return nil, false
+	}
+	var v string
+	found, err := b.store.Get(hex.EncodeToString([]byte(key)), &v)
+	if err != nil || !found {
+		if err != nil {
+			conf.Log.Warnf("local cache %s get %s error: %v", b.table, key, err)
+		}
+		b.order.Remove(el)
+		delete(b.index, key)
+		return nil, false
+	}
+	e := &localEntry{}
+	if err := json.Unmarshal([]byte(v), e); err != nil {
+		conf.Log.Warnf("local cache %s decode %s error: %v", b.table, key, err)
+		return nil, false
+	}
+	r := make([]api.SourceTuple, 0, len(e.Tuples))
+	for _, t := range e.Tuples {
+		r = append(r, api.NewDefaultSourceTupleWithTime(t.Message, t.Meta, time.UnixMilli(t.Timestamp)))
+	}
+	return r, true
+}
+
+func (b *localBackend) Set(key string, value []api.SourceTuple, ttl time.Duration) {
+	b.Lock()
+	defer b.Unlock()
+	b.set(key, value, ttl)
+}
+
+// SetIfAbsent stores the value only if the key is absent or expired for the first write wins policy
+func (b *localBackend) SetIfAbsent(key string, value []api.SourceTuple, ttl time.Duration) {
+	b.Lock()
+	defer b.Unlock()
+	if el, ok := b.index[key]; ok {
+		if lk := el.Value.(*localKey); lk.expiration <= 0 || lk.expiration > conf.GetNowInMilli() {
+			return
+		}
+	}
+	b.set(key, value, ttl)
+}
+
+func (b *localBackend) set(key string, value []api.SourceTuple, ttl time.Duration) {
+	now := conf.GetNowInMilli()
+	e := &localEntry{Tuples: make([]localTuple, 0, len(value)), Stored: now}
+	if ttl > 0 {
+		e.Expiration = now + ttl.Milliseconds()
+	}
+	for _, v := range value {
+		e.Tuples = append(e.Tuples, localTuple{Message: v.Message(), Meta: v.Meta(), Timestamp: v.Timestamp().UnixMilli()})
+	}
+	data, err := json.Marshal(e)
+	if err != nil {
+		conf.Log.Warnf("local cache %s encode %s error: %v", b.table, key, err)
+		return
+	}
+	if err := b.store.Set(hex.EncodeToString([]byte(key)), string(data)); err != nil {
+		conf.Log.Warnf("local cache %s set %s error: %v", b.table, key, err)
+		return
+	}
+	if el, ok := b.index[key]; ok {
+		b.order.Remove(el)
+	}
+	b.index[key] = b.order.PushBack(&localKey{key: key, expiration: e.Expiration})
+	b.evict()
+}
+
+// evict removes the earliest stored results over the max items
+func (b *localBackend) evict() {
+	for b.maxItems > 0 && b.order.Len() > b.maxItems {
+		b.remove(b.order.Front())
+	}
+}
+
+func (b *localBackend) remove(el *list.Element) {
+	lk := el.Value.(*localKey)
+	b.order.Remove(el)
+	delete(b.index, lk.key)
+	if err := b.store.Delete(hex.EncodeToString([]byte(lk.key))); err != nil {
+		conf.Log.Debugf("local cache %s delete %s error: %v", b.table, lk.key, err)
+	}
+}
+
+func (b *localBackend) Delete(key string) {
+	b.Lock()
+	defer b.Unlock()
+	if el, ok := b.index[key]; ok {
+		b.remove(el)
+	}
+}
+
+func (b *localBackend) Clear() {
+	b.Lock()
+	defer b.Unlock()
+	if err := b.store.Clean(); err != nil {
+		conf.Log.Warnf("local cache %s clear error: %v", b.table, err)
+	}
+	b.order.Init()
+	b.index = make(map[string]*list.Element)
+}
+
+// ClearPrefix deletes the results of the keys with the prefix of the namespace
+func (b *localBackend) ClearPrefix(prefix string) {
+	b.Lock()
+	defer b.Unlock()
+	for k, el := range b.index {
+		if strings.HasPrefix(k, prefix) {
+			b.remove(el)
+		}
+	}
+}
+
+func (b *localBackend) run(ctx context.Context, ticker *clock.Ticker) {
+	for {
+		select {
+		case <-ticker.C:
+			b.compact()
+		case <-ctx.Done():
+			ticker.Stop()
+			return
+		}
+	}
+}
+
+// compact deletes the expired results from the store
+func (b *localBackend) compact() {
+	now := conf.GetNowInMilli()
+	b.Lock()
+	defer b.Unlock()
+	n := 0
+	for el := b.order.Front(); el != nil; {
+		next := el.Next()
+		if lk := el.Value.(*localKey); lk.expiration > 0 && lk.expiration <= now {
+			b.remove(el)
+			n++
+		}
+		el = next
+	}
+	if n > 0 {
+		conf.Log.Debugf("local cache %s compacts %d expired results", b.table, n)
+	}
+}
+
+// Close releases the backend of the node. The stored results are kept for the next run
+func (b *localBackend) Close() {
+	localLock.Lock()
+	defer localLock.Unlock()
+	b.Lock()
+	defer b.Unlock()
+	b.refs--
+	if b.refs > 0 {
+		return
+	}
+	if b.cancel != nil {
+		b.cancel()
+	}
+	delete(localBackends, b.table)
+}
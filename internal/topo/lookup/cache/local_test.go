@@ -0,0 +1,109 @@
+// Copyright 2023 EMQ Technologies Co., Ltd.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cache
+
+import (
+	"testing"
+	"time"
+
+	"github.com/benbjohnson/clock"
+	"github.com/stretchr/testify/require"
+
+	"github.com/lf-edge/ekuiper/internal/conf"
+	"github.com/lf-edge/ekuiper/internal/pkg/store"
+	"github.com/lf-edge/ekuiper/pkg/api"
+)
+
+func TestLocalBackend(t *testing.T) {
+	require.NoError(t, store.SetupDefault(t.TempDir()))
+	mc := conf.Clock.(*clock.Mock)
+	rows := func(v int) []api.SourceTuple {
+		return []api.SourceTuple{api.NewDefaultSourceTupleWithTime(map[string]interface{}{"a": float64(v)}, nil, time.UnixMilli(mc.Now().UnixMilli()))}
+	}
+	b, err := NewBackend(BackendLocal, "test", map[string]interface{}{"maxItems": 2})
+	require.NoError(t, err)
+	b.Set("it's", rows(1), 0)
+	b.Set("b", rows(2), time.Second)
+	r, ok := b.Get("it's")
+	require.True(t, ok)
+	require.Equal(t, rows(1), r)
+	// the earliest is evicted
+	c := rows(3)
+	b.Set("c", c, 0)
+	_, ok = b.Get("it's")
+	require.False(t, ok)
+	mc.Add(2 * time.Second)
+	_, ok = b.Get("b")
+	require.False(t, ok)
+	b.Close()
+
+	// reopen after restart
+	b, err = NewBackend(BackendLocal, "test", map[string]interface{}{"maxItems": 2})
+	require.NoError(t, err)
+	r, ok = b.Get("c")
+	require.True(t, ok)
+	require.Equal(t, c, r)
+	b.(FirstWriter).SetIfAbsent("c", rows(4), 0)
+	r, _ = b.Get("c")
+	require.Equal(t, c, r)
+	b.Set("ns1:d", rows(5), 0)
+	b.(PrefixClearer).ClearPrefix("ns1:")
+	_, ok = b.Get("ns1:d")
+	require.False(t, ok)
+	_, ok = b.Get("c")
+	require.True(t, ok)
+	b.Clear()
+	_, ok = b.Get("c")
+	require.False(t, ok)
+	b.Close()
+}
+
+func TestLocalBackendCompact(t *testing.T) {
+	require.NoError(t, store.SetupDefault(t.TempDir()))
+	mc := conf.Clock.(*clock.Mock)
+	b, err := NewBackend(BackendLocal, "compact", map[string]interface{}{"compactInterval": 1000})
+	require.NoError(t, err)
+	defer b.Close()
+	// the backend is shared by the nodes of the same table
+	b2, err := NewBackend(BackendLocal, "compact", nil)
+	require.NoError(t, err)
+	require.Same(t, b, b2)
+	b2.Close()
+	// the later nodes cannot change the props of the shared backend
+	_, err = NewBackend(BackendLocal, "compact", map[string]interface{}{"compactInterval": 2000})
+	require.EqualError(t, err, "local cache lookup/compact is already used with compactInterval 1000, conflicts with 2000")
+	_, err = NewBackend(BackendLocal, "compact", map[string]interface{}{"maxItems": 10})
+	require.EqualError(t, err, "local cache lookup/compact is already used with maxItems 0, conflicts with 10")
+	b2, err = NewBackend(BackendLocal, "compact", map[string]interface{}{"compactInterval": 1000})
+	require.NoError(t, err)
+	b2.Close()
+	lb := b.(*localBackend)
+	b.Set("a", []api.SourceTuple{}, 500*time.Millisecond)
+	b.Set("b", []api.SourceTuple{}, 0)
+	mc.Add(time.Second)
+	require.Eventually(t, func() bool {
+		lb.Lock()
+		defer lb.Unlock()
+		return lb.order.Len() == 1
+	}, time.Second, 10*time.Millisecond)
+	keys, err := lb.store.Keys()
+	require.NoError(t, err)
+	require.Len(t, keys, 1)
+}
+
+func TestLocalBackendInvalid(t *testing.T) {
+	_, err := NewBackend(BackendLocal, "invalid", map[string]interface{}{"maxItems": -1})
+	require.EqualError(t, err, "invalid maxItems -1, must not be negative")
+}
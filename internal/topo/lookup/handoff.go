@@ -0,0 +1,98 @@
+// Copyright 2023 EMQ Technologies Co., Ltd.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package lookup
+
+import (
+	"sync"
+	"time"
+
+	"github.com/benbjohnson/clock"
+
+	"github.com/lf-edge/ekuiper/internal/conf"
+	"github.com/lf-edge/ekuiper/internal/topo/lookup/cache"
+)
+
+// HandoffTimeout is how long the parked caches of an updating rule wait to be taken over by the new lookup nodes
+const HandoffTimeout = time.Minute
+
+type parkedCache struct {
+	c     *cache.Cache
+	timer *clock.Timer
+}
+
+var (
+	// handoffRules are the updating rules whose lookup nodes can park the caches, with the deadline
+	handoffRules = make(map[string]time.Time)
+	parkedCaches = make(map[string]*parkedCache)
+	handoffLock  = &sync.Mutex{}
+)
+
+// PrepareHandoff is called before stopping the old topology when updating a rule. It allows the lookup nodes of the
+// rule to park their caches when stopping so that the lookup nodes of the new topology can take them over.
+func PrepareHandoff(ruleId string) {
+	handoffLock.Lock()
+	defer handoffLock.Unlock()
+	now := conf.GetNow()
+	for r, deadline := range handoffRules {
+		if now.After(deadline) {
+			delete(handoffRules, r)
+		}
+	}
+	handoffRules[ruleId] = now.Add(HandoffTimeout)
+}
+
+// ParkCache parks the cache of a stopping lookup node with the id which identifies the node and its lookup conf.
+// It returns false if the rule is not updating, and then the caller should close the cache.
+// The parked cache is closed if not taken over within HandoffTimeout.
+func ParkCache(ruleId string, id string, c *cache.Cache) bool {
+	handoffLock.Lock()
+	defer handoffLock.Unlock()
+	deadline, ok := handoffRules[ruleId]
+	if !ok {
+		return false
+	}
+	if conf.GetNow().After(deadline) {
+		delete(handoffRules, ruleId)
+		return false
+	}
+	if old, ok := parkedCaches[id]; ok {
+		old.timer.Stop()
+		old.c.Close()
+	}
+	p := &parkedCache{c: c}
+	p.timer = conf.Clock.AfterFunc(HandoffTimeout, func() {
+		handoffLock.Lock()
+		defer handoffLock.Unlock()
+		if parkedCaches[id] == p {
+			delete(parkedCaches, id)
+			p.c.Close()
+		}
+	})
+	parkedCaches[id] = p
+	return true
+}
+
+// TakeCache returns the parked cache of the id and removes it from the parking. It returns nil if not found.
+func TakeCache(id string) *cache.Cache {
+	handoffLock.Lock()
+	defer handoffLock.Unlock()
+	p, ok := parkedCaches[id]
+	if !ok {
+		return nil
+	}
+	p.timer.Stop()
+	delete(parkedCaches, id)
+	return p.c
+}
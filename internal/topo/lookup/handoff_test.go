@@ -0,0 +1,55 @@
+// Copyright 2023 EMQ Technologies Co., Ltd.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package lookup
+
+import (
+	"testing"
+	"time"
+
+	"github.com/benbjohnson/clock"
+
+	"github.com/lf-edge/ekuiper/internal/conf"
+	"github.com/lf-edge/ekuiper/internal/topo/lookup/cache"
+)
+
+func TestHandoff(t *testing.T) {
+	mc := conf.Clock.(*clock.Mock)
+	c := cache.NewCache(0, false)
+	if ParkCache("rule1", "rule1/op1", c) {
+		t.Fatal("expect not parked if the rule is not updating")
+	}
+	PrepareHandoff("rule1")
+	if !ParkCache("rule1", "rule1/op1", c) {
+		t.Fatal("expect parked for the updating rule")
+	}
+	if TakeCache("rule1/op2") != nil {
+		t.Error("expect no cache for the other node")
+	}
+	if TakeCache("rule1/op1") != c {
+		t.Error("expect to take over the parked cache")
+	}
+	if TakeCache("rule1/op1") != nil {
+		t.Error("expect the cache to be taken only once")
+	}
+	// expire if not taken
+	_ = ParkCache("rule1", "rule1/op1", c)
+	mc.Add(HandoffTimeout + time.Millisecond)
+	if TakeCache("rule1/op1") != nil {
+		t.Error("expect the parked cache expired")
+	}
+	if ParkCache("rule1", "rule1/op1", cache.NewCache(0, false)) {
+		t.Error("expect not parked after the handoff deadline")
+	}
+}
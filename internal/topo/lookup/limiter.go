@@ -0,0 +1,101 @@
+// Copyright 2023 EMQ Technologies Co., Ltd.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package lookup
+
+import (
+	"fmt"
+	"math"
+	"sync"
+	"time"
+
+	"github.com/lf-edge/ekuiper/internal/conf"
+)
+
+// Limiter is a token bucket to limit the rate of the calls to the lookup source.
+// It is safe to be shared by the lookup nodes of multiple rules.
+type Limiter struct {
+	sync.Mutex
+	// the tokens refilled per second and the bucket size
+	rate  float64
+	burst int
+	// tokens could be negative which means the tokens are reserved by the waiting calls
+	tokens float64
+	last   time.Time
+}
+
+func NewLimiter(rate float64, burst int) *Limiter {
+	return &Limiter{rate: rate, burst: burst, tokens: float64(burst), last: conf.GetNow()}
+}
+
+// Reserve takes a token and returns the duration to wait until the token is available.
+// If the wait exceeds maxWait, no token is taken and false is returned.
+func (l *Limiter) Reserve(maxWait time.Duration) (time.Duration, bool) {
+	l.Lock()
+	defer l.Unlock()
+	now := conf.GetNow()
+	if elapsed := now.Sub(l.last); elapsed > 0 {
+		l.tokens = math.Min(float64(l.burst), l.tokens+elapsed.Seconds()*l.rate)
+		l.last = now
+	}
+	if l.tokens >= 1 {
+		l.tokens--
+		return 0, true
+	}
+	wait := time.Duration((1 - l.tokens) / l.rate * float64(time.Second))
+	if wait > maxWait {
+		return wait, false
+	}
+	l.tokens--
+	return wait, true
+}
+
+type sharedLimiter struct {
+	l     *Limiter
+	count int
+}
+
+var (
+	limiters    = make(map[string]*sharedLimiter)
+	limiterLock = &sync.Mutex{}
+)
+
+// AcquireLimiter returns the limiter of the group shared by all the lookup nodes which use the same group such as
+// the same database connection. The limiter is created by the first acquirer. The later ones must have the same setting.
+func AcquireLimiter(group string, rate float64, burst int) (*Limiter, error) {
+	limiterLock.Lock()
+	defer limiterLock.Unlock()
+	if sl, ok := limiters[group]; ok {
+		if sl.l.rate != rate || sl.l.burst != burst {
+			return nil, fmt.Errorf("rate limit group %s is already defined with rate %v and burst %d", group, sl.l.rate, sl.l.burst)
+		}
+		sl.count++
+		return sl.l, nil
+	}
+	l := NewLimiter(rate, burst)
+	limiters[group] = &sharedLimiter{l: l, count: 1}
+	return l, nil
+}
+
+// ReleaseLimiter is called when the lookup node stops. The limiter is removed when no one uses it.
+func ReleaseLimiter(group string) {
+	limiterLock.Lock()
+	defer limiterLock.Unlock()
+	if sl, ok := limiters[group]; ok {
+		sl.count--
+		if sl.count <= 0 {
+			delete(limiters, group)
+		}
+	}
+}
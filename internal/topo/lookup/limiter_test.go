@@ -0,0 +1,75 @@
+// Copyright 2023 EMQ Technologies Co., Ltd.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package lookup
+
+import (
+	"testing"
+	"time"
+
+	"github.com/benbjohnson/clock"
+
+	"github.com/lf-edge/ekuiper/internal/conf"
+)
+
+func TestLimiter(t *testing.T) {
+	mc := conf.Clock.(*clock.Mock)
+	l := NewLimiter(2, 2)
+	for i := 0; i < 2; i++ {
+		if w, ok := l.Reserve(0); !ok || w != 0 {
+			t.Fatalf("%d: expect token in burst but got wait %v %v", i, w, ok)
+		}
+	}
+	if w, ok := l.Reserve(100 * time.Millisecond); ok || w != 500*time.Millisecond {
+		t.Errorf("expect rejected with wait 500ms but got %v %v", w, ok)
+	}
+	if w, ok := l.Reserve(time.Second); !ok || w != 500*time.Millisecond {
+		t.Errorf("expect reserved with wait 500ms but got %v %v", w, ok)
+	}
+	// the next token is after the reserved one
+	if w, ok := l.Reserve(time.Second); !ok || w != time.Second {
+		t.Errorf("expect reserved with wait 1s but got %v %v", w, ok)
+	}
+	mc.Add(10 * time.Second)
+	for i := 0; i < 2; i++ {
+		if _, ok := l.Reserve(0); !ok {
+			t.Errorf("%d: expect the bucket refilled to burst", i)
+		}
+	}
+	if _, ok := l.Reserve(0); ok {
+		t.Error("expect the bucket not exceeding burst")
+	}
+}
+
+func TestSharedLimiter(t *testing.T) {
+	l1, err := AcquireLimiter("db1", 10, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	l2, err := AcquireLimiter("db1", 10, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if l1 != l2 {
+		t.Error("expect the same limiter for the same group")
+	}
+	if _, err := AcquireLimiter("db1", 20, 1); err == nil {
+		t.Error("expect error for different setting of the same group")
+	}
+	ReleaseLimiter("db1")
+	ReleaseLimiter("db1")
+	if _, ok := limiters["db1"]; ok {
+		t.Error("expect the limiter removed after all released")
+	}
+}
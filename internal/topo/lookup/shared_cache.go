@@ -0,0 +1,102 @@
+// Copyright 2023 EMQ Technologies Co., Ltd.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package lookup
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/lf-edge/ekuiper/internal/topo/lookup/cache"
+)
+
+type sharedCache struct {
+	c     *cache.Cache
+	opts  cache.Options
+	count int
+}
+
+var (
+	sharedCaches = make(map[string]*sharedCache)
+	cacheLock    = &sync.Mutex{}
+)
+
+// AcquireCache returns a view of the memory cache shared by the lookup nodes of all the rules looking up the table.
+// Each view has its own ttl and empty result policy, and the namespace of the options decides whether the cached
+// results are reusable by the other views. The memory options must be the same as the rules already sharing the cache.
+func AcquireCache(table string, opts *cache.Options) (*cache.Cache, error) {
+	cacheLock.Lock()
+	defer cacheLock.Unlock()
+	so := storeOptions(opts)
+	sc, ok := sharedCaches[table]
+	if ok {
+		if d := diffOptions(sc.opts, so); d != "" {
+			return nil, fmt.Errorf("shared cache of lookup table %s is already used with %s", table, d)
+		}
+		sc.count++
+	} else {
+		sc = &sharedCache{c: cache.NewCacheWithOptions(&so), opts: so, count: 1}
+		sharedCaches[table] = sc
+	}
+	return cache.NewView(sc.c, opts), nil
+}
+
+// storeOptions returns the options of the shared memory of the cache
+func storeOptions(opts *cache.Options) cache.Options {
+	return cache.Options{
+		HashKeys:             opts.HashKeys,
+		MaxItems:             opts.MaxItems,
+		MaxBytes:             opts.MaxBytes,
+		Sliding:              opts.Sliding,
+		StaleWhileRevalidate: opts.StaleWhileRevalidate,
+		MaxStale:             opts.MaxStale,
+		Compression:          opts.Compression,
+		CompressMinBytes:     opts.CompressMinBytes,
+		RetainStale:          opts.RetainStale,
+	}
+}
+
+// diffOptions describes the memory options which are different, empty if they are the same
+func diffOptions(a, b cache.Options) string {
+	var d []string
+	diff := func(name string, x, y interface{}) {
+		if x != y {
+			d = append(d, fmt.Sprintf("%s %v, conflicts with %v", name, x, y))
+		}
+	}
+	diff("hashKeys", a.HashKeys, b.HashKeys)
+	diff("maxItems", a.MaxItems, b.MaxItems)
+	diff("maxBytes", a.MaxBytes, b.MaxBytes)
+	diff("sliding", a.Sliding, b.Sliding)
+	diff("staleWhileRevalidate", a.StaleWhileRevalidate, b.StaleWhileRevalidate)
+	diff("maxStale", a.MaxStale, b.MaxStale)
+	diff("compression", a.Compression, b.Compression)
+	diff("compressMinBytes", a.CompressMinBytes, b.CompressMinBytes)
+	diff("retainStale", a.RetainStale, b.RetainStale)
+	return strings.Join(d, "; ")
+}
+
+// ReleaseCache is called when the lookup node stops. The cache is closed when no one uses it.
+func ReleaseCache(table string) {
+	cacheLock.Lock()
+	defer cacheLock.Unlock()
+	if sc, ok := sharedCaches[table]; ok {
+		sc.count--
+		if sc.count <= 0 {
+			sc.c.Close()
+			delete(sharedCaches, table)
+		}
+	}
+}
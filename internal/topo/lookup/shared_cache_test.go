@@ -0,0 +1,60 @@
+// Copyright 2023 EMQ Technologies Co., Ltd.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package lookup
+
+import (
+	"testing"
+	"time"
+
+	"github.com/lf-edge/ekuiper/internal/topo/lookup/cache"
+	"github.com/lf-edge/ekuiper/pkg/api"
+)
+
+func TestSharedCache(t *testing.T) {
+	v := []api.SourceTuple{api.NewDefaultSourceTuple(map[string]interface{}{"a": 1}, nil)}
+	c1, err := AcquireCache("table1", &cache.Options{TTL: time.Second, MaxItems: 10, Namespace: "k"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the rules of the same table share the cache with different ttl
+	c2, err := AcquireCache("table1", &cache.Options{TTL: time.Minute, MaxItems: 10, Namespace: "k"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	c1.Set("a", v)
+	if _, ok := c2.Get("a"); !ok {
+		t.Error("expect the result cached by the other rule")
+	}
+	_, err = AcquireCache("table1", &cache.Options{MaxItems: 20, Sliding: true})
+	if err == nil || err.Error() != "shared cache of lookup table table1 is already used with maxItems 10, conflicts with 20; sliding false, conflicts with true" {
+		t.Errorf("expect the conflicting options rejected but got %v", err)
+	}
+	ReleaseCache("table1")
+	if _, ok := c2.Get("a"); !ok {
+		t.Error("expect the cache kept for the other rule")
+	}
+	ReleaseCache("table1")
+	if _, ok := c2.Get("a"); ok {
+		t.Error("expect the cache closed after all the rules release it")
+	}
+	c3, err := AcquireCache("table1", &cache.Options{MaxItems: 20})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := c3.Get("a"); ok {
+		t.Error("expect a new cache after released")
+	}
+	ReleaseCache("table1")
+}
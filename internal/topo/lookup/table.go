@@ -51,15 +51,24 @@ func Attach(name string) (api.LookupSource, error) {
 	return nil, fmt.Errorf("lookup table %s is not found", name)
 }
 
-// Detach called by lookup nodes when it is closed
+// Detach called by lookup nodes when it is closed or idle. If no lookup node is attached, the idle resources of the
+// lookup source are released if supported
 func Detach(name string) error {
 	lock.Lock()
-	defer lock.Unlock()
-	if i, ok := instances[name]; ok {
-		atomic.AddInt32(&i.count, -1)
-		return nil
+	i, ok := instances[name]
+	if !ok {
+		lock.Unlock()
+		return fmt.Errorf("lookup table %s is not found", name)
 	}
-	return fmt.Errorf("lookup table %s is not found", name)
+	count := atomic.AddInt32(&i.count, -1)
+	lock.Unlock()
+	if r, ok := i.ls.(api.LookupIdleReleaser); ok && count == 0 {
+		ctx := kctx.WithValue(kctx.Background(), kctx.LoggerKey, conf.Log.WithField("table", name))
+		if err := r.ReleaseIdle(ctx); err != nil {
+			ctx.GetLogger().Warnf("release the idle resources of lookup table %s error: %v", name, err)
+		}
+	}
+	return nil
 }
 
 // CreateInstance called when create a lookup table
@@ -0,0 +1,84 @@
+// Copyright 2023 EMQ Technologies Co., Ltd.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package node
+
+import "sync"
+
+// maxBypassWindows is the max bypass period in windows
+const maxBypassWindows = 64
+
+var (
+	// cacheAdaptiveWindow is the count of lookups to measure the cache hit ratio in adaptive cache mode
+	cacheAdaptiveWindow = 1000
+	// cacheMinHitRatio is the hit ratio below which the cache is bypassed in adaptive cache mode
+	cacheMinHitRatio = 0.05
+)
+
+// cacheBypass detects the near zero cache hit ratio such as unique keys per event, and stops caching for a while.
+// The hit ratio is measured over a window of lookups. If it is below the threshold, the next lookups bypass the cache.
+// After that, the caching resumes to probe whether the pattern changes. The bypass period doubles every time the probe
+// still gets a low ratio. It is safe to be used concurrently by the async lookups.
+type cacheBypass struct {
+	sync.Mutex
+	window   int
+	minRatio float64
+	// the counts in the current window
+	lookups int
+	hits    int
+	// the remaining lookups to bypass and the current bypass period in windows
+	remaining int
+	backoff   int
+}
+
+func newCacheBypass(window int, minRatio float64) *cacheBypass {
+	return &cacheBypass{window: window, minRatio: minRatio}
+}
+
+// Bypass returns whether the current lookup should bypass the cache
+func (b *cacheBypass) Bypass() bool {
+	b.Lock()
+	defer b.Unlock()
+	if b.remaining > 0 {
+		b.remaining--
+		return true
+	}
+	return false
+}
+
+// Observe records whether the cache is hit for a lookup not bypassed. It returns true if the bypass starts
+func (b *cacheBypass) Observe(hit bool) bool {
+	b.Lock()
+	defer b.Unlock()
+	b.lookups++
+	if hit {
+		b.hits++
+	}
+	if b.lookups < b.window {
+		return false
+	}
+	ratio := float64(b.hits) / float64(b.lookups)
+	b.lookups, b.hits = 0, 0
+	if ratio >= b.minRatio {
+		b.backoff = 0
+		return false
+	}
+	if b.backoff == 0 {
+		b.backoff = 1
+	} else if b.backoff < maxBypassWindows {
+		b.backoff *= 2
+	}
+	b.remaining = b.backoff * b.window
+	return true
+}
@@ -0,0 +1,67 @@
+// Copyright 2023 EMQ Technologies Co., Ltd.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package node
+
+import (
+	"testing"
+)
+
+func TestCacheBypass(t *testing.T) {
+	b := newCacheBypass(4, 0.5)
+	observe := func(hits ...bool) bool {
+		started := false
+		for _, h := range hits {
+			if b.Bypass() {
+				t.Fatal("expect not bypassed when observing")
+			}
+			started = b.Observe(h)
+		}
+		return started
+	}
+	countBypass := func() int {
+		r := 0
+		for b.Bypass() {
+			r++
+		}
+		return r
+	}
+	if observe(true, false, true, false) {
+		t.Error("expect no bypass for hit ratio 0.5")
+	}
+	if !observe(false, false, true, false) {
+		t.Error("expect bypass for hit ratio 0.25")
+	}
+	if c := countBypass(); c != 4 {
+		t.Errorf("expect bypass 1 window but got %d", c)
+	}
+	observe(false, false, false, false)
+	if c := countBypass(); c != 8 {
+		t.Errorf("expect bypass 2 windows but got %d", c)
+	}
+	// the pattern changes, reset the backoff
+	observe(true, true, true, false)
+	observe(false, false, false, false)
+	if c := countBypass(); c != 4 {
+		t.Errorf("expect bypass 1 window after reset but got %d", c)
+	}
+	for i := 0; i < 10; i++ {
+		observe(false, false, false, false)
+		countBypass()
+	}
+	observe(false, false, false, false)
+	if c := countBypass(); c != maxBypassWindows*4 {
+		t.Errorf("expect bypass max windows but got %d", c)
+	}
+}
@@ -0,0 +1,133 @@
+// Copyright 2023 EMQ Technologies Co., Ltd.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package node
+
+import (
+	"fmt"
+
+	"github.com/lf-edge/ekuiper/internal/conf"
+	"github.com/lf-edge/ekuiper/internal/topo/node/metric"
+	"github.com/lf-edge/ekuiper/internal/xsql"
+	"github.com/lf-edge/ekuiper/pkg/api"
+	"github.com/lf-edge/ekuiper/pkg/infra"
+)
+
+// CTENode converts the results of a common table expression query to the tuples of the CTE name, so that the
+// following query can read them like a stream. A window result is split into one tuple per row.
+type CTENode struct {
+	*defaultSinkNode
+	statManager metric.StatManager
+	emitter     string
+}
+
+func NewCTENode(name string, emitter string, options *api.RuleOption) *CTENode {
+	n := &CTENode{emitter: emitter}
+	n.defaultSinkNode = &defaultSinkNode{
+		input: make(chan interface{}, options.BufferLength),
+		defaultNode: &defaultNode{
+			outputs:   make(map[string]chan<- interface{}),
+			name:      name,
+			sendError: options.SendError,
+		},
+	}
+	return n
+}
+
+func (n *CTENode) Exec(ctx api.StreamContext, errCh chan<- error) {
+	n.ctx = ctx
+	log := ctx.GetLogger()
+	log.Debugf("CTENode %s is started", n.name)
+
+	if len(n.outputs) <= 0 {
+		infra.DrainError(ctx, fmt.Errorf("no output channel found"), errCh)
+		return
+	}
+	stats, err := metric.NewStatManager(ctx, "op")
+	if err != nil {
+		infra.DrainError(ctx, fmt.Errorf("fail to create stat manager"), errCh)
+		return
+	}
+	n.statManager = stats
+	n.statManagers = []metric.StatManager{stats}
+	go func() {
+		err := infra.SafeRun(func() error {
+			for {
+				log.Debugf("CTENode %s is looping", n.name)
+				select {
+				case item, opened := <-n.input:
+					processed := false
+					if item, processed = n.preprocess(item); processed {
+						break
+					}
+					n.statManager.IncTotalRecordsIn()
+					n.statManager.ProcessTimeStart()
+					if !opened {
+						n.statManager.IncTotalExceptions("input channel closed")
+						break
+					}
+					switch d := item.(type) {
+					case error:
+						_ = n.Broadcast(d)
+						n.statManager.IncTotalExceptions(d.Error())
+					case *xsql.WatermarkTuple:
+						// the following query generates its own watermark by the tuple timestamps
+					default:
+						rows, err := n.convert(d)
+						if err != nil {
+							_ = n.Broadcast(err)
+							n.statManager.IncTotalExceptions(err.Error())
+							break
+						}
+						for _, r := range rows {
+							_ = n.Broadcast(r)
+							n.statManager.IncTotalRecordsOut()
+						}
+					}
+					n.statManager.ProcessTimeEnd()
+					n.statManager.SetBufferLength(int64(len(n.input)))
+				case <-ctx.Done():
+					log.Infoln("Cancelling cte node....")
+					return nil
+				}
+			}
+		})
+		if err != nil {
+			infra.DrainError(ctx, err, errCh)
+		}
+	}()
+}
+
+// convert the result of the CTE query to tuples of the CTE. The rows of a window are timed at the window end
+func (n *CTENode) convert(data interface{}) ([]*xsql.Tuple, error) {
+	switch d := data.(type) {
+	case *xsql.Tuple:
+		return []*xsql.Tuple{{Emitter: n.emitter, Message: d.ToMap(), Metadata: d.Metadata, Timestamp: d.Timestamp}}, nil
+	case xsql.Collection:
+		ts := conf.GetNowInMilli()
+		if r := d.GetWindowRange(); r != nil {
+			if end, ok := r.FuncValue("window_end"); ok {
+				ts = end.(int64)
+			}
+		}
+		maps := d.ToMaps()
+		result := make([]*xsql.Tuple, 0, len(maps))
+		for _, m := range maps {
+			result = append(result, &xsql.Tuple{Emitter: n.emitter, Message: m, Timestamp: ts})
+		}
+		return result, nil
+	default:
+		return nil, fmt.Errorf("run CTENode error: invalid input type but got %[1]T(%[1]v)", d)
+	}
+}
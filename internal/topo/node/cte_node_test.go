@@ -0,0 +1,46 @@
+// Copyright 2023 EMQ Technologies Co., Ltd.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package node
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/lf-edge/ekuiper/internal/xsql"
+	"github.com/lf-edge/ekuiper/pkg/api"
+)
+
+func TestCTEConvert(t *testing.T) {
+	n := NewCTENode("test", "hot", &api.RuleOption{BufferLength: 10})
+	r, err := n.convert(&xsql.Tuple{Emitter: "demo", Message: xsql.Message{"temp": 32}, Metadata: xsql.Metadata{"topic": "t1"}, Timestamp: 10})
+	require.NoError(t, err)
+	require.Equal(t, []*xsql.Tuple{{Emitter: "hot", Message: xsql.Message{"temp": 32}, Metadata: xsql.Metadata{"topic": "t1"}, Timestamp: 10}}, r)
+	// each row of the window is a tuple at the window end
+	r, err = n.convert(&xsql.WindowTuples{
+		Content: []xsql.TupleRow{
+			&xsql.Tuple{Emitter: "demo", Message: xsql.Message{"temp": 32}, Timestamp: 10},
+			&xsql.Tuple{Emitter: "demo", Message: xsql.Message{"temp": 35}, Timestamp: 20},
+		},
+		WindowRange: xsql.NewWindowRange(0, 100),
+	})
+	require.NoError(t, err)
+	require.Equal(t, []*xsql.Tuple{
+		{Emitter: "hot", Message: xsql.Message{"temp": 32}, Timestamp: 100},
+		{Emitter: "hot", Message: xsql.Message{"temp": 35}, Timestamp: 100},
+	}, r)
+	_, err = n.convert("invalid")
+	require.EqualError(t, err, "run CTENode error: invalid input type but got string(invalid)")
+}
@@ -46,6 +46,8 @@ func NewEventTimeTrigger(window *WindowConfig) (*EventTimeTrigger, error) {
 	case ast.SESSION_WINDOW:
 		// Use timeout to update watermark
 		w.interval = window.Interval
+	case ast.COUNT_OR_TIME_WINDOW:
+		// Run by its own loop which does not need the trigger
 	default:
 		return nil, fmt.Errorf("unsupported window type %d", window.Type)
 	}
@@ -115,6 +117,15 @@ func (o *WindowOperator) execEventWindow(ctx api.StreamContext, inputs []*xsql.T
 		prevWindowEndTs int64
 		lastTicked      bool
 	)
+	if o.allowedLateness > 0 {
+		if s, err := ctx.GetState(WindowHistoryKey); err == nil && s != nil {
+			if st, ok := s.([]*xsql.Tuple); ok {
+				o.history = st
+			} else {
+				log.Warnf("restore window state `history` %v error, invalid type", s)
+			}
+		}
+	}
 	for {
 		select {
 		// process incoming item
@@ -143,6 +154,7 @@ func (o *WindowOperator) execEventWindow(ctx api.StreamContext, inputs []*xsql.T
 
 				windowEndTs := nextWindowEndTs
 				ticked := false
+				fired := false
 				// Session window needs a recalculation of window because its window end depends on the inputs
 				if windowEndTs == math.MaxInt64 || o.window.Type == ast.SESSION_WINDOW || o.window.Type == ast.SLIDING_WINDOW {
 					if o.window.Type == ast.SESSION_WINDOW {
@@ -168,10 +180,11 @@ func (o *WindowOperator) execEventWindow(ctx api.StreamContext, inputs []*xsql.T
 								o.triggerTS = o.triggerTS[1:]
 							}
 						} else {
-							inputs = o.scan(inputs, windowEndTs, ctx)
+							inputs = o.scanWithHistory(inputs, windowEndTs, ctx)
 						}
 					}
 					prevWindowEndTs = windowEndTs
+					fired = true
 					lastTicked = ticked
 					if o.window.Type == ast.SESSION_WINDOW {
 						windowEndTs, ticked = o.trigger.getNextSessionWindow(inputs, watermarkTs)
@@ -182,6 +195,11 @@ func (o *WindowOperator) execEventWindow(ctx api.StreamContext, inputs []*xsql.T
 				}
 				nextWindowEndTs = windowEndTs
 				log.Debugf("next window end %d", nextWindowEndTs)
+				if o.allowedLateness > 0 {
+					if o.expireHistory(watermarkTs) || fired {
+						_ = ctx.PutState(WindowHistoryKey, o.history)
+					}
+				}
 			case *xsql.Tuple:
 				ctx.GetLogger().Debug("Tuple", d.GetTimestamp())
 				o.statManager.ProcessTimeStart()
@@ -191,6 +209,21 @@ func (o *WindowOperator) execEventWindow(ctx api.StreamContext, inputs []*xsql.T
 				if o.triggerTime == 0 {
 					o.triggerTime = d.Timestamp
 				}
+				// the late tuple within the allowed lateness, whose windows have fired
+				if o.allowedLateness > 0 && d.Timestamp < prevWindowEndTs {
+					// with hopping windows, the late tuple may also be in the windows to fire, whose start is after the
+					// start of the next window
+					if d.Timestamp >= prevWindowEndTs+o.trigger.interval-o.window.Length {
+						inputs = append(inputs, d)
+						_ = ctx.PutState(WindowInputsKey, inputs)
+					} else {
+						o.history = append(o.history, d)
+						_ = ctx.PutState(WindowHistoryKey, o.history)
+					}
+					o.refire(ctx, d, prevWindowEndTs, inputs)
+					o.statManager.ProcessTimeEnd()
+					break
+				}
 				if o.window.Type == ast.SLIDING_WINDOW && o.isMatchCondition(ctx, d) {
 					o.triggerTS = append(o.triggerTS, d.GetTimestamp())
 				}
@@ -213,6 +246,71 @@ func (o *WindowOperator) execEventWindow(ctx api.StreamContext, inputs []*xsql.T
 	}
 }
 
+// scanWithHistory scans the inputs for the window like scan, and moves the tuples which leave the inputs to the history
+// so that they are still in the windows to re-fire. The history and the inputs never share a tuple
+func (o *WindowOperator) scanWithHistory(inputs []*xsql.Tuple, triggerTime int64, ctx api.StreamContext) []*xsql.Tuple {
+	if o.allowedLateness <= 0 {
+		return o.scan(inputs, triggerTime, ctx)
+	}
+	before := make([]*xsql.Tuple, len(inputs))
+	copy(before, inputs)
+	inputs = o.scan(inputs, triggerTime, ctx)
+	// scan keeps the order of the rest tuples
+	j := 0
+	for _, t := range before {
+		if j < len(inputs) && inputs[j] == t {
+			j++
+		} else {
+			o.history = append(o.history, t)
+		}
+	}
+	return inputs
+}
+
+// refire emits the updated results of the fired windows which the late tuple belongs to. Only tumbling and hopping
+// windows are supported whose window ends are aligned by the interval back from the last window end. The windows are
+// composed of the history and the inputs which are not fired out yet
+func (o *WindowOperator) refire(ctx api.StreamContext, tuple *xsql.Tuple, lastWindowEndTs int64, inputs []*xsql.Tuple) {
+	for end := lastWindowEndTs; end > tuple.Timestamp; end -= o.trigger.interval {
+		start := end - o.window.Length
+		if tuple.Timestamp < start {
+			continue
+		}
+		results := &xsql.WindowTuples{
+			Content: make([]xsql.TupleRow, 0),
+		}
+		for _, tuples := range [][]*xsql.Tuple{o.history, inputs} {
+			for _, t := range tuples {
+				if t.Timestamp >= start && t.Timestamp < end {
+					results = results.AddTuple(t)
+				}
+			}
+		}
+		results.WindowRange = xsql.NewWindowRange(start, end)
+		ctx.GetLogger().Debugf("window %s re-fired at %d for the late tuple at %d", o.name, end, tuple.Timestamp)
+		_ = o.Broadcast(results)
+		o.statManager.IncTotalRecordsOut()
+	}
+}
+
+// expireHistory removes the tuples which cannot be in any window to re-fire. The late tuples must not be earlier than
+// the watermark minus the allowed lateness, so do their windows. It returns whether any tuple is removed
+func (o *WindowOperator) expireHistory(watermarkTs int64) bool {
+	expire := watermarkTs - o.allowedLateness - o.window.Length
+	i := 0
+	for _, t := range o.history {
+		if t.Timestamp >= expire {
+			o.history[i] = t
+			i++
+		}
+	}
+	if i < len(o.history) {
+		o.history = o.history[:i]
+		return true
+	}
+	return false
+}
+
 func getEarliestEventTs(inputs []*xsql.Tuple, startTs int64, endTs int64) int64 {
 	var minTs int64 = math.MaxInt64
 	for _, t := range inputs {
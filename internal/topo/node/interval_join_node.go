@@ -0,0 +1,359 @@
+// Copyright 2021-2023 EMQ Technologies Co., Ltd.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package node
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/lf-edge/ekuiper/internal/conf"
+	"github.com/lf-edge/ekuiper/internal/topo/node/metric"
+	"github.com/lf-edge/ekuiper/internal/xsql"
+	"github.com/lf-edge/ekuiper/pkg/api"
+	"github.com/lf-edge/ekuiper/pkg/ast"
+	"github.com/lf-edge/ekuiper/pkg/cast"
+	"github.com/lf-edge/ekuiper/pkg/infra"
+)
+
+const IntervalJoinKey = "$$intervalJoinInputs"
+
+// IntervalJoinConf is the extracted join condition of the interval join. A left row and a right row are joined if
+// their keys are equal, the left time minus the right time is within [Lower, Upper] and the Condition is true.
+type IntervalJoinConf struct {
+	Left      string
+	Right     string
+	LeftKeys  []ast.Expr
+	RightKeys []ast.Expr
+	LeftTime  ast.Expr
+	RightTime ast.Expr
+	Lower     int64
+	Upper     int64
+	// Condition is the rest of the join condition, nil if none
+	Condition ast.Expr
+}
+
+type intervalRow struct {
+	ts    int64
+	tuple *xsql.Tuple
+	// expired is set when the row is dropped from the buffer, so that it is removed from the state lazily
+	expired bool
+}
+
+// intervalBuffer buffers the rows of one stream by the join key in the arrival order
+type intervalBuffer struct {
+	rows map[string][]*intervalRow
+	// max is the max time of the received rows
+	max int64
+	// maxAt is the processing time when the max is received
+	maxAt int64
+}
+
+// IntervalJoinNode joins the rows of two streams without window. Each row is joined with the buffered rows of the
+// other stream immediately, and buffered until no later row of the other stream can join it. The rows of each stream
+// are supposed to arrive in the time order, the rows later than the bound are dropped from the buffer. The buffers are
+// also expired by the watermark in event time, or by the estimated progress of the streams on a timer in processing
+// time, so a quiet stream does not keep the rows of the other stream forever.
+type IntervalJoinNode struct {
+	*defaultSinkNode
+	statManager metric.StatManager
+	conf        *IntervalJoinConf
+	isEventTime bool
+	// states
+	left  *intervalBuffer
+	right *intervalBuffer
+	// rows are the buffered rows of both streams in the arrival order, and tuples are their tuples to save in the state.
+	// The expired rows are removed when they are the majority
+	rows    []*intervalRow
+	tuples  []*xsql.Tuple
+	expired int
+}
+
+func NewIntervalJoinNode(name string, conf *IntervalJoinConf, options *api.RuleOption) *IntervalJoinNode {
+	n := &IntervalJoinNode{
+		conf:        conf,
+		isEventTime: options.IsEventTime,
+		left:        &intervalBuffer{rows: make(map[string][]*intervalRow)},
+		right:       &intervalBuffer{rows: make(map[string][]*intervalRow)},
+	}
+	n.defaultSinkNode = &defaultSinkNode{
+		input: make(chan interface{}, options.BufferLength),
+		defaultNode: &defaultNode{
+			outputs:   make(map[string]chan<- interface{}),
+			name:      name,
+			sendError: options.SendError,
+		},
+	}
+	return n
+}
+
+func (n *IntervalJoinNode) Exec(ctx api.StreamContext, errCh chan<- error) {
+	n.ctx = ctx
+	log := ctx.GetLogger()
+	log.Debugf("IntervalJoinNode %s is started", n.name)
+
+	if len(n.outputs) <= 0 {
+		infra.DrainError(ctx, fmt.Errorf("no output channel found"), errCh)
+		return
+	}
+	stats, err := metric.NewStatManager(ctx, "op")
+	if err != nil {
+		infra.DrainError(ctx, fmt.Errorf("fail to create stat manager"), errCh)
+		return
+	}
+	n.statManager = stats
+	n.statManagers = []metric.StatManager{stats}
+	go func() {
+		err := infra.SafeRun(func() error {
+			fv, _ := xsql.NewFunctionValuersForOp(ctx)
+			var expireTick <-chan time.Time
+			if !n.isEventTime {
+				ticker := conf.GetTicker(n.expireInterval())
+				defer ticker.Stop()
+				expireTick = ticker.C
+			}
+			// restore the buffered rows
+			if s, err := ctx.GetState(IntervalJoinKey); err == nil {
+				switch st := s.(type) {
+				case []*xsql.Tuple:
+					for _, t := range st {
+						if _, err := n.join(t, fv); err != nil {
+							log.Warnf("Restore interval join row %s error: %v", t.Message, err)
+						}
+					}
+					log.Infof("Restore interval join state with %d rows", len(st))
+				case nil:
+					log.Debugf("Restore interval join state, nothing")
+				default:
+					infra.DrainError(ctx, fmt.Errorf("restore interval join state %v error, invalid type", st), errCh)
+				}
+			} else {
+				log.Warnf("Restore interval join state fails: %s", err)
+			}
+
+			for {
+				log.Debugf("IntervalJoinNode %s is looping", n.name)
+				select {
+				case item, opened := <-n.input:
+					// save the buffered rows only when the barrier triggers the checkpoint
+					if isBarrier(item) {
+						n.saveState(ctx)
+					}
+					processed := false
+					if item, processed = n.preprocess(item); processed {
+						break
+					}
+					n.statManager.IncTotalRecordsIn()
+					n.statManager.ProcessTimeStart()
+					if !opened {
+						n.statManager.IncTotalExceptions("input channel closed")
+						break
+					}
+					switch d := item.(type) {
+					case error:
+						_ = n.Broadcast(d)
+						n.statManager.IncTotalExceptions(d.Error())
+					case *xsql.WatermarkTuple:
+						// the later rows of both streams are not before the watermark
+						if n.isEventTime {
+							n.expireBy(d.GetTimestamp(), d.GetTimestamp())
+						}
+						_ = n.Broadcast(d)
+					case *xsql.Tuple:
+						log.Debugf("IntervalJoinNode receive tuple input %s", d)
+						sets, err := n.join(d, fv)
+						if err != nil {
+							_ = n.Broadcast(err)
+							n.statManager.IncTotalExceptions(err.Error())
+							break
+						}
+						if len(sets.Content) > 0 {
+							_ = n.Broadcast(sets)
+							n.statManager.IncTotalRecordsOut()
+						}
+					default:
+						e := fmt.Errorf("run IntervalJoinNode error: invalid input type but got %[1]T(%[1]v)", d)
+						_ = n.Broadcast(e)
+						n.statManager.IncTotalExceptions(e.Error())
+					}
+					n.statManager.ProcessTimeEnd()
+					n.statManager.SetBufferLength(int64(len(n.input)))
+				case <-expireTick:
+					now := conf.GetNowInMilli()
+					n.expireBy(n.left.progress(now), n.right.progress(now))
+				case <-ctx.Done():
+					log.Infoln("Cancelling interval join node....")
+					return nil
+				}
+			}
+		})
+		if err != nil {
+			infra.DrainError(ctx, err, errCh)
+		}
+	}()
+}
+
+// join joins the tuple with the buffered rows of the other stream, and then buffers it
+func (n *IntervalJoinNode) join(t *xsql.Tuple, fv *xsql.FunctionValuer) (*xsql.JoinTuples, error) {
+	isLeft := t.Emitter == n.conf.Left
+	if !isLeft && t.Emitter != n.conf.Right {
+		return nil, fmt.Errorf("run IntervalJoinNode error: receive tuple from unknown emitter %s", t.Emitter)
+	}
+	keys, timeExpr, self, other := n.conf.LeftKeys, n.conf.LeftTime, n.left, n.right
+	if !isLeft {
+		keys, timeExpr, self, other = n.conf.RightKeys, n.conf.RightTime, n.right, n.left
+	}
+	ve := &xsql.ValuerEval{Valuer: xsql.MultiValuer(t, fv)}
+	key, ok, err := joinKey(ve, keys)
+	if err != nil {
+		return nil, err
+	}
+	ts, err := cast.InterfaceToUnixMilli(ve.Eval(timeExpr), "")
+	if err != nil {
+		return nil, fmt.Errorf("evaluate join time %s error: %v", timeExpr, err)
+	}
+	sets := &xsql.JoinTuples{Content: make([]*xsql.JoinTuple, 0)}
+	// a nil key does not equal any key like NULL in SQL, so the row is neither joined nor buffered
+	if ok {
+		for _, r := range other.rows[key] {
+			l, lt, rt := t, ts, r.ts
+			rr := r.tuple
+			if !isLeft {
+				l, lt, rt, rr = r.tuple, r.ts, ts, t
+			}
+			if d := lt - rt; d < n.conf.Lower || d > n.conf.Upper {
+				continue
+			}
+			merged := &xsql.JoinTuple{}
+			merged.AddTuple(l)
+			merged.AddTuple(rr)
+			if n.conf.Condition != nil {
+				jve := &xsql.ValuerEval{Valuer: xsql.MultiValuer(merged, fv)}
+				switch val := jve.Eval(n.conf.Condition).(type) {
+				case error:
+					return nil, val
+				case bool:
+					if !val {
+						continue
+					}
+				default:
+					return nil, fmt.Errorf("invalid join condition that returns non-bool value %[1]T(%[1]v)", val)
+				}
+			}
+			sets.Content = append(sets.Content, merged)
+		}
+		r := &intervalRow{ts: ts, tuple: t}
+		self.rows[key] = append(self.rows[key], r)
+		n.rows = append(n.rows, r)
+		n.tuples = append(n.tuples, t)
+	}
+	if ts > self.max {
+		self.max, self.maxAt = ts, conf.GetNowInMilli()
+		// the later rows of this stream cannot join the rows of the other stream before the bound
+		if isLeft {
+			n.expired += other.expire(ts - n.conf.Upper)
+		} else {
+			n.expired += other.expire(ts + n.conf.Lower)
+		}
+		n.compact()
+	}
+	return sets, nil
+}
+
+// saveState saves a copy of the buffered rows, because the rows are compacted in place while the state is being saved
+func (n *IntervalJoinNode) saveState(ctx api.StreamContext) {
+	_ = ctx.PutState(IntervalJoinKey, append([]*xsql.Tuple(nil), n.tuples...))
+}
+
+// expireBy drops the rows which cannot join the later rows of the streams, whose times are not before leftTs and
+// rightTs respectively. It returns whether any row is dropped
+func (n *IntervalJoinNode) expireBy(leftTs, rightTs int64) bool {
+	c := n.right.expire(leftTs-n.conf.Upper) + n.left.expire(rightTs+n.conf.Lower)
+	n.expired += c
+	n.compact()
+	return c > 0
+}
+
+// compact removes the expired rows from the rows to save once they are the majority, so that the cost is amortized
+func (n *IntervalJoinNode) compact() {
+	if n.expired == 0 || n.expired*2 < len(n.rows) {
+		return
+	}
+	i := 0
+	for _, r := range n.rows {
+		if !r.expired {
+			n.rows[i] = r
+			n.tuples[i] = r.tuple
+			i++
+		}
+	}
+	for j := i; j < len(n.rows); j++ {
+		n.rows[j], n.tuples[j] = nil, nil
+	}
+	n.rows, n.tuples, n.expired = n.rows[:i], n.tuples[:i], 0
+}
+
+// expireInterval is the interval in milliseconds to expire the rows in processing time, which is the span of the time
+// bound but at least one second
+func (n *IntervalJoinNode) expireInterval() int64 {
+	if d := n.conf.Upper - n.conf.Lower; d > 1000 {
+		return d
+	}
+	return 1000
+}
+
+// progress estimates the time of the stream in processing time. A quiet stream is supposed to progress with the wall
+// clock since its latest row, and a stream without any row is at the wall clock
+func (b *intervalBuffer) progress(now int64) int64 {
+	return b.max + now - b.maxAt
+}
+
+// expire drops the rows before the time and returns the count of the dropped rows
+func (b *intervalBuffer) expire(before int64) int {
+	c := 0
+	for k, rows := range b.rows {
+		i := 0
+		for i < len(rows) && rows[i].ts < before {
+			rows[i].expired = true
+			i++
+		}
+		c += i
+		if i == len(rows) {
+			delete(b.rows, k)
+		} else if i > 0 {
+			b.rows[k] = rows[i:]
+		}
+	}
+	return c
+}
+
+// joinKey evaluates the join keys of the row to a string. It returns false if any key is nil
+func joinKey(ve *xsql.ValuerEval, keys []ast.Expr) (string, bool, error) {
+	var b strings.Builder
+	for i, e := range keys {
+		v := ve.Eval(e)
+		if err, ok := v.(error); ok {
+			return "", false, fmt.Errorf("evaluate join key %s error: %v", e, err)
+		}
+		if v == nil {
+			return "", false, nil
+		}
+		if i > 0 {
+			b.WriteByte(',')
+		}
+		b.WriteString(fmt.Sprintf("%v", v))
+	}
+	return b.String(), true, nil
+}
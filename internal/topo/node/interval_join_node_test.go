@@ -0,0 +1,94 @@
+// Copyright 2021-2023 EMQ Technologies Co., Ltd.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package node
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/lf-edge/ekuiper/internal/conf"
+	"github.com/lf-edge/ekuiper/internal/topo/context"
+	"github.com/lf-edge/ekuiper/internal/topo/state"
+	"github.com/lf-edge/ekuiper/internal/xsql"
+	"github.com/lf-edge/ekuiper/pkg/api"
+	"github.com/lf-edge/ekuiper/pkg/ast"
+)
+
+func TestIntervalJoin(t *testing.T) {
+	ref := func(s, n string) *ast.FieldRef {
+		return &ast.FieldRef{StreamName: ast.StreamName(s), Name: n}
+	}
+	n := NewIntervalJoinNode("test", &IntervalJoinConf{
+		Left: "s1", Right: "s2",
+		LeftKeys: []ast.Expr{ref("s1", "id")}, RightKeys: []ast.Expr{ref("s2", "id")},
+		LeftTime: ref("s1", "ts"), RightTime: ref("s2", "ts"),
+		Lower: -100, Upper: 50,
+	}, &api.RuleOption{BufferLength: 10})
+	fv, _ := xsql.NewFunctionValuersForOp(context.Background())
+	tuple := func(emitter string, id int, ts int64) *xsql.Tuple {
+		return &xsql.Tuple{Emitter: emitter, Message: xsql.Message{"id": id, "ts": ts}, Timestamp: ts}
+	}
+	join := func(tp *xsql.Tuple) []*xsql.JoinTuple {
+		sets, err := n.join(tp, fv)
+		require.NoError(t, err)
+		return sets.Content
+	}
+	require.Empty(t, join(tuple("s1", 1, 100)))
+	require.Empty(t, join(tuple("s1", 2, 110)))
+	// the left time minus the right time is within [-100, 50]
+	r := join(tuple("s2", 1, 120))
+	require.Len(t, r, 1)
+	require.Equal(t, []xsql.TupleRow{tuple("s1", 1, 100), tuple("s2", 1, 120)}, r[0].Tuples)
+	require.Empty(t, join(tuple("s2", 1, 210)))
+	require.Len(t, join(tuple("s1", 1, 170)), 2)
+	// the right rows before 270 - 50 are expired
+	require.Empty(t, join(tuple("s1", 1, 270)))
+	require.Len(t, n.right.rows["1"], 0)
+	// the expired rows are removed from the state once they are the majority
+	require.Equal(t, []*xsql.Tuple{tuple("s1", 2, 110), tuple("s1", 1, 170), tuple("s1", 1, 270)}, n.tuples)
+	_, err := n.join(tuple("s3", 1, 300), fv)
+	require.EqualError(t, err, "run IntervalJoinNode error: receive tuple from unknown emitter s3")
+
+	// the quiet right stream does not keep the left rows forever
+	require.True(t, n.expireBy(300, 300))
+	require.Len(t, n.left.rows["1"], 1)
+	require.Empty(t, n.left.rows["2"])
+	require.Equal(t, []*xsql.Tuple{tuple("s1", 1, 270)}, n.tuples)
+	require.False(t, n.expireBy(300, 300))
+
+	// in processing time, the quiet stream progresses with the wall clock since its latest row
+	now := conf.GetNowInMilli()
+	require.Equal(t, now, (&intervalBuffer{}).progress(now))
+	n.left.maxAt = now
+	require.Equal(t, int64(770), n.left.progress(now+500))
+
+	// the rows without a key neither join nor get buffered
+	noKey := func(emitter string, ts int64) *xsql.Tuple {
+		return &xsql.Tuple{Emitter: emitter, Message: xsql.Message{"ts": ts}, Timestamp: ts}
+	}
+	require.Empty(t, join(noKey("s2", 300)))
+	require.Empty(t, join(noKey("s1", 300)))
+	require.Equal(t, []*xsql.Tuple{tuple("s1", 1, 270)}, n.tuples)
+
+	// the buffered rows are saved as a copy on the checkpoint
+	store, _ := state.CreateStore("intervalJoinRule", api.AtMostOnce)
+	ctx := context.Background().WithMeta("intervalJoinRule", "op1", store)
+	n.saveState(ctx)
+	n.tuples[0] = nil
+	s, err := ctx.GetState(IntervalJoinKey)
+	require.NoError(t, err)
+	require.Equal(t, []*xsql.Tuple{tuple("s1", 1, 270)}, s)
+}
@@ -15,32 +15,63 @@
 package node
 
 import (
+	"encoding/gob"
 	"fmt"
 
+	"github.com/lf-edge/ekuiper/internal/conf"
 	"github.com/lf-edge/ekuiper/internal/topo/node/metric"
 	"github.com/lf-edge/ekuiper/internal/xsql"
 	"github.com/lf-edge/ekuiper/pkg/api"
+	"github.com/lf-edge/ekuiper/pkg/ast"
+	"github.com/lf-edge/ekuiper/pkg/cast"
 	"github.com/lf-edge/ekuiper/pkg/infra"
 )
 
+func init() {
+	gob.Register(map[string][]*TableVersion{})
+}
+
+// TemporalTable is the table joined by the version valid at the time of the stream row
+type TemporalTable struct {
+	AsOf ast.Expr
+	// HistorySize is the max count of the versions to keep
+	HistorySize int
+}
+
+// TableVersion is the content of the table since the time
+type TableVersion struct {
+	Ts     int64
+	Tuples []*xsql.Tuple
+}
+
 // JoinAlignNode will block the stream and buffer all the table tuples. Once buffered, it will combine the later input with the buffer
 // The input for batch table MUST be *WindowTuples
 type JoinAlignNode struct {
 	*defaultSinkNode
 	statManager metric.StatManager
+	temporals   map[string]*TemporalTable
 	// states
 	batch map[string][]*xsql.Tuple
+	// history is the versions of the temporal tables in time order
+	history map[string][]*TableVersion
 }
 
-const BatchKey = "$$batchInputs"
+const (
+	BatchKey   = "$$batchInputs"
+	HistoryKey = "$$batchHistory"
+	// defaultHistorySize is the count of the versions to keep if the HISTORY_SIZE of the table is not set
+	defaultHistorySize = 10
+)
 
-func NewJoinAlignNode(name string, emitters []string, options *api.RuleOption) (*JoinAlignNode, error) {
+func NewJoinAlignNode(name string, emitters []string, temporals map[string]*TemporalTable, options *api.RuleOption) (*JoinAlignNode, error) {
 	batch := make(map[string][]*xsql.Tuple, len(emitters))
 	for _, e := range emitters {
 		batch[e] = nil
 	}
 	n := &JoinAlignNode{
-		batch: batch,
+		batch:     batch,
+		temporals: temporals,
+		history:   make(map[string][]*TableVersion),
 	}
 	n.defaultSinkNode = &defaultSinkNode{
 		input: make(chan interface{}, options.BufferLength),
@@ -88,6 +119,16 @@ func (n *JoinAlignNode) Exec(ctx api.StreamContext, errCh chan<- error) {
 			if n.batch == nil {
 				n.batch = make(map[string][]*xsql.Tuple)
 			}
+			if len(n.temporals) > 0 {
+				if s, err := ctx.GetState(HistoryKey); err == nil {
+					if st, ok := s.(map[string][]*TableVersion); ok {
+						n.history = st
+					}
+				} else {
+					log.Warnf("Restore batch history fails: %s", err)
+				}
+			}
+			fv, _ := xsql.NewFunctionValuersForOp(ctx)
 
 			for {
 				log.Debugf("JoinAlignNode %s is looping", n.name)
@@ -112,11 +153,11 @@ func (n *JoinAlignNode) Exec(ctx api.StreamContext, errCh chan<- error) {
 						_ = n.Broadcast(d)
 					case *xsql.Tuple:
 						log.Debugf("JoinAlignNode receive tuple input %s", d)
-						n.alignBatch(ctx, d)
+						n.alignBatch(ctx, d, fv)
 					case *xsql.WindowTuples:
 						if d.WindowRange != nil { // real window
 							log.Debugf("JoinAlignNode receive window input %s", d)
-							n.alignBatch(ctx, d)
+							n.alignBatch(ctx, d, fv)
 						} else { // table window
 							log.Debugf("JoinAlignNode receive batch source %s", d)
 							emitter := d.Content[0].GetEmitter()
@@ -130,6 +171,10 @@ func (n *JoinAlignNode) Exec(ctx api.StreamContext, errCh chan<- error) {
 							}
 							n.batch[emitter] = convertToTupleSlice(d.Content)
 							_ = ctx.PutState(BatchKey, n.batch)
+							if t, ok := n.temporals[emitter]; ok {
+								n.addVersion(emitter, n.batch[emitter], t.HistorySize)
+								_ = ctx.PutState(HistoryKey, n.history)
+							}
 						}
 					default:
 						e := fmt.Errorf("run JoinAlignNode error: invalid input type but got %[1]T(%[1]v)", d)
@@ -156,19 +201,71 @@ func convertToTupleSlice(content []xsql.TupleRow) []*xsql.Tuple {
 	return tuples
 }
 
-func (n *JoinAlignNode) alignBatch(_ api.StreamContext, input any) {
+// addVersion adds the new content of the table as a version since the latest time of its tuples
+func (n *JoinAlignNode) addVersion(emitter string, tuples []*xsql.Tuple, size int) {
+	v := &TableVersion{Tuples: tuples}
+	for _, t := range tuples {
+		if t.Timestamp > v.Ts {
+			v.Ts = t.Timestamp
+		}
+	}
+	if v.Ts == 0 {
+		v.Ts = conf.GetNowInMilli()
+	}
+	if size <= 0 {
+		size = defaultHistorySize
+	}
+	h := append(n.history[emitter], v)
+	if len(h) > size {
+		h = h[len(h)-size:]
+	}
+	n.history[emitter] = h
+}
+
+// versionAt returns the content of the table valid at the time, nil if the time is before all the kept versions
+func (n *JoinAlignNode) versionAt(emitter string, ts int64) []*xsql.Tuple {
+	h := n.history[emitter]
+	for i := len(h) - 1; i >= 0; i-- {
+		if h[i].Ts <= ts {
+			return h[i].Tuples
+		}
+	}
+	return nil
+}
+
+func (n *JoinAlignNode) alignBatch(_ api.StreamContext, input any, fv *xsql.FunctionValuer) {
 	n.statManager.ProcessTimeStart()
 	var w *xsql.WindowTuples
+	batch := n.batch
 	switch t := input.(type) {
 	case *xsql.Tuple:
 		w = &xsql.WindowTuples{
 			Content: make([]xsql.TupleRow, 0),
 		}
 		w.AddTuple(t)
+		if len(n.temporals) > 0 {
+			batch = make(map[string][]*xsql.Tuple, len(n.batch))
+			for emitter, contents := range n.batch {
+				tt, ok := n.temporals[emitter]
+				if !ok {
+					batch[emitter] = contents
+					continue
+				}
+				ve := &xsql.ValuerEval{Valuer: xsql.MultiValuer(t, fv)}
+				ts, err := cast.InterfaceToUnixMilli(ve.Eval(tt.AsOf), "")
+				if err != nil {
+					e := fmt.Errorf("run JoinAlignNode error: evaluate AS OF time %s error: %v", tt.AsOf, err)
+					_ = n.Broadcast(e)
+					n.statManager.IncTotalExceptions(e.Error())
+					return
+				}
+				batch[emitter] = n.versionAt(emitter, ts)
+			}
+		}
 	case *xsql.WindowTuples:
 		w = t
 	}
-	for _, contents := range n.batch {
+	for _, contents := range batch {
 		if contents != nil {
 			for _, v := range contents {
 				w = w.AddTuple(v)
@@ -0,0 +1,48 @@
+// Copyright 2021-2023 EMQ Technologies Co., Ltd.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package node
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/lf-edge/ekuiper/internal/xsql"
+	"github.com/lf-edge/ekuiper/pkg/api"
+	"github.com/lf-edge/ekuiper/pkg/ast"
+)
+
+func TestJoinAlignVersions(t *testing.T) {
+	n, err := NewJoinAlignNode("test", []string{"tbl"}, map[string]*TemporalTable{
+		"tbl": {AsOf: &ast.FieldRef{StreamName: "demo", Name: "ts"}, HistorySize: 2},
+	}, &api.RuleOption{BufferLength: 10})
+	require.NoError(t, err)
+	tuples := func(ts ...int64) []*xsql.Tuple {
+		r := make([]*xsql.Tuple, 0, len(ts))
+		for _, t := range ts {
+			r = append(r, &xsql.Tuple{Emitter: "tbl", Message: xsql.Message{"ts": t}, Timestamp: t})
+		}
+		return r
+	}
+	n.addVersion("tbl", tuples(100), 2)
+	n.addVersion("tbl", tuples(100, 200), 2)
+	require.Equal(t, tuples(100), n.versionAt("tbl", 150))
+	require.Equal(t, tuples(100, 200), n.versionAt("tbl", 200))
+	require.Nil(t, n.versionAt("tbl", 50))
+	// the oldest version is dropped
+	n.addVersion("tbl", tuples(200, 300), 2)
+	require.Nil(t, n.versionAt("tbl", 150))
+	require.Equal(t, tuples(200, 300), n.versionAt("tbl", 1000))
+}
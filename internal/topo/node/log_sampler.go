@@ -0,0 +1,82 @@
+// Copyright 2023 EMQ Technologies Co., Ltd.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package node
+
+import (
+	"fmt"
+	"sync"
+	"sync/atomic"
+
+	"github.com/lf-edge/ekuiper/internal/conf"
+)
+
+// logSampler decides whether to log the debug info of an event. It samples 1 in every n events and
+// at most perSecond events in a second. Zero means no limit. It can be changed when running.
+type logSampler struct {
+	every     int64
+	perSecond int64
+	count     int64
+
+	sync.Mutex
+	// the current second and the sampled count in it
+	second      int64
+	secondCount int64
+}
+
+func newLogSampler(every, perSecond int) (*logSampler, error) {
+	s := &logSampler{}
+	if err := s.Set(every, perSecond); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// Set changes the sampling rate
+func (s *logSampler) Set(every, perSecond int) error {
+	if every < 0 {
+		return fmt.Errorf("invalid debug sample every %d, must not be negative", every)
+	}
+	if perSecond < 0 {
+		return fmt.Errorf("invalid debug sample per second %d, must not be negative", perSecond)
+	}
+	atomic.StoreInt64(&s.every, int64(every))
+	atomic.StoreInt64(&s.perSecond, int64(perSecond))
+	return nil
+}
+
+// Sample returns whether the current event should be logged
+func (s *logSampler) Sample() bool {
+	every := atomic.LoadInt64(&s.every)
+	c := atomic.AddInt64(&s.count, 1)
+	if every > 1 && (c-1)%every != 0 {
+		return false
+	}
+	perSecond := atomic.LoadInt64(&s.perSecond)
+	if perSecond <= 0 {
+		return true
+	}
+	sec := conf.GetNowInMilli() / 1000
+	s.Lock()
+	defer s.Unlock()
+	if sec != s.second {
+		s.second = sec
+		s.secondCount = 0
+	}
+	if s.secondCount >= perSecond {
+		return false
+	}
+	s.secondCount++
+	return true
+}
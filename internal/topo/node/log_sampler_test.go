@@ -0,0 +1,65 @@
+// Copyright 2023 EMQ Technologies Co., Ltd.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package node
+
+import (
+	"testing"
+	"time"
+
+	"github.com/benbjohnson/clock"
+
+	"github.com/lf-edge/ekuiper/internal/conf"
+)
+
+func TestLogSampler(t *testing.T) {
+	countSampled := func(s *logSampler, n int) int {
+		r := 0
+		for i := 0; i < n; i++ {
+			if s.Sample() {
+				r++
+			}
+		}
+		return r
+	}
+	s, err := newLogSampler(0, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c := countSampled(s, 10); c != 10 {
+		t.Errorf("expect all sampled without sampling but got %d", c)
+	}
+	_ = s.Set(5, 0)
+	if c := countSampled(s, 20); c != 4 {
+		t.Errorf("expect 1 in 5 sampled but got %d", c)
+	}
+	mc := conf.Clock.(*clock.Mock)
+	// restore the clock for the following tests which rely on the mock start time
+	defer mc.Set(mc.Now())
+	mc.Add(time.Second)
+	_ = s.Set(0, 3)
+	if c := countSampled(s, 10); c != 3 {
+		t.Errorf("expect 3 sampled per second but got %d", c)
+	}
+	mc.Add(time.Second)
+	if c := countSampled(s, 10); c != 3 {
+		t.Errorf("expect 3 sampled in the next second but got %d", c)
+	}
+	if err := s.Set(-1, 0); err == nil {
+		t.Error("expect error for negative sample rate")
+	}
+	if _, err := newLogSampler(0, -1); err == nil {
+		t.Error("expect error for negative sample rate")
+	}
+}
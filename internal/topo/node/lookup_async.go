@@ -0,0 +1,233 @@
+// Copyright 2023 EMQ Technologies Co., Ltd.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package node
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/lf-edge/ekuiper/internal/topo/checkpoint"
+	"github.com/lf-edge/ekuiper/internal/xsql"
+	"github.com/lf-edge/ekuiper/pkg/api"
+	"github.com/lf-edge/ekuiper/pkg/infra"
+)
+
+// DefaultAsyncConcurrency is the default max lookups in flight when the output is not ordered
+const DefaultAsyncConcurrency = 16
+
+// LookupAsyncConf is the options to run the lookups asynchronously
+type LookupAsyncConf struct {
+	// Ordered keeps the output in the input order, default to true. If false, the lookups run asynchronously and the
+	// results are emitted as they complete for higher throughput
+	Ordered *bool `json:"ordered"`
+	// AsyncConcurrency is the max lookups in flight. When ordered, the lookups run asynchronously only if it is set, and
+	// the results are emitted in the input order. Default to 16 when not ordered
+	AsyncConcurrency int `json:"asyncConcurrency"`
+	// LatestWins cancels the lookup in flight when a newer event of the same lookup key arrives in async mode.
+	// The superseded event is dropped. Default to false which keeps all the lookups
+	LatestWins bool `json:"latestWins"`
+}
+
+// validate checks the async options and fills the default concurrency of the unordered mode
+func (c *LookupAsyncConf) validate() error {
+	if c.AsyncConcurrency < 0 {
+		return fmt.Errorf("invalid lookup asyncConcurrency %d, must not be negative", c.AsyncConcurrency)
+	}
+	if c.Ordered != nil && !*c.Ordered && c.AsyncConcurrency == 0 {
+		c.AsyncConcurrency = DefaultAsyncConcurrency
+	}
+	if c.LatestWins && (c.Ordered == nil || *c.Ordered) {
+		return fmt.Errorf("invalid lookup latestWins, must be used with ordered false")
+	}
+	return nil
+}
+
+// asyncResult is the fetched lookup results of an input in async mode
+type asyncResult struct {
+	// item is the input which is a xsql.TupleRow or *xsql.WindowTuples
+	item interface{}
+	// rows are the rows of the window input or the exploded rows of the tuple input
+	rows    []xsql.TupleRow
+	fetches []*lookupFetch
+	err     error
+	// key and cancel are set in latest wins mode to cancel the fetch when superseded
+	key        string
+	cancel     context.CancelFunc
+	superseded bool
+	// completed is set in ordered mode when the result is received but waits for the earlier results to emit
+	completed bool
+}
+
+// asyncLookups fetches the lookup results in separate routines and joins them in the node routine as they complete,
+// so the output may be out of order. In ordered mode, the completed results are held until all the earlier ones are
+// emitted, and they still count as in flight so that a slow lookup bounds the held results by the max.
+// The lookup values are evaluated before dispatching and the results are joined after completion in the node routine,
+// only the fetching runs concurrently. All the methods must be called in the node routine.
+type asyncLookups struct {
+	n   *LookupNode
+	ctx api.StreamContext
+	fv  *xsql.FunctionValuer
+	// done is buffered by the max in flight lookups so that the fetching routines never block
+	done     chan *asyncResult
+	inflight int
+	max      int
+	// latest are the latest lookups in flight by the lookup key in latest wins mode
+	latest map[string]*asyncResult
+	// pending are the lookups in flight in the input order in ordered mode
+	ordered bool
+	pending []*asyncResult
+}
+
+func newAsyncLookups(ctx api.StreamContext, n *LookupNode, fv *xsql.FunctionValuer, max int, ordered bool) *asyncLookups {
+	return &asyncLookups{
+		n:       n,
+		ctx:     ctx,
+		fv:      fv,
+		done:    make(chan *asyncResult, max),
+		max:     max,
+		ordered: ordered,
+	}
+}
+
+// supersede records the result as the latest of the key and cancels the previous lookup of the key in flight
+func (a *asyncLookups) supersede(r *asyncResult, key string) {
+	if a.latest == nil {
+		a.latest = make(map[string]*asyncResult)
+	}
+	if old, ok := a.latest[key]; ok {
+		old.superseded = true
+		old.cancel()
+	}
+	r.key = key
+	a.latest[key] = r
+}
+
+// dispatch runs the fetch in a new routine. If the max in flight lookups are reached, it waits for a completion first.
+// It returns false if the rule is stopped
+func (a *asyncLookups) dispatch(r *asyncResult, fetch func() ([]*lookupFetch, error)) bool {
+	if !a.await(a.max - 1) {
+		return false
+	}
+	a.inflight++
+	if a.ordered {
+		a.pending = append(a.pending, r)
+	}
+	go func() {
+		r.err = infra.SafeRun(func() (err error) {
+			r.fetches, err = fetch()
+			return err
+		})
+		a.done <- r
+	}()
+	return true
+}
+
+// await joins the completed results until at most max lookups are in flight. It returns false if the rule is stopped
+func (a *asyncLookups) await(max int) bool {
+	for a.inflight > max {
+		select {
+		case r := <-a.done:
+			a.complete(r)
+		case <-a.ctx.Done():
+			return false
+		}
+	}
+	return true
+}
+
+// complete joins and emits a result received from done. In ordered mode, it emits the completed results at the head
+// of the pending lookups
+func (a *asyncLookups) complete(r *asyncResult) {
+	if !a.ordered {
+		a.inflight--
+		a.emit(r)
+		return
+	}
+	r.completed = true
+	for len(a.pending) > 0 && a.pending[0].completed {
+		h := a.pending[0]
+		a.pending[0] = nil
+		a.pending = a.pending[1:]
+		a.inflight--
+		a.emit(h)
+	}
+}
+
+// awaitOrdered waits for all the lookups in flight in ordered mode so that an output not dispatched, such as an error,
+// does not overtake them. It returns false if the rule is stopped
+func (a *asyncLookups) awaitOrdered() bool {
+	if !a.ordered {
+		return true
+	}
+	return a.await(0)
+}
+
+func (a *asyncLookups) emit(r *asyncResult) {
+	n := a.n
+	if r.cancel != nil {
+		r.cancel()
+		if a.latest[r.key] == r {
+			delete(a.latest, r.key)
+		}
+		if r.superseded {
+			n.counters.Inc(SupersededTotal)
+			n.statManager.ProcessTimeEnd()
+			return
+		}
+	}
+	switch d := r.item.(type) {
+	case *xsql.WindowTuples:
+		sets := &xsql.JoinTuples{Content: make([]*xsql.JoinTuple, 0), WindowRange: d.GetWindowRange()}
+		var wj *windowJoin
+		err := r.err
+		if err == nil {
+			wj, err = n.joinWindow(a.ctx, r.rows, r.fetches, a.fv, sets)
+		}
+		n.emitWindow(d, sets, wj, err)
+	case xsql.TupleRow:
+		sets := &xsql.JoinTuples{Content: make([]*xsql.JoinTuple, 0)}
+		err := r.err
+		if err == nil {
+			if r.rows != nil {
+				// the exploded rows of the tuple
+				_, err = n.joinWindow(a.ctx, r.rows, r.fetches, a.fv, sets)
+			} else {
+				err = n.join(a.ctx, d, r.fetches[0], a.fv, sets)
+			}
+		}
+		n.emitTuple(d, sets, err)
+	}
+	n.statManager.ProcessTimeEnd()
+}
+
+// isBarrier checks if the input is a checkpoint barrier which must not overtake the lookups in flight
+func isBarrier(item interface{}) bool {
+	if b, ok := item.(*checkpoint.BufferOrEvent); ok {
+		_, ok = b.Data.(*checkpoint.Barrier)
+		return ok
+	}
+	return false
+}
+
+// newAsync returns the async lookups by the async options, nil if the lookups run in the node routine
+func (n *LookupNode) newAsync(ctx api.StreamContext, fv *xsql.FunctionValuer) *asyncLookups {
+	if n.conf.Ordered != nil && !*n.conf.Ordered {
+		return newAsyncLookups(ctx, n, fv, n.conf.AsyncConcurrency, false)
+	}
+	if n.conf.AsyncConcurrency > 0 {
+		return newAsyncLookups(ctx, n, fv, n.conf.AsyncConcurrency, true)
+	}
+	return nil
+}
@@ -0,0 +1,116 @@
+// Copyright 2023 EMQ Technologies Co., Ltd.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package node
+
+import (
+	"fmt"
+
+	"github.com/lf-edge/ekuiper/internal/topo/lookup/cache"
+	"github.com/lf-edge/ekuiper/pkg/api"
+)
+
+// batchLookuper serves the results prefetched by one batch lookup and falls back to the lookuper for the other values,
+// such as the retries of the fuzzy keys
+type batchLookuper struct {
+	lookuper
+	results map[string][]api.SourceTuple
+}
+
+func (b *batchLookuper) prefetched(values []interface{}) bool {
+	_, ok := b.results[cacheKey(values)]
+	return ok
+}
+
+func (b *batchLookuper) Lookup(ctx api.StreamContext, fields []string, keys []string, values []interface{}) ([]api.SourceTuple, error) {
+	if r, ok := b.results[cacheKey(values)]; ok {
+		return r, nil
+	}
+	return b.lookuper.Lookup(ctx, fields, keys, values)
+}
+
+// prefetch looks up the values of multiple rows in one batch call if the source supports. The values which are cached,
+// skipped by the null key policy or expanded to multiple keys are not prefetched, and they are looked up one by one as
+// usual. It returns the lookuper serving the prefetched results
+func (n *LookupNode) prefetch(ctx api.StreamContext, ns lookuper, cvss [][]interface{}, c *cache.Cache) (lookuper, error) {
+	bl, ok := ns.(api.LookupBatcher)
+	if !ok || n.conf.MultiKey != "" || len(n.ranges) > 0 || len(cvss) < 2 {
+		return ns, nil
+	}
+	var (
+		batch [][]interface{}
+		seen  = make(map[string]bool, len(cvss))
+	)
+	for _, cvs := range cvss {
+		if skip, err := n.skipNullKey(cvs); skip || err != nil {
+			continue
+		}
+		k := cacheKey(cvs)
+		if seen[k] {
+			continue
+		}
+		seen[k] = true
+		if c != nil {
+			if _, hit := c.Get(lookupCacheKey(ns, cvs)); hit {
+				continue
+			}
+		}
+		batch = append(batch, cvs)
+	}
+	// the values are rejected one by one by the open circuit breaker
+	if len(batch) < 2 || (n.breaker != nil && !n.breaker.closed()) {
+		return ns, nil
+	}
+	// the batch is one call to the lookup source in the rate limit. If shed, the values are looked up one by one
+	// which are shed too if the limit is still exceeded
+	shed, err := n.throttle(ctx, batch)
+	if err != nil || shed {
+		return ns, err
+	}
+	rs, err := bl.LookupBatch(ctx, n.sourceFields(), n.keys, batch)
+	if err != nil {
+		// look up the values one by one to retry or apply the retry failure policy to each of them
+		if n.conf.RetryCount > 0 || (n.conf.RetryFailurePolicy != "" && n.conf.RetryFailurePolicy != RetryFailureError) {
+			n.debugf("LookupNode %s fails to look up %d values in batch, look up one by one: %v", n.name, len(batch), err)
+			return ns, nil
+		}
+		return nil, newLookupSourceError(n.name, err)
+	}
+	if len(rs) != len(batch) {
+		return nil, &LookupResultError{Table: n.name, Msg: fmt.Sprintf("batch lookup of %s returns %d results for %d values", n.name, len(rs), len(batch))}
+	}
+	n.debugf("LookupNode %s looks up %d values in one batch", n.name, len(batch))
+	b := &batchLookuper{lookuper: ns, results: make(map[string][]api.SourceTuple, len(batch))}
+	for i, cvs := range batch {
+		b.results[cacheKey(cvs)] = rs[i]
+	}
+	return b, nil
+}
+
+// fetchRows reads the lookup results of the values of multiple rows
+func (n *LookupNode) fetchRows(ctx api.StreamContext, ns lookuper, cvss [][]interface{}, c *cache.Cache) ([]*lookupFetch, error) {
+	ns, err := n.prefetch(ctx, ns, cvss, c)
+	if err != nil {
+		return nil, err
+	}
+	fs := make([]*lookupFetch, len(cvss))
+	for i, cvs := range cvss {
+		f, err := n.fetchRow(ctx, ns, cvs, c)
+		if err != nil {
+			return nil, err
+		}
+		fs[i] = f
+	}
+	return fs, nil
+}
@@ -0,0 +1,154 @@
+// Copyright 2023 EMQ Technologies Co., Ltd.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package node
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/lf-edge/ekuiper/internal/conf"
+	"github.com/lf-edge/ekuiper/pkg/api"
+)
+
+// DefaultBreakerCooldown is the default time in milliseconds the circuit breaker stays open
+const DefaultBreakerCooldown = 30000
+
+// LookupBreakerConf is the options of the circuit breaker of the lookup source
+type LookupBreakerConf struct {
+	// BreakerThreshold is the count of the consecutive failed lookups, after the retries, to open the circuit breaker.
+	// When open, the lookups are rejected without calling the source and handled by RetryFailurePolicy. 0 means no breaker
+	BreakerThreshold int `json:"breakerThreshold"`
+	// BreakerCooldown is the time in milliseconds the breaker stays open before a trial call. Default to 30000
+	BreakerCooldown int `json:"breakerCooldown"`
+	// BreakerMaxStale is how long in milliseconds the expired results are kept in the memory cache to be served when
+	// the breaker is open. 0 means not serving the stale results
+	BreakerMaxStale int `json:"breakerMaxStale"`
+}
+
+// validate checks the breaker options and fills the default cool down. Serving the stale results requires the cache
+func (c *LookupBreakerConf) validate(cached bool) error {
+	if c.BreakerThreshold < 0 {
+		return fmt.Errorf("invalid lookup breakerThreshold %d, must not be negative", c.BreakerThreshold)
+	}
+	if c.BreakerCooldown < 0 {
+		return fmt.Errorf("invalid lookup breakerCooldown %d, must not be negative", c.BreakerCooldown)
+	}
+	if c.BreakerMaxStale < 0 {
+		return fmt.Errorf("invalid lookup breakerMaxStale %d, must not be negative", c.BreakerMaxStale)
+	}
+	if c.BreakerMaxStale > 0 && (c.BreakerThreshold == 0 || !cached) {
+		return fmt.Errorf("invalid lookup breakerMaxStale %d, it requires breakerThreshold and cache", c.BreakerMaxStale)
+	}
+	if c.BreakerCooldown == 0 {
+		c.BreakerCooldown = DefaultBreakerCooldown
+	}
+	return nil
+}
+
+// circuitBreaker stops calling the lookup source for a cool down after the consecutive failed lookups, so that a dead
+// source does not back up the rule by the timeouts and the retries. After the cool down, the breaker is half open and
+// allows one trial call. The success of the trial closes the breaker, and the failure opens it for another cool down.
+// It is safe to be used by the concurrent lookups in async mode.
+type circuitBreaker struct {
+	sync.Mutex
+	threshold int
+	cooldown  time.Duration
+	// failures is the count of the consecutive failed lookups
+	failures int
+	// openUntil is when the open breaker allows a trial call, zero if closed
+	openUntil time.Time
+	// trial is set when the trial call is in flight
+	trial bool
+}
+
+func newCircuitBreaker(threshold int, cooldown time.Duration) *circuitBreaker {
+	return &circuitBreaker{threshold: threshold, cooldown: cooldown}
+}
+
+// allow returns whether the lookup can call the source. When the cool down is over, only the first caller is allowed
+// as the trial
+func (b *circuitBreaker) allow() bool {
+	b.Lock()
+	defer b.Unlock()
+	if b.openUntil.IsZero() {
+		return true
+	}
+	if b.trial || conf.GetNow().Before(b.openUntil) {
+		return false
+	}
+	b.trial = true
+	return true
+}
+
+// closed returns whether the breaker is closed without taking the trial
+func (b *circuitBreaker) closed() bool {
+	b.Lock()
+	defer b.Unlock()
+	return b.openUntil.IsZero()
+}
+
+// abort ends the trial call without a result, such as canceled, so that the next caller can take the trial
+func (b *circuitBreaker) abort() {
+	b.Lock()
+	defer b.Unlock()
+	b.trial = false
+}
+
+// record records the result of an allowed call. It returns true if the breaker is opened by the failure
+func (b *circuitBreaker) record(failed bool) bool {
+	b.Lock()
+	defer b.Unlock()
+	if !failed {
+		b.failures = 0
+		b.openUntil = time.Time{}
+		b.trial = false
+		return false
+	}
+	b.failures++
+	if b.trial {
+		b.trial = false
+		b.openUntil = conf.GetNow().Add(b.cooldown)
+		return true
+	}
+	if b.openUntil.IsZero() && b.failures >= b.threshold {
+		b.openUntil = conf.GetNow().Add(b.cooldown)
+		return true
+	}
+	return false
+}
+
+// breakerLookup calls the lookup source with retries if the circuit breaker allows, and records the result to the
+// breaker. The rejected lookup is handled by the retry failure policy
+func (n *LookupNode) breakerLookup(ctx api.StreamContext, ns lookuper, cvs []interface{}) ([]api.SourceTuple, error) {
+	if !n.breaker.allow() {
+		n.counters.Inc(BreakerRejectedTotal)
+		n.debugf("LookupNode %s rejects the lookup of %v for the open circuit breaker", n.name, cvs)
+		var err error = &LookupCircuitOpenError{Table: n.name}
+		if n.conf.RetryFailurePolicy != "" && n.conf.RetryFailurePolicy != RetryFailureError {
+			err = &retriesExhaustedError{err: err}
+		}
+		return nil, err
+	}
+	r, e := n.retryLookup(ctx, ns, cvs)
+	if e != nil && ctx.Err() != nil {
+		// the canceled lookups are not the failures of the source
+		n.breaker.abort()
+	} else if n.breaker.record(e != nil) {
+		n.counters.Inc(BreakerOpensTotal)
+		ctx.GetLogger().Warnf("LookupNode %s opens the circuit breaker for %d consecutive failures: %v", n.name, n.conf.BreakerThreshold, e)
+	}
+	return r, e
+}
@@ -0,0 +1,410 @@
+// Copyright 2023 EMQ Technologies Co., Ltd.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package node
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/lf-edge/ekuiper/internal/topo/lookup"
+	"github.com/lf-edge/ekuiper/internal/topo/lookup/cache"
+	"github.com/lf-edge/ekuiper/internal/topo/node/metric"
+	"github.com/lf-edge/ekuiper/internal/xsql"
+	"github.com/lf-edge/ekuiper/pkg/api"
+)
+
+// initCache creates the cache by the cache options, or acquires the shared cache, or takes over the cache of the
+// previous run of the rule. It also registers the cache counters
+func (n *LookupNode) initCache(ctx api.StreamContext, counters *metric.CounterGroup) error {
+	ttl, err := parseLookupTTL("cacheTtl", n.conf.CacheTTL)
+	if err != nil {
+		return err
+	}
+	maxStale, err := parseLookupTTL("cacheMaxStale", n.conf.CacheMaxStale)
+	if err != nil {
+		return err
+	}
+	missTTL, err := parseLookupTTL("cacheMissingKeyTtl", n.conf.CacheMissingKeyTTL)
+	if err != nil {
+		return err
+	}
+	opts := &cache.Options{
+		TTL:             ttl,
+		CacheMissingKey: n.conf.CacheMissingKey,
+		MissingKeyTTL:   missTTL,
+		HashKeys:        n.conf.CacheHashKeys,
+		MaxItems:        n.conf.CacheSize,
+		MaxBytes:        n.conf.CacheMaxBytes,
+		Sliding:         n.conf.CacheSliding,
+		Namespace:       n.conf.CacheNamespace,
+		FirstWriteWins:  n.conf.CacheSetPolicy == CacheSetFirstWriteWins,
+	}
+	if n.conf.CacheCompress != "" {
+		opts.Compression = n.conf.CacheCompress
+		opts.CompressMinBytes = n.conf.CacheCompressMinBytes
+	}
+	if n.conf.BreakerMaxStale > 0 {
+		opts.RetainStale = time.Duration(n.conf.BreakerMaxStale) * time.Millisecond
+		counters.Register(StaleServedTotal)
+	}
+	if n.conf.CacheStaleWhileRevalidate {
+		opts.StaleWhileRevalidate = true
+		opts.MaxStale = maxStale
+		counters.Register(StaleServedTotal, RefreshFailuresTotal)
+	}
+	if n.conf.CacheBackend != "" && n.conf.CacheBackend != cache.BackendMemory {
+		opts.Backend, err = cache.NewBackend(n.conf.CacheBackend, n.name, n.conf.CacheBackendProps)
+		if err != nil {
+			return err
+		}
+	}
+	if n.conf.CacheShared {
+		opts.Namespace = n.sharedCacheNamespace()
+		sc, err := lookup.AcquireCache(n.name, opts)
+		if err != nil {
+			return err
+		}
+		n.setCache(sc, n.name)
+	} else {
+		n.handoffId = n.cacheHandoffId(ctx)
+		if hc := lookup.TakeCache(n.handoffId); hc != nil {
+			ctx.GetLogger().Infof("LookupNode %s takes over the cache of the previous run of the rule", n.name)
+			n.setCache(hc, "")
+			if opts.Backend != nil {
+				opts.Backend.Close()
+			}
+		} else {
+			n.setCache(cache.NewCacheWithOptions(opts), "")
+		}
+	}
+	if n.conf.CacheMissingKey {
+		counters.Register(CachedMisses, CachedMissHitsTotal)
+	}
+	if n.conf.CacheNonEmptyOnly || n.conf.CacheMaxRows > 0 {
+		counters.Register(CacheSkippedTotal)
+	}
+	if n.conf.CacheMaxValueBytes > 0 {
+		counters.Register(CacheOversizedTotal)
+	}
+	counters.Register(CacheHitsTotal, CacheMissesTotal, CacheChangesTotal)
+	if n.conf.CacheOnChange == CacheOnChangeRefresh {
+		counters.Register(RefreshFailuresTotal)
+	}
+	if opts.Backend == nil {
+		counters.Register(CacheItems, CacheEvictionsTotal)
+	}
+	if n.conf.CacheAdaptive {
+		n.bypass = newCacheBypass(cacheAdaptiveWindow, cacheMinHitRatio)
+		counters.Register(CacheBypassTotal)
+	}
+	return nil
+}
+
+// openCache subscribes the changes of the lookup tables to update the cache and preloads the cache. It returns the
+// function to unsubscribe the changes and release the cache when the node stops
+func (n *LookupNode) openCache(ctx api.StreamContext, c *cache.Cache, cacheId string, tables *lookupTables, fv *xsql.FunctionValuer) func() {
+	log := ctx.GetLogger()
+	var unsubscribes []func()
+	// invalidate the cache automatically if the source notifies the changes
+	for i, s := range tables.sources {
+		if cn, ok := s.(api.LookupChangeNotifier); ok {
+			// the results of the union tables are refreshed from all the tables, so only invalidate them
+			var refresher lookuper
+			if n.conf.CacheOnChange == CacheOnChangeRefresh && len(tables.tables) == 1 {
+				refresher = s
+			}
+			unsubscribe := cn.Subscribe(func(key string, value interface{}) {
+				n.onLookupChange(ctx, refresher, key, value)
+			})
+			if unsubscribe == nil {
+				// the source does not notify the changes by its configuration
+				continue
+			}
+			log.Infof("LookupNode %s subscribes the changes of lookup table %s", n.name, tables.tables[i])
+			unsubscribes = append(unsubscribes, unsubscribe)
+		}
+	}
+	if n.conf.CachePreload {
+		if err := n.preload(ctx, tables.ns, c, fv); err != nil {
+			log.Warnf("LookupNode %s fails to preload the cache and starts with an empty cache: %v", n.name, err)
+		}
+	}
+	return func() {
+		for i := len(unsubscribes) - 1; i >= 0; i-- {
+			unsubscribes[i]()
+		}
+		if cacheId != "" {
+			lookup.ReleaseCache(cacheId)
+			return
+		}
+		// the changes are not notified during parking, so the cache may become stale
+		if len(unsubscribes) > 0 || !lookup.ParkCache(ctx.GetRuleId(), n.handoffId, c) {
+			c.Close()
+		}
+	}
+}
+
+// cachedLookup reads the cache firstly and then the lookup source if the cache misses. It also returns whether the cache is hit
+func (n *LookupNode) cachedLookup(ctx api.StreamContext, ns lookuper, cvs []interface{}, c *cache.Cache) ([]api.SourceTuple, bool, error) {
+	if c == nil {
+		r, _, e := n.sourceLookup(ctx, ns, cvs)
+		return r, false, e
+	}
+	if n.bypass != nil && n.bypass.Bypass() {
+		n.counters.Inc(CacheBypassTotal)
+		r, _, e := n.sourceLookup(ctx, ns, cvs)
+		return r, false, e
+	}
+	k := lookupCacheKey(ns, cvs)
+	r, ok, stale := c.GetOrRevalidate(ctx, k, func() error {
+		return n.refresh(ctx, ns, cvs, c, k)
+	})
+	if stale {
+		n.counters.Inc(StaleServedTotal)
+	}
+	if ok {
+		n.counters.Inc(CacheHitsTotal)
+		n.observeCache(ctx, c, true)
+		if len(r) == 0 {
+			n.counters.Inc(CachedMissHitsTotal)
+			n.debugf("LookupNode %s hits the cached miss of key %s", n.name, k)
+		}
+		return r, true, nil
+	}
+	n.counters.Inc(CacheMissesTotal)
+	r, shed, e := n.sourceLookup(ctx, ns, cvs)
+	if e != nil {
+		var oe *LookupCircuitOpenError
+		if n.conf.BreakerMaxStale > 0 && errors.As(e, &oe) {
+			if sr, ok, isStale := c.GetStale(k); ok {
+				if isStale {
+					n.counters.Inc(StaleServedTotal)
+				}
+				n.debugf("LookupNode %s serves the stale result of key %s for the open circuit breaker", n.name, k)
+				return sr, false, nil
+			}
+		}
+		return nil, false, e
+	}
+	// the shed result is not the real result of the key
+	if shed {
+		return nil, false, nil
+	}
+	n.cacheResult(c, k, r)
+	n.observeCache(ctx, c, false)
+	return r, false, nil
+}
+
+// cacheResult caches the lookup result if it meets the caching conditions
+func (n *LookupNode) cacheResult(c *cache.Cache, k string, r []api.SourceTuple) {
+	if (n.conf.CacheNonEmptyOnly && len(r) == 0) || (n.conf.CacheMaxRows > 0 && len(r) > n.conf.CacheMaxRows) {
+		n.counters.Inc(CacheSkippedTotal)
+		n.debugf("LookupNode %s does not cache the result of key %s with %d rows", n.name, k, len(r))
+		return
+	}
+	if n.conf.CacheMaxValueBytes > 0 {
+		if size := cache.EstimateSize(r); size > n.conf.CacheMaxValueBytes {
+			n.counters.Inc(CacheOversizedTotal)
+			n.debugf("LookupNode %s does not cache the result of key %s with size %d exceeding the max value bytes", n.name, k, size)
+			return
+		}
+	}
+	c.Set(k, r)
+}
+
+// refresh looks up the stale result in the background and caches it again. The stale result is removed firstly in case
+// the new result does not meet the caching conditions
+func (n *LookupNode) refresh(ctx api.StreamContext, ns lookuper, cvs []interface{}, c *cache.Cache, k string) error {
+	r, shed, err := n.sourceLookup(ctx, ns, cvs)
+	if err == nil && shed {
+		err = fmt.Errorf("the refresh is shed by the rate limit")
+	}
+	if err != nil {
+		n.counters.Inc(RefreshFailuresTotal)
+		return err
+	}
+	c.Delete(k)
+	n.cacheResult(c, k, r)
+	return nil
+}
+
+// observeCache feeds the cache hit to the adaptive cache mode. When the bypass starts, the cache is cleared
+// to release the memory of the results which are unlikely to be hit unless it is shared
+func (n *LookupNode) observeCache(ctx api.StreamContext, c *cache.Cache, hit bool) {
+	if n.bypass == nil {
+		return
+	}
+	if n.bypass.Observe(hit) {
+		// the shared cache may be still useful for other rules
+		if n.cacheId == "" {
+			c.Clear()
+		}
+		ctx.GetLogger().Infof("LookupNode %s bypasses the cache for a while due to the low hit ratio", n.name)
+	}
+}
+
+// sharedCacheNamespace identifies the cached results which are reusable across rules in the shared cache of the table.
+// The cached results are the full rows of the lookup keys, so the selected fields and the ttl are not part of it
+func (n *LookupNode) sharedCacheNamespace() string {
+	tables := append([]string{n.name}, n.conf.UnionTables...)
+	ns := fmt.Sprintf("%v_%s_%v", tables, n.conf.UnionStrategy, n.keys)
+	if n.conf.CacheNamespace != "" {
+		ns = n.conf.CacheNamespace + ":" + ns
+	}
+	return ns
+}
+
+// cacheHandoffId identifies the cache of the node in the rule. The lookup conf, the table definition and the selected
+// fields are part of the id, so the cache is only taken over by the new node if they are unchanged
+func (n *LookupNode) cacheHandoffId(ctx api.StreamContext) string {
+	c, _ := json.Marshal(n.conf)
+	o, _ := json.Marshal(n.srcOptions)
+	return fmt.Sprintf("%s/%s/%v/%v/%s/%s", ctx.GetRuleId(), ctx.GetOpId(), n.fields, n.keys, o, c)
+}
+
+// setCache publishes the cache of the running node
+func (n *LookupNode) setCache(c *cache.Cache, cacheId string) {
+	n.cacheLock.Lock()
+	defer n.cacheLock.Unlock()
+	n.cache, n.cacheId = c, cacheId
+}
+
+// getCache returns the cache and the shared cache id of the running node
+func (n *LookupNode) getCache() (*cache.Cache, string) {
+	n.cacheLock.RLock()
+	defer n.cacheLock.RUnlock()
+	return n.cache, n.cacheId
+}
+
+// InvalidateCache removes the cached results of the lookup values. If no values specified, the whole cache will be cleared.
+// The whole cache is also cleared if the fields are evaluated by the rows, in temporal mode or with range predicates,
+// since the results of the values may be cached for any fields, time buckets or range values.
+func (n *LookupNode) InvalidateCache(values [][]interface{}) error {
+	c, _ := n.getCache()
+	if c == nil {
+		return fmt.Errorf("cache is not enabled for lookup node %s", n.name)
+	}
+	if len(values) == 0 || n.fieldsExpr != nil || n.conf.Temporal || len(n.ranges) > 0 {
+		c.Clear()
+		return nil
+	}
+	for _, cvs := range values {
+		c.Delete(cacheKey(cvs))
+	}
+	return nil
+}
+
+// CacheOptions are the cache options of a running lookup node to update. The nil options are kept unchanged
+type CacheOptions struct {
+	// CacheTTL is an integer in seconds or a duration string like "30s"
+	CacheTTL        interface{} `json:"cacheTtl"`
+	CacheMissingKey *bool       `json:"cacheMissingKey"`
+}
+
+// UpdateCacheOptions changes the cache options at runtime without restarting the rule. The change applies to the
+// subsequent lookups and the cached results keep their ttl. Turning off cacheMissingKey removes the cached empty results.
+// For the shared cache, only the options of this rule are changed, and the removed empty results are the ones reusable
+// by this rule.
+func (n *LookupNode) UpdateCacheOptions(opts *CacheOptions) error {
+	// the updates are serialized
+	n.cacheLock.Lock()
+	defer n.cacheLock.Unlock()
+	c := n.cache
+	if c == nil {
+		return fmt.Errorf("cache is not enabled for lookup node %s", n.name)
+	}
+	if opts.CacheMissingKey != nil && *opts.CacheMissingKey && n.conf.CacheNonEmptyOnly {
+		return fmt.Errorf("lookup cacheNonEmptyOnly conflicts with cacheMissingKey")
+	}
+	if opts.CacheTTL != nil {
+		ttl, err := parseLookupTTL("cacheTtl", opts.CacheTTL)
+		if err != nil {
+			return err
+		}
+		c.SetTTL(ttl)
+	}
+	if opts.CacheMissingKey != nil {
+		c.SetCacheMissingKey(*opts.CacheMissingKey)
+	}
+	return nil
+}
+
+// onLookupChange invalidates the cached results affected by a changed row of the lookup source.
+// The cached result can only be located by the key value when looking up by the changed key alone,
+// otherwise the whole cache is cleared. An empty key means the only lookup key of the source, such as the redis key.
+// If the refresher is set by the refresh change policy, the located result is refreshed instead.
+func (n *LookupNode) onLookupChange(ctx api.StreamContext, refresher lookuper, key string, value interface{}) {
+	n.counters.Inc(CacheChangesTotal)
+	if len(n.keys) == 1 && (key == "" || n.keys[0] == key) && !n.conf.FuzzyKey {
+		cvs := []interface{}{value}
+		if refresher != nil && n.refreshChanged(ctx, refresher, cvs) {
+			ctx.GetLogger().Debugf("LookupNode %s refreshes the cache for the change of %s=%v", n.name, key, value)
+			return
+		}
+		_ = n.InvalidateCache([][]interface{}{cvs})
+	} else {
+		_ = n.InvalidateCache(nil)
+	}
+	ctx.GetLogger().Debugf("LookupNode %s invalidates the cache for the change of %s=%v", n.name, key, value)
+}
+
+// refreshChanged looks up the cached result of the changed values again in the background and replaces it, so that
+// the hot keys keep hitting the cache after the changes. The result is invalidated if the refresh fails.
+// It returns false if the result cannot be located to refresh
+func (n *LookupNode) refreshChanged(ctx api.StreamContext, refresher lookuper, cvs []interface{}) bool {
+	c, _ := n.getCache()
+	if c == nil || n.fieldsExpr != nil || n.conf.Temporal || len(n.ranges) > 0 {
+		return false
+	}
+	k := cacheKey(cvs)
+	if _, ok := c.Get(k); !ok {
+		// nothing to refresh if not cached
+		return true
+	}
+	go func() {
+		if err := n.refresh(ctx, refresher, cvs, c, k); err != nil {
+			ctx.GetLogger().Warnf("LookupNode %s fails to refresh the changed values %v and invalidates them: %v", n.name, cvs, err)
+			c.Delete(k)
+		}
+	}()
+	return true
+}
+
+// cacheKey returns the cache key of the lookup values
+func cacheKey(cvs []interface{}) string {
+	return fmt.Sprintf("%v", cvs)
+}
+
+// lookupCacheKey returns the cache key of the lookup values which also contains the fields looked up by the row and
+// the time bucket if any
+func lookupCacheKey(ns lookuper, cvs []interface{}) string {
+	k := cacheKey(cvs)
+	for {
+		switch l := ns.(type) {
+		case *fieldsLookuper:
+			k += l.key
+			ns = l.lookuper
+		case *temporalLookuper:
+			k += l.key
+			ns = l.lookuper
+		case *batchLookuper:
+			ns = l.lookuper
+		default:
+			return k
+		}
+	}
+}
@@ -0,0 +1,569 @@
+// Copyright 2023 EMQ Technologies Co., Ltd.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package node
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/lf-edge/ekuiper/internal/compressor"
+	"github.com/lf-edge/ekuiper/internal/topo/lookup/cache"
+	"github.com/lf-edge/ekuiper/internal/xsql"
+	"github.com/lf-edge/ekuiper/pkg/ast"
+	"github.com/lf-edge/ekuiper/pkg/cast"
+)
+
+const (
+	// OverLimitTruncate truncates the lookup result to the max rows and logs a warning
+	OverLimitTruncate = "truncate"
+	// OverLimitError reports error when the lookup result exceeds the max rows
+	OverLimitError = "error"
+)
+
+const (
+	// CacheOnChangeInvalidate removes the cached results of the changed rows notified by the lookup source
+	CacheOnChangeInvalidate = "invalidate"
+	// CacheOnChangeRefresh looks up the cached results of the changed rows again and replaces them in the background
+	CacheOnChangeRefresh = "refresh"
+)
+
+const (
+	// CacheSetLastWriteWins overwrites the cached result by the later set of the same key
+	CacheSetLastWriteWins = "lastWriteWins"
+	// CacheSetFirstWriteWins keeps the unexpired cached result and discards the later set of the same key
+	CacheSetFirstWriteWins = "firstWriteWins"
+)
+
+const (
+	// UnionFirstMatch returns the result of the first lookup table which has a match
+	UnionFirstMatch = "firstMatch"
+	// UnionAll returns the results of all the lookup tables
+	UnionAll = "unionAll"
+)
+
+const (
+	// NullKeySkip returns empty result without lookup if any lookup value is null
+	NullKeySkip = "skip"
+	// NullKeyError reports error if any lookup value is null
+	NullKeyError = "error"
+	// NullKeyPass sends the null values to the lookup source
+	NullKeyPass = "passNull"
+)
+
+const (
+	// RateLimitShed skips the lookup which exceeds the rate limit and treats it as no match
+	RateLimitShed = "shed"
+	// RateLimitError reports error for the lookup which exceeds the rate limit
+	RateLimitError = "error"
+)
+
+const (
+	// MultiKeyAny looks up each key of the array lookup values and joins all the matched results
+	MultiKeyAny = "any"
+	// MultiKeyAll looks up each key of the array lookup values and treats the row as a miss if any key has no result
+	MultiKeyAll = "all"
+)
+
+const (
+	// SortAsc sorts the lookup result in ascending order
+	SortAsc = "asc"
+	// SortDesc sorts the lookup result in descending order
+	SortDesc = "desc"
+)
+
+const (
+	// EmitAsMeta attaches the lookup latency and cache hit to the metadata of the lookup rows
+	EmitAsMeta = "meta"
+	// EmitAsField attaches the lookup latency and cache hit as the fields of the lookup rows
+	EmitAsField = "field"
+	// DefaultLatencyName is the default name of the lookup latency in milliseconds
+	DefaultLatencyName = "lookupLatency"
+	// DefaultCacheHitName is the default name of the cache hit flag
+	DefaultCacheHitName = "lookupCacheHit"
+	// DefaultMatchedKeyName is the default field name of the matched key
+	DefaultMatchedKeyName = "lookupKey"
+	// SourceTagName is the field name of the source tag
+	SourceTagName = "lookupSource"
+)
+
+const (
+	// SummaryAppend emits the window summary besides the joined rows
+	SummaryAppend = "append"
+	// SummaryOnly emits the window summary instead of the joined rows
+	SummaryOnly = "only"
+)
+
+// The fields of the window summary tuple
+const (
+	// SummaryRows is the count of the window rows to look up, including the exploded ones
+	SummaryRows = "rows"
+	// SummaryMatched is the count of the rows with any lookup result
+	SummaryMatched = "matched"
+	// SummaryMissed is the count of the rows without lookup result
+	SummaryMissed = "missed"
+	// SummaryResults is the count of the joined lookup rows
+	SummaryResults = "results"
+	// SummaryAvgFanout is the average lookup rows joined to a matched row
+	SummaryAvgFanout = "avgFanout"
+	// SummaryWindowStart is the start time of the window in milliseconds
+	SummaryWindowStart = "windowStart"
+	// SummaryWindowEnd is the end time of the window in milliseconds
+	SummaryWindowEnd = "windowEnd"
+)
+
+const (
+	// DefaultCacheCompressMinBytes is the default min estimated size of the cached results to compress
+	DefaultCacheCompressMinBytes = 1024
+)
+
+type LookupConf struct {
+	Cache bool `json:"cache"`
+	// CacheTTL is an integer in seconds or a duration string like "30s"
+	CacheTTL        interface{} `json:"cacheTtl"`
+	CacheMissingKey bool        `json:"cacheMissingKey"`
+	// CacheMissingKeyTTL is the ttl of the cached empty results in the same format as CacheTTL. Default to CacheTTL
+	CacheMissingKeyTTL interface{} `json:"cacheMissingKeyTtl"`
+	// CacheStaleWhileRevalidate serves the expired result for at most CacheMaxStale while refreshing it in the background
+	CacheStaleWhileRevalidate bool `json:"cacheStaleWhileRevalidate"`
+	// CacheMaxStale is an integer in seconds or a duration string. Default to the ttl of the result
+	CacheMaxStale interface{} `json:"cacheMaxStale"`
+	// CacheSliding extends the ttl of a cached result on every hit so that the hot keys never expire
+	CacheSliding bool `json:"cacheSliding"`
+	// CacheSetPolicy decides which result is kept when the concurrent lookups of the same key set the cache, could be
+	// "lastWriteWins" or "firstWriteWins". Default to "lastWriteWins"
+	CacheSetPolicy string `json:"cacheSetPolicy"`
+	// CacheOnChange decides how to update the cache when the lookup source notifies a changed row, could be
+	// "invalidate" or "refresh". Default to "invalidate"
+	CacheOnChange string `json:"cacheOnChange"`
+	// CacheHashKeys stores the hash of the cache keys instead of the original keys to save memory
+	CacheHashKeys bool `json:"cacheHashKeys"`
+	// CacheSize is the max count of the cached results, 0 means no limit. When exceeding, the least recently used
+	// results are evicted
+	CacheSize int `json:"cacheSize"`
+	// CacheMaxBytes is the memory budget in bytes of the cache, 0 means no limit
+	CacheMaxBytes int64 `json:"cacheMaxBytes"`
+	// CacheMaxValueBytes only caches the results whose estimated size is at most the bytes, 0 means no limit
+	CacheMaxValueBytes int64 `json:"cacheMaxValueBytes"`
+	// CacheCompress is the codec to compress the cached results such as "zstd", "gzip", "zlib" or "flate". Default to
+	// empty which means no compression
+	CacheCompress string `json:"cacheCompress"`
+	// CacheCompressMinBytes only compresses the results whose estimated size is at least the bytes. Default to 1024
+	CacheCompressMinBytes int64 `json:"cacheCompressMinBytes"`
+	// CacheNonEmptyOnly never caches the empty results. It conflicts with CacheMissingKey
+	CacheNonEmptyOnly bool `json:"cacheNonEmptyOnly"`
+	// CacheMaxRows only caches the results of at most the rows to avoid caching the huge fan-out results, 0 means no limit
+	CacheMaxRows int `json:"cacheMaxRows"`
+	// CacheShared shares the cache with the rules which look up the same tables by the same keys with the same cache options.
+	// The full rows are cached and the selected fields are projected when joining
+	CacheShared bool `json:"cacheShared"`
+	// CacheAdaptive stops caching for a while if the cache is rarely hit such as looking up by unique keys
+	CacheAdaptive bool `json:"cacheAdaptive"`
+	// CacheBackend is the registered backend to store the cache such as "redis", default to "memory". A remote backend
+	// shares the cache across the instances, so the memory only options such as CacheSliding are not supported
+	CacheBackend string `json:"cacheBackend"`
+	// CacheBackendProps are the connection props of the cache backend
+	CacheBackendProps map[string]interface{} `json:"cacheBackendProps"`
+	// CacheNamespace is prefixed to all the cache keys to isolate the rules or the environments sharing the same cache
+	// backend or the shared cache, such as the test and the production rules. Default to empty which means no prefix
+	CacheNamespace string `json:"cacheNamespace"`
+	// CachePreload scans the lookup source to populate the cache when the rule starts, so that the first events do not
+	// all miss the cache. The lookup source must support scanning
+	CachePreload bool `json:"cachePreload"`
+	// CachePreloadFilter is a condition like "region = 'eu'" evaluated against each scanned row to only preload the
+	// matched rows. Default to empty which preloads all the rows
+	CachePreloadFilter string `json:"cachePreloadFilter"`
+	// BufferLength is the input buffer length of the lookup node. If not set, use the rule option bufferLength
+	BufferLength int `json:"bufferLength"`
+	// BroadcastTimeout is the max time in milliseconds to wait for a slow downstream before dropping the result.
+	// If not set, the result is dropped immediately when the downstream buffer is full
+	BroadcastTimeout int `json:"broadcastTimeout"`
+	// UnionTables are the additional lookup tables to query besides the joined table, in the priority order
+	UnionTables []string `json:"unionTables"`
+	// UnionStrategy decides how to combine the results of multiple tables, could be "firstMatch"(default) or "unionAll"
+	UnionStrategy string `json:"unionStrategy"`
+	// FuzzyKey retries the lookup with the normalized string keys if the exact lookup has no result.
+	// The normalization trims and collapses the whitespaces and strips the FuzzyKeyPrefixes
+	FuzzyKey           bool     `json:"fuzzyKey"`
+	FuzzyKeyPrefixes   []string `json:"fuzzyKeyPrefixes"`
+	FuzzyKeyIgnoreCase bool     `json:"fuzzyKeyIgnoreCase"`
+	// NullKeyPolicy decides what to do if any lookup value is null, could be "skip"(default), "error" or "passNull"
+	NullKeyPolicy string `json:"nullKeyPolicy"`
+	// StrictInput validates that each input row contains the fields referenced by the lookup values and reports the
+	// missing field as an error. Default to false which evaluates the missing fields as null
+	StrictInput bool `json:"strictInput"`
+	// RateLimit is the max calls per second to the lookup source, 0 means no limit. The cache hits are not limited
+	RateLimit float64 `json:"rateLimit"`
+	// RateLimitGroup shares the rate limit across the rules with the same group such as the same database connection
+	RateLimitGroup string `json:"rateLimitGroup"`
+	// RateLimitMaxWait is the max time in milliseconds to wait for the rate limit, 0 means no wait
+	RateLimitMaxWait int `json:"rateLimitMaxWait"`
+	// RateLimitPolicy decides what to do when the wait exceeds RateLimitMaxWait, could be "shed"(default) or "error"
+	RateLimitPolicy string `json:"rateLimitPolicy"`
+	// ExplodeField is the array field of the left row to explode before lookup. Each element replaces the array in a copy
+	// of the row which is looked up and joined separately. An empty or null array is exploded to a null element
+	ExplodeField string `json:"explodeField"`
+	// MultiKey looks up each element of the array lookup values as a separate key, could be "any" or "all".
+	// The array values are zipped by index to compose the keys. Default to empty which looks up the array as is
+	MultiKey string `json:"multiKey"`
+	// SortField is the field of the lookup result to sort the rows by before joining. The rows missing the field are placed last
+	SortField string `json:"sortField"`
+	// ResultFilter is a condition like "status = 'active'" evaluated against each lookup row. The rows not matching it are
+	// not joined. It applies before sorting and truncation
+	ResultFilter string `json:"resultFilter"`
+	// FieldsExpr is an expression evaluated against each stream row to get the fields to look up, such as choosing the
+	// attributes by a type field. It returns an array of field names or a comma separated string. If it returns null
+	// or empty, the fields selected by the rule are looked up. The window inputs always look up the selected fields
+	FieldsExpr string `json:"fieldsExpr"`
+	// SortOrder could be "asc"(default) or "desc"
+	SortOrder string `json:"sortOrder"`
+	// MaxResultRows is the max rows of one lookup result, 0 means no limit
+	MaxResultRows int `json:"maxResultRows"`
+	// OverLimitPolicy decides what to do when the result exceeds MaxResultRows, could be "truncate"(default) or "error"
+	OverLimitPolicy string `json:"overLimitPolicy"`
+	// StrictFields validates that each lookup row contains all the selected fields
+	StrictFields bool `json:"strictFields"`
+	// FieldDefaults are the values to fill when a selected field is missing in strict fields mode. If no default, report error
+	FieldDefaults map[string]interface{} `json:"fieldDefaults"`
+	// Temporal looks up the rows valid at the timestamp of the stream row instead of the current rows if the lookup
+	// source supports time-versioned data. The other sources ignore the timestamp
+	Temporal bool `json:"temporal"`
+	// TemporalBucket is the time bucket in milliseconds to truncate the timestamp of the stream row, so that the rows
+	// in the same bucket share the lookup and the cached result. Default to 0 which means the exact timestamp
+	TemporalBucket int `json:"temporalBucket"`
+	// ErrorTopic is the memory topic to publish the failed lookups as error rows with the stream row, the lookup values
+	// and the error message, so that other rules can consume them by a memory stream to aggregate and alert on the
+	// enrichment failures. The errors are still emitted and counted as before. Default to empty which means no error rows
+	ErrorTopic string `json:"errorTopic"`
+	// WindowSummary emits a summary tuple of the join statistics per window to the summary output, could be "append"
+	// which emits the joined rows too, or "only" which emits the summary only. Default to empty which means no summary
+	WindowSummary string `json:"windowSummary"`
+	// WindowSummaryFields are the fields of the summary tuple. Default to all the fields
+	WindowSummaryFields []string `json:"windowSummaryFields"`
+	// Emitter overrides the emitter name of the lookup rows in the join output which is the lookup table name by default.
+	// It must not be the name of another stream or table in the rule
+	Emitter string `json:"emitter"`
+	// LeftFields are the fields of the left row to keep in the join output, empty means all. The metadata is always kept
+	LeftFields []string `json:"leftFields"`
+	// LeftDropKeys drops the left fields used in the lookup values unless they are in LeftFields
+	LeftDropKeys bool `json:"leftDropKeys"`
+	// FieldAliases renames the fields of the lookup rows such as {"name": "deviceName"} to avoid the conflicts with the
+	// stream fields. The SQL refers to the aliases while the lookup source is queried by the original fields
+	FieldAliases map[string]string `json:"fieldAliases"`
+	// Transform is a list of select fields like "a, b * 2 AS c" to be applied to each lookup row before merging
+	Transform string `json:"transform"`
+	// EmitLatency attaches the lookup duration in milliseconds and whether the cache is hit to each lookup row
+	EmitLatency bool `json:"emitLatency"`
+	// EmitLatencyAs decides where to attach the latency, could be "meta"(default) or "field"
+	EmitLatencyAs string `json:"emitLatencyAs"`
+	// WindowSnapshot looks up all the rows of a window against one snapshot of the lookup source for consistency.
+	// The cache is bypassed in the snapshot. Sources which do not support snapshot ignore it
+	WindowSnapshot bool `json:"windowSnapshot"`
+	// SkipInvalidWindowElements skips the window elements which are not tuple rows and joins the rest of the window.
+	// By default, such an element fails the whole window
+	SkipInvalidWindowElements bool `json:"skipInvalidWindowElements"`
+	// EmitMatchedKey attaches the lookup key values which match each lookup row as a field for the join provenance.
+	// The value is a map of the lookup key to its value. In multi key mode, it is the key of the array element matched
+	EmitMatchedKey bool `json:"emitMatchedKey"`
+	// MatchedKeyName is the field name of the matched key, default to "lookupKey"
+	MatchedKeyName string `json:"matchedKeyName"`
+	// TagSource tags each joined row with the emitter of the input row, so that the rows from multiple upstream streams
+	// can be told apart downstream. If the input is a join result, the emitter of its first row is used
+	TagSource bool `json:"tagSource"`
+	// LatencyName and CacheHitName are the names of the attached values, default to "lookupLatency" and "lookupCacheHit"
+	LatencyName  string `json:"latencyName"`
+	CacheHitName string `json:"cacheHitName"`
+	// The options of the lookup source calls and the node routine, flattened in the conf
+	LookupRetryConf     `json:",squash"`
+	LookupBreakerConf   `json:",squash"`
+	LookupAsyncConf     `json:",squash"`
+	LookupHeartbeatConf `json:",squash"`
+	LookupIdleConf      `json:",squash"`
+	LookupProbeConf     `json:",squash"`
+	LookupDebugConf     `json:",squash"`
+}
+
+// applyConf validates the lookup conf and initializes the states derived from it
+func (n *LookupNode) applyConf(lookupConf *LookupConf) error {
+	if _, err := parseLookupTTL("cacheTtl", lookupConf.CacheTTL); err != nil {
+		return err
+	}
+	if _, err := parseLookupTTL("cacheMissingKeyTtl", lookupConf.CacheMissingKeyTTL); err != nil {
+		return err
+	}
+	if _, err := parseLookupTTL("cacheMaxStale", lookupConf.CacheMaxStale); err != nil {
+		return err
+	}
+	switch lookupConf.UnionStrategy {
+	case "", UnionFirstMatch, UnionAll:
+	default:
+		return fmt.Errorf("invalid lookup unionStrategy %s, must be %s or %s", lookupConf.UnionStrategy, UnionFirstMatch, UnionAll)
+	}
+	if lookupConf.CacheSize < 0 {
+		return fmt.Errorf("invalid lookup cacheSize %d, must not be negative", lookupConf.CacheSize)
+	}
+	if lookupConf.CacheMaxBytes < 0 {
+		return fmt.Errorf("invalid lookup cacheMaxBytes %d, must not be negative", lookupConf.CacheMaxBytes)
+	}
+	if lookupConf.CacheMaxValueBytes < 0 {
+		return fmt.Errorf("invalid lookup cacheMaxValueBytes %d, must not be negative", lookupConf.CacheMaxValueBytes)
+	}
+	if lookupConf.CacheCompressMinBytes < 0 {
+		return fmt.Errorf("invalid lookup cacheCompressMinBytes %d, must not be negative", lookupConf.CacheCompressMinBytes)
+	}
+	if lookupConf.CacheCompress != "" {
+		if _, err := compressor.GetCompressor(lookupConf.CacheCompress); err != nil {
+			return fmt.Errorf("invalid lookup cacheCompress %s: %v", lookupConf.CacheCompress, err)
+		}
+		if lookupConf.CacheCompressMinBytes == 0 {
+			lookupConf.CacheCompressMinBytes = DefaultCacheCompressMinBytes
+		}
+	}
+	if lookupConf.CacheMaxRows < 0 {
+		return fmt.Errorf("invalid lookup cacheMaxRows %d, must not be negative", lookupConf.CacheMaxRows)
+	}
+	if lookupConf.CacheNonEmptyOnly && lookupConf.CacheMissingKey {
+		return fmt.Errorf("lookup cacheNonEmptyOnly conflicts with cacheMissingKey")
+	}
+	if lookupConf.CacheBackend != "" && lookupConf.CacheBackend != cache.BackendMemory &&
+		(lookupConf.CacheSliding || lookupConf.CacheStaleWhileRevalidate || lookupConf.CacheHashKeys || lookupConf.CacheSize > 0 || lookupConf.CacheMaxBytes > 0 || lookupConf.CacheCompress != "" || lookupConf.CacheShared) {
+		return fmt.Errorf("invalid lookup cacheBackend %s, cacheSliding, cacheStaleWhileRevalidate, cacheHashKeys, cacheSize, cacheMaxBytes, cacheCompress and cacheShared are only supported by the %s backend", lookupConf.CacheBackend, cache.BackendMemory)
+	}
+	if lookupConf.MaxResultRows < 0 {
+		return fmt.Errorf("invalid lookup maxResultRows %d, must not be negative", lookupConf.MaxResultRows)
+	}
+	switch lookupConf.NullKeyPolicy {
+	case "", NullKeySkip, NullKeyError, NullKeyPass:
+	default:
+		return fmt.Errorf("invalid lookup nullKeyPolicy %s, must be %s, %s or %s", lookupConf.NullKeyPolicy, NullKeySkip, NullKeyError, NullKeyPass)
+	}
+	if lookupConf.RateLimit < 0 {
+		return fmt.Errorf("invalid lookup rateLimit %v, must not be negative", lookupConf.RateLimit)
+	}
+	if lookupConf.RateLimitMaxWait < 0 {
+		return fmt.Errorf("invalid lookup rateLimitMaxWait %d, must not be negative", lookupConf.RateLimitMaxWait)
+	}
+	switch lookupConf.RateLimitPolicy {
+	case "", RateLimitShed, RateLimitError:
+	default:
+		return fmt.Errorf("invalid lookup rateLimitPolicy %s, must be %s or %s", lookupConf.RateLimitPolicy, RateLimitShed, RateLimitError)
+	}
+	switch lookupConf.CacheSetPolicy {
+	case "", CacheSetLastWriteWins, CacheSetFirstWriteWins:
+	default:
+		return fmt.Errorf("invalid lookup cacheSetPolicy %s, must be %s or %s", lookupConf.CacheSetPolicy, CacheSetLastWriteWins, CacheSetFirstWriteWins)
+	}
+	switch lookupConf.CacheOnChange {
+	case "", CacheOnChangeInvalidate, CacheOnChangeRefresh:
+	default:
+		return fmt.Errorf("invalid lookup cacheOnChange %s, must be %s or %s", lookupConf.CacheOnChange, CacheOnChangeInvalidate, CacheOnChangeRefresh)
+	}
+	switch lookupConf.WindowSummary {
+	case "", SummaryAppend, SummaryOnly:
+	default:
+		return fmt.Errorf("invalid lookup windowSummary %s, must be %s or %s", lookupConf.WindowSummary, SummaryAppend, SummaryOnly)
+	}
+	for _, f := range lookupConf.WindowSummaryFields {
+		switch f {
+		case SummaryRows, SummaryMatched, SummaryMissed, SummaryResults, SummaryAvgFanout, SummaryWindowStart, SummaryWindowEnd:
+		default:
+			return fmt.Errorf("invalid lookup windowSummaryFields %s, must be %s, %s, %s, %s, %s, %s or %s", f, SummaryRows, SummaryMatched, SummaryMissed, SummaryResults, SummaryAvgFanout, SummaryWindowStart, SummaryWindowEnd)
+		}
+	}
+	switch lookupConf.MultiKey {
+	case "", MultiKeyAny, MultiKeyAll:
+	default:
+		return fmt.Errorf("invalid lookup multiKey %s, must be %s or %s", lookupConf.MultiKey, MultiKeyAny, MultiKeyAll)
+	}
+	switch lookupConf.SortOrder {
+	case "", SortAsc, SortDesc:
+	default:
+		return fmt.Errorf("invalid lookup sortOrder %s, must be %s or %s", lookupConf.SortOrder, SortAsc, SortDesc)
+	}
+	switch lookupConf.OverLimitPolicy {
+	case "", OverLimitTruncate, OverLimitError:
+	default:
+		return fmt.Errorf("invalid lookup overLimitPolicy %s, must be %s or %s", lookupConf.OverLimitPolicy, OverLimitTruncate, OverLimitError)
+	}
+	if lookupConf.BroadcastTimeout < 0 {
+		return fmt.Errorf("invalid lookup broadcastTimeout %d, must not be negative", lookupConf.BroadcastTimeout)
+	}
+	if lookupConf.BufferLength < 0 {
+		return fmt.Errorf("invalid lookup bufferLength %d, must not be negative", lookupConf.BufferLength)
+	}
+	switch lookupConf.EmitLatencyAs {
+	case "", EmitAsMeta, EmitAsField:
+	default:
+		return fmt.Errorf("invalid lookup emitLatencyAs %s, must be %s or %s", lookupConf.EmitLatencyAs, EmitAsMeta, EmitAsField)
+	}
+	if err := lookupConf.LookupRetryConf.validate(); err != nil {
+		return err
+	}
+	if err := lookupConf.LookupBreakerConf.validate(lookupConf.Cache); err != nil {
+		return err
+	}
+	if err := lookupConf.LookupAsyncConf.validate(); err != nil {
+		return err
+	}
+	if err := lookupConf.LookupHeartbeatConf.validate(); err != nil {
+		return err
+	}
+	if err := lookupConf.LookupIdleConf.validate(); err != nil {
+		return err
+	}
+	if err := lookupConf.LookupProbeConf.validate(n.keys); err != nil {
+		return err
+	}
+	sampler, err := lookupConf.LookupDebugConf.sampler()
+	if err != nil {
+		return err
+	}
+	n.sampler = sampler
+	n.leftCols = nil
+	if len(lookupConf.LeftFields) > 0 {
+		n.leftCols = n.leftColumns(lookupConf.LeftFields, lookupConf.LeftDropKeys)
+	}
+	if err := n.applyFieldAliases(lookupConf.FieldAliases); err != nil {
+		return err
+	}
+	if lookupConf.EmitMatchedKey && lookupConf.MatchedKeyName == "" {
+		lookupConf.MatchedKeyName = DefaultMatchedKeyName
+	}
+	if lookupConf.EmitLatency {
+		if lookupConf.LatencyName == "" {
+			lookupConf.LatencyName = DefaultLatencyName
+		}
+		if lookupConf.CacheHitName == "" {
+			lookupConf.CacheHitName = DefaultCacheHitName
+		}
+		if lookupConf.LatencyName == lookupConf.CacheHitName {
+			return fmt.Errorf("invalid lookup latencyName and cacheHitName, must not be the same %s", lookupConf.LatencyName)
+		}
+		if lookupConf.EmitMatchedKey && lookupConf.EmitLatencyAs == EmitAsField && (lookupConf.MatchedKeyName == lookupConf.LatencyName || lookupConf.MatchedKeyName == lookupConf.CacheHitName) {
+			return fmt.Errorf("invalid lookup matchedKeyName %s, must not be the same as latencyName or cacheHitName", lookupConf.MatchedKeyName)
+		}
+	}
+	if lookupConf.Transform != "" {
+		tf, err := parseLookupTransform(lookupConf.Transform)
+		if err != nil {
+			return err
+		}
+		n.transformFields = tf
+	}
+	if lookupConf.ResultFilter != "" {
+		rf, err := parseLookupResultFilter(lookupConf.ResultFilter)
+		if err != nil {
+			return err
+		}
+		n.resultFilter = rf
+	}
+	if lookupConf.CachePreloadFilter != "" {
+		pf, err := parseLookupPreloadFilter(lookupConf.CachePreloadFilter)
+		if err != nil {
+			return err
+		}
+		n.preloadFilter = pf
+	}
+	if lookupConf.CachePreload {
+		switch {
+		case len(lookupConf.UnionTables) > 0:
+			return fmt.Errorf("lookup cachePreload conflicts with unionTables")
+		case lookupConf.FieldsExpr != "":
+			return fmt.Errorf("lookup cachePreload conflicts with fieldsExpr")
+		case lookupConf.Temporal:
+			return fmt.Errorf("lookup cachePreload conflicts with temporal")
+		}
+	}
+	if lookupConf.TemporalBucket < 0 {
+		return fmt.Errorf("invalid lookup temporalBucket %d, must not be negative", lookupConf.TemporalBucket)
+	}
+	if lookupConf.FieldsExpr != "" {
+		if lookupConf.CacheShared {
+			return fmt.Errorf("lookup fieldsExpr conflicts with cacheShared")
+		}
+		fe, err := parseLookupFieldsExpr(lookupConf.FieldsExpr)
+		if err != nil {
+			return err
+		}
+		n.fieldsExpr = fe
+	}
+	n.conf = lookupConf
+	return nil
+}
+
+// parseLookupTTL parses the ttl option of the given name which can be an integer in seconds or a duration string
+func parseLookupTTL(name string, v interface{}) (time.Duration, error) {
+	var ttl time.Duration
+	switch tv := v.(type) {
+	case nil:
+		return 0, nil
+	case string:
+		if i, err := strconv.Atoi(tv); err == nil {
+			ttl = time.Duration(i) * time.Second
+		} else {
+			d, err := time.ParseDuration(tv)
+			if err != nil {
+				return 0, fmt.Errorf("invalid lookup %s %s, must be an integer in seconds or a duration string like 30s", name, tv)
+			}
+			ttl = d
+		}
+	default:
+		i, err := cast.ToInt(v, cast.CONVERT_SAMEKIND)
+		if err != nil {
+			return 0, fmt.Errorf("invalid lookup %s %v, must be an integer in seconds or a duration string like 30s", name, v)
+		}
+		ttl = time.Duration(i) * time.Second
+	}
+	if ttl < 0 {
+		return 0, fmt.Errorf("invalid lookup %s %v, must not be negative", name, v)
+	}
+	return ttl, nil
+}
+
+func parseLookupTransform(transform string) (ast.Fields, error) {
+	stmt, err := xsql.NewParser(strings.NewReader("select " + transform + " from nonexist")).Parse()
+	if err != nil {
+		return nil, fmt.Errorf("invalid lookup transform %s: %v", transform, err)
+	}
+	return stmt.Fields, nil
+}
+
+func parseLookupResultFilter(filter string) (ast.Expr, error) {
+	stmt, err := xsql.NewParser(strings.NewReader("select * from nonexist where " + filter)).Parse()
+	if err != nil {
+		return nil, fmt.Errorf("invalid lookup resultFilter %s: %v", filter, err)
+	}
+	return stmt.Condition, nil
+}
+
+func parseLookupPreloadFilter(filter string) (ast.Expr, error) {
+	stmt, err := xsql.NewParser(strings.NewReader("select * from nonexist where " + filter)).Parse()
+	if err != nil {
+		return nil, fmt.Errorf("invalid lookup cachePreloadFilter %s: %v", filter, err)
+	}
+	return stmt.Condition, nil
+}
+
+func parseLookupFieldsExpr(expr string) (ast.Expr, error) {
+	stmt, err := xsql.NewParser(strings.NewReader("select " + expr + " from nonexist")).Parse()
+	if err != nil {
+		return nil, fmt.Errorf("invalid lookup fieldsExpr %s: %v", expr, err)
+	}
+	if len(stmt.Fields) != 1 {
+		return nil, fmt.Errorf("invalid lookup fieldsExpr %s: expect exactly one field expression but got %d", expr, len(stmt.Fields))
+	}
+	return stmt.Fields[0].Expr, nil
+}
@@ -0,0 +1,67 @@
+// Copyright 2023 EMQ Technologies Co., Ltd.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package node
+
+import (
+	"fmt"
+)
+
+const (
+	// DebugLookupValuesKey is the metadata key of the evaluated lookup values in debug mode
+	DebugLookupValuesKey = "lookupValues"
+	// DebugCacheKeyKey is the metadata key of the cache key in debug mode
+	DebugCacheKeyKey = "lookupCacheKey"
+)
+
+// LookupDebugConf is the options to debug the lookups of each event
+type LookupDebugConf struct {
+	// DebugSampleEvery logs the per event debug info for only 1 in every n events, 0 means no sampling
+	DebugSampleEvery int `json:"debugSampleEvery"`
+	// DebugSamplePerSecond logs the per event debug info for at most n events per second, 0 means no limit
+	DebugSamplePerSecond int `json:"debugSamplePerSecond"`
+	// DebugEmitKeys attaches the lookup values and cache key to the metadata of the lookup rows for debugging
+	DebugEmitKeys bool `json:"debugEmitKeys"`
+}
+
+// sampler returns the sampler of the per event debug logs
+func (c *LookupDebugConf) sampler() (*logSampler, error) {
+	return newLogSampler(c.DebugSampleEvery, c.DebugSamplePerSecond)
+}
+
+// debugf logs the per event debug info if the event is sampled
+func (n *LookupNode) debugf(format string, args ...interface{}) {
+	if n.sampled.Load() {
+		n.ctx.GetLogger().Debugf(format, args...)
+	}
+}
+
+// SetDebugSampling changes the sampling rate of the per event debug logs when running
+func (n *LookupNode) SetDebugSampling(every, perSecond int) error {
+	if n.sampler == nil {
+		return fmt.Errorf("lookup node %s is not initialized", n.name)
+	}
+	return n.sampler.Set(every, perSecond)
+}
+
+// debugMeta returns a copy of the metadata with the lookup values and cache key for debugging
+func (n *LookupNode) debugMeta(meta map[string]interface{}, cvs []interface{}) map[string]interface{} {
+	result := make(map[string]interface{}, len(meta)+2)
+	for k, v := range meta {
+		result[k] = v
+	}
+	result[DebugLookupValuesKey] = cvs
+	result[DebugCacheKeyKey] = cacheKey(cvs)
+	return result
+}
@@ -0,0 +1,183 @@
+// Copyright 2023 EMQ Technologies Co., Ltd.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package node
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// LookupError is the common interface of the errors reported by the lookup node.
+// Use errors.As with the concrete types to handle the different failures.
+type LookupError interface {
+	error
+	// LookupTable returns the name of the lookup table where the error happens
+	LookupTable() string
+}
+
+// LookupSourceError is reported when the lookup source fails to attach, detach or look up
+type LookupSourceError struct {
+	Table string
+	// Op is the failed operation like "detach". If empty, the message is the same as the source error
+	Op  string
+	Err error
+}
+
+func (e *LookupSourceError) Error() string {
+	if e.Op == "" {
+		return e.Err.Error()
+	}
+	return fmt.Sprintf("%s lookup source %s error: %v", e.Op, e.Table, e.Err)
+}
+
+func (e *LookupSourceError) Unwrap() error {
+	return e.Err
+}
+
+func (e *LookupSourceError) LookupTable() string {
+	return e.Table
+}
+
+// LookupTimeoutError is reported when the lookup source times out
+type LookupTimeoutError struct {
+	Table string
+	Err   error
+}
+
+func (e *LookupTimeoutError) Error() string {
+	return e.Err.Error()
+}
+
+func (e *LookupTimeoutError) Unwrap() error {
+	return e.Err
+}
+
+func (e *LookupTimeoutError) LookupTable() string {
+	return e.Table
+}
+
+// InvalidInputError is reported when the input of the lookup node is not supported
+type InvalidInputError struct {
+	Table string
+	Msg   string
+}
+
+func (e *InvalidInputError) Error() string {
+	return e.Msg
+}
+
+func (e *InvalidInputError) LookupTable() string {
+	return e.Table
+}
+
+// LookupResultError is reported when the lookup result is invalid such as exceeding the max rows or missing fields
+type LookupResultError struct {
+	Table string
+	Msg   string
+}
+
+func (e *LookupResultError) Error() string {
+	return e.Msg
+}
+
+func (e *LookupResultError) LookupTable() string {
+	return e.Table
+}
+
+// LookupThrottledError is reported when the lookup source call exceeds the rate limit with the error policy
+type LookupThrottledError struct {
+	Table string
+	// Wait is the duration needed to wait for the rate limit
+	Wait time.Duration
+}
+
+func (e *LookupThrottledError) Error() string {
+	return fmt.Sprintf("lookup %s is throttled, need to wait %v for the rate limit", e.Table, e.Wait)
+}
+
+func (e *LookupThrottledError) LookupTable() string {
+	return e.Table
+}
+
+// LookupCircuitOpenError is reported when the lookup is rejected because the circuit breaker of the lookup source is
+// open after the consecutive failures
+type LookupCircuitOpenError struct {
+	Table string
+}
+
+func (e *LookupCircuitOpenError) Error() string {
+	return fmt.Sprintf("lookup %s is rejected, the circuit breaker is open after consecutive failures", e.Table)
+}
+
+func (e *LookupCircuitOpenError) LookupTable() string {
+	return e.Table
+}
+
+// newLookupSourceError classifies the error returned by the lookup source
+func newLookupSourceError(table string, err error) LookupError {
+	if isTimeout(err) {
+		return &LookupTimeoutError{Table: table, Err: err}
+	}
+	return &LookupSourceError{Table: table, Err: err}
+}
+
+func isTimeout(err error) bool {
+	if errors.Is(err, context.DeadlineExceeded) {
+		return true
+	}
+	var te interface{ Timeout() bool }
+	return errors.As(err, &te) && te.Timeout()
+}
+
+// keyedError carries the lookup values of a failed lookup to the error row. It is unwrapped before emitting
+type keyedError struct {
+	err  error
+	keys []interface{}
+}
+
+func (e *keyedError) Error() string {
+	return e.err.Error()
+}
+
+func (e *keyedError) Unwrap() error {
+	return e.err
+}
+
+// lookupErrorType returns the kind of the lookup error in the error rows
+func lookupErrorType(err error) string {
+	var (
+		te *LookupTimeoutError
+		se *LookupSourceError
+		ie *InvalidInputError
+		re *LookupResultError
+		le *LookupThrottledError
+	)
+	switch {
+	case errors.As(err, &te):
+		return "timeout"
+	case errors.As(err, &se):
+		return "source"
+	case errors.As(err, &ie):
+		return "invalidInput"
+	case errors.As(err, &re):
+		return "result"
+	case errors.As(err, &le):
+		return "throttled"
+	default:
+		return "unknown"
+	}
+}
@@ -0,0 +1,47 @@
+// Copyright 2023 EMQ Technologies Co., Ltd.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package node
+
+import (
+	"reflect"
+	"sync"
+
+	"github.com/lf-edge/ekuiper/internal/xsql"
+)
+
+// LookupInputExtractor converts a custom input of the lookup node such as a raw payload to a row to look up
+type LookupInputExtractor func(input interface{}) (xsql.TupleRow, error)
+
+var (
+	lookupExtractors    = make(map[reflect.Type]LookupInputExtractor)
+	lookupExtractorLock = &sync.RWMutex{}
+)
+
+// RegisterLookupInputExtractor registers the extractor for the inputs of the same type as the sample. The later
+// registration of the same type overrides the former one. The built-in inputs, which are xsql.TupleRow and
+// *xsql.WindowTuples, are always handled by the lookup node itself.
+func RegisterLookupInputExtractor(sample interface{}, extractor LookupInputExtractor) {
+	lookupExtractorLock.Lock()
+	defer lookupExtractorLock.Unlock()
+	lookupExtractors[reflect.TypeOf(sample)] = extractor
+}
+
+// getLookupInputExtractor returns the registered extractor of the input type
+func getLookupInputExtractor(input interface{}) (LookupInputExtractor, bool) {
+	lookupExtractorLock.RLock()
+	defer lookupExtractorLock.RUnlock()
+	e, ok := lookupExtractors[reflect.TypeOf(input)]
+	return e, ok
+}
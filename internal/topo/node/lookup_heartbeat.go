@@ -0,0 +1,74 @@
+// Copyright 2023 EMQ Technologies Co., Ltd.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package node
+
+import (
+	"fmt"
+
+	"github.com/lf-edge/ekuiper/internal/conf"
+	"github.com/lf-edge/ekuiper/internal/xsql"
+)
+
+// LookupHeartbeatConf is the options to send the heartbeat watermarks when there is no input
+type LookupHeartbeatConf struct {
+	// HeartbeatInterval is the interval in milliseconds to send a watermark when there is no input, 0 means disabled.
+	// The watermark is the processing time, so it is not supported in event time rules
+	HeartbeatInterval int `json:"heartbeatInterval"`
+}
+
+// validate checks the heartbeat interval
+func (c *LookupHeartbeatConf) validate() error {
+	if c.HeartbeatInterval < 0 {
+		return fmt.Errorf("invalid lookup heartbeatInterval %d, must not be negative", c.HeartbeatInterval)
+	}
+	return nil
+}
+
+// lookupHeartbeat tracks the inputs to send the processing time as the watermark when there is no input in an
+// interval, so that the downstream time based operators can advance. All the methods must be called in the node routine
+type lookupHeartbeat struct {
+	// idle is true if there is no input since the last tick
+	idle          bool
+	lastWatermark int64
+}
+
+// active records an input
+func (h *lookupHeartbeat) active() {
+	h.idle = false
+}
+
+// forward records the watermark input so that the heartbeat watermark never goes back
+func (h *lookupHeartbeat) forward(w *xsql.WatermarkTuple) {
+	if w.GetTimestamp() > h.lastWatermark {
+		h.lastWatermark = w.GetTimestamp()
+	}
+}
+
+// due returns whether the heartbeat is sent at the tick which is when there is no input since the last tick
+func (h *lookupHeartbeat) due() bool {
+	due := h.idle
+	h.idle = true
+	return due
+}
+
+// watermark returns the heartbeat watermark of the processing time, nil if it does not advance the last watermark
+func (h *lookupHeartbeat) watermark() *xsql.WatermarkTuple {
+	now := conf.GetNowInMilli()
+	if now <= h.lastWatermark {
+		return nil
+	}
+	h.lastWatermark = now
+	return &xsql.WatermarkTuple{Timestamp: now}
+}
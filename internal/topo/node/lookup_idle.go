@@ -0,0 +1,118 @@
+// Copyright 2023 EMQ Technologies Co., Ltd.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package node
+
+import (
+	"fmt"
+
+	"github.com/lf-edge/ekuiper/internal/conf"
+	"github.com/lf-edge/ekuiper/internal/topo/lookup"
+	"github.com/lf-edge/ekuiper/pkg/api"
+)
+
+const (
+	// DetachErrorIgnore logs the detach error of the lookup source and ignores it
+	DetachErrorIgnore = "ignore"
+	// DetachErrorFail reports the detach error of the lookup source as a rule error
+	DetachErrorFail = "fail"
+)
+
+// LookupIdleConf is the options to detach the lookup tables
+type LookupIdleConf struct {
+	// IdleTimeout is the time in milliseconds without input to detach the lookup tables so that the lookup sources can
+	// release the idle resources such as the connections. The tables are attached again by the next input. 0 means never
+	IdleTimeout int `json:"idleTimeout"`
+	// DetachErrorPolicy decides how to handle the error when detaching the lookup source on close, could be "ignore"(default) or "fail"
+	DetachErrorPolicy string `json:"detachErrorPolicy"`
+}
+
+// validate checks the idle timeout and the detach error policy
+func (c *LookupIdleConf) validate() error {
+	switch c.DetachErrorPolicy {
+	case "", DetachErrorIgnore, DetachErrorFail:
+	default:
+		return fmt.Errorf("invalid lookup detachErrorPolicy %s, must be %s or %s", c.DetachErrorPolicy, DetachErrorIgnore, DetachErrorFail)
+	}
+	if c.IdleTimeout < 0 {
+		return fmt.Errorf("invalid lookup idleTimeout %d, must not be negative", c.IdleTimeout)
+	}
+	return nil
+}
+
+// lookupTables attaches the joined table and the union tables as one lookup source. The tables are detached after
+// idle for the idle timeout and attached again by the next input. All the methods must be called in the node routine
+type lookupTables struct {
+	tables   []string
+	strategy string
+	sources  []api.LookupSource
+	// ns is the lookup source of the attached tables, nil if detached
+	ns          api.LookupSource
+	idleTimeout int64
+	lastActive  int64
+}
+
+func newLookupTables(name string, c *LookupConf) *lookupTables {
+	tables := append([]string{name}, c.UnionTables...)
+	return &lookupTables{
+		tables:      tables,
+		strategy:    c.UnionStrategy,
+		sources:     make([]api.LookupSource, 0, len(tables)),
+		idleTimeout: int64(c.IdleTimeout),
+		lastActive:  conf.GetNowInMilli(),
+	}
+}
+
+// attach attaches the detached tables if any
+func (t *lookupTables) attach() error {
+	if len(t.sources) == len(t.tables) {
+		return nil
+	}
+	for _, table := range t.tables[len(t.sources):] {
+		s, err := lookup.Attach(table)
+		if err != nil {
+			return &LookupSourceError{Table: table, Err: err}
+		}
+		t.sources = append(t.sources, s)
+	}
+	if len(t.sources) == 1 {
+		t.ns = t.sources[0]
+	} else {
+		t.ns = &unionLookupSource{sources: t.sources, strategy: t.strategy}
+	}
+	return nil
+}
+
+// detach detaches all the attached tables and returns the first error
+func (t *lookupTables) detach() error {
+	var err error
+	for _, table := range t.tables[:len(t.sources)] {
+		if de := lookup.Detach(table); de != nil && err == nil {
+			err = &LookupSourceError{Table: table, Op: "detach", Err: de}
+		}
+	}
+	t.sources = t.sources[:0]
+	t.ns = nil
+	return err
+}
+
+// touch records the input which keeps the tables attached
+func (t *lookupTables) touch() {
+	t.lastActive = conf.GetNowInMilli()
+}
+
+// idle returns whether the tables are attached and have no input for the idle timeout
+func (t *lookupTables) idle() bool {
+	return len(t.sources) > 0 && conf.GetNowInMilli()-t.lastActive >= t.idleTimeout
+}
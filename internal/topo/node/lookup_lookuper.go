@@ -0,0 +1,156 @@
+// Copyright 2023 EMQ Technologies Co., Ltd.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package node
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/lf-edge/ekuiper/internal/xsql"
+	"github.com/lf-edge/ekuiper/pkg/api"
+)
+
+// lookuper is the common lookup method of the lookup source and the lookup snapshot
+type lookuper interface {
+	Lookup(ctx api.StreamContext, fields []string, keys []string, values []interface{}) ([]api.SourceTuple, error)
+}
+
+// rowLookuper returns the lookup source to look up the row, which looks up the fields evaluated by fieldsExpr if set
+// and the rows valid at the timestamp of the row in temporal mode
+func (n *LookupNode) rowLookuper(d xsql.TupleRow, ns api.LookupSource, fv *xsql.FunctionValuer, afv *xsql.AggregateFunctionValuer) (lookuper, error) {
+	lk := n.asOfLookuper(ns, d)
+	if n.fieldsExpr == nil {
+		return lk, nil
+	}
+	var fields []string
+	switch v := n.valuerEval(d, nil, fv, afv).Eval(n.fieldsExpr).(type) {
+	case nil:
+	case error:
+		return nil, &InvalidInputError{Table: n.name, Msg: fmt.Sprintf("evaluate lookup fieldsExpr of %s error: %v", n.name, v)}
+	case string:
+		for _, f := range strings.Split(v, ",") {
+			if f = strings.TrimSpace(f); f != "" {
+				fields = append(fields, f)
+			}
+		}
+	case []interface{}:
+		for _, e := range v {
+			f, ok := e.(string)
+			if !ok {
+				return nil, &InvalidInputError{Table: n.name, Msg: fmt.Sprintf("lookup fieldsExpr of %s must return an array of strings but got %v", n.name, v)}
+			}
+			fields = append(fields, f)
+		}
+	default:
+		return nil, &InvalidInputError{Table: n.name, Msg: fmt.Sprintf("lookup fieldsExpr of %s must return an array of strings but got %v", n.name, v)}
+	}
+	if len(fields) == 0 {
+		return lk, nil
+	}
+	return newFieldsLookuper(lk, fields), nil
+}
+
+// fieldsLookuper looks up the fields evaluated from the input row instead of the fields selected by the rule
+type fieldsLookuper struct {
+	lookuper
+	fields []string
+	// key is the sorted fields to distinguish the cached results of different fields
+	key string
+}
+
+func newFieldsLookuper(ns lookuper, fields []string) *fieldsLookuper {
+	sorted := make([]string, len(fields))
+	copy(sorted, fields)
+	sort.Strings(sorted)
+	return &fieldsLookuper{lookuper: ns, fields: fields, key: fmt.Sprintf("%v", sorted)}
+}
+
+func (l *fieldsLookuper) Lookup(ctx api.StreamContext, _ []string, keys []string, values []interface{}) ([]api.SourceTuple, error) {
+	return l.lookuper.Lookup(ctx, l.fields, keys, values)
+}
+
+// temporalLookuper looks up the rows valid at the time bucket of the input row
+type temporalLookuper struct {
+	lookuper
+	src  api.LookupTemporal
+	asOf time.Time
+	// key is the time bucket to distinguish the cached results of different times
+	key string
+}
+
+func (l *temporalLookuper) Lookup(ctx api.StreamContext, fields []string, keys []string, values []interface{}) ([]api.SourceTuple, error) {
+	return l.src.LookupAsOf(ctx, fields, keys, values, l.asOf)
+}
+
+// asOfLookuper returns the lookup source to look up the rows valid at the timestamp of the row in temporal mode.
+// It returns the source itself if not in temporal mode, or the source does not support temporal lookup, or the row
+// has no timestamp such as a joined row
+func (n *LookupNode) asOfLookuper(ns lookuper, d xsql.TupleRow) lookuper {
+	if !n.conf.Temporal {
+		return ns
+	}
+	src, ok := ns.(api.LookupTemporal)
+	if !ok {
+		return ns
+	}
+	e, ok := d.(xsql.Event)
+	if !ok {
+		return ns
+	}
+	ts := e.GetTimestamp()
+	if b := int64(n.conf.TemporalBucket); b > 0 {
+		ts -= ts % b
+	}
+	return &temporalLookuper{lookuper: ns, src: src, asOf: time.UnixMilli(ts), key: "@" + strconv.FormatInt(ts, 10)}
+}
+
+// unionLookupSource queries multiple lookup sources as one
+type unionLookupSource struct {
+	sources  []api.LookupSource
+	strategy string
+}
+
+func (u *unionLookupSource) Open(_ api.StreamContext) error {
+	return nil
+}
+
+func (u *unionLookupSource) Configure(_ string, _ map[string]interface{}) error {
+	return nil
+}
+
+func (u *unionLookupSource) Lookup(ctx api.StreamContext, fields []string, keys []string, values []interface{}) ([]api.SourceTuple, error) {
+	var result []api.SourceTuple
+	for _, s := range u.sources {
+		r, err := s.Lookup(ctx, fields, keys, values)
+		if err != nil {
+			return nil, err
+		}
+		if len(r) > 0 {
+			if u.strategy != UnionAll {
+				return r, nil
+			}
+			result = append(result, r...)
+		}
+	}
+	return result, nil
+}
+
+// Close do nothing, the sources are managed by the lookup table instances
+func (u *unionLookupSource) Close(_ api.StreamContext) error {
+	return nil
+}
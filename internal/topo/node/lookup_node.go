@@ -15,9 +15,18 @@
 package node
 
 import (
+	"errors"
 	"fmt"
+	"math"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
 
+	"github.com/lf-edge/ekuiper/internal/binder/io"
 	"github.com/lf-edge/ekuiper/internal/conf"
+	"github.com/lf-edge/ekuiper/internal/io/memory/pubsub"
+	"github.com/lf-edge/ekuiper/internal/topo/checkpoint"
 	"github.com/lf-edge/ekuiper/internal/topo/lookup"
 	"github.com/lf-edge/ekuiper/internal/topo/lookup/cache"
 	nodeConf "github.com/lf-edge/ekuiper/internal/topo/node/conf"
@@ -29,24 +38,121 @@ import (
 	"github.com/lf-edge/ekuiper/pkg/infra"
 )
 
-type LookupConf struct {
-	Cache           bool `json:"cache"`
-	CacheTTL        int  `json:"cacheTtl"`
-	CacheMissingKey bool `json:"cacheMissingKey"`
-}
+// The fields of the error rows published to the error topic
+const (
+	ErrorRowTable = "table"
+	ErrorRowError = "error"
+	// ErrorRowType is the kind of the failure, see lookupErrorType
+	ErrorRowType = "errorType"
+	// ErrorRowKeys are the lookup values of the failed lookup, nil if the failure happens before evaluating them
+	ErrorRowKeys = "keys"
+	// ErrorRowRow is the stream row of a tuple input
+	ErrorRowRow = "row"
+	// ErrorRowRows are the stream rows of a window input
+	ErrorRowRows = "rows"
+)
+
+const (
+	// CacheHitsTotal and CacheMissesTotal count the lookups which hit or miss the cache, excluding the bypassed ones
+	CacheHitsTotal   = "cache_hits_total"
+	CacheMissesTotal = "cache_misses_total"
+	// CacheItems is the gauge of the count of the results in the memory cache
+	CacheItems = "cache_items"
+	// LeftJoinNoMatchTotal counts the left join rows emitted without any lookup result
+	LeftJoinNoMatchTotal = "left_join_no_match_total"
+	// TruncatedResultsTotal counts the lookup results which exceed the max result rows
+	TruncatedResultsTotal = "truncated_results_total"
+	// BroadcastShedTotal counts the results dropped because the downstream is not ready within the broadcast timeout
+	BroadcastShedTotal = "broadcast_shed_total"
+	// CacheSkippedTotal counts the lookup results not cached because of cacheNonEmptyOnly or cacheMaxRows
+	CacheSkippedTotal = "cache_skipped_total"
+	// CacheOversizedTotal counts the lookup results not cached because they exceed cacheMaxValueBytes
+	CacheOversizedTotal = "cache_oversized_total"
+	// CacheBypassTotal counts the lookups which bypass the cache because of the low hit ratio in adaptive cache mode
+	CacheBypassTotal = "cache_bypass_total"
+	// StaleServedTotal counts the cache hits of the stale results in stale while revalidate mode
+	StaleServedTotal = "stale_served_total"
+	// RefreshFailuresTotal counts the failed background refreshes of the stale results
+	RefreshFailuresTotal = "refresh_failures_total"
+	// SupersededTotal counts the lookups canceled and dropped because a newer event of the same key arrives
+	SupersededTotal = "superseded_total"
+	// CachedMisses is the gauge of the empty results in the cache when caching missing keys
+	CachedMisses = "cached_misses"
+	// CachedMissHitsTotal counts the cache hits of the cached empty results
+	CachedMissHitsTotal = "cached_miss_hits_total"
+	// ProbeHealthy is the gauge of the last probe result, 1 if succeeded and 0 if failed or not probed yet
+	ProbeHealthy = "probe_healthy"
+	// ProbeLatency is the gauge of the duration in milliseconds of the last probe
+	ProbeLatency = "probe_latency"
+	// ProbeFailuresTotal counts the failed probes
+	ProbeFailuresTotal = "probe_failures_total"
+	// ThrottledTotal counts the lookup source calls which wait for the rate limit
+	ThrottledTotal = "throttled_total"
+	// ThrottleRejectedTotal counts the lookup source calls which are shed or failed because of the rate limit
+	ThrottleRejectedTotal = "throttle_rejected_total"
+	// InvalidWindowElementsTotal counts the window elements skipped because they are not tuple rows
+	InvalidWindowElementsTotal = "invalid_window_elements_total"
+	// CacheEvictionsTotal counts the results evicted from the memory cache for the cache size or the memory budget
+	CacheEvictionsTotal = "cache_evictions_total"
+	// RetriesTotal counts the retried calls to the lookup source
+	RetriesTotal = "retries_total"
+	// RetryExhaustedTotal counts the lookups which still fail after all the retries
+	RetryExhaustedTotal = "retry_exhausted_total"
+	// CacheChangesTotal counts the changes notified by the lookup sources to update the cache
+	CacheChangesTotal = "cache_changes_total"
+	// BreakerOpensTotal counts the times the circuit breaker opens
+	BreakerOpensTotal = "breaker_opens_total"
+	// BreakerRejectedTotal counts the lookups rejected by the open circuit breaker
+	BreakerRejectedTotal = "breaker_rejected_total"
+)
 
 // LookupNode will look up the data from the external source when receiving an event
 type LookupNode struct {
 	*defaultSinkNode
 	statManager metric.StatManager
-	sourceType  string
-	joinType    ast.JoinType
-	vals        []ast.Expr
+	counters    *metric.CounterGroup
+	// tracer is nil if tracing is disabled
+	tracer     LookupTracer
+	sourceType string
+	joinType   ast.JoinType
+	vals       []ast.Expr
+	// inputRefs are the fields of the input rows referenced by the lookup values in strict input mode
+	inputRefs []*ast.FieldRef
 
 	srcOptions *ast.Options
 	conf       *LookupConf
 	fields     []string
 	keys       []string
+	// ranges are the range predicates whose values are at the tail of vals
+	ranges []api.LookupRange
+	// aggVals is true if the lookup values have aggregate functions
+	aggVals bool
+	// leftCols are the columns to pick from the left row, nil means all
+	leftCols [][]string
+	// transform fields parsed from conf.Transform
+	transformFields ast.Fields
+	resultFilter    ast.Expr
+	preloadFilter   ast.Expr
+	fieldsExpr      ast.Expr
+	// cacheLock guards the cache, its id and the counters which are set when running and read by the rest api
+	cacheLock sync.RWMutex
+	cache     *cache.Cache
+	// cacheId is the table name of the shared cache, empty if the cache is not shared
+	cacheId string
+	// handoffId identifies the own cache to be taken over by the same node with the same conf when the rule is updated
+	handoffId string
+	// bypass decides whether to bypass the cache in adaptive cache mode
+	bypass  *cacheBypass
+	limiter *lookup.Limiter
+	sampler *logSampler
+	// sampled is whether the current event is sampled to log the debug info
+	sampled atomic.Bool
+	// side is the side output to emit the left rows of inner join which have no joined result. Drop them if no output is attached
+	side *defaultNode
+	// summary is the output to emit the window summary tuples
+	summary *defaultNode
+	// breaker is nil if the circuit breaker is disabled
+	breaker *circuitBreaker
 }
 
 func NewLookupNode(name string, fields []string, keys []string, joinType ast.JoinType, vals []ast.Expr, srcOptions *ast.Options, options *api.RuleOption) (*LookupNode, error) {
@@ -54,8 +160,18 @@ func NewLookupNode(name string, fields []string, keys []string, joinType ast.Joi
 	if t == "" {
 		return nil, fmt.Errorf("source type is not specified")
 	}
+	if err := validateLookupSource(t); err != nil {
+		return nil, err
+	}
 	props := nodeConf.GetSourceConf(t, srcOptions)
 	lookupConf := &LookupConf{}
+	// The precedence is source props > engine defaults > hardcoded defaults
+	if conf.Config != nil && conf.Config.Lookup != nil {
+		err := cast.MapToStruct(conf.Config.Lookup, lookupConf)
+		if err != nil {
+			return nil, fmt.Errorf("invalid default lookup conf: %v", err)
+		}
+	}
 	if lc, ok := props["lookup"].(map[string]interface{}); ok {
 		err := cast.MapToStruct(lc, lookupConf)
 		if err != nil {
@@ -66,22 +182,102 @@ func NewLookupNode(name string, fields []string, keys []string, joinType ast.Joi
 		fields:     fields,
 		keys:       keys,
 		srcOptions: srcOptions,
-		conf:       lookupConf,
 		sourceType: t,
 		joinType:   joinType,
 		vals:       vals,
 	}
+	for _, v := range vals {
+		if xsql.HasAggFuncs(v) {
+			n.aggVals = true
+			break
+		}
+	}
+	err := n.applyConf(lookupConf)
+	if err != nil {
+		return nil, err
+	}
+	// the heartbeat watermark is the processing time, which would push the event time windows past the events in flight
+	if options.IsEventTime && lookupConf.HeartbeatInterval > 0 {
+		return nil, fmt.Errorf("lookup heartbeatInterval is not supported in event time rule")
+	}
+	bufferLength := options.BufferLength
+	if lookupConf.BufferLength > 0 {
+		bufferLength = lookupConf.BufferLength
+	}
 	n.defaultSinkNode = &defaultSinkNode{
-		input: make(chan interface{}, options.BufferLength),
+		input: make(chan interface{}, bufferLength),
 		defaultNode: &defaultNode{
 			outputs:   make(map[string]chan<- interface{}),
 			name:      name,
 			sendError: options.SendError,
 		},
 	}
+	n.side = &defaultNode{
+		outputs:   make(map[string]chan<- interface{}),
+		name:      name + "_miss",
+		sendError: options.SendError,
+	}
+	n.summary = &defaultNode{
+		outputs:   make(map[string]chan<- interface{}),
+		name:      name + "_summary",
+		sendError: options.SendError,
+	}
 	return n, nil
 }
 
+// GetSideEmitter returns the side output which emits the left rows of inner join without any joined result.
+// In planner graph, it is the second dim of the edges of the lookup join node
+func (n *LookupNode) GetSideEmitter() api.Emitter {
+	return n.side
+}
+
+// GetSummaryEmitter returns the output which emits the summary tuple of each window if windowSummary is set.
+// In planner graph, it is the third dim of the edges of the lookup join node
+func (n *LookupNode) GetSummaryEmitter() api.Emitter {
+	return n.summary
+}
+
+// SetQos sets the qos of the side outputs too
+func (n *LookupNode) SetQos(qos api.Qos) {
+	n.defaultNode.SetQos(qos)
+	if n.side != nil {
+		n.side.SetQos(qos)
+	}
+	if n.summary != nil {
+		n.summary.SetQos(qos)
+	}
+}
+
+// Broadcast forwards the checkpoint barriers to the side outputs too so that their downstream can complete the checkpoint
+func (n *LookupNode) Broadcast(val interface{}) error {
+	if _, ok := val.(*checkpoint.Barrier); ok {
+		if n.side != nil {
+			_ = n.side.Broadcast(val)
+		}
+		if n.summary != nil {
+			_ = n.summary.Broadcast(val)
+		}
+	}
+	return n.defaultNode.Broadcast(val)
+}
+
+// hasSideOutput returns whether the side output is attached so that the unmatched rows need to be emitted
+func (n *LookupNode) hasSideOutput() bool {
+	return n.joinType == ast.INNER_JOIN && n.side != nil && len(n.side.outputs) > 0
+}
+
+// validateLookupSource checks if the source type can be used as a lookup table to fail early at rule creation
+func validateLookupSource(sourceType string) error {
+	ls, err := io.LookupSource(sourceType)
+	if ls == nil {
+		if err != nil {
+			conf.Log.Debugf("find lookup source %s error: %v", sourceType, err)
+		}
+		return fmt.Errorf("source %s does not support lookup tables", sourceType)
+	}
+	return nil
+}
+
 func (n *LookupNode) Exec(ctx api.StreamContext, errCh chan<- error) {
 	n.ctx = ctx
 	log := ctx.GetLogger()
@@ -98,154 +294,881 @@ func (n *LookupNode) Exec(ctx api.StreamContext, errCh chan<- error) {
 	}
 	n.statManager = stats
 	n.statManagers = []metric.StatManager{stats}
+	if n.side != nil {
+		n.side.ctx = ctx
+		n.side.statManagers = n.statManagers
+	}
+	if n.summary != nil {
+		n.summary.ctx = ctx
+		n.summary.statManagers = n.statManagers
+	}
+	counters := metric.NewCounterGroup()
+	n.tracer = getLookupTracer()
+	if n.conf.StrictInput {
+		n.inputRefs = n.inputFieldRefs()
+	}
+	if n.joinType == ast.LEFT_JOIN {
+		counters.Register(LeftJoinNoMatchTotal)
+	}
+	if n.conf.BroadcastTimeout > 0 {
+		counters.Register(BroadcastShedTotal)
+	}
+	if n.conf.MaxResultRows > 0 {
+		counters.Register(TruncatedResultsTotal)
+	}
+	if n.conf.RateLimit > 0 {
+		counters.Register(ThrottledTotal, ThrottleRejectedTotal)
+	}
+	if n.conf.RetryCount > 0 {
+		counters.Register(RetriesTotal, RetryExhaustedTotal)
+	}
+	if n.conf.BreakerThreshold > 0 {
+		n.breaker = newCircuitBreaker(n.conf.BreakerThreshold, time.Duration(n.conf.BreakerCooldown)*time.Millisecond)
+		counters.Register(BreakerOpensTotal, BreakerRejectedTotal)
+	}
+	if n.conf.LatestWins {
+		counters.Register(SupersededTotal)
+	}
+	if n.conf.ProbeInterval > 0 {
+		counters.Register(ProbeHealthy, ProbeLatency, ProbeFailuresTotal)
+	}
+	if n.conf.SkipInvalidWindowElements {
+		counters.Register(InvalidWindowElementsTotal)
+	}
+	if n.conf.Cache {
+		if err := n.initCache(ctx, counters); err != nil {
+			infra.DrainError(ctx, err, errCh)
+			return
+		}
+	}
+	// the counters are published when all registered since the rest api reads them concurrently
+	n.setCounters(counters)
 	go func() {
 		err := infra.SafeRun(func() error {
-			ns, err := lookup.Attach(n.name)
+			return n.run(ctx)
+		})
+		if err != nil {
+			infra.DrainError(ctx, err, errCh)
+		}
+	}()
+}
+
+// run attaches the lookup tables and processes the inputs until the rule is stopped
+func (n *LookupNode) run(ctx api.StreamContext) (err error) {
+	log := ctx.GetLogger()
+	tables := newLookupTables(n.name, n.conf)
+	defer func() {
+		if de := tables.detach(); de != nil {
+			if n.conf.DetachErrorPolicy == DetachErrorFail {
+				if err == nil {
+					err = de
+				}
+			} else {
+				log.Warn(de)
+			}
+		}
+	}()
+	if n.conf.RateLimit > 0 {
+		// allow the calls of one second at once
+		burst := int(math.Ceil(n.conf.RateLimit))
+		if g := n.conf.RateLimitGroup; g != "" {
+			l, err := lookup.AcquireLimiter(g, n.conf.RateLimit, burst)
 			if err != nil {
 				return err
 			}
-			defer lookup.Detach(n.name)
-			fv, _ := xsql.NewFunctionValuersForOp(ctx)
-			var c *cache.Cache
-			if n.conf.Cache {
-				c = cache.NewCache(n.conf.CacheTTL, n.conf.CacheMissingKey)
-				defer c.Close()
+			defer lookup.ReleaseLimiter(g)
+			n.limiter = l
+		} else {
+			n.limiter = lookup.NewLimiter(n.conf.RateLimit, burst)
+		}
+	}
+	if err := tables.attach(); err != nil {
+		return err
+	}
+	if t := n.conf.ErrorTopic; t != "" {
+		pubsub.CreatePub(t)
+		defer pubsub.RemovePub(t)
+	}
+	fv, afv := xsql.NewFunctionValuersForOp(ctx)
+	c, cacheId := n.getCache()
+	if c != nil {
+		defer n.openCache(ctx, c, cacheId, tables, fv)()
+	}
+	var (
+		hb        = &lookupHeartbeat{idle: true}
+		async     = n.newAsync(ctx, fv)
+		asyncDone <-chan *asyncResult
+	)
+	if async != nil {
+		asyncDone = async.done
+	}
+	heartbeat, stopHeartbeat := lookupTicker(n.conf.HeartbeatInterval)
+	defer stopHeartbeat()
+	idleCheck, stopIdleCheck := lookupTicker(n.conf.IdleTimeout)
+	defer stopIdleCheck()
+	probe, stopProbe := lookupTicker(n.conf.ProbeInterval)
+	defer stopProbe()
+	// Start the lookup source loop
+	for {
+		n.debugf("LookupNode %s is looping", n.name)
+		select {
+		// process incoming item from both streams(transformed) and tables
+		case item, opened := <-n.input:
+			// the barriers and watermarks must not overtake the lookups in flight
+			if async != nil && isBarrier(item) && !async.await(0) {
+				return nil
 			}
-			// Start the lookup source loop
-			for {
-				log.Debugf("LookupNode %s is looping", n.name)
-				select {
-				// process incoming item from both streams(transformed) and tables
-				case item, opened := <-n.input:
-					processed := false
-					if item, processed = n.preprocess(item); processed {
-						break
-					}
-					n.statManager.IncTotalRecordsIn()
-					n.statManager.ProcessTimeStart()
-					if !opened {
-						n.statManager.IncTotalExceptions("input channel closed")
-						break
-					}
-					switch d := item.(type) {
-					case error:
-						_ = n.Broadcast(d)
-						n.statManager.IncTotalExceptions(d.Error())
-					case *xsql.WatermarkTuple:
-						_ = n.Broadcast(d)
-					case xsql.TupleRow:
-						log.Debugf("Lookup Node receive tuple input %s", d)
-						n.statManager.ProcessTimeStart()
-						sets := &xsql.JoinTuples{Content: make([]*xsql.JoinTuple, 0)}
-						err := n.lookup(ctx, d, fv, ns, sets, c)
-						if err != nil {
-							_ = n.Broadcast(err)
-							n.statManager.IncTotalExceptions(err.Error())
-						} else {
-							_ = n.Broadcast(sets)
-							n.statManager.IncTotalRecordsOut()
-						}
-						n.statManager.ProcessTimeEnd()
-						n.statManager.SetBufferLength(int64(len(n.input)))
-					case *xsql.WindowTuples:
-						log.Debugf("Lookup Node receive window input %s", d)
-						n.statManager.ProcessTimeStart()
-						sets := &xsql.JoinTuples{Content: make([]*xsql.JoinTuple, 0), WindowRange: item.(*xsql.WindowTuples).GetWindowRange()}
-						err := d.Range(func(i int, r xsql.ReadonlyRow) (bool, error) {
-							tr, ok := r.(xsql.TupleRow)
-							if !ok {
-								return false, fmt.Errorf("Invalid window element, must be a tuple row but got %v", r)
-							}
-							err := n.lookup(ctx, tr, fv, ns, sets, c)
-							if err != nil {
-								return false, err
-							}
-							return true, nil
-						})
-						if err != nil {
-							_ = n.Broadcast(err)
-							n.statManager.IncTotalExceptions(err.Error())
-						} else {
-							_ = n.Broadcast(sets)
-							n.statManager.IncTotalRecordsOut()
-						}
-						n.statManager.ProcessTimeEnd()
-						n.statManager.SetBufferLength(int64(len(n.input)))
-					default:
-						e := fmt.Errorf("run lookup node error: invalid input type but got %[1]T(%[1]v)", d)
-						_ = n.Broadcast(e)
-						n.statManager.IncTotalExceptions(e.Error())
-					}
-				case <-ctx.Done():
-					log.Infoln("Cancelling lookup node....")
+			// barriers are handled in preprocess and are not treated as data
+			processed := false
+			if item, processed = n.preprocess(item); processed {
+				break
+			}
+			hb.active()
+			tables.touch()
+			if err := tables.attach(); err != nil {
+				return err
+			}
+			n.sampled.Store(n.sampler.Sample())
+			n.statManager.IncTotalRecordsIn()
+			n.statManager.ProcessTimeStart()
+			if !opened {
+				n.statManager.IncTotalExceptions("input channel closed")
+				break
+			}
+			switch d := item.(type) {
+			case error:
+				if async != nil && !async.awaitOrdered() {
+					return nil
+				}
+				n.broadcast(d)
+				n.statManager.IncTotalExceptions(d.Error())
+			case *xsql.WatermarkTuple:
+				if async != nil && !async.await(0) {
+					return nil
+				}
+				hb.forward(d)
+				n.broadcast(d)
+			case xsql.TupleRow:
+				n.debugf("Lookup Node receive tuple input %s", d)
+				if !n.lookupRow(ctx, d, tables.ns, c, async, fv, afv) {
+					return nil
+				}
+			case *xsql.WindowTuples:
+				n.debugf("Lookup Node receive window input %s", d)
+				if !n.lookupWindowInput(ctx, d, tables.ns, c, async, fv, afv) {
+					return nil
+				}
+			default:
+				extract, ok := getLookupInputExtractor(d)
+				if !ok {
+					e := &InvalidInputError{Table: n.name, Msg: fmt.Sprintf("run lookup node error: invalid input type but got %[1]T(%[1]v)", d)}
+					n.broadcast(e)
+					n.statManager.IncTotalExceptions(e.Error())
+					break
+				}
+				row, err := extract(d)
+				if err != nil {
+					e := &InvalidInputError{Table: n.name, Msg: fmt.Sprintf("run lookup node error: fail to extract the input %[1]T(%[1]v): %[2]v", d, err)}
+					n.broadcast(e)
+					n.statManager.IncTotalExceptions(e.Error())
+					break
+				}
+				n.debugf("Lookup Node receive custom input %T extracted to %s", d, row)
+				if !n.lookupRow(ctx, row, tables.ns, c, async, fv, afv) {
 					return nil
 				}
 			}
+		case r := <-asyncDone:
+			async.complete(r)
+		case <-probe:
+			// the probe does not count as activity, so the tables are detached again by the next idle check
+			if err := tables.attach(); err != nil {
+				return err
+			}
+			n.probe(ctx, tables.ns)
+		case <-idleCheck:
+			if tables.idle() && (async == nil || async.inflight == 0) {
+				log.Infof("LookupNode %s detaches the lookup tables after idle for %d ms", n.name, n.conf.IdleTimeout)
+				if de := tables.detach(); de != nil {
+					log.Warn(de)
+				}
+			}
+		case <-heartbeat:
+			// Only send heartbeat when idle to let the downstream time based operators advance
+			if hb.due() {
+				if async != nil && !async.await(0) {
+					return nil
+				}
+				if w := hb.watermark(); w != nil {
+					n.broadcast(w)
+				}
+			}
+		case <-ctx.Done():
+			log.Infoln("Cancelling lookup node....")
+			return nil
+		}
+	}
+}
+
+// lookupRow looks up and emits a row input. In async mode, the lookup is dispatched and emitted when it completes.
+// It returns false if the rule is stopped
+func (n *LookupNode) lookupRow(ctx api.StreamContext, d xsql.TupleRow, ns api.LookupSource, c *cache.Cache, async *asyncLookups, fv *xsql.FunctionValuer, afv *xsql.AggregateFunctionValuer) bool {
+	n.statManager.ProcessTimeStart()
+	err := n.validateInput(d)
+	// ns may be changed by the idle detach after dispatching
+	var src lookuper
+	if err == nil {
+		src, err = n.rowLookuper(d, ns, fv, afv)
+	}
+	if err != nil {
+		if async != nil && !async.awaitOrdered() {
+			return false
+		}
+		n.emitTuple(d, &xsql.JoinTuples{Content: make([]*xsql.JoinTuple, 0)}, err)
+		n.statManager.ProcessTimeEnd()
+		return true
+	}
+	if n.conf.ExplodeField != "" {
+		rows := n.explode(d)
+		cvss := make([][]interface{}, len(rows))
+		for i, r := range rows {
+			cvss[i] = n.lookupValues(n.valuerEval(r, nil, fv, afv))
+		}
+		carrier := n.traceCarrier(d)
+		if async != nil {
+			return async.dispatch(&asyncResult{item: d, rows: rows}, func() ([]*lookupFetch, error) {
+				return n.traceFetch(ctx, carrier, func() ([]*lookupFetch, error) {
+					return n.fetchRows(ctx, src, cvss, c)
+				})
+			})
+		}
+		sets := &xsql.JoinTuples{Content: make([]*xsql.JoinTuple, 0)}
+		fs, err := n.traceFetch(ctx, carrier, func() ([]*lookupFetch, error) {
+			return n.fetchRows(ctx, src, cvss, c)
 		})
-		if err != nil {
-			infra.DrainError(ctx, err, errCh)
+		if err == nil {
+			_, err = n.joinWindow(ctx, rows, fs, fv, sets)
 		}
-	}()
+		n.emitTuple(d, sets, err)
+		n.statManager.ProcessTimeEnd()
+		n.statManager.SetBufferLength(int64(len(n.input)))
+		return true
+	}
+	if async != nil {
+		cvs, carrier := n.lookupValues(n.valuerEval(d, nil, fv, afv)), n.traceCarrier(d)
+		r, fctx := &asyncResult{item: d}, ctx
+		if n.conf.LatestWins {
+			fctx, r.cancel = ctx.WithCancel()
+			async.supersede(r, lookupCacheKey(src, cvs))
+		}
+		return async.dispatch(r, func() ([]*lookupFetch, error) {
+			return n.traceFetch(fctx, carrier, func() ([]*lookupFetch, error) {
+				f, err := n.fetchRow(fctx, src, cvs, c)
+				if err != nil {
+					return nil, err
+				}
+				return []*lookupFetch{f}, nil
+			})
+		})
+	}
+	sets := &xsql.JoinTuples{Content: make([]*xsql.JoinTuple, 0)}
+	err = n.lookup(ctx, d, n.valuerEval(d, nil, fv, afv), fv, src, sets, c)
+	n.emitTuple(d, sets, err)
+	n.statManager.ProcessTimeEnd()
+	n.statManager.SetBufferLength(int64(len(n.input)))
+	return true
+}
+
+// lookupTicker returns the channel of a ticker by the interval in milliseconds and the function to stop it.
+// The channel is nil and never fires if the interval is 0
+func lookupTicker(interval int) (<-chan time.Time, func()) {
+	if interval <= 0 {
+		return nil, func() {}
+	}
+	ticker := conf.GetTicker(int64(interval))
+	return ticker.C, ticker.Stop
+}
+
+// emitTuple sends out the join result of a tuple. The tuple is sent to the side output if it has no joined result
+func (n *LookupNode) emitTuple(d xsql.TupleRow, sets *xsql.JoinTuples, err error) {
+	if err != nil {
+		err = n.publishError(map[string]interface{}{ErrorRowRow: d.ToMap()}, err)
+		n.broadcast(err)
+		n.statManager.IncTotalExceptions(err.Error())
+		return
+	}
+	n.broadcast(sets)
+	n.statManager.IncTotalRecordsOut()
+	if len(sets.Content) == 0 && n.hasSideOutput() {
+		_ = n.side.Broadcast(d)
+	}
+}
+
+// publishError publishes the error row of a failed lookup to the error topic if set. The error row has the stream
+// row or rows of the input and the lookup values if known. It returns the error without the lookup values to emit
+func (n *LookupNode) publishError(data map[string]interface{}, err error) error {
+	var keys []interface{}
+	if ke, ok := err.(*keyedError); ok {
+		keys, err = ke.keys, ke.err
+	}
+	if n.conf.ErrorTopic == "" {
+		return err
+	}
+	data[ErrorRowTable] = n.name
+	data[ErrorRowError] = err.Error()
+	data[ErrorRowType] = lookupErrorType(err)
+	data[ErrorRowKeys] = keys
+	pubsub.Produce(n.ctx, n.conf.ErrorTopic, data)
+	return err
+}
+
+// withKeys attaches the lookup values to the error of a failed lookup for the error row if the error topic is set
+func (n *LookupNode) withKeys(err error, cvs []interface{}) error {
+	if n.conf.ErrorTopic == "" {
+		return err
+	}
+	return &keyedError{err: err, keys: cvs}
+}
+
+// broadcast sends out the result. If the broadcast timeout is set, it waits for the slow downstream until timeout
+// instead of dropping the result immediately to shed load in a controlled way.
+func (n *LookupNode) broadcast(val interface{}) {
+	if n.conf.BroadcastTimeout <= 0 {
+		_ = n.Broadcast(val)
+		return
+	}
+	if _, ok := val.(error); ok && !n.sendError {
+		return
+	}
+	for name, out := range n.outputs {
+		var data interface{} = val
+		if n.qos >= api.AtLeastOnce {
+			data = &checkpoint.BufferOrEvent{
+				Data:    val,
+				Channel: n.name,
+			}
+		}
+		select {
+		case out <- data:
+		default:
+			timer := conf.GetTimer(int64(n.conf.BroadcastTimeout))
+			select {
+			case out <- data:
+			case <-timer.C:
+				n.counters.Inc(BroadcastShedTotal)
+				n.statManager.IncTotalExceptions(fmt.Sprintf("broadcast timeout, drop message from %s to %s", n.name, name))
+			case <-n.ctx.Done():
+			}
+			timer.Stop()
+		}
+		switch vt := val.(type) {
+		case xsql.Collection:
+			val = vt.Clone()
+		case xsql.TupleRow:
+			val = vt.Clone()
+		}
+	}
+}
+
+// explode returns a copy of the row for each element of the explode field with the element replacing the array.
+// The row itself is returned if the field is not an array
+func (n *LookupNode) explode(d xsql.TupleRow) []xsql.TupleRow {
+	if n.conf.ExplodeField == "" {
+		return []xsql.TupleRow{d}
+	}
+	v, _ := d.Value(n.conf.ExplodeField, "")
+	var elems []interface{}
+	switch vt := v.(type) {
+	case nil:
+	case []interface{}:
+		elems = vt
+	default:
+		return []xsql.TupleRow{d}
+	}
+	if len(elems) == 0 {
+		elems = []interface{}{nil}
+	}
+	rows := make([]xsql.TupleRow, len(elems))
+	for i, e := range elems {
+		r := d.Clone().(xsql.TupleRow)
+		if t, ok := r.(*xsql.Tuple); ok {
+			// replace in the message so that the element is also found by the qualified field of the stream
+			msg := make(map[string]interface{}, len(t.Message))
+			for k, v := range t.Message {
+				msg[k] = v
+			}
+			msg[n.conf.ExplodeField] = e
+			t.Message = msg
+		} else {
+			r.Set(n.conf.ExplodeField, e)
+		}
+		rows[i] = r
+	}
+	return rows
+}
+
+// valuerEval returns the valuer to evaluate the lookup values of the row. If the values have aggregate functions,
+// they are calculated over the aggregate data which is the whole window for window input. If agg is nil, they are
+// calculated over the row itself
+func (n *LookupNode) valuerEval(d xsql.TupleRow, agg xsql.AggregateData, fv *xsql.FunctionValuer, afv *xsql.AggregateFunctionValuer) *xsql.ValuerEval {
+	if !n.aggVals {
+		return &xsql.ValuerEval{Valuer: xsql.MultiValuer(d, fv)}
+	}
+	if agg == nil {
+		agg = &xsql.WindowTuples{Content: []xsql.TupleRow{d}}
+	}
+	afv.SetData(agg)
+	return &xsql.ValuerEval{Valuer: xsql.MultiAggregateValuer(agg, fv, d, fv, afv, &xsql.WildcardValuer{Data: d})}
+}
+
+// lookupFetch is the lookup result of a row before joining
+type lookupFetch struct {
+	cvs []interface{}
+	r   []api.SourceTuple
+	hit bool
+	// failed is set if the lookup still fails after the retries and is handled by the retry failure policy
+	failed bool
+	// latency is the lookup duration in milliseconds
+	latency float64
 }
 
 // lookup will lookup the cache firstly, if expires, read the external source
-func (n *LookupNode) lookup(ctx api.StreamContext, d xsql.TupleRow, fv *xsql.FunctionValuer, ns api.LookupSource, tuples *xsql.JoinTuples, c *cache.Cache) error {
-	ve := &xsql.ValuerEval{Valuer: xsql.MultiValuer(d, fv)}
+func (n *LookupNode) lookup(ctx api.StreamContext, d xsql.TupleRow, ve *xsql.ValuerEval, fv *xsql.FunctionValuer, ns lookuper, tuples *xsql.JoinTuples, c *cache.Cache) error {
+	cvs := n.lookupValues(ve)
+	fs, err := n.traceFetch(ctx, n.traceCarrier(d), func() ([]*lookupFetch, error) {
+		f, err := n.fetchRow(ctx, ns, cvs, c)
+		if err != nil {
+			return nil, err
+		}
+		return []*lookupFetch{f}, nil
+	})
+	if err != nil {
+		return err
+	}
+	return n.join(ctx, d, fs[0], fv, tuples)
+}
+
+// lookupValues evaluates the lookup values of a row
+func (n *LookupNode) lookupValues(ve *xsql.ValuerEval) []interface{} {
 	cvs := make([]interface{}, len(n.vals))
-	hasNil := false
 	for i, val := range n.vals {
 		cvs[i] = ve.Eval(val)
-		if cvs[i] == nil {
-			hasNil = true
+	}
+	return cvs
+}
+
+// fetchRow reads the lookup result of the values from the cache or the lookup source.
+// It does not evaluate any expression so that it can run concurrently in async mode
+func (n *LookupNode) fetchRow(ctx api.StreamContext, ns lookuper, cvs []interface{}, c *cache.Cache) (*lookupFetch, error) {
+	var (
+		f     = &lookupFetch{cvs: cvs}
+		start = conf.GetNow()
+	)
+	// if any of the value is nil, the lookup will always return empty result by default
+	skip, e := n.skipNullKey(cvs)
+	if e != nil {
+		return nil, n.withKeys(e, cvs)
+	}
+	if !skip {
+		if n.conf.MultiKey != "" {
+			f.r, f.hit, e = n.multiLookup(ctx, ns, cvs, c)
+		} else {
+			f.r, f.hit, e = n.fetch(ctx, ns, cvs, c)
 		}
 	}
+	f.latency = float64(conf.GetNow().Sub(start)) / float64(time.Millisecond)
+	if e != nil {
+		var re *retriesExhaustedError
+		if errors.As(e, &re) {
+			f.r, f.failed = nil, true
+			return f, nil
+		}
+		if le, ok := e.(LookupError); ok {
+			return nil, n.withKeys(le, cvs)
+		}
+		return nil, n.withKeys(newLookupSourceError(n.name, e), cvs)
+	}
+	return f, nil
+}
+
+// join merges the row with its lookup result into the tuples
+func (n *LookupNode) join(ctx api.StreamContext, d xsql.TupleRow, f *lookupFetch, fv *xsql.FunctionValuer, tuples *xsql.JoinTuples) error {
 	var (
-		r  []api.SourceTuple
-		e  error
-		ok bool
+		r = f.r
+		e error
 	)
-	if !hasNil { // if any of the value is nil, the lookup will always return empty result
-		if c != nil {
-			k := fmt.Sprintf("%v", cvs)
-			r, ok = c.Get(k)
-			if !ok {
-				r, e = ns.Lookup(ctx, n.fields, n.keys, cvs)
-				if e != nil {
-					return e
+	if f.failed && n.conf.RetryFailurePolicy == RetryFailureDrop {
+		n.debugf("Lookup Node %s drops the failed tuple %s", n.name, d)
+		return nil
+	}
+	if n.resultFilter != nil && len(r) > 0 {
+		r = n.filterResult(r, n.resultFilter, fv)
+	}
+	if n.conf.SortField != "" && len(r) > 1 {
+		r = n.sortResult(r)
+	}
+	if n.conf.MaxResultRows > 0 && len(r) > n.conf.MaxResultRows {
+		n.counters.Inc(TruncatedResultsTotal)
+		if n.conf.OverLimitPolicy == OverLimitError {
+			return n.withKeys(&LookupResultError{Table: n.name, Msg: fmt.Sprintf("lookup result of %s has %d rows which exceeds the max result rows %d", n.name, len(r), n.conf.MaxResultRows)}, f.cvs)
+		}
+		ctx.GetLogger().Warnf("lookup result of %s has %d rows which exceeds the max result rows %d, truncated", n.name, len(r), n.conf.MaxResultRows)
+		r = r[:n.conf.MaxResultRows]
+	}
+	if len(r) == 0 && n.joinType != ast.LEFT_JOIN {
+		n.debugf("Lookup Node %s no result found for tuple %s", n.name, d)
+		return nil
+	}
+	left := n.leftRow(d)
+	var src string
+	if n.conf.TagSource {
+		src = sourceEmitter(d)
+	}
+	if len(r) == 0 {
+		merged := n.newJoinTuple(left, src)
+		tuples.Content = append(tuples.Content, merged)
+		n.counters.Inc(LeftJoinNoMatchTotal)
+	}
+	joined := false
+	for _, v := range r {
+		msg := v.Message()
+		if n.cacheId != "" && len(n.fields) > 0 {
+			msg = n.project(msg)
+		}
+		if n.conf.StrictFields {
+			msg, e = n.validateFields(msg)
+			if e != nil {
+				return n.withKeys(e, f.cvs)
+			}
+		}
+		if len(n.transformFields) > 0 {
+			msg, e = n.transform(msg, v.Meta(), fv)
+			if e != nil {
+				// Only drop the failed row so that the rest of the result is still merged
+				n.statManager.IncTotalExceptions(e.Error())
+				continue
+			}
+		}
+		if len(n.conf.FieldAliases) > 0 {
+			msg = n.aliasFields(msg)
+		}
+		if n.conf.EmitMatchedKey {
+			msg = n.matchedKeyAttached(msg, v, f.cvs)
+		}
+		meta := v.Meta()
+		if n.conf.DebugEmitKeys {
+			meta = n.debugMeta(meta, f.cvs)
+		}
+		if n.conf.EmitLatency {
+			msg, meta = n.latencyAttached(msg, meta, f.latency, f.hit)
+		}
+		merged := n.newJoinTuple(left, src)
+		t := &xsql.Tuple{
+			Emitter:   n.emitter(),
+			Message:   msg,
+			Metadata:  meta,
+			Timestamp: conf.GetNowInMilli(),
+		}
+		merged.AddTuple(t)
+		tuples.Content = append(tuples.Content, merged)
+		joined = true
+	}
+	// all the rows fail to transform, the left row of the left join is still emitted without the lookup fields
+	if !joined && len(r) > 0 && n.joinType == ast.LEFT_JOIN {
+		tuples.Content = append(tuples.Content, n.newJoinTuple(left, src))
+		n.counters.Inc(LeftJoinNoMatchTotal)
+	}
+	return nil
+}
+
+// newJoinTuple creates the join tuple of the input row which is tagged with the source emitter if enabled
+func (n *LookupNode) newJoinTuple(left xsql.TupleRow, src string) *xsql.JoinTuple {
+	merged := &xsql.JoinTuple{}
+	merged.AddTuple(left)
+	if n.conf.TagSource {
+		merged.Set(SourceTagName, src)
+	}
+	return merged
+}
+
+// sourceEmitter returns the emitter of the upstream stream of the input row
+func sourceEmitter(d xsql.TupleRow) string {
+	if jt, ok := d.(*xsql.JoinTuple); ok && len(jt.Tuples) > 0 {
+		return sourceEmitter(jt.Tuples[0])
+	}
+	return d.GetEmitter()
+}
+
+// inputFieldRefs collects the references of the input fields in the lookup values
+func (n *LookupNode) inputFieldRefs() []*ast.FieldRef {
+	var refs []*ast.FieldRef
+	for _, v := range n.vals {
+		ast.WalkFunc(v, func(node ast.Node) bool {
+			switch nt := node.(type) {
+			case *ast.Call:
+				// the args of the metadata functions are the metadata keys instead of the fields
+				if nt.Name == "meta" || nt.Name == "mqtt" {
+					return false
+				}
+			case *ast.FieldRef:
+				if !nt.IsAlias() {
+					refs = append(refs, nt)
 				}
-				c.Set(k, r)
 			}
-		} else {
-			r, e = ns.Lookup(ctx, n.fields, n.keys, cvs)
+			return true
+		})
+	}
+	return refs
+}
+
+// validateInput checks that the input row contains all the fields referenced by the lookup values in strict input mode
+func (n *LookupNode) validateInput(d xsql.TupleRow) error {
+	for _, f := range n.inputRefs {
+		var t string
+		if f.StreamName != ast.DefaultStream {
+			t = string(f.StreamName)
+		}
+		if _, ok := d.Value(f.Name, t); !ok {
+			return &InvalidInputError{Table: n.name, Msg: fmt.Sprintf("the input row of lookup %s misses the field %s referenced by the lookup values", n.name, f.Name)}
 		}
 	}
-	if e != nil {
-		return e
-	} else {
-		if len(r) == 0 {
-			if n.joinType == ast.LEFT_JOIN {
-				merged := &xsql.JoinTuple{}
-				merged.AddTuple(d)
-				tuples.Content = append(tuples.Content, merged)
+	return nil
+}
+
+// skipNullKey returns whether to skip the lookup because of the null values according to the null key policy
+func (n *LookupNode) skipNullKey(cvs []interface{}) (bool, error) {
+	for _, v := range cvs {
+		if v == nil {
+			switch n.conf.NullKeyPolicy {
+			case NullKeyError:
+				return true, &InvalidInputError{Table: n.name, Msg: fmt.Sprintf("lookup values %v of %s have null value", cvs, n.name)}
+			case NullKeyPass:
+				return false, nil
+			default:
+				return true, nil
+			}
+		}
+	}
+	return false, nil
+}
+
+// fetch looks up the values with the cache and retries the normalized values in fuzzy key mode
+func (n *LookupNode) fetch(ctx api.StreamContext, ns lookuper, cvs []interface{}, c *cache.Cache) ([]api.SourceTuple, bool, error) {
+	r, hit, e := n.cachedLookup(ctx, ns, cvs, c)
+	if e == nil && len(r) == 0 && n.conf.FuzzyKey {
+		if ncvs, changed := n.normalizeKeys(cvs); changed {
+			r, hit, e = n.cachedLookup(ctx, ns, ncvs, c)
+			if e == nil && c != nil && len(r) > 0 {
+				// cache the result for the original key too to avoid normalizing again
+				n.cacheResult(c, lookupCacheKey(ns, cvs), r)
+			}
+		}
+	}
+	return r, hit, e
+}
+
+// multiLookup looks up each key composed from the array lookup values and combines the results. It returns whether
+// all the keys hit the cache. In all mode, the result is empty if any key has no result so that the row goes to the miss path
+func (n *LookupNode) multiLookup(ctx api.StreamContext, ns lookuper, cvs []interface{}, c *cache.Cache) ([]api.SourceTuple, bool, error) {
+	keys, err := n.expandKeys(cvs)
+	if err != nil {
+		return nil, false, err
+	}
+	var result []api.SourceTuple
+	allHit := len(keys) > 0
+	for _, k := range keys {
+		skip, err := n.skipNullKey(k)
+		if err != nil {
+			return nil, false, err
+		}
+		var (
+			r   []api.SourceTuple
+			hit bool
+		)
+		if !skip {
+			r, hit, err = n.fetch(ctx, ns, k, c)
+			if err != nil {
+				return nil, false, err
+			}
+		}
+		if len(r) == 0 && n.conf.MultiKey == MultiKeyAll {
+			n.debugf("Lookup Node %s no result found for key %v, the whole row is missed", n.name, k)
+			return nil, false, nil
+		}
+		allHit = allHit && hit
+		if n.conf.EmitMatchedKey && len(keys) > 1 {
+			for _, t := range r {
+				result = append(result, &keyedTuple{SourceTuple: t, key: k})
+			}
+			continue
+		}
+		result = append(result, r...)
+	}
+	return result, allHit, nil
+}
+
+// expandKeys composes the keys from the array lookup values by index. The scalar values are shared by all the keys.
+// All the array values must have the same length
+func (n *LookupNode) expandKeys(cvs []interface{}) ([][]interface{}, error) {
+	size := -1
+	for _, v := range cvs {
+		if arr, ok := v.([]interface{}); ok {
+			if size >= 0 && len(arr) != size {
+				return nil, &InvalidInputError{Table: n.name, Msg: fmt.Sprintf("lookup values %v of %s have arrays of different lengths", cvs, n.name)}
+			}
+			size = len(arr)
+		}
+	}
+	if size < 0 {
+		return [][]interface{}{cvs}, nil
+	}
+	keys := make([][]interface{}, size)
+	for i := range keys {
+		key := make([]interface{}, len(cvs))
+		for j, v := range cvs {
+			if arr, ok := v.([]interface{}); ok {
+				key[j] = arr[i]
 			} else {
-				ctx.GetLogger().Debugf("Lookup Node %s no result found for tuple %s", n.name, d)
-				return nil
+				key[j] = v
 			}
 		}
-		for _, v := range r {
-			merged := &xsql.JoinTuple{}
-			merged.AddTuple(d)
-			t := &xsql.Tuple{
-				Emitter:   n.name,
-				Message:   v.Message(),
-				Metadata:  v.Meta(),
-				Timestamp: conf.GetNowInMilli(),
+		keys[i] = key
+	}
+	return keys, nil
+}
+
+// sourceLookup calls the lookup source under the rate limit. It returns true if the call is shed by the rate limit.
+// The prefetched values have been limited by the batch call
+func (n *LookupNode) sourceLookup(ctx api.StreamContext, ns lookuper, cvs []interface{}) ([]api.SourceTuple, bool, error) {
+	if b, ok := ns.(*batchLookuper); !ok || !b.prefetched(cvs) {
+		if shed, err := n.throttle(ctx, cvs); err != nil || shed {
+			return nil, shed, err
+		}
+	}
+	if n.breaker == nil {
+		r, e := n.retryLookup(ctx, ns, cvs)
+		return r, false, e
+	}
+	r, e := n.breakerLookup(ctx, ns, cvs)
+	return r, false, e
+}
+
+// throttle waits for the rate limit of a call to the lookup source of the values. It returns true if the call is shed
+func (n *LookupNode) throttle(ctx api.StreamContext, values interface{}) (bool, error) {
+	if n.limiter != nil {
+		wait, ok := n.limiter.Reserve(time.Duration(n.conf.RateLimitMaxWait) * time.Millisecond)
+		if !ok {
+			n.counters.Inc(ThrottleRejectedTotal)
+			if n.conf.RateLimitPolicy == RateLimitError {
+				return false, &LookupThrottledError{Table: n.name, Wait: wait}
+			}
+			n.debugf("LookupNode %s sheds the lookup of %v for the rate limit", n.name, values)
+			return true, nil
+		}
+		if wait > 0 {
+			n.counters.Inc(ThrottledTotal)
+			timer := conf.Clock.Timer(wait)
+			select {
+			case <-timer.C:
+			case <-ctx.Done():
+				timer.Stop()
+				return false, ctx.Err()
 			}
-			merged.AddTuple(t)
-			tuples.Content = append(tuples.Content, merged)
 		}
+	}
+	return false, nil
+}
+
+// sourceFields returns the fields to query from the lookup source
+func (n *LookupNode) sourceFields() []string {
+	if n.cacheId != "" {
+		// query the full rows to be reusable by the other rules
 		return nil
 	}
+	return n.fields
+}
+
+// emitter returns the emitter name of the lookup rows in the join output
+func (n *LookupNode) emitter() string {
+	if n.conf.Emitter != "" {
+		return n.conf.Emitter
+	}
+	return n.name
+}
+
+// ValidateEmitter checks that the overridden emitter does not collide with the names of the streams in the rule
+// which include the lookup table itself
+func (n *LookupNode) ValidateEmitter(streams []string) error {
+	e := n.emitter()
+	if e == n.name {
+		return nil
+	}
+	for _, s := range streams {
+		if s == e {
+			return fmt.Errorf("lookup emitter %s of %s collides with the stream %s in the rule", e, n.name, s)
+		}
+	}
+	return nil
+}
+
+// normalizeKeys returns the normalized string lookup values for fuzzy lookup and whether any value is changed
+func (n *LookupNode) normalizeKeys(cvs []interface{}) ([]interface{}, bool) {
+	changed := false
+	result := make([]interface{}, len(cvs))
+	for i, v := range cvs {
+		result[i] = v
+		sv, ok := v.(string)
+		if !ok {
+			continue
+		}
+		nv := strings.Join(strings.Fields(sv), " ")
+		for _, prefix := range n.conf.FuzzyKeyPrefixes {
+			if strings.HasPrefix(nv, prefix) {
+				nv = strings.TrimSpace(strings.TrimPrefix(nv, prefix))
+				break
+			}
+		}
+		if n.conf.FuzzyKeyIgnoreCase {
+			nv = strings.ToLower(nv)
+		}
+		if nv != sv {
+			result[i] = nv
+			changed = true
+		}
+	}
+	return result, changed
+}
+
+// GetExtraMetrics returns the lookup specific metrics
+func (n *LookupNode) GetExtraMetrics() ([]string, []interface{}) {
+	counters := n.getCounters()
+	if counters == nil {
+		return nil, nil
+	}
+	c, _ := n.getCache()
+	// the counter is only registered with cacheMissingKey which may be turned off at runtime
+	if c != nil {
+		counters.Set(CachedMisses, int64(c.MissCount()))
+	}
+	if c != nil && (n.conf.CacheBackend == "" || n.conf.CacheBackend == cache.BackendMemory) {
+		counters.Set(CacheItems, int64(c.Len()))
+		counters.Set(CacheEvictionsTotal, c.Evictions())
+	}
+	return counters.GetMetrics()
+}
+
+// setCounters publishes the counters of the running node after they are all registered
+func (n *LookupNode) setCounters(counters *metric.CounterGroup) {
+	n.cacheLock.Lock()
+	defer n.cacheLock.Unlock()
+	n.counters = counters
+}
+
+// getCounters returns the counters of the running node
+func (n *LookupNode) getCounters() *metric.CounterGroup {
+	n.cacheLock.RLock()
+	defer n.cacheLock.RUnlock()
+	return n.counters
 }
 
 func (n *LookupNode) merge(ctx api.StreamContext, d xsql.TupleRow, r []map[string]interface{}) {
@@ -15,8 +15,14 @@
 package node
 
 import (
+	"errors"
 	"fmt"
+	"os"
 	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 
@@ -25,12 +31,17 @@ import (
 	"github.com/lf-edge/ekuiper/internal/binder"
 	"github.com/lf-edge/ekuiper/internal/binder/io"
 	"github.com/lf-edge/ekuiper/internal/conf"
+	"github.com/lf-edge/ekuiper/internal/io/memory/pubsub"
 	"github.com/lf-edge/ekuiper/internal/plugin"
+	"github.com/lf-edge/ekuiper/internal/topo/checkpoint"
 	"github.com/lf-edge/ekuiper/internal/topo/context"
 	"github.com/lf-edge/ekuiper/internal/topo/lookup"
+	"github.com/lf-edge/ekuiper/internal/topo/lookup/cache"
+	"github.com/lf-edge/ekuiper/internal/topo/state"
 	"github.com/lf-edge/ekuiper/internal/xsql"
 	"github.com/lf-edge/ekuiper/pkg/api"
 	"github.com/lf-edge/ekuiper/pkg/ast"
+	"github.com/lf-edge/ekuiper/pkg/cast"
 )
 
 type mockLookupSrc struct {
@@ -59,6 +70,9 @@ func (m *mockLookupSrc) Lookup(_ api.StreamContext, fields []string, _ []string,
 		}
 	}
 	a1, ok := values[0].(int)
+	if i64, isInt64 := values[0].(int64); isInt64 { // aggregate results are int64
+		a1, ok = int(i64), true
+	}
 	if ok {
 		var result []api.SourceTuple
 		c := a1 % 2
@@ -105,6 +119,241 @@ func (m *mockLookupSrc) Close(_ api.StreamContext) error {
 	return nil
 }
 
+// mockSnapshotLookupSrc returns the current version which changes after every lookup to mock a changing table
+type mockSnapshotLookupSrc struct {
+	version int
+	closed  int
+}
+
+func (m *mockSnapshotLookupSrc) Open(_ api.StreamContext) error {
+	return nil
+}
+
+func (m *mockSnapshotLookupSrc) Configure(_ string, _ map[string]interface{}) error {
+	return nil
+}
+
+func (m *mockSnapshotLookupSrc) Lookup(_ api.StreamContext, _ []string, _ []string, _ []interface{}) ([]api.SourceTuple, error) {
+	m.version++
+	return []api.SourceTuple{api.NewDefaultSourceTuple(map[string]interface{}{"version": m.version}, nil)}, nil
+}
+
+func (m *mockSnapshotLookupSrc) Snapshot(_ api.StreamContext) (api.LookupSnapshot, error) {
+	m.version++
+	return &mockLookupSnapshot{src: m, version: m.version}, nil
+}
+
+func (m *mockSnapshotLookupSrc) Close(_ api.StreamContext) error {
+	return nil
+}
+
+type mockLookupSnapshot struct {
+	src     *mockSnapshotLookupSrc
+	version int
+}
+
+func (m *mockLookupSnapshot) Lookup(_ api.StreamContext, _ []string, _ []string, _ []interface{}) ([]api.SourceTuple, error) {
+	return []api.SourceTuple{api.NewDefaultSourceTuple(map[string]interface{}{"version": m.version}, nil)}, nil
+}
+
+func (m *mockLookupSnapshot) Close(_ api.StreamContext) error {
+	m.src.closed++
+	return nil
+}
+
+// mockNotifyLookupSrc notifies the changes to the subscribed handler which is triggered by the test
+type mockNotifyLookupSrc struct {
+	mockSnapshotLookupSrc
+	sync.Mutex
+	handler func(key string, value interface{})
+}
+
+func (m *mockNotifyLookupSrc) Subscribe(handler func(key string, value interface{})) func() {
+	m.Lock()
+	defer m.Unlock()
+	m.handler = handler
+	return func() {
+		m.Lock()
+		defer m.Unlock()
+		m.handler = nil
+	}
+}
+
+func (m *mockNotifyLookupSrc) notify(key string, value interface{}) {
+	m.Lock()
+	defer m.Unlock()
+	if m.handler != nil {
+		m.handler(key, value)
+	}
+}
+
+// mockIdleLookupSrc counts the releases of the idle resources
+type mockIdleLookupSrc struct {
+	mockSnapshotLookupSrc
+	released atomic.Int32
+}
+
+func (m *mockIdleLookupSrc) ReleaseIdle(_ api.StreamContext) error {
+	m.released.Add(1)
+	return nil
+}
+
+// mockBlockingLookupSrc blocks the first lookup until the context is canceled and returns the call order for the others
+type mockBlockingLookupSrc struct {
+	mockSnapshotLookupSrc
+	calls atomic.Int32
+}
+
+func (m *mockBlockingLookupSrc) Lookup(ctx api.StreamContext, _ []string, _ []string, _ []interface{}) ([]api.SourceTuple, error) {
+	c := m.calls.Add(1)
+	if c == 1 {
+		<-ctx.Done()
+		return nil, ctx.Err()
+	}
+	return []api.SourceTuple{api.NewDefaultSourceTuple(map[string]interface{}{"call": int(c)}, nil)}, nil
+}
+
+// mockFieldsLookupSrc returns a row with each looked up field set to its name
+type mockFieldsLookupSrc struct {
+	mockSnapshotLookupSrc
+	calls atomic.Int32
+}
+
+func (m *mockFieldsLookupSrc) Lookup(_ api.StreamContext, fields []string, _ []string, _ []interface{}) ([]api.SourceTuple, error) {
+	m.calls.Add(1)
+	msg := make(map[string]interface{}, len(fields))
+	for _, f := range fields {
+		msg[f] = f
+	}
+	return []api.SourceTuple{api.NewDefaultSourceTuple(msg, nil)}, nil
+}
+
+// mockBatchLookupSrc looks up the values in batch like the mock source and counts the calls
+type mockBatchLookupSrc struct {
+	mockLookupSrc
+	calls   atomic.Int32
+	batches atomic.Int32
+	sizes   []int
+}
+
+func (m *mockBatchLookupSrc) Lookup(ctx api.StreamContext, fields []string, keys []string, values []interface{}) ([]api.SourceTuple, error) {
+	m.calls.Add(1)
+	return m.mockLookupSrc.Lookup(ctx, fields, keys, values)
+}
+
+func (m *mockBatchLookupSrc) LookupBatch(ctx api.StreamContext, fields []string, keys []string, values [][]interface{}) ([][]api.SourceTuple, error) {
+	m.batches.Add(1)
+	m.sizes = append(m.sizes, len(values))
+	result := make([][]api.SourceTuple, len(values))
+	for i, v := range values {
+		result[i], _ = m.mockLookupSrc.Lookup(ctx, fields, keys, v)
+	}
+	return result, nil
+}
+
+// mockScanLookupSrc scans the fixed rows and counts the lookup calls
+type mockScanLookupSrc struct {
+	mockLookupSrc
+	calls atomic.Int32
+}
+
+func (m *mockScanLookupSrc) Lookup(ctx api.StreamContext, fields []string, keys []string, values []interface{}) ([]api.SourceTuple, error) {
+	m.calls.Add(1)
+	return m.mockLookupSrc.Lookup(ctx, fields, keys, values)
+}
+
+func (m *mockScanLookupSrc) Scan(_ api.StreamContext, _ []string) ([]api.SourceTuple, error) {
+	return []api.SourceTuple{
+		api.NewDefaultSourceTuple(map[string]interface{}{"a": 6, "newA": 60}, nil),
+		api.NewDefaultSourceTuple(map[string]interface{}{"a": 1, "newA": 10}, nil),
+		api.NewDefaultSourceTuple(map[string]interface{}{"a": 1, "newA": 11}, nil),
+		api.NewDefaultSourceTuple(map[string]interface{}{"a": nil, "newA": 0}, nil),
+	}, nil
+}
+
+// mockRangeLookupSrc filters the temperature bands by the ranges and records the ranges pushed down
+type mockRangeLookupSrc struct {
+	mockLookupSrc
+	calls  atomic.Int32
+	ranges []api.LookupRange
+}
+
+func (m *mockRangeLookupSrc) LookupRange(_ api.StreamContext, _ []string, keys []string, _ []interface{}, ranges []api.LookupRange) ([]api.SourceTuple, error) {
+	m.calls.Add(1)
+	if len(keys) > 0 {
+		return nil, fmt.Errorf("unexpected keys %v", keys)
+	}
+	m.ranges = ranges
+	var result []api.SourceTuple
+	for _, b := range []map[string]interface{}{{"low": 0, "high": 10, "name": "cold"}, {"low": 10, "high": 30, "name": "warm"}, {"low": 30, "high": 100, "name": "hot"}} {
+		matched := true
+		for _, r := range ranges {
+			f, v := b[r.Field].(int), r.Value.(int)
+			switch r.Op {
+			case "<":
+				matched = matched && f < v
+			case "<=":
+				matched = matched && f <= v
+			case ">":
+				matched = matched && f > v
+			case ">=":
+				matched = matched && f >= v
+			}
+		}
+		if matched {
+			result = append(result, api.NewDefaultSourceTuple(b, nil))
+		}
+	}
+	return result, nil
+}
+
+// mockFlakyLookupSrc fails the first lookups like a recovering source and then looks up like the mock source
+type mockFlakyLookupSrc struct {
+	mockLookupSrc
+	fails atomic.Int32
+}
+
+func (m *mockFlakyLookupSrc) Lookup(ctx api.StreamContext, fields []string, keys []string, values []interface{}) ([]api.SourceTuple, error) {
+	if m.fails.Add(-1) >= 0 {
+		return nil, errors.New("connection refused")
+	}
+	return m.mockLookupSrc.Lookup(ctx, fields, keys, values)
+}
+
+// mockDelayLookupSrc delays each lookup by the lookup value in milliseconds and records the max lookups at the same time
+type mockDelayLookupSrc struct {
+	mockSnapshotLookupSrc
+	inflight    atomic.Int32
+	maxInflight atomic.Int32
+}
+
+func (m *mockDelayLookupSrc) Lookup(_ api.StreamContext, _ []string, _ []string, values []interface{}) ([]api.SourceTuple, error) {
+	c := m.inflight.Add(1)
+	defer m.inflight.Add(-1)
+	for {
+		if mc := m.maxInflight.Load(); c <= mc || m.maxInflight.CompareAndSwap(mc, c) {
+			break
+		}
+	}
+	d, _ := cast.ToInt(values[0], cast.CONVERT_SAMEKIND)
+	time.Sleep(time.Duration(d) * time.Millisecond)
+	return []api.SourceTuple{api.NewDefaultSourceTuple(map[string]interface{}{"delay": d}, nil)}, nil
+}
+
+type mockTemporalLookupSrc struct {
+	mockSnapshotLookupSrc
+	calls atomic.Int32
+}
+
+func (m *mockTemporalLookupSrc) Lookup(_ api.StreamContext, _ []string, _ []string, _ []interface{}) ([]api.SourceTuple, error) {
+	return []api.SourceTuple{api.NewDefaultSourceTuple(map[string]interface{}{"version": "current"}, nil)}, nil
+}
+
+func (m *mockTemporalLookupSrc) LookupAsOf(_ api.StreamContext, _ []string, _ []string, _ []interface{}, asOf time.Time) ([]api.SourceTuple, error) {
+	m.calls.Add(1)
+	return []api.SourceTuple{api.NewDefaultSourceTuple(map[string]interface{}{"version": asOf.UnixMilli()}, nil)}, nil
+}
+
 type mockFac struct{}
 
 func (m *mockFac) Source(_ string) (api.Source, error) {
@@ -116,8 +365,31 @@ func (m *mockFac) SourcePluginInfo(_ string) (plugin.EXTENSION_TYPE, string, str
 }
 
 func (m *mockFac) LookupSource(name string) (api.LookupSource, error) {
-	if name == "mock" {
+	switch name {
+	case "mock":
 		return &mockLookupSrc{}, nil
+	case "mockSnapshot":
+		return &mockSnapshotLookupSrc{}, nil
+	case "mockNotify":
+		return &mockNotifyLookupSrc{}, nil
+	case "mockIdle":
+		return &mockIdleLookupSrc{}, nil
+	case "mockBlocking":
+		return &mockBlockingLookupSrc{}, nil
+	case "mockFields":
+		return &mockFieldsLookupSrc{}, nil
+	case "mockTemporal":
+		return &mockTemporalLookupSrc{}, nil
+	case "mockDelay":
+		return &mockDelayLookupSrc{}, nil
+	case "mockBatch":
+		return &mockBatchLookupSrc{}, nil
+	case "mockScan":
+		return &mockScanLookupSrc{}, nil
+	case "mockFlaky":
+		return &mockFlakyLookupSrc{}, nil
+	case "mockRange":
+		return &mockRangeLookupSrc{}, nil
 	}
 	return nil, nil
 }
@@ -537,3 +809,2490 @@ func TestCachedLookup(t *testing.T) {
 		return
 	}
 }
+
+// doLookup sends the input to the lookup node and returns the first output
+func doLookup(t *testing.T, l *LookupNode, errCh chan error, outputCh chan interface{}, input interface{}) interface{} {
+	select {
+	case err := <-errCh:
+		t.Fatal(err)
+	case l.input <- input:
+	case <-time.After(1 * time.Second):
+		t.Fatal("send message timeout")
+	}
+	select {
+	case err := <-errCh:
+		t.Fatal(err)
+	case output := <-outputCh:
+		return output
+	case <-time.After(1 * time.Second):
+		t.Fatal("receive message timeout")
+	}
+	return nil
+}
+
+// lookupMessages extracts the messages of the lookup side from the join result
+func lookupMessages(output interface{}) []map[string]interface{} {
+	jt, ok := output.(*xsql.JoinTuples)
+	if !ok {
+		return nil
+	}
+	result := make([]map[string]interface{}, 0, len(jt.Content))
+	for _, c := range jt.Content {
+		if len(c.Tuples) < 2 {
+			result = append(result, nil)
+			continue
+		}
+		result = append(result, c.Tuples[1].(*xsql.Tuple).Message)
+	}
+	return result
+}
+
+func newTestLookupNode(t *testing.T, fields []string, joinType ast.JoinType, lc *LookupConf) (*LookupNode, chan error, chan interface{}) {
+	return newTestLookupNodeOfType(t, "mock", fields, joinType, lc)
+}
+
+// newTestLookupNodeOfType creates a lookup table of the source type with the same name and starts a lookup node of it
+func newTestLookupNodeOfType(t *testing.T, sourceType string, fields []string, joinType ast.JoinType, lc *LookupConf) (*LookupNode, chan error, chan interface{}) {
+	options := &ast.Options{
+		DATASOURCE:        sourceType,
+		TYPE:              sourceType,
+		STRICT_VALIDATION: true,
+		KIND:              "lookup",
+	}
+	lookup.CreateInstance(sourceType, sourceType, options)
+	contextLogger := conf.Log.WithField("rule", t.Name())
+	ctx, cancel := context.WithValue(context.Background(), context.LoggerKey, contextLogger).WithCancel()
+	t.Cleanup(cancel)
+	return startTestLookupNode(t, ctx, options, fields, joinType, lc)
+}
+
+// startTestLookupNode creates and runs a lookup node of the mock source in the context
+func startTestLookupNode(t *testing.T, ctx api.StreamContext, options *ast.Options, fields []string, joinType ast.JoinType, lc *LookupConf) (*LookupNode, chan error, chan interface{}) {
+	sourceType := options.TYPE
+	l, err := NewLookupNode(sourceType, fields, []string{"a"}, joinType, []ast.Expr{&ast.FieldRef{
+		StreamName: "",
+		Name:       "a",
+	}}, options, &api.RuleOption{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if lc != nil {
+		if err := l.applyConf(lc); err != nil {
+			t.Fatal(err)
+		}
+	}
+	errCh := make(chan error)
+	outputCh := make(chan interface{}, 1)
+	l.outputs["mock"] = outputCh
+	l.Exec(ctx, errCh)
+	return l, errCh, outputCh
+}
+
+func TestLookupTransform(t *testing.T) {
+	l, errCh, outputCh := newTestLookupNode(t, []string{}, ast.INNER_JOIN, &LookupConf{
+		Transform: "newA AS a2, newB * 10 AS b10",
+	})
+	output := doLookup(t, l, errCh, outputCh, &xsql.Tuple{
+		Emitter: "demo",
+		Message: map[string]interface{}{"a": 6},
+	})
+	exp := []map[string]interface{}{
+		{"a2": 1, "b10": int64(20)},
+		{"a2": 6, "b10": int64(120)},
+	}
+	if !reflect.DeepEqual(exp, lookupMessages(output)) {
+		t.Errorf("expect %v but got %v", exp, lookupMessages(output))
+	}
+	// Rows failed to transform are dropped but the others are still merged
+	l.transformFields, _ = parseLookupTransform("10 / (newA - 1) AS c")
+	output = doLookup(t, l, errCh, outputCh, &xsql.Tuple{
+		Emitter: "demo",
+		Message: map[string]interface{}{"a": 6},
+	})
+	exp = []map[string]interface{}{
+		{"c": int64(2)},
+	}
+	if !reflect.DeepEqual(exp, lookupMessages(output)) {
+		t.Errorf("expect %v but got %v", exp, lookupMessages(output))
+	}
+	// The left row of left join is still emitted if all the rows fail to transform
+	ll, errCh, outputCh := newTestLookupNode(t, []string{}, ast.LEFT_JOIN, &LookupConf{
+		Transform: "10 / (newA - newA) AS c",
+	})
+	output = doLookup(t, ll, errCh, outputCh, &xsql.Tuple{
+		Emitter: "demo",
+		Message: map[string]interface{}{"a": 6},
+	})
+	if jt := output.(*xsql.JoinTuples); len(jt.Content) != 1 || len(jt.Content[0].Tuples) != 1 {
+		t.Errorf("expect only the left row but got %v", output)
+	}
+}
+
+func TestLeftJoinNoMatchMetric(t *testing.T) {
+	l, errCh, outputCh := newTestLookupNode(t, []string{}, ast.LEFT_JOIN, nil)
+	// 210 can be divided by 2, 3, 5 and 7 so that no result is returned
+	output := doLookup(t, l, errCh, outputCh, &xsql.Tuple{
+		Emitter: "demo",
+		Message: map[string]interface{}{"a": 210},
+	})
+	if jt := output.(*xsql.JoinTuples); len(jt.Content) != 1 || len(jt.Content[0].Tuples) != 1 {
+		t.Errorf("expect only the left row but got %v", output)
+	}
+	_ = doLookup(t, l, errCh, outputCh, &xsql.Tuple{
+		Emitter: "demo",
+		Message: map[string]interface{}{"a": 6},
+	})
+	keys, values := l.GetExtraMetrics()
+	if !reflect.DeepEqual([]string{LeftJoinNoMatchTotal}, keys) || !reflect.DeepEqual([]interface{}{int64(1)}, values) {
+		t.Errorf("unexpected metrics %v: %v", keys, values)
+	}
+	// Inner join does not register the metric
+	li, _, _ := newTestLookupNode(t, []string{}, ast.INNER_JOIN, nil)
+	if keys, _ := li.GetExtraMetrics(); len(keys) != 0 {
+		t.Errorf("inner join should not have left join metric but got %v", keys)
+	}
+}
+
+func TestParseLookupTTL(t *testing.T) {
+	tests := []struct {
+		name string
+		v    interface{}
+		ttl  time.Duration
+		err  string
+	}{
+		{name: "cacheTtl", v: nil, ttl: 0},
+		{name: "cacheTtl", v: 20, ttl: 20 * time.Second},
+		{name: "cacheTtl", v: float64(30), ttl: 30 * time.Second},
+		{name: "cacheTtl", v: "40", ttl: 40 * time.Second},
+		{name: "cacheTtl", v: "5m", ttl: 5 * time.Minute},
+		{name: "cacheTtl", v: "500ms", ttl: 500 * time.Millisecond},
+		{name: "cacheTtl", v: "abc", err: "invalid lookup cacheTtl abc, must be an integer in seconds or a duration string like 30s"},
+		{name: "cacheTtl", v: -1, err: "invalid lookup cacheTtl -1, must not be negative"},
+		{name: "cacheTtl", v: true, err: "invalid lookup cacheTtl true, must be an integer in seconds or a duration string like 30s"},
+		{name: "cacheMissingKeyTtl", v: "abc", err: "invalid lookup cacheMissingKeyTtl abc, must be an integer in seconds or a duration string like 30s"},
+		{name: "cacheMaxStale", v: -1, err: "invalid lookup cacheMaxStale -1, must not be negative"},
+	}
+	for i, tt := range tests {
+		ttl, err := parseLookupTTL(tt.name, tt.v)
+		if tt.err != "" {
+			if err == nil || err.Error() != tt.err {
+				t.Errorf("case %d: expect error %s but got %v", i, tt.err, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("case %d: unexpected error %v", i, err)
+		} else if ttl != tt.ttl {
+			t.Errorf("case %d: expect %v but got %v", i, tt.ttl, ttl)
+		}
+	}
+}
+
+func TestUnionLookup(t *testing.T) {
+	lookup.CreateInstance("mock2", "mock", &ast.Options{
+		DATASOURCE: "mock2",
+		TYPE:       "mock",
+		KIND:       "lookup",
+	})
+	tests := []struct {
+		strategy string
+		a        int
+		count    int
+	}{
+		{strategy: UnionFirstMatch, a: 6, count: 2},
+		{strategy: UnionAll, a: 6, count: 4},
+		{strategy: UnionAll, a: 210, count: 0},
+	}
+	for i, tt := range tests {
+		l, errCh, outputCh := newTestLookupNode(t, []string{}, ast.INNER_JOIN, &LookupConf{
+			UnionTables:   []string{"mock2"},
+			UnionStrategy: tt.strategy,
+		})
+		output := doLookup(t, l, errCh, outputCh, &xsql.Tuple{
+			Emitter: "demo",
+			Message: map[string]interface{}{"a": tt.a},
+		})
+		if c := len(output.(*xsql.JoinTuples).Content); c != tt.count {
+			t.Errorf("case %d: expect %d rows but got %d", i, tt.count, c)
+		}
+	}
+}
+
+func TestLookupStrictFields(t *testing.T) {
+	input := &xsql.Tuple{
+		Emitter: "demo",
+		Message: map[string]interface{}{"a": 35},
+	}
+	// Fill the default value of the missing field
+	l, errCh, outputCh := newTestLookupNode(t, []string{"newA", "newC"}, ast.INNER_JOIN, &LookupConf{
+		StrictFields:  true,
+		FieldDefaults: map[string]interface{}{"newC": "none"},
+	})
+	output := doLookup(t, l, errCh, outputCh, input)
+	exp := []map[string]interface{}{
+		{"newA": 1, "newB": 2, "newC": "none"},
+		{"newA": 2, "newB": 4, "newC": "none"},
+	}
+	if !reflect.DeepEqual(exp, lookupMessages(output)) {
+		t.Errorf("expect %v but got %v", exp, lookupMessages(output))
+	}
+	// Report error without default value
+	l, errCh, outputCh = newTestLookupNode(t, []string{"newA", "newC"}, ast.INNER_JOIN, &LookupConf{
+		StrictFields: true,
+	})
+	l.sendError = true
+	output = doLookup(t, l, errCh, outputCh, input)
+	err, ok := output.(error)
+	if !ok || err.Error() != "lookup row of mock misses field newC" {
+		t.Errorf("expect missing field error but got %v", output)
+	}
+}
+
+func TestNormalizeKeys(t *testing.T) {
+	n := &LookupNode{conf: &LookupConf{
+		FuzzyKey:         true,
+		FuzzyKeyPrefixes: []string{"dev-", "device "},
+	}}
+	tests := []struct {
+		cvs     []interface{}
+		result  []interface{}
+		changed bool
+	}{
+		{cvs: []interface{}{"sensor 1"}, result: []interface{}{"sensor 1"}, changed: false},
+		{cvs: []interface{}{"  sensor   1 "}, result: []interface{}{"sensor 1"}, changed: true},
+		{cvs: []interface{}{"dev-sensor1", 10}, result: []interface{}{"sensor1", 10}, changed: true},
+		{cvs: []interface{}{"device  Sensor1"}, result: []interface{}{"Sensor1"}, changed: true},
+	}
+	for i, tt := range tests {
+		result, changed := n.normalizeKeys(tt.cvs)
+		if changed != tt.changed || !reflect.DeepEqual(result, tt.result) {
+			t.Errorf("case %d: expect %v(%v) but got %v(%v)", i, tt.result, tt.changed, result, changed)
+		}
+	}
+	n.conf.FuzzyKeyIgnoreCase = true
+	result, changed := n.normalizeKeys([]interface{}{"device Sensor1"})
+	if !changed || !reflect.DeepEqual([]interface{}{"sensor1"}, result) {
+		t.Errorf("ignore case: unexpected result %v", result)
+	}
+}
+
+func TestLookupMaxResultRows(t *testing.T) {
+	// 1 has 4 result rows
+	input := &xsql.Tuple{
+		Emitter: "demo",
+		Message: map[string]interface{}{"a": 1},
+	}
+	l, errCh, outputCh := newTestLookupNode(t, []string{}, ast.INNER_JOIN, &LookupConf{
+		MaxResultRows: 2,
+	})
+	output := doLookup(t, l, errCh, outputCh, input)
+	if c := len(output.(*xsql.JoinTuples).Content); c != 2 {
+		t.Errorf("expect truncated to 2 rows but got %d", c)
+	}
+	if c := l.counters.Get(TruncatedResultsTotal); c != 1 {
+		t.Errorf("expect 1 truncated result but got %d", c)
+	}
+
+	l, errCh, outputCh = newTestLookupNode(t, []string{}, ast.INNER_JOIN, &LookupConf{
+		MaxResultRows:   2,
+		OverLimitPolicy: OverLimitError,
+	})
+	l.sendError = true
+	output = doLookup(t, l, errCh, outputCh, input)
+	if err, ok := output.(error); !ok || err.Error() != "lookup result of mock has 4 rows which exceeds the max result rows 2" {
+		t.Errorf("expect over limit error but got %v", output)
+	}
+	if c := l.counters.Get(TruncatedResultsTotal); c != 1 {
+		t.Errorf("expect 1 over limit result but got %d", c)
+	}
+}
+
+func TestLookupErrorTopic(t *testing.T) {
+	ch := pubsub.CreateSub("lookupErrors", nil, t.Name(), 10)
+	defer pubsub.CloseSourceConsumerChannel("lookupErrors", t.Name())
+	l, errCh, outputCh := newTestLookupNode(t, []string{}, ast.INNER_JOIN, &LookupConf{
+		MaxResultRows:   2,
+		OverLimitPolicy: OverLimitError,
+		ErrorTopic:      "lookupErrors",
+	})
+	l.sendError = true
+	errMsg := "lookup result of mock has 4 rows which exceeds the max result rows 2"
+	tests := []struct {
+		input interface{}
+		exp   map[string]interface{}
+	}{
+		{
+			input: &xsql.Tuple{Emitter: "demo", Message: map[string]interface{}{"a": 1}},
+			exp: map[string]interface{}{
+				ErrorRowTable: "mock",
+				ErrorRowError: errMsg,
+				ErrorRowType:  "result",
+				ErrorRowKeys:  []interface{}{1},
+				ErrorRowRow:   map[string]interface{}{"a": 1},
+			},
+		},
+		{
+			input: &xsql.WindowTuples{Content: []xsql.TupleRow{
+				&xsql.Tuple{Emitter: "demo", Message: map[string]interface{}{"a": 6}},
+				&xsql.Tuple{Emitter: "demo", Message: map[string]interface{}{"a": 1}},
+			}},
+			exp: map[string]interface{}{
+				ErrorRowTable: "mock",
+				ErrorRowError: errMsg,
+				ErrorRowType:  "result",
+				ErrorRowKeys:  []interface{}{1},
+				ErrorRowRows:  []map[string]interface{}{{"a": 6}, {"a": 1}},
+			},
+		},
+	}
+	for i, tt := range tests {
+		// the error is still emitted as is
+		output := doLookup(t, l, errCh, outputCh, tt.input)
+		if err, ok := output.(*LookupResultError); !ok || err.Error() != errMsg {
+			t.Errorf("case %d: expect over limit error but got %v", i, output)
+		}
+		select {
+		case st := <-ch:
+			if !reflect.DeepEqual(tt.exp, st.Message()) {
+				t.Errorf("case %d: expect error row %v but got %v", i, tt.exp, st.Message())
+			}
+		case <-time.After(1 * time.Second):
+			t.Fatalf("case %d: receive error row timeout", i)
+		}
+	}
+}
+
+func TestLookupHeartbeat(t *testing.T) {
+	_, errCh, outputCh := newTestLookupNode(t, []string{}, ast.INNER_JOIN, &LookupConf{
+		LookupHeartbeatConf: LookupHeartbeatConf{HeartbeatInterval: 1000},
+	})
+	// wait for the ticker to start
+	time.Sleep(100 * time.Millisecond)
+	mc := conf.Clock.(*clock.Mock)
+	mc.Add(1 * time.Second)
+	select {
+	case err := <-errCh:
+		t.Fatal(err)
+	case output := <-outputCh:
+		wt, ok := output.(*xsql.WatermarkTuple)
+		if !ok {
+			t.Fatalf("expect watermark but got %v", output)
+		}
+		if wt.GetTimestamp() != conf.GetNowInMilli() {
+			t.Errorf("expect watermark %d but got %d", conf.GetNowInMilli(), wt.GetTimestamp())
+		}
+	case <-time.After(1 * time.Second):
+		t.Fatal("receive heartbeat timeout")
+	}
+}
+
+func TestLookupHeartbeatEventTime(t *testing.T) {
+	old := conf.Config.Lookup
+	conf.Config.Lookup = map[string]interface{}{"heartbeatInterval": 1000}
+	defer func() {
+		conf.Config.Lookup = old
+	}()
+	options := &ast.Options{DATASOURCE: "mock", TYPE: "mock", KIND: "lookup"}
+	_, err := NewLookupNode("mock", []string{}, []string{"a"}, ast.INNER_JOIN, []ast.Expr{&ast.FieldRef{Name: "a"}}, options, &api.RuleOption{IsEventTime: true})
+	if err == nil || err.Error() != "lookup heartbeatInterval is not supported in event time rule" {
+		t.Errorf("expect the heartbeat rejected in event time rule but got %v", err)
+	}
+	if _, err := NewLookupNode("mock", []string{}, []string{"a"}, ast.INNER_JOIN, []ast.Expr{&ast.FieldRef{Name: "a"}}, options, &api.RuleOption{}); err != nil {
+		t.Errorf("expect the heartbeat supported in processing time rule but got %v", err)
+	}
+}
+
+func TestLookupIdleTimeout(t *testing.T) {
+	l, errCh, outputCh := newTestLookupNodeOfType(t, "mockIdle", []string{}, ast.INNER_JOIN, &LookupConf{
+		LookupIdleConf: LookupIdleConf{IdleTimeout: 1000},
+	})
+	// wait for the node to attach the table and start the ticker
+	time.Sleep(100 * time.Millisecond)
+	ls, err := lookup.Attach("mockIdle")
+	if err != nil {
+		t.Fatal(err)
+	}
+	_ = lookup.Detach("mockIdle")
+	src := ls.(*mockIdleLookupSrc)
+	mc := conf.Clock.(*clock.Mock)
+	waitReleased := func(exp int32) {
+		mc.Add(1 * time.Second)
+		for i := 0; i < 10 && src.released.Load() < exp; i++ {
+			time.Sleep(50 * time.Millisecond)
+		}
+		if r := src.released.Load(); r != exp {
+			t.Fatalf("expect released %d times but got %d", exp, r)
+		}
+	}
+	waitReleased(1)
+	// the input attaches the table again
+	if msgs := lookupMessages(doLookup(t, l, errCh, outputCh, &xsql.Tuple{Emitter: "demo", Message: map[string]interface{}{"a": 1}})); len(msgs) != 1 {
+		t.Errorf("expect to look up after idle but got %v", msgs)
+	}
+	waitReleased(2)
+}
+
+func TestLookupMetricsWhileStarting(t *testing.T) {
+	options := &ast.Options{DATASOURCE: "mock", TYPE: "mock", STRICT_VALIDATION: true, KIND: "lookup"}
+	lookup.CreateInstance("mock", "mock", options)
+	contextLogger := conf.Log.WithField("rule", t.Name())
+	ctx, cancel := context.WithValue(context.Background(), context.LoggerKey, contextLogger).WithCancel()
+	t.Cleanup(cancel)
+	l, err := NewLookupNode("mock", []string{}, []string{"a"}, ast.LEFT_JOIN, []ast.Expr{&ast.FieldRef{Name: "a"}}, options, &api.RuleOption{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := l.applyConf(&LookupConf{Cache: true, CacheMissingKey: true, MaxResultRows: 1}); err != nil {
+		t.Fatal(err)
+	}
+	l.outputs["mock"] = make(chan interface{}, 1)
+	// the status api polls the metrics while the rule starts
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < 1000; i++ {
+			l.GetExtraMetrics()
+		}
+	}()
+	l.Exec(ctx, make(chan error))
+	<-done
+	names, _ := l.GetExtraMetrics()
+	if len(names) == 0 {
+		t.Error("expect the counters registered after start")
+	}
+}
+
+func TestLookupProbe(t *testing.T) {
+	l, errCh, outputCh := newTestLookupNode(t, []string{}, ast.INNER_JOIN, &LookupConf{
+		LookupProbeConf: LookupProbeConf{
+			ProbeInterval: 1000,
+			ProbeKeys:     []interface{}{6},
+		},
+	})
+	// wait for the ticker to start
+	time.Sleep(100 * time.Millisecond)
+	mc := conf.Clock.(*clock.Mock)
+	mc.Add(1 * time.Second)
+	select {
+	case err := <-errCh:
+		t.Fatal(err)
+	case output := <-outputCh:
+		t.Fatalf("expect no output of the probe but got %v", output)
+	case <-time.After(200 * time.Millisecond):
+	}
+	if h := l.counters.Get(ProbeHealthy); h != 1 {
+		t.Errorf("expect the probe healthy but got %d", h)
+	}
+	if f := l.counters.Get(ProbeFailuresTotal); f != 0 {
+		t.Errorf("expect no probe failure but got %d", f)
+	}
+	if err := (&LookupNode{keys: []string{"a"}}).applyConf(&LookupConf{LookupProbeConf: LookupProbeConf{ProbeInterval: 1000}}); err == nil {
+		t.Error("expect error for probe without probe keys")
+	}
+}
+
+func TestLookupDebugEmitKeys(t *testing.T) {
+	l, errCh, outputCh := newTestLookupNode(t, []string{}, ast.INNER_JOIN, &LookupConf{
+		LookupDebugConf: LookupDebugConf{DebugEmitKeys: true},
+	})
+	output := doLookup(t, l, errCh, outputCh, &xsql.Tuple{
+		Emitter: "demo",
+		Message: map[string]interface{}{"a": 6},
+	})
+	jt := output.(*xsql.JoinTuples)
+	if len(jt.Content) != 2 {
+		t.Fatalf("expect 2 rows but got %v", output)
+	}
+	for _, c := range jt.Content {
+		lt := c.Tuples[1].(*xsql.Tuple)
+		if v, _ := lt.Meta(DebugLookupValuesKey, ""); !reflect.DeepEqual([]interface{}{6}, v) {
+			t.Errorf("expect lookup values [6] but got %v", v)
+		}
+		if v, _ := lt.Meta(DebugCacheKeyKey, ""); v != "[6]" {
+			t.Errorf("expect cache key [6] but got %v", v)
+		}
+		if _, ok := lt.Message[DebugLookupValuesKey]; ok {
+			t.Errorf("message should not be changed but got %v", lt.Message)
+		}
+	}
+}
+
+func TestLookupEmitLatency(t *testing.T) {
+	l, errCh, outputCh := newTestLookupNode(t, []string{}, ast.INNER_JOIN, &LookupConf{
+		Cache:         true,
+		CacheTTL:      20,
+		EmitLatency:   true,
+		EmitLatencyAs: EmitAsField,
+		LatencyName:   "latency",
+		CacheHitName:  "hit",
+	})
+	for i, expHit := range []bool{false, true} {
+		output := doLookup(t, l, errCh, outputCh, &xsql.Tuple{
+			Emitter: "demo",
+			Message: map[string]interface{}{"a": 6},
+		})
+		msgs := lookupMessages(output)
+		if len(msgs) != 2 {
+			t.Fatalf("%d: expect 2 rows but got %v", i, output)
+		}
+		for _, msg := range msgs {
+			if msg["hit"] != expHit {
+				t.Errorf("%d: expect hit %v but got %v", i, expHit, msg["hit"])
+			}
+			if _, ok := msg["latency"].(float64); !ok {
+				t.Errorf("%d: expect float latency but got %v", i, msg["latency"])
+			}
+		}
+	}
+
+	l, errCh, outputCh = newTestLookupNode(t, []string{}, ast.INNER_JOIN, &LookupConf{
+		EmitLatency: true,
+	})
+	output := doLookup(t, l, errCh, outputCh, &xsql.Tuple{
+		Emitter: "demo",
+		Message: map[string]interface{}{"a": 6},
+	})
+	for _, c := range output.(*xsql.JoinTuples).Content {
+		lt := c.Tuples[1].(*xsql.Tuple)
+		if v, _ := lt.Meta(DefaultCacheHitName, ""); v != false {
+			t.Errorf("expect cache hit false in meta but got %v", v)
+		}
+		if _, ok := lt.Meta(DefaultLatencyName, ""); !ok {
+			t.Errorf("expect latency in meta but got %v", lt.Metadata)
+		}
+		if _, ok := lt.Message[DefaultLatencyName]; ok {
+			t.Errorf("message should not be changed but got %v", lt.Message)
+		}
+	}
+
+	err := (&LookupNode{}).applyConf(&LookupConf{EmitLatency: true, LatencyName: "a", CacheHitName: "a"})
+	if err == nil {
+		t.Error("expect error for the same latency and cache hit names")
+	}
+}
+
+func TestLookupSourceNotSupported(t *testing.T) {
+	_, err := NewLookupNode("mqttTable", []string{}, []string{"a"}, ast.INNER_JOIN, []ast.Expr{&ast.FieldRef{
+		StreamName: "",
+		Name:       "a",
+	}}, &ast.Options{
+		DATASOURCE: "topic",
+		TYPE:       "mqtt",
+		KIND:       "lookup",
+	}, &api.RuleOption{})
+	if err == nil || err.Error() != "source mqtt does not support lookup tables" {
+		t.Errorf("expect not support error but got %v", err)
+	}
+}
+
+func TestLookupWindowSnapshot(t *testing.T) {
+	input := &xsql.WindowTuples{
+		Content: []xsql.TupleRow{
+			&xsql.Tuple{Emitter: "demo", Message: map[string]interface{}{"a": 1}},
+			&xsql.Tuple{Emitter: "demo", Message: map[string]interface{}{"a": 2}},
+			&xsql.Tuple{Emitter: "demo", Message: map[string]interface{}{"a": 3}},
+		},
+	}
+	tests := []struct {
+		snapshot bool
+		exp      []map[string]interface{}
+		closed   int
+	}{
+		{
+			snapshot: false,
+			exp:      []map[string]interface{}{{"version": 1}, {"version": 2}, {"version": 3}},
+		},
+		{
+			snapshot: true,
+			exp:      []map[string]interface{}{{"version": 1}, {"version": 1}, {"version": 1}},
+			closed:   1,
+		},
+	}
+	for i, tt := range tests {
+		l, errCh, outputCh := newTestLookupNodeOfType(t, "mockSnapshot", []string{}, ast.INNER_JOIN, &LookupConf{
+			WindowSnapshot: tt.snapshot,
+		})
+		output := doLookup(t, l, errCh, outputCh, input)
+		if !reflect.DeepEqual(tt.exp, lookupMessages(output)) {
+			t.Errorf("case %d: expect %v but got %v", i, tt.exp, lookupMessages(output))
+		}
+		ls, err := lookup.Attach("mockSnapshot")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if c := ls.(*mockSnapshotLookupSrc).closed; c != tt.closed {
+			t.Errorf("case %d: expect snapshot closed %d times but got %d", i, tt.closed, c)
+		}
+		_ = lookup.Detach("mockSnapshot")
+	}
+}
+
+func TestLookupCacheAdaptive(t *testing.T) {
+	window, minRatio := cacheAdaptiveWindow, cacheMinHitRatio
+	cacheAdaptiveWindow, cacheMinHitRatio = 2, 0.5
+	defer func() {
+		cacheAdaptiveWindow, cacheMinHitRatio = window, minRatio
+	}()
+	l, errCh, outputCh := newTestLookupNode(t, []string{}, ast.INNER_JOIN, &LookupConf{
+		Cache:         true,
+		CacheAdaptive: true,
+		EmitLatency:   true,
+		EmitLatencyAs: EmitAsField,
+	})
+	tests := []struct {
+		a   int
+		hit bool
+	}{
+		// unique keys, start bypass
+		{a: 1}, {a: 2},
+		// bypassed
+		{a: 1}, {a: 1},
+		// caching resumes with the cleared cache
+		{a: 1}, {a: 1, hit: true},
+		{a: 1, hit: true},
+	}
+	for i, tt := range tests {
+		output := doLookup(t, l, errCh, outputCh, &xsql.Tuple{
+			Emitter: "demo",
+			Message: map[string]interface{}{"a": tt.a},
+		})
+		msgs := lookupMessages(output)
+		if len(msgs) == 0 {
+			t.Fatalf("case %d: expect lookup rows but got %v", i, output)
+		}
+		if msgs[0][DefaultCacheHitName] != tt.hit {
+			t.Errorf("case %d: expect hit %v but got %v", i, tt.hit, msgs[0][DefaultCacheHitName])
+		}
+	}
+	if c := l.counters.Get(CacheBypassTotal); c != 2 {
+		t.Errorf("expect 2 lookups bypassed but got %d", c)
+	}
+}
+
+func TestLookupExplode(t *testing.T) {
+	tests := []struct {
+		joinType ast.JoinType
+		a        interface{}
+		// the count of the joined rows of each exploded element
+		counts map[interface{}]int
+	}{
+		{joinType: ast.INNER_JOIN, a: []interface{}{6, 0, 1}, counts: map[interface{}]int{6: 2, 1: 4}},
+		{joinType: ast.LEFT_JOIN, a: []interface{}{6, 0, 1}, counts: map[interface{}]int{6: 2, 0: 1, 1: 4}},
+		{joinType: ast.LEFT_JOIN, a: []interface{}{}, counts: map[interface{}]int{nil: 1}},
+		{joinType: ast.INNER_JOIN, a: 6, counts: map[interface{}]int{6: 2}},
+	}
+	for i, tt := range tests {
+		l, errCh, outputCh := newTestLookupNode(t, []string{}, tt.joinType, &LookupConf{
+			ExplodeField: "a",
+		})
+		output := doLookup(t, l, errCh, outputCh, &xsql.Tuple{Emitter: "demo", Message: map[string]interface{}{"a": tt.a, "b": 1}})
+		jt, ok := output.(*xsql.JoinTuples)
+		if !ok {
+			t.Fatalf("case %d: expect join tuples but got %v", i, output)
+		}
+		counts := make(map[interface{}]int)
+		for _, c := range jt.Content {
+			v, _ := c.Tuples[0].Value("a", "")
+			counts[v]++
+		}
+		if !reflect.DeepEqual(tt.counts, counts) {
+			t.Errorf("case %d: expect the joined rows %v but got %v", i, tt.counts, counts)
+		}
+	}
+}
+
+func TestLookupEmitMatchedKey(t *testing.T) {
+	l, errCh, outputCh := newTestLookupNode(t, []string{}, ast.INNER_JOIN, &LookupConf{
+		MultiKey:       MultiKeyAny,
+		EmitMatchedKey: true,
+	})
+	msgs := lookupMessages(doLookup(t, l, errCh, outputCh, &xsql.Tuple{Emitter: "demo", Message: map[string]interface{}{"a": []interface{}{6, 1}}}))
+	counts := make(map[interface{}]int)
+	for _, m := range msgs {
+		key, ok := m[DefaultMatchedKeyName].(map[string]interface{})
+		if !ok {
+			t.Fatalf("expect the matched key in %v", m)
+		}
+		counts[key["a"]]++
+	}
+	// 6 has 2 rows and 1 has 4 rows in the mock source
+	if exp := map[interface{}]int{6: 2, 1: 4}; !reflect.DeepEqual(exp, counts) {
+		t.Errorf("expect the rows of each matched key %v but got %v", exp, counts)
+	}
+	msgs = lookupMessages(doLookup(t, l, errCh, outputCh, &xsql.Tuple{Emitter: "demo", Message: map[string]interface{}{"a": 6}}))
+	for _, m := range msgs {
+		if exp := map[string]interface{}{"a": 6}; !reflect.DeepEqual(exp, m[DefaultMatchedKeyName]) {
+			t.Errorf("expect the matched key %v but got %v", exp, m[DefaultMatchedKeyName])
+		}
+	}
+}
+
+func TestLookupMultiKey(t *testing.T) {
+	tests := []struct {
+		mode     string
+		joinType ast.JoinType
+		a        interface{}
+		rows     int
+		noMatch  bool
+	}{
+		{mode: MultiKeyAny, joinType: ast.INNER_JOIN, a: []interface{}{6, 1}, rows: 6},
+		{mode: MultiKeyAll, joinType: ast.INNER_JOIN, a: []interface{}{6, 1}, rows: 6},
+		{mode: MultiKeyAny, joinType: ast.INNER_JOIN, a: []interface{}{6, 0}, rows: 2},
+		{mode: MultiKeyAll, joinType: ast.INNER_JOIN, a: []interface{}{6, 0}, rows: 0},
+		{mode: MultiKeyAll, joinType: ast.LEFT_JOIN, a: []interface{}{6, 0}, rows: 1, noMatch: true},
+		{mode: MultiKeyAll, joinType: ast.INNER_JOIN, a: []interface{}{}, rows: 0},
+		{mode: MultiKeyAll, joinType: ast.INNER_JOIN, a: 6, rows: 2},
+	}
+	for i, tt := range tests {
+		l, errCh, outputCh := newTestLookupNode(t, []string{}, tt.joinType, &LookupConf{
+			MultiKey: tt.mode,
+		})
+		output := doLookup(t, l, errCh, outputCh, &xsql.Tuple{
+			Emitter: "demo",
+			Message: map[string]interface{}{"a": tt.a},
+		})
+		msgs := lookupMessages(output)
+		if len(msgs) != tt.rows {
+			t.Errorf("case %d: expect %d rows but got %v", i, tt.rows, output)
+			continue
+		}
+		if tt.noMatch && msgs[0] != nil {
+			t.Errorf("case %d: expect no lookup row but got %v", i, msgs[0])
+		}
+	}
+	l, _, _ := newTestLookupNode(t, []string{}, ast.INNER_JOIN, nil)
+	keys, err := l.expandKeys([]interface{}{[]interface{}{1, 2}, "x", []interface{}{"a", "b"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	exp := [][]interface{}{{1, "x", "a"}, {2, "x", "b"}}
+	if !reflect.DeepEqual(exp, keys) {
+		t.Errorf("expect keys %v but got %v", exp, keys)
+	}
+	var ie *InvalidInputError
+	if _, err := l.expandKeys([]interface{}{[]interface{}{1, 2}, []interface{}{"a"}}); !errors.As(err, &ie) {
+		t.Errorf("expect invalid input error for different lengths but got %v", err)
+	}
+}
+
+func TestLookupRateLimit(t *testing.T) {
+	input := &xsql.Tuple{Emitter: "demo", Message: map[string]interface{}{"a": 6}}
+	l, errCh, outputCh := newTestLookupNode(t, []string{}, ast.INNER_JOIN, &LookupConf{
+		RateLimit: 1,
+	})
+	if msgs := lookupMessages(doLookup(t, l, errCh, outputCh, input)); len(msgs) != 2 {
+		t.Errorf("expect 2 rows for the first lookup but got %v", msgs)
+	}
+	if msgs := lookupMessages(doLookup(t, l, errCh, outputCh, input)); len(msgs) != 0 {
+		t.Errorf("expect the throttled lookup to be shed but got %v", msgs)
+	}
+	if c := l.counters.Get(ThrottleRejectedTotal); c != 1 {
+		t.Errorf("expect 1 throttled lookup rejected but got %d", c)
+	}
+
+	l, errCh, outputCh = newTestLookupNode(t, []string{}, ast.INNER_JOIN, &LookupConf{
+		RateLimit:       1,
+		RateLimitPolicy: RateLimitError,
+	})
+	l.sendError = true
+	_ = doLookup(t, l, errCh, outputCh, input)
+	output := doLookup(t, l, errCh, outputCh, input)
+	var te *LookupThrottledError
+	if err, ok := output.(error); !ok || !errors.As(err, &te) || te.Wait != time.Second {
+		t.Errorf("expect throttled error but got %v", output)
+	}
+}
+
+func TestLookupRetry(t *testing.T) {
+	// advance the mock clock for the retry backoff
+	mc := conf.Clock.(*clock.Mock)
+	done := make(chan struct{})
+	var wg sync.WaitGroup
+	wg.Add(1)
+	// stop advancing the clock before the following tests
+	defer func() {
+		close(done)
+		wg.Wait()
+	}()
+	go func() {
+		defer wg.Done()
+		for {
+			select {
+			case <-done:
+				return
+			case <-time.After(time.Millisecond):
+				mc.Add(10 * time.Millisecond)
+			}
+		}
+	}()
+	input := &xsql.Tuple{Emitter: "demo", Message: map[string]interface{}{"a": 6}}
+	tests := []struct {
+		name      string
+		joinType  ast.JoinType
+		policy    string
+		fails     int32
+		rows      int
+		err       bool
+		retries   int64
+		exhausted int64
+	}{
+		{name: "recovered", joinType: ast.INNER_JOIN, fails: 2, rows: 2, retries: 2},
+		{name: "error", joinType: ast.INNER_JOIN, fails: 5, err: true, retries: 2, exhausted: 1},
+		{name: "unjoined", joinType: ast.LEFT_JOIN, policy: RetryFailureUnjoined, fails: 5, rows: 1, retries: 2, exhausted: 1},
+		{name: "drop", joinType: ast.LEFT_JOIN, policy: RetryFailureDrop, fails: 5, retries: 2, exhausted: 1},
+	}
+	for _, tt := range tests {
+		l, errCh, outputCh := newTestLookupNodeOfType(t, "mockFlaky", []string{}, tt.joinType, &LookupConf{
+			LookupRetryConf: LookupRetryConf{
+				RetryCount:         2,
+				RetryInterval:      10,
+				RetryFailurePolicy: tt.policy,
+			},
+		})
+		l.sendError = true
+		ls, err := lookup.Attach("mockFlaky")
+		if err != nil {
+			t.Fatal(err)
+		}
+		ls.(*mockFlakyLookupSrc).fails.Store(tt.fails)
+		output := doLookup(t, l, errCh, outputCh, input)
+		_ = lookup.Detach("mockFlaky")
+		if _, ok := output.(error); ok != tt.err {
+			t.Errorf("%s: expect error %v but got %v", tt.name, tt.err, output)
+		} else if jt, ok := output.(*xsql.JoinTuples); ok && len(jt.Content) != tt.rows {
+			t.Errorf("%s: expect %d rows but got %v", tt.name, tt.rows, output)
+		}
+		if c := l.counters.Get(RetriesTotal); c != tt.retries {
+			t.Errorf("%s: expect %d retries but got %d", tt.name, tt.retries, c)
+		}
+		if c := l.counters.Get(RetryExhaustedTotal); c != tt.exhausted {
+			t.Errorf("%s: expect %d exhausted lookups but got %d", tt.name, tt.exhausted, c)
+		}
+	}
+	if err := (&LookupNode{}).applyConf(&LookupConf{LookupRetryConf: LookupRetryConf{RetryFailurePolicy: "ignore"}}); err == nil {
+		t.Error("expect error for invalid retryFailurePolicy")
+	}
+}
+
+func TestLookupCircuitBreaker(t *testing.T) {
+	mc := conf.Clock.(*clock.Mock)
+	input := &xsql.Tuple{Emitter: "demo", Message: map[string]interface{}{"a": 6}}
+	l, errCh, outputCh := newTestLookupNodeOfType(t, "mockFlaky", []string{}, ast.LEFT_JOIN, &LookupConf{
+		LookupBreakerConf: LookupBreakerConf{
+			BreakerThreshold: 2,
+			BreakerCooldown:  1000,
+		},
+		LookupRetryConf: LookupRetryConf{RetryFailurePolicy: RetryFailureUnjoined},
+	})
+	ls, err := lookup.Attach("mockFlaky")
+	if err != nil {
+		t.Fatal(err)
+	}
+	src := ls.(*mockFlakyLookupSrc)
+	src.fails.Store(3)
+	for i := 0; i < 3; i++ {
+		if msgs := lookupMessages(doLookup(t, l, errCh, outputCh, input)); len(msgs) != 1 || msgs[0] != nil {
+			t.Errorf("lookup %d: expect the unjoined row but got %v", i, msgs)
+		}
+	}
+	if c := src.fails.Load(); c != 1 {
+		t.Errorf("expect the rejected lookup not to call the source but %d fails left", c)
+	}
+	if c := l.counters.Get(BreakerOpensTotal); c != 1 {
+		t.Errorf("expect the breaker to open once but got %d", c)
+	}
+	if c := l.counters.Get(BreakerRejectedTotal); c != 1 {
+		t.Errorf("expect 1 lookup rejected but got %d", c)
+	}
+	// the failed trial opens the breaker again
+	mc.Add(time.Second)
+	_ = doLookup(t, l, errCh, outputCh, input)
+	if c := l.counters.Get(BreakerOpensTotal); c != 2 {
+		t.Errorf("expect the failed trial to open the breaker but got %d opens", c)
+	}
+	_ = doLookup(t, l, errCh, outputCh, input)
+	if c := l.counters.Get(BreakerRejectedTotal); c != 2 {
+		t.Errorf("expect 2 lookups rejected but got %d", c)
+	}
+	// the successful trial closes the breaker
+	mc.Add(time.Second)
+	for i := 0; i < 2; i++ {
+		if msgs := lookupMessages(doLookup(t, l, errCh, outputCh, input)); len(msgs) != 2 {
+			t.Errorf("lookup %d: expect 2 rows after recovered but got %v", i, msgs)
+		}
+	}
+	_ = lookup.Detach("mockFlaky")
+
+	l, errCh, outputCh = newTestLookupNodeOfType(t, "mockFlaky", []string{}, ast.INNER_JOIN, &LookupConf{
+		LookupBreakerConf: LookupBreakerConf{BreakerThreshold: 1},
+	})
+	l.sendError = true
+	ls, err = lookup.Attach("mockFlaky")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ls.(*mockFlakyLookupSrc).fails.Store(5)
+	_ = doLookup(t, l, errCh, outputCh, input)
+	output := doLookup(t, l, errCh, outputCh, input)
+	_ = lookup.Detach("mockFlaky")
+	var oe *LookupCircuitOpenError
+	if err, ok := output.(error); !ok || !errors.As(err, &oe) || oe.LookupTable() != "mockFlaky" {
+		t.Errorf("expect circuit open error but got %v", output)
+	}
+}
+
+func TestLookupCircuitBreakerStale(t *testing.T) {
+	mc := conf.Clock.(*clock.Mock)
+	input := &xsql.Tuple{Emitter: "demo", Message: map[string]interface{}{"a": 6}}
+	l, errCh, outputCh := newTestLookupNodeOfType(t, "mockFlaky", []string{}, ast.INNER_JOIN, &LookupConf{
+		Cache:    true,
+		CacheTTL: 1,
+		LookupBreakerConf: LookupBreakerConf{
+			BreakerThreshold: 1,
+			BreakerMaxStale:  10000,
+		},
+	})
+	l.sendError = true
+	ls, err := lookup.Attach("mockFlaky")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = lookup.Detach("mockFlaky") }()
+	ls.(*mockFlakyLookupSrc).fails.Store(0)
+	if msgs := lookupMessages(doLookup(t, l, errCh, outputCh, input)); len(msgs) != 2 {
+		t.Errorf("expect 2 rows but got %v", msgs)
+	}
+	mc.Add(2 * time.Second)
+	ls.(*mockFlakyLookupSrc).fails.Store(5)
+	// the failure opens the breaker, and then the expired result is served
+	if _, ok := doLookup(t, l, errCh, outputCh, input).(error); !ok {
+		t.Error("expect the error of the failed lookup")
+	}
+	if msgs := lookupMessages(doLookup(t, l, errCh, outputCh, input)); len(msgs) != 2 {
+		t.Errorf("expect the stale 2 rows but got %v", msgs)
+	}
+	if c := l.counters.Get(StaleServedTotal); c != 1 {
+		t.Errorf("expect 1 stale result served but got %d", c)
+	}
+	if err := (&LookupNode{}).applyConf(&LookupConf{LookupBreakerConf: LookupBreakerConf{BreakerMaxStale: 1000}}); err == nil {
+		t.Error("expect error for breakerMaxStale without the breaker")
+	}
+	if err := (&LookupNode{}).applyConf(&LookupConf{LookupBreakerConf: LookupBreakerConf{BreakerThreshold: -1}}); err == nil {
+		t.Error("expect error for negative breakerThreshold")
+	}
+}
+
+func TestLookupRetryBackoff(t *testing.T) {
+	l := &LookupNode{conf: &LookupConf{LookupRetryConf: LookupRetryConf{RetryInterval: 1000}}}
+	for i, exp := range []int{1000, 2000, 4000, 8000, 10000, 10000, 10000} {
+		d := l.retryBackoff(i)
+		if d < time.Duration(exp/2)*time.Millisecond || d > time.Duration(exp)*time.Millisecond {
+			t.Errorf("attempt %d: expect backoff between %dms and %dms but got %v", i, exp/2, exp, d)
+		}
+	}
+	if d := l.retryBackoff(100); d > RetryMaxInterval*time.Millisecond {
+		t.Errorf("expect backoff at most the max interval but got %v", d)
+	}
+}
+
+func TestLookupCacheShared(t *testing.T) {
+	input := &xsql.Tuple{Emitter: "demo", Message: map[string]interface{}{"a": 6}}
+	tests := []struct {
+		fields []string
+		ttl    interface{}
+		exp    []map[string]interface{}
+		hit    bool
+	}{
+		{
+			fields: []string{"newA"},
+			exp:    []map[string]interface{}{{"newA": 1}, {"newA": 6}},
+		},
+		{ // reuse the full rows cached by the other node with its own ttl
+			fields: []string{"newB"},
+			ttl:    20,
+			exp:    []map[string]interface{}{{"newB": 2}, {"newB": 12}},
+			hit:    true,
+		},
+	}
+	var nodes []*LookupNode
+	for i, tt := range tests {
+		l, errCh, outputCh := newTestLookupNode(t, tt.fields, ast.INNER_JOIN, &LookupConf{
+			Cache:       true,
+			CacheShared: true,
+			CacheTTL:    tt.ttl,
+			EmitLatency: true,
+		})
+		nodes = append(nodes, l)
+		output := doLookup(t, l, errCh, outputCh, input)
+		if !reflect.DeepEqual(tt.exp, lookupMessages(output)) {
+			t.Errorf("case %d: expect %v but got %v", i, tt.exp, lookupMessages(output))
+			continue
+		}
+		for _, c := range output.(*xsql.JoinTuples).Content {
+			if hit, _ := c.Tuples[1].(*xsql.Tuple).Meta(DefaultCacheHitName, ""); hit != tt.hit {
+				t.Errorf("case %d: expect cache hit %v but got %v", i, tt.hit, hit)
+			}
+		}
+	}
+	if nodes[0].cacheId != "mock" || nodes[1].cache.Len() != 1 {
+		t.Errorf("expect the cache of the table shared by the nodes but got %d items", nodes[1].cache.Len())
+	}
+	// the memory options of the shared cache cannot be changed by the later rules
+	l, err := NewLookupNode("mock", []string{"newA"}, []string{"a"}, ast.INNER_JOIN, []ast.Expr{&ast.FieldRef{Name: "a"}}, nodes[0].srcOptions, &api.RuleOption{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := l.applyConf(&LookupConf{Cache: true, CacheShared: true, CacheSize: 10}); err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithValue(context.Background(), context.LoggerKey, conf.Log).WithCancel()
+	defer cancel()
+	errCh := make(chan error, 1)
+	l.outputs["mock"] = make(chan interface{}, 1)
+	l.Exec(ctx, errCh)
+	select {
+	case err := <-errCh:
+		if !strings.Contains(err.Error(), "shared cache of lookup table mock is already used with maxItems 0, conflicts with 10") {
+			t.Errorf("expect the conflicting cache size rejected but got %v", err)
+		}
+	case <-time.After(time.Second):
+		t.Error("expect the conflicting cache size rejected")
+	}
+}
+
+func TestLookupAsync(t *testing.T) {
+	ordered := false
+	l, errCh, outputCh := newTestLookupNode(t, []string{}, ast.INNER_JOIN, &LookupConf{
+		LookupAsyncConf: LookupAsyncConf{
+			Ordered:          &ordered,
+			AsyncConcurrency: 2,
+		},
+		// wait for the test to receive the results completed at the same time
+		BroadcastTimeout: 1000,
+	})
+	inputs := []interface{}{
+		&xsql.Tuple{Emitter: "demo", Message: map[string]interface{}{"a": 1}},
+		&xsql.Tuple{Emitter: "demo", Message: map[string]interface{}{"a": 2}},
+		&xsql.Tuple{Emitter: "demo", Message: map[string]interface{}{"a": 3}},
+		&xsql.WatermarkTuple{Timestamp: 100},
+	}
+	go func() {
+		for _, input := range inputs {
+			l.input <- input
+		}
+	}()
+	// the results may be out of order
+	rows := make(map[interface{}]int)
+	for i := range inputs {
+		select {
+		case err := <-errCh:
+			t.Fatal(err)
+		case output := <-outputCh:
+			switch ot := output.(type) {
+			case *xsql.WatermarkTuple:
+				if i != len(inputs)-1 {
+					t.Errorf("expect the watermark after all the lookups in flight but got it at %d", i)
+				}
+			case *xsql.JoinTuples:
+				if len(ot.Content) > 0 {
+					rows[ot.Content[0].Tuples[0].(*xsql.Tuple).Message["a"]] = len(ot.Content)
+				}
+			default:
+				t.Fatalf("unexpected output %v", output)
+			}
+		case <-time.After(time.Second):
+			t.Fatal("receive message timeout")
+		}
+	}
+	exp := map[interface{}]int{1: 4, 2: 3, 3: 3}
+	if !reflect.DeepEqual(exp, rows) {
+		t.Errorf("expect rows %v but got %v", exp, rows)
+	}
+}
+
+func TestLookupAsyncOrdered(t *testing.T) {
+	l, errCh, outputCh := newTestLookupNodeOfType(t, "mockDelay", []string{}, ast.INNER_JOIN, &LookupConf{
+		LookupAsyncConf:  LookupAsyncConf{AsyncConcurrency: 3},
+		BroadcastTimeout: 1000,
+	})
+	// the later lookups complete first
+	delays := []int{150, 50, 10}
+	go func() {
+		for _, d := range delays {
+			l.input <- &xsql.Tuple{Emitter: "demo", Message: map[string]interface{}{"a": d}}
+		}
+	}()
+	for i, d := range delays {
+		select {
+		case err := <-errCh:
+			t.Fatal(err)
+		case output := <-outputCh:
+			if msgs := lookupMessages(output); len(msgs) != 1 || msgs[0]["delay"] != d {
+				t.Errorf("%d: expect the result of delay %d but got %v", i, d, output)
+			}
+		case <-time.After(time.Second):
+			t.Fatal("receive message timeout")
+		}
+	}
+	ls, err := lookup.Attach("mockDelay")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer lookup.Detach("mockDelay")
+	if c := ls.(*mockDelayLookupSrc).maxInflight.Load(); c != 3 {
+		t.Errorf("expect 3 lookups at the same time but got %d", c)
+	}
+}
+
+func TestLookupLatestWins(t *testing.T) {
+	ordered := false
+	l, errCh, outputCh := newTestLookupNodeOfType(t, "mockBlocking", []string{}, ast.INNER_JOIN, &LookupConf{
+		LookupAsyncConf: LookupAsyncConf{
+			Ordered:    &ordered,
+			LatestWins: true,
+		},
+	})
+	// wait for the node to attach the table
+	time.Sleep(100 * time.Millisecond)
+	ls, err := lookup.Attach("mockBlocking")
+	if err != nil {
+		t.Fatal(err)
+	}
+	_ = lookup.Detach("mockBlocking")
+	src := ls.(*mockBlockingLookupSrc)
+	// the first lookup blocks until superseded by the second one of the same key
+	l.input <- &xsql.Tuple{Emitter: "demo", Message: map[string]interface{}{"a": 1}}
+	for i := 0; i < 10 && src.calls.Load() == 0; i++ {
+		time.Sleep(50 * time.Millisecond)
+	}
+	msgs := lookupMessages(doLookup(t, l, errCh, outputCh, &xsql.Tuple{Emitter: "demo", Message: map[string]interface{}{"a": 1}}))
+	if len(msgs) != 1 || msgs[0]["call"] != 2 {
+		t.Errorf("expect the result of the latest lookup but got %v", msgs)
+	}
+	for i := 0; i < 10 && l.counters.Get(SupersededTotal) == 0; i++ {
+		time.Sleep(50 * time.Millisecond)
+	}
+	if c := l.counters.Get(SupersededTotal); c != 1 {
+		t.Errorf("expect superseded 1 but got %d", c)
+	}
+	select {
+	case output := <-outputCh:
+		t.Errorf("expect the superseded lookup dropped but got %v", output)
+	case <-time.After(100 * time.Millisecond):
+	}
+}
+
+func TestLookupCacheHandoff(t *testing.T) {
+	options := &ast.Options{
+		DATASOURCE:        "mock",
+		TYPE:              "mock",
+		STRICT_VALIDATION: true,
+		KIND:              "lookup",
+	}
+	lookup.CreateInstance("mock", "mock", options)
+	contextLogger := conf.Log.WithField("rule", t.Name())
+	input := &xsql.Tuple{Emitter: "demo", Message: map[string]interface{}{"a": 6}}
+	lc := func() *LookupConf {
+		return &LookupConf{Cache: true, EmitLatency: true}
+	}
+	tempStore, _ := state.CreateStore("handoffRule", api.AtMostOnce)
+	run := func() (*LookupNode, chan error, chan interface{}, func()) {
+		ctx, cancel := context.WithValue(context.Background(), context.LoggerKey, contextLogger).WithMeta("handoffRule", "op1", tempStore).WithCancel()
+		t.Cleanup(cancel)
+		l, errCh, outputCh := startTestLookupNode(t, ctx, options, []string{}, ast.INNER_JOIN, lc())
+		return l, errCh, outputCh, cancel
+	}
+	l1, errCh, outputCh, cancel := run()
+	_ = doLookup(t, l1, errCh, outputCh, input)
+	lookup.PrepareHandoff("handoffRule")
+	cancel()
+	// wait for the old node to park its cache
+	var parked *cache.Cache
+	for i := 0; i < 100 && parked == nil; i++ {
+		time.Sleep(10 * time.Millisecond)
+		parked = lookup.TakeCache(l1.handoffId)
+	}
+	if parked != l1.cache {
+		t.Fatal("expect the cache of the stopped node to be parked")
+	}
+	if !lookup.ParkCache("handoffRule", l1.handoffId, parked) {
+		t.Fatal("expect the rule to be updating")
+	}
+	l2, errCh, outputCh, _ := run()
+	if l2.cache != parked {
+		t.Fatal("expect the new node to take over the parked cache")
+	}
+	output := doLookup(t, l2, errCh, outputCh, input)
+	for _, c := range output.(*xsql.JoinTuples).Content {
+		if hit, _ := c.Tuples[1].(*xsql.Tuple).Meta(DefaultCacheHitName, ""); hit != true {
+			t.Errorf("expect cache hit of the taken over cache but got %v", hit)
+		}
+	}
+	// the conf is changed
+	changed := lc()
+	changed.CacheMissingKey = true
+	ctx, cancel := context.WithValue(context.Background(), context.LoggerKey, contextLogger).WithMeta("handoffRule", "op1", tempStore).WithCancel()
+	defer cancel()
+	l3, _, _ := startTestLookupNode(t, ctx, options, []string{}, ast.INNER_JOIN, changed)
+	if l3.handoffId == l2.handoffId {
+		t.Error("expect different handoff id for the changed conf")
+	}
+}
+
+func TestLookupEmitter(t *testing.T) {
+	l, errCh, outputCh := newTestLookupNode(t, []string{}, ast.INNER_JOIN, &LookupConf{
+		Emitter: "dim",
+	})
+	output := doLookup(t, l, errCh, outputCh, &xsql.Tuple{Emitter: "demo", Message: map[string]interface{}{"a": 6}})
+	jt, ok := output.(*xsql.JoinTuples)
+	if !ok || len(jt.Content) == 0 {
+		t.Fatalf("expect join tuples but got %v", output)
+	}
+	for _, c := range jt.Content {
+		if e := c.Tuples[1].GetEmitter(); e != "dim" {
+			t.Errorf("expect emitter dim but got %s", e)
+		}
+	}
+	if err := l.ValidateEmitter([]string{"demo", "mock"}); err != nil {
+		t.Errorf("unexpected error %v", err)
+	}
+	if err := l.ValidateEmitter([]string{"dim", "mock"}); err == nil || err.Error() != "lookup emitter dim of mock collides with the stream dim in the rule" {
+		t.Errorf("expect collision error but got %v", err)
+	}
+}
+
+func TestLookupLeftFields(t *testing.T) {
+	tests := []struct {
+		dropKeys bool
+		exp      xsql.Message
+	}{
+		{dropKeys: false, exp: xsql.Message{"a": 6, "b": 1}},
+		{dropKeys: true, exp: xsql.Message{"b": 1}},
+	}
+	for i, tt := range tests {
+		l, errCh, outputCh := newTestLookupNode(t, []string{}, ast.INNER_JOIN, &LookupConf{
+			LeftFields:   []string{"b"},
+			LeftDropKeys: tt.dropKeys,
+		})
+		input := &xsql.Tuple{Emitter: "demo", Message: map[string]interface{}{"a": 6, "b": 1, "c": 2}, Metadata: map[string]interface{}{"topic": "demo"}}
+		output := doLookup(t, l, errCh, outputCh, input)
+		jt, ok := output.(*xsql.JoinTuples)
+		if !ok || len(jt.Content) == 0 {
+			t.Fatalf("case %d: expect join tuples but got %v", i, output)
+		}
+		for _, c := range jt.Content {
+			left := c.Tuples[0].(*xsql.Tuple)
+			if !reflect.DeepEqual(tt.exp, left.Message) {
+				t.Errorf("case %d: expect left row %v but got %v", i, tt.exp, left.Message)
+			}
+			if v, ok := left.Meta("topic", ""); !ok || v != "demo" {
+				t.Errorf("case %d: expect the metadata of the left row kept but got %v", i, v)
+			}
+		}
+		if len(input.Message) != 3 {
+			t.Errorf("case %d: expect the input unchanged but got %v", i, input.Message)
+		}
+	}
+}
+
+func TestLookupFieldAliases(t *testing.T) {
+	// the fields source returns the queried field names as the values
+	l, errCh, outputCh := newTestLookupNodeOfType(t, "mockFields", []string{"aliasA", "newB"}, ast.INNER_JOIN, &LookupConf{
+		FieldAliases: map[string]string{"newA": "aliasA"},
+	})
+	if exp := []string{"newA", "newB"}; !reflect.DeepEqual(exp, l.fields) {
+		t.Errorf("expect to query fields %v but got %v", exp, l.fields)
+	}
+	output := doLookup(t, l, errCh, outputCh, &xsql.Tuple{Emitter: "demo", Message: map[string]interface{}{"a": 6, "newA": 6}})
+	exp := []map[string]interface{}{{"aliasA": "newA", "newB": "newB"}}
+	if r := lookupMessages(output); !reflect.DeepEqual(exp, r) {
+		t.Errorf("expect %v but got %v", exp, r)
+	}
+	if v, ok := output.(*xsql.JoinTuples).Content[0].ToMap()["aliasA"]; !ok || v != "newA" {
+		t.Errorf("expect the aliased field in the merged row but got %v", v)
+	}
+
+	tests := []struct {
+		aliases map[string]string
+		err     string
+	}{
+		{aliases: map[string]string{"a": ""}, err: "invalid lookup fieldAliases, the alias of a is empty"},
+		{aliases: map[string]string{"a": "c", "b": "c"}, err: "invalid lookup fieldAliases, a and b have the same alias c"},
+		{aliases: map[string]string{"a": "b", "b": "c"}, err: "invalid lookup fieldAliases, the alias b of a is also an aliased field"},
+	}
+	for i, tt := range tests {
+		if err := (&LookupNode{}).applyConf(&LookupConf{FieldAliases: tt.aliases}); err == nil || err.Error() != tt.err {
+			t.Errorf("case %d: expect error %s but got %v", i, tt.err, err)
+		}
+	}
+}
+
+func TestLookupCacheStaleWhileRevalidate(t *testing.T) {
+	l, errCh, outputCh := newTestLookupNodeOfType(t, "mockSnapshot", []string{}, ast.INNER_JOIN, &LookupConf{
+		Cache:                     true,
+		CacheTTL:                  10,
+		CacheStaleWhileRevalidate: true,
+	})
+	version := func() interface{} {
+		msgs := lookupMessages(doLookup(t, l, errCh, outputCh, &xsql.Tuple{Emitter: "demo", Message: map[string]interface{}{"a": 1}}))
+		if len(msgs) != 1 {
+			t.Fatalf("expect 1 lookup row but got %v", msgs)
+		}
+		return msgs[0]["version"]
+	}
+	if v := version(); v != 1 {
+		t.Fatalf("expect version 1 but got %v", v)
+	}
+	conf.Clock.(*clock.Mock).Add(11 * time.Second)
+	if v := version(); v != 1 {
+		t.Errorf("expect the stale version 1 but got %v", v)
+	}
+	for i := 0; i < 20; i++ {
+		if r, ok := l.cache.Get(cacheKey([]interface{}{1})); ok && r[0].Message()["version"] == 2 {
+			break
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+	if v := version(); v != 2 {
+		t.Errorf("expect the refreshed version 2 but got %v", v)
+	}
+	if s := l.counters.Get(StaleServedTotal); s != 1 {
+		t.Errorf("expect 1 stale result served but got %d", s)
+	}
+}
+
+func TestLookupCacheConditions(t *testing.T) {
+	l, errCh, outputCh := newTestLookupNode(t, []string{}, ast.LEFT_JOIN, &LookupConf{
+		Cache:             true,
+		CacheNonEmptyOnly: true,
+		CacheMaxRows:      2,
+	})
+	// 0 has no result, 1 has 4 rows and 6 has 2 rows in the mock source
+	for _, a := range []int{0, 1, 6} {
+		_ = doLookup(t, l, errCh, outputCh, &xsql.Tuple{Emitter: "demo", Message: map[string]interface{}{"a": a}})
+	}
+	for a, exp := range map[int]bool{0: false, 1: false, 6: true} {
+		if _, ok := l.cache.Get(cacheKey([]interface{}{a})); ok != exp {
+			t.Errorf("expect the result of %d cached %v but got %v", a, exp, ok)
+		}
+	}
+	names, values := l.GetExtraMetrics()
+	for i, name := range names {
+		if name == CacheSkippedTotal && values[i] != int64(2) {
+			t.Errorf("expect 2 skipped results but got %v", values[i])
+		}
+	}
+	if err := (&LookupNode{}).applyConf(&LookupConf{CacheNonEmptyOnly: true, CacheMissingKey: true}); err == nil {
+		t.Error("expect error for cacheNonEmptyOnly with cacheMissingKey")
+	}
+}
+
+// mockCacheBackend records the keys set to the backend
+type mockCacheBackend struct {
+	sync.Mutex
+	items map[string][]api.SourceTuple
+}
+
+func (b *mockCacheBackend) Get(key string) ([]api.SourceTuple, bool) {
+	b.Lock()
+	defer b.Unlock()
+	v, ok := b.items[key]
+	return v, ok
+}
+
+func (b *mockCacheBackend) Set(key string, value []api.SourceTuple, _ time.Duration) {
+	b.Lock()
+	defer b.Unlock()
+	b.items[key] = value
+}
+
+func (b *mockCacheBackend) Delete(key string) {
+	b.Lock()
+	defer b.Unlock()
+	delete(b.items, key)
+}
+
+func (b *mockCacheBackend) Clear() {
+	b.Lock()
+	defer b.Unlock()
+	b.items = make(map[string][]api.SourceTuple)
+}
+
+func (b *mockCacheBackend) Close() {}
+
+func TestLookupCacheBackend(t *testing.T) {
+	b := &mockCacheBackend{items: make(map[string][]api.SourceTuple)}
+	cache.RegisterBackend("mockBackend", func(_ string, _ map[string]interface{}) (cache.Backend, error) {
+		return b, nil
+	})
+	l, errCh, outputCh := newTestLookupNode(t, []string{}, ast.INNER_JOIN, &LookupConf{
+		Cache:        true,
+		CacheBackend: "mockBackend",
+	})
+	_ = doLookup(t, l, errCh, outputCh, &xsql.Tuple{Emitter: "demo", Message: map[string]interface{}{"a": 6}})
+	if r, ok := b.Get(cacheKey([]interface{}{6})); !ok || len(r) != 2 {
+		t.Errorf("expect the result cached in the backend but got %v", r)
+	}
+	// the result is served by the backend
+	b.Set(cacheKey([]interface{}{6}), []api.SourceTuple{api.NewDefaultSourceTuple(map[string]interface{}{"newA": 100}, nil)}, 0)
+	if msgs := lookupMessages(doLookup(t, l, errCh, outputCh, &xsql.Tuple{Emitter: "demo", Message: map[string]interface{}{"a": 6}})); len(msgs) != 1 || msgs[0]["newA"] != 100 {
+		t.Errorf("expect the result from the backend but got %v", msgs)
+	}
+	if err := (&LookupNode{}).applyConf(&LookupConf{CacheBackend: "redis", CacheSliding: true}); err == nil {
+		t.Error("expect error for cacheSliding with redis backend")
+	}
+}
+
+func TestLookupUpdateCacheOptions(t *testing.T) {
+	l, errCh, outputCh := newTestLookupNode(t, []string{}, ast.LEFT_JOIN, &LookupConf{
+		Cache:           true,
+		CacheMissingKey: true,
+	})
+	// 0 has no result in the mock source
+	_ = doLookup(t, l, errCh, outputCh, &xsql.Tuple{Emitter: "demo", Message: map[string]interface{}{"a": 0}})
+	if _, ok := l.cache.Get(cacheKey([]interface{}{0})); !ok {
+		t.Fatal("expect the missing key cached")
+	}
+	off := false
+	if err := l.UpdateCacheOptions(&CacheOptions{CacheMissingKey: &off, CacheTTL: "10s"}); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := l.cache.Get(cacheKey([]interface{}{0})); ok {
+		t.Error("expect the cached miss removed")
+	}
+	_ = doLookup(t, l, errCh, outputCh, &xsql.Tuple{Emitter: "demo", Message: map[string]interface{}{"a": 0}})
+	if _, ok := l.cache.Get(cacheKey([]interface{}{0})); ok {
+		t.Error("expect the missing key not cached after update")
+	}
+	if err := l.UpdateCacheOptions(&CacheOptions{CacheTTL: "invalid"}); err == nil {
+		t.Error("expect error for invalid ttl")
+	}
+	nl, _, _ := newTestLookupNode(t, []string{}, ast.LEFT_JOIN, &LookupConf{})
+	if err := nl.UpdateCacheOptions(&CacheOptions{}); err == nil {
+		t.Error("expect error when cache is not enabled")
+	}
+}
+
+func TestLookupCacheMaxValueBytes(t *testing.T) {
+	// the result of 6 in the mock source
+	limit := cache.EstimateSize([]api.SourceTuple{
+		api.NewDefaultSourceTuple(map[string]interface{}{"newA": 1, "newB": 2}, nil),
+		api.NewDefaultSourceTuple(map[string]interface{}{"newA": 6, "newB": 12}, nil),
+	})
+	l, errCh, outputCh := newTestLookupNode(t, []string{}, ast.INNER_JOIN, &LookupConf{
+		Cache:              true,
+		CacheMaxValueBytes: limit,
+	})
+	// 1 has 4 rows which is larger
+	for _, a := range []int{1, 6} {
+		if msgs := lookupMessages(doLookup(t, l, errCh, outputCh, &xsql.Tuple{Emitter: "demo", Message: map[string]interface{}{"a": a}})); len(msgs) == 0 {
+			t.Errorf("expect the result of %d joined", a)
+		}
+	}
+	for a, exp := range map[int]bool{1: false, 6: true} {
+		if _, ok := l.cache.Get(cacheKey([]interface{}{a})); ok != exp {
+			t.Errorf("expect the result of %d cached %v but got %v", a, exp, ok)
+		}
+	}
+	if c := l.counters.Get(CacheOversizedTotal); c != 1 {
+		t.Errorf("expect 1 oversized result but got %d", c)
+	}
+}
+
+func TestLookupCacheSize(t *testing.T) {
+	l, errCh, outputCh := newTestLookupNode(t, []string{}, ast.INNER_JOIN, &LookupConf{
+		Cache:     true,
+		CacheSize: 1,
+	})
+	for _, a := range []int{6, 1} {
+		_ = doLookup(t, l, errCh, outputCh, &xsql.Tuple{Emitter: "demo", Message: map[string]interface{}{"a": a}})
+	}
+	if _, ok := l.cache.Get(cacheKey([]interface{}{6})); ok {
+		t.Error("expect the least recently used result of 6 evicted")
+	}
+	if _, ok := l.cache.Get(cacheKey([]interface{}{1})); !ok {
+		t.Error("expect the result of 1 cached")
+	}
+	names, values := l.GetExtraMetrics()
+	metrics := make(map[string]interface{}, len(names))
+	for i, name := range names {
+		metrics[name] = values[i]
+	}
+	if metrics[CacheEvictionsTotal] != int64(1) {
+		t.Errorf("expect 1 eviction but got %v", metrics[CacheEvictionsTotal])
+	}
+	if err := (&LookupNode{}).applyConf(&LookupConf{CacheSize: -1}); err == nil || !strings.HasPrefix(err.Error(), "invalid lookup cacheSize -1") {
+		t.Errorf("expect error for negative cache size but got %v", err)
+	}
+}
+
+func TestLookupCacheCompress(t *testing.T) {
+	l, errCh, outputCh := newTestLookupNode(t, []string{}, ast.INNER_JOIN, &LookupConf{
+		Cache:                 true,
+		CacheCompress:         "zstd",
+		CacheCompressMinBytes: 1,
+	})
+	var results [][]map[string]interface{}
+	for i := 0; i < 2; i++ {
+		results = append(results, lookupMessages(doLookup(t, l, errCh, outputCh, &xsql.Tuple{Emitter: "demo", Message: map[string]interface{}{"a": 6}})))
+	}
+	// the second result is decompressed from the cache
+	exp := []map[string]interface{}{{"newA": 1, "newB": 2}, {"newA": 6, "newB": 12}}
+	for i, r := range results {
+		if !reflect.DeepEqual(exp, r) {
+			t.Errorf("%d: expect %v but got %v", i, exp, r)
+		}
+	}
+	if r, ok := l.cache.Get(cacheKey([]interface{}{6})); !ok || len(r) != 2 || !reflect.DeepEqual(exp[1], r[1].Message()) {
+		t.Errorf("expect the result of 6 cached but got %v", r)
+	}
+	if err := (&LookupNode{}).applyConf(&LookupConf{CacheCompress: "lz4"}); err == nil || !strings.HasPrefix(err.Error(), "invalid lookup cacheCompress lz4") {
+		t.Errorf("expect error for unknown codec but got %v", err)
+	}
+}
+
+func TestLookupCacheMissingKeyTTL(t *testing.T) {
+	l, errCh, outputCh := newTestLookupNode(t, []string{}, ast.LEFT_JOIN, &LookupConf{
+		Cache:              true,
+		CacheTTL:           "10s",
+		CacheMissingKey:    true,
+		CacheMissingKeyTTL: "1s",
+	})
+	// 0 has no result in the mock source
+	for _, a := range []int{0, 6} {
+		_ = doLookup(t, l, errCh, outputCh, &xsql.Tuple{Emitter: "demo", Message: map[string]interface{}{"a": a}})
+	}
+	conf.Clock.(*clock.Mock).Add(2 * time.Second)
+	if _, ok := l.cache.Get(cacheKey([]interface{}{0})); ok {
+		t.Error("expect the cached miss expired by cacheMissingKeyTtl")
+	}
+	if _, ok := l.cache.Get(cacheKey([]interface{}{6})); !ok {
+		t.Error("expect the result of 6 kept by cacheTtl")
+	}
+	if err := (&LookupNode{}).applyConf(&LookupConf{CacheMissingKeyTTL: "invalid"}); err == nil {
+		t.Error("expect error for invalid cacheMissingKeyTtl")
+	}
+}
+
+func TestLookupCachedMisses(t *testing.T) {
+	l, errCh, outputCh := newTestLookupNode(t, []string{}, ast.LEFT_JOIN, &LookupConf{
+		Cache:           true,
+		CacheMissingKey: true,
+	})
+	// 0 has no result in the mock source
+	for _, a := range []int{0, 0, 6, 0} {
+		_ = doLookup(t, l, errCh, outputCh, &xsql.Tuple{Emitter: "demo", Message: map[string]interface{}{"a": a}})
+	}
+	names, values := l.GetExtraMetrics()
+	metrics := make(map[string]interface{}, len(names))
+	for i, name := range names {
+		metrics[name] = values[i]
+	}
+	if metrics[CachedMisses] != int64(1) {
+		t.Errorf("expect 1 cached miss but got %v", metrics[CachedMisses])
+	}
+	if metrics[CachedMissHitsTotal] != int64(2) {
+		t.Errorf("expect 2 hits of the cached miss but got %v", metrics[CachedMissHitsTotal])
+	}
+	var keys []string
+	l.cache.RangeMisses(func(key string, _ time.Time) bool {
+		keys = append(keys, key)
+		return true
+	})
+	if exp := []string{cacheKey([]interface{}{0})}; !reflect.DeepEqual(exp, keys) {
+		t.Errorf("expect cached misses %v but got %v", exp, keys)
+	}
+}
+
+func TestLookupCacheMetrics(t *testing.T) {
+	l, errCh, outputCh := newTestLookupNode(t, []string{}, ast.INNER_JOIN, &LookupConf{
+		Cache: true,
+	})
+	for _, a := range []int{6, 6, 1} {
+		_ = doLookup(t, l, errCh, outputCh, &xsql.Tuple{Emitter: "demo", Message: map[string]interface{}{"a": a}})
+	}
+	names, values := l.GetExtraMetrics()
+	metrics := make(map[string]interface{}, len(names))
+	for i, name := range names {
+		metrics[name] = values[i]
+	}
+	exp := map[string]interface{}{
+		CacheHitsTotal:      int64(1),
+		CacheMissesTotal:    int64(2),
+		CacheChangesTotal:   int64(0),
+		CacheItems:          int64(2),
+		CacheEvictionsTotal: int64(0),
+	}
+	if !reflect.DeepEqual(exp, metrics) {
+		t.Errorf("expect metrics %v but got %v", exp, metrics)
+	}
+}
+
+func TestLookupChangeNotification(t *testing.T) {
+	l, errCh, outputCh := newTestLookupNodeOfType(t, "mockNotify", []string{}, ast.INNER_JOIN, &LookupConf{
+		Cache: true,
+	})
+	input := &xsql.Tuple{Emitter: "demo", Message: map[string]interface{}{"a": 1}}
+	ls, err := lookup.Attach("mockNotify")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = lookup.Detach("mockNotify") }()
+	src := ls.(*mockNotifyLookupSrc)
+	tests := []struct {
+		key   string
+		value interface{}
+		exp   []map[string]interface{}
+	}{
+		{ // cached
+			exp: []map[string]interface{}{{"version": 1}},
+		},
+		{ // other key value changed
+			key:   "a",
+			value: 2,
+			exp:   []map[string]interface{}{{"version": 1}},
+		},
+		{
+			key:   "a",
+			value: 1,
+			exp:   []map[string]interface{}{{"version": 2}},
+		},
+		{ // not the lookup key, clear all
+			key:   "b",
+			value: 1,
+			exp:   []map[string]interface{}{{"version": 3}},
+		},
+		{ // the only key of the source
+			key:   "",
+			value: 1,
+			exp:   []map[string]interface{}{{"version": 4}},
+		},
+	}
+	output := doLookup(t, l, errCh, outputCh, input)
+	if exp := []map[string]interface{}{{"version": 1}}; !reflect.DeepEqual(exp, lookupMessages(output)) {
+		t.Fatalf("expect %v but got %v", exp, lookupMessages(output))
+	}
+	for i, tt := range tests {
+		if tt.value != nil {
+			src.notify(tt.key, tt.value)
+		}
+		output = doLookup(t, l, errCh, outputCh, input)
+		if !reflect.DeepEqual(tt.exp, lookupMessages(output)) {
+			t.Errorf("case %d: expect %v but got %v", i, tt.exp, lookupMessages(output))
+		}
+	}
+	if c := l.counters.Get(CacheChangesTotal); c != 4 {
+		t.Errorf("expect 4 changes but got %d", c)
+	}
+}
+
+func TestLookupChangeRefresh(t *testing.T) {
+	l, errCh, outputCh := newTestLookupNodeOfType(t, "mockNotify", []string{}, ast.INNER_JOIN, &LookupConf{
+		Cache:         true,
+		CacheOnChange: CacheOnChangeRefresh,
+	})
+	input := &xsql.Tuple{Emitter: "demo", Message: map[string]interface{}{"a": 1}}
+	ls, err := lookup.Attach("mockNotify")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = lookup.Detach("mockNotify") }()
+	src := ls.(*mockNotifyLookupSrc)
+	if r := lookupMessages(doLookup(t, l, errCh, outputCh, input)); !reflect.DeepEqual([]map[string]interface{}{{"version": 1}}, r) {
+		t.Fatalf("expect version 1 but got %v", r)
+	}
+	// the not cached key is not refreshed
+	src.notify("a", 2)
+	src.notify("a", 1)
+	timeout := time.After(time.Second)
+	for {
+		if r, ok := l.cache.Get(cacheKey([]interface{}{1})); ok && len(r) == 1 && r[0].Message()["version"] == 2 {
+			break
+		}
+		select {
+		case <-timeout:
+			t.Fatal("refresh timeout")
+		case <-time.After(10 * time.Millisecond):
+		}
+	}
+	// the refreshed result is hit
+	if r := lookupMessages(doLookup(t, l, errCh, outputCh, input)); !reflect.DeepEqual([]map[string]interface{}{{"version": 2}}, r) {
+		t.Errorf("expect the refreshed version 2 but got %v", r)
+	}
+	if c := l.counters.Get(CacheHitsTotal); c != 1 {
+		t.Errorf("expect 1 cache hit but got %d", c)
+	}
+	if err := (&LookupNode{}).applyConf(&LookupConf{CacheOnChange: "update"}); err == nil {
+		t.Error("expect error for invalid cacheOnChange")
+	}
+}
+
+// rawLookupInput is a custom input of the raw payload of the lookup value
+type mockLookupSpan struct {
+	name    string
+	carrier map[string]interface{}
+	attrs   map[string]interface{}
+	ended   bool
+}
+
+func (s *mockLookupSpan) SetAttribute(key string, value interface{}) {
+	s.attrs[key] = value
+}
+
+func (s *mockLookupSpan) End(_ error) {
+	s.ended = true
+}
+
+type mockLookupTracer struct {
+	sync.Mutex
+	spans []*mockLookupSpan
+}
+
+func (m *mockLookupTracer) Start(_ api.StreamContext, name string, carrier map[string]interface{}) LookupSpan {
+	m.Lock()
+	defer m.Unlock()
+	s := &mockLookupSpan{name: name, carrier: carrier, attrs: make(map[string]interface{})}
+	m.spans = append(m.spans, s)
+	return s
+}
+
+func TestLookupTrace(t *testing.T) {
+	tracer := &mockLookupTracer{}
+	RegisterLookupTracer(tracer)
+	defer RegisterLookupTracer(nil)
+	l, errCh, outputCh := newTestLookupNode(t, []string{}, ast.INNER_JOIN, &LookupConf{Cache: true})
+	meta := map[string]interface{}{"traceparent": "00-0af7651916cd43dd8448eb211c80319c-b7ad6b7169203331-01"}
+	for i := 0; i < 2; i++ {
+		_ = doLookup(t, l, errCh, outputCh, &xsql.Tuple{Emitter: "demo", Message: map[string]interface{}{"a": 6}, Metadata: meta})
+	}
+	tracer.Lock()
+	defer tracer.Unlock()
+	if len(tracer.spans) != 2 {
+		t.Fatalf("expect 2 spans but got %d", len(tracer.spans))
+	}
+	for i, s := range tracer.spans {
+		if !s.ended || s.name != "lookup mock" {
+			t.Errorf("unexpected span %d %v", i, s)
+		}
+		if !reflect.DeepEqual(meta, s.carrier) {
+			t.Errorf("expect the trace context of the metadata but got %v", s.carrier)
+		}
+		exp := map[string]interface{}{"lookup.table": "mock", "lookup.cacheHit": i == 1, "lookup.keys": 1, "lookup.rows": 2}
+		if !reflect.DeepEqual(exp, s.attrs) {
+			t.Errorf("expect span %d attributes %v but got %v", i, exp, s.attrs)
+		}
+	}
+}
+
+type rawLookupInput []byte
+
+func TestLookupInputExtractor(t *testing.T) {
+	RegisterLookupInputExtractor(rawLookupInput(nil), func(input interface{}) (xsql.TupleRow, error) {
+		a, err := strconv.Atoi(string(input.(rawLookupInput)))
+		if err != nil {
+			return nil, err
+		}
+		return &xsql.Tuple{Emitter: "raw", Message: map[string]interface{}{"a": a}}, nil
+	})
+	l, errCh, outputCh := newTestLookupNode(t, []string{}, ast.INNER_JOIN, &LookupConf{})
+	l.sendError = true
+	exp := lookupMessages(doLookup(t, l, errCh, outputCh, &xsql.Tuple{Emitter: "demo", Message: map[string]interface{}{"a": 6}}))
+	if len(exp) == 0 {
+		t.Fatal("expect lookup results of the tuple input")
+	}
+	if r := lookupMessages(doLookup(t, l, errCh, outputCh, rawLookupInput("6"))); !reflect.DeepEqual(exp, r) {
+		t.Errorf("expect %v for the custom input but got %v", exp, r)
+	}
+	output := doLookup(t, l, errCh, outputCh, rawLookupInput("x"))
+	var ie *InvalidInputError
+	if err, ok := output.(error); !ok || !errors.As(err, &ie) || !strings.Contains(err.Error(), "fail to extract the input node.rawLookupInput") {
+		t.Errorf("expect invalid input error of extraction but got %v", output)
+	}
+}
+
+func TestLookupErrors(t *testing.T) {
+	l, errCh, outputCh := newTestLookupNode(t, []string{"newA", "newC"}, ast.INNER_JOIN, &LookupConf{
+		StrictFields: true,
+	})
+	l.sendError = true
+	output := doLookup(t, l, errCh, outputCh, &xsql.Tuple{
+		Emitter: "demo",
+		Message: map[string]interface{}{"a": 6},
+	})
+	var re *LookupResultError
+	if err, ok := output.(error); !ok || !errors.As(err, &re) || re.LookupTable() != "mock" {
+		t.Errorf("expect lookup result error but got %v", output)
+	}
+	output = doLookup(t, l, errCh, outputCh, 100)
+	var ie *InvalidInputError
+	if err, ok := output.(error); !ok || !errors.As(err, &ie) || err.Error() != "run lookup node error: invalid input type but got int(100)" {
+		t.Errorf("expect invalid input error but got %v", output)
+	}
+
+	srcErr := errors.New("connection refused")
+	err := newLookupSourceError("mock", srcErr)
+	var se *LookupSourceError
+	if !errors.As(err, &se) || !errors.Is(err, srcErr) || err.Error() != "connection refused" {
+		t.Errorf("expect lookup source error but got %v", err)
+	}
+	err = newLookupSourceError("mock", fmt.Errorf("query error: %w", os.ErrDeadlineExceeded))
+	var te *LookupTimeoutError
+	if !errors.As(err, &te) || te.LookupTable() != "mock" {
+		t.Errorf("expect lookup timeout error but got %v", err)
+	}
+	err = &LookupSourceError{Table: "mock", Op: "detach", Err: srcErr}
+	if err.Error() != "detach lookup source mock error: connection refused" {
+		t.Errorf("unexpected detach error message %s", err.Error())
+	}
+}
+
+func TestLookupSideOutput(t *testing.T) {
+	l, errCh, outputCh := newTestLookupNode(t, []string{}, ast.INNER_JOIN, nil)
+	sideCh := make(chan interface{}, 1)
+	if err := l.GetSideEmitter().AddOutput(sideCh, "dlq"); err != nil {
+		t.Fatal(err)
+	}
+	miss := &xsql.Tuple{
+		Emitter: "demo",
+		Message: map[string]interface{}{"a": 210},
+	}
+	doLookup(t, l, errCh, outputCh, miss)
+	select {
+	case output := <-sideCh:
+		if !reflect.DeepEqual(miss, output) {
+			t.Errorf("expect %v in side output but got %v", miss, output)
+		}
+	case <-time.After(1 * time.Second):
+		t.Fatal("receive side output timeout")
+	}
+	// matched rows are not sent to the side output
+	output := doLookup(t, l, errCh, outputCh, &xsql.WindowTuples{
+		Content: []xsql.TupleRow{
+			&xsql.Tuple{Emitter: "demo", Message: map[string]interface{}{"a": 6}},
+			miss,
+		},
+	})
+	if len(output.(*xsql.JoinTuples).Content) != 2 {
+		t.Errorf("expect 2 joined rows but got %v", output)
+	}
+	select {
+	case output := <-sideCh:
+		wt, ok := output.(*xsql.WindowTuples)
+		if !ok || len(wt.Content) != 1 || !reflect.DeepEqual(miss, wt.Content[0]) {
+			t.Errorf("expect window of the unmatched row in side output but got %v", output)
+		}
+	case <-time.After(1 * time.Second):
+		t.Fatal("receive side output timeout")
+	}
+}
+
+func TestLookupWindowSummary(t *testing.T) {
+	l, errCh, outputCh := newTestLookupNode(t, []string{}, ast.INNER_JOIN, &LookupConf{
+		WindowSummary:       SummaryAppend,
+		WindowSummaryFields: []string{SummaryRows, SummaryMatched, SummaryMissed, SummaryResults, SummaryAvgFanout, SummaryWindowEnd},
+	})
+	summaryCh := make(chan interface{}, 1)
+	if err := l.GetSummaryEmitter().AddOutput(summaryCh, "stats"); err != nil {
+		t.Fatal(err)
+	}
+	output := doLookup(t, l, errCh, outputCh, &xsql.WindowTuples{
+		Content: []xsql.TupleRow{
+			&xsql.Tuple{Emitter: "demo", Message: map[string]interface{}{"a": 6}},
+			&xsql.Tuple{Emitter: "demo", Message: map[string]interface{}{"a": 1}},
+			&xsql.Tuple{Emitter: "demo", Message: map[string]interface{}{"a": 210}},
+		},
+		WindowRange: xsql.NewWindowRange(1000, 2000),
+	})
+	if len(output.(*xsql.JoinTuples).Content) != 6 {
+		t.Errorf("expect 6 joined rows but got %v", output)
+	}
+	exp := xsql.Message{
+		SummaryRows:      3,
+		SummaryMatched:   2,
+		SummaryMissed:    1,
+		SummaryResults:   6,
+		SummaryAvgFanout: 3.0,
+		SummaryWindowEnd: int64(2000),
+	}
+	select {
+	case output := <-summaryCh:
+		if tu, ok := output.(*xsql.Tuple); !ok || tu.Emitter != "mock" || !reflect.DeepEqual(exp, tu.Message) {
+			t.Errorf("expect summary %v but got %v", exp, output)
+		}
+	case <-time.After(1 * time.Second):
+		t.Fatal("receive summary timeout")
+	}
+
+	tests := []struct {
+		lc  *LookupConf
+		err string
+	}{
+		{lc: &LookupConf{WindowSummary: "all"}, err: "invalid lookup windowSummary all, must be append or only"},
+		{lc: &LookupConf{WindowSummary: SummaryOnly, WindowSummaryFields: []string{"count"}}, err: "invalid lookup windowSummaryFields count, must be rows, matched, missed, results, avgFanout, windowStart or windowEnd"},
+	}
+	for i, tt := range tests {
+		if err := (&LookupNode{}).applyConf(tt.lc); err == nil || err.Error() != tt.err {
+			t.Errorf("case %d: expect error %s but got %v", i, tt.err, err)
+		}
+	}
+}
+
+func TestLookupAggregateValues(t *testing.T) {
+	stmt, err := xsql.NewParser(strings.NewReader("select max(a) from demo")).Parse()
+	if err != nil {
+		t.Fatal(err)
+	}
+	options := &ast.Options{
+		DATASOURCE: "mock",
+		TYPE:       "mock",
+		KIND:       "lookup",
+	}
+	lookup.CreateInstance("mock", "mock", options)
+	contextLogger := conf.Log.WithField("rule", t.Name())
+	ctx, cancel := context.WithValue(context.Background(), context.LoggerKey, contextLogger).WithCancel()
+	defer cancel()
+	l, err := NewLookupNode("mock", []string{}, []string{"a"}, ast.INNER_JOIN, []ast.Expr{stmt.Fields[0].Expr}, options, &api.RuleOption{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	errCh := make(chan error)
+	outputCh := make(chan interface{}, 1)
+	l.outputs["mock"] = outputCh
+	l.Exec(ctx, errCh)
+	// The aggregate is calculated over the window, so all rows look up with the max value 6
+	output := doLookup(t, l, errCh, outputCh, &xsql.WindowTuples{
+		Content: []xsql.TupleRow{
+			&xsql.Tuple{Emitter: "demo", Message: map[string]interface{}{"a": 1}},
+			&xsql.Tuple{Emitter: "demo", Message: map[string]interface{}{"a": 6}},
+		},
+	})
+	exp := []map[string]interface{}{
+		{"newA": 1, "newB": 2},
+		{"newA": 6, "newB": 12},
+		{"newA": 1, "newB": 2},
+		{"newA": 6, "newB": 12},
+	}
+	if !reflect.DeepEqual(exp, lookupMessages(output)) {
+		t.Errorf("expect %v but got %v", exp, lookupMessages(output))
+	}
+	// The aggregate is calculated over the row itself for tuple input
+	output = doLookup(t, l, errCh, outputCh, &xsql.Tuple{Emitter: "demo", Message: map[string]interface{}{"a": 1}})
+	if c := len(lookupMessages(output)); c != 4 {
+		t.Errorf("expect 4 rows but got %v", output)
+	}
+}
+
+func TestLookupMetaValues(t *testing.T) {
+	stmt, err := xsql.NewParser(strings.NewReader("select meta(topic), mqtt(topic) from demo")).Parse()
+	if err != nil {
+		t.Fatal(err)
+	}
+	options := &ast.Options{
+		DATASOURCE: "mock",
+		TYPE:       "mock",
+		KIND:       "lookup",
+	}
+	lookup.CreateInstance("mock", "mock", options)
+	contextLogger := conf.Log.WithField("rule", t.Name())
+	ctx, cancel := context.WithValue(context.Background(), context.LoggerKey, contextLogger).WithCancel()
+	defer cancel()
+	l, err := NewLookupNode("mock", []string{}, []string{"a"}, ast.INNER_JOIN, []ast.Expr{stmt.Fields[0].Expr}, options, &api.RuleOption{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the lookup values are evaluated from the metadata rather than the message
+	fv, afv := xsql.NewFunctionValuersForOp(ctx)
+	tuple := &xsql.Tuple{Emitter: "demo", Message: map[string]interface{}{"a": 1, "topic": 1}, Metadata: map[string]interface{}{"topic": 6}}
+	if cvs := l.lookupValues(l.valuerEval(tuple, nil, fv, afv)); !reflect.DeepEqual([]interface{}{6}, cvs) {
+		t.Errorf("expect lookup values [6] but got %v", cvs)
+	}
+	mqttTuple := &xsql.Tuple{Emitter: "demo", Message: map[string]interface{}{"topic": "other"}, Metadata: map[string]interface{}{"topic": "devices/6"}}
+	l.vals = []ast.Expr{stmt.Fields[0].Expr, stmt.Fields[1].Expr}
+	if cvs := l.lookupValues(l.valuerEval(mqttTuple, nil, fv, afv)); !reflect.DeepEqual([]interface{}{"devices/6", "devices/6"}, cvs) {
+		t.Errorf("expect lookup values [devices/6 devices/6] but got %v", cvs)
+	}
+	l.vals = []ast.Expr{stmt.Fields[0].Expr}
+	if err := l.applyConf(&LookupConf{StrictInput: true}); err != nil {
+		t.Fatal(err)
+	}
+	errCh := make(chan error)
+	outputCh := make(chan interface{}, 1)
+	l.outputs["mock"] = outputCh
+	l.Exec(ctx, errCh)
+	exp := []map[string]interface{}{
+		{"newA": 1, "newB": 2},
+		{"newA": 6, "newB": 12},
+	}
+	output := doLookup(t, l, errCh, outputCh, tuple)
+	if !reflect.DeepEqual(exp, lookupMessages(output)) {
+		t.Errorf("expect %v but got %v", exp, lookupMessages(output))
+	}
+	// the rows of a window are looked up by their own metadata
+	output = doLookup(t, l, errCh, outputCh, &xsql.WindowTuples{
+		Content: []xsql.TupleRow{
+			&xsql.Tuple{Emitter: "demo", Message: map[string]interface{}{"a": 1}, Metadata: map[string]interface{}{"topic": 6}},
+			&xsql.Tuple{Emitter: "demo", Message: map[string]interface{}{"a": 6}},
+		},
+	})
+	if !reflect.DeepEqual(exp, lookupMessages(output)) {
+		t.Errorf("expect %v but got %v", exp, lookupMessages(output))
+	}
+}
+
+func TestLookupFieldsExpr(t *testing.T) {
+	l, errCh, outputCh := newTestLookupNodeOfType(t, "mockFields", []string{"name"}, ast.INNER_JOIN, &LookupConf{
+		Cache:      true,
+		FieldsExpr: "CASE type WHEN 'device' THEN 'model, vendor' WHEN 'bad' THEN 1 ELSE fields END",
+	})
+	tests := []struct {
+		msg map[string]interface{}
+		exp []map[string]interface{}
+	}{
+		{
+			msg: map[string]interface{}{"a": 1, "type": "device"},
+			exp: []map[string]interface{}{{"model": "model", "vendor": "vendor"}},
+		},
+		{
+			msg: map[string]interface{}{"a": 1, "type": "user", "fields": []interface{}{"owner"}},
+			exp: []map[string]interface{}{{"owner": "owner"}},
+		},
+		{
+			msg: map[string]interface{}{"a": 1, "type": "user"},
+			exp: []map[string]interface{}{{"name": "name"}},
+		},
+		// cached by the key and the fields
+		{
+			msg: map[string]interface{}{"a": 1, "type": "device"},
+			exp: []map[string]interface{}{{"model": "model", "vendor": "vendor"}},
+		},
+	}
+	for i, tt := range tests {
+		output := doLookup(t, l, errCh, outputCh, &xsql.Tuple{Emitter: "demo", Message: tt.msg})
+		if !reflect.DeepEqual(tt.exp, lookupMessages(output)) {
+			t.Errorf("case %d: expect %v but got %v", i, tt.exp, lookupMessages(output))
+		}
+	}
+	ls, err := lookup.Attach("mockFields")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer lookup.Detach("mockFields")
+	if c := ls.(*mockFieldsLookupSrc).calls.Load(); c != 3 {
+		t.Errorf("expect 3 lookups but got %d", c)
+	}
+	l.sendError = true
+	output := doLookup(t, l, errCh, outputCh, &xsql.Tuple{Emitter: "demo", Message: map[string]interface{}{"a": 1, "type": "bad"}})
+	var ie *InvalidInputError
+	if err, ok := output.(error); !ok || !errors.As(err, &ie) {
+		t.Errorf("expect error for invalid fields but got %v", output)
+	}
+	if err := (&LookupNode{}).applyConf(&LookupConf{FieldsExpr: "type >"}); err == nil {
+		t.Error("expect error for invalid fields expr")
+	}
+	err = (&LookupNode{}).applyConf(&LookupConf{FieldsExpr: "fields, type"})
+	if err == nil || err.Error() != "invalid lookup fieldsExpr fields, type: expect exactly one field expression but got 2" {
+		t.Errorf("expect error for multiple fields expr but got %v", err)
+	}
+}
+
+func TestLookupTemporal(t *testing.T) {
+	l, errCh, outputCh := newTestLookupNodeOfType(t, "mockTemporal", []string{}, ast.INNER_JOIN, &LookupConf{
+		Cache:          true,
+		Temporal:       true,
+		TemporalBucket: 1000,
+	})
+	tests := []struct {
+		ts  int64
+		exp []map[string]interface{}
+	}{
+		{ts: 1500, exp: []map[string]interface{}{{"version": int64(1000)}}},
+		// cached by the key and the time bucket
+		{ts: 1999, exp: []map[string]interface{}{{"version": int64(1000)}}},
+		{ts: 2500, exp: []map[string]interface{}{{"version": int64(2000)}}},
+	}
+	for i, tt := range tests {
+		output := doLookup(t, l, errCh, outputCh, &xsql.Tuple{Emitter: "demo", Message: map[string]interface{}{"a": 1}, Timestamp: tt.ts})
+		if !reflect.DeepEqual(tt.exp, lookupMessages(output)) {
+			t.Errorf("case %d: expect %v but got %v", i, tt.exp, lookupMessages(output))
+		}
+	}
+	// each row of a window is looked up at its own timestamp
+	output := doLookup(t, l, errCh, outputCh, &xsql.WindowTuples{
+		Content: []xsql.TupleRow{
+			&xsql.Tuple{Emitter: "demo", Message: map[string]interface{}{"a": 1}, Timestamp: 1200},
+			&xsql.Tuple{Emitter: "demo", Message: map[string]interface{}{"a": 1}, Timestamp: 3200},
+		},
+	})
+	exp := []map[string]interface{}{{"version": int64(1000)}, {"version": int64(3000)}}
+	if !reflect.DeepEqual(exp, lookupMessages(output)) {
+		t.Errorf("expect %v but got %v", exp, lookupMessages(output))
+	}
+	ls, err := lookup.Attach("mockTemporal")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer lookup.Detach("mockTemporal")
+	if c := ls.(*mockTemporalLookupSrc).calls.Load(); c != 3 {
+		t.Errorf("expect 3 temporal lookups but got %d", c)
+	}
+	if err := (&LookupNode{}).applyConf(&LookupConf{Temporal: true, TemporalBucket: -1}); err == nil || err.Error() != "invalid lookup temporalBucket -1, must not be negative" {
+		t.Errorf("expect error for negative bucket but got %v", err)
+	}
+}
+
+func TestLookupResultFilter(t *testing.T) {
+	l, errCh, outputCh := newTestLookupNode(t, []string{}, ast.LEFT_JOIN, &LookupConf{
+		Cache:        true,
+		ResultFilter: "newA > 1 AND newB < 10",
+	})
+	// a=19 returns newA 1, 1, 4, 5
+	exp := []map[string]interface{}{{"newA": 4, "newB": 8}}
+	for i := 0; i < 2; i++ {
+		output := doLookup(t, l, errCh, outputCh, &xsql.Tuple{Emitter: "demo", Message: map[string]interface{}{"a": 19}})
+		if !reflect.DeepEqual(exp, lookupMessages(output)) {
+			t.Errorf("round %d: expect %v but got %v", i, exp, lookupMessages(output))
+		}
+	}
+	if r, _ := l.cache.Get(cacheKey([]interface{}{19})); len(r) != 4 {
+		t.Errorf("expect the full result cached but got %v", r)
+	}
+	// a=1 returns newA 1, 1, 1, 1 which are all filtered out
+	output := doLookup(t, l, errCh, outputCh, &xsql.Tuple{Emitter: "demo", Message: map[string]interface{}{"a": 1}})
+	if msgs := lookupMessages(output); len(msgs) != 1 || msgs[0] != nil {
+		t.Errorf("expect the left row only but got %v", msgs)
+	}
+	if c := l.counters.Get(LeftJoinNoMatchTotal); c != 1 {
+		t.Errorf("expect 1 no match but got %d", c)
+	}
+	if err := (&LookupNode{}).applyConf(&LookupConf{ResultFilter: "newA >"}); err == nil {
+		t.Error("expect error for invalid result filter")
+	}
+}
+
+func TestLookupSortResult(t *testing.T) {
+	tests := []struct {
+		order string
+		exp   []map[string]interface{}
+	}{
+		{
+			order: "",
+			exp:   []map[string]interface{}{{"newA": 1, "newB": 2}, {"newA": 1, "newB": 2}, {"newA": 4, "newB": 8}},
+		},
+		{
+			order: SortDesc,
+			exp:   []map[string]interface{}{{"newA": 5, "newB": 10}, {"newA": 4, "newB": 8}, {"newA": 1, "newB": 2}},
+		},
+	}
+	for i, tt := range tests {
+		l, errCh, outputCh := newTestLookupNode(t, []string{}, ast.INNER_JOIN, &LookupConf{
+			SortField:     "newA",
+			SortOrder:     tt.order,
+			MaxResultRows: 3,
+		})
+		// a=19 returns newA 1, 1, 4, 5, the first 3 rows are kept after sorting
+		output := doLookup(t, l, errCh, outputCh, &xsql.Tuple{
+			Emitter: "demo",
+			Message: map[string]interface{}{"a": 19},
+		})
+		if !reflect.DeepEqual(tt.exp, lookupMessages(output)) {
+			t.Errorf("case %d: expect %v but got %v", i, tt.exp, lookupMessages(output))
+		}
+	}
+
+	n := &LookupNode{conf: &LookupConf{SortField: "ts"}}
+	r := n.sortResult([]api.SourceTuple{
+		api.NewDefaultSourceTuple(map[string]interface{}{"id": 1}, nil),
+		api.NewDefaultSourceTuple(map[string]interface{}{"id": 2, "ts": 3.5}, nil),
+		api.NewDefaultSourceTuple(map[string]interface{}{"id": 3, "ts": int64(2)}, nil),
+	})
+	ids := make([]interface{}, 0, len(r))
+	for _, v := range r {
+		ids = append(ids, v.Message()["id"])
+	}
+	if !reflect.DeepEqual([]interface{}{3, 2, 1}, ids) {
+		t.Errorf("expect missing field last and mixed numbers sorted but got %v", ids)
+	}
+}
+
+func TestLookupBarrier(t *testing.T) {
+	l, _, outputCh := newTestLookupNode(t, []string{}, ast.INNER_JOIN, nil)
+	sideCh := make(chan interface{}, 1)
+	if err := l.GetSideEmitter().AddOutput(sideCh, "dlq"); err != nil {
+		t.Fatal(err)
+	}
+	l.SetQos(api.AtLeastOnce)
+	barrier := &checkpoint.Barrier{CheckpointId: 1, OpId: "mock"}
+	_ = l.Broadcast(barrier)
+	for _, ch := range []chan interface{}{outputCh, sideCh} {
+		select {
+		case output := <-ch:
+			boe, ok := output.(*checkpoint.BufferOrEvent)
+			if !ok || boe.Data != barrier {
+				t.Errorf("expect barrier but got %v", output)
+			}
+		case <-time.After(1 * time.Second):
+			t.Fatal("receive barrier timeout")
+		}
+	}
+}
+
+func TestLookupStrictInput(t *testing.T) {
+	l, errCh, outputCh := newTestLookupNode(t, []string{}, ast.LEFT_JOIN, &LookupConf{
+		StrictInput: true,
+	})
+	l.sendError = true
+	output := doLookup(t, l, errCh, outputCh, &xsql.Tuple{Emitter: "demo", Message: map[string]interface{}{"b": 6}})
+	var ie *InvalidInputError
+	if err, ok := output.(error); !ok || !errors.As(err, &ie) || !strings.Contains(err.Error(), "misses the field a") {
+		t.Errorf("expect the missing field error but got %v", output)
+	}
+	// the null value is not missing
+	if msgs := lookupMessages(doLookup(t, l, errCh, outputCh, &xsql.Tuple{Emitter: "demo", Message: map[string]interface{}{"a": nil}})); len(msgs) != 1 || msgs[0] != nil {
+		t.Errorf("expect the left row only for null key but got %v", msgs)
+	}
+	if msgs := lookupMessages(doLookup(t, l, errCh, outputCh, &xsql.Tuple{Emitter: "demo", Message: map[string]interface{}{"a": 6}})); len(msgs) != 2 {
+		t.Errorf("expect 2 rows but got %v", msgs)
+	}
+	// the window row missing the field fails the whole window
+	output = doLookup(t, l, errCh, outputCh, &xsql.WindowTuples{Content: []xsql.TupleRow{
+		&xsql.Tuple{Emitter: "demo", Message: map[string]interface{}{"a": 6}},
+		&xsql.Tuple{Emitter: "demo", Message: map[string]interface{}{"b": 6}},
+	}})
+	if err, ok := output.(error); !ok || !errors.As(err, &ie) {
+		t.Errorf("expect the missing field error of window but got %v", output)
+	}
+}
+
+func TestLookupNullKeyPolicy(t *testing.T) {
+	input := &xsql.Tuple{
+		Emitter: "demo",
+		Message: map[string]interface{}{"b": 1},
+	}
+	for _, policy := range []string{"", NullKeySkip} {
+		l, errCh, outputCh := newTestLookupNode(t, []string{}, ast.INNER_JOIN, &LookupConf{NullKeyPolicy: policy})
+		output := doLookup(t, l, errCh, outputCh, input)
+		if c := len(output.(*xsql.JoinTuples).Content); c != 0 {
+			t.Errorf("policy %s: expect no row but got %v", policy, output)
+		}
+	}
+	// The mock source returns one default row for the non int value
+	l, errCh, outputCh := newTestLookupNode(t, []string{}, ast.INNER_JOIN, &LookupConf{NullKeyPolicy: NullKeyPass})
+	output := doLookup(t, l, errCh, outputCh, input)
+	exp := []map[string]interface{}{{"newA": 0, "newB": 0}}
+	if !reflect.DeepEqual(exp, lookupMessages(output)) {
+		t.Errorf("expect %v but got %v", exp, lookupMessages(output))
+	}
+	l, errCh, outputCh = newTestLookupNode(t, []string{}, ast.INNER_JOIN, &LookupConf{NullKeyPolicy: NullKeyError})
+	l.sendError = true
+	output = doLookup(t, l, errCh, outputCh, input)
+	var ie *InvalidInputError
+	if err, ok := output.(error); !ok || !errors.As(err, &ie) || err.Error() != "lookup values [<nil>] of mock have null value" {
+		t.Errorf("expect null value error but got %v", output)
+	}
+	if err := (&LookupNode{}).applyConf(&LookupConf{NullKeyPolicy: "none"}); err == nil {
+		t.Error("expect error for invalid null key policy")
+	}
+}
+
+func TestLookupSkipInvalidWindowElements(t *testing.T) {
+	input := func() *xsql.WindowTuples {
+		return &xsql.WindowTuples{Content: []xsql.TupleRow{
+			&xsql.Tuple{Emitter: "demo", Message: map[string]interface{}{"a": 6}},
+			nil,
+			&xsql.Tuple{Emitter: "demo", Message: map[string]interface{}{"a": 1}},
+		}}
+	}
+	l, errCh, outputCh := newTestLookupNode(t, []string{}, ast.INNER_JOIN, &LookupConf{})
+	l.sendError = true
+	if output := doLookup(t, l, errCh, outputCh, input()); !strings.Contains(fmt.Sprintf("%v", output), "Invalid window element") {
+		t.Errorf("expect the window failed by default but got %v", output)
+	}
+	l, errCh, outputCh = newTestLookupNode(t, []string{}, ast.INNER_JOIN, &LookupConf{SkipInvalidWindowElements: true})
+	output := doLookup(t, l, errCh, outputCh, input())
+	// 6 has 2 results and 1 has 4 results
+	if jt, ok := output.(*xsql.JoinTuples); !ok || len(jt.Content) != 6 {
+		t.Errorf("expect 6 joined rows but got %v", output)
+	}
+	if c := l.counters.Get(InvalidWindowElementsTotal); c != 1 {
+		t.Errorf("expect 1 invalid window element but got %d", c)
+	}
+}
+
+func TestLookupTagSource(t *testing.T) {
+	l, errCh, outputCh := newTestLookupNode(t, []string{}, ast.LEFT_JOIN, &LookupConf{TagSource: true})
+	output := doLookup(t, l, errCh, outputCh, &xsql.WindowTuples{Content: []xsql.TupleRow{
+		&xsql.Tuple{Emitter: "demo", Message: map[string]interface{}{"a": 6}},
+		&xsql.Tuple{Emitter: "demo2", Message: map[string]interface{}{"a": 210}},
+		&xsql.JoinTuple{Tuples: []xsql.TupleRow{
+			&xsql.Tuple{Emitter: "demo3", Message: map[string]interface{}{"a": 6}},
+			&xsql.Tuple{Emitter: "other", Message: map[string]interface{}{"b": 1}},
+		}},
+	}})
+	jt, ok := output.(*xsql.JoinTuples)
+	if !ok {
+		t.Fatalf("expect join tuples but got %v", output)
+	}
+	var tags []interface{}
+	for _, c := range jt.Content {
+		v, _ := c.Value(SourceTagName, "")
+		tags = append(tags, v)
+	}
+	// the unmatched row of the left join is tagged too
+	exp := []interface{}{"demo", "demo", "demo2", "demo3", "demo3"}
+	if !reflect.DeepEqual(exp, tags) {
+		t.Errorf("expect tags %v but got %v", exp, tags)
+	}
+	if m := jt.Content[0].ToMap(); m[SourceTagName] != "demo" {
+		t.Errorf("expect the tag in the output map but got %v", m)
+	}
+}
+
+func TestLookupCachePreload(t *testing.T) {
+	l, errCh, outputCh := newTestLookupNodeOfType(t, "mockScan", []string{}, ast.INNER_JOIN, &LookupConf{
+		Cache:              true,
+		CachePreload:       true,
+		CachePreloadFilter: "newA > 10",
+	})
+	// 6 and 1 are preloaded, 2 is not scanned and looked up from the source
+	tests := []struct {
+		a   int
+		exp []map[string]interface{}
+	}{
+		{a: 6, exp: []map[string]interface{}{{"a": 6, "newA": 60}}},
+		{a: 1, exp: []map[string]interface{}{{"a": 1, "newA": 11}}},
+		{a: 2, exp: []map[string]interface{}{{"newA": 2, "newB": 4}, {"newA": 2, "newB": 4}, {"newA": 2, "newB": 4}}},
+	}
+	for _, tt := range tests {
+		r := lookupMessages(doLookup(t, l, errCh, outputCh, &xsql.Tuple{Emitter: "demo", Message: map[string]interface{}{"a": tt.a}}))
+		if !reflect.DeepEqual(tt.exp, r) {
+			t.Errorf("%d: expect %v but got %v", tt.a, tt.exp, r)
+		}
+	}
+	ls, err := lookup.Attach("mockScan")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer lookup.Detach("mockScan")
+	if c := ls.(*mockScanLookupSrc).calls.Load(); c != 1 {
+		t.Errorf("expect 1 lookup call but got %d", c)
+	}
+	if err := (&LookupNode{}).applyConf(&LookupConf{CachePreload: true, Temporal: true}); err == nil {
+		t.Error("expect error for cachePreload with temporal")
+	}
+	if err := (&LookupNode{}).applyConf(&LookupConf{CachePreloadFilter: "newA >"}); err == nil || !strings.HasPrefix(err.Error(), "invalid lookup cachePreloadFilter") {
+		t.Errorf("expect error for invalid cachePreloadFilter but got %v", err)
+	}
+}
+
+func TestLookupRange(t *testing.T) {
+	temp := &ast.FieldRef{StreamName: "", Name: "temp"}
+	ranges := []*LookupRangeKey{{Field: "low", Op: "<=", Val: temp}, {Field: "high", Op: ">", Val: temp}}
+	start := func(sourceType string, keys []string, vals []ast.Expr) (*LookupNode, chan error, chan interface{}) {
+		options := &ast.Options{
+			DATASOURCE: sourceType,
+			TYPE:       sourceType,
+			KIND:       "lookup",
+		}
+		lookup.CreateInstance(sourceType, sourceType, options)
+		contextLogger := conf.Log.WithField("rule", t.Name())
+		ctx, cancel := context.WithValue(context.Background(), context.LoggerKey, contextLogger).WithCancel()
+		t.Cleanup(cancel)
+		l, err := NewLookupNode(sourceType, []string{}, keys, ast.INNER_JOIN, vals, options, &api.RuleOption{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := l.applyConf(&LookupConf{Cache: true}); err != nil {
+			t.Fatal(err)
+		}
+		if err := l.SetRanges(ranges); err != nil {
+			t.Fatal(err)
+		}
+		l.sendError = true
+		errCh := make(chan error)
+		outputCh := make(chan interface{}, 1)
+		l.outputs["mock"] = outputCh
+		l.Exec(ctx, errCh)
+		return l, errCh, outputCh
+	}
+	// the ranges are pushed down and the results are cached by the range values
+	l, errCh, outputCh := start("mockRange", nil, nil)
+	for _, v := range []int{20, 20, 5} {
+		r := lookupMessages(doLookup(t, l, errCh, outputCh, &xsql.Tuple{Emitter: "demo", Message: map[string]interface{}{"temp": v}}))
+		exp := "warm"
+		if v == 5 {
+			exp = "cold"
+		}
+		if len(r) != 1 || r[0]["name"] != exp {
+			t.Errorf("%d: expect %s but got %v", v, exp, r)
+		}
+	}
+	ls, err := lookup.Attach("mockRange")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer lookup.Detach("mockRange")
+	src := ls.(*mockRangeLookupSrc)
+	if c := src.calls.Load(); c != 2 {
+		t.Errorf("expect 2 range lookups but got %d", c)
+	}
+	if exp := []api.LookupRange{{Field: "low", Op: "<=", Value: 5}, {Field: "high", Op: ">", Value: 5}}; !reflect.DeepEqual(exp, src.ranges) {
+		t.Errorf("expect ranges %v but got %v", exp, src.ranges)
+	}
+	// the source without range lookup is scanned and the rows are filtered by the join condition after joining
+	l, errCh, outputCh = start("mockScan", nil, nil)
+	if r := lookupMessages(doLookup(t, l, errCh, outputCh, &xsql.Tuple{Emitter: "demo", Message: map[string]interface{}{"temp": 20}})); len(r) != 4 {
+		t.Errorf("expect 4 scanned rows but got %v", r)
+	}
+	// the source is looked up by the keys only
+	l, errCh, outputCh = start("mock", []string{"a"}, []ast.Expr{&ast.FieldRef{StreamName: "", Name: "a"}})
+	if r := lookupMessages(doLookup(t, l, errCh, outputCh, &xsql.Tuple{Emitter: "demo", Message: map[string]interface{}{"a": 6, "temp": 20}})); len(r) != 2 {
+		t.Errorf("expect 2 rows of the key but got %v", r)
+	}
+	// the source supports neither range lookup nor scanning
+	l, errCh, outputCh = start("mock", nil, nil)
+	output := doLookup(t, l, errCh, outputCh, &xsql.Tuple{Emitter: "demo", Message: map[string]interface{}{"temp": 20}})
+	if err, ok := output.(error); !ok || !strings.Contains(err.Error(), "supports neither range lookup nor scanning") {
+		t.Errorf("expect unsupported range lookup error but got %v", output)
+	}
+	n := &LookupNode{conf: &LookupConf{FuzzyKey: true}}
+	if err := n.SetRanges(ranges); err == nil {
+		t.Error("expect error for fuzzyKey with ranges")
+	}
+	n = &LookupNode{conf: &LookupConf{}}
+	if err := n.SetRanges([]*LookupRangeKey{{Field: "low", Op: "=", Val: temp}}); err == nil {
+		t.Error("expect error for invalid range operator")
+	}
+}
+
+func TestLookupBatch(t *testing.T) {
+	l, errCh, outputCh := newTestLookupNodeOfType(t, "mockBatch", []string{}, ast.INNER_JOIN, &LookupConf{Cache: true})
+	window := func(values ...interface{}) *xsql.WindowTuples {
+		w := &xsql.WindowTuples{}
+		for _, v := range values {
+			w.Content = append(w.Content, &xsql.Tuple{Emitter: "demo", Message: map[string]interface{}{"a": v}})
+		}
+		return w
+	}
+	// the duplicated and the null values are not in the batch
+	output := doLookup(t, l, errCh, outputCh, window(6, 1, 6, nil))
+	if jt, ok := output.(*xsql.JoinTuples); !ok || len(jt.Content) != 8 {
+		t.Errorf("expect 8 joined rows but got %v", output)
+	}
+	// 6 and 1 are cached, so only one value is left which is looked up alone
+	output = doLookup(t, l, errCh, outputCh, window(6, 1, 2))
+	if jt, ok := output.(*xsql.JoinTuples); !ok || len(jt.Content) != 9 {
+		t.Errorf("expect 9 joined rows but got %v", output)
+	}
+	ls, err := lookup.Attach("mockBatch")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer lookup.Detach("mockBatch")
+	src := ls.(*mockBatchLookupSrc)
+	if b, c := src.batches.Load(), src.calls.Load(); b != 1 || c != 1 {
+		t.Errorf("expect 1 batch and 1 single lookup but got %d and %d", b, c)
+	}
+	if !reflect.DeepEqual([]int{2}, src.sizes) {
+		t.Errorf("expect the batch of 2 values but got %v", src.sizes)
+	}
+}
@@ -0,0 +1,92 @@
+// Copyright 2023 EMQ Technologies Co., Ltd.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package node
+
+import (
+	"fmt"
+
+	"github.com/lf-edge/ekuiper/internal/conf"
+	"github.com/lf-edge/ekuiper/internal/topo/lookup/cache"
+	"github.com/lf-edge/ekuiper/internal/xsql"
+	"github.com/lf-edge/ekuiper/pkg/api"
+)
+
+// preload scans the lookup source and caches the rows grouped by the values of the lookup keys, so that the first
+// lookups of the scanned keys hit the cache. The keys not scanned still go to the lookup source as usual.
+// The key fields are also scanned to group the rows, and then removed if not selected
+func (n *LookupNode) preload(ctx api.StreamContext, ns api.LookupSource, c *cache.Cache, fv *xsql.FunctionValuer) error {
+	s, ok := ns.(api.LookupScanner)
+	if !ok {
+		return fmt.Errorf("lookup table %s does not support scanning to preload the cache", n.name)
+	}
+	fields := n.sourceFields()
+	var extra []string
+	if len(fields) > 0 {
+		selected := make(map[string]bool, len(fields))
+		for _, f := range fields {
+			selected[f] = true
+		}
+		fields = append([]string{}, fields...)
+		for _, k := range n.keys {
+			if !selected[k] {
+				fields = append(fields, k)
+				extra = append(extra, k)
+			}
+		}
+	}
+	start := conf.GetNow()
+	rows, err := s.Scan(ctx, fields)
+	if err != nil {
+		return err
+	}
+	if n.preloadFilter != nil {
+		rows = n.filterResult(rows, n.preloadFilter, fv)
+	}
+	var (
+		keys    []string
+		results = make(map[string][]api.SourceTuple)
+	)
+	for _, r := range rows {
+		msg := r.Message()
+		cvs := make([]interface{}, len(n.keys))
+		for i, k := range n.keys {
+			cvs[i] = msg[k]
+		}
+		// the rows of null keys are never looked up by default
+		if skip, err := n.skipNullKey(cvs); skip || err != nil {
+			continue
+		}
+		if len(extra) > 0 {
+			m := make(map[string]interface{}, len(msg))
+			for k, v := range msg {
+				m[k] = v
+			}
+			for _, k := range extra {
+				delete(m, k)
+			}
+			r = api.NewDefaultSourceTupleWithTime(m, r.Meta(), r.Timestamp())
+		}
+		k := lookupCacheKey(ns, cvs)
+		if _, ok := results[k]; !ok {
+			keys = append(keys, k)
+		}
+		results[k] = append(results[k], r)
+	}
+	for _, k := range keys {
+		n.cacheResult(c, k, results[k])
+	}
+	ctx.GetLogger().Infof("LookupNode %s preloads %d keys from %d rows in %v", n.name, len(keys), len(rows), conf.GetNow().Sub(start))
+	return nil
+}
@@ -0,0 +1,61 @@
+// Copyright 2023 EMQ Technologies Co., Ltd.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package node
+
+import (
+	"fmt"
+
+	"github.com/lf-edge/ekuiper/internal/conf"
+	"github.com/lf-edge/ekuiper/pkg/api"
+	"github.com/lf-edge/ekuiper/pkg/infra"
+)
+
+// LookupProbeConf is the options to probe the health of the lookup source
+type LookupProbeConf struct {
+	// ProbeInterval is the interval in milliseconds to look up the ProbeKeys to check the health of the lookup source
+	// regardless of the traffic, 0 means disabled. The probe result is only reported in the metrics
+	ProbeInterval int `json:"probeInterval"`
+	// ProbeKeys are the lookup values of the probe for each lookup key
+	ProbeKeys []interface{} `json:"probeKeys"`
+}
+
+// validate checks that the probe keys have a value for each lookup key
+func (c *LookupProbeConf) validate(keys []string) error {
+	if c.ProbeInterval < 0 {
+		return fmt.Errorf("invalid lookup probeInterval %d, must not be negative", c.ProbeInterval)
+	}
+	if c.ProbeInterval > 0 && len(c.ProbeKeys) != len(keys) {
+		return fmt.Errorf("invalid lookup probeKeys %v, must have a value for each lookup key %v", c.ProbeKeys, keys)
+	}
+	return nil
+}
+
+// probe looks up the probe keys from the lookup source directly and reports the result in the metrics. It does not go
+// through the cache, the rate limit or the stats of the records, and the result is not emitted
+func (n *LookupNode) probe(ctx api.StreamContext, ns lookuper) {
+	start := conf.GetNow()
+	err := infra.SafeRun(func() error {
+		_, err := ns.Lookup(ctx, n.fields, n.keys, n.conf.ProbeKeys)
+		return err
+	})
+	n.counters.Set(ProbeLatency, conf.GetNow().Sub(start).Milliseconds())
+	if err != nil {
+		n.counters.Set(ProbeHealthy, 0)
+		n.counters.Inc(ProbeFailuresTotal)
+		ctx.GetLogger().Warnf("LookupNode %s probes lookup source failed: %v", n.name, err)
+		return
+	}
+	n.counters.Set(ProbeHealthy, 1)
+}
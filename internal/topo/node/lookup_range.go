@@ -0,0 +1,97 @@
+// Copyright 2023 EMQ Technologies Co., Ltd.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package node
+
+import (
+	"fmt"
+
+	"github.com/lf-edge/ekuiper/internal/xsql"
+	"github.com/lf-edge/ekuiper/pkg/api"
+	"github.com/lf-edge/ekuiper/pkg/ast"
+)
+
+// LookupRangeKey is a range predicate of the lookup join such as "table.low <= stream.temp". Field is the field of the
+// lookup table, Op is how the field compares to the value and Val is evaluated against the input row
+type LookupRangeKey struct {
+	Field string
+	Op    string
+	Val   ast.Expr
+}
+
+// SetRanges sets the range predicates of the lookup join. The range values are evaluated after the key values as part
+// of the lookup values, so that they are also in the cache key
+func (n *LookupNode) SetRanges(ranges []*LookupRangeKey) error {
+	if len(ranges) == 0 {
+		return nil
+	}
+	if n.conf.MultiKey != "" {
+		return fmt.Errorf("lookup multiKey conflicts with the range predicates")
+	}
+	if n.conf.FuzzyKey {
+		return fmt.Errorf("lookup fuzzyKey conflicts with the range predicates")
+	}
+	if n.conf.CachePreload {
+		return fmt.Errorf("lookup cachePreload conflicts with the range predicates")
+	}
+	for _, r := range ranges {
+		switch r.Op {
+		case "<", "<=", ">", ">=":
+		default:
+			return fmt.Errorf("invalid lookup range operator %s of %s", r.Op, r.Field)
+		}
+		n.ranges = append(n.ranges, api.LookupRange{Field: r.Field, Op: r.Op})
+		n.vals = append(n.vals, r.Val)
+		if xsql.HasAggFuncs(r.Val) {
+			n.aggVals = true
+		}
+	}
+	if len(n.conf.LeftFields) > 0 {
+		n.leftCols = n.leftColumns(n.conf.LeftFields, n.conf.LeftDropKeys)
+	}
+	return nil
+}
+
+// rangeLookup looks up the source with the range values at the tail of the lookup values. The ranges are pushed down
+// if the source supports, otherwise it is looked up by the keys only and the join condition filters the rows after
+// joining. A join without keys requires the source to support the ranges or scanning
+func (n *LookupNode) rangeLookup(ctx api.StreamContext, ns lookuper, cvs []interface{}) ([]api.SourceTuple, error) {
+	kl := len(n.keys)
+	ranges := make([]api.LookupRange, len(n.ranges))
+	for i, r := range n.ranges {
+		ranges[i] = api.LookupRange{Field: r.Field, Op: r.Op, Value: cvs[kl+i]}
+	}
+	fields := n.sourceFields()
+	for {
+		switch l := ns.(type) {
+		case *fieldsLookuper:
+			fields = l.fields
+			ns = l.lookuper
+			continue
+		case *batchLookuper:
+			ns = l.lookuper
+			continue
+		case api.LookupRanger:
+			return l.LookupRange(ctx, fields, n.keys, cvs[:kl], ranges)
+		}
+		break
+	}
+	if kl > 0 {
+		return ns.Lookup(ctx, fields, n.keys, cvs[:kl])
+	}
+	if s, ok := ns.(api.LookupScanner); ok {
+		return s.Scan(ctx, fields)
+	}
+	return nil, fmt.Errorf("lookup table %s supports neither range lookup nor scanning for the join without equi-join predicate", n.name)
+}
@@ -0,0 +1,253 @@
+// Copyright 2023 EMQ Technologies Co., Ltd.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package node
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/lf-edge/ekuiper/internal/xsql"
+	"github.com/lf-edge/ekuiper/pkg/api"
+	"github.com/lf-edge/ekuiper/pkg/ast"
+)
+
+// applyFieldAliases validates the aliases and replaces the aliases in the selected fields with the original fields to query
+func (n *LookupNode) applyFieldAliases(aliases map[string]string) error {
+	if len(aliases) == 0 {
+		return nil
+	}
+	origins := make([]string, 0, len(aliases))
+	for f := range aliases {
+		origins = append(origins, f)
+	}
+	sort.Strings(origins)
+	reverse := make(map[string]string, len(aliases))
+	for _, f := range origins {
+		a := aliases[f]
+		if a == "" {
+			return fmt.Errorf("invalid lookup fieldAliases, the alias of %s is empty", f)
+		}
+		if o, ok := reverse[a]; ok {
+			return fmt.Errorf("invalid lookup fieldAliases, %s and %s have the same alias %s", o, f, a)
+		}
+		if _, ok := aliases[a]; ok && a != f {
+			return fmt.Errorf("invalid lookup fieldAliases, the alias %s of %s is also an aliased field", a, f)
+		}
+		reverse[a] = f
+	}
+	fields := make([]string, len(n.fields))
+	for i, f := range n.fields {
+		if o, ok := reverse[f]; ok {
+			f = o
+		}
+		fields[i] = f
+	}
+	n.fields = fields
+	return nil
+}
+
+// leftColumns returns the columns to pick from the left row. Unless dropped, the fields referred by the lookup values are kept
+func (n *LookupNode) leftColumns(fields []string, dropKeys bool) [][]string {
+	cols := make([][]string, 0, len(fields))
+	for _, f := range fields {
+		cols = append(cols, []string{f, ""})
+	}
+	vals := n.vals
+	if dropKeys {
+		// the range values are still referred by the join condition after joining
+		vals = n.vals[len(n.keys):]
+	}
+	for _, v := range vals {
+		ast.WalkFunc(v, func(node ast.Node) bool {
+			if f, ok := node.(*ast.FieldRef); ok {
+				cols = append(cols, []string{f.Name, ""})
+			}
+			return true
+		})
+	}
+	return cols
+}
+
+// leftRow returns a copy of the left row with only the left columns to merge into the join output
+func (n *LookupNode) leftRow(d xsql.TupleRow) xsql.TupleRow {
+	if n.leftCols == nil {
+		return d
+	}
+	nd := d.Clone().(xsql.TupleRow)
+	nd.Pick(false, n.leftCols, nil, nil)
+	return nd
+}
+
+// filterResult returns the lookup rows matching the filter in a new slice since the result may be cached.
+// The rows failing to evaluate are dropped as exceptions
+func (n *LookupNode) filterResult(r []api.SourceTuple, filter ast.Expr, fv *xsql.FunctionValuer) []api.SourceTuple {
+	result := make([]api.SourceTuple, 0, len(r))
+	for _, v := range r {
+		ve := &xsql.ValuerEval{Valuer: xsql.MultiValuer(&xsql.Tuple{Emitter: n.name, Message: v.Message(), Metadata: v.Meta()}, fv)}
+		switch rv := ve.Eval(filter).(type) {
+		case error:
+			n.statManager.IncTotalExceptions(fmt.Sprintf("filter lookup row error: %v", rv))
+		case bool:
+			if rv {
+				result = append(result, v)
+			}
+		}
+	}
+	return result
+}
+
+// sortResult returns a copy of the lookup result sorted by the sort field. The rows missing the field are placed last
+func (n *LookupNode) sortResult(r []api.SourceTuple) []api.SourceTuple {
+	result := make([]api.SourceTuple, len(r))
+	copy(result, r)
+	desc := n.conf.SortOrder == SortDesc
+	// reuse the comparison of the sql expression to support the comparison between different number types and time
+	less := &ast.BinaryExpr{OP: ast.LT, LHS: &ast.FieldRef{Name: "l", StreamName: ast.DefaultStream}, RHS: &ast.FieldRef{Name: "r", StreamName: ast.DefaultStream}}
+	sort.SliceStable(result, func(i, j int) bool {
+		vi := result[i].Message()[n.conf.SortField]
+		vj := result[j].Message()[n.conf.SortField]
+		if vi == nil || vj == nil {
+			return vi != nil
+		}
+		if desc {
+			vi, vj = vj, vi
+		}
+		ve := &xsql.ValuerEval{Valuer: &xsql.Tuple{Message: map[string]interface{}{"l": vi, "r": vj}}}
+		b, ok := ve.Eval(less).(bool)
+		return ok && b
+	})
+	return result
+}
+
+// validateFields checks if the lookup row has all the selected fields and fills the default values for the missing ones
+func (n *LookupNode) validateFields(msg map[string]interface{}) (map[string]interface{}, error) {
+	var result map[string]interface{}
+	for _, f := range n.fields {
+		if _, ok := msg[f]; ok {
+			continue
+		}
+		dv, ok := n.conf.FieldDefaults[f]
+		if !ok {
+			return nil, &LookupResultError{Table: n.name, Msg: fmt.Sprintf("lookup row of %s misses field %s", n.name, f)}
+		}
+		if result == nil {
+			// copy to avoid changing the cached result
+			result = make(map[string]interface{}, len(msg)+1)
+			for k, v := range msg {
+				result[k] = v
+			}
+		}
+		result[f] = dv
+	}
+	if result == nil {
+		return msg, nil
+	}
+	return result, nil
+}
+
+// transform evaluates the transform fields against a lookup row and returns the new message
+func (n *LookupNode) transform(msg map[string]interface{}, meta map[string]interface{}, fv *xsql.FunctionValuer) (map[string]interface{}, error) {
+	ve := &xsql.ValuerEval{Valuer: xsql.MultiValuer(&xsql.Tuple{Emitter: n.name, Message: msg, Metadata: meta}, fv)}
+	result := make(map[string]interface{}, len(n.transformFields))
+	for _, f := range n.transformFields {
+		if _, ok := f.Expr.(*ast.Wildcard); ok {
+			for k, v := range msg {
+				result[k] = v
+			}
+			continue
+		}
+		v := ve.Eval(f.Expr)
+		if e, ok := v.(error); ok {
+			return nil, fmt.Errorf("transform lookup row error: %v", e)
+		}
+		if f.AName != "" {
+			result[f.AName] = v
+		} else {
+			result[f.Name] = v
+		}
+	}
+	return result, nil
+}
+
+// aliasFields returns a copy of the lookup row with the fields renamed by the aliases. The aliased value overrides
+// the field of the same name in the row
+func (n *LookupNode) aliasFields(msg map[string]interface{}) map[string]interface{} {
+	result := make(map[string]interface{}, len(msg))
+	for k, v := range msg {
+		if _, ok := n.conf.FieldAliases[k]; !ok {
+			result[k] = v
+		}
+	}
+	for f, a := range n.conf.FieldAliases {
+		if v, ok := msg[f]; ok {
+			result[a] = v
+		}
+	}
+	return result
+}
+
+// project returns a copy of the full lookup row with only the selected fields
+func (n *LookupNode) project(msg map[string]interface{}) map[string]interface{} {
+	result := make(map[string]interface{}, len(n.fields))
+	for _, f := range n.fields {
+		if v, ok := msg[f]; ok {
+			result[f] = v
+		}
+	}
+	return result
+}
+
+// keyedTuple is a lookup row with the key matched in multi key mode
+type keyedTuple struct {
+	api.SourceTuple
+	key []interface{}
+}
+
+// matchedKeyAttached returns a copy of the message with the matched key attached
+func (n *LookupNode) matchedKeyAttached(msg map[string]interface{}, t api.SourceTuple, cvs []interface{}) map[string]interface{} {
+	if kt, ok := t.(*keyedTuple); ok {
+		cvs = kt.key
+	}
+	key := make(map[string]interface{}, len(n.keys))
+	for i, k := range n.keys {
+		if i < len(cvs) {
+			key[k] = cvs[i]
+		}
+	}
+	result := make(map[string]interface{}, len(msg)+1)
+	for k, v := range msg {
+		result[k] = v
+	}
+	result[n.conf.MatchedKeyName] = key
+	return result
+}
+
+// latencyAttached returns a copy of the message or metadata with the lookup latency and cache hit attached
+func (n *LookupNode) latencyAttached(msg map[string]interface{}, meta map[string]interface{}, latency float64, hit bool) (map[string]interface{}, map[string]interface{}) {
+	target := meta
+	if n.conf.EmitLatencyAs == EmitAsField {
+		target = msg
+	}
+	result := make(map[string]interface{}, len(target)+2)
+	for k, v := range target {
+		result[k] = v
+	}
+	result[n.conf.LatencyName] = latency
+	result[n.conf.CacheHitName] = hit
+	if n.conf.EmitLatencyAs == EmitAsField {
+		return result, meta
+	}
+	return msg, result
+}
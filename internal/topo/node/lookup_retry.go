@@ -0,0 +1,134 @@
+// Copyright 2023 EMQ Technologies Co., Ltd.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package node
+
+import (
+	"fmt"
+	"math/rand"
+	"time"
+
+	"github.com/lf-edge/ekuiper/internal/conf"
+	"github.com/lf-edge/ekuiper/pkg/api"
+)
+
+const (
+	// RetryFailureError reports error for the lookup which still fails after the retries
+	RetryFailureError = "error"
+	// RetryFailureDrop drops the row whose lookup still fails after the retries
+	RetryFailureDrop = "drop"
+	// RetryFailureUnjoined joins the row whose lookup still fails after the retries with no result, so that it is
+	// emitted unjoined in left join
+	RetryFailureUnjoined = "unjoined"
+)
+
+const (
+	// DefaultRetryInterval is the default interval in milliseconds before the first retry
+	DefaultRetryInterval = 100
+	// RetryMaxInterval is the max interval in milliseconds between the retries
+	RetryMaxInterval = 10000
+)
+
+// LookupRetryConf is the options to retry the failed calls to the lookup source
+type LookupRetryConf struct {
+	// RetryCount is the max retries of a failed call to the lookup source, 0 means no retry
+	RetryCount int `json:"retryCount"`
+	// RetryInterval is the interval in milliseconds before the first retry which doubles every retry up to
+	// RetryMaxInterval. The actual wait is randomized between half of the interval and the interval. Default to 100
+	RetryInterval int `json:"retryInterval"`
+	// RetryFailurePolicy decides what to do when the lookup still fails after the retries, could be "error"(default),
+	// "drop" or "unjoined"
+	RetryFailurePolicy string `json:"retryFailurePolicy"`
+}
+
+// validate checks the retry options and fills the default interval
+func (c *LookupRetryConf) validate() error {
+	if c.RetryCount < 0 {
+		return fmt.Errorf("invalid lookup retryCount %d, must not be negative", c.RetryCount)
+	}
+	if c.RetryInterval < 0 {
+		return fmt.Errorf("invalid lookup retryInterval %d, must not be negative", c.RetryInterval)
+	}
+	switch c.RetryFailurePolicy {
+	case "", RetryFailureError, RetryFailureDrop, RetryFailureUnjoined:
+	default:
+		return fmt.Errorf("invalid lookup retryFailurePolicy %s, must be %s, %s or %s", c.RetryFailurePolicy, RetryFailureError, RetryFailureDrop, RetryFailureUnjoined)
+	}
+	if c.RetryInterval == 0 {
+		c.RetryInterval = DefaultRetryInterval
+	}
+	return nil
+}
+
+// retriesExhaustedError is returned when the lookup source still fails after the retries and the retry failure policy
+// is not error, so that the row is dropped or joined without result by the policy instead of failing
+type retriesExhaustedError struct {
+	err error
+}
+
+func (e *retriesExhaustedError) Error() string {
+	return e.err.Error()
+}
+
+func (e *retriesExhaustedError) Unwrap() error {
+	return e.err
+}
+
+// retryLookup calls the lookup source and retries the failed calls with exponential backoff. The retries stop when
+// the rule is stopped
+func (n *LookupNode) retryLookup(ctx api.StreamContext, ns lookuper, cvs []interface{}) ([]api.SourceTuple, error) {
+	r, err := n.callSource(ctx, ns, cvs)
+	for i := 0; err != nil && i < n.conf.RetryCount; i++ {
+		d := n.retryBackoff(i)
+		n.debugf("LookupNode %s retries the lookup of %v in %v for error: %v", n.name, cvs, d, err)
+		timer := conf.Clock.Timer(d)
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			timer.Stop()
+			return nil, err
+		}
+		n.counters.Inc(RetriesTotal)
+		r, err = n.callSource(ctx, ns, cvs)
+	}
+	if err == nil {
+		return r, nil
+	}
+	n.counters.Inc(RetryExhaustedTotal)
+	if n.conf.RetryFailurePolicy != "" && n.conf.RetryFailurePolicy != RetryFailureError {
+		n.debugf("LookupNode %s gives up the lookup of %v for error: %v", n.name, cvs, err)
+		return nil, &retriesExhaustedError{err: err}
+	}
+	return nil, err
+}
+
+// callSource calls the lookup source once, with the range predicates if any
+func (n *LookupNode) callSource(ctx api.StreamContext, ns lookuper, cvs []interface{}) ([]api.SourceTuple, error) {
+	if len(n.ranges) > 0 {
+		return n.rangeLookup(ctx, ns, cvs)
+	}
+	return ns.Lookup(ctx, n.sourceFields(), n.keys, cvs)
+}
+
+// retryBackoff returns the wait before the retry of the attempt starting from 0. The interval doubles every attempt
+// up to the max interval, and the wait is a random duration between half of the interval and the interval so that
+// the retries of many rows do not hit the recovering source at once
+func (n *LookupNode) retryBackoff(attempt int) time.Duration {
+	d := RetryMaxInterval
+	if attempt < 30 && n.conf.RetryInterval<<attempt < d {
+		d = n.conf.RetryInterval << attempt
+	}
+	half := d / 2
+	return time.Duration(half+rand.Intn(d-half+1)) * time.Millisecond
+}
@@ -0,0 +1,104 @@
+// Copyright 2023 EMQ Technologies Co., Ltd.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package node
+
+import (
+	"sync"
+
+	"github.com/lf-edge/ekuiper/internal/xsql"
+	"github.com/lf-edge/ekuiper/pkg/api"
+)
+
+// LookupSpan is a tracing span of a lookup. It may be ended in the fetching routine in async mode
+type LookupSpan interface {
+	SetAttribute(key string, value interface{})
+	// End finishes the span with the error of the lookup if any
+	End(err error)
+}
+
+// LookupTracer starts the tracing spans of the lookups, such as an adapter of opentelemetry. The carrier is the metadata
+// of the input row which may carry the trace context propagated from the upstream such as the traceparent header. It is
+// nil for the window inputs. It must be safe to be used concurrently.
+type LookupTracer interface {
+	Start(ctx api.StreamContext, name string, carrier map[string]interface{}) LookupSpan
+}
+
+var (
+	lookupTracer     LookupTracer
+	lookupTracerLock = &sync.RWMutex{}
+)
+
+// RegisterLookupTracer sets the tracer of the lookup nodes started afterwards. Set nil to disable tracing, which is
+// the default so that no span is created.
+func RegisterLookupTracer(tracer LookupTracer) {
+	lookupTracerLock.Lock()
+	defer lookupTracerLock.Unlock()
+	lookupTracer = tracer
+}
+
+func getLookupTracer() LookupTracer {
+	lookupTracerLock.RLock()
+	defer lookupTracerLock.RUnlock()
+	return lookupTracer
+}
+
+// traceCarrier returns the metadata of the row to propagate the trace context. It is nil if tracing is disabled
+func (n *LookupNode) traceCarrier(d xsql.TupleRow) map[string]interface{} {
+	if n.tracer == nil {
+		return nil
+	}
+	if m, ok := d.Meta("*", ""); ok {
+		if mm, ok := m.(map[string]interface{}); ok {
+			return mm
+		}
+	}
+	return nil
+}
+
+// traceFetch runs the fetch in a span covering the cache check and the lookup source calls if tracing is enabled.
+// The span is tagged with whether all the results hit the cache, the count of the keys and the count of the rows
+func (n *LookupNode) traceFetch(ctx api.StreamContext, carrier map[string]interface{}, fetch func() ([]*lookupFetch, error)) ([]*lookupFetch, error) {
+	if n.tracer == nil {
+		return fetch()
+	}
+	span := n.tracer.Start(ctx, "lookup "+n.name, carrier)
+	fs, err := fetch()
+	span.SetAttribute("lookup.table", n.name)
+	if err == nil {
+		hit, keys, rows := len(fs) > 0, 0, 0
+		for _, f := range fs {
+			hit = hit && f.hit
+			keys += n.keyCardinality(f.cvs)
+			rows += len(f.r)
+		}
+		span.SetAttribute("lookup.cacheHit", hit)
+		span.SetAttribute("lookup.keys", keys)
+		span.SetAttribute("lookup.rows", rows)
+	}
+	span.End(err)
+	return fs, err
+}
+
+// keyCardinality returns the count of the keys to look up for the lookup values
+func (n *LookupNode) keyCardinality(cvs []interface{}) int {
+	if n.conf.MultiKey == "" {
+		return 1
+	}
+	keys, err := n.expandKeys(cvs)
+	if err != nil {
+		return 0
+	}
+	return len(keys)
+}
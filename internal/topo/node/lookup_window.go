@@ -0,0 +1,228 @@
+// Copyright 2023 EMQ Technologies Co., Ltd.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package node
+
+import (
+	"fmt"
+
+	"github.com/lf-edge/ekuiper/internal/conf"
+	"github.com/lf-edge/ekuiper/internal/topo/lookup/cache"
+	"github.com/lf-edge/ekuiper/internal/xsql"
+	"github.com/lf-edge/ekuiper/pkg/api"
+)
+
+// windowJoin is the statistics of joining the rows of a window
+type windowJoin struct {
+	// misses are the rows without joined result if the side output is attached
+	misses  []xsql.TupleRow
+	rows    int
+	matched int
+	results int
+}
+
+// lookupWindowInput looks up and emits a window input. In async mode, the lookup is dispatched and emitted when it
+// completes. It returns false if the rule is stopped
+func (n *LookupNode) lookupWindowInput(ctx api.StreamContext, d *xsql.WindowTuples, ns api.LookupSource, c *cache.Cache, async *asyncLookups, fv *xsql.FunctionValuer, afv *xsql.AggregateFunctionValuer) bool {
+	n.statManager.ProcessTimeStart()
+	if async != nil {
+		rows, cvss, err := n.windowValues(d, fv, afv)
+		if err != nil {
+			if !async.awaitOrdered() {
+				return false
+			}
+			n.emitWindow(d, nil, nil, err)
+			return true
+		}
+		return async.dispatch(&asyncResult{item: d, rows: rows}, func() ([]*lookupFetch, error) {
+			return n.fetchWindow(ctx, rows, cvss, ns, c)
+		})
+	}
+	sets := &xsql.JoinTuples{Content: make([]*xsql.JoinTuple, 0), WindowRange: d.GetWindowRange()}
+	wj, err := n.lookupWindow(ctx, d, fv, afv, ns, sets, c)
+	n.emitWindow(d, sets, wj, err)
+	n.statManager.ProcessTimeEnd()
+	n.statManager.SetBufferLength(int64(len(n.input)))
+	return true
+}
+
+// lookupWindow looks up each row of the window. If window snapshot is enabled and supported by the source, all rows are looked up against one snapshot.
+// It returns the rows without joined result if the side output is attached
+func (n *LookupNode) lookupWindow(ctx api.StreamContext, d *xsql.WindowTuples, fv *xsql.FunctionValuer, afv *xsql.AggregateFunctionValuer, ns api.LookupSource, tuples *xsql.JoinTuples, c *cache.Cache) (*windowJoin, error) {
+	rows, cvss, err := n.windowValues(d, fv, afv)
+	if err != nil {
+		return nil, err
+	}
+	fs, err := n.fetchWindow(ctx, rows, cvss, ns, c)
+	if err != nil {
+		return nil, err
+	}
+	return n.joinWindow(ctx, rows, fs, fv, tuples)
+}
+
+// windowValues evaluates the lookup values of each row of the window
+func (n *LookupNode) windowValues(d *xsql.WindowTuples, fv *xsql.FunctionValuer, afv *xsql.AggregateFunctionValuer) ([]xsql.TupleRow, [][]interface{}, error) {
+	var (
+		rows []xsql.TupleRow
+		cvss [][]interface{}
+	)
+	err := d.Range(func(i int, r xsql.ReadonlyRow) (bool, error) {
+		tr, ok := r.(xsql.TupleRow)
+		if !ok {
+			if n.conf.SkipInvalidWindowElements {
+				n.counters.Inc(InvalidWindowElementsTotal)
+				n.debugf("Lookup Node skips the invalid window element %d %v", i, r)
+				return true, nil
+			}
+			return false, &InvalidInputError{Table: n.name, Msg: fmt.Sprintf("Invalid window element, must be a tuple row but got %v", r)}
+		}
+		if err := n.validateInput(tr); err != nil {
+			return false, err
+		}
+		for _, er := range n.explode(tr) {
+			rows = append(rows, er)
+			cvss = append(cvss, n.lookupValues(n.valuerEval(er, d, fv, afv)))
+		}
+		return true, nil
+	})
+	return rows, cvss, err
+}
+
+// fetchWindow reads the lookup results of the values of all the window rows in one tracing span
+func (n *LookupNode) fetchWindow(ctx api.StreamContext, rows []xsql.TupleRow, cvss [][]interface{}, ns api.LookupSource, c *cache.Cache) ([]*lookupFetch, error) {
+	return n.traceFetch(ctx, nil, func() ([]*lookupFetch, error) {
+		return n.fetchWindowRows(ctx, rows, cvss, ns, c)
+	})
+}
+
+// fetchWindowRows reads the lookup results of the window rows. With window snapshot, they are read from one snapshot.
+// In temporal mode, each row is looked up at its own timestamp
+func (n *LookupNode) fetchWindowRows(ctx api.StreamContext, rows []xsql.TupleRow, cvss [][]interface{}, ns api.LookupSource, c *cache.Cache) ([]*lookupFetch, error) {
+	var lk lookuper = ns
+	if n.conf.WindowSnapshot {
+		if ss, ok := ns.(api.LookupSnapshotter); ok {
+			snap, err := ss.Snapshot(ctx)
+			if err != nil {
+				return nil, &LookupSourceError{Table: n.name, Op: "snapshot", Err: err}
+			}
+			defer func() {
+				if ce := snap.Close(ctx); ce != nil {
+					ctx.GetLogger().Warnf("close lookup snapshot of %s error: %v", n.name, ce)
+				}
+			}()
+			lk = snap
+			// the cached results may come from other versions
+			c = nil
+		}
+	}
+	if n.conf.Temporal {
+		fs := make([]*lookupFetch, len(cvss))
+		for i, cvs := range cvss {
+			f, err := n.fetchRow(ctx, n.asOfLookuper(lk, rows[i]), cvs, c)
+			if err != nil {
+				return nil, err
+			}
+			fs[i] = f
+		}
+		return fs, nil
+	}
+	return n.fetchRows(ctx, lk, cvss, c)
+}
+
+// joinWindow joins the window rows with their lookup results. It returns the rows without joined result if the side output is attached
+func (n *LookupNode) joinWindow(ctx api.StreamContext, rows []xsql.TupleRow, fs []*lookupFetch, fv *xsql.FunctionValuer, tuples *xsql.JoinTuples) (*windowJoin, error) {
+	wj := &windowJoin{rows: len(rows)}
+	side := n.hasSideOutput()
+	for i, tr := range rows {
+		l := len(tuples.Content)
+		if err := n.join(ctx, tr, fs[i], fv, tuples); err != nil {
+			return nil, err
+		}
+		added := len(tuples.Content) - l
+		if added == 0 {
+			if side {
+				wj.misses = append(wj.misses, tr)
+			}
+			// the left join row without match has the left row only
+		} else if len(tuples.Content[l].Tuples) > 1 {
+			wj.matched++
+			wj.results += added
+		}
+	}
+	return wj, nil
+}
+
+// emitWindow sends out the join result of a window. The rows without joined result are sent to the side output and
+// the summary is sent to the summary output
+func (n *LookupNode) emitWindow(d *xsql.WindowTuples, sets *xsql.JoinTuples, wj *windowJoin, err error) {
+	if err != nil {
+		rows := make([]map[string]interface{}, 0, len(d.Content))
+		for _, r := range d.Content {
+			// the invalid window elements are not reported
+			if r != nil {
+				rows = append(rows, r.ToMap())
+			}
+		}
+		err = n.publishError(map[string]interface{}{ErrorRowRows: rows}, err)
+		n.broadcast(err)
+		n.statManager.IncTotalExceptions(err.Error())
+		return
+	}
+	if n.conf.WindowSummary != SummaryOnly {
+		n.broadcast(sets)
+	}
+	n.statManager.IncTotalRecordsOut()
+	if len(wj.misses) > 0 {
+		_ = n.side.Broadcast(&xsql.WindowTuples{Content: wj.misses, WindowRange: d.GetWindowRange()})
+	}
+	if n.conf.WindowSummary != "" {
+		_ = n.summary.Broadcast(n.windowSummary(d, wj))
+	}
+}
+
+// windowSummary returns the summary tuple of the join statistics of a window
+func (n *LookupNode) windowSummary(d *xsql.WindowTuples, wj *windowJoin) *xsql.Tuple {
+	fields := n.conf.WindowSummaryFields
+	if len(fields) == 0 {
+		fields = []string{SummaryRows, SummaryMatched, SummaryMissed, SummaryResults, SummaryAvgFanout, SummaryWindowStart, SummaryWindowEnd}
+	}
+	msg := make(map[string]interface{}, len(fields))
+	for _, f := range fields {
+		switch f {
+		case SummaryRows:
+			msg[f] = wj.rows
+		case SummaryMatched:
+			msg[f] = wj.matched
+		case SummaryMissed:
+			msg[f] = wj.rows - wj.matched
+		case SummaryResults:
+			msg[f] = wj.results
+		case SummaryAvgFanout:
+			var avg float64
+			if wj.matched > 0 {
+				avg = float64(wj.results) / float64(wj.matched)
+			}
+			msg[f] = avg
+		case SummaryWindowStart:
+			if wr := d.GetWindowRange(); wr != nil {
+				msg[f], _ = wr.FuncValue("window_start")
+			}
+		case SummaryWindowEnd:
+			if wr := d.GetWindowRange(); wr != nil {
+				msg[f], _ = wr.FuncValue("window_end")
+			}
+		}
+	}
+	return &xsql.Tuple{Emitter: n.name, Message: msg, Timestamp: conf.GetNowInMilli()}
+}
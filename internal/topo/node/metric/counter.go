@@ -0,0 +1,74 @@
+// Copyright 2023 EMQ Technologies Co., Ltd.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package metric
+
+import "sync/atomic"
+
+// CounterGroup holds the operator specific counters besides the common metrics of StatManager.
+// Counters must be registered before use, the updates of unregistered counters are ignored.
+// Unlike StatManager, it is safe to update the counters concurrently.
+type CounterGroup struct {
+	names    []string
+	counters map[string]*int64
+}
+
+func NewCounterGroup() *CounterGroup {
+	return &CounterGroup{
+		counters: make(map[string]*int64),
+	}
+}
+
+// Register adds a counter. It is not thread safe and must be called before using the counters
+func (g *CounterGroup) Register(names ...string) {
+	for _, name := range names {
+		if _, ok := g.counters[name]; !ok {
+			g.names = append(g.names, name)
+			g.counters[name] = new(int64)
+		}
+	}
+}
+
+func (g *CounterGroup) Inc(name string) {
+	g.Add(name, 1)
+}
+
+func (g *CounterGroup) Add(name string, delta int64) {
+	if c, ok := g.counters[name]; ok {
+		atomic.AddInt64(c, delta)
+	}
+}
+
+// Set sets the value of a gauge like counter
+func (g *CounterGroup) Set(name string, v int64) {
+	if c, ok := g.counters[name]; ok {
+		atomic.StoreInt64(c, v)
+	}
+}
+
+func (g *CounterGroup) Get(name string) int64 {
+	if c, ok := g.counters[name]; ok {
+		return atomic.LoadInt64(c)
+	}
+	return 0
+}
+
+// GetMetrics returns the names and values of all the registered counters in the registered order
+func (g *CounterGroup) GetMetrics() ([]string, []interface{}) {
+	values := make([]interface{}, len(g.names))
+	for i, name := range g.names {
+		values[i] = atomic.LoadInt64(g.counters[name])
+	}
+	return g.names, values
+}
@@ -37,6 +37,11 @@ type OperatorNode interface {
 	RemoveMetrics(name string)
 }
 
+// ExtraMetricsNode is implemented by the operators which have their own metrics besides the common ones
+type ExtraMetricsNode interface {
+	GetExtraMetrics() (keys []string, values []interface{})
+}
+
 type DataSourceNode interface {
 	api.Emitter
 	Open(ctx api.StreamContext, errCh chan<- error)
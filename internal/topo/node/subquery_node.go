@@ -0,0 +1,347 @@
+// Copyright 2023 EMQ Technologies Co., Ltd.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package node
+
+import (
+	"fmt"
+
+	"github.com/lf-edge/ekuiper/internal/topo/lookup"
+	"github.com/lf-edge/ekuiper/internal/topo/node/metric"
+	"github.com/lf-edge/ekuiper/internal/xsql"
+	"github.com/lf-edge/ekuiper/pkg/api"
+	"github.com/lf-edge/ekuiper/pkg/ast"
+	"github.com/lf-edge/ekuiper/pkg/infra"
+)
+
+// SubqueryBatchKey is the state key of the buffered scan tables of the subquery node
+const SubqueryBatchKey = "$$subqueryBatch"
+
+// Subquery is a subquery against a table. The subquery on a scan table is materialized whenever the table is updated.
+// The IN subquery on a lookup table looks up the key of each row instead.
+type Subquery struct {
+	Expr *ast.SubqueryExpr
+	// Table is the name of the table to query
+	Table string
+	// Key is the left expression of IN to look up, only for the lookup table
+	Key ast.Expr
+	// KeyField is the table field to match the key, only for the lookup table
+	KeyField string
+	// Fields are the table fields used by the subquery, only for the lookup table
+	Fields []string
+}
+
+// SubqueryNode calculates the subqueries for each stream row and caches the results in the row, so that the later
+// ops read them like the analytic functions. The input of scan tables MUST be *WindowTuples
+type SubqueryNode struct {
+	*defaultSinkNode
+	statManager metric.StatManager
+	subqueries  []*Subquery
+	lookupers   map[string]api.LookupSource
+	// states
+	batch map[string][]*xsql.Tuple
+	// results are the materialized results of the subqueries on scan tables
+	results []interface{}
+}
+
+func NewSubqueryNode(name string, subqueries []*Subquery, options *api.RuleOption) (*SubqueryNode, error) {
+	n := &SubqueryNode{
+		subqueries: subqueries,
+		lookupers:  make(map[string]api.LookupSource),
+		batch:      make(map[string][]*xsql.Tuple),
+		results:    make([]interface{}, len(subqueries)),
+	}
+	for _, sq := range subqueries {
+		if sq.Key != nil {
+			if !sq.Expr.Scalar && sq.KeyField != "" {
+				continue
+			}
+			return nil, fmt.Errorf("only IN subquery of a single field is supported for lookup table %s", sq.Table)
+		}
+		n.batch[sq.Table] = nil
+	}
+	n.defaultSinkNode = &defaultSinkNode{
+		input: make(chan interface{}, options.BufferLength),
+		defaultNode: &defaultNode{
+			outputs:   make(map[string]chan<- interface{}),
+			name:      name,
+			sendError: options.SendError,
+		},
+	}
+	return n, nil
+}
+
+func (n *SubqueryNode) Exec(ctx api.StreamContext, errCh chan<- error) {
+	n.ctx = ctx
+	log := ctx.GetLogger()
+	log.Debugf("SubqueryNode %s is started", n.name)
+
+	if len(n.outputs) <= 0 {
+		infra.DrainError(ctx, fmt.Errorf("no output channel found"), errCh)
+		return
+	}
+	stats, err := metric.NewStatManager(ctx, "op")
+	if err != nil {
+		infra.DrainError(ctx, fmt.Errorf("fail to create stat manager"), errCh)
+		return
+	}
+	n.statManager = stats
+	n.statManagers = []metric.StatManager{stats}
+	go func() {
+		err := infra.SafeRun(func() error {
+			// detach the attached tables even if attaching a later table fails
+			defer func() {
+				for table := range n.lookupers {
+					if err := lookup.Detach(table); err != nil {
+						log.Warnf("detach lookup table %s error: %v", table, err)
+					}
+				}
+			}()
+			for _, sq := range n.subqueries {
+				if sq.Key == nil {
+					continue
+				}
+				if _, ok := n.lookupers[sq.Table]; ok {
+					continue
+				}
+				ls, err := lookup.Attach(sq.Table)
+				if err != nil {
+					return err
+				}
+				n.lookupers[sq.Table] = ls
+			}
+			fv, afv := xsql.NewFunctionValuersForOp(ctx)
+			// restore batch state
+			if s, err := ctx.GetState(SubqueryBatchKey); err == nil {
+				if st, ok := s.(map[string][]*xsql.Tuple); ok {
+					n.batch = st
+					log.Infof("Restore subquery batch state %+v", st)
+					if err := n.materialize(fv, afv); err != nil {
+						log.Warnf("Restore subquery results fails: %s", err)
+					}
+				}
+			} else {
+				log.Warnf("Restore subquery batch state fails: %s", err)
+			}
+
+			for {
+				log.Debugf("SubqueryNode %s is looping", n.name)
+				select {
+				case item, opened := <-n.input:
+					processed := false
+					if item, processed = n.preprocess(item); processed {
+						break
+					}
+					n.statManager.IncTotalRecordsIn()
+					n.statManager.ProcessTimeStart()
+					if !opened {
+						n.statManager.IncTotalExceptions("input channel closed")
+						break
+					}
+					switch d := item.(type) {
+					case error:
+						_ = n.Broadcast(d)
+						n.statManager.IncTotalExceptions(d.Error())
+					case *xsql.WatermarkTuple:
+						_ = n.Broadcast(d)
+					case *xsql.Tuple:
+						log.Debugf("SubqueryNode receive tuple input %s", d)
+						r, err := n.apply(ctx, d, fv)
+						if err != nil {
+							_ = n.Broadcast(err)
+							n.statManager.IncTotalExceptions(err.Error())
+							break
+						}
+						_ = n.Broadcast(r)
+						n.statManager.IncTotalRecordsOut()
+					case *xsql.WindowTuples:
+						if d.WindowRange != nil || len(d.Content) == 0 {
+							e := fmt.Errorf("run SubqueryNode error: invalid window input %[1]T(%[1]v)", d)
+							_ = n.Broadcast(e)
+							n.statManager.IncTotalExceptions(e.Error())
+							break
+						}
+						log.Debugf("SubqueryNode receive batch source %s", d)
+						emitter := d.Content[0].GetEmitter()
+						if _, ok := n.batch[emitter]; !ok {
+							e := fmt.Errorf("run SubqueryNode error: receive batch input from unknown emitter %[1]T(%[1]v)", d)
+							_ = n.Broadcast(e)
+							n.statManager.IncTotalExceptions(e.Error())
+							break
+						}
+						n.batch[emitter] = convertToTupleSlice(d.Content)
+						_ = ctx.PutState(SubqueryBatchKey, n.batch)
+						if err := n.materialize(fv, afv); err != nil {
+							_ = n.Broadcast(err)
+							n.statManager.IncTotalExceptions(err.Error())
+						}
+					default:
+						e := fmt.Errorf("run SubqueryNode error: invalid input type but got %[1]T(%[1]v)", d)
+						_ = n.Broadcast(e)
+						n.statManager.IncTotalExceptions(e.Error())
+					}
+					n.statManager.ProcessTimeEnd()
+					n.statManager.SetBufferLength(int64(len(n.input)))
+				case <-ctx.Done():
+					log.Infoln("Cancelling subquery node....")
+					return nil
+				}
+			}
+		})
+		if err != nil {
+			infra.DrainError(ctx, err, errCh)
+		}
+	}()
+}
+
+// apply returns a copy of the tuple with the results of the subqueries. The input tuple may be shared by other
+// branches so it is not modified
+func (n *SubqueryNode) apply(ctx api.StreamContext, tuple *xsql.Tuple, fv *xsql.FunctionValuer) (*xsql.Tuple, error) {
+	result := tuple.Clone().(*xsql.Tuple)
+	for i, sq := range n.subqueries {
+		r := n.results[i]
+		if sq.Key != nil {
+			var err error
+			r, err = n.lookup(ctx, sq, tuple, fv)
+			if err != nil {
+				return nil, fmt.Errorf("run subquery on %s error: %v", sq.Table, err)
+			}
+		}
+		result.Set(sq.Expr.CachedField, r)
+	}
+	return result, nil
+}
+
+// lookup looks up the key of the tuple in the lookup table and returns the values of the matched rows
+func (n *SubqueryNode) lookup(ctx api.StreamContext, sq *Subquery, tuple *xsql.Tuple, fv *xsql.FunctionValuer) (interface{}, error) {
+	ls, ok := n.lookupers[sq.Table]
+	if !ok {
+		return nil, fmt.Errorf("lookup table %s is not attached", sq.Table)
+	}
+	ve := &xsql.ValuerEval{Valuer: xsql.MultiValuer(tuple, fv)}
+	key := ve.Eval(sq.Key)
+	if err, ok := key.(error); ok {
+		return nil, err
+	}
+	result := make([]interface{}, 0)
+	if key == nil {
+		return result, nil
+	}
+	sts, err := ls.Lookup(ctx, sq.Fields, []string{sq.KeyField}, []interface{}{key})
+	if err != nil {
+		return nil, err
+	}
+	rows := make([]*xsql.Tuple, 0, len(sts))
+	for _, st := range sts {
+		rows = append(rows, &xsql.Tuple{Emitter: sq.Table, Message: st.Message(), Metadata: st.Meta(), Timestamp: st.Timestamp().UnixMilli()})
+	}
+	rows, err = filterRows(sq.Expr.Stmt.Condition, rows, fv)
+	if err != nil {
+		return nil, err
+	}
+	for _, row := range rows {
+		v := (&xsql.ValuerEval{Valuer: xsql.MultiValuer(row, fv)}).Eval(sq.Expr.Stmt.Fields[0].Expr)
+		if err, ok := v.(error); ok {
+			return nil, err
+		}
+		result = append(result, v)
+	}
+	return result, nil
+}
+
+// materialize calculates the subqueries on scan tables against the buffered table rows. The failed subquery results
+// in nil and the first error is returned.
+func (n *SubqueryNode) materialize(fv *xsql.FunctionValuer, afv *xsql.AggregateFunctionValuer) error {
+	var firstErr error
+	for i, sq := range n.subqueries {
+		if sq.Key != nil {
+			continue
+		}
+		r, err := evalSubquery(sq.Expr, n.batch[sq.Table], fv, afv)
+		if err != nil {
+			r = nil
+			if firstErr == nil {
+				firstErr = fmt.Errorf("run subquery on %s error: %v", sq.Table, err)
+			}
+		}
+		n.results[i] = r
+	}
+	return firstErr
+}
+
+// evalSubquery evaluates the subquery against the table rows. The IN subquery returns the values of all the rows.
+// The scalar subquery with aggregates returns the aggregate over the rows, otherwise it returns the value of the
+// only row, or nil if no row. It is an error if the scalar subquery returns more than one row.
+func evalSubquery(sq *ast.SubqueryExpr, tuples []*xsql.Tuple, fv *xsql.FunctionValuer, afv *xsql.AggregateFunctionValuer) (interface{}, error) {
+	rows, err := filterRows(sq.Stmt.Condition, tuples, fv)
+	if err != nil {
+		return nil, err
+	}
+	expr := sq.Stmt.Fields[0].Expr
+	if sq.Scalar && xsql.HasAggFuncs(expr) {
+		w := &xsql.WindowTuples{Content: make([]xsql.TupleRow, 0, len(rows))}
+		for _, row := range rows {
+			w = w.AddTuple(row)
+		}
+		w.SetIsAgg(true)
+		afv.SetData(w)
+		ve := &xsql.ValuerEval{Valuer: xsql.MultiAggregateValuer(w, fv, w, fv, afv, &xsql.WildcardValuer{Data: w})}
+		v := ve.Eval(expr)
+		if err, ok := v.(error); ok {
+			return nil, err
+		}
+		return v, nil
+	}
+	if sq.Scalar && len(rows) > 1 {
+		return nil, fmt.Errorf("scalar subquery returns %d rows", len(rows))
+	}
+	result := make([]interface{}, 0, len(rows))
+	for _, row := range rows {
+		v := (&xsql.ValuerEval{Valuer: xsql.MultiValuer(row, fv)}).Eval(expr)
+		if err, ok := v.(error); ok {
+			return nil, err
+		}
+		result = append(result, v)
+	}
+	if sq.Scalar {
+		if len(result) == 0 {
+			return nil, nil
+		}
+		return result[0], nil
+	}
+	return result, nil
+}
+
+// filterRows returns the rows matching the condition of the subquery
+func filterRows(condition ast.Expr, rows []*xsql.Tuple, fv *xsql.FunctionValuer) ([]*xsql.Tuple, error) {
+	if condition == nil {
+		return rows, nil
+	}
+	result := make([]*xsql.Tuple, 0, len(rows))
+	for _, row := range rows {
+		ve := &xsql.ValuerEval{Valuer: xsql.MultiValuer(row, fv)}
+		switch r := ve.Eval(condition).(type) {
+		case error:
+			return nil, r
+		case bool:
+			if r {
+				result = append(result, row)
+			}
+		case nil:
+		default:
+			return nil, fmt.Errorf("invalid condition that returns non-bool value %[1]T(%[1]v)", r)
+		}
+	}
+	return result, nil
+}
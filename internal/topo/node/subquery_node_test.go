@@ -0,0 +1,130 @@
+// Copyright 2023 EMQ Technologies Co., Ltd.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package node
+
+import (
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/lf-edge/ekuiper/internal/conf"
+	"github.com/lf-edge/ekuiper/internal/topo/context"
+	"github.com/lf-edge/ekuiper/internal/topo/lookup"
+	"github.com/lf-edge/ekuiper/internal/xsql"
+	"github.com/lf-edge/ekuiper/pkg/api"
+	"github.com/lf-edge/ekuiper/pkg/ast"
+)
+
+type mockSubqueryLookup struct {
+	rows map[interface{}][]map[string]interface{}
+}
+
+func (m *mockSubqueryLookup) Open(_ api.StreamContext) error { return nil }
+
+func (m *mockSubqueryLookup) Configure(_ string, _ map[string]interface{}) error { return nil }
+
+func (m *mockSubqueryLookup) Lookup(_ api.StreamContext, _ []string, _ []string, values []interface{}) ([]api.SourceTuple, error) {
+	var r []api.SourceTuple
+	for _, row := range m.rows[values[0]] {
+		r = append(r, api.NewDefaultSourceTuple(row, nil))
+	}
+	return r, nil
+}
+
+func (m *mockSubqueryLookup) Close(_ api.StreamContext) error { return nil }
+
+func TestSubquery(t *testing.T) {
+	stmt, err := xsql.NewParser(strings.NewReader("SELECT (SELECT max(threshold) FROM limits WHERE kind = 'temp') AS m, (SELECT name FROM limits WHERE kind = 'hum') AS n FROM demo WHERE deviceId IN (SELECT id FROM blacklist WHERE level > 1)")).Parse()
+	require.NoError(t, err)
+	in := stmt.Condition.(*ast.BinaryExpr)
+	sqs := []*Subquery{
+		{Expr: stmt.Fields[0].Expr.(*ast.SubqueryExpr), Table: "limits"},
+		{Expr: stmt.Fields[1].Expr.(*ast.SubqueryExpr), Table: "limits"},
+		{Expr: in.RHS.(*ast.ValueSetExpr).ArrayExpr.(*ast.SubqueryExpr), Table: "blacklist", Key: in.LHS, KeyField: "id", Fields: []string{"id", "level"}},
+	}
+	for i, sq := range sqs {
+		sq.Expr.CachedField = "$$sq_" + strconv.Itoa(i)
+	}
+	n, err := NewSubqueryNode("test", sqs, &api.RuleOption{BufferLength: 10})
+	require.NoError(t, err)
+	n.lookupers["blacklist"] = &mockSubqueryLookup{rows: map[interface{}][]map[string]interface{}{
+		"d1": {{"id": "d1", "level": 2}},
+		"d2": {{"id": "d2", "level": 1}},
+	}}
+	ctx := context.Background()
+	fv, afv := xsql.NewFunctionValuersForOp(ctx)
+	tuple := func(id string) *xsql.Tuple {
+		return &xsql.Tuple{Emitter: "demo", Message: xsql.Message{"deviceId": id}}
+	}
+	eval := func(tp *xsql.Tuple) []interface{} {
+		r, err := n.apply(ctx, tp, fv)
+		require.NoError(t, err)
+		// the results are set to a copy of the input tuple
+		require.True(t, tp.AffiliateRow.IsEmpty())
+		ve := &xsql.ValuerEval{Valuer: xsql.MultiValuer(r, fv)}
+		return []interface{}{ve.Eval(stmt.Fields[0].Expr), ve.Eval(stmt.Fields[1].Expr), ve.Eval(stmt.Condition)}
+	}
+	// the table is not loaded yet
+	require.Equal(t, []interface{}{nil, nil, true}, eval(tuple("d1")))
+
+	n.batch["limits"] = []*xsql.Tuple{
+		{Emitter: "limits", Message: xsql.Message{"kind": "temp", "threshold": 30}},
+		{Emitter: "limits", Message: xsql.Message{"kind": "temp", "threshold": 40}},
+		{Emitter: "limits", Message: xsql.Message{"kind": "hum", "threshold": 80, "name": "humidity"}},
+	}
+	require.NoError(t, n.materialize(fv, afv))
+	require.Equal(t, []interface{}{int64(40), "humidity", true}, eval(tuple("d1")))
+	// the lookup rows are filtered by the condition of the subquery
+	require.Equal(t, []interface{}{int64(40), "humidity", false}, eval(tuple("d2")))
+	require.Equal(t, []interface{}{int64(40), "humidity", false}, eval(tuple("d3")))
+
+	// the scalar subquery without aggregate must return one row at most
+	n.batch["limits"] = append(n.batch["limits"], &xsql.Tuple{Emitter: "limits", Message: xsql.Message{"kind": "hum", "threshold": 90, "name": "humidity2"}})
+	require.EqualError(t, n.materialize(fv, afv), "run subquery on limits error: scalar subquery returns 2 rows")
+	require.Equal(t, []interface{}{int64(40), nil, true}, eval(tuple("d1")))
+}
+
+func TestSubqueryInvalid(t *testing.T) {
+	stmt, err := xsql.NewParser(strings.NewReader("SELECT (SELECT id FROM blacklist) AS m FROM demo")).Parse()
+	require.NoError(t, err)
+	_, err = NewSubqueryNode("test", []*Subquery{
+		{Expr: stmt.Fields[0].Expr.(*ast.SubqueryExpr), Table: "blacklist", Key: &ast.FieldRef{Name: "deviceId", StreamName: ast.DefaultStream}, KeyField: "id"},
+	}, &api.RuleOption{BufferLength: 10})
+	require.EqualError(t, err, "only IN subquery of a single field is supported for lookup table blacklist")
+}
+
+func TestSubqueryAttachFailure(t *testing.T) {
+	require.NoError(t, lookup.CreateInstance("sqAttached", "mock", &ast.Options{DATASOURCE: "mock", TYPE: "mock", KIND: "lookup"}))
+	stmt, err := xsql.NewParser(strings.NewReader("SELECT * FROM demo WHERE deviceId IN (SELECT id FROM sqAttached) AND deviceId IN (SELECT id FROM sqMissing)")).Parse()
+	require.NoError(t, err)
+	cond := stmt.Condition.(*ast.BinaryExpr)
+	var sqs []*Subquery
+	for i, table := range []string{"sqAttached", "sqMissing"} {
+		in := []ast.Expr{cond.LHS, cond.RHS}[i].(*ast.BinaryExpr)
+		sqs = append(sqs, &Subquery{Expr: in.RHS.(*ast.ValueSetExpr).ArrayExpr.(*ast.SubqueryExpr), Table: table, Key: in.LHS, KeyField: "id", Fields: []string{"id"}})
+	}
+	n, err := NewSubqueryNode("test", sqs, &api.RuleOption{BufferLength: 10})
+	require.NoError(t, err)
+	require.NoError(t, n.AddOutput(make(chan interface{}, 10), "output"))
+	ctx, cancel := context.WithValue(context.Background(), context.LoggerKey, conf.Log).WithCancel()
+	defer cancel()
+	errCh := make(chan error, 1)
+	n.Exec(ctx, errCh)
+	require.EqualError(t, <-errCh, "lookup table sqMissing is not found")
+	// the table attached before the failure is detached so that it can be dropped
+	require.NoError(t, lookup.DropInstance("sqAttached"))
+}
@@ -18,7 +18,10 @@ import (
 	"fmt"
 	"math"
 	"sort"
+	"time"
 
+	"github.com/lf-edge/ekuiper/internal/conf"
+	"github.com/lf-edge/ekuiper/internal/topo/checkpoint"
 	"github.com/lf-edge/ekuiper/internal/topo/node/metric"
 	"github.com/lf-edge/ekuiper/internal/xsql"
 	"github.com/lf-edge/ekuiper/pkg/api"
@@ -34,10 +37,22 @@ type WatermarkOp struct {
 	// config
 	lateTolerance int64
 	sendWatermark bool
+	// allowedLateness is how much time the events after the watermark are still forwarded to update the fired windows
+	allowedLateness int64
+	// late is the side output to emit the events beyond the allowed lateness. Drop them if no output is attached
+	late *defaultNode
+	// idleTimeout is how long an input without events is idle and no longer holds back the watermark
+	idleTimeout int64
+	// partition is the metadata key to track the watermarks of the partitions in a stream like the MQTT topics
+	partition string
+	streams   map[string]struct{}
 	// state
 	events          []*xsql.Tuple // All the cached events in order
 	streamWMs       map[string]int64
 	lastWatermarkTs int64
+	// lastActive is the processing time of the last event of each input. It is not saved so the inputs are active
+	// again after restoring
+	lastActive map[string]int64
 }
 
 var _ OperatorNode = &WatermarkOp{}
@@ -50,8 +65,10 @@ const (
 
 func NewWatermarkOp(name string, sendWatermark bool, streams []string, options *api.RuleOption) *WatermarkOp {
 	wms := make(map[string]int64, len(streams))
+	ss := make(map[string]struct{}, len(streams))
 	for _, s := range streams {
 		wms[s] = options.LateTol
+		ss[s] = struct{}{}
 	}
 	return &WatermarkOp{
 		defaultSinkNode: &defaultSinkNode{
@@ -62,12 +79,41 @@ func NewWatermarkOp(name string, sendWatermark bool, streams []string, options *
 				sendError: options.SendError,
 			},
 		},
-		lateTolerance: options.LateTol,
-		sendWatermark: sendWatermark,
-		streamWMs:     wms,
+		lateTolerance:   options.LateTol,
+		sendWatermark:   sendWatermark,
+		allowedLateness: options.AllowedLateness,
+		late: &defaultNode{
+			outputs:   make(map[string]chan<- interface{}),
+			name:      name + "_late",
+			sendError: options.SendError,
+		},
+		idleTimeout: options.IdleTimeout,
+		partition:   options.WatermarkPartition,
+		streams:     ss,
+		streamWMs:   wms,
 	}
 }
 
+// GetLateEmitter returns the side output which emits the late events beyond the allowed lateness.
+// In planner graph, it is the second dim of the edges of the watermark node
+func (w *WatermarkOp) GetLateEmitter() api.Emitter {
+	return w.late
+}
+
+// SetQos sets the qos of the late output too
+func (w *WatermarkOp) SetQos(qos api.Qos) {
+	w.defaultNode.SetQos(qos)
+	w.late.SetQos(qos)
+}
+
+// Broadcast forwards the checkpoint barriers to the late output too so that its downstream can complete the checkpoint
+func (w *WatermarkOp) Broadcast(val interface{}) error {
+	if _, ok := val.(*checkpoint.Barrier); ok {
+		_ = w.late.Broadcast(val)
+	}
+	return w.defaultNode.Broadcast(val)
+}
+
 func (w *WatermarkOp) Exec(ctx api.StreamContext, errCh chan<- error) {
 	ctx.GetLogger().Debugf("watermark node %s is started", w.name)
 	if len(w.outputs) <= 0 {
@@ -82,6 +128,8 @@ func (w *WatermarkOp) Exec(ctx api.StreamContext, errCh chan<- error) {
 	w.statManager = stats
 	w.statManagers = []metric.StatManager{stats}
 	w.ctx = ctx
+	w.late.ctx = ctx
+	w.late.statManagers = w.statManagers
 	// restore state
 	if s, err := ctx.GetState(WatermarkKey); err == nil && s != nil {
 		if si, ok := s.(int64); ok {
@@ -114,8 +162,20 @@ func (w *WatermarkOp) Exec(ctx api.StreamContext, errCh chan<- error) {
 		}
 	}
 
+	now := conf.GetNowInMilli()
+	w.lastActive = make(map[string]int64, len(w.streamWMs))
+	for k := range w.streamWMs {
+		w.lastActive[k] = now
+	}
+
 	ctx.GetLogger().Infof("Start with state lastWatermarkTs: %d", w.lastWatermarkTs)
 	go func() {
+		var idleCh <-chan time.Time
+		if w.idleTimeout > 0 {
+			ticker := conf.GetTicker(w.idleTimeout)
+			defer ticker.Stop()
+			idleCh = ticker.C
+		}
 		err := infra.SafeRun(func() error {
 			for {
 				select {
@@ -141,15 +201,21 @@ func (w *WatermarkOp) Exec(ctx api.StreamContext, errCh chan<- error) {
 						// Later a series of events may send out in order
 						w.statManager.ProcessTimeStart()
 						// whether to drop the late event
-						if w.track(ctx, d.Emitter, d.GetTimestamp()) {
+						if w.track(ctx, w.inputKey(d), d.GetTimestamp()) {
 							// If not drop, check if it can be sent out
 							w.addAndTrigger(ctx, d)
+						} else {
+							w.handleLate(ctx, d)
 						}
 					default:
 						e := fmt.Errorf("run watermark op error: expect *xsql.Tuple type but got %[1]T(%[1]v)", d)
 						_ = w.Broadcast(e)
 						w.statManager.IncTotalExceptions(e.Error())
 					}
+				// the idle inputs no longer hold back the watermark even if no event comes
+				case <-idleCh:
+					w.trigger(ctx)
+					w.evictIdle(ctx)
 				}
 			}
 		})
@@ -159,8 +225,55 @@ func (w *WatermarkOp) Exec(ctx api.StreamContext, errCh chan<- error) {
 	}()
 }
 
+// inputKey is the stream of the event, or the stream and the partition once the stream has any event with the
+// partition metadata. After that, the events without the metadata are tracked as the empty partition of the stream
+func (w *WatermarkOp) inputKey(d *xsql.Tuple) string {
+	if w.partition == "" {
+		return d.Emitter
+	}
+	p, ok := d.Metadata[w.partition]
+	if !ok {
+		// the stream watermark exists until the stream is partitioned
+		if _, ok := w.streamWMs[d.Emitter]; ok {
+			return d.Emitter
+		}
+		p = ""
+	}
+	key := fmt.Sprintf("%s/%v", d.Emitter, p)
+	// the stream watermark is replaced by the partition watermarks
+	if _, ok := w.streamWMs[d.Emitter]; ok {
+		delete(w.streamWMs, d.Emitter)
+		delete(w.lastActive, d.Emitter)
+	}
+	return key
+}
+
+// evictIdle removes the idle partitions so that the tracked partitions do not grow without bound. The watermark has
+// proceeded over the idle partitions already. An evicted partition is tracked again once an event arrives
+func (w *WatermarkOp) evictIdle(ctx api.StreamContext) {
+	now := conf.GetNowInMilli()
+	evicted := false
+	for k := range w.streamWMs {
+		if _, ok := w.streams[k]; ok {
+			continue
+		}
+		if now-w.lastActive[k] >= w.idleTimeout {
+			delete(w.streamWMs, k)
+			delete(w.lastActive, k)
+			evicted = true
+		}
+	}
+	if evicted {
+		ctx.GetLogger().Debugf("evict idle partitions, %d inputs left", len(w.streamWMs))
+		_ = ctx.PutState(StreamWMKey, w.streamWMs)
+	}
+}
+
 func (w *WatermarkOp) track(ctx api.StreamContext, emitter string, ts int64) bool {
 	ctx.GetLogger().Debugf("watermark generator track event from topic %s at %d", emitter, ts)
+	if w.lastActive != nil {
+		w.lastActive[emitter] = conf.GetNowInMilli()
+	}
 	watermark, ok := w.streamWMs[emitter]
 	if !ok || ts > watermark {
 		w.streamWMs[emitter] = ts
@@ -170,6 +283,20 @@ func (w *WatermarkOp) track(ctx api.StreamContext, emitter string, ts int64) boo
 	return r
 }
 
+// handleLate forwards the late event within the allowed lateness right away so that the window can update its fired
+// results. The events beyond are sent to the late output if attached, otherwise dropped
+func (w *WatermarkOp) handleLate(ctx api.StreamContext, d *xsql.Tuple) {
+	if w.allowedLateness > 0 && d.GetTimestamp() >= w.lastWatermarkTs-w.allowedLateness {
+		ctx.GetLogger().Debugf("forward late event at %d with watermark %d", d.GetTimestamp(), w.lastWatermarkTs)
+		_ = w.Broadcast(d)
+		w.statManager.IncTotalRecordsOut()
+	} else {
+		ctx.GetLogger().Debugf("late event at %d is beyond the watermark %d", d.GetTimestamp(), w.lastWatermarkTs)
+		_ = w.late.Broadcast(d)
+	}
+	w.statManager.ProcessTimeEnd()
+}
+
 // Add an event and check if watermark proceeds
 // If yes, send out all events before the watermark
 func (w *WatermarkOp) addAndTrigger(ctx api.StreamContext, d *xsql.Tuple) {
@@ -184,13 +311,17 @@ func (w *WatermarkOp) addAndTrigger(ctx api.StreamContext, d *xsql.Tuple) {
 		copy(w.events[index+1:], w.events[index:])
 		w.events[index] = d
 	}
+	w.trigger(ctx)
+}
 
+// trigger sends out all events before the watermark if it proceeds
+func (w *WatermarkOp) trigger(ctx api.StreamContext) {
 	watermark := w.computeWatermarkTs()
 	ctx.GetLogger().Debugf("compute watermark event at %d with last %d", watermark, w.lastWatermarkTs)
 	// Make sure watermark time proceeds
 	if watermark > w.lastWatermarkTs {
 		// Send out all events before the watermark
-		if watermark >= w.events[0].GetTimestamp() {
+		if len(w.events) > 0 && watermark >= w.events[0].GetTimestamp() {
 			// Find out the last event to send in this watermark change
 			c := len(w.events)
 			for i, e := range w.events {
@@ -223,13 +354,33 @@ func (w *WatermarkOp) addAndTrigger(ctx api.StreamContext, d *xsql.Tuple) {
 	}
 }
 
-// watermark is the minimum timestamp of all input topics
+// watermark is the minimum timestamp of all active input topics. If all inputs are idle, it is the maximum timestamp
+// so that the cached events are sent out
 func (w *WatermarkOp) computeWatermarkTs() int64 {
-	var ts int64 = math.MaxInt64
-	for _, wm := range w.streamWMs {
+	var (
+		ts     int64 = math.MaxInt64
+		maxTs  int64 = math.MinInt64
+		active       = false
+		now          = conf.GetNowInMilli()
+	)
+	for k, wm := range w.streamWMs {
+		if maxTs < wm {
+			maxTs = wm
+		}
+		if w.idleTimeout > 0 && now-w.lastActive[k] >= w.idleTimeout {
+			continue
+		}
+		active = true
 		if ts > wm {
 			ts = wm
 		}
 	}
+	if !active {
+		// the evicted partitions may have the maximum timestamp, keep the watermark then
+		if len(w.streamWMs) == 0 || maxTs-w.lateTolerance < w.lastWatermarkTs {
+			return w.lastWatermarkTs
+		}
+		ts = maxTs
+	}
 	return ts - w.lateTolerance
 }
@@ -18,6 +18,7 @@ import (
 	"testing"
 	"time"
 
+	"github.com/benbjohnson/clock"
 	"github.com/stretchr/testify/assert"
 
 	"github.com/lf-edge/ekuiper/internal/conf"
@@ -506,3 +507,99 @@ func TestMultiStreamWatermark(t *testing.T) {
 		})
 	}
 }
+
+func TestWatermarkLateEvents(t *testing.T) {
+	contextLogger := conf.Log.WithField("rule", "TestWatermarkLateEvents")
+	ctx := context.WithValue(context.Background(), context.LoggerKey, contextLogger)
+	tempStore, _ := state.CreateStore("TestWatermarkLateEvents", api.AtMostOnce)
+	nctx, cancel := ctx.WithMeta("TestWatermarkLateEvents", "test", tempStore).WithCancel()
+	defer cancel()
+	w := NewWatermarkOp("mock", false, []string{"demo"}, &api.RuleOption{
+		IsEventTime:     true,
+		LateTol:         0,
+		AllowedLateness: 100,
+	})
+	errCh := make(chan error)
+	outputCh := make(chan interface{}, 10)
+	lateCh := make(chan interface{}, 10)
+	w.outputs["mock"] = outputCh
+	assert.NoError(t, w.GetLateEmitter().AddOutput(lateCh, "late"))
+	w.Exec(nctx, errCh)
+
+	tuple := func(ts int64) *xsql.Tuple {
+		return &xsql.Tuple{Emitter: "demo", Message: map[string]interface{}{"ts": ts}, Timestamp: ts}
+	}
+	receive := func(ch chan interface{}) interface{} {
+		select {
+		case err := <-errCh:
+			t.Fatal(err)
+		case v := <-ch:
+			return v
+		case <-time.After(5 * time.Second):
+			t.Fatal("receive message timeout")
+		}
+		return nil
+	}
+	w.input <- tuple(100)
+	assert.Equal(t, tuple(100), receive(outputCh))
+	// late but within the allowed lateness, forwarded right away
+	w.input <- tuple(50)
+	assert.Equal(t, tuple(50), receive(outputCh))
+	w.input <- tuple(300)
+	assert.Equal(t, tuple(300), receive(outputCh))
+	// beyond the allowed lateness, sent to the late output
+	w.input <- tuple(150)
+	assert.Equal(t, tuple(150), receive(lateCh))
+	assert.Len(t, outputCh, 0)
+}
+
+func TestWatermarkIdleInputs(t *testing.T) {
+	contextLogger := conf.Log.WithField("rule", "TestWatermarkIdleInputs")
+	ctx := context.WithValue(context.Background(), context.LoggerKey, contextLogger)
+	tempStore, _ := state.CreateStore("TestWatermarkIdleInputs", api.AtMostOnce)
+	nctx := ctx.WithMeta("TestWatermarkIdleInputs", "test", tempStore)
+	w := NewWatermarkOp("mock", true, []string{"demo1", "demo2"}, &api.RuleOption{
+		IsEventTime:        true,
+		IdleTimeout:        1000,
+		WatermarkPartition: "topic",
+	})
+	mc := conf.Clock.(*clock.Mock)
+	w.lastActive = map[string]int64{"demo1": conf.GetNowInMilli(), "demo2": conf.GetNowInMilli()}
+	track := func(topic string, ts int64) {
+		d := &xsql.Tuple{Emitter: "demo1", Message: map[string]interface{}{"ts": ts}, Metadata: xsql.Metadata{"topic": topic}, Timestamp: ts}
+		assert.True(t, w.track(nctx, w.inputKey(d), ts))
+	}
+	track("a", 100)
+	track("b", 50)
+	// the stream watermark is replaced by the partitions
+	assert.Equal(t, map[string]int64{"demo1/a": 100, "demo1/b": 50, "demo2": 0}, w.streamWMs)
+	// demo2 without any event holds back the watermark before it is idle
+	assert.Equal(t, int64(0), w.computeWatermarkTs())
+	mc.Add(500 * time.Millisecond)
+	track("b", 150)
+	assert.Equal(t, int64(0), w.computeWatermarkTs())
+	// demo2 and the partition a are idle
+	mc.Add(600 * time.Millisecond)
+	assert.Equal(t, int64(150), w.computeWatermarkTs())
+	// all inputs are idle
+	mc.Add(time.Second)
+	assert.Equal(t, int64(150), w.computeWatermarkTs())
+	track("a", 120)
+	assert.Equal(t, int64(120), w.computeWatermarkTs())
+	// the events without the partition are tracked as the empty partition of the partitioned stream
+	noPartition := &xsql.Tuple{Emitter: "demo1", Message: map[string]interface{}{"ts": 130}, Timestamp: 130}
+	assert.True(t, w.track(nctx, w.inputKey(noPartition), 130))
+	assert.Equal(t, map[string]int64{"demo1/a": 120, "demo1/b": 150, "demo1/": 130, "demo2": 0}, w.streamWMs)
+	// the idle partitions are evicted but the streams are kept
+	mc.Add(500 * time.Millisecond)
+	track("a", 140)
+	w.evictIdle(nctx)
+	assert.Equal(t, map[string]int64{"demo1/a": 140, "demo1/": 130, "demo2": 0}, w.streamWMs)
+	mc.Add(time.Second)
+	w.evictIdle(nctx)
+	assert.Equal(t, map[string]int64{"demo2": 0}, w.streamWMs)
+	w.lastWatermarkTs = 140
+	assert.Equal(t, int64(140), w.computeWatermarkTs())
+	track("b", 160)
+	assert.Equal(t, int64(160), w.computeWatermarkTs())
+}
@@ -0,0 +1,140 @@
+// Copyright 2023 EMQ Technologies Co., Ltd.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package node
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/benbjohnson/clock"
+
+	"github.com/lf-edge/ekuiper/internal/conf"
+	"github.com/lf-edge/ekuiper/internal/xsql"
+	"github.com/lf-edge/ekuiper/pkg/api"
+)
+
+// execCountOrTimeWindow runs the window which starts from the first tuple and closes when it has the max count of
+// tuples or has lasted for the max duration, whichever comes first. The window length is the duration and the interval
+// is the count. In processing time, a timer fires at the end of the duration. In event time, the window is closed when
+// the watermark or a later tuple passes the end.
+func (o *WindowOperator) execCountOrTimeWindow(ctx api.StreamContext, inputs []*xsql.Tuple) {
+	log := ctx.GetLogger()
+	var (
+		timer *clock.Timer
+		c     <-chan time.Time
+	)
+	stop := func() {
+		if timer != nil {
+			timer.Stop()
+			timer = nil
+			c = nil
+		}
+	}
+	// schedule starts a new timer for each window so that the fired value of the stopped timer is never read
+	schedule := func(end int64) {
+		if o.isEventTime {
+			return
+		}
+		stop()
+		d := end - conf.GetNowInMilli()
+		if d < 0 {
+			d = 0
+		}
+		timer = conf.GetTimer(d)
+		c = timer.C
+	}
+	emit := func(end int64) {
+		results := &xsql.WindowTuples{
+			Content: make([]xsql.TupleRow, 0, len(inputs)),
+		}
+		for _, t := range inputs {
+			results = results.AddTuple(t)
+		}
+		results.WindowRange = xsql.NewWindowRange(inputs[0].Timestamp, end)
+		log.Debugf("count or time window %s triggered for %d tuples", o.name, len(inputs))
+		_ = o.Broadcast(results)
+		o.statManager.IncTotalRecordsOut()
+		inputs = make([]*xsql.Tuple, 0)
+		stop()
+	}
+	add := func(tuple *xsql.Tuple) {
+		// the tuple after the end belongs to the next window
+		if len(inputs) > 0 && tuple.Timestamp >= inputs[0].Timestamp+o.window.Length {
+			emit(inputs[0].Timestamp + o.window.Length)
+		}
+		inputs = append(inputs, tuple)
+		if len(inputs) == 1 {
+			schedule(tuple.Timestamp + o.window.Length)
+		}
+		if int64(len(inputs)) >= o.window.Interval {
+			emit(tuple.Timestamp)
+		}
+	}
+	// resume the timer of the restored window
+	if len(inputs) > 0 {
+		schedule(inputs[0].Timestamp + o.window.Length)
+	}
+	for {
+		select {
+		case item, opened := <-o.input:
+			if !opened {
+				o.statManager.IncTotalExceptions("input channel closed")
+				break
+			}
+			processed := false
+			if item, processed = o.preprocess(item); processed {
+				break
+			}
+			switch d := item.(type) {
+			case error:
+				_ = o.Broadcast(d)
+				o.statManager.IncTotalExceptions(d.Error())
+			case *xsql.WatermarkTuple:
+				if len(inputs) > 0 && inputs[0].Timestamp+o.window.Length <= d.GetTimestamp() {
+					o.statManager.ProcessTimeStart()
+					emit(inputs[0].Timestamp + o.window.Length)
+					o.statManager.ProcessTimeEnd()
+					_ = ctx.PutState(WindowInputsKey, inputs)
+				}
+			case *xsql.Tuple:
+				log.Debugf("Count or time window receive tuple %s", d.Message)
+				o.statManager.IncTotalRecordsIn()
+				o.statManager.ProcessTimeStart()
+				add(d)
+				o.statManager.ProcessTimeEnd()
+				o.statManager.SetBufferLength(int64(len(o.input)))
+				_ = ctx.PutState(WindowInputsKey, inputs)
+			default:
+				e := fmt.Errorf("run Window error: expect xsql.Tuple type but got %[1]T(%[1]v)", d)
+				_ = o.Broadcast(e)
+				o.statManager.IncTotalExceptions(e.Error())
+			}
+		case now := <-c:
+			log.Debugf("Count or time window timer fires at %d", now.UnixMilli())
+			timer = nil
+			c = nil
+			if len(inputs) > 0 {
+				o.statManager.ProcessTimeStart()
+				emit(inputs[0].Timestamp + o.window.Length)
+				o.statManager.ProcessTimeEnd()
+				_ = ctx.PutState(WindowInputsKey, inputs)
+			}
+		case <-ctx.Done():
+			log.Infoln("Cancelling window....")
+			stop()
+			return
+		}
+	}
+}
@@ -0,0 +1,78 @@
+// Copyright 2023 EMQ Technologies Co., Ltd.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package node
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/lf-edge/ekuiper/internal/conf"
+	"github.com/lf-edge/ekuiper/internal/topo/context"
+	"github.com/lf-edge/ekuiper/internal/topo/state"
+	"github.com/lf-edge/ekuiper/internal/xsql"
+	"github.com/lf-edge/ekuiper/pkg/api"
+	"github.com/lf-edge/ekuiper/pkg/ast"
+)
+
+func TestCountOrTimeWindow(t *testing.T) {
+	contextLogger := conf.Log.WithField("rule", "TestCountOrTimeWindow")
+	ctx := context.WithValue(context.Background(), context.LoggerKey, contextLogger)
+	tempStore, _ := state.CreateStore("TestCountOrTimeWindow", api.AtMostOnce)
+	nctx, cancel := ctx.WithMeta("TestCountOrTimeWindow", "test", tempStore).WithCancel()
+	defer cancel()
+	o, err := NewWindowOp("test", WindowConfig{Type: ast.COUNT_OR_TIME_WINDOW, Length: 1000, Interval: 3, RawInterval: 1, TimeUnit: ast.SS}, &api.RuleOption{IsEventTime: true})
+	require.NoError(t, err)
+	errCh := make(chan error)
+	outputCh := make(chan interface{}, 10)
+	o.outputs["mock"] = outputCh
+	o.Exec(nctx, errCh)
+
+	tuple := func(ts int64) *xsql.Tuple {
+		return &xsql.Tuple{Emitter: "demo", Message: map[string]interface{}{"ts": ts}, Timestamp: ts}
+	}
+	receive := func() *xsql.WindowTuples {
+		select {
+		case err := <-errCh:
+			t.Fatal(err)
+		case v := <-outputCh:
+			return v.(*xsql.WindowTuples)
+		case <-time.After(5 * time.Second):
+			t.Fatal("receive message timeout")
+		}
+		return nil
+	}
+	// closed by the count
+	o.input <- tuple(100)
+	o.input <- tuple(200)
+	o.input <- tuple(300)
+	r := receive()
+	require.Equal(t, 3, r.Len())
+	require.Equal(t, xsql.NewWindowRange(100, 300), r.WindowRange)
+	// closed by the duration when a later tuple arrives
+	o.input <- tuple(500)
+	o.input <- &xsql.WatermarkTuple{Timestamp: 1400}
+	o.input <- tuple(1600)
+	r = receive()
+	require.Equal(t, 1, r.Len())
+	require.Equal(t, xsql.NewWindowRange(500, 1500), r.WindowRange)
+	// closed by the duration when the watermark passes
+	o.input <- &xsql.WatermarkTuple{Timestamp: 2600}
+	r = receive()
+	require.Equal(t, 1, r.Len())
+	require.Equal(t, xsql.NewWindowRange(1600, 2600), r.WindowRange)
+	require.Len(t, outputCh, 0)
+}
@@ -40,6 +40,15 @@ type WindowConfig struct {
 	Delay            int64
 	RawInterval      int
 	TimeUnit         ast.Token
+	// Partition is the partition keys of the session window. If set, each key has its own session
+	Partition *ast.PartitionExpr
+	// PaneAggs are the aggregate calls of the hopping or tumbling window to calculate incrementally by panes. If set,
+	// the window emits a row with the results in the cached fields for each group of the PaneKeys instead of the tuples
+	PaneAggs []*ast.Call
+	PaneKeys []*ast.FieldRef
+	// Rollup is the time units of the tiers which merge the results of the tumbling window with panes further. Each
+	// tier emits the merged results when its natural time unit ends
+	Rollup []ast.Token
 }
 
 type WindowOperator struct {
@@ -49,6 +58,8 @@ type WindowOperator struct {
 	duration    int64
 	isEventTime bool
 	trigger     *EventTimeTrigger // For event time only
+	// allowedLateness is how much time the fired windows wait for the late tuples to re-fire. For event time only
+	allowedLateness int64
 
 	statManager metric.StatManager
 	ticker      *clock.Ticker // For processing time only
@@ -59,12 +70,15 @@ type WindowOperator struct {
 	triggerTS        []int64
 	triggerCondition ast.Expr
 	stateFuncs       []*ast.Call
+	// history is the fired tuples which have left the inputs but are kept for the allowed lateness to re-fire the windows
+	history []*xsql.Tuple
 }
 
 const (
-	WindowInputsKey = "$$windowInputs"
-	TriggerTimeKey  = "$$triggerTime"
-	MsgCountKey     = "$$msgCount"
+	WindowInputsKey  = "$$windowInputs"
+	TriggerTimeKey   = "$$triggerTime"
+	MsgCountKey      = "$$msgCount"
+	WindowHistoryKey = "$$windowHistory"
 )
 
 func init() {
@@ -89,6 +103,10 @@ func NewWindowOp(name string, w WindowConfig, options *api.RuleOption) (*WindowO
 		// if no interval value is set, and it's a count window, then set interval to length value.
 		o.window.Interval = o.window.Length
 	}
+	if o.window.Interval == 0 && o.window.Type == ast.TUMBLING_WINDOW && len(o.window.PaneAggs) > 0 {
+		// the tumbling window with panes runs as the hopping window whose interval is the length
+		o.window.Interval = o.window.Length
+	}
 	if options.IsEventTime {
 		// Create watermark generator
 		if w, err := NewEventTimeTrigger(o.window); err != nil {
@@ -96,6 +114,7 @@ func NewWindowOp(name string, w WindowConfig, options *api.RuleOption) (*WindowO
 		} else {
 			o.trigger = w
 		}
+		o.allowedLateness = options.AllowedLateness
 	}
 	if w.TriggerCondition != nil {
 		o.triggerCondition = w.TriggerCondition
@@ -160,7 +179,37 @@ func (o *WindowOperator) Exec(ctx api.StreamContext, errCh chan<- error) {
 		}
 	}
 	log.Infof("Start with window state triggerTime: %d, msgCount: %d", o.triggerTime, o.msgCount)
-	if o.isEventTime {
+	if o.window.Type == ast.SESSION_WINDOW && o.window.Partition != nil {
+		go func() {
+			err := infra.SafeRun(func() error {
+				o.execPartitionedSessionWindow(ctx, inputs)
+				return nil
+			})
+			if err != nil {
+				infra.DrainError(ctx, err, errCh)
+			}
+		}()
+	} else if o.window.Type == ast.COUNT_OR_TIME_WINDOW {
+		go func() {
+			err := infra.SafeRun(func() error {
+				o.execCountOrTimeWindow(ctx, inputs)
+				return nil
+			})
+			if err != nil {
+				infra.DrainError(ctx, err, errCh)
+			}
+		}()
+	} else if len(o.window.PaneAggs) > 0 {
+		go func() {
+			err := infra.SafeRun(func() error {
+				o.execPaneWindow(ctx, inputs)
+				return nil
+			})
+			if err != nil {
+				infra.DrainError(ctx, err, errCh)
+			}
+		}()
+	} else if o.isEventTime {
 		go func() {
 			err := infra.SafeRun(func() error {
 				o.execEventWindow(ctx, inputs, errCh)
@@ -346,6 +395,8 @@ func (o *WindowOperator) execProcessingWindow(ctx api.StreamContext, inputs []*x
 				switch o.window.Type {
 				case ast.NOT_WINDOW:
 					inputs = o.scan(inputs, d.Timestamp, ctx)
+				case ast.TUMBLING_WINDOW:
+					inputs = o.triggerEarly(ctx, inputs, d)
 				case ast.SLIDING_WINDOW:
 					if o.isMatchCondition(ctx, d) {
 						if o.window.Delay > 0 {
@@ -371,6 +422,7 @@ func (o *WindowOperator) execProcessingWindow(ctx api.StreamContext, inputs []*x
 						_ = ctx.PutState(TriggerTimeKey, o.triggerTime)
 						log.Debugf("Session window set start time %d", o.triggerTime)
 					}
+					inputs = o.triggerEarly(ctx, inputs, d)
 				case ast.COUNT_WINDOW:
 					o.msgCount++
 					log.Debugf(fmt.Sprintf("msgCount: %d", o.msgCount))
@@ -438,8 +490,9 @@ func (o *WindowOperator) execProcessingWindow(ctx api.StreamContext, inputs []*x
 				o.statManager.ProcessTimeEnd()
 				_ = ctx.PutState(WindowInputsKey, inputs)
 				_ = ctx.PutState(TriggerTimeKey, o.triggerTime)
-				timeoutTicker = nil
 			}
+			// the session is closed even if its inputs have been emitted by the trigger condition
+			timeoutTicker = nil
 		// is cancelling
 		case <-ctx.Done():
 			log.Infoln("Cancelling window....")
@@ -646,6 +699,40 @@ func (o *WindowOperator) GetMetrics() [][]interface{} {
 	return o.defaultNode.GetMetrics()
 }
 
+// triggerEarly emits the tuples of the tumbling or session window before it closes if the trigger condition is met.
+// The aggregate functions in the condition are calculated over the tuples and the fields refer to the latest tuple. The
+// emitted tuples are removed so that the window emits the rest when it closes.
+func (o *WindowOperator) triggerEarly(ctx api.StreamContext, inputs []*xsql.Tuple, d *xsql.Tuple) []*xsql.Tuple {
+	if o.triggerCondition == nil || len(inputs) == 0 {
+		return inputs
+	}
+	results := &xsql.WindowTuples{
+		Content: make([]xsql.TupleRow, 0, len(inputs)),
+	}
+	for _, tuple := range inputs {
+		results = results.AddTuple(tuple)
+	}
+	results.WindowRange = xsql.NewWindowRange(o.triggerTime, conf.GetNowInMilli())
+	fv, afv := xsql.NewFunctionValuersForOp(ctx)
+	afv.SetData(results)
+	ve := &xsql.ValuerEval{Valuer: xsql.MultiAggregateValuer(results, fv, d, fv, afv, &xsql.WildcardValuer{Data: d})}
+	switch v := ve.Eval(o.triggerCondition).(type) {
+	case error:
+		ctx.GetLogger().Errorf("window %s trigger condition meet error: %v", o.name, v)
+		return inputs
+	case bool:
+		if !v {
+			return inputs
+		}
+	default:
+		return inputs
+	}
+	ctx.GetLogger().Debugf("window %s triggered by the condition for %d tuples", o.name, len(inputs))
+	_ = o.Broadcast(results)
+	o.statManager.IncTotalRecordsOut()
+	return make([]*xsql.Tuple, 0)
+}
+
 func (o *WindowOperator) isMatchCondition(ctx api.StreamContext, d *xsql.Tuple) bool {
 	if o.triggerCondition == nil || o.window.Type != ast.SLIDING_WINDOW {
 		return true
@@ -17,10 +17,18 @@ package node
 import (
 	"fmt"
 	"reflect"
+	"strings"
 	"testing"
 	"time"
 
+	"github.com/stretchr/testify/require"
+
+	"github.com/lf-edge/ekuiper/internal/conf"
+	"github.com/lf-edge/ekuiper/internal/topo/context"
+	"github.com/lf-edge/ekuiper/internal/topo/node/metric"
+	"github.com/lf-edge/ekuiper/internal/topo/state"
 	"github.com/lf-edge/ekuiper/internal/xsql"
+	"github.com/lf-edge/ekuiper/pkg/api"
 	"github.com/lf-edge/ekuiper/pkg/ast"
 )
 
@@ -339,3 +347,123 @@ func TestCountWindow(t *testing.T) {
 		}
 	}
 }
+
+func TestWindowRefire(t *testing.T) {
+	contextLogger := conf.Log.WithField("rule", "TestWindowRefire")
+	ctx := context.WithValue(context.Background(), context.LoggerKey, contextLogger)
+	tempStore, _ := state.CreateStore("TestWindowRefire", api.AtMostOnce)
+	nctx := ctx.WithMeta("TestWindowRefire", "test", tempStore)
+	tuple := func(ts int64) *xsql.Tuple {
+		return &xsql.Tuple{Emitter: "demo", Message: map[string]interface{}{"ts": ts}, Timestamp: ts}
+	}
+	newOp := func(w WindowConfig) (*WindowOperator, chan interface{}) {
+		o, err := NewWindowOp("test", w, &api.RuleOption{IsEventTime: true, AllowedLateness: 500, BufferLength: 10})
+		require.NoError(t, err)
+		stats, err := metric.NewStatManager(nctx, "op")
+		require.NoError(t, err)
+		o.ctx = nctx
+		o.statManager = stats
+		o.statManagers = []metric.StatManager{stats}
+		ch := make(chan interface{}, 10)
+		o.outputs["out"] = ch
+		return o, ch
+	}
+
+	// the late tuple re-fires the tumbling window it belongs to
+	o, ch := newOp(WindowConfig{Type: ast.TUMBLING_WINDOW, Length: 1000, RawInterval: 1, TimeUnit: ast.SS})
+	o.history = []*xsql.Tuple{tuple(100), tuple(600), tuple(1200), tuple(900)}
+	o.refire(nctx, tuple(900), 2000, nil)
+	require.Len(t, ch, 1)
+	r := (<-ch).(*xsql.WindowTuples)
+	require.Equal(t, xsql.NewWindowRange(0, 1000), r.WindowRange)
+	require.Equal(t, 3, r.Len())
+	// the tuples which cannot be in any window to re-fire are removed
+	require.True(t, o.expireHistory(2000))
+	require.Equal(t, []*xsql.Tuple{tuple(600), tuple(1200), tuple(900)}, o.history)
+
+	// the late tuple re-fires all the hopping windows it belongs to
+	o, ch = newOp(WindowConfig{Type: ast.HOPPING_WINDOW, Length: 2000, Interval: 1000, RawInterval: 1, TimeUnit: ast.SS})
+	o.history = []*xsql.Tuple{tuple(100), tuple(1200), tuple(2100), tuple(900)}
+	o.refire(nctx, tuple(900), 3000, nil)
+	require.Len(t, ch, 2)
+	r = (<-ch).(*xsql.WindowTuples)
+	require.Equal(t, xsql.NewWindowRange(0, 2000), r.WindowRange)
+	require.Equal(t, 3, r.Len())
+	r = (<-ch).(*xsql.WindowTuples)
+	require.Equal(t, xsql.NewWindowRange(-1000, 1000), r.WindowRange)
+	require.Equal(t, 2, r.Len())
+
+	// the late tuple of the hopping window also lands in the window to fire
+	o, ch = newOp(WindowConfig{Type: ast.HOPPING_WINDOW, Length: 2000, Interval: 1000, RawInterval: 1, TimeUnit: ast.SS})
+	cctx, cancel := nctx.WithCancel()
+	defer cancel()
+	go o.execEventWindow(cctx, nil, nil)
+	for _, d := range []interface{}{tuple(1100), tuple(2100), tuple(2900), &xsql.WatermarkTuple{Timestamp: 3000}} {
+		o.input <- d
+	}
+	receive := func() *xsql.WindowTuples {
+		select {
+		case v := <-ch:
+			return v.(*xsql.WindowTuples)
+		case <-time.After(time.Second):
+			t.Fatal("expect the window result")
+		}
+		return nil
+	}
+	// the empty window before the first tuple fires too
+	for _, n := range []int{0, 1, 3} {
+		require.Equal(t, n, receive().Len())
+	}
+	o.input <- tuple(2500)
+	r = receive()
+	require.Equal(t, xsql.NewWindowRange(1000, 3000), r.WindowRange)
+	require.Equal(t, 4, r.Len())
+	o.input <- &xsql.WatermarkTuple{Timestamp: 4000}
+	r = receive()
+	require.Equal(t, xsql.NewWindowRange(2000, 4000), r.WindowRange)
+	require.Equal(t, 3, r.Len())
+}
+
+func TestWindowTriggerEarly(t *testing.T) {
+	contextLogger := conf.Log.WithField("rule", "TestWindowTriggerEarly")
+	ctx := context.WithValue(context.Background(), context.LoggerKey, contextLogger)
+	tempStore, _ := state.CreateStore("TestWindowTriggerEarly", api.AtMostOnce)
+	nctx := ctx.WithMeta("TestWindowTriggerEarly", "test", tempStore)
+	stmt, err := xsql.NewParser(strings.NewReader(`SELECT count(*) FROM demo GROUP BY TUMBLINGWINDOW(ss, 10) OVER (WHEN count(*) >= 3 OR kind = "eob")`)).Parse()
+	require.NoError(t, err)
+	w := stmt.Dimensions.GetWindow()
+	o, err := NewWindowOp("test", WindowConfig{Type: ast.TUMBLING_WINDOW, Length: 10000, RawInterval: 10, TimeUnit: ast.SS, TriggerCondition: w.TriggerCondition}, &api.RuleOption{BufferLength: 10})
+	require.NoError(t, err)
+	stats, err := metric.NewStatManager(nctx, "op")
+	require.NoError(t, err)
+	o.ctx = nctx
+	o.statManager = stats
+	o.statManagers = []metric.StatManager{stats}
+	ch := make(chan interface{}, 10)
+	o.outputs["out"] = ch
+	tuple := func(kind string) *xsql.Tuple {
+		return &xsql.Tuple{Emitter: "demo", Message: map[string]interface{}{"kind": kind}}
+	}
+
+	var inputs []*xsql.Tuple
+	for i := 0; i < 2; i++ {
+		d := tuple("data")
+		inputs = o.triggerEarly(nctx, append(inputs, d), d)
+	}
+	require.Len(t, inputs, 2)
+	require.Len(t, ch, 0)
+	// the aggregate condition is met
+	d := tuple("data")
+	inputs = o.triggerEarly(nctx, append(inputs, d), d)
+	require.Empty(t, inputs)
+	require.Len(t, ch, 1)
+	require.Equal(t, 3, (<-ch).(*xsql.WindowTuples).Len())
+	// the condition of the latest tuple is met
+	d = tuple("data")
+	inputs = o.triggerEarly(nctx, append(inputs, d), d)
+	d = tuple("eob")
+	inputs = o.triggerEarly(nctx, append(inputs, d), d)
+	require.Empty(t, inputs)
+	require.Len(t, ch, 1)
+	require.Equal(t, 2, (<-ch).(*xsql.WindowTuples).Len())
+}
@@ -0,0 +1,663 @@
+// Copyright 2023 EMQ Technologies Co., Ltd.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package node
+
+import (
+	"encoding/gob"
+	"errors"
+	"fmt"
+	"math"
+	"strings"
+	"time"
+
+	"github.com/benbjohnson/clock"
+
+	"github.com/lf-edge/ekuiper/internal/conf"
+	"github.com/lf-edge/ekuiper/internal/xsql"
+	"github.com/lf-edge/ekuiper/pkg/api"
+	"github.com/lf-edge/ekuiper/pkg/ast"
+	"github.com/lf-edge/ekuiper/pkg/cast"
+)
+
+const WindowPanesKey = "$$windowPanes"
+
+func init() {
+	gob.Register(&paneState{})
+}
+
+// paneKind is the type of the aggregated values, which is decided by the first value like the builtin functions
+type paneKind int8
+
+const (
+	paneNone paneKind = iota
+	paneInt
+	paneFloat
+	paneString
+)
+
+func (k paneKind) String() string {
+	switch k {
+	case paneInt:
+		return "int"
+	case paneFloat:
+		return "float64"
+	case paneString:
+		return "string"
+	default:
+		return "nil"
+	}
+}
+
+// paneTop is a value kept by topn. F or S is the value to compare according to the kind of the accumulator
+type paneTop struct {
+	V interface{}
+	F float64
+	S string
+}
+
+// paneAcc is the partial result of an aggregate function. Int, Float or Str is the sum for sum and avg, the min for
+// min and the max for max according to the kind. For topn, Top is the N largest values in descending order
+type paneAcc struct {
+	// Count is the count of the non-nil values
+	Count int64
+	Kind  paneKind
+	Int   int64
+	Float float64
+	Str   string
+	Err   string
+	N     int
+	Top   []*paneTop
+}
+
+// newPaneAccs creates the empty partial results of the aggregate functions
+func newPaneAccs(aggs []*ast.Call) []*paneAcc {
+	accs := make([]*paneAcc, len(aggs))
+	for i, c := range aggs {
+		accs[i] = &paneAcc{}
+		if c.Name == "topn" && len(c.Args) == 2 {
+			if il, ok := c.Args[1].(*ast.IntegerLiteral); ok {
+				accs[i].N = int(il.Val)
+			}
+		}
+	}
+	return accs
+}
+
+// add accumulates a value of the aggregate function with the name
+func (a *paneAcc) add(name string, v interface{}) {
+	if v == nil {
+		return
+	}
+	o := paneAcc{Count: 1, N: a.N}
+	if name == "topn" {
+		top := &paneTop{V: v}
+		if s, ok := v.(string); ok {
+			o.Kind, top.S = paneString, s
+		} else if f, err := cast.ToFloat64(v, cast.CONVERT_SAMEKIND); err == nil {
+			o.Kind, top.F = paneFloat, f
+		} else {
+			o.Err = fmt.Sprintf("run %s function error: found invalid arg %[2]T(%[2]v)", name, v)
+		}
+		o.Top = []*paneTop{top}
+	} else if name != "count" {
+		switch t := v.(type) {
+		case int:
+			o.Kind, o.Int = paneInt, int64(t)
+		case int64:
+			o.Kind, o.Int = paneInt, t
+		case float64:
+			// the int values convert the later float values like the builtin functions
+			if a.Kind == paneInt {
+				o.Kind, o.Int = paneInt, int64(t)
+			} else {
+				o.Kind, o.Float = paneFloat, t
+			}
+		case string:
+			if name == "min" || name == "max" {
+				o.Kind, o.Str = paneString, t
+			} else {
+				o.Err = fmt.Sprintf("run %s function error: found invalid arg %[2]T(%[2]v)", name, v)
+			}
+		default:
+			if vi, err := cast.ToInt64(v, cast.CONVERT_SAMEKIND); err == nil && a.Kind == paneInt {
+				o.Kind, o.Int = paneInt, vi
+			} else {
+				o.Err = fmt.Sprintf("run %s function error: found invalid arg %[2]T(%[2]v)", name, v)
+			}
+		}
+	}
+	a.merge(name, &o)
+}
+
+// merge merges the partial result of the same aggregate function
+func (a *paneAcc) merge(name string, o *paneAcc) {
+	if a.Err != "" {
+		return
+	}
+	if o.Err != "" {
+		a.Err = o.Err
+		return
+	}
+	a.Count += o.Count
+	if name == "count" || o.Kind == paneNone {
+		return
+	}
+	if name == "topn" {
+		a.mergeTop(o)
+		return
+	}
+	switch {
+	case a.Kind == paneNone:
+		a.Kind, a.Int, a.Float, a.Str = o.Kind, o.Int, o.Float, o.Str
+	case a.Kind == paneInt && o.Kind == paneFloat:
+		a.mergeInt(name, int64(o.Float))
+	case a.Kind != o.Kind:
+		a.Err = fmt.Sprintf("run %s function error: requires %s but found %s", name, a.Kind, o.Kind)
+	case a.Kind == paneInt:
+		a.mergeInt(name, o.Int)
+	case a.Kind == paneFloat:
+		switch name {
+		case "min":
+			a.Float = math.Min(a.Float, o.Float)
+		case "max":
+			a.Float = math.Max(a.Float, o.Float)
+		default:
+			a.Float += o.Float
+		}
+	default:
+		if (name == "min" && o.Str < a.Str) || (name == "max" && o.Str > a.Str) {
+			a.Str = o.Str
+		}
+	}
+}
+
+func (a *paneAcc) mergeInt(name string, v int64) {
+	switch name {
+	case "min":
+		if v < a.Int {
+			a.Int = v
+		}
+	case "max":
+		if v > a.Int {
+			a.Int = v
+		}
+	default:
+		a.Int += v
+	}
+}
+
+// mergeTop merges the largest values of the later values so that at most N values are kept. The earlier one of the
+// equal values is in front like the builtin function
+func (a *paneAcc) mergeTop(o *paneAcc) {
+	if a.N == 0 {
+		a.N = o.N
+	}
+	if a.Kind == paneNone {
+		a.Kind = o.Kind
+	} else if a.Kind != o.Kind {
+		a.Err = fmt.Sprintf("run topn function error: requires the values of the same type but found %v and %v", a.Top[0].V, o.Top[0].V)
+		return
+	}
+	less := func(x, y *paneTop) bool {
+		if a.Kind == paneString {
+			return x.S < y.S
+		}
+		return x.F < y.F
+	}
+	merged := make([]*paneTop, 0, a.N)
+	i, j := 0, 0
+	for len(merged) < a.N && (i < len(a.Top) || j < len(o.Top)) {
+		if j >= len(o.Top) || (i < len(a.Top) && !less(a.Top[i], o.Top[j])) {
+			merged = append(merged, a.Top[i])
+			i++
+		} else {
+			merged = append(merged, o.Top[j])
+			j++
+		}
+	}
+	a.Top = merged
+}
+
+// result returns the same result as the builtin aggregate function over all the values
+func (a *paneAcc) result(name string) interface{} {
+	if a.Err != "" {
+		return errors.New(a.Err)
+	}
+	if name == "count" {
+		return int(a.Count)
+	}
+	if name == "topn" {
+		result := make([]interface{}, len(a.Top))
+		for i, t := range a.Top {
+			result[i] = t.V
+		}
+		return result
+	}
+	switch a.Kind {
+	case paneInt:
+		if name == "avg" {
+			return a.Int / a.Count
+		}
+		return a.Int
+	case paneFloat:
+		if name == "avg" {
+			return a.Float / float64(a.Count)
+		}
+		return a.Float
+	case paneString:
+		return a.Str
+	default:
+		return nil
+	}
+}
+
+// paneGroup is the partial results of a group in a pane or in a window when merged
+type paneGroup struct {
+	Key     string
+	Emitter string
+	// Keys are the values of the group by fields
+	Keys map[string]interface{}
+	// Ts is the timestamp of the first tuple of the group
+	Ts   int64
+	Accs []*paneAcc
+}
+
+type pane struct {
+	Start  int64
+	Groups []*paneGroup
+	index  map[string]*paneGroup
+}
+
+func (p *pane) group(key string) (*paneGroup, bool) {
+	if p.index == nil {
+		p.index = make(map[string]*paneGroup, len(p.Groups))
+		for _, g := range p.Groups {
+			p.index[g.Key] = g
+		}
+	}
+	g, ok := p.index[key]
+	return g, ok
+}
+
+// merge merges the partial results of a group into the group of the same key in the pane
+func (p *pane) merge(g *paneGroup, aggs []*ast.Call) {
+	m, ok := p.group(g.Key)
+	if !ok {
+		m = &paneGroup{Key: g.Key, Emitter: g.Emitter, Keys: g.Keys, Ts: g.Ts, Accs: newPaneAccs(aggs)}
+		p.Groups = append(p.Groups, m)
+		p.index[g.Key] = m
+	}
+	for i, a := range g.Accs {
+		m.Accs[i].merge(aggs[i].Name, a)
+	}
+}
+
+// rollupTier is a tier of the rollup. Pane is the merged partial results of the finer tier, from its start to the End
+// of the natural time unit. It is nil before the first results of the finer tier
+type rollupTier struct {
+	Unit ast.Token
+	End  int64
+	Pane *pane
+}
+
+// paneState is the panes saved in the state. Next is the end of the next window in event time
+type paneState struct {
+	Anchor int64
+	Next   int64
+	Panes  []*pane
+	// Tiers is saved with the panes so that the rollup is consistent with the window after recovery
+	Tiers []*rollupTier
+}
+
+// paneWindow keeps the partial results of the aggregate functions of the hopping window by panes instead of the tuples.
+// The tumbling window is a hopping window with only one pane in each window. The size of a pane is the greatest common
+// divisor of the length and the interval, and the panes are aligned to the first window end, so that each window covers
+// a whole number of panes. A tuple is only accumulated in one pane when received, and a window merges the partial
+// results of its panes when emitted.
+type paneWindow struct {
+	size   int64
+	anchor int64
+	// low is the start of the earliest pane which is still in a window to emit
+	low   int64
+	panes []*pane
+	aggs  []*ast.Call
+	keys  []*ast.FieldRef
+	tiers []*rollupTier
+}
+
+func newPaneWindow(w *WindowConfig) *paneWindow {
+	a, b := w.Length, w.Interval
+	for b != 0 {
+		a, b = b, a%b
+	}
+	pw := &paneWindow{size: a, low: math.MinInt64, aggs: w.PaneAggs, keys: w.PaneKeys}
+	for _, u := range w.Rollup {
+		pw.tiers = append(pw.tiers, &rollupTier{Unit: u})
+	}
+	return pw
+}
+
+// add accumulates the tuple into its pane
+func (w *paneWindow) add(tuple *xsql.Tuple, fv *xsql.FunctionValuer) error {
+	if tuple.Timestamp < w.low {
+		return nil
+	}
+	ve := &xsql.ValuerEval{Valuer: xsql.MultiValuer(tuple, fv)}
+	var b strings.Builder
+	values := make(map[string]interface{}, len(w.keys))
+	for _, k := range w.keys {
+		v := ve.Eval(k)
+		if err, ok := v.(error); ok {
+			return fmt.Errorf("run Group By error: %v", err)
+		}
+		b.WriteString(fmt.Sprintf("%v,", v))
+		values[k.Name] = v
+	}
+	start := w.anchor + (tuple.Timestamp-w.anchor)/w.size*w.size
+	if (tuple.Timestamp-w.anchor)%w.size < 0 {
+		start -= w.size
+	}
+	p := w.pane(start)
+	key := b.String()
+	g, ok := p.group(key)
+	if !ok {
+		g = &paneGroup{Key: key, Emitter: tuple.Emitter, Keys: values, Ts: tuple.Timestamp, Accs: newPaneAccs(w.aggs)}
+		p.Groups = append(p.Groups, g)
+		p.index[key] = g
+	}
+	for i, c := range w.aggs {
+		if _, ok := c.Args[0].(*ast.Wildcard); ok {
+			g.Accs[i].Count++
+			continue
+		}
+		g.Accs[i].add(c.Name, ve.Eval(c.Args[0]))
+	}
+	return nil
+}
+
+// pane returns the pane of the start, the panes are kept in the order of the start
+func (w *paneWindow) pane(start int64) *pane {
+	i := len(w.panes)
+	for i > 0 && w.panes[i-1].Start >= start {
+		if w.panes[i-1].Start == start {
+			return w.panes[i-1]
+		}
+		i--
+	}
+	p := &pane{Start: start, index: make(map[string]*paneGroup)}
+	w.panes = append(w.panes, nil)
+	copy(w.panes[i+1:], w.panes[i:])
+	w.panes[i] = p
+	return p
+}
+
+// collect merges the panes in the window into one pane
+func (w *paneWindow) collect(start, end int64) *pane {
+	merged := &pane{Start: start}
+	for _, p := range w.panes {
+		if p.Start < start || p.Start >= end {
+			continue
+		}
+		for _, g := range p.Groups {
+			merged.merge(g, w.aggs)
+		}
+	}
+	return merged
+}
+
+// tuples converts the merged pane into a row with the results for each group
+func (w *paneWindow) tuples(p *pane) *xsql.WindowTuples {
+	results := &xsql.WindowTuples{
+		Content: make([]xsql.TupleRow, 0, len(p.Groups)),
+	}
+	for _, g := range p.Groups {
+		msg := make(xsql.Message, len(g.Keys)+len(w.aggs))
+		for k, v := range g.Keys {
+			msg[k] = v
+		}
+		for i, c := range w.aggs {
+			msg[c.CachedField] = g.Accs[i].result(c.Name)
+		}
+		results = results.AddTuple(&xsql.Tuple{Emitter: g.Emitter, Message: msg, Timestamp: g.Ts})
+	}
+	return results
+}
+
+// rollup cascades the merged pane of the window ended at end into the tiers, and returns the results of the tiers
+// in the order they are closed
+func (w *paneWindow) rollup(end int64, merged *pane) []*xsql.WindowTuples {
+	return w.feed(0, end, merged, nil)
+}
+
+// feed merges the results of the finer tier ended at end into the tier i, and closes the tier if it ends
+func (w *paneWindow) feed(i int, end int64, p *pane, results []*xsql.WindowTuples) []*xsql.WindowTuples {
+	if i >= len(w.tiers) {
+		return results
+	}
+	t := w.tiers[i]
+	// the finer results are after the tier, such as when restarted after the tier ended in processing time
+	if t.Pane != nil && end > t.End {
+		results = w.close(i, results)
+	}
+	if t.Pane == nil {
+		start, e := alignTier(end-1, t.Unit)
+		t.Pane, t.End = &pane{Start: start}, e
+	}
+	for _, g := range p.Groups {
+		t.Pane.merge(g, w.aggs)
+	}
+	if end >= t.End {
+		results = w.close(i, results)
+	}
+	return results
+}
+
+// close emits the results of the tier i and feeds them into the coarser tier
+func (w *paneWindow) close(i int, results []*xsql.WindowTuples) []*xsql.WindowTuples {
+	t := w.tiers[i]
+	p, end := t.Pane, t.End
+	t.Pane = nil
+	r := w.tuples(p)
+	r.WindowRange = xsql.NewWindowRange(p.Start, end)
+	return w.feed(i+1, end, p, append(results, r))
+}
+
+// alignTier returns the range of the natural time unit which the time is in
+func alignTier(ts int64, unit ast.Token) (int64, int64) {
+	n := time.UnixMilli(ts)
+	var start time.Time
+	switch unit {
+	case ast.DD:
+		start = time.Date(n.Year(), n.Month(), n.Day(), 0, 0, 0, 0, n.Location())
+		return start.UnixMilli(), start.AddDate(0, 0, 1).UnixMilli()
+	case ast.HH:
+		start = time.Date(n.Year(), n.Month(), n.Day(), n.Hour(), 0, 0, 0, n.Location())
+		return start.UnixMilli(), start.Add(time.Hour).UnixMilli()
+	case ast.MI:
+		start = time.Date(n.Year(), n.Month(), n.Day(), n.Hour(), n.Minute(), 0, 0, n.Location())
+		return start.UnixMilli(), start.Add(time.Minute).UnixMilli()
+	case ast.SS:
+		start = time.Date(n.Year(), n.Month(), n.Day(), n.Hour(), n.Minute(), n.Second(), 0, n.Location())
+		return start.UnixMilli(), start.Add(time.Second).UnixMilli()
+	default:
+		return ts, ts + 1
+	}
+}
+
+// expire removes the panes before the time which are not in any window to emit
+func (w *paneWindow) expire(before int64) {
+	w.low = before
+	i := 0
+	for i < len(w.panes) && w.panes[i].Start < before {
+		i++
+	}
+	w.panes = w.panes[i:]
+}
+
+// execPaneWindow runs the hopping window, or the tumbling window with rollup or topn, which aggregates incrementally by
+// panes.
+// In processing time, the windows are emitted by the ticker aligned to the natural time. In event time, the first
+// window end is aligned by the earliest tuple like the event time trigger, and the windows ended before the watermark
+// are emitted. The results of each window are then rolled up into the tiers, which are emitted after the window.
+func (o *WindowOperator) execPaneWindow(ctx api.StreamContext, inputs []*xsql.Tuple) {
+	log := ctx.GetLogger()
+	fv, _ := xsql.NewFunctionValuersForOp(ctx)
+	pw := newPaneWindow(o.window)
+	var next int64
+	if s, err := ctx.GetState(WindowPanesKey); err == nil && s != nil {
+		if st, ok := s.(*paneState); ok {
+			pw.anchor, next, pw.panes = st.Anchor, st.Next, st.Panes
+			if len(st.Tiers) == len(pw.tiers) {
+				pw.tiers = st.Tiers
+			}
+			log.Infof("Restore window panes %d", len(pw.panes))
+		} else {
+			log.Warnf("restore window state `panes` %v error, invalid type", s)
+		}
+	}
+	var (
+		firstTicker *clock.Timer
+		firstC      <-chan time.Time
+		c           <-chan time.Time
+		// anchored is whether the panes are aligned. The tuples before that are kept in the inputs
+		anchored = next > 0
+	)
+	save := func() {
+		_ = ctx.PutState(WindowPanesKey, &paneState{Anchor: pw.anchor, Next: next, Panes: pw.panes, Tiers: pw.tiers})
+	}
+	add := func(tuple *xsql.Tuple) {
+		if err := pw.add(tuple, fv); err != nil {
+			_ = o.Broadcast(err)
+			o.statManager.IncTotalExceptions(err.Error())
+		}
+	}
+	anchor := func(end int64) {
+		pw.anchor = end
+		anchored = true
+		for _, t := range inputs {
+			add(t)
+		}
+		inputs = nil
+		_ = ctx.PutState(WindowInputsKey, inputs)
+	}
+	emit := func(end int64) {
+		// the same window range as the hopping window without panes. The tumbling window is aligned by the panes
+		start := o.triggerTime - o.window.Interval
+		if o.window.Type == ast.TUMBLING_WINDOW || start <= 0 {
+			start = end - o.window.Length
+		}
+		merged := pw.collect(end-o.window.Length, end)
+		results := pw.tuples(merged)
+		results.WindowRange = xsql.NewWindowRange(start, end)
+		log.Debugf("pane window %s triggered at %d for %d groups", o.name, end, results.Len())
+		_ = o.Broadcast(results)
+		o.statManager.IncTotalRecordsOut()
+		for _, r := range pw.rollup(end, merged) {
+			log.Debugf("rollup of pane window %s triggered at %d for %d groups", o.name, end, r.Len())
+			_ = o.Broadcast(r)
+			o.statManager.IncTotalRecordsOut()
+		}
+		o.triggerTime = end
+		pw.expire(end + o.window.Interval - o.window.Length)
+		_ = ctx.PutState(TriggerTimeKey, o.triggerTime)
+	}
+	if !o.isEventTime {
+		var firstTime int64
+		firstTime, firstTicker = getFirstTimer(ctx, o.window.RawInterval, o.window.TimeUnit)
+		firstC = firstTicker.C
+		if !anchored || (firstTime-pw.anchor)%pw.size != 0 {
+			anchor(firstTime)
+		}
+		next = firstTime
+		save()
+	}
+	for {
+		select {
+		case item, opened := <-o.input:
+			if !opened {
+				o.statManager.IncTotalExceptions("input channel closed")
+				break
+			}
+			processed := false
+			if item, processed = o.preprocess(item); processed {
+				break
+			}
+			switch d := item.(type) {
+			case error:
+				_ = o.Broadcast(d)
+				o.statManager.IncTotalExceptions(d.Error())
+			case *xsql.WatermarkTuple:
+				watermarkTs := d.GetTimestamp()
+				if !anchored {
+					earliest := getEarliestEventTs(inputs, 0, watermarkTs)
+					if earliest == math.MaxInt64 {
+						break
+					}
+					next = getAlignedWindowEndTime(time.UnixMilli(earliest), o.window.RawInterval, o.window.TimeUnit).UnixMilli()
+					anchor(next)
+				}
+				o.statManager.ProcessTimeStart()
+				for next <= watermarkTs {
+					emit(next)
+					next += o.window.Interval
+				}
+				o.statManager.ProcessTimeEnd()
+				save()
+			case *xsql.Tuple:
+				log.Debugf("Pane window receive tuple %s", d.Message)
+				o.statManager.IncTotalRecordsIn()
+				o.statManager.ProcessTimeStart()
+				if o.isEventTime && o.triggerTime == 0 {
+					o.triggerTime = d.Timestamp
+				}
+				if anchored {
+					add(d)
+					save()
+				} else {
+					inputs = append(inputs, d)
+					_ = ctx.PutState(WindowInputsKey, inputs)
+				}
+				o.statManager.ProcessTimeEnd()
+				o.statManager.SetBufferLength(int64(len(o.input)))
+			default:
+				e := fmt.Errorf("run Window error: expect xsql.Tuple type but got %[1]T(%[1]v)", d)
+				_ = o.Broadcast(e)
+				o.statManager.IncTotalExceptions(e.Error())
+			}
+		case now := <-firstC:
+			log.Infof("First tick at %v(%d), defined at %d", now, now.UnixMilli(), next)
+			firstTicker.Stop()
+			o.ticker = conf.GetTicker(o.window.Interval)
+			c = o.ticker.C
+			o.statManager.ProcessTimeStart()
+			emit(next)
+			o.statManager.ProcessTimeEnd()
+			save()
+		case now := <-c:
+			next += o.window.Interval
+			log.Debugf("Successive tick at %v(%d), defined at %d", now, now.UnixMilli(), next)
+			o.statManager.ProcessTimeStart()
+			emit(next)
+			o.statManager.ProcessTimeEnd()
+			save()
+		case <-ctx.Done():
+			log.Infoln("Cancelling window....")
+			if o.ticker != nil {
+				o.ticker.Stop()
+			}
+			return
+		}
+	}
+}
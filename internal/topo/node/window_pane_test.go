@@ -0,0 +1,239 @@
+// Copyright 2023 EMQ Technologies Co., Ltd.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package node
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/lf-edge/ekuiper/internal/conf"
+	"github.com/lf-edge/ekuiper/internal/topo/context"
+	"github.com/lf-edge/ekuiper/internal/topo/state"
+	"github.com/lf-edge/ekuiper/internal/xsql"
+	"github.com/lf-edge/ekuiper/pkg/api"
+	"github.com/lf-edge/ekuiper/pkg/ast"
+)
+
+func TestPaneAcc(t *testing.T) {
+	acc := func(name string, values ...interface{}) *paneAcc {
+		a := &paneAcc{}
+		for _, v := range values {
+			a.add(name, v)
+		}
+		return a
+	}
+	require.Equal(t, int64(6), acc("sum", 1, nil, int64(2), 3.5).result("sum"))
+	require.Equal(t, 2.5, acc("avg", 2.0, 3.0).result("avg"))
+	require.Equal(t, int64(2), acc("avg", 2, 3).result("avg"))
+	require.Equal(t, 3, acc("count", "a", nil, 1, map[string]interface{}{}).result("count"))
+	require.Equal(t, "a", acc("min", "b", "a", "c").result("min"))
+	require.Equal(t, nil, acc("max", nil).result("max"))
+	require.Equal(t, errors.New("run sum function error: found invalid arg string(a)"), acc("sum", "a").result("sum"))
+	// merge the panes
+	m := acc("max", 1, 5)
+	m.merge("max", acc("max", 7.9))
+	m.merge("max", acc("max"))
+	require.Equal(t, int64(7), m.result("max"))
+	m = acc("avg", 1.0)
+	m.merge("avg", acc("avg", 2))
+	require.Equal(t, errors.New("run avg function error: requires float64 but found int"), m.result("avg"))
+	// topn keeps only n values and the earlier one of the equal values
+	top := func(values ...interface{}) *paneAcc {
+		a := &paneAcc{N: 3}
+		for _, v := range values {
+			a.add("topn", v)
+		}
+		return a
+	}
+	m = top(3, nil, 5.5, int64(1), 3.0)
+	require.Len(t, m.Top, 3)
+	m.merge("topn", top(4, 1, 3))
+	m.merge("topn", top())
+	require.Equal(t, []interface{}{5.5, 4, 3}, m.result("topn"))
+	m = top("b", "a", "c", "d")
+	require.Equal(t, []interface{}{"d", "c", "b"}, m.result("topn"))
+	m.merge("topn", top(1))
+	require.Equal(t, errors.New("run topn function error: requires the values of the same type but found d and 1"), m.result("topn"))
+	require.Equal(t, errors.New("run topn function error: found invalid arg bool(true)"), top(1, true).result("topn"))
+	accs := newPaneAccs([]*ast.Call{{Name: "topn", Args: []ast.Expr{&ast.FieldRef{Name: "v"}, &ast.IntegerLiteral{Val: 2}}}, {Name: "sum"}})
+	require.Equal(t, []*paneAcc{{N: 2}, {}}, accs)
+}
+
+func TestPaneWindow(t *testing.T) {
+	contextLogger := conf.Log.WithField("rule", "TestPaneWindow")
+	ctx := context.WithValue(context.Background(), context.LoggerKey, contextLogger)
+	tempStore, _ := state.CreateStore("TestPaneWindow", api.AtMostOnce)
+	nctx, cancel := ctx.WithMeta("TestPaneWindow", "test", tempStore).WithCancel()
+	defer cancel()
+	o, err := NewWindowOp("test", WindowConfig{
+		Type: ast.HOPPING_WINDOW, Length: 3000, Interval: 1000, RawInterval: 1, TimeUnit: ast.SS,
+		PaneAggs: []*ast.Call{
+			{Name: "count", FuncType: ast.FuncTypeAgg, Args: []ast.Expr{&ast.Wildcard{Token: ast.ASTERISK}}, CachedField: "c", Cached: true},
+			{Name: "sum", FuncType: ast.FuncTypeAgg, Args: []ast.Expr{&ast.FieldRef{Name: "v", StreamName: ast.DefaultStream}}, CachedField: "s", Cached: true},
+		},
+		PaneKeys: []*ast.FieldRef{{Name: "k", StreamName: ast.DefaultStream}},
+	}, &api.RuleOption{IsEventTime: true})
+	require.NoError(t, err)
+	errCh := make(chan error)
+	outputCh := make(chan interface{}, 10)
+	o.outputs["mock"] = outputCh
+	o.Exec(nctx, errCh)
+
+	tuple := func(ts int64, k string, v int) *xsql.Tuple {
+		return &xsql.Tuple{Emitter: "demo", Message: map[string]interface{}{"k": k, "v": v}, Timestamp: ts}
+	}
+	receive := func() *xsql.WindowTuples {
+		select {
+		case err := <-errCh:
+			t.Fatal(err)
+		case v := <-outputCh:
+			return v.(*xsql.WindowTuples)
+		case <-time.After(5 * time.Second):
+			t.Fatal("receive message timeout")
+		}
+		return nil
+	}
+	row := func(r *xsql.WindowTuples, i int) xsql.Message {
+		return r.Content[i].(*xsql.Tuple).Message
+	}
+	o.input <- tuple(100, "a", 1)
+	o.input <- tuple(1100, "a", 2)
+	o.input <- &xsql.WatermarkTuple{Timestamp: 1000}
+	r := receive()
+	require.Equal(t, xsql.NewWindowRange(-2000, 1000), r.WindowRange)
+	require.Equal(t, 1, r.Len())
+	require.Equal(t, xsql.Message{"k": "a", "c": 1, "s": int64(1)}, row(r, 0))
+
+	o.input <- tuple(1500, "b", 3)
+	o.input <- tuple(2500, "a", 4)
+	o.input <- &xsql.WatermarkTuple{Timestamp: 3000}
+	r = receive()
+	require.Equal(t, xsql.NewWindowRange(-1000, 2000), r.WindowRange)
+	require.Equal(t, 2, r.Len())
+	require.Equal(t, xsql.Message{"k": "a", "c": 2, "s": int64(3)}, row(r, 0))
+	require.Equal(t, xsql.Message{"k": "b", "c": 1, "s": int64(3)}, row(r, 1))
+	r = receive()
+	require.Equal(t, xsql.NewWindowRange(1000, 3000), r.WindowRange)
+	require.Equal(t, xsql.Message{"k": "a", "c": 3, "s": int64(7)}, row(r, 0))
+	require.Equal(t, xsql.Message{"k": "b", "c": 1, "s": int64(3)}, row(r, 1))
+	require.Len(t, outputCh, 0)
+}
+
+func TestPaneRollup(t *testing.T) {
+	aggs := []*ast.Call{{Name: "sum", FuncType: ast.FuncTypeAgg, Args: []ast.Expr{&ast.FieldRef{Name: "v", StreamName: ast.DefaultStream}}, CachedField: "s", Cached: true}}
+	pw := newPaneWindow(&WindowConfig{Type: ast.TUMBLING_WINDOW, Length: 500, Interval: 500, PaneAggs: aggs, Rollup: []ast.Token{ast.SS, ast.MI}})
+	window := func(end int64) *pane {
+		p := &pane{Start: end - 500}
+		p.merge(&paneGroup{Key: "a,", Emitter: "demo", Keys: map[string]interface{}{"k": "a"}, Accs: []*paneAcc{{Count: 1, Kind: paneInt, Int: 1}}}, aggs)
+		return p
+	}
+	check := func(r *xsql.WindowTuples, start, end int64, sum int64) {
+		require.Equal(t, xsql.NewWindowRange(start, end), r.WindowRange)
+		require.Equal(t, xsql.Message{"k": "a", "s": sum}, r.Content[0].(*xsql.Tuple).Message)
+	}
+	for end := int64(500); end < 60000; end += 500 {
+		rs := pw.rollup(end, window(end))
+		if end%1000 == 0 {
+			require.Len(t, rs, 1)
+			check(rs[0], end-1000, end, 2)
+		} else {
+			require.Empty(t, rs)
+		}
+	}
+	// the minute tier is merged from the second tier
+	rs := pw.rollup(60000, window(60000))
+	require.Len(t, rs, 2)
+	check(rs[0], 59000, 60000, 2)
+	check(rs[1], 0, 60000, 120)
+
+	require.Empty(t, pw.rollup(60500, window(60500)))
+	// the tiers ended before the window are closed without it
+	rs = pw.rollup(125000, window(125000))
+	require.Len(t, rs, 3)
+	check(rs[0], 60000, 61000, 1)
+	check(rs[1], 124000, 125000, 1)
+	check(rs[2], 60000, 120000, 1)
+	require.Equal(t, int64(180000), pw.tiers[1].End)
+	require.Equal(t, int64(120000), pw.tiers[1].Pane.Start)
+}
+
+func TestPaneRollupWindow(t *testing.T) {
+	contextLogger := conf.Log.WithField("rule", "TestPaneRollupWindow")
+	ctx := context.WithValue(context.Background(), context.LoggerKey, contextLogger)
+	tempStore, _ := state.CreateStore("TestPaneRollupWindow", api.AtMostOnce)
+	nctx, cancel := ctx.WithMeta("TestPaneRollupWindow", "test", tempStore).WithCancel()
+	defer cancel()
+	o, err := NewWindowOp("test", WindowConfig{
+		Type: ast.TUMBLING_WINDOW, Length: 500, RawInterval: 500, TimeUnit: ast.MS,
+		PaneAggs: []*ast.Call{
+			{Name: "count", FuncType: ast.FuncTypeAgg, Args: []ast.Expr{&ast.Wildcard{Token: ast.ASTERISK}}, CachedField: "c", Cached: true},
+			{Name: "sum", FuncType: ast.FuncTypeAgg, Args: []ast.Expr{&ast.FieldRef{Name: "v", StreamName: ast.DefaultStream}}, CachedField: "s", Cached: true},
+		},
+		PaneKeys: []*ast.FieldRef{{Name: "k", StreamName: ast.DefaultStream}},
+		Rollup:   []ast.Token{ast.SS},
+	}, &api.RuleOption{IsEventTime: true})
+	require.NoError(t, err)
+	errCh := make(chan error)
+	outputCh := make(chan interface{}, 10)
+	o.outputs["mock"] = outputCh
+	o.Exec(nctx, errCh)
+
+	tuple := func(ts int64, k string, v int) *xsql.Tuple {
+		return &xsql.Tuple{Emitter: "demo", Message: map[string]interface{}{"k": k, "v": v}, Timestamp: ts}
+	}
+	receive := func() *xsql.WindowTuples {
+		select {
+		case err := <-errCh:
+			t.Fatal(err)
+		case v := <-outputCh:
+			return v.(*xsql.WindowTuples)
+		case <-time.After(5 * time.Second):
+			t.Fatal("receive message timeout")
+		}
+		return nil
+	}
+	row := func(r *xsql.WindowTuples, i int) xsql.Message {
+		return r.Content[i].(*xsql.Tuple).Message
+	}
+	o.input <- tuple(100, "a", 1)
+	o.input <- tuple(600, "a", 2)
+	o.input <- tuple(700, "b", 3)
+	o.input <- &xsql.WatermarkTuple{Timestamp: 1000}
+	r := receive()
+	require.Equal(t, xsql.NewWindowRange(0, 500), r.WindowRange)
+	require.Equal(t, 1, r.Len())
+	require.Equal(t, xsql.Message{"k": "a", "c": 1, "s": int64(1)}, row(r, 0))
+	r = receive()
+	require.Equal(t, xsql.NewWindowRange(500, 1000), r.WindowRange)
+	require.Equal(t, 2, r.Len())
+	require.Equal(t, xsql.Message{"k": "a", "c": 1, "s": int64(2)}, row(r, 0))
+	require.Equal(t, xsql.Message{"k": "b", "c": 1, "s": int64(3)}, row(r, 1))
+	// the second tier is emitted after the window which ends it
+	r = receive()
+	require.Equal(t, xsql.NewWindowRange(0, 1000), r.WindowRange)
+	require.Equal(t, 2, r.Len())
+	require.Equal(t, xsql.Message{"k": "a", "c": 2, "s": int64(3)}, row(r, 0))
+	require.Equal(t, xsql.Message{"k": "b", "c": 1, "s": int64(3)}, row(r, 1))
+
+	o.input <- tuple(1200, "a", 4)
+	o.input <- &xsql.WatermarkTuple{Timestamp: 1500}
+	r = receive()
+	require.Equal(t, xsql.NewWindowRange(1000, 1500), r.WindowRange)
+	require.Equal(t, xsql.Message{"k": "a", "c": 1, "s": int64(4)}, row(r, 0))
+	require.Len(t, outputCh, 0)
+}
@@ -0,0 +1,263 @@
+// Copyright 2023 EMQ Technologies Co., Ltd.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package node
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/benbjohnson/clock"
+
+	"github.com/lf-edge/ekuiper/internal/conf"
+	"github.com/lf-edge/ekuiper/internal/xsql"
+	"github.com/lf-edge/ekuiper/pkg/api"
+)
+
+// keyedSession is the open session of a partition key
+type keyedSession struct {
+	key    string
+	start  int64
+	last   int64
+	tuples []*xsql.Tuple
+}
+
+// sessionWindows groups the tuples into a session for each partition key. A session starts from the first tuple of
+// the key, and closes when no tuple of the key arrives within the gap, or when it lasts for the max duration. Unlike
+// the session window without partition, the max duration is counted from the start of each session instead of being
+// aligned to the natural time, because the sessions of the keys start at different times.
+type sessionWindows struct {
+	gap         int64
+	maxDuration int64
+	sessions    map[string]*keyedSession
+}
+
+func newSessionWindows(gap int64, maxDuration int64) *sessionWindows {
+	return &sessionWindows{gap: gap, maxDuration: maxDuration, sessions: make(map[string]*keyedSession)}
+}
+
+// end returns the time when the session closes if no more tuple of the key arrives
+func (s *sessionWindows) end(ks *keyedSession) int64 {
+	e := ks.last + s.gap
+	if s.maxDuration > 0 && ks.start+s.maxDuration < e {
+		e = ks.start + s.maxDuration
+	}
+	return e
+}
+
+// add adds the tuple to the session of its key. If the tuple is beyond the end of the current session, it starts a new
+// session and the current session is closed and returned.
+func (s *sessionWindows) add(key string, tuple *xsql.Tuple) *keyedSession {
+	ks, ok := s.sessions[key]
+	if ok && tuple.Timestamp < s.end(ks) {
+		ks.tuples = append(ks.tuples, tuple)
+		if tuple.Timestamp > ks.last {
+			ks.last = tuple.Timestamp
+		}
+		return nil
+	}
+	s.sessions[key] = &keyedSession{key: key, start: tuple.Timestamp, last: tuple.Timestamp, tuples: []*xsql.Tuple{tuple}}
+	return ks
+}
+
+// expire removes and returns the sessions ended at or before the time, in the order of the end time
+func (s *sessionWindows) expire(now int64) []*keyedSession {
+	var result []*keyedSession
+	for k, ks := range s.sessions {
+		if s.end(ks) <= now {
+			result = append(result, ks)
+			delete(s.sessions, k)
+		}
+	}
+	sort.Slice(result, func(i, j int) bool {
+		ei, ej := s.end(result[i]), s.end(result[j])
+		if ei != ej {
+			return ei < ej
+		}
+		return result[i].key < result[j].key
+	})
+	return result
+}
+
+// next returns the earliest end time of the sessions, math.MaxInt64 if no session
+func (s *sessionWindows) next() int64 {
+	var n int64 = math.MaxInt64
+	for _, ks := range s.sessions {
+		if e := s.end(ks); e < n {
+			n = e
+		}
+	}
+	return n
+}
+
+// inputs returns the tuples of all the open sessions to save in the state
+func (s *sessionWindows) inputs() []*xsql.Tuple {
+	var result []*xsql.Tuple
+	for _, ks := range s.sessions {
+		result = append(result, ks.tuples...)
+	}
+	sort.SliceStable(result, func(i, j int) bool {
+		return result[i].Timestamp < result[j].Timestamp
+	})
+	return result
+}
+
+// partitionKey evaluates the partition expressions against the tuple
+func (o *WindowOperator) partitionKey(ctx api.StreamContext, tuple *xsql.Tuple) (string, error) {
+	fv, _ := xsql.NewFunctionValuersForOp(ctx)
+	ve := &xsql.ValuerEval{Valuer: xsql.MultiValuer(tuple, fv)}
+	var b strings.Builder
+	for i, e := range o.window.Partition.Exprs {
+		v := ve.Eval(e)
+		if err, ok := v.(error); ok {
+			return "", fmt.Errorf("evaluate partition key %s error: %v", e, err)
+		}
+		if i > 0 {
+			b.WriteByte(',')
+		}
+		b.WriteString(fmt.Sprintf("%v", v))
+	}
+	return b.String(), nil
+}
+
+// emitSession sends the tuples of a closed session as a window
+func (o *WindowOperator) emitSession(ctx api.StreamContext, sw *sessionWindows, ks *keyedSession) {
+	results := &xsql.WindowTuples{
+		Content: make([]xsql.TupleRow, 0, len(ks.tuples)),
+	}
+	for _, t := range ks.tuples {
+		results = results.AddTuple(t)
+	}
+	results.WindowRange = xsql.NewWindowRange(ks.start, sw.end(ks))
+	ctx.GetLogger().Debugf("session window %s of key %s triggered for %d tuples", o.name, ks.key, len(ks.tuples))
+	_ = o.Broadcast(results)
+	o.statManager.IncTotalRecordsOut()
+}
+
+// execPartitionedSessionWindow runs the session window partitioned by key. In processing time, a timer fires at the
+// earliest end of the sessions. In event time, the sessions ended before the watermark are emitted.
+func (o *WindowOperator) execPartitionedSessionWindow(ctx api.StreamContext, inputs []*xsql.Tuple) {
+	log := ctx.GetLogger()
+	sw := newSessionWindows(o.window.Interval, o.window.Length)
+	var (
+		timer *clock.Timer
+		c     <-chan time.Time
+		// scheduled is the time the timer fires at
+		scheduled int64 = math.MaxInt64
+	)
+	schedule := func(next int64) {
+		if o.isEventTime || next >= scheduled {
+			return
+		}
+		scheduled = next
+		d := next - conf.GetNowInMilli()
+		if d < 0 {
+			d = 0
+		}
+		if timer == nil {
+			timer = conf.GetTimer(d)
+			c = timer.C
+		} else {
+			timer.Stop()
+			timer.Reset(time.Duration(d) * time.Millisecond)
+		}
+	}
+	// add returns whether the tuple is added and whether a session is closed
+	add := func(tuple *xsql.Tuple) (bool, bool) {
+		key, err := o.partitionKey(ctx, tuple)
+		if err != nil {
+			_ = o.Broadcast(err)
+			o.statManager.IncTotalExceptions(err.Error())
+			return false, false
+		}
+		closed := sw.add(key, tuple)
+		if closed != nil {
+			o.emitSession(ctx, sw, closed)
+		}
+		schedule(sw.end(sw.sessions[key]))
+		return true, closed != nil
+	}
+	// the inputs in the state are the tuples of the open sessions, which are only rebuilt when a session closes
+	expire := func(now int64) {
+		closed := sw.expire(now)
+		for _, ks := range closed {
+			o.emitSession(ctx, sw, ks)
+		}
+		if len(closed) > 0 {
+			inputs = sw.inputs()
+			_ = ctx.PutState(WindowInputsKey, inputs)
+		}
+	}
+	// restore the sessions
+	for _, tuple := range inputs {
+		add(tuple)
+	}
+	inputs = sw.inputs()
+	_ = ctx.PutState(WindowInputsKey, inputs)
+	for {
+		select {
+		case item, opened := <-o.input:
+			if !opened {
+				o.statManager.IncTotalExceptions("input channel closed")
+				break
+			}
+			processed := false
+			if item, processed = o.preprocess(item); processed {
+				break
+			}
+			switch d := item.(type) {
+			case error:
+				_ = o.Broadcast(d)
+				o.statManager.IncTotalExceptions(d.Error())
+			case *xsql.WatermarkTuple:
+				o.statManager.ProcessTimeStart()
+				expire(d.GetTimestamp())
+				o.statManager.ProcessTimeEnd()
+			case *xsql.Tuple:
+				log.Debugf("Session window receive tuple %s", d.Message)
+				o.statManager.IncTotalRecordsIn()
+				o.statManager.ProcessTimeStart()
+				added, closed := add(d)
+				if closed {
+					inputs = sw.inputs()
+				} else if added {
+					inputs = append(inputs, d)
+				}
+				o.statManager.ProcessTimeEnd()
+				o.statManager.SetBufferLength(int64(len(o.input)))
+				_ = ctx.PutState(WindowInputsKey, inputs)
+			default:
+				e := fmt.Errorf("run Window error: expect xsql.Tuple type but got %[1]T(%[1]v)", d)
+				_ = o.Broadcast(e)
+				o.statManager.IncTotalExceptions(e.Error())
+			}
+		case now := <-c:
+			log.Debugf("Session window timer fires at %d", now.UnixMilli())
+			scheduled = math.MaxInt64
+			o.statManager.ProcessTimeStart()
+			expire(now.UnixMilli())
+			o.statManager.ProcessTimeEnd()
+			schedule(sw.next())
+		case <-ctx.Done():
+			log.Infoln("Cancelling window....")
+			if timer != nil {
+				timer.Stop()
+			}
+			return
+		}
+	}
+}
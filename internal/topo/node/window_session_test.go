@@ -0,0 +1,58 @@
+// Copyright 2023 EMQ Technologies Co., Ltd.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package node
+
+import (
+	"math"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/lf-edge/ekuiper/internal/xsql"
+)
+
+func TestSessionWindows(t *testing.T) {
+	sw := newSessionWindows(100, 1000)
+	tuple := func(ts int64) *xsql.Tuple {
+		return &xsql.Tuple{Emitter: "demo", Timestamp: ts}
+	}
+	require.Equal(t, int64(math.MaxInt64), sw.next())
+	require.Nil(t, sw.add("a", tuple(0)))
+	require.Nil(t, sw.add("b", tuple(50)))
+	require.Nil(t, sw.add("a", tuple(90)))
+	require.Equal(t, int64(150), sw.next())
+	require.Len(t, sw.inputs(), 3)
+	// the session of b times out, a is extended
+	closed := sw.expire(180)
+	require.Len(t, closed, 1)
+	require.Equal(t, "b", closed[0].key)
+	require.Equal(t, int64(190), sw.next())
+	// the tuple after the gap starts a new session
+	closed = []*keyedSession{sw.add("a", tuple(200))}
+	require.Equal(t, int64(0), closed[0].start)
+	require.Len(t, closed[0].tuples, 2)
+	require.Equal(t, int64(190), sw.end(closed[0]))
+	// the session is capped by the max duration
+	for ts := int64(280); ts < 1300; ts += 80 {
+		if ks := sw.add("a", tuple(ts)); ks != nil {
+			require.Equal(t, int64(200), ks.start)
+			require.Equal(t, int64(1200), sw.end(ks))
+			require.Equal(t, int64(1240), ts)
+		}
+	}
+	require.Equal(t, int64(1240), sw.sessions["a"].start)
+	require.Len(t, sw.expire(1340), 1)
+	require.Empty(t, sw.sessions)
+}
@@ -24,17 +24,19 @@ import (
 
 type AggregateOp struct {
 	Dimensions ast.Dimensions
+	// Pivot turns the rows of each group into the columns of the group
+	Pivot *ast.Pivot
 }
 
 // Apply
 /*  input: Collection
  *  output: Collection
  */
-func (p *AggregateOp) Apply(ctx api.StreamContext, data interface{}, fv *xsql.FunctionValuer, _ *xsql.AggregateFunctionValuer) interface{} {
+func (p *AggregateOp) Apply(ctx api.StreamContext, data interface{}, fv *xsql.FunctionValuer, afv *xsql.AggregateFunctionValuer) interface{} {
 	log := ctx.GetLogger()
 	log.Debugf("aggregate plan receive %v", data)
 	grouped := data
-	if p.Dimensions != nil {
+	if p.Dimensions != nil || p.Pivot != nil {
 		switch input := data.(type) {
 		case error:
 			return input
@@ -66,9 +68,14 @@ func (p *AggregateOp) Apply(ctx api.StreamContext, data interface{}, fv *xsql.Fu
 			if len(result) > 0 {
 				g := make([]*xsql.GroupedTuples, 0, len(result))
 				for _, v := range result {
+					if p.Pivot != nil {
+						if err := p.pivot(v, fv, afv); err != nil {
+							return err
+						}
+					}
 					g = append(g, v)
 				}
-				grouped = &xsql.GroupedTuplesSet{Groups: g}
+				grouped = &xsql.GroupedTuplesSet{Groups: g, WindowRange: wr}
 			} else {
 				grouped = nil
 			}
@@ -79,3 +86,47 @@ func (p *AggregateOp) Apply(ctx api.StreamContext, data interface{}, fv *xsql.Fu
 	}
 	return grouped
 }
+
+// pivot sets the aggregate of the rows matching each value as the column of the group. The column of the value
+// without any matching row is null
+func (p *AggregateOp) pivot(g *xsql.GroupedTuples, fv *xsql.FunctionValuer, afv *xsql.AggregateFunctionValuer) error {
+	first, ok := g.Content[0].(*xsql.Tuple)
+	if !ok {
+		return fmt.Errorf("run PIVOT error: only single stream is supported but got %T", g.Content[0])
+	}
+	matched := make([][]xsql.TupleRow, len(p.Pivot.Values))
+	for _, r := range g.Content {
+		ve := &xsql.ValuerEval{Valuer: xsql.MultiValuer(r, &xsql.WindowRangeValuer{WindowRange: g.WindowRange}, fv)}
+		for i, v := range p.Pivot.Values {
+			switch m := ve.Eval(&ast.BinaryExpr{OP: ast.EQ, LHS: p.Pivot.For, RHS: v}).(type) {
+			case error:
+				return fmt.Errorf("run PIVOT error: %v", m)
+			case bool:
+				if m {
+					matched[i] = append(matched[i], r)
+				}
+			}
+		}
+	}
+	msg := make(xsql.Message, len(first.Message)+len(p.Pivot.Names))
+	for k, v := range first.Message {
+		msg[k] = v
+	}
+	for i, name := range p.Pivot.Names {
+		if len(matched[i]) == 0 {
+			msg[name] = nil
+			continue
+		}
+		rows := &xsql.GroupedTuples{Content: matched[i], WindowRange: g.WindowRange}
+		afv.SetData(rows)
+		ve := &xsql.ValuerEval{Valuer: xsql.MultiAggregateValuer(rows, fv, rows, fv, afv, &xsql.WildcardValuer{Data: rows})}
+		v := ve.Eval(p.Pivot.Agg)
+		if err, ok := v.(error); ok {
+			return fmt.Errorf("run PIVOT error: %v", err)
+		}
+		msg[name] = v
+	}
+	// the pivot columns are read from the first row of the group like the dimensions
+	g.Content[0] = &xsql.Tuple{Emitter: first.Emitter, Message: msg, Metadata: first.Metadata, Timestamp: first.Timestamp}
+	return nil
+}
@@ -21,6 +21,8 @@ import (
 	"strings"
 	"testing"
 
+	"github.com/stretchr/testify/require"
+
 	"github.com/lf-edge/ekuiper/internal/conf"
 	"github.com/lf-edge/ekuiper/internal/topo/context"
 	"github.com/lf-edge/ekuiper/internal/xsql"
@@ -501,3 +503,34 @@ func TestAggregatePlanError(t *testing.T) {
 		}
 	}
 }
+
+func TestAggregatePivot(t *testing.T) {
+	stmt, err := xsql.NewParser(strings.NewReader("SELECT ts, temp, hum, pressure FROM demo PIVOT (max(value) FOR metric IN ('temp', 'hum', 'pressure')) GROUP BY ts, TUMBLINGWINDOW(ss, 10)")).Parse()
+	require.NoError(t, err)
+	contextLogger := conf.Log.WithField("rule", "TestAggregatePivot")
+	ctx := context.WithValue(context.Background(), context.LoggerKey, contextLogger)
+	fv, afv := xsql.NewFunctionValuersForOp(ctx)
+	pp := &AggregateOp{Dimensions: stmt.Dimensions.GetGroups(), Pivot: stmt.Pivot}
+	wr := xsql.NewWindowRange(1541152486013, 1541152487013)
+	rows := []xsql.TupleRow{
+		&xsql.Tuple{Emitter: "demo", Message: xsql.Message{"ts": 1, "metric": "temp", "value": 20}},
+		&xsql.Tuple{Emitter: "demo", Message: xsql.Message{"ts": 1, "metric": "hum", "value": 60}},
+		&xsql.Tuple{Emitter: "demo", Message: xsql.Message{"ts": 1, "metric": "temp", "value": 22}},
+	}
+	result := pp.Apply(ctx, &xsql.WindowTuples{Content: append([]xsql.TupleRow{}, rows...), WindowRange: wr}, fv, afv)
+	require.Equal(t, &xsql.GroupedTuplesSet{
+		Groups: []*xsql.GroupedTuples{
+			{
+				Content: []xsql.TupleRow{
+					&xsql.Tuple{Emitter: "demo", Message: xsql.Message{"ts": 1, "metric": "temp", "value": 20, "temp": int64(22), "hum": int64(60), "pressure": nil}},
+					rows[1], rows[2],
+				},
+				WindowRange: wr,
+			},
+		},
+		WindowRange: wr,
+	}, result)
+
+	result = pp.Apply(ctx, &xsql.JoinTuples{Content: []*xsql.JoinTuple{{Tuples: rows}}}, fv, afv)
+	require.EqualError(t, result.(error), "run PIVOT error: only single stream is supported but got *xsql.JoinTuple")
+}
@@ -15,22 +15,174 @@
 package operator
 
 import (
+	"encoding/gob"
 	"fmt"
+	"sort"
+	"strings"
+	"time"
 
 	"github.com/lf-edge/ekuiper/internal/xsql"
 	"github.com/lf-edge/ekuiper/pkg/api"
 	"github.com/lf-edge/ekuiper/pkg/ast"
+	"github.com/lf-edge/ekuiper/pkg/cast"
 )
 
+const analyticFramesKey = "$$analyticFrames"
+
+func init() {
+	gob.Register(&analyticFrames{})
+}
+
 type AnalyticFuncsOp struct {
 	Funcs      []*ast.Call
 	FieldFuncs []*ast.Call
 }
 
-func (p *AnalyticFuncsOp) evalTupleFunc(calls []*ast.Call, ve *xsql.ValuerEval, input xsql.TupleRow) (xsql.TupleRow, error) {
+// analyticFrames are the states of the aggregate functions over ROWS frame, keyed by the cached field and the
+// partition key. They are saved in the rule state so that the frames are restored after a restart. The frames of the
+// partitions are never evicted because an unbounded frame needs all the rows since the rule starts.
+type analyticFrames struct {
+	Frames map[string]map[string]*frameState
+}
+
+// frameState is the incremental state of an aggregate function over the frame of a partition
+type frameState struct {
+	// Values are the argument values of the rows in a bounded frame
+	Values []interface{}
+	// Acc is the result of an unbounded frame. For avg, it is the sum of the values
+	Acc    interface{}
+	Count  int64
+	Result interface{}
+}
+
+// HasFrame returns whether any of the functions is an aggregate function over ROWS frame, which keeps the state
+func (p *AnalyticFuncsOp) HasFrame() bool {
+	for _, calls := range [][]*ast.Call{p.FieldFuncs, p.Funcs} {
+		for _, call := range calls {
+			if call.Frame != nil {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func (p *AnalyticFuncsOp) eval(call *ast.Call, ve *xsql.ValuerEval, fv *xsql.FunctionValuer, frames *analyticFrames) interface{} {
+	if call.Frame != nil {
+		return p.evalFrame(call, ve, fv, frames)
+	}
+	return ve.Eval(call)
+}
+
+// evalFrame adds the current row into the frame of its partition and calculates the aggregate function over the frame
+func (p *AnalyticFuncsOp) evalFrame(call *ast.Call, ve *xsql.ValuerEval, fv *xsql.FunctionValuer, frames *analyticFrames) interface{} {
+	pk := "self"
+	if call.Partition != nil && len(call.Partition.Exprs) > 0 {
+		pk = ""
+		for _, pe := range call.Partition.Exprs {
+			temp := ve.Eval(pe)
+			if _, ok := temp.(error); ok {
+				return temp
+			}
+			pk += fmt.Sprintf("%v", temp)
+		}
+	}
+	states, ok := frames.Frames[call.CachedField]
+	if !ok {
+		states = make(map[string]*frameState)
+		frames.Frames[call.CachedField] = states
+	}
+	fs, ok := states[pk]
+	if !ok {
+		fs = &frameState{}
+		if call.Name == "count" {
+			fs.Result = 0
+		}
+		states[pk] = fs
+	}
+	if call.WhenExpr != nil {
+		if b, ok := ve.Eval(call.WhenExpr).(bool); ok && !b {
+			return fs.Result
+		}
+	}
+	v := ve.Eval(call.Args[0])
+	if _, ok := v.(error); ok {
+		return v
+	}
+	var r interface{}
+	if call.Frame.Preceding >= 0 {
+		fs.Values = append(fs.Values, v)
+		if len(fs.Values) > call.Frame.Preceding+1 {
+			fs.Values = fs.Values[1:]
+		}
+		vals := make([]interface{}, len(fs.Values))
+		copy(vals, fs.Values)
+		r, _ = fv.Call(call.Name, call.FuncId, []interface{}{vals})
+	} else {
+		r = fs.accumulate(call, fv, v)
+	}
+	if _, ok := r.(error); ok {
+		return r
+	}
+	fs.Result = r
+	return r
+}
+
+// accumulate calculates the unbounded frame without keeping the rows
+func (fs *frameState) accumulate(call *ast.Call, fv *xsql.FunctionValuer, v interface{}) interface{} {
+	if v == nil {
+		return fs.Result
+	}
+	fs.Count++
+	switch call.Name {
+	case "count":
+		return int(fs.Count)
+	case "avg":
+		switch vt := v.(type) {
+		case int, int64:
+			var sum int64
+			if fs.Acc != nil {
+				s, ok := fs.Acc.(int64)
+				if !ok {
+					return fmt.Errorf("run avg function error: found invalid arg %[1]T(%[1]v)", v)
+				}
+				sum = s
+			}
+			vi, _ := cast.ToInt64(vt, cast.CONVERT_SAMEKIND)
+			fs.Acc = sum + vi
+			return fs.Acc.(int64) / fs.Count
+		case float64:
+			var sum float64
+			if fs.Acc != nil {
+				s, ok := fs.Acc.(float64)
+				if !ok {
+					return fmt.Errorf("run avg function error: found invalid arg %[1]T(%[1]v)", v)
+				}
+				sum = s
+			}
+			fs.Acc = sum + vt
+			return fs.Acc.(float64) / float64(fs.Count)
+		default:
+			return fmt.Errorf("run avg function error: found invalid arg %[1]T(%[1]v)", v)
+		}
+	default:
+		// sum, min and max of the accumulated result and the new value are the result of the whole frame
+		vals := []interface{}{v}
+		if fs.Acc != nil {
+			vals = append(vals, fs.Acc)
+		}
+		r, _ := fv.Call(call.Name, call.FuncId, []interface{}{vals})
+		if _, ok := r.(error); !ok {
+			fs.Acc = r
+		}
+		return r
+	}
+}
+
+func (p *AnalyticFuncsOp) evalTupleFunc(calls []*ast.Call, ve *xsql.ValuerEval, fv *xsql.FunctionValuer, input xsql.TupleRow, frames *analyticFrames) (xsql.TupleRow, error) {
 	for _, call := range calls {
 		f := call
-		result := ve.Eval(f)
+		result := p.eval(f, ve, fv, frames)
 		if e, ok := result.(error); ok {
 			return nil, e
 		}
@@ -39,48 +191,143 @@ func (p *AnalyticFuncsOp) evalTupleFunc(calls []*ast.Call, ve *xsql.ValuerEval,
 	return input, nil
 }
 
-func (p *AnalyticFuncsOp) evalCollectionFunc(calls []*ast.Call, fv *xsql.FunctionValuer, input xsql.SingleCollection) (xsql.SingleCollection, error) {
+func (p *AnalyticFuncsOp) evalCollectionFunc(calls []*ast.Call, fv *xsql.FunctionValuer, input xsql.SingleCollection, frames *analyticFrames) (xsql.SingleCollection, error) {
+	var (
+		rows   []xsql.Row
+		orders []*ast.Call
+	)
+	for _, call := range calls {
+		if len(call.OrderBy) > 0 {
+			orders = append(orders, call)
+		}
+	}
 	err := input.RangeSet(func(_ int, row xsql.Row) (bool, error) {
 		ve := &xsql.ValuerEval{Valuer: xsql.MultiValuer(row, &xsql.WindowRangeValuer{WindowRange: input.GetWindowRange()}, fv, &xsql.WildcardValuer{Data: row})}
 		for _, call := range calls {
 			f := call
-			result := ve.Eval(f)
+			// the frame with ORDER BY is calculated after all rows are collected
+			if len(f.OrderBy) > 0 {
+				continue
+			}
+			result := p.eval(f, ve, fv, frames)
 			if e, ok := result.(error); ok {
 				return false, e
 			}
 			row.Set(f.CachedField, result)
 		}
+		rows = append(rows, row)
 		return true, nil
 	})
 	if err != nil {
 		return nil, err
 	}
+	for _, call := range orders {
+		if err := p.evalOrderedFrame(call, fv, input, rows, frames); err != nil {
+			return nil, err
+		}
+	}
 	return input, nil
 }
 
+// evalOrderedFrame calculates the frame of the rows in the order of the ORDER BY clause
+func (p *AnalyticFuncsOp) evalOrderedFrame(call *ast.Call, fv *xsql.FunctionValuer, input xsql.SingleCollection, rows []xsql.Row, frames *analyticFrames) error {
+	ves := make([]*xsql.ValuerEval, len(rows))
+	keys := make([][]interface{}, len(rows))
+	idx := make([]int, len(rows))
+	for i, row := range rows {
+		ves[i] = &xsql.ValuerEval{Valuer: xsql.MultiValuer(row, &xsql.WindowRangeValuer{WindowRange: input.GetWindowRange()}, fv, &xsql.WildcardValuer{Data: row})}
+		keys[i] = make([]interface{}, len(call.OrderBy))
+		for j, s := range call.OrderBy {
+			keys[i][j] = ves[i].Eval(s.FieldExpr)
+		}
+		idx[i] = i
+	}
+	sort.SliceStable(idx, func(a, b int) bool {
+		ka, kb := keys[idx[a]], keys[idx[b]]
+		for j, s := range call.OrderBy {
+			c := compareOrderValue(ka[j], kb[j])
+			if c != 0 {
+				return (c < 0) == s.Ascending
+			}
+		}
+		return false
+	})
+	for _, i := range idx {
+		result := p.evalFrame(call, ves[i], fv, frames)
+		if e, ok := result.(error); ok {
+			return e
+		}
+		rows[i].Set(call.CachedField, result)
+	}
+	return nil
+}
+
+// compareOrderValue compares the values of ORDER BY. It returns a negative number if a is less than b.
+func compareOrderValue(a, b interface{}) int {
+	if a == nil || b == nil {
+		switch {
+		case a != nil:
+			return -1
+		case b != nil:
+			return 1
+		default:
+			return 0
+		}
+	}
+	if ta, ok := a.(time.Time); ok {
+		if tb, ok := b.(time.Time); ok {
+			return ta.Compare(tb)
+		}
+	}
+	fa, err1 := cast.ToFloat64(a, cast.STRICT)
+	fb, err2 := cast.ToFloat64(b, cast.STRICT)
+	if err1 == nil && err2 == nil {
+		switch {
+		case fa < fb:
+			return -1
+		case fa > fb:
+			return 1
+		default:
+			return 0
+		}
+	}
+	return strings.Compare(fmt.Sprintf("%v", a), fmt.Sprintf("%v", b))
+}
+
 func (p *AnalyticFuncsOp) Apply(ctx api.StreamContext, data interface{}, fv *xsql.FunctionValuer, _ *xsql.AggregateFunctionValuer) interface{} {
 	ctx.GetLogger().Debugf("AnalyticFuncsOp receive: %v", data)
-	var err error
+	var (
+		err    error
+		frames *analyticFrames
+	)
+	if p.HasFrame() {
+		if s, err := ctx.GetState(analyticFramesKey); err == nil && s != nil {
+			frames, _ = s.(*analyticFrames)
+		}
+		if frames == nil {
+			frames = &analyticFrames{Frames: make(map[string]map[string]*frameState)}
+		}
+	}
 	switch input := data.(type) {
 	case error:
 		return input
 	case xsql.TupleRow:
 		ve := &xsql.ValuerEval{Valuer: xsql.MultiValuer(input, fv)}
-		input, err = p.evalTupleFunc(p.FieldFuncs, ve, input)
+		input, err = p.evalTupleFunc(p.FieldFuncs, ve, fv, input, frames)
 		if err != nil {
 			return err
 		}
-		input, err = p.evalTupleFunc(p.Funcs, ve, input)
+		input, err = p.evalTupleFunc(p.Funcs, ve, fv, input, frames)
 		if err != nil {
 			return err
 		}
 		data = input
 	case xsql.SingleCollection:
-		input, err = p.evalCollectionFunc(p.FieldFuncs, fv, input)
+		input, err = p.evalCollectionFunc(p.FieldFuncs, fv, input, frames)
 		if err != nil {
 			return err
 		}
-		input, err = p.evalCollectionFunc(p.Funcs, fv, input)
+		input, err = p.evalCollectionFunc(p.Funcs, fv, input, frames)
 		if err != nil {
 			return err
 		}
@@ -88,5 +335,10 @@ func (p *AnalyticFuncsOp) Apply(ctx api.StreamContext, data interface{}, fv *xsq
 	default:
 		return fmt.Errorf("run analytic funcs op error: invalid input %[1]T(%[1]v)", input)
 	}
+	if frames != nil {
+		if err := ctx.PutState(analyticFramesKey, frames); err != nil {
+			return err
+		}
+	}
 	return data
 }
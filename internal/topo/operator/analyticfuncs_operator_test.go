@@ -15,11 +15,15 @@
 package operator
 
 import (
+	"bytes"
+	"encoding/gob"
 	"fmt"
 	"reflect"
 	"strconv"
 	"testing"
 
+	"github.com/stretchr/testify/require"
+
 	"github.com/lf-edge/ekuiper/internal/conf"
 	"github.com/lf-edge/ekuiper/internal/topo/context"
 	"github.com/lf-edge/ekuiper/internal/topo/state"
@@ -190,3 +194,67 @@ func TestAnalyticFuncs(t *testing.T) {
 		}
 	}
 }
+
+func TestAnalyticFrameFuncs(t *testing.T) {
+	temp := &ast.FieldRef{Name: "temp", StreamName: ast.DefaultStream}
+	device := &ast.PartitionExpr{Exprs: []ast.Expr{&ast.FieldRef{Name: "device", StreamName: ast.DefaultStream}}}
+	ts := ast.SortFields{{Name: "ts", Uname: "ts", Ascending: true, FieldExpr: &ast.FieldRef{Name: "ts", StreamName: ast.DefaultStream}}}
+	funcs := []*ast.Call{
+		{Name: "avg", FuncId: 0, FuncType: ast.FuncTypeAgg, Args: []ast.Expr{temp}, CachedField: "$$a_avg_0", Partition: device, Frame: &ast.FrameExpr{Preceding: 1}},
+		{Name: "sum", FuncId: 1, FuncType: ast.FuncTypeAgg, Args: []ast.Expr{temp}, CachedField: "$$a_sum_1", Partition: device, OrderBy: ts, Frame: &ast.FrameExpr{Preceding: -1}},
+		{Name: "count", FuncId: 2, FuncType: ast.FuncTypeAgg, Args: []ast.Expr{temp}, CachedField: "$$a_count_2", Frame: &ast.FrameExpr{Preceding: -1}, WhenExpr: &ast.BinaryExpr{OP: ast.GT, LHS: temp, RHS: &ast.IntegerLiteral{Val: 20}}},
+	}
+	data := []xsql.Message{
+		{"device": "a", "temp": 10.0},
+		{"device": "b", "temp": 30.0},
+		{"device": "a", "temp": 20.0},
+		{"device": "a", "temp": 40.0},
+		{"device": "a"},
+	}
+	exp := []map[string]interface{}{
+		{"$$a_avg_0": 10.0, "$$a_sum_1": 10.0, "$$a_count_2": 0},
+		{"$$a_avg_0": 30.0, "$$a_sum_1": 30.0, "$$a_count_2": 1},
+		{"$$a_avg_0": 15.0, "$$a_sum_1": 30.0, "$$a_count_2": 1},
+		{"$$a_avg_0": 30.0, "$$a_sum_1": 70.0, "$$a_count_2": 2},
+		// the row without temp is counted in the frame but not calculated
+		{"$$a_avg_0": 40.0, "$$a_sum_1": 70.0, "$$a_count_2": 2},
+	}
+	contextLogger := conf.Log.WithField("rule", "TestAnalyticFrameFuncs")
+	tempStore, _ := state.CreateStore("mockRuleFrame", api.AtMostOnce)
+	ctx := context.WithValue(context.Background(), context.LoggerKey, contextLogger).WithMeta("mockRuleFrame", "project", tempStore)
+	fv, afv := xsql.NewFunctionValuersForOp(ctx)
+
+	pp := &AnalyticFuncsOp{Funcs: funcs}
+	for i, d := range data {
+		r := pp.Apply(ctx, &xsql.Tuple{Emitter: "test", Message: d}, fv, afv)
+		require.Equal(t, exp[i], r.(*xsql.Tuple).CalCols, "row %d", i)
+	}
+	// the frames are restored from the state by a new operator such as after a restart
+	var buf bytes.Buffer
+	s, _ := ctx.GetState(analyticFramesKey)
+	require.NoError(t, gob.NewEncoder(&buf).Encode(&s))
+	var restored interface{}
+	require.NoError(t, gob.NewDecoder(&buf).Decode(&restored))
+	restoreStore, _ := state.CreateStore("mockRuleFrameRestore", api.AtMostOnce)
+	restoreCtx := context.WithValue(context.Background(), context.LoggerKey, contextLogger).WithMeta("mockRuleFrameRestore", "project", restoreStore)
+	require.NoError(t, restoreCtx.PutState(analyticFramesKey, restored))
+	rfv, rafv := xsql.NewFunctionValuersForOp(restoreCtx)
+	pp = &AnalyticFuncsOp{Funcs: funcs}
+	r := pp.Apply(restoreCtx, &xsql.Tuple{Emitter: "test", Message: xsql.Message{"device": "a", "temp": 50.0}}, rfv, rafv)
+	require.Equal(t, map[string]interface{}{"$$a_avg_0": 50.0, "$$a_sum_1": 120.0, "$$a_count_2": 3}, r.(*xsql.Tuple).CalCols)
+
+	// the rows of a collection are calculated in the order of ORDER BY
+	pp = &AnalyticFuncsOp{Funcs: []*ast.Call{
+		{Name: "sum", FuncId: 3, FuncType: ast.FuncTypeAgg, Args: []ast.Expr{temp}, CachedField: "$$a_sum_3", OrderBy: ts, Frame: &ast.FrameExpr{Preceding: -1}},
+	}}
+	r = pp.Apply(ctx, &xsql.WindowTuples{Content: []xsql.TupleRow{
+		&xsql.Tuple{Emitter: "test", Message: xsql.Message{"ts": 3, "temp": 1.0}},
+		&xsql.Tuple{Emitter: "test", Message: xsql.Message{"ts": 1, "temp": 2.0}},
+		&xsql.Tuple{Emitter: "test", Message: xsql.Message{"ts": 2, "temp": 3.0}},
+	}}, fv, afv)
+	var sums []interface{}
+	for _, row := range r.(*xsql.WindowTuples).Content {
+		sums = append(sums, row.(*xsql.Tuple).CalCols["$$a_sum_3"])
+	}
+	require.Equal(t, []interface{}{6.0, 2.0, 5.0}, sums)
+}
@@ -0,0 +1,102 @@
+// Copyright 2023 EMQ Technologies Co., Ltd.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package operator
+
+import (
+	"encoding/gob"
+	"encoding/json"
+	"fmt"
+
+	"github.com/lf-edge/ekuiper/internal/xsql"
+	"github.com/lf-edge/ekuiper/pkg/api"
+	"github.com/lf-edge/ekuiper/pkg/ast"
+)
+
+const dedupSeenKey = "$$dedupSeen"
+
+func init() {
+	gob.Register(&dedupSeen{})
+}
+
+// dedupSeen is the keys seen with the time of their first rows. Cleaned is the last time to clean the expired keys
+type dedupSeen struct {
+	Keys    map[string]int64
+	Cleaned int64
+}
+
+// DedupOp drops the rows whose keys have been seen within the duration. The seen keys are kept in the state, so that
+// the rows replayed after a restart are dropped too. The expired keys are cleaned once the duration passes.
+type DedupOp struct {
+	Keys []ast.Expr
+	// Within is the duration in milliseconds to remember a key since its first row
+	Within int64
+}
+
+func (p *DedupOp) Apply(ctx api.StreamContext, data interface{}, fv *xsql.FunctionValuer, _ *xsql.AggregateFunctionValuer) interface{} {
+	ctx.GetLogger().Debugf("dedup receive: %v", data)
+	switch input := data.(type) {
+	case error:
+		return input
+	case *xsql.Tuple:
+		key, err := p.key(input, fv)
+		if err != nil {
+			return err
+		}
+		var seen *dedupSeen
+		if s, err := ctx.GetState(dedupSeenKey); err == nil && s != nil {
+			seen, _ = s.(*dedupSeen)
+		}
+		if seen == nil {
+			seen = &dedupSeen{Keys: make(map[string]int64), Cleaned: input.Timestamp}
+		}
+		ts := input.Timestamp
+		if ts-seen.Cleaned >= p.Within {
+			for k, first := range seen.Keys {
+				if ts-first >= p.Within {
+					delete(seen.Keys, k)
+				}
+			}
+			seen.Cleaned = ts
+		}
+		if first, ok := seen.Keys[key]; ok && ts-first < p.Within {
+			ctx.GetLogger().Debugf("drop duplicate of key %s first seen at %d", key, first)
+			_ = ctx.PutState(dedupSeenKey, seen)
+			return nil
+		}
+		seen.Keys[key] = ts
+		_ = ctx.PutState(dedupSeenKey, seen)
+		return input
+	default:
+		return fmt.Errorf("run DEDUP BY error: invalid input %[1]T(%[1]v)", input)
+	}
+}
+
+// key encodes the values of the key expressions in json so that the values with the separators do not conflict
+func (p *DedupOp) key(row *xsql.Tuple, fv *xsql.FunctionValuer) (string, error) {
+	ve := &xsql.ValuerEval{Valuer: xsql.MultiValuer(row, fv)}
+	values := make([]interface{}, 0, len(p.Keys))
+	for _, e := range p.Keys {
+		v := ve.Eval(e)
+		if err, ok := v.(error); ok {
+			return "", fmt.Errorf("evaluate dedup key %s error: %v", e, err)
+		}
+		values = append(values, v)
+	}
+	b, err := json.Marshal(values)
+	if err != nil {
+		return "", fmt.Errorf("encode dedup key %v error: %v", values, err)
+	}
+	return string(b), nil
+}
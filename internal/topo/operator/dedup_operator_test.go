@@ -0,0 +1,59 @@
+// Copyright 2023 EMQ Technologies Co., Ltd.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package operator
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/lf-edge/ekuiper/internal/conf"
+	"github.com/lf-edge/ekuiper/internal/topo/context"
+	"github.com/lf-edge/ekuiper/internal/topo/state"
+	"github.com/lf-edge/ekuiper/internal/xsql"
+	"github.com/lf-edge/ekuiper/pkg/api"
+)
+
+func TestDedup(t *testing.T) {
+	stmt, err := xsql.NewParser(strings.NewReader(`SELECT * FROM demo DEDUP BY deviceId, msgId WITHIN (ss, 10) WHERE temp > 20`)).Parse()
+	require.NoError(t, err)
+	require.NotNil(t, stmt.Dedup)
+	data := []*xsql.Tuple{
+		{Emitter: "demo", Message: xsql.Message{"deviceId": "d1", "msgId": 1}, Timestamp: 0},
+		{Emitter: "demo", Message: xsql.Message{"deviceId": "d2", "msgId": 1}, Timestamp: 1000},
+		// duplicate
+		{Emitter: "demo", Message: xsql.Message{"deviceId": "d1", "msgId": 1}, Timestamp: 2000},
+		{Emitter: "demo", Message: xsql.Message{"deviceId": "d1", "msgId": 2}, Timestamp: 3000},
+		// the key of d1 is expired and cleaned
+		{Emitter: "demo", Message: xsql.Message{"deviceId": "d1", "msgId": 1}, Timestamp: 10000},
+		// duplicate of the row after expired
+		{Emitter: "demo", Message: xsql.Message{"deviceId": "d1", "msgId": 1}, Timestamp: 12000},
+	}
+	expected := []interface{}{data[0], data[1], nil, data[3], data[4], nil}
+	contextLogger := conf.Log.WithField("rule", "TestDedup")
+	tempStore, _ := state.CreateStore("mockRuleDedup", api.AtMostOnce)
+	ctx := context.WithValue(context.Background(), context.LoggerKey, contextLogger).WithMeta("mockRuleDedup", "dedup", tempStore)
+	pp := &DedupOp{Keys: stmt.Dedup.Keys, Within: 10000}
+	fv, afv := xsql.NewFunctionValuersForOp(ctx)
+	for i, d := range data {
+		require.Equal(t, expected[i], pp.Apply(ctx, d, fv, afv), i)
+	}
+	s, err := ctx.GetState(dedupSeenKey)
+	require.NoError(t, err)
+	seen := s.(*dedupSeen)
+	require.Equal(t, int64(10000), seen.Cleaned)
+	require.Len(t, seen.Keys, 3)
+}
@@ -0,0 +1,215 @@
+// Copyright 2023 EMQ Technologies Co., Ltd.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package operator
+
+import (
+	"encoding/gob"
+	"fmt"
+	"strings"
+
+	"github.com/lf-edge/ekuiper/internal/xsql"
+	"github.com/lf-edge/ekuiper/pkg/api"
+	"github.com/lf-edge/ekuiper/pkg/cast"
+)
+
+const (
+	fillStateKey = "$$fillGroups"
+
+	FillNull     = "null"
+	FillPrevious = "previous"
+	FillLinear   = "linear"
+)
+
+func init() {
+	gob.Register(&fillGroups{})
+}
+
+// fillGroups is the last row of each group. Order keeps the groups in the order they appear to fill them in a stable
+// order
+type fillGroups struct {
+	Rows  map[string]*fillRow
+	Order []string
+}
+
+// fillRow is the last row of a group with its source tuple fields to carry over to the filled rows. Start is the
+// start of the last window of the group, either filled or not, and Seen is the start of the last window with data.
+type fillRow struct {
+	Message   map[string]interface{}
+	Emitter   string
+	Timestamp int64
+	Metadata  map[string]interface{}
+	Start     int64
+	Seen      int64
+}
+
+// FillOp fills the rows of the windows without data for each group so that the output series is continuous. The
+// windows skipped by the event time windows and the windows without any row of the group are filled. In linear mode,
+// the missing windows are interpolated when the group has data again.
+type FillOp struct {
+	Mode string
+	// Step is the duration in milliseconds between the starts of two successive windows
+	Step int64
+	// MaxGap is the max duration in milliseconds to fill since the last window with data of a group. The group without
+	// data for longer is removed. 0 means no limit
+	MaxGap int64
+	// Keys are the fields to identify a group. Aggs are the aggregate fields to fill. Starts and Ends are the fields of
+	// window_start() and window_end() which are set to the range of the filled window
+	Keys   []string
+	Aggs   []string
+	Starts []string
+	Ends   []string
+}
+
+func (p *FillOp) Apply(ctx api.StreamContext, data interface{}, _ *xsql.FunctionValuer, _ *xsql.AggregateFunctionValuer) interface{} {
+	ctx.GetLogger().Debugf("fill receive: %v", data)
+	switch input := data.(type) {
+	case error:
+		return input
+	case xsql.Collection:
+		wr := input.GetWindowRange()
+		if wr == nil {
+			return input
+		}
+		var groups *fillGroups
+		if s, err := ctx.GetState(fillStateKey); err == nil && s != nil {
+			groups, _ = s.(*fillGroups)
+		}
+		if groups == nil {
+			groups = &fillGroups{Rows: make(map[string]*fillRow)}
+		}
+		ws := wr.WindowStart()
+		current := make(map[string]*fillRow)
+		var rows []*fillRow
+		if input.Len() > 0 {
+			maps := input.ToMaps()
+			_ = input.Range(func(i int, r xsql.ReadonlyRow) (bool, error) {
+				if i >= len(maps) {
+					return false, nil
+				}
+				row := &fillRow{Message: maps[i], Start: ws, Seen: ws}
+				if t := sourceTuple(r); t != nil {
+					row.Emitter, row.Timestamp, row.Metadata = t.Emitter, t.Timestamp, t.Metadata
+				}
+				rows = append(rows, row)
+				current[p.key(row.Message)] = row
+				return true, nil
+			})
+		}
+		length := wr.WindowEnd() - ws
+		var (
+			filled []*fillRow
+			order  []string
+		)
+		for _, k := range groups.Order {
+			last := groups.Rows[k]
+			// the count of the windows between the last window of the group and the current one
+			n := (ws-last.Start+p.Step/2)/p.Step - 1
+			row, ok := current[k]
+			if p.Mode == FillLinear {
+				// the gap longer than the max gap is not interpolated
+				if ok && !p.expired(last, ws) {
+					for i := int64(1); i <= n; i++ {
+						filled = append(filled, p.fill(last, row, float64(i)/float64(n+1), last.Start+i*p.Step, length))
+					}
+				}
+			} else {
+				for i := int64(1); i <= n && !p.expired(last, last.Start+i*p.Step); i++ {
+					filled = append(filled, p.fill(last, nil, 0, last.Start+i*p.Step, length))
+				}
+				if !ok && !p.expired(last, ws) {
+					filled = append(filled, p.fill(last, nil, 0, ws, length))
+					last.Start = ws
+				}
+			}
+			if !ok && p.expired(last, ws) {
+				delete(groups.Rows, k)
+				continue
+			}
+			order = append(order, k)
+		}
+		groups.Order = order
+		for _, row := range rows {
+			k := p.key(row.Message)
+			if _, ok := groups.Rows[k]; !ok {
+				groups.Order = append(groups.Order, k)
+			}
+			groups.Rows[k] = row
+		}
+		if err := ctx.PutState(fillStateKey, groups); err != nil {
+			return err
+		}
+		if len(filled) == 0 && len(rows) == 0 {
+			return nil
+		}
+		result := &xsql.WindowTuples{WindowRange: wr}
+		for _, row := range append(filled, rows...) {
+			result.Content = append(result.Content, &xsql.Tuple{Emitter: row.Emitter, Message: row.Message, Timestamp: row.Timestamp, Metadata: row.Metadata})
+		}
+		return result
+	default:
+		return fmt.Errorf("run fill op error: invalid input %[1]T(%[1]v)", input)
+	}
+}
+
+// sourceTuple returns the tuple of the row to carry over. The row of a group carries the first tuple of the group like
+// its metadata
+func sourceTuple(r xsql.ReadonlyRow) *xsql.Tuple {
+	if g, ok := r.(*xsql.GroupedTuples); ok && len(g.Content) > 0 {
+		r = g.Content[0]
+	}
+	t, _ := r.(*xsql.Tuple)
+	return t
+}
+
+// expired returns whether the window started at start is beyond the max gap since the last data of the group
+func (p *FillOp) expired(last *fillRow, start int64) bool {
+	return p.MaxGap > 0 && start-last.Seen > p.MaxGap
+}
+
+func (p *FillOp) key(row map[string]interface{}) string {
+	var b strings.Builder
+	for _, k := range p.Keys {
+		b.WriteString(fmt.Sprintf("%v,", row[k]))
+	}
+	return b.String()
+}
+
+// fill creates the row of the window started at start from the last row of the group. In linear mode, the aggregate
+// fields are interpolated between the last row and the next row by the ratio
+func (p *FillOp) fill(last, next *fillRow, ratio float64, start, length int64) *fillRow {
+	row := make(map[string]interface{}, len(last.Message))
+	for k, v := range last.Message {
+		row[k] = v
+	}
+	for _, k := range p.Aggs {
+		switch p.Mode {
+		case FillNull:
+			row[k] = nil
+		case FillLinear:
+			prev, err1 := cast.ToFloat64(last.Message[k], cast.CONVERT_SAMEKIND)
+			nv, err2 := cast.ToFloat64(next.Message[k], cast.CONVERT_SAMEKIND)
+			if err1 == nil && err2 == nil {
+				row[k] = prev + (nv-prev)*ratio
+			}
+		}
+	}
+	for _, k := range p.Starts {
+		row[k] = start
+	}
+	for _, k := range p.Ends {
+		row[k] = start + length
+	}
+	return &fillRow{Message: row, Emitter: last.Emitter, Timestamp: last.Timestamp, Metadata: last.Metadata}
+}
@@ -0,0 +1,150 @@
+// Copyright 2023 EMQ Technologies Co., Ltd.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package operator
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/lf-edge/ekuiper/internal/conf"
+	"github.com/lf-edge/ekuiper/internal/topo/context"
+	"github.com/lf-edge/ekuiper/internal/topo/state"
+	"github.com/lf-edge/ekuiper/internal/xsql"
+	"github.com/lf-edge/ekuiper/pkg/api"
+)
+
+func TestFill(t *testing.T) {
+	window := func(start int64, rows ...map[string]interface{}) *xsql.WindowTuples {
+		w := &xsql.WindowTuples{WindowRange: xsql.NewWindowRange(start, start+10)}
+		for _, r := range rows {
+			w.Content = append(w.Content, &xsql.Tuple{Emitter: "demo", Message: r})
+		}
+		return w
+	}
+	row := func(id string, avg interface{}, end int64) map[string]interface{} {
+		return map[string]interface{}{"id": id, "avg": avg, "end": end}
+	}
+	inputs := []*xsql.WindowTuples{
+		window(0, row("a", 1.0, 10), row("b", 10.0, 10)),
+		window(10, row("a", 2.0, 20)),
+		// the windows 20 and 30 are skipped
+		window(40, row("a", 5.0, 50), row("b", 40.0, 50)),
+		window(50),
+	}
+	tests := []struct {
+		mode   string
+		result [][]map[string]interface{}
+	}{
+		{
+			mode: FillNull,
+			result: [][]map[string]interface{}{
+				{row("a", 1.0, 10), row("b", 10.0, 10)},
+				{row("b", nil, 20), row("a", 2.0, 20)},
+				{row("a", nil, 30), row("a", nil, 40), row("b", nil, 30), row("b", nil, 40), row("a", 5.0, 50), row("b", 40.0, 50)},
+				{row("a", nil, 60), row("b", nil, 60)},
+			},
+		},
+		{
+			mode: FillPrevious,
+			result: [][]map[string]interface{}{
+				{row("a", 1.0, 10), row("b", 10.0, 10)},
+				{row("b", 10.0, 20), row("a", 2.0, 20)},
+				{row("a", 2.0, 30), row("a", 2.0, 40), row("b", 10.0, 30), row("b", 10.0, 40), row("a", 5.0, 50), row("b", 40.0, 50)},
+				{row("a", 5.0, 60), row("b", 40.0, 60)},
+			},
+		},
+		{
+			mode: FillLinear,
+			result: [][]map[string]interface{}{
+				{row("a", 1.0, 10), row("b", 10.0, 10)},
+				{row("a", 2.0, 20)},
+				{row("a", 3.0, 30), row("a", 4.0, 40), row("b", 17.5, 20), row("b", 25.0, 30), row("b", 32.5, 40), row("a", 5.0, 50), row("b", 40.0, 50)},
+				// the empty window is filled until the next data
+				nil,
+			},
+		},
+	}
+	contextLogger := conf.Log.WithField("rule", "TestFill")
+	for _, tt := range tests {
+		t.Run(tt.mode, func(t *testing.T) {
+			tempStore, _ := state.CreateStore("mockRuleFill"+tt.mode, api.AtMostOnce)
+			ctx := context.WithValue(context.Background(), context.LoggerKey, contextLogger).WithMeta("mockRuleFill"+tt.mode, "project", tempStore)
+			fv, afv := xsql.NewFunctionValuersForOp(ctx)
+			op := &FillOp{Mode: tt.mode, Step: 10, Keys: []string{"id"}, Aggs: []string{"avg"}, Ends: []string{"end"}}
+			for i, input := range inputs {
+				r := op.Apply(ctx, input, fv, afv)
+				if tt.result[i] == nil {
+					require.Nil(t, r, "window %d", i)
+					continue
+				}
+				require.Equal(t, tt.result[i], r.(*xsql.WindowTuples).ToMaps(), "window %d", i)
+			}
+		})
+	}
+}
+
+func TestFillMaxGap(t *testing.T) {
+	row := func(id string, avg interface{}, end int64) map[string]interface{} {
+		return map[string]interface{}{"id": id, "avg": avg, "end": end}
+	}
+	window := func(start int64, rows ...map[string]interface{}) *xsql.WindowTuples {
+		w := &xsql.WindowTuples{WindowRange: xsql.NewWindowRange(start, start+10)}
+		for _, r := range rows {
+			w.Content = append(w.Content, &xsql.Tuple{Emitter: "demo", Message: r, Timestamp: start + 1, Metadata: xsql.Metadata{"topic": r["id"]}})
+		}
+		return w
+	}
+	inputs := []*xsql.WindowTuples{
+		window(0, row("a", 1.0, 10), row("b", 10.0, 10)),
+		window(10, row("a", 2.0, 20)),
+		window(20, row("a", 3.0, 30)),
+		// b is removed as it has no data for longer than the max gap
+		window(30, row("a", 4.0, 40)),
+		window(40, row("a", 5.0, 50), row("b", 40.0, 50)),
+	}
+	result := [][]map[string]interface{}{
+		{row("a", 1.0, 10), row("b", 10.0, 10)},
+		{row("b", 10.0, 20), row("a", 2.0, 20)},
+		{row("b", 10.0, 30), row("a", 3.0, 30)},
+		{row("a", 4.0, 40)},
+		{row("a", 5.0, 50), row("b", 40.0, 50)},
+	}
+	contextLogger := conf.Log.WithField("rule", "TestFillMaxGap")
+	tempStore, _ := state.CreateStore("mockRuleFillMaxGap", api.AtMostOnce)
+	ctx := context.WithValue(context.Background(), context.LoggerKey, contextLogger).WithMeta("mockRuleFillMaxGap", "project", tempStore)
+	fv, afv := xsql.NewFunctionValuersForOp(ctx)
+	op := &FillOp{Mode: FillPrevious, Step: 10, MaxGap: 20, Keys: []string{"id"}, Aggs: []string{"avg"}, Ends: []string{"end"}}
+	for i, input := range inputs {
+		r := op.Apply(ctx, input, fv, afv).(*xsql.WindowTuples)
+		require.Equal(t, result[i], r.ToMaps(), "window %d", i)
+		// the filled rows carry over the tuple fields of the last row of the group
+		if i == 1 {
+			filled := r.Content[0].(*xsql.Tuple)
+			require.Equal(t, "demo", filled.Emitter)
+			require.Equal(t, int64(1), filled.Timestamp)
+			require.Equal(t, xsql.Metadata{"topic": "b"}, filled.Metadata)
+		}
+	}
+	// the row of a group carries over its first tuple
+	groupStore, _ := state.CreateStore("mockRuleFillGroup", api.AtMostOnce)
+	ctx = context.WithValue(context.Background(), context.LoggerKey, contextLogger).WithMeta("mockRuleFillGroup", "project", groupStore)
+	op = &FillOp{Mode: FillNull, Step: 10, Keys: []string{"id"}, Aggs: []string{"avg"}, Ends: []string{"end"}}
+	grouped := &xsql.GroupedTuplesSet{Groups: []*xsql.GroupedTuples{{Content: window(60, row("c", 1.0, 70)).Content}}, WindowRange: xsql.NewWindowRange(60, 70)}
+	require.Equal(t, []map[string]interface{}{row("c", 1.0, 70)}, op.Apply(ctx, grouped, fv, afv).(*xsql.WindowTuples).ToMaps())
+	r := op.Apply(ctx, window(70), fv, afv).(*xsql.WindowTuples)
+	require.Equal(t, []map[string]interface{}{row("c", nil, 80)}, r.ToMaps())
+	require.Equal(t, xsql.Metadata{"topic": "c"}, r.Content[0].(*xsql.Tuple).Metadata)
+}
@@ -0,0 +1,291 @@
+// Copyright 2022 EMQ Technologies Co., Ltd.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package operator
+
+import (
+	"encoding/gob"
+	"fmt"
+	"strings"
+
+	"github.com/lf-edge/ekuiper/internal/xsql"
+	"github.com/lf-edge/ekuiper/pkg/api"
+	"github.com/lf-edge/ekuiper/pkg/ast"
+)
+
+const matchRunsKey = "$$matchRuns"
+
+func init() {
+	gob.Register(&matchRuns{})
+}
+
+// matchRuns is the partial matches of each partition. Cleaned is the last time to drop the expired runs of all the
+// partitions, so that the runs of the partitions without new rows do not stay forever
+type matchRuns struct {
+	Partitions map[string][]*matchRun
+	Cleaned    int64
+}
+
+// matchRun is a partial match of the pattern. Pos is the index of the current pattern variable and Count is the rows
+// matched by it. Rows keeps the last matched row of each variable.
+type matchRun struct {
+	Pos   int
+	Count int
+	Start int64
+	Rows  map[string]*xsql.Tuple
+}
+
+// MatchRecognizeOp matches the pattern against the rows of each partition in order. When a match completes, it is
+// sent out as a row of the partition fields and the measures, and the next match starts after the last matched row.
+type MatchRecognizeOp struct {
+	Match *ast.MatchRecognize
+	// Within is the max duration in milliseconds from the first to the last row of a match, 0 means no limit
+	Within int64
+}
+
+func (p *MatchRecognizeOp) Apply(ctx api.StreamContext, data interface{}, fv *xsql.FunctionValuer, _ *xsql.AggregateFunctionValuer) interface{} {
+	ctx.GetLogger().Debugf("match recognize receive: %v", data)
+	switch input := data.(type) {
+	case error:
+		return input
+	case *xsql.Tuple:
+		key, err := p.partitionKey(input, fv)
+		if err != nil {
+			return err
+		}
+		var all *matchRuns
+		if s, err := ctx.GetState(matchRunsKey); err == nil && s != nil {
+			all, _ = s.(*matchRuns)
+		}
+		if all == nil {
+			all = &matchRuns{Partitions: make(map[string][]*matchRun), Cleaned: input.Timestamp}
+		}
+		if p.Within > 0 && input.Timestamp-all.Cleaned >= p.Within {
+			p.expire(all, input.Timestamp)
+		}
+		runs, matched, err := p.step(all.Partitions[key], input, fv)
+		if err != nil {
+			return err
+		}
+		if len(runs) > 0 {
+			all.Partitions[key] = runs
+		} else {
+			delete(all.Partitions, key)
+		}
+		_ = ctx.PutState(matchRunsKey, all)
+		if matched == nil {
+			return nil
+		}
+		return p.output(input, matched, fv)
+	default:
+		return fmt.Errorf("run MATCH_RECOGNIZE error: invalid input %[1]T(%[1]v)", input)
+	}
+}
+
+// expire drops the runs of all the partitions which cannot complete within the duration by the time
+func (p *MatchRecognizeOp) expire(all *matchRuns, ts int64) {
+	for k, runs := range all.Partitions {
+		i := 0
+		for _, r := range runs {
+			if ts-r.Start <= p.Within {
+				runs[i] = r
+				i++
+			}
+		}
+		if i == 0 {
+			delete(all.Partitions, k)
+		} else {
+			all.Partitions[k] = runs[:i]
+		}
+	}
+	all.Cleaned = ts
+}
+
+func (p *MatchRecognizeOp) partitionKey(row *xsql.Tuple, fv *xsql.FunctionValuer) (string, error) {
+	if p.Match.Partition == nil {
+		return "", nil
+	}
+	ve := &xsql.ValuerEval{Valuer: xsql.MultiValuer(row, fv)}
+	var b strings.Builder
+	for i, e := range p.Match.Partition.Exprs {
+		v := ve.Eval(e)
+		if err, ok := v.(error); ok {
+			return "", fmt.Errorf("evaluate partition key %s error: %v", e, err)
+		}
+		if i > 0 {
+			b.WriteByte(',')
+		}
+		b.WriteString(fmt.Sprintf("%v", v))
+	}
+	return b.String(), nil
+}
+
+// step moves the runs and a new run from the row forward. It returns the matched run if any, which clears all the
+// runs so that the matches do not overlap. If several runs complete, the one starting earliest wins.
+func (p *MatchRecognizeOp) step(runs []*matchRun, row *xsql.Tuple, fv *xsql.FunctionValuer) ([]*matchRun, *matchRun, error) {
+	runs = append(runs, &matchRun{Start: row.Timestamp})
+	var (
+		result  []*matchRun
+		matched *matchRun
+		seen    = make(map[string]struct{})
+	)
+	for _, r := range runs {
+		if p.Within > 0 && row.Timestamp-r.Start > p.Within {
+			continue
+		}
+		// try the current variable and the following ones which can be skipped
+		for pos, count := r.Pos, r.Count; pos < len(p.Match.Pattern); pos, count = pos+1, 0 {
+			v := p.Match.Pattern[pos]
+			if v.Max < 0 || count < v.Max {
+				ok, err := p.test(v.Name, r.Rows, row, fv)
+				if err != nil {
+					return nil, nil, err
+				}
+				if ok {
+					next := &matchRun{Pos: pos, Count: count + 1, Start: r.Start, Rows: make(map[string]*xsql.Tuple, len(r.Rows)+1)}
+					for k, t := range r.Rows {
+						next.Rows[k] = t
+					}
+					next.Rows[v.Name] = row
+					if p.complete(next) {
+						if matched == nil || next.Start < matched.Start {
+							matched = next
+						}
+					} else if k := p.runKey(next); !hasKey(seen, k) {
+						seen[k] = struct{}{}
+						result = append(result, next)
+					}
+				}
+			}
+			if count < v.Min {
+				break
+			}
+		}
+	}
+	if matched != nil {
+		return nil, matched, nil
+	}
+	return result, nil, nil
+}
+
+// complete returns whether the remaining variables of the run can all be skipped
+func (p *MatchRecognizeOp) complete(r *matchRun) bool {
+	if r.Count < p.Match.Pattern[r.Pos].Min {
+		return false
+	}
+	for _, v := range p.Match.Pattern[r.Pos+1:] {
+		if v.Min > 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// runKey identifies the runs which behave the same for the following rows. The count over the min of an unbounded
+// variable makes no difference.
+func (p *MatchRecognizeOp) runKey(r *matchRun) string {
+	count := r.Count
+	if v := p.Match.Pattern[r.Pos]; v.Max < 0 && count > v.Min {
+		count = v.Min
+	}
+	return fmt.Sprintf("%d-%d-%d", r.Start, r.Pos, count)
+}
+
+func hasKey(m map[string]struct{}, k string) bool {
+	_, ok := m[k]
+	return ok
+}
+
+// test returns whether the row matches the variable. A variable without definition matches any row.
+func (p *MatchRecognizeOp) test(name string, rows map[string]*xsql.Tuple, row *xsql.Tuple, fv *xsql.FunctionValuer) (bool, error) {
+	var cond ast.Expr
+	for _, d := range p.Match.Defines {
+		if d.Name == name {
+			cond = d.Condition
+			break
+		}
+	}
+	if cond == nil {
+		return true, nil
+	}
+	ve := &xsql.ValuerEval{Valuer: xsql.MultiValuer(p.valuer(name, rows, row), fv)}
+	switch r := ve.Eval(cond).(type) {
+	case error:
+		return false, fmt.Errorf("evaluate define of %s error: %v", name, r)
+	case bool:
+		return r, nil
+	default:
+		return false, nil
+	}
+}
+
+func (p *MatchRecognizeOp) valuer(current string, rows map[string]*xsql.Tuple, row *xsql.Tuple) *matchValuer {
+	vars := make(map[string]struct{}, len(p.Match.Pattern))
+	for _, v := range p.Match.Pattern {
+		vars[v.Name] = struct{}{}
+	}
+	return &matchValuer{vars: vars, current: current, rows: rows, row: row}
+}
+
+// output builds the row of the match with the partition fields and the measures
+func (p *MatchRecognizeOp) output(row *xsql.Tuple, matched *matchRun, fv *xsql.FunctionValuer) interface{} {
+	msg := make(xsql.Message)
+	if p.Match.Partition != nil {
+		for _, e := range p.Match.Partition.Exprs {
+			if f, ok := e.(*ast.FieldRef); ok {
+				msg[f.Name], _ = row.Value(f.Name, string(f.StreamName))
+			}
+		}
+	}
+	ve := &xsql.ValuerEval{Valuer: xsql.MultiValuer(p.valuer("", matched.Rows, row), fv)}
+	for _, f := range p.Match.Measures {
+		v := ve.Eval(f.Expr)
+		if err, ok := v.(error); ok {
+			return fmt.Errorf("evaluate measure %s error: %v", f.Name, err)
+		}
+		msg[f.Name] = v
+	}
+	return &xsql.Tuple{Emitter: row.Emitter, Message: msg, Timestamp: row.Timestamp, Metadata: row.Metadata}
+}
+
+// matchValuer reads the fields of a pattern variable like A.temp from its last matched row, and the other fields from
+// the current row
+type matchValuer struct {
+	vars    map[string]struct{}
+	current string
+	rows    map[string]*xsql.Tuple
+	row     *xsql.Tuple
+}
+
+func (v *matchValuer) target(table string) (*xsql.Tuple, bool) {
+	if _, ok := v.vars[table]; ok && table != v.current {
+		r, ok := v.rows[table]
+		return r, ok
+	}
+	return v.row, true
+}
+
+func (v *matchValuer) Value(key, table string) (interface{}, bool) {
+	if r, ok := v.target(table); ok {
+		return r.Value(key, table)
+	}
+	return nil, false
+}
+
+func (v *matchValuer) Meta(key, table string) (interface{}, bool) {
+	if r, ok := v.target(table); ok {
+		return r.Meta(key, table)
+	}
+	return nil, false
+}
@@ -0,0 +1,115 @@
+// Copyright 2022 EMQ Technologies Co., Ltd.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package operator
+
+import (
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/lf-edge/ekuiper/internal/conf"
+	"github.com/lf-edge/ekuiper/internal/topo/context"
+	"github.com/lf-edge/ekuiper/internal/topo/state"
+	"github.com/lf-edge/ekuiper/internal/xsql"
+	"github.com/lf-edge/ekuiper/pkg/api"
+)
+
+func TestMatchRecognize(t *testing.T) {
+	tests := []struct {
+		sql    string
+		within int64
+		data   []*xsql.Tuple
+		result []interface{}
+	}{
+		{ // 0 partition and within
+			sql:    `SELECT * FROM demo MATCH_RECOGNIZE (PARTITION BY deviceId MEASURES A.temp AS startTemp, B.temp AS endTemp PATTERN (A B+) DEFINE A AS temp > 30, B AS temp > A.temp)`,
+			within: 10000,
+			data: []*xsql.Tuple{
+				{Emitter: "demo", Message: xsql.Message{"deviceId": "d1", "temp": 20}, Timestamp: 0},
+				{Emitter: "demo", Message: xsql.Message{"deviceId": "d1", "temp": 31}, Timestamp: 1},
+				{Emitter: "demo", Message: xsql.Message{"deviceId": "d2", "temp": 35}, Timestamp: 2},
+				{Emitter: "demo", Message: xsql.Message{"deviceId": "d1", "temp": 33}, Timestamp: 3},
+				{Emitter: "demo", Message: xsql.Message{"deviceId": "d2", "temp": 36}, Timestamp: 15000},
+				{Emitter: "demo", Message: xsql.Message{"deviceId": "d2", "temp": 40}, Timestamp: 16000},
+			},
+			result: []interface{}{
+				nil, nil, nil,
+				&xsql.Tuple{Emitter: "demo", Message: xsql.Message{"deviceId": "d1", "startTemp": 31, "endTemp": 33}, Timestamp: 3},
+				nil,
+				&xsql.Tuple{Emitter: "demo", Message: xsql.Message{"deviceId": "d2", "startTemp": 36, "endTemp": 40}, Timestamp: 16000},
+			},
+		},
+		{ // 1 variable without define and the match does not overlap
+			sql: `SELECT * FROM demo MATCH_RECOGNIZE (MEASURES A.temp AS startTemp, temp AS endTemp PATTERN (A N* B) DEFINE A AS temp > 30, B AS temp < 20)`,
+			data: []*xsql.Tuple{
+				{Emitter: "demo", Message: xsql.Message{"temp": 35}, Timestamp: 0},
+				{Emitter: "demo", Message: xsql.Message{"temp": 25}, Timestamp: 1},
+				{Emitter: "demo", Message: xsql.Message{"temp": 32}, Timestamp: 2},
+				{Emitter: "demo", Message: xsql.Message{"temp": 10}, Timestamp: 3},
+				{Emitter: "demo", Message: xsql.Message{"temp": 10}, Timestamp: 4},
+			},
+			result: []interface{}{
+				nil, nil, nil,
+				&xsql.Tuple{Emitter: "demo", Message: xsql.Message{"startTemp": 35, "endTemp": 10}, Timestamp: 3},
+				nil,
+			},
+		},
+	}
+	contextLogger := conf.Log.WithField("rule", "TestMatchRecognize")
+	for i, tt := range tests {
+		stmt, err := xsql.NewParser(strings.NewReader(tt.sql)).Parse()
+		require.NoError(t, err)
+		tempStore, _ := state.CreateStore("mockRule"+strconv.Itoa(i), api.AtMostOnce)
+		ctx := context.WithValue(context.Background(), context.LoggerKey, contextLogger).WithMeta("mockRule"+strconv.Itoa(i), "match", tempStore)
+		pp := &MatchRecognizeOp{Match: stmt.MatchRecognize, Within: tt.within}
+		fv, afv := xsql.NewFunctionValuersForOp(ctx)
+		r := make([]interface{}, 0, len(tt.data))
+		for _, d := range tt.data {
+			r = append(r, pp.Apply(ctx, d, fv, afv))
+		}
+		require.Equal(t, tt.result, r, "case %d", i)
+	}
+}
+
+func TestMatchRecognizeExpire(t *testing.T) {
+	stmt, err := xsql.NewParser(strings.NewReader(`SELECT * FROM demo MATCH_RECOGNIZE (PARTITION BY deviceId PATTERN (A B) DEFINE A AS temp > 30, B AS temp > A.temp)`)).Parse()
+	require.NoError(t, err)
+	tempStore, _ := state.CreateStore("mockRuleExpire", api.AtMostOnce)
+	ctx := context.WithValue(context.Background(), context.LoggerKey, conf.Log).WithMeta("mockRuleExpire", "match", tempStore)
+	fv, afv := xsql.NewFunctionValuersForOp(ctx)
+	pp := &MatchRecognizeOp{Match: stmt.MatchRecognize, Within: 10000}
+	require.Nil(t, pp.Apply(ctx, &xsql.Tuple{Emitter: "demo", Message: xsql.Message{"deviceId": "d1", "temp": 31}, Timestamp: 0}, fv, afv))
+	require.Nil(t, pp.Apply(ctx, &xsql.Tuple{Emitter: "demo", Message: xsql.Message{"deviceId": "d2", "temp": 31}, Timestamp: 5000}, fv, afv))
+	// the partial match of d1 expires by the row of d3 though d1 has no new rows
+	require.Nil(t, pp.Apply(ctx, &xsql.Tuple{Emitter: "demo", Message: xsql.Message{"deviceId": "d3", "temp": 20}, Timestamp: 12000}, fv, afv))
+	s, err := ctx.GetState(matchRunsKey)
+	require.NoError(t, err)
+	all := s.(*matchRuns)
+	require.NotContains(t, all.Partitions, "d1")
+	require.Len(t, all.Partitions["d2"], 1)
+	require.Equal(t, int64(5000), all.Partitions["d2"][0].Start)
+}
+
+func TestMatchRecognizeInvalid(t *testing.T) {
+	stmt, err := xsql.NewParser(strings.NewReader(`SELECT * FROM demo MATCH_RECOGNIZE (PATTERN (A))`)).Parse()
+	require.NoError(t, err)
+	tempStore, _ := state.CreateStore("mockRule", api.AtMostOnce)
+	ctx := context.WithValue(context.Background(), context.LoggerKey, conf.Log).WithMeta("mockRule", "match", tempStore)
+	fv, afv := xsql.NewFunctionValuersForOp(ctx)
+	r := (&MatchRecognizeOp{Match: stmt.MatchRecognize}).Apply(ctx, &xsql.WindowTuples{}, fv, afv)
+	require.ErrorContains(t, r.(error), "run MATCH_RECOGNIZE error: invalid input *xsql.WindowTuples")
+}
@@ -0,0 +1,48 @@
+// Copyright 2023 EMQ Technologies Co., Ltd.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package operator
+
+import (
+	"fmt"
+
+	"github.com/lf-edge/ekuiper/internal/xsql"
+	"github.com/lf-edge/ekuiper/pkg/api"
+)
+
+// UnionStreamMeta is the meta key of the stream name which the merged row is from
+const UnionStreamMeta = "stream"
+
+// UnionOp merges the rows of the streams of UNION ALL as the rows of the first stream. The original stream name is
+// kept in the meta so that it can be read by meta(stream)
+type UnionOp struct {
+	Emitter string
+}
+
+func (p *UnionOp) Apply(ctx api.StreamContext, data interface{}, _ *xsql.FunctionValuer, _ *xsql.AggregateFunctionValuer) interface{} {
+	ctx.GetLogger().Debugf("union receive: %v", data)
+	switch input := data.(type) {
+	case error:
+		return input
+	case *xsql.Tuple:
+		meta := make(xsql.Metadata, len(input.Metadata)+1)
+		for k, v := range input.Metadata {
+			meta[k] = v
+		}
+		meta[UnionStreamMeta] = input.Emitter
+		return &xsql.Tuple{Emitter: p.Emitter, Message: input.Message, Metadata: meta, Timestamp: input.Timestamp}
+	default:
+		return fmt.Errorf("run UNION ALL error: invalid input %[1]T(%[1]v)", input)
+	}
+}
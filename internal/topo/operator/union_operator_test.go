@@ -0,0 +1,61 @@
+// Copyright 2023 EMQ Technologies Co., Ltd.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package operator
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/lf-edge/ekuiper/internal/conf"
+	"github.com/lf-edge/ekuiper/internal/topo/context"
+	"github.com/lf-edge/ekuiper/internal/xsql"
+	"github.com/lf-edge/ekuiper/pkg/ast"
+)
+
+func TestUnion(t *testing.T) {
+	contextLogger := conf.Log.WithField("rule", "TestUnion")
+	ctx := context.WithValue(context.Background(), context.LoggerKey, contextLogger)
+	fv, afv := xsql.NewFunctionValuersForOp(ctx)
+	pp := &UnionOp{Emitter: "s1"}
+	tests := []struct {
+		data   interface{}
+		result interface{}
+	}{
+		{
+			data:   &xsql.Tuple{Emitter: "s1", Message: xsql.Message{"temp": 20}, Timestamp: 10},
+			result: &xsql.Tuple{Emitter: "s1", Message: xsql.Message{"temp": 20}, Metadata: xsql.Metadata{"stream": "s1"}, Timestamp: 10},
+		},
+		{
+			data:   &xsql.Tuple{Emitter: "s2", Message: xsql.Message{"temp": 30}, Metadata: xsql.Metadata{"topic": "t2"}, Timestamp: 20},
+			result: &xsql.Tuple{Emitter: "s1", Message: xsql.Message{"temp": 30}, Metadata: xsql.Metadata{"topic": "t2", "stream": "s2"}, Timestamp: 20},
+		},
+		{
+			data:   errors.New("an error from upstream"),
+			result: errors.New("an error from upstream"),
+		},
+		{
+			data:   "invalid",
+			result: errors.New("run UNION ALL error: invalid input string(invalid)"),
+		},
+	}
+	for i, tt := range tests {
+		require.Equal(t, tt.result, pp.Apply(ctx, tt.data, fv, afv), i)
+	}
+	// the meta of the merged stream is readable by the first stream name
+	ve := &xsql.ValuerEval{Valuer: xsql.MultiValuer(pp.Apply(ctx, tests[1].data, fv, afv).(*xsql.Tuple), fv)}
+	require.Equal(t, "s2", ve.Eval(&ast.MetaRef{StreamName: "s1", Name: "stream"}))
+}
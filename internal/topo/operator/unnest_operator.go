@@ -0,0 +1,71 @@
+// Copyright 2023 EMQ Technologies Co., Ltd.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package operator
+
+import (
+	"fmt"
+
+	"github.com/lf-edge/ekuiper/internal/xsql"
+	"github.com/lf-edge/ekuiper/pkg/api"
+	"github.com/lf-edge/ekuiper/pkg/ast"
+)
+
+// UnnestOp expands each element of the array into a row of which the element is the field named by the alias. The
+// row of a null or empty array is dropped like a cross join
+type UnnestOp struct {
+	Expr  ast.Expr
+	Alias string
+}
+
+func (p *UnnestOp) Apply(ctx api.StreamContext, data interface{}, fv *xsql.FunctionValuer, _ *xsql.AggregateFunctionValuer) interface{} {
+	ctx.GetLogger().Debugf("unnest receive: %v", data)
+	switch input := data.(type) {
+	case error:
+		return input
+	case *xsql.Tuple:
+		ve := &xsql.ValuerEval{Valuer: xsql.MultiValuer(input, fv)}
+		var elements []interface{}
+		switch v := ve.Eval(p.Expr).(type) {
+		case error:
+			return fmt.Errorf("run UNNEST error: %v", v)
+		case nil:
+			return nil
+		case []interface{}:
+			elements = v
+		case []map[string]interface{}:
+			elements = make([]interface{}, len(v))
+			for i, m := range v {
+				elements[i] = m
+			}
+		default:
+			return fmt.Errorf("run UNNEST error: expect an array but got %[1]T(%[1]v)", v)
+		}
+		if len(elements) == 0 {
+			return nil
+		}
+		rows := make([]xsql.TupleRow, 0, len(elements))
+		for _, e := range elements {
+			msg := make(xsql.Message, len(input.Message)+1)
+			for k, v := range input.Message {
+				msg[k] = v
+			}
+			msg[p.Alias] = e
+			rows = append(rows, &xsql.Tuple{Emitter: input.Emitter, Message: msg, Metadata: input.Metadata, Timestamp: input.Timestamp})
+		}
+		return rows
+	default:
+		return fmt.Errorf("run UNNEST error: invalid input %[1]T(%[1]v)", input)
+	}
+}
@@ -0,0 +1,77 @@
+// Copyright 2023 EMQ Technologies Co., Ltd.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package operator
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/lf-edge/ekuiper/internal/conf"
+	"github.com/lf-edge/ekuiper/internal/topo/context"
+	"github.com/lf-edge/ekuiper/internal/xsql"
+)
+
+func TestUnnest(t *testing.T) {
+	stmt, err := xsql.NewParser(strings.NewReader(`SELECT deviceId, r->value FROM demo CROSS JOIN UNNEST(readings) AS r`)).Parse()
+	require.NoError(t, err)
+	require.NotNil(t, stmt.Unnest)
+	contextLogger := conf.Log.WithField("rule", "TestUnnest")
+	ctx := context.WithValue(context.Background(), context.LoggerKey, contextLogger)
+	fv, afv := xsql.NewFunctionValuersForOp(ctx)
+	pp := &UnnestOp{Expr: stmt.Unnest.Expr, Alias: stmt.Unnest.Alias}
+	tests := []struct {
+		data   interface{}
+		result interface{}
+	}{
+		{
+			data: &xsql.Tuple{Emitter: "demo", Message: xsql.Message{"deviceId": "d1", "readings": []interface{}{
+				map[string]interface{}{"value": 1},
+				map[string]interface{}{"value": 2},
+			}}, Timestamp: 10},
+			result: []xsql.TupleRow{
+				&xsql.Tuple{Emitter: "demo", Message: xsql.Message{"deviceId": "d1", "readings": []interface{}{
+					map[string]interface{}{"value": 1},
+					map[string]interface{}{"value": 2},
+				}, "r": map[string]interface{}{"value": 1}}, Timestamp: 10},
+				&xsql.Tuple{Emitter: "demo", Message: xsql.Message{"deviceId": "d1", "readings": []interface{}{
+					map[string]interface{}{"value": 1},
+					map[string]interface{}{"value": 2},
+				}, "r": map[string]interface{}{"value": 2}}, Timestamp: 10},
+			},
+		},
+		{
+			data:   &xsql.Tuple{Emitter: "demo", Message: xsql.Message{"deviceId": "d2", "readings": []interface{}{}}},
+			result: nil,
+		},
+		{
+			data:   &xsql.Tuple{Emitter: "demo", Message: xsql.Message{"deviceId": "d3"}},
+			result: nil,
+		},
+		{
+			data:   &xsql.Tuple{Emitter: "demo", Message: xsql.Message{"deviceId": "d4", "readings": 3}},
+			result: errors.New("run UNNEST error: expect an array but got int(3)"),
+		},
+		{
+			data:   "invalid",
+			result: errors.New("run UNNEST error: invalid input string(invalid)"),
+		},
+	}
+	for i, tt := range tests {
+		require.Equal(t, tt.result, pp.Apply(ctx, tt.data, fv, afv), i)
+	}
+}
@@ -0,0 +1,65 @@
+// Copyright 2023 EMQ Technologies Co., Ltd.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package operator
+
+import (
+	"fmt"
+
+	"github.com/lf-edge/ekuiper/internal/xsql"
+	"github.com/lf-edge/ekuiper/pkg/api"
+	"github.com/lf-edge/ekuiper/pkg/ast"
+)
+
+// UnpivotOp turns the columns of each row into rows. Each row has the other fields of the original row with the
+// column name and the column value. The null columns are skipped
+type UnpivotOp struct {
+	Unpivot *ast.Unpivot
+}
+
+func (p *UnpivotOp) Apply(ctx api.StreamContext, data interface{}, _ *xsql.FunctionValuer, _ *xsql.AggregateFunctionValuer) interface{} {
+	ctx.GetLogger().Debugf("unpivot receive: %v", data)
+	switch input := data.(type) {
+	case error:
+		return input
+	case *xsql.Tuple:
+		base := make(xsql.Message, len(input.Message))
+		for k, v := range input.Message {
+			base[k] = v
+		}
+		for _, c := range p.Unpivot.Columns {
+			delete(base, c)
+		}
+		rows := make([]xsql.TupleRow, 0, len(p.Unpivot.Columns))
+		for _, c := range p.Unpivot.Columns {
+			v, ok := input.Message[c]
+			if !ok || v == nil {
+				continue
+			}
+			msg := make(xsql.Message, len(base)+2)
+			for k, bv := range base {
+				msg[k] = bv
+			}
+			msg[p.Unpivot.Name] = c
+			msg[p.Unpivot.Value] = v
+			rows = append(rows, &xsql.Tuple{Emitter: input.Emitter, Message: msg, Metadata: input.Metadata, Timestamp: input.Timestamp})
+		}
+		if len(rows) == 0 {
+			return nil
+		}
+		return rows
+	default:
+		return fmt.Errorf("run UNPIVOT error: invalid input %[1]T(%[1]v)", input)
+	}
+}
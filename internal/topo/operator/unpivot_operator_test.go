@@ -0,0 +1,66 @@
+// Copyright 2023 EMQ Technologies Co., Ltd.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package operator
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/lf-edge/ekuiper/internal/conf"
+	"github.com/lf-edge/ekuiper/internal/topo/context"
+	"github.com/lf-edge/ekuiper/internal/xsql"
+)
+
+func TestUnpivot(t *testing.T) {
+	stmt, err := xsql.NewParser(strings.NewReader(`SELECT ts, metric, value FROM demo UNPIVOT (value FOR metric IN (temp, hum))`)).Parse()
+	require.NoError(t, err)
+	require.NotNil(t, stmt.Unpivot)
+	contextLogger := conf.Log.WithField("rule", "TestUnpivot")
+	ctx := context.WithValue(context.Background(), context.LoggerKey, contextLogger)
+	fv, afv := xsql.NewFunctionValuersForOp(ctx)
+	pp := &UnpivotOp{Unpivot: stmt.Unpivot}
+	tests := []struct {
+		data   interface{}
+		result interface{}
+	}{
+		{
+			data: &xsql.Tuple{Emitter: "demo", Message: xsql.Message{"ts": 1, "temp": 20, "hum": 60}, Timestamp: 10},
+			result: []xsql.TupleRow{
+				&xsql.Tuple{Emitter: "demo", Message: xsql.Message{"ts": 1, "metric": "temp", "value": 20}, Timestamp: 10},
+				&xsql.Tuple{Emitter: "demo", Message: xsql.Message{"ts": 1, "metric": "hum", "value": 60}, Timestamp: 10},
+			},
+		},
+		{
+			data: &xsql.Tuple{Emitter: "demo", Message: xsql.Message{"ts": 2, "temp": 21, "hum": nil}},
+			result: []xsql.TupleRow{
+				&xsql.Tuple{Emitter: "demo", Message: xsql.Message{"ts": 2, "metric": "temp", "value": 21}},
+			},
+		},
+		{
+			data:   &xsql.Tuple{Emitter: "demo", Message: xsql.Message{"ts": 3}},
+			result: nil,
+		},
+		{
+			data:   "invalid",
+			result: errors.New("run UNPIVOT error: invalid input string(invalid)"),
+		},
+	}
+	for i, tt := range tests {
+		require.Equal(t, tt.result, pp.Apply(ctx, tt.data, fv, afv), i)
+	}
+}
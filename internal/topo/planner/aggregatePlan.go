@@ -19,6 +19,7 @@ import "github.com/lf-edge/ekuiper/pkg/ast"
 type AggregatePlan struct {
 	baseLogicalPlan
 	dimensions ast.Dimensions
+	pivot      *ast.Pivot
 }
 
 func (p AggregatePlan) Init() *AggregatePlan {
@@ -42,10 +43,35 @@ func (p *AggregatePlan) BuildExplainInfo() {
 		info += " }"
 	}
 
+	if p.pivot != nil {
+		info += p.pivot.String()
+	}
+
 	p.baseLogicalPlan.ExplainInfo.Info = info
 }
 
 func (p *AggregatePlan) PruneColumns(fields []ast.Expr) error {
 	f := getFields(p.dimensions)
+	if p.pivot != nil {
+		// the pivot columns are not from the source
+		pf := make([]ast.Expr, 0, len(fields))
+		for _, field := range fields {
+			if fr, ok := field.(*ast.FieldRef); ok && isPivotColumn(p.pivot, fr.Name) {
+				continue
+			}
+			pf = append(pf, field)
+		}
+		fields = append(pf, getFields(p.pivot.Agg)...)
+		f = append(f, getFields(p.pivot.For)...)
+	}
 	return p.baseLogicalPlan.PruneColumns(append(fields, f...))
 }
+
+func isPivotColumn(pivot *ast.Pivot, name string) bool {
+	for _, n := range pivot.Names {
+		if n == name {
+			return true
+		}
+	}
+	return false
+}
@@ -33,14 +33,21 @@ type streamInfo struct {
 
 // Analyze the select statement by decorating the info from stream statement.
 // Typically, set the correct stream name for fieldRefs
-func decorateStmt(s *ast.SelectStatement, store kv.KeyValue) ([]*streamInfo, []*ast.Call, []*ast.Call, error) {
+func decorateStmt(s *ast.SelectStatement, store kv.KeyValue, ctes map[string]*CTEPlan) ([]*streamInfo, []*ast.Call, []*ast.Call, error) {
 	streamsFromStmt := xsql.GetStreams(s)
 	streamStmts := make([]*streamInfo, len(streamsFromStmt))
 	isSchemaless := false
 	for i, s := range streamsFromStmt {
-		streamStmt, err := xsql.GetDataSource(store, s)
-		if err != nil {
-			return nil, nil, nil, fmt.Errorf("fail to get stream %s, please check if stream is created", s)
+		var streamStmt *ast.StreamStmt
+		if _, ok := ctes[s]; ok {
+			// the CTE is read as a schemaless stream
+			streamStmt = &ast.StreamStmt{Name: ast.StreamName(s), StreamType: ast.TypeStream, Options: &ast.Options{}}
+		} else {
+			var err error
+			streamStmt, err = xsql.GetDataSource(store, s)
+			if err != nil {
+				return nil, nil, nil, fmt.Errorf("fail to get stream %s, please check if stream is created", s)
+			}
 		}
 		si, err := convertStreamInfo(streamStmt)
 		if err != nil {
@@ -51,6 +58,10 @@ func decorateStmt(s *ast.SelectStatement, store kv.KeyValue) ([]*streamInfo, []*
 			isSchemaless = true
 		}
 	}
+	// the selected fields of MATCH_RECOGNIZE are the measures instead of the stream fields
+	if s.MatchRecognize != nil {
+		isSchemaless = true
+	}
 	if checkAliasReferenceCycle(s) {
 		return nil, nil, nil, fmt.Errorf("select fields have cycled alias")
 	}
@@ -71,6 +82,19 @@ func decorateStmt(s *ast.SelectStatement, store kv.KeyValue) ([]*streamInfo, []*
 				fieldsMap.reserve(field.Name, streamStmt.stmt.Name)
 			}
 		}
+		// the element of UNNEST and the columns of PIVOT and UNPIVOT are the fields of the FROM stream
+		if s.Unnest != nil {
+			fieldsMap.reserve(s.Unnest.Alias, streamStmts[0].stmt.Name)
+		}
+		if s.Pivot != nil {
+			for _, name := range s.Pivot.Names {
+				fieldsMap.reserve(name, streamStmts[0].stmt.Name)
+			}
+		}
+		if s.Unpivot != nil {
+			fieldsMap.reserve(s.Unpivot.Name, streamStmts[0].stmt.Name)
+			fieldsMap.reserve(s.Unpivot.Value, streamStmts[0].stmt.Name)
+		}
 	}
 	var (
 		walkErr            error
@@ -172,7 +196,7 @@ func decorateStmt(s *ast.SelectStatement, store kv.KeyValue) ([]*streamInfo, []*
 		case ast.Fields:
 			return false
 		case *ast.Call:
-			if function.IsAnalyticFunc(f.Name) {
+			if function.IsAnalyticFunc(f.Name) || f.Frame != nil {
 				f.CachedField = fmt.Sprintf("%s_%s_%d", function.AnalyticPrefix, f.Name, f.FuncId)
 				f.Cached = true
 				analyticFuncs = append(analyticFuncs, &ast.Call{
@@ -183,6 +207,8 @@ func decorateStmt(s *ast.SelectStatement, store kv.KeyValue) ([]*streamInfo, []*
 					CachedField: f.CachedField,
 					Partition:   f.Partition,
 					WhenExpr:    f.WhenExpr,
+					OrderBy:     f.OrderBy,
+					Frame:       f.Frame,
 				})
 			}
 		}
@@ -198,7 +224,7 @@ func decorateStmt(s *ast.SelectStatement, store kv.KeyValue) ([]*streamInfo, []*
 		ast.WalkFunc(&field, func(n ast.Node) bool {
 			switch f := n.(type) {
 			case *ast.Call:
-				if function.IsAnalyticFunc(f.Name) {
+				if function.IsAnalyticFunc(f.Name) || f.Frame != nil {
 					f.CachedField = fmt.Sprintf("%s_%s_%d", function.AnalyticPrefix, f.Name, f.FuncId)
 					f.Cached = true
 					calls = append([]*ast.Call{
@@ -210,6 +236,8 @@ func decorateStmt(s *ast.SelectStatement, store kv.KeyValue) ([]*streamInfo, []*
 							CachedField: f.CachedField,
 							Partition:   f.Partition,
 							WhenExpr:    f.WhenExpr,
+							OrderBy:     f.OrderBy,
+							Frame:       f.Frame,
 						},
 					}, calls...)
 				}
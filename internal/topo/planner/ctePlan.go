@@ -0,0 +1,48 @@
+// Copyright 2023 EMQ Technologies Co., Ltd.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package planner
+
+import (
+	"github.com/lf-edge/ekuiper/internal/topo/node"
+	"github.com/lf-edge/ekuiper/pkg/ast"
+)
+
+// CTEPlan is the result of a common table expression read like a stream. Its child is the plan of the CTE query
+type CTEPlan struct {
+	baseLogicalPlan
+	name string
+	// op is the built node shared by all the plans reading the CTE
+	op *node.CTENode
+}
+
+func (p CTEPlan) Init() *CTEPlan {
+	p.baseLogicalPlan.self = &p
+	p.baseLogicalPlan.setPlanType(CTE)
+	return &p
+}
+
+func (p *CTEPlan) BuildExplainInfo() {
+	p.baseLogicalPlan.ExplainInfo.Info = "Name:" + p.name
+}
+
+// PushDownPredicate the CTE may be shared by other plans, so the condition cannot be pushed into it
+func (p *CTEPlan) PushDownPredicate(condition ast.Expr) (ast.Expr, LogicalPlan) {
+	return condition, p
+}
+
+// PruneColumns the plan of the CTE query is already optimized and it outputs the selected fields only
+func (p *CTEPlan) PruneColumns(_ []ast.Expr) error {
+	return nil
+}
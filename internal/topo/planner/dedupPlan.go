@@ -0,0 +1,56 @@
+// Copyright 2023 EMQ Technologies Co., Ltd.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package planner
+
+import (
+	"strconv"
+	"strings"
+
+	"github.com/lf-edge/ekuiper/pkg/ast"
+)
+
+type DedupPlan struct {
+	baseLogicalPlan
+	keys []ast.Expr
+	// within is the duration in milliseconds to remember a key
+	within int64
+}
+
+func (p DedupPlan) Init() *DedupPlan {
+	p.baseLogicalPlan.self = &p
+	p.baseLogicalPlan.setPlanType(DEDUP)
+	return &p
+}
+
+func (p *DedupPlan) BuildExplainInfo() {
+	keys := make([]string, 0, len(p.keys))
+	for _, k := range p.keys {
+		keys = append(keys, k.String())
+	}
+	p.baseLogicalPlan.ExplainInfo.Info = "Keys:[ " + strings.Join(keys, ", ") + " ], Within:" + strconv.FormatInt(p.within, 10)
+}
+
+// PushDownPredicate the condition applies to the deduplicated rows. If pushed down, a duplicate would pass when the
+// first row is filtered out, so it cannot be pushed down
+func (p *DedupPlan) PushDownPredicate(condition ast.Expr) (ast.Expr, LogicalPlan) {
+	return condition, p
+}
+
+func (p *DedupPlan) PruneColumns(fields []ast.Expr) error {
+	for _, k := range p.keys {
+		fields = append(fields, getFields(k)...)
+	}
+	return p.baseLogicalPlan.PruneColumns(fields)
+}
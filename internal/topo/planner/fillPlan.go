@@ -0,0 +1,78 @@
+// Copyright 2023 EMQ Technologies Co., Ltd.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package planner
+
+import (
+	"strconv"
+	"strings"
+
+	"github.com/lf-edge/ekuiper/internal/xsql"
+	"github.com/lf-edge/ekuiper/pkg/ast"
+)
+
+type FillPlan struct {
+	baseLogicalPlan
+	mode string
+	// step is the duration in milliseconds between the starts of two successive windows
+	step int64
+	// maxGap is the max duration in milliseconds to fill since the last data of a group, 0 means no limit
+	maxGap int64
+	keys   []string
+	aggs   []string
+	starts []string
+	ends   []string
+}
+
+func (p FillPlan) Init() *FillPlan {
+	p.baseLogicalPlan.self = &p
+	p.baseLogicalPlan.setPlanType(FILL)
+	return &p
+}
+
+func (p *FillPlan) BuildExplainInfo() {
+	p.baseLogicalPlan.ExplainInfo.Info = "Mode:" + p.mode + ", Step:" + strconv.FormatInt(p.step, 10) + ", Keys:[ " + strings.Join(p.keys, ", ") + " ], Aggs:[ " + strings.Join(p.aggs, ", ") + " ]"
+}
+
+// newFillPlan classifies the select fields. The aggregate fields are filled, the window_start() and window_end()
+// fields are set to the range of the filled window and the other fields identify the groups.
+func newFillPlan(mode string, step, maxGap int64, fields ast.Fields) *FillPlan {
+	p := FillPlan{mode: mode, step: step, maxGap: maxGap}
+	for _, field := range fields {
+		expr, name := field.Expr, field.Name
+		if field.AName != "" {
+			name = field.AName
+			if fr, ok := expr.(*ast.FieldRef); ok && fr.AliasRef != nil {
+				expr = fr.AliasRef.Expression
+			}
+		}
+		if c, ok := expr.(*ast.Call); ok && (c.Name == "window_start" || c.Name == "window_end") {
+			if c.Name == "window_start" {
+				p.starts = append(p.starts, name)
+			} else {
+				p.ends = append(p.ends, name)
+			}
+			continue
+		}
+		if _, ok := expr.(*ast.Wildcard); ok {
+			continue
+		}
+		if xsql.IsAggregate(expr) {
+			p.aggs = append(p.aggs, name)
+		} else {
+			p.keys = append(p.keys, name)
+		}
+	}
+	return p.Init()
+}
@@ -0,0 +1,172 @@
+// Copyright 2021 EMQ Technologies Co., Ltd.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package planner
+
+import (
+	"fmt"
+
+	"github.com/lf-edge/ekuiper/internal/topo/node"
+	"github.com/lf-edge/ekuiper/pkg/ast"
+)
+
+// IntervalJoinPlan is the plan to join two streams without window. The rows are joined by the equi-join keys and the
+// time bound like `s1.ts BETWEEN (s2.ts - 10000) AND (s2.ts + 10000)`
+type IntervalJoinPlan struct {
+	baseLogicalPlan
+	from *ast.Table
+	join ast.Join
+	conf *node.IntervalJoinConf
+}
+
+// Init must run validateAndExtractCondition before this func
+func (p IntervalJoinPlan) Init() *IntervalJoinPlan {
+	p.baseLogicalPlan.self = &p
+	p.baseLogicalPlan.setPlanType(INTERVALJOIN)
+	return &p
+}
+
+func (p *IntervalJoinPlan) BuildExplainInfo() {
+	info := "Join:{ joinType:" + p.join.JoinType.String()
+	if p.join.Expr != nil {
+		info += ", expr:" + p.join.Expr.String()
+	}
+	info += fmt.Sprintf(", interval:[%d, %d] }", p.conf.Lower, p.conf.Upper)
+	p.baseLogicalPlan.ExplainInfo.Info = info
+}
+
+// PushDownPredicate the conditions are applied to the joined rows
+func (p *IntervalJoinPlan) PushDownPredicate(condition ast.Expr) (ast.Expr, LogicalPlan) {
+	return condition, p
+}
+
+func (p *IntervalJoinPlan) PruneColumns(fields []ast.Expr) error {
+	f := getFields(p.join)
+	return p.baseLogicalPlan.PruneColumns(append(fields, f...))
+}
+
+// validateAndExtractCondition makes sure the join condition has equi-join keys of the two streams and a time bound,
+// and extracts the other conditions to filter the joined rows
+func (p *IntervalJoinPlan) validateAndExtractCondition() bool {
+	// the rows of a self join cannot be told apart by the emitter
+	if p.join.JoinType != ast.INNER_JOIN || p.join.Expr == nil || p.join.Name == p.from.Name {
+		return false
+	}
+	c := &node.IntervalJoinConf{Left: p.from.Name, Right: p.join.Name}
+	equi, conditions := flatConditions(p.join.Expr)
+	var rest []ast.Expr
+	for _, e := range equi {
+		ls, rs := p.side(e.LHS), p.side(e.RHS)
+		switch {
+		case ls == 1 && rs == 2:
+			c.LeftKeys = append(c.LeftKeys, e.LHS)
+			c.RightKeys = append(c.RightKeys, e.RHS)
+		case ls == 2 && rs == 1:
+			c.LeftKeys = append(c.LeftKeys, e.RHS)
+			c.RightKeys = append(c.RightKeys, e.LHS)
+		default:
+			rest = append(rest, e)
+		}
+	}
+	bounded := false
+	for _, e := range conditions {
+		if !bounded && p.extractBound(e, c) {
+			bounded = true
+			continue
+		}
+		rest = append(rest, e)
+	}
+	if len(c.LeftKeys) == 0 || !bounded {
+		return false
+	}
+	for _, e := range rest {
+		c.Condition = combine(c.Condition, e)
+	}
+	p.conf = c
+	return true
+}
+
+// extractBound extracts the bound of the left time minus the right time from the BETWEEN condition
+func (p *IntervalJoinPlan) extractBound(e ast.Expr, c *node.IntervalJoinConf) bool {
+	be, ok := e.(*ast.BinaryExpr)
+	if !ok || be.OP != ast.BETWEEN {
+		return false
+	}
+	b, ok := be.RHS.(*ast.BetweenExpr)
+	if !ok {
+		return false
+	}
+	f, ok := be.LHS.(*ast.FieldRef)
+	if !ok {
+		return false
+	}
+	lf, lower, ok := timeOffset(b.Lower)
+	if !ok {
+		return false
+	}
+	hf, upper, ok := timeOffset(b.Higher)
+	if !ok || lf.StreamName != hf.StreamName || lf.Name != hf.Name || lower > upper {
+		return false
+	}
+	switch fs, ts := p.side(f), p.side(lf); {
+	case fs == 1 && ts == 2:
+		c.LeftTime, c.RightTime, c.Lower, c.Upper = f, lf, lower, upper
+	case fs == 2 && ts == 1:
+		c.LeftTime, c.RightTime, c.Lower, c.Upper = lf, f, -upper, -lower
+	default:
+		return false
+	}
+	return true
+}
+
+// timeOffset parses the expression of a field plus or minus an integer
+func timeOffset(e ast.Expr) (*ast.FieldRef, int64, bool) {
+	switch t := e.(type) {
+	case *ast.ParenExpr:
+		return timeOffset(t.Expr)
+	case *ast.FieldRef:
+		return t, 0, true
+	case *ast.BinaryExpr:
+		f, ok := t.LHS.(*ast.FieldRef)
+		if !ok {
+			return nil, 0, false
+		}
+		v, ok := t.RHS.(*ast.IntegerLiteral)
+		if !ok {
+			return nil, 0, false
+		}
+		switch t.OP {
+		case ast.ADD:
+			return f, int64(v.Val), true
+		case ast.SUB:
+			return f, -int64(v.Val), true
+		}
+	}
+	return nil, 0, false
+}
+
+// side returns 1 if the expression only refers to the left stream, 2 if only refers to the right stream, otherwise 0
+func (p *IntervalJoinPlan) side(e ast.Expr) int {
+	s, hasDefault := getRefSources(e)
+	if hasDefault || len(s) != 1 {
+		return 0
+	}
+	switch string(s[0]) {
+	case p.from.Name, p.from.Alias:
+		return 1
+	case p.join.Name, p.join.Alias:
+		return 2
+	}
+	return 0
+}
@@ -0,0 +1,83 @@
+// Copyright 2022 EMQ Technologies Co., Ltd.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package planner
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/lf-edge/ekuiper/internal/topo/node"
+	"github.com/lf-edge/ekuiper/internal/xsql"
+	"github.com/lf-edge/ekuiper/pkg/ast"
+)
+
+func TestIntervalJoinValidate(t *testing.T) {
+	ref := func(s, n string) *ast.FieldRef {
+		return &ast.FieldRef{StreamName: ast.StreamName(s), Name: n}
+	}
+	tests := []struct {
+		sql  string
+		v    bool
+		conf *node.IntervalJoinConf
+	}{
+		{ // 0
+			sql: `SELECT * FROM s1 INNER JOIN s2 ON s1.id = s2.id AND s1.ts BETWEEN (s2.ts - 10000) AND (s2.ts + 5000) AND s1.v > s2.v`,
+			v:   true,
+			conf: &node.IntervalJoinConf{
+				Left: "s1", Right: "s2",
+				LeftKeys: []ast.Expr{ref("s1", "id")}, RightKeys: []ast.Expr{ref("s2", "id")},
+				LeftTime: ref("s1", "ts"), RightTime: ref("s2", "ts"),
+				Lower: -10000, Upper: 5000,
+				Condition: &ast.BinaryExpr{OP: ast.GT, LHS: ref("s1", "v"), RHS: ref("s2", "v")},
+			},
+		},
+		{ // 1 the time bound of the right stream
+			sql: `SELECT * FROM s1 INNER JOIN s2 ON s2.ts BETWEEN (s1.ts - 1000) AND s1.ts AND s2.id = s1.id`,
+			v:   true,
+			conf: &node.IntervalJoinConf{
+				Left: "s1", Right: "s2",
+				LeftKeys: []ast.Expr{ref("s1", "id")}, RightKeys: []ast.Expr{ref("s2", "id")},
+				LeftTime: ref("s1", "ts"), RightTime: ref("s2", "ts"),
+				Lower: 0, Upper: 1000,
+			},
+		},
+		{ // 2 no time bound
+			sql: `SELECT * FROM s1 INNER JOIN s2 ON s1.id = s2.id`,
+		},
+		{ // 3 no key
+			sql: `SELECT * FROM s1 INNER JOIN s2 ON s1.ts BETWEEN (s2.ts - 1000) AND (s2.ts + 1000)`,
+		},
+		{ // 4 invalid bound
+			sql: `SELECT * FROM s1 INNER JOIN s2 ON s1.id = s2.id AND s1.ts BETWEEN (s2.ts + 1000) AND (s2.ts - 1000)`,
+		},
+		{ // 5 outer join
+			sql: `SELECT * FROM s1 LEFT JOIN s2 ON s1.id = s2.id AND s1.ts BETWEEN (s2.ts - 1000) AND (s2.ts + 1000)`,
+		},
+		{ // 6 self join
+			sql: `SELECT * FROM s1 AS a INNER JOIN s1 AS b ON a.id = b.id AND a.ts BETWEEN (b.ts - 1000) AND (b.ts + 1000)`,
+		},
+	}
+	for i, tt := range tests {
+		stmt, err := xsql.NewParser(strings.NewReader(tt.sql)).Parse()
+		require.NoError(t, err)
+		p := &IntervalJoinPlan{from: stmt.Sources[0].(*ast.Table), join: stmt.Joins[0]}
+		require.Equal(t, tt.v, p.validateAndExtractCondition(), "case %d", i)
+		if tt.v {
+			require.Equal(t, tt.conf, p.conf, "case %d", i)
+		}
+	}
+}
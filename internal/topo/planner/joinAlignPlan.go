@@ -14,11 +14,16 @@
 
 package planner
 
-import "github.com/lf-edge/ekuiper/pkg/ast"
+import (
+	"github.com/lf-edge/ekuiper/internal/topo/node"
+	"github.com/lf-edge/ekuiper/pkg/ast"
+)
 
 type JoinAlignPlan struct {
 	baseLogicalPlan
 	Emitters []string
+	// Temporals are the tables joined by FOR SYSTEM_TIME AS OF, nil if none
+	Temporals map[string]*node.TemporalTable
 }
 
 func (p *JoinAlignPlan) BuildExplainInfo() {
@@ -33,6 +38,11 @@ func (p *JoinAlignPlan) BuildExplainInfo() {
 		}
 		info += " ]"
 	}
+	for _, emitter := range p.Emitters {
+		if t, ok := p.Temporals[emitter]; ok {
+			info += ", AsOf:{ " + emitter + ": " + t.AsOf.String() + " }"
+		}
+	}
 	p.baseLogicalPlan.ExplainInfo.Info = info
 }
 
@@ -130,18 +130,27 @@ func (p *baseLogicalPlan) PruneColumns(fields []ast.Expr) error {
 type PlanType string
 
 const (
-	AGGREGATE     PlanType = "AggregatePlan"
-	ANALYTICFUNCS PlanType = "AnalyticFuncsPlan"
-	DATASOURCE    PlanType = "DataSourcePlan"
-	FILTER        PlanType = "FilterPlan"
-	HAVING        PlanType = "HavingPlan"
-	JOINALIGN     PlanType = "JoinAlignPlan"
-	JOIN          PlanType = "JoinPlan"
-	LOOKUP        PlanType = "LookupPlan"
-	ORDER         PlanType = "OrderPlan"
-	PROJECT       PlanType = "ProjectPlan"
-	PROJECTSET    PlanType = "ProjectSetPlan"
-	WINDOW        PlanType = "WindowPlan"
-	WINDOWFUNC    PlanType = "WindowFuncPlan"
-	WATERMARK     PlanType = "WatermarkPlan"
+	AGGREGATE      PlanType = "AggregatePlan"
+	ANALYTICFUNCS  PlanType = "AnalyticFuncsPlan"
+	CTE            PlanType = "CTEPlan"
+	DATASOURCE     PlanType = "DataSourcePlan"
+	DEDUP          PlanType = "DedupPlan"
+	FILL           PlanType = "FillPlan"
+	FILTER         PlanType = "FilterPlan"
+	HAVING         PlanType = "HavingPlan"
+	INTERVALJOIN   PlanType = "IntervalJoinPlan"
+	JOINALIGN      PlanType = "JoinAlignPlan"
+	JOIN           PlanType = "JoinPlan"
+	LOOKUP         PlanType = "LookupPlan"
+	MATCHRECOGNIZE PlanType = "MatchRecognizePlan"
+	ORDER          PlanType = "OrderPlan"
+	PROJECT        PlanType = "ProjectPlan"
+	PROJECTSET     PlanType = "ProjectSetPlan"
+	SUBQUERY       PlanType = "SubqueryPlan"
+	UNION          PlanType = "UnionPlan"
+	UNNEST         PlanType = "UnnestPlan"
+	UNPIVOT        PlanType = "UnpivotPlan"
+	WINDOW         PlanType = "WindowPlan"
+	WINDOWFUNC     PlanType = "WindowFuncPlan"
+	WATERMARK      PlanType = "WatermarkPlan"
 )
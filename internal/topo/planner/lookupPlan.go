@@ -17,6 +17,7 @@ package planner
 import (
 	"github.com/modern-go/reflect2"
 
+	"github.com/lf-edge/ekuiper/internal/topo/node"
 	"github.com/lf-edge/ekuiper/pkg/ast"
 )
 
@@ -29,6 +30,9 @@ type LookupPlan struct {
 	valvars    []ast.Expr
 	options    *ast.Options
 	conditions ast.Expr
+	// ranges are the range predicates of the table fields extracted from the conditions, which are still kept in
+	// the conditions to filter the rows after joining
+	ranges []*node.LookupRangeKey
 }
 
 // Init must run validateAndExtractCondition before this func
@@ -104,11 +108,12 @@ func extractLookupCondition(condition ast.Expr, tableName string) (unpushable as
 	return condition, nil
 }
 
-// validateAndExtractCondition Make sure the join condition is equi-join and extreact other conditions
+// validateAndExtractCondition Make sure the join condition has equi-join or range predicates and extreact other conditions
 func (p *LookupPlan) validateAndExtractCondition() bool {
 	equi, conditions := flatConditions(p.joinExpr.Expr)
-	// No equal predict condition found
-	if len(equi) == 0 {
+	p.extractRanges(conditions)
+	// No equal or range predict condition found
+	if len(equi) == 0 && len(p.ranges) == 0 {
 		return false
 	}
 	if len(conditions) > 0 {
@@ -174,7 +179,85 @@ func (p *LookupPlan) validateAndExtractCondition() bool {
 		}
 		return true
 	}
-	return false
+	return len(p.ranges) > 0
+}
+
+// extractRanges extracts the range predicates comparing a table field to an expression without the table fields,
+// including the BETWEEN of a table field or between two table fields
+func (p *LookupPlan) extractRanges(conditions []ast.Expr) {
+	for _, c := range conditions {
+		be, ok := c.(*ast.BinaryExpr)
+		if !ok {
+			continue
+		}
+		switch be.OP {
+		case ast.LT, ast.LTE, ast.GT, ast.GTE:
+			if f, ok := p.tableField(be.LHS); ok && !p.refersTable(be.RHS) {
+				p.addRange(f, be.OP, be.RHS)
+			} else if f, ok := p.tableField(be.RHS); ok && !p.refersTable(be.LHS) {
+				p.addRange(f, flipOp(be.OP), be.LHS)
+			}
+		case ast.BETWEEN:
+			b, ok := be.RHS.(*ast.BetweenExpr)
+			if !ok {
+				continue
+			}
+			if f, ok := p.tableField(be.LHS); ok {
+				if !p.refersTable(b.Lower) {
+					p.addRange(f, ast.GTE, b.Lower)
+				}
+				if !p.refersTable(b.Higher) {
+					p.addRange(f, ast.LTE, b.Higher)
+				}
+			} else if !p.refersTable(be.LHS) {
+				if f, ok := p.tableField(b.Lower); ok {
+					p.addRange(f, ast.LTE, be.LHS)
+				}
+				if f, ok := p.tableField(b.Higher); ok {
+					p.addRange(f, ast.GTE, be.LHS)
+				}
+			}
+		}
+	}
+}
+
+func (p *LookupPlan) addRange(field string, op ast.Token, val ast.Expr) {
+	p.ranges = append(p.ranges, &node.LookupRangeKey{Field: field, Op: op.String(), Val: val})
+}
+
+// tableField returns the field name if the expression is a field of the table
+func (p *LookupPlan) tableField(e ast.Expr) (string, bool) {
+	if f, ok := e.(*ast.FieldRef); ok && string(f.StreamName) == p.joinExpr.Name {
+		return f.Name, true
+	}
+	return "", false
+}
+
+func (p *LookupPlan) refersTable(e ast.Expr) bool {
+	refers := false
+	ast.WalkFunc(e, func(n ast.Node) bool {
+		if f, ok := n.(*ast.FieldRef); ok && string(f.StreamName) == p.joinExpr.Name {
+			refers = true
+		}
+		return !refers
+	})
+	return refers
+}
+
+// flipOp returns the operator with the operands swapped
+func flipOp(op ast.Token) ast.Token {
+	switch op {
+	case ast.LT:
+		return ast.GT
+	case ast.LTE:
+		return ast.GTE
+	case ast.GT:
+		return ast.LT
+	case ast.GTE:
+		return ast.LTE
+	default:
+		return op
+	}
 }
 
 // flatConditions flat the join condition. Only binary condition of EQ and AND are allowed
@@ -20,6 +20,7 @@ import (
 	"sort"
 	"testing"
 
+	"github.com/lf-edge/ekuiper/internal/topo/node"
 	"github.com/lf-edge/ekuiper/pkg/ast"
 )
 
@@ -30,6 +31,7 @@ func TestValidate(t *testing.T) {
 		c  ast.Expr
 		k  []string
 		vv []ast.Expr
+		r  []*node.LookupRangeKey
 	}{
 		{ // 0
 			p: &LookupPlan{
@@ -78,8 +80,21 @@ func TestValidate(t *testing.T) {
 					},
 				},
 			},
-			v: false,
-			c: nil,
+			v: true,
+			c: &ast.BinaryExpr{
+				OP: ast.GT,
+				LHS: &ast.FieldRef{
+					StreamName: "left",
+					Name:       "device_id",
+				},
+				RHS: &ast.FieldRef{
+					StreamName: "good",
+					Name:       "id",
+				},
+			},
+			r: []*node.LookupRangeKey{
+				{Field: "id", Op: "<", Val: &ast.FieldRef{StreamName: "left", Name: "device_id"}},
+			},
 		}, { // 2
 			p: &LookupPlan{
 				joinExpr: ast.Join{
@@ -295,6 +310,125 @@ func TestValidate(t *testing.T) {
 				},
 			},
 			v: false,
+		}, { // 8
+			p: &LookupPlan{
+				joinExpr: ast.Join{
+					Name:     "good",
+					JoinType: 0,
+					Expr: &ast.BinaryExpr{
+						OP: ast.EQ,
+						LHS: &ast.Call{
+							Name:     "meta",
+							FuncType: ast.FuncTypeScalar,
+							Args: []ast.Expr{
+								&ast.MetaRef{
+									StreamName: ast.DefaultStream,
+									Name:       "topic",
+								},
+							},
+						},
+						RHS: &ast.FieldRef{
+							StreamName: "good",
+							Name:       "topic",
+						},
+					},
+				},
+			},
+			v: true,
+			k: []string{
+				"topic",
+			},
+			vv: []ast.Expr{
+				&ast.Call{
+					Name:     "meta",
+					FuncType: ast.FuncTypeScalar,
+					Args: []ast.Expr{
+						&ast.MetaRef{
+							StreamName: ast.DefaultStream,
+							Name:       "topic",
+						},
+					},
+				},
+			},
+		}, { // 9
+			p: &LookupPlan{
+				joinExpr: ast.Join{
+					Name:     "good",
+					JoinType: 0,
+					Expr: &ast.BinaryExpr{
+						OP:  ast.BETWEEN,
+						LHS: &ast.FieldRef{StreamName: "left", Name: "temp"},
+						RHS: &ast.BetweenExpr{
+							Lower:  &ast.FieldRef{StreamName: "good", Name: "low"},
+							Higher: &ast.FieldRef{StreamName: "good", Name: "high"},
+						},
+					},
+				},
+			},
+			v: true,
+			c: &ast.BinaryExpr{
+				OP:  ast.BETWEEN,
+				LHS: &ast.FieldRef{StreamName: "left", Name: "temp"},
+				RHS: &ast.BetweenExpr{
+					Lower:  &ast.FieldRef{StreamName: "good", Name: "low"},
+					Higher: &ast.FieldRef{StreamName: "good", Name: "high"},
+				},
+			},
+			r: []*node.LookupRangeKey{
+				{Field: "low", Op: "<=", Val: &ast.FieldRef{StreamName: "left", Name: "temp"}},
+				{Field: "high", Op: ">=", Val: &ast.FieldRef{StreamName: "left", Name: "temp"}},
+			},
+		}, { // 10
+			p: &LookupPlan{
+				joinExpr: ast.Join{
+					Name:     "good",
+					JoinType: 0,
+					Expr: &ast.BinaryExpr{
+						OP: ast.AND,
+						LHS: &ast.BinaryExpr{
+							OP:  ast.EQ,
+							LHS: &ast.FieldRef{StreamName: "left", Name: "device_id"},
+							RHS: &ast.FieldRef{StreamName: "good", Name: "id"},
+						},
+						RHS: &ast.BinaryExpr{
+							OP:  ast.BETWEEN,
+							LHS: &ast.FieldRef{StreamName: "good", Name: "ts"},
+							RHS: &ast.BetweenExpr{
+								Lower:  &ast.IntegerLiteral{Val: 10},
+								Higher: &ast.FieldRef{StreamName: "left", Name: "ts"},
+							},
+						},
+					},
+				},
+			},
+			v: true,
+			c: &ast.BinaryExpr{
+				OP:  ast.BETWEEN,
+				LHS: &ast.FieldRef{StreamName: "good", Name: "ts"},
+				RHS: &ast.BetweenExpr{
+					Lower:  &ast.IntegerLiteral{Val: 10},
+					Higher: &ast.FieldRef{StreamName: "left", Name: "ts"},
+				},
+			},
+			k:  []string{"id"},
+			vv: []ast.Expr{&ast.FieldRef{StreamName: "left", Name: "device_id"}},
+			r: []*node.LookupRangeKey{
+				{Field: "ts", Op: ">=", Val: &ast.IntegerLiteral{Val: 10}},
+				{Field: "ts", Op: "<=", Val: &ast.FieldRef{StreamName: "left", Name: "ts"}},
+			},
+		}, { // 11
+			p: &LookupPlan{
+				joinExpr: ast.Join{
+					Name:     "good",
+					JoinType: 0,
+					Expr: &ast.BinaryExpr{
+						OP:  ast.LT,
+						LHS: &ast.FieldRef{StreamName: "good", Name: "id"},
+						RHS: &ast.FieldRef{StreamName: "good", Name: "max"},
+					},
+				},
+			},
+			v: false,
 		},
 	}
 	fmt.Printf("The test bucket size is %d.\n\n", len(tests))
@@ -317,6 +451,9 @@ func TestValidate(t *testing.T) {
 			if !reflect.DeepEqual(tt.vv, tt.p.valvars) {
 				t.Errorf("case %d: expect val vars %v but got %v", i, tt.vv, tt.p.valvars)
 			}
+			if !reflect.DeepEqual(tt.r, tt.p.ranges) {
+				t.Errorf("case %d: expect ranges %v but got %v", i, tt.r, tt.p.ranges)
+			}
 		}
 	}
 }
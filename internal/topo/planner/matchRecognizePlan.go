@@ -0,0 +1,99 @@
+// Copyright 2022 EMQ Technologies Co., Ltd.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package planner
+
+import (
+	"strings"
+
+	"github.com/lf-edge/ekuiper/pkg/ast"
+)
+
+type MatchRecognizePlan struct {
+	baseLogicalPlan
+	match *ast.MatchRecognize
+}
+
+func (p MatchRecognizePlan) Init() *MatchRecognizePlan {
+	p.baseLogicalPlan.self = &p
+	p.baseLogicalPlan.setPlanType(MATCHRECOGNIZE)
+	return &p
+}
+
+func (p *MatchRecognizePlan) BuildExplainInfo() {
+	info := ""
+	if p.match.Partition != nil {
+		info += p.match.Partition.String() + ", "
+	}
+	vars := make([]string, 0, len(p.match.Pattern))
+	for _, v := range p.match.Pattern {
+		vars = append(vars, v.String())
+	}
+	info += "Pattern:[ " + strings.Join(vars, " ") + " ]"
+	if len(p.match.Measures) > 0 {
+		measures := make([]string, 0, len(p.match.Measures))
+		for _, f := range p.match.Measures {
+			measures = append(measures, f.Name)
+		}
+		info += ", Measures:[ " + strings.Join(measures, ", ") + " ]"
+	}
+	p.baseLogicalPlan.ExplainInfo.Info = info
+}
+
+// PushDownPredicate the condition applies to the matches so that it cannot be pushed down
+func (p *MatchRecognizePlan) PushDownPredicate(condition ast.Expr) (ast.Expr, LogicalPlan) {
+	return condition, p
+}
+
+// PruneColumns the measures are produced by this op, and the fields referred by the pattern variables are read from the
+// input rows
+func (p *MatchRecognizePlan) PruneColumns(fields []ast.Expr) error {
+	measures := make(map[string]struct{}, len(p.match.Measures))
+	for _, f := range p.match.Measures {
+		measures[f.Name] = struct{}{}
+	}
+	var result []ast.Expr
+	for _, f := range fields {
+		if fr, ok := f.(*ast.FieldRef); ok {
+			if _, ok := measures[fr.Name]; ok {
+				continue
+			}
+		}
+		result = append(result, f)
+	}
+	var exprs []ast.Expr
+	if p.match.Partition != nil {
+		exprs = append(exprs, p.match.Partition.Exprs...)
+	}
+	for _, f := range p.match.Measures {
+		exprs = append(exprs, f.Expr)
+	}
+	for _, d := range p.match.Defines {
+		exprs = append(exprs, d.Condition)
+	}
+	for _, e := range exprs {
+		ast.WalkFunc(e, func(n ast.Node) bool {
+			switch f := n.(type) {
+			case *ast.FieldRef:
+				if f.Name != "" {
+					result = append(result, &ast.FieldRef{StreamName: ast.DefaultStream, Name: f.Name})
+				}
+			case *ast.Wildcard:
+				result = append(result, f)
+			}
+			return true
+		})
+	}
+	return p.baseLogicalPlan.PruneColumns(result)
+}
@@ -0,0 +1,174 @@
+// Copyright 2023 EMQ Technologies Co., Ltd.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package planner
+
+import (
+	"fmt"
+
+	"github.com/lf-edge/ekuiper/internal/binder/function"
+	"github.com/lf-edge/ekuiper/internal/xsql"
+	"github.com/lf-edge/ekuiper/pkg/api"
+	"github.com/lf-edge/ekuiper/pkg/ast"
+)
+
+const paneFieldPrefix = "$$pane"
+
+// paneFuncs are the decomposable aggregate functions whose results can be merged from the partial results of panes
+var paneFuncs = map[string]bool{
+	"sum":   true,
+	"count": true,
+	"min":   true,
+	"max":   true,
+	"avg":   true,
+	"topn":  true,
+}
+
+// extractPaneAggs finds out whether the hopping window, or the tumbling window with rollup or topn, can be aggregated
+// incrementally by panes. The window op then keeps the partial results of the aggregate functions for each pane and
+// group instead of the tuples, and emits one row for each group with the merged results in the cached fields. It is
+// only possible when all the clauses after the window only refer to the decomposable aggregate functions and the group
+// by fields. Once possible, the aggregate calls are marked as cached so that the later ops read the merged results.
+// For topn, only the n largest values are kept for each group so that the window does not buffer the tuples.
+func extractPaneAggs(stmt *ast.SelectStatement, w *ast.Window, opt *api.RuleOption) ([]*ast.Call, []*ast.FieldRef) {
+	// the plain tumbling window is only run by panes for topn
+	plain := false
+	switch w.WindowType {
+	case ast.TUMBLING_WINDOW:
+		if w.TriggerCondition != nil {
+			return nil, nil
+		}
+		plain = len(w.Rollup) == 0
+	case ast.HOPPING_WINDOW:
+		if w.Interval == nil || w.Length.Val <= w.Interval.Val {
+			return nil, nil
+		}
+	default:
+		return nil, nil
+	}
+	if len(stmt.Sources) != 1 || len(stmt.Joins) > 0 || stmt.Pivot != nil || opt.AllowedLateness > 0 {
+		return nil, nil
+	}
+	// the condition is run after the window in event time
+	if opt.IsEventTime && stmt.Condition != nil {
+		return nil, nil
+	}
+	var keys []*ast.FieldRef
+	for _, d := range stmt.Dimensions {
+		if _, ok := d.Expr.(*ast.Window); ok {
+			continue
+		}
+		fr, ok := d.Expr.(*ast.FieldRef)
+		if !ok || fr.IsAlias() {
+			return nil, nil
+		}
+		keys = append(keys, fr)
+	}
+	var (
+		calls    []*ast.Call
+		seen     = make(map[*ast.Call]bool)
+		eligible = true
+		hasTopN  = false
+	)
+	visit := func(n ast.Node) bool {
+		if !eligible {
+			return false
+		}
+		switch f := n.(type) {
+		case *ast.Call:
+			if f.FuncType == ast.FuncTypeAgg {
+				if !paneFuncs[f.Name] || len(f.Args) != paneArgs(f) || f.Partition != nil || f.WhenExpr != nil || f.Frame != nil || !isPaneArg(f.Args[0]) {
+					eligible = false
+					return false
+				}
+				if f.Name == "topn" {
+					if _, ok := f.Args[0].(*ast.Wildcard); ok {
+						eligible = false
+						return false
+					}
+					hasTopN = true
+				}
+				// the field of an alias is also walked by its references
+				if !seen[f] {
+					seen[f] = true
+					calls = append(calls, f)
+				}
+				return false
+			}
+			if f.FuncType == ast.FuncTypeCols || f.FuncType == ast.FuncTypeWindow || function.IsAnalyticFunc(f.Name) || xsql.ImplicitStateFuncs[f.Name] || f.Name == "event_time" {
+				eligible = false
+			}
+		case *ast.FieldRef:
+			if !f.IsAlias() && !isPaneKey(keys, f) {
+				eligible = false
+			}
+		case *ast.Wildcard, *ast.MetaRef:
+			eligible = false
+		}
+		return eligible
+	}
+	ast.WalkFunc(stmt.Fields, visit)
+	ast.WalkFunc(stmt.Having, visit)
+	ast.WalkFunc(stmt.SortFields, visit)
+	if !eligible || len(calls) == 0 || (plain && !hasTopN) {
+		return nil, nil
+	}
+	for _, c := range calls {
+		c.Cached = true
+		c.CachedField = fmt.Sprintf("%s_%s_%d", paneFieldPrefix, c.Name, c.FuncId)
+	}
+	return calls, keys
+}
+
+// paneArgs returns the count of the args of the aggregate function. The count of the values to keep for topn is
+// validated to be a positive int literal
+func paneArgs(f *ast.Call) int {
+	if f.Name == "topn" {
+		return 2
+	}
+	return 1
+}
+
+// isPaneArg returns whether the arg of the aggregate function can be evaluated against each tuple when added to a pane
+func isPaneArg(arg ast.Expr) bool {
+	if _, ok := arg.(*ast.Wildcard); ok {
+		return true
+	}
+	valid := true
+	ast.WalkFunc(arg, func(n ast.Node) bool {
+		switch f := n.(type) {
+		case *ast.Call:
+			if f.FuncType != ast.FuncTypeScalar || function.IsAnalyticFunc(f.Name) || xsql.ImplicitStateFuncs[f.Name] || f.Name == "window_start" || f.Name == "window_end" || f.Name == "event_time" {
+				valid = false
+			}
+		case *ast.Wildcard:
+			valid = false
+		case *ast.FieldRef:
+			if f.IsAlias() {
+				valid = false
+			}
+		}
+		return valid
+	})
+	return valid
+}
+
+func isPaneKey(keys []*ast.FieldRef, f *ast.FieldRef) bool {
+	for _, k := range keys {
+		if k.Name == f.Name && k.StreamName == f.StreamName {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,160 @@
+// Copyright 2023 EMQ Technologies Co., Ltd.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package planner
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/lf-edge/ekuiper/internal/pkg/store"
+	"github.com/lf-edge/ekuiper/internal/xsql"
+	"github.com/lf-edge/ekuiper/pkg/api"
+	"github.com/lf-edge/ekuiper/pkg/ast"
+)
+
+func TestExtractPaneAggs(t *testing.T) {
+	kv, err := store.GetKV("stream")
+	require.NoError(t, err)
+	s, err := json.Marshal(&xsql.StreamInfo{
+		StreamType: ast.TypeStream,
+		Statement:  `CREATE STREAM demo () WITH (DATASOURCE="demo", FORMAT="json", KEY="ts");`,
+	})
+	require.NoError(t, err)
+	require.NoError(t, kv.Set("demo", string(s)))
+	tests := []struct {
+		sql   string
+		opt   *api.RuleOption
+		calls []string
+		keys  int
+	}{
+		{ // 0
+			sql:   `SELECT deviceId, count(*), avg(temp) AS a, max(temp) + 1 FROM demo GROUP BY deviceId, HOPPINGWINDOW(ss, 60, 10) HAVING a > 20 ORDER BY deviceId`,
+			calls: []string{"$$pane_count_0", "$$pane_avg_1", "$$pane_max_2"},
+			keys:  1,
+		},
+		{ // 1 the condition is run before the window in processing time
+			sql:   `SELECT sum(temp * 2) FROM demo WHERE temp > 0 GROUP BY HOPPINGWINDOW(ss, 60, 10)`,
+			calls: []string{"$$pane_sum_0"},
+		},
+		{ // 2 the condition is run after the window in event time
+			sql: `SELECT sum(temp) FROM demo WHERE temp > 0 GROUP BY HOPPINGWINDOW(ss, 60, 10)`,
+			opt: &api.RuleOption{IsEventTime: true},
+		},
+		{ // 3 not decomposable
+			sql: `SELECT sum(temp), collect(temp) FROM demo GROUP BY HOPPINGWINDOW(ss, 60, 10)`,
+		},
+		{ // 4 refer to the field not grouped
+			sql: `SELECT deviceId, sum(temp) FROM demo GROUP BY HOPPINGWINDOW(ss, 60, 10)`,
+		},
+		{ // 5 wildcard
+			sql: `SELECT *, count(*) FROM demo GROUP BY HOPPINGWINDOW(ss, 60, 10)`,
+		},
+		{ // 6 no overlap
+			sql: `SELECT count(*) FROM demo GROUP BY HOPPINGWINDOW(ss, 10, 10)`,
+		},
+		{ // 7 not hopping window
+			sql: `SELECT count(*) FROM demo GROUP BY SLIDINGWINDOW(ss, 10)`,
+		},
+		{ // 8 the late tuples re-fire the windows by the tuples
+			sql: `SELECT count(*) FROM demo GROUP BY HOPPINGWINDOW(ss, 60, 10)`,
+			opt: &api.RuleOption{IsEventTime: true, AllowedLateness: 1000},
+		},
+		{ // 9 the implicit state function
+			sql: `SELECT count(*), last_agg_hit_count() AS lc FROM demo GROUP BY HOPPINGWINDOW(ss, 60, 10)`,
+		},
+		{ // 10 the tumbling window with rollup
+			sql:   `SELECT deviceId, sum(temp) FROM demo GROUP BY deviceId, TUMBLINGWINDOW(mi, 1) ROLLUP(hh, dd)`,
+			calls: []string{"$$pane_sum_0"},
+			keys:  1,
+		},
+		{ // 11 the tumbling window without rollup
+			sql: `SELECT sum(temp) FROM demo GROUP BY TUMBLINGWINDOW(mi, 1)`,
+		},
+		{ // 12 the tumbling window with topn
+			sql:   `SELECT deviceId, topn(temp, 3) AS t, count(*) FROM demo GROUP BY deviceId, TUMBLINGWINDOW(mi, 1)`,
+			calls: []string{"$$pane_topn_0", "$$pane_count_1"},
+			keys:  1,
+		},
+		{ // 13 the hopping window with topn
+			sql:   `SELECT topn(temp * 2, 3) FROM demo GROUP BY HOPPINGWINDOW(ss, 60, 10)`,
+			calls: []string{"$$pane_topn_0"},
+		},
+		{ // 14 the tumbling window with trigger condition
+			sql: `SELECT topn(temp, 3) FROM demo GROUP BY TUMBLINGWINDOW(mi, 1) OVER (WHEN temp > 20)`,
+		},
+		{ // 15 topn of the wildcard
+			sql: `SELECT topn(*, 3) FROM demo GROUP BY TUMBLINGWINDOW(mi, 1)`,
+		},
+	}
+	for i, tt := range tests {
+		stmt, err := xsql.NewParser(strings.NewReader(tt.sql)).Parse()
+		require.NoError(t, err, "case %d", i)
+		// resolve the aliases and streams like the planner
+		_, _, _, err = decorateStmt(stmt, kv, nil)
+		require.NoError(t, err, "case %d", i)
+		opt := tt.opt
+		if opt == nil {
+			opt = &api.RuleOption{}
+		}
+		calls, keys := extractPaneAggs(stmt, stmt.Dimensions.GetWindow(), opt)
+		require.Len(t, calls, len(tt.calls), "case %d", i)
+		for j, c := range calls {
+			require.True(t, c.Cached, "case %d", i)
+			require.Equal(t, tt.calls[j], c.CachedField, "case %d", i)
+		}
+		require.Len(t, keys, tt.keys, "case %d", i)
+	}
+}
+
+func TestValidateRollup(t *testing.T) {
+	tests := []struct {
+		sql   string
+		tiers []ast.Token
+		err   string
+	}{
+		{
+			sql:   `SELECT count(*) FROM demo GROUP BY TUMBLINGWINDOW(mi, 5) ROLLUP(hh, dd)`,
+			tiers: []ast.Token{ast.HH, ast.DD},
+		},
+		{
+			sql: `SELECT count(*) FROM demo GROUP BY TUMBLINGWINDOW(mi, 7) ROLLUP(hh)`,
+			err: "the rollup tier HH must be a multiple of the window length or the previous tier",
+		},
+		{
+			sql: `SELECT count(*) FROM demo GROUP BY TUMBLINGWINDOW(hh, 2) ROLLUP(hh)`,
+			err: "the rollup tier HH must be a multiple of the window length or the previous tier",
+		},
+		{
+			sql: `SELECT count(*) FROM demo GROUP BY TUMBLINGWINDOW(ss, 10) ROLLUP(dd, hh)`,
+			err: "the rollup tier HH must be a multiple of the window length or the previous tier",
+		},
+	}
+	for i, tt := range tests {
+		stmt, err := xsql.NewParser(strings.NewReader(tt.sql)).Parse()
+		require.NoError(t, err, "case %d", i)
+		w := stmt.Dimensions.GetWindow()
+		wp := WindowPlan{wtype: w.WindowType, length: w.Length.Val, timeUnit: w.TimeUnit.Val}.Init()
+		err = validateRollup(wp, w.Rollup)
+		if tt.err != "" {
+			require.EqualError(t, err, tt.err, "case %d", i)
+			continue
+		}
+		require.NoError(t, err, "case %d", i)
+		require.Equal(t, tt.tiers, wp.rollup, "case %d", i)
+	}
+}
@@ -15,6 +15,7 @@
 package planner
 
 import (
+	"encoding/json"
 	"errors"
 	"fmt"
 
@@ -39,12 +40,23 @@ func Plan(rule *api.Rule) (*topo.Topo, error) {
 
 // PlanSQLWithSourcesAndSinks For test only
 func PlanSQLWithSourcesAndSinks(rule *api.Rule, sources []*node.SourceNode, sinks []*node.SinkNode) (*topo.Topo, error) {
-	sql := rule.Sql
+	stmt, lp, err := createLogicalPlanFromRule(rule)
+	if err != nil {
+		return nil, err
+	}
+	tp, err := createTopo(rule, lp, sources, sinks, xsql.GetStreams(stmt))
+	if err != nil {
+		return nil, err
+	}
+	return tp, nil
+}
 
+// createLogicalPlanFromRule parses and validates the sql of the rule and creates the optimized logical plan
+func createLogicalPlanFromRule(rule *api.Rule) (*ast.SelectStatement, LogicalPlan, error) {
 	conf.Log.Infof("Init rule with options %+v", rule.Options)
-	stmt, err := xsql.GetStatementFromSql(sql)
+	stmt, err := xsql.GetStatementFromSql(rule.Sql)
 	if err != nil {
-		return nil, err
+		return nil, nil, err
 	}
 	// validation
 	streamsFromStmt := xsql.GetStreams(stmt)
@@ -52,22 +64,18 @@ func PlanSQLWithSourcesAndSinks(rule *api.Rule, sources []*node.SourceNode, sink
 	//	return nil, fmt.Errorf("Invalid parameter sources or streams, the length cannot match the statement, expect %d sources.", len(streamsFromStmt))
 	//}
 	if rule.Options.SendMetaToSink && (len(streamsFromStmt) > 1 || stmt.Dimensions != nil) {
-		return nil, fmt.Errorf("Invalid option sendMetaToSink, it can not be applied to window")
+		return nil, nil, fmt.Errorf("Invalid option sendMetaToSink, it can not be applied to window")
 	}
 	store, err := store2.GetKV("stream")
 	if err != nil {
-		return nil, err
+		return nil, nil, err
 	}
 	// Create the logical plan and optimize. Logical plans are a linked list
 	lp, err := createLogicalPlan(stmt, rule.Options, store)
 	if err != nil {
-		return nil, err
+		return nil, nil, err
 	}
-	tp, err := createTopo(rule, lp, sources, sinks, streamsFromStmt)
-	if err != nil {
-		return nil, err
-	}
-	return tp, nil
+	return stmt, lp, nil
 }
 
 func createTopo(rule *api.Rule, lp LogicalPlan, sources []*node.SourceNode, sinks []*node.SinkNode, streamsFromStmt []string) (*topo.Topo, error) {
@@ -94,7 +102,16 @@ func createTopo(rule *api.Rule, lp LogicalPlan, sources []*node.SourceNode, sink
 				if !ok {
 					return nil, fmt.Errorf("expect map[string]interface{} type for the action properties, but found %v", action)
 				}
-				tp.AddSink(inputs, node.NewSinkNode(fmt.Sprintf("%s_%d", name, i), name, props))
+				sinkInputs := inputs
+				// the action receives the late events beyond the allowed lateness instead of the rule results
+				if late, _ := props["lateData"].(bool); late {
+					wp := findWatermarkPlan(lp)
+					if wp == nil {
+						return nil, fmt.Errorf("action %s receives the late data but the rule is not in event time", name)
+					}
+					sinkInputs = []api.Emitter{wp.op.GetLateEmitter()}
+				}
+				tp.AddSink(sinkInputs, node.NewSinkNode(fmt.Sprintf("%s_%d", name, i), name, props))
 			}
 		}
 	}
@@ -103,25 +120,7 @@ func createTopo(rule *api.Rule, lp LogicalPlan, sources []*node.SourceNode, sink
 }
 
 func GetExplainInfoFromLogicalPlan(rule *api.Rule) (string, error) {
-	sql := rule.Sql
-
-	conf.Log.Infof("Init rule with options %+v", rule.Options)
-	stmt, err := xsql.GetStatementFromSql(sql)
-	if err != nil {
-		return "", err
-	}
-	// validation
-	streamsFromStmt := xsql.GetStreams(stmt)
-
-	if rule.Options.SendMetaToSink && (len(streamsFromStmt) > 1 || stmt.Dimensions != nil) {
-		return "", fmt.Errorf("invalid option sendMetaToSink, it can not be applied to window")
-	}
-	store, err := store2.GetKV("stream")
-	if err != nil {
-		return "", err
-	}
-	// Create logical plan and optimize. Logical plans are a linked list
-	lp, err := createLogicalPlan(stmt, rule.Options, store)
+	_, lp, err := createLogicalPlanFromRule(rule)
 	if err != nil {
 		return "", err
 	}
@@ -156,7 +155,71 @@ func GetExplainInfoFromLogicalPlan(rule *api.Rule) (string, error) {
 	return res, nil
 }
 
+// PhysicalPlan is the plan of a rule built without running it. The plans are the optimized logical plans which
+// show the join types, the pushed down filters and the windows. The topo is the DAG of the operator nodes.
+type PhysicalPlan struct {
+	Plans []json.RawMessage  `json:"plans,omitempty"`
+	Topo  *api.PrintableTopo `json:"topo"`
+}
+
+// ExplainRule plans the rule without starting it. The graph rule only has the topo.
+func ExplainRule(rule *api.Rule) (*PhysicalPlan, error) {
+	if rule.Sql == "" {
+		tp, err := PlanByGraph(rule)
+		if err != nil {
+			return nil, err
+		}
+		return &PhysicalPlan{Topo: tp.GetTopo()}, nil
+	}
+	stmt, lp, err := createLogicalPlanFromRule(rule)
+	if err != nil {
+		return nil, err
+	}
+	// the plans are listed in pre-order, the plan read by multiple plans like the CTE is listed once
+	var (
+		plans   []json.RawMessage
+		visited = make(map[LogicalPlan]bool)
+		id      int64
+		setId   func(p LogicalPlan)
+	)
+	setId = func(p LogicalPlan) {
+		if visited[p] {
+			return
+		}
+		visited[p] = true
+		p.SetID(id)
+		id++
+		for _, c := range p.Children() {
+			setId(c)
+		}
+	}
+	setId(lp)
+	visited = make(map[LogicalPlan]bool)
+	var explain func(p LogicalPlan)
+	explain = func(p LogicalPlan) {
+		if visited[p] {
+			return
+		}
+		visited[p] = true
+		p.BuildExplainInfo()
+		plans = append(plans, json.RawMessage(p.Explain()))
+		for _, c := range p.Children() {
+			explain(c)
+		}
+	}
+	explain(lp)
+	tp, err := createTopo(rule, lp, nil, nil, xsql.GetStreams(stmt))
+	if err != nil {
+		return nil, err
+	}
+	return &PhysicalPlan{Plans: plans, Topo: tp.GetTopo()}, nil
+}
+
 func buildOps(lp LogicalPlan, tp *topo.Topo, options *api.RuleOption, sources []*node.SourceNode, streamsFromStmt []string, index int) (api.Emitter, int, error) {
+	// the CTE read by multiple plans is built once
+	if cp, ok := lp.(*CTEPlan); ok && cp.op != nil {
+		return cp.op, index, nil
+	}
 	var inputs []api.Emitter
 	newIndex := index
 	for _, c := range lp.Children() {
@@ -171,6 +234,8 @@ func buildOps(lp LogicalPlan, tp *topo.Topo, options *api.RuleOption, sources []
 	var (
 		op  api.Emitter
 		err error
+		// single is set for the operators which keep their state across rows, so they must run in one worker
+		single bool
 	)
 	switch t := lp.(type) {
 	case *DataSourcePlan:
@@ -182,9 +247,33 @@ func buildOps(lp LogicalPlan, tp *topo.Topo, options *api.RuleOption, sources []
 		inputs = []api.Emitter{srcNode}
 		op = srcNode
 	case *WatermarkPlan:
-		op = node.NewWatermarkOp(fmt.Sprintf("%d_watermark", newIndex), t.SendWatermark, t.Emitters, options)
+		t.op = node.NewWatermarkOp(fmt.Sprintf("%d_watermark", newIndex), t.SendWatermark, t.Emitters, options)
+		op = t.op
+	case *CTEPlan:
+		t.op = node.NewCTENode(fmt.Sprintf("%d_cte", newIndex), t.name, options)
+		op = t.op
+	case *UnionPlan:
+		op = Transform(&operator.UnionOp{Emitter: t.emitter}, fmt.Sprintf("%d_union", newIndex), options)
+	case *UnnestPlan:
+		op = Transform(&operator.UnnestOp{Expr: t.unnest.Expr, Alias: t.unnest.Alias}, fmt.Sprintf("%d_unnest", newIndex), options)
+	case *UnpivotPlan:
+		op = Transform(&operator.UnpivotOp{Unpivot: t.unpivot}, fmt.Sprintf("%d_unpivot", newIndex), options)
+	case *DedupPlan:
+		op = Transform(&operator.DedupOp{Keys: t.keys, Within: t.within}, fmt.Sprintf("%d_dedup", newIndex), options)
+		single = true
+	case *MatchRecognizePlan:
+		l, err := convertMatchWithin(t.match)
+		if err != nil {
+			return nil, 0, err
+		}
+		op = Transform(&operator.MatchRecognizeOp{Match: t.match, Within: l}, fmt.Sprintf("%d_match", newIndex), options)
+		single = true
+	case *SubqueryPlan:
+		op, err = node.NewSubqueryNode(fmt.Sprintf("%d_subquery", newIndex), t.subqueries, options)
 	case *AnalyticFuncsPlan:
-		op = Transform(&operator.AnalyticFuncsOp{Funcs: t.funcs, FieldFuncs: t.fieldFuncs}, fmt.Sprintf("%d_analytic", newIndex), options)
+		aop := &operator.AnalyticFuncsOp{Funcs: t.funcs, FieldFuncs: t.fieldFuncs}
+		op = Transform(aop, fmt.Sprintf("%d_analytic", newIndex), options)
+		single = aop.HasFrame()
 	case *WindowPlan:
 		if t.condition != nil {
 			wfilterOp := Transform(&operator.FilterOp{Condition: t.condition}, fmt.Sprintf("%d_windowFilter", newIndex), options)
@@ -199,6 +288,9 @@ func buildOps(lp LogicalPlan, tp *topo.Topo, options *api.RuleOption, sources []
 			rawInterval = t.length
 		case ast.HOPPING_WINDOW:
 			rawInterval = t.interval
+		case ast.COUNT_OR_TIME_WINDOW:
+			// the interval is the max count instead of a duration
+			i = int64(t.interval)
 		}
 		t.ExtractStateFunc()
 		op, err = node.NewWindowOp(fmt.Sprintf("%d_window", newIndex), node.WindowConfig{
@@ -210,21 +302,35 @@ func buildOps(lp LogicalPlan, tp *topo.Topo, options *api.RuleOption, sources []
 			TimeUnit:         t.timeUnit,
 			TriggerCondition: t.triggerCondition,
 			StateFuncs:       t.stateFuncs,
+			Partition:        t.partition,
+			PaneAggs:         t.paneAggs,
+			PaneKeys:         t.paneKeys,
+			Rollup:           t.rollup,
 		}, options)
 		if err != nil {
 			return nil, 0, err
 		}
 	case *LookupPlan:
-		op, err = node.NewLookupNode(t.joinExpr.Name, t.fields, t.keys, t.joinExpr.JoinType, t.valvars, t.options, options)
+		var ln *node.LookupNode
+		ln, err = node.NewLookupNode(t.joinExpr.Name, t.fields, t.keys, t.joinExpr.JoinType, t.valvars, t.options, options)
+		if err == nil {
+			err = ln.SetRanges(t.ranges)
+		}
+		if err == nil {
+			err = ln.ValidateEmitter(streamsFromStmt)
+		}
+		op = ln
 	case *JoinAlignPlan:
-		op, err = node.NewJoinAlignNode(fmt.Sprintf("%d_join_aligner", newIndex), t.Emitters, options)
+		op, err = node.NewJoinAlignNode(fmt.Sprintf("%d_join_aligner", newIndex), t.Emitters, t.Temporals, options)
+	case *IntervalJoinPlan:
+		op = node.NewIntervalJoinNode(fmt.Sprintf("%d_interval_join", newIndex), t.conf, options)
 	case *JoinPlan:
 		op = Transform(&operator.JoinOp{Joins: t.joins, From: t.from}, fmt.Sprintf("%d_join", newIndex), options)
 	case *FilterPlan:
 		t.ExtractStateFunc()
 		op = Transform(&operator.FilterOp{Condition: t.condition, StateFuncs: t.stateFuncs}, fmt.Sprintf("%d_filter", newIndex), options)
 	case *AggregatePlan:
-		op = Transform(&operator.AggregateOp{Dimensions: t.dimensions}, fmt.Sprintf("%d_aggregate", newIndex), options)
+		op = Transform(&operator.AggregateOp{Dimensions: t.dimensions, Pivot: t.pivot}, fmt.Sprintf("%d_aggregate", newIndex), options)
 	case *HavingPlan:
 		t.ExtractStateFunc()
 		op = Transform(&operator.HavingOp{Condition: t.condition, StateFuncs: t.stateFuncs}, fmt.Sprintf("%d_having", newIndex), options)
@@ -232,6 +338,9 @@ func buildOps(lp LogicalPlan, tp *topo.Topo, options *api.RuleOption, sources []
 		op = Transform(&operator.OrderOp{SortFields: t.SortFields}, fmt.Sprintf("%d_order", newIndex), options)
 	case *ProjectPlan:
 		op = Transform(&operator.ProjectOp{ColNames: t.colNames, AliasNames: t.aliasNames, AliasFields: t.aliasFields, ExprFields: t.exprFields, ExceptNames: t.exceptNames, IsAggregate: t.isAggregate, AllWildcard: t.allWildcard, WildcardEmitters: t.wildcardEmitters, ExprNames: t.exprNames, SendMeta: t.sendMeta, LimitCount: t.limitCount, EnableLimit: t.enableLimit, WindowFuncNames: t.windowFuncNames}, fmt.Sprintf("%d_project", newIndex), options)
+	case *FillPlan:
+		op = Transform(&operator.FillOp{Mode: t.mode, Step: t.step, MaxGap: t.maxGap, Keys: t.keys, Aggs: t.aggs, Starts: t.starts, Ends: t.ends}, fmt.Sprintf("%d_fill", newIndex), options)
+		single = true
 	case *ProjectSetPlan:
 		op = Transform(&operator.ProjectSetOperator{SrfMapping: t.SrfMapping, LimitCount: t.limitCount, EnableLimit: t.enableLimit}, fmt.Sprintf("%d_projectset", newIndex), options)
 	case *WindowFuncPlan:
@@ -242,7 +351,7 @@ func buildOps(lp LogicalPlan, tp *topo.Topo, options *api.RuleOption, sources []
 	if err != nil {
 		return nil, 0, err
 	}
-	if uop, ok := op.(*node.UnaryOperator); ok {
+	if uop, ok := op.(*node.UnaryOperator); ok && !single {
 		uop.SetConcurrency(options.Concurrency)
 	}
 	if onode, ok := op.(node.OperatorNode); ok {
@@ -285,6 +394,77 @@ func convertFromDuration(t *WindowPlan) (int64, int64, int64) {
 	return int64(t.length) * unit, int64(t.interval) * unit, t.delay * unit
 }
 
+// validateRollup checks that each rollup tier covers a whole number of the finer tier or the window, so that the tiers
+// are aligned to the natural time with the window
+func validateRollup(wp *WindowPlan, tiers []*ast.TimeLiteral) error {
+	prev, _, _ := convertFromDuration(wp)
+	for _, t := range tiers {
+		d, _, _ := convertFromDuration(&WindowPlan{length: 1, timeUnit: t.Val})
+		if d <= prev || d%prev != 0 {
+			return fmt.Errorf("the rollup tier %s must be a multiple of the window length or the previous tier", t)
+		}
+		wp.rollup = append(wp.rollup, t.Val)
+		prev = d
+	}
+	return nil
+}
+
+// extractTemporals returns the scan tables joined by FOR SYSTEM_TIME AS OF, nil if none
+func extractTemporals(joins ast.Joins, streamStmts []*streamInfo, w *ast.Window) (map[string]*node.TemporalTable, error) {
+	var temporals map[string]*node.TemporalTable
+	for _, join := range joins {
+		if join.AsOf == nil {
+			continue
+		}
+		if w != nil {
+			return nil, fmt.Errorf("FOR SYSTEM_TIME AS OF is not supported with window")
+		}
+		var opts *ast.Options
+		for _, sInfo := range streamStmts {
+			if string(sInfo.stmt.Name) == join.Name && sInfo.stmt.StreamType == ast.TypeTable && sInfo.stmt.Options.KIND != ast.StreamKindLookup {
+				opts = sInfo.stmt.Options
+				break
+			}
+		}
+		if opts == nil {
+			return nil, fmt.Errorf("FOR SYSTEM_TIME AS OF is only supported for scan table, but %s is not", join.Name)
+		}
+		if temporals == nil {
+			temporals = make(map[string]*node.TemporalTable)
+		}
+		temporals[join.Name] = &node.TemporalTable{AsOf: join.AsOf, HistorySize: opts.HISTORY_SIZE}
+	}
+	return temporals, nil
+}
+
+// convertMatchWithin returns the WITHIN duration of the match in milliseconds, 0 if not set
+func convertMatchWithin(m *ast.MatchRecognize) (int64, error) {
+	if m.Within == nil {
+		return 0, nil
+	}
+	return convertWithin(m.Within, m.WithinUnit)
+}
+
+// convertWithin converts the WITHIN duration to milliseconds
+func convertWithin(within *ast.IntegerLiteral, withinUnit *ast.TimeLiteral) (int64, error) {
+	var unit int64
+	switch withinUnit.Val {
+	case ast.DD:
+		unit = 24 * 3600 * 1000
+	case ast.HH:
+		unit = 3600 * 1000
+	case ast.MI:
+		unit = 60 * 1000
+	case ast.SS:
+		unit = 1000
+	case ast.MS:
+		unit = 1
+	default:
+		return 0, fmt.Errorf("invalid WITHIN unit %s", withinUnit)
+	}
+	return int64(within.Val) * unit, nil
+}
+
 func transformSourceNode(t *DataSourcePlan, sources []*node.SourceNode, options *api.RuleOption) (*node.SourceNode, error) {
 	isSchemaless := t.isSchemaless
 	switch t.streamStmt.StreamType {
@@ -346,6 +526,28 @@ func getMockSource(sources []*node.SourceNode, name string) *node.SourceNode {
 }
 
 func createLogicalPlan(stmt *ast.SelectStatement, opt *api.RuleOption, store kv.KeyValue) (LogicalPlan, error) {
+	// The CTEs are planned in order so that a CTE can read the earlier ones. Each CTE plan is shared by all the
+	// plans reading it
+	var ctes map[string]*CTEPlan
+	if len(stmt.With) > 0 {
+		ctes = make(map[string]*CTEPlan, len(stmt.With))
+		// only the output of the rule is filled
+		cteOpt := *opt
+		cteOpt.GapFill = ""
+		for _, cte := range stmt.With {
+			inner, err := createStmtPlan(cte.Stmt, &cteOpt, store, ctes)
+			if err != nil {
+				return nil, fmt.Errorf("invalid CTE %s: %v", cte.Name, err)
+			}
+			p := CTEPlan{name: cte.Name}.Init()
+			p.SetChildren([]LogicalPlan{inner})
+			ctes[cte.Name] = p
+		}
+	}
+	return createStmtPlan(stmt, opt, store, ctes)
+}
+
+func createStmtPlan(stmt *ast.SelectStatement, opt *api.RuleOption, store kv.KeyValue, ctes map[string]*CTEPlan) (LogicalPlan, error) {
 	dimensions := stmt.Dimensions
 	var (
 		p        LogicalPlan
@@ -357,15 +559,19 @@ func createLogicalPlan(stmt *ast.SelectStatement, opt *api.RuleOption, store kv.
 		streamEmitters      []string
 		w                   *ast.Window
 		ds                  ast.Dimensions
+		fillStep            int64
 	)
 
-	streamStmts, analyticFuncs, analyticFieldFuncs, err := decorateStmt(stmt, store)
+	streamStmts, analyticFuncs, analyticFieldFuncs, err := decorateStmt(stmt, store, ctes)
 	if err != nil {
 		return nil, err
 	}
 
 	for _, sInfo := range streamStmts {
-		if sInfo.stmt.StreamType == ast.TypeTable && sInfo.stmt.Options.KIND == ast.StreamKindLookup {
+		if cte, ok := ctes[string(sInfo.stmt.Name)]; ok {
+			children = append(children, cte)
+			streamEmitters = append(streamEmitters, string(sInfo.stmt.Name))
+		} else if sInfo.stmt.StreamType == ast.TypeTable && sInfo.stmt.Options.KIND == ast.StreamKindLookup {
 			if lookupTableChildren == nil {
 				lookupTableChildren = make(map[string]*ast.Options)
 			}
@@ -379,6 +585,11 @@ func createLogicalPlan(stmt *ast.SelectStatement, opt *api.RuleOption, store kv.
 				iet:          opt.IsEventTime,
 				allMeta:      opt.SendMetaToSink,
 			}.Init()
+			if union := stmt.Sources[0].(*ast.Table); union.Name == string(sInfo.stmt.Name) && len(union.Union) > 0 {
+				if p, err = createUnionPlan(sInfo, union.Union, p, store, opt); err != nil {
+					return nil, err
+				}
+			}
 			if sInfo.stmt.StreamType == ast.TypeStream {
 				children = append(children, p)
 				streamEmitters = append(streamEmitters, string(sInfo.stmt.Name))
@@ -389,6 +600,26 @@ func createLogicalPlan(stmt *ast.SelectStatement, opt *api.RuleOption, store kv.
 		}
 	}
 	hasWindow := dimensions != nil && dimensions.GetWindow() != nil
+	if opt.IsEventTime && opt.AllowedLateness > 0 && hasWindow {
+		switch dimensions.GetWindow().WindowType {
+		case ast.TUMBLING_WINDOW, ast.HOPPING_WINDOW:
+		default:
+			return nil, fmt.Errorf("allowedLateness is only supported by tumbling window and hopping window")
+		}
+	}
+	if opt.GapFill != "" {
+		if !hasWindow {
+			return nil, fmt.Errorf("gapFill is only supported by tumbling window and hopping window")
+		}
+		switch dimensions.GetWindow().WindowType {
+		case ast.TUMBLING_WINDOW, ast.HOPPING_WINDOW:
+		default:
+			return nil, fmt.Errorf("gapFill is only supported by tumbling window and hopping window")
+		}
+		if len(dimensions.GetWindow().Rollup) > 0 {
+			return nil, fmt.Errorf("gapFill is not supported by the window with ROLLUP")
+		}
+	}
 	if opt.IsEventTime {
 		p = WatermarkPlan{
 			SendWatermark: hasWindow,
@@ -397,6 +628,82 @@ func createLogicalPlan(stmt *ast.SelectStatement, opt *api.RuleOption, store kv.
 		p.SetChildren(children)
 		children = []LogicalPlan{p}
 	}
+	if stmt.Unnest != nil {
+		if len(children) != 1 {
+			return nil, errors.New("UNNEST only supports a single stream")
+		}
+		p = UnnestPlan{
+			unnest: stmt.Unnest,
+		}.Init()
+		p.SetChildren(children)
+		children = []LogicalPlan{p}
+	}
+	if stmt.Unpivot != nil {
+		if len(children) != 1 {
+			return nil, errors.New("UNPIVOT only supports a single stream")
+		}
+		if schema := streamStmts[0].schema; schema != nil {
+			for _, c := range stmt.Unpivot.Columns {
+				found := false
+				for _, f := range schema {
+					if f.Name == c {
+						found = true
+						break
+					}
+				}
+				if !found {
+					return nil, fmt.Errorf("column %s of UNPIVOT is not found in stream %s", c, streamStmts[0].stmt.Name)
+				}
+			}
+		}
+		p = UnpivotPlan{
+			unpivot: stmt.Unpivot,
+		}.Init()
+		p.SetChildren(children)
+		children = []LogicalPlan{p}
+	}
+	if stmt.Pivot != nil && (len(children) != 1 || stmt.Joins != nil) {
+		return nil, errors.New("PIVOT only supports a single stream")
+	}
+	if stmt.Dedup != nil {
+		if len(children) != 1 {
+			return nil, errors.New("DEDUP BY only supports a single stream")
+		}
+		within, err := convertWithin(stmt.Dedup.Within, stmt.Dedup.WithinUnit)
+		if err != nil {
+			return nil, err
+		}
+		p = DedupPlan{
+			keys:   stmt.Dedup.Keys,
+			within: within,
+		}.Init()
+		p.SetChildren(children)
+		children = []LogicalPlan{p}
+	}
+	if stmt.MatchRecognize != nil {
+		if len(children) != 1 || len(scanTableChildren) > 0 || lookupTableChildren != nil {
+			return nil, errors.New("MATCH_RECOGNIZE only supports a single stream")
+		}
+		p = MatchRecognizePlan{
+			match: stmt.MatchRecognize,
+		}.Init()
+		p.SetChildren(children)
+		children = []LogicalPlan{p}
+	}
+	subqueries, subqueryTables, err := extractSubqueries(stmt, store, opt)
+	if err != nil {
+		return nil, err
+	}
+	if len(subqueries) > 0 {
+		if len(children) != 1 || stmt.Joins != nil {
+			return nil, errors.New("subquery only supports a single stream")
+		}
+		p = SubqueryPlan{
+			subqueries: subqueries,
+		}.Init()
+		p.SetChildren(append(children, subqueryTables...))
+		children = []LogicalPlan{p}
+	}
 	if len(analyticFuncs) > 0 || len(analyticFieldFuncs) > 0 {
 		p = AnalyticFuncsPlan{
 			funcs:      analyticFuncs,
@@ -432,18 +739,63 @@ func createLogicalPlan(stmt *ast.SelectStatement, opt *api.RuleOption, store kv.
 				wp.condition = w.Filter
 			}
 			if w.TriggerCondition != nil {
+				if w.WindowType != ast.SLIDING_WINDOW {
+					if opt.IsEventTime {
+						return nil, fmt.Errorf("the trigger condition of %s is not supported in event time", w.WindowType)
+					}
+					if w.Partition != nil {
+						return nil, errors.New("the trigger condition is not supported by the partitioned session window")
+					}
+				}
 				wp.triggerCondition = w.TriggerCondition
 			}
+			wp.partition = w.Partition
+			if opt.GapFill != "" {
+				l, i, _ := convertFromDuration(wp)
+				fillStep = l
+				if w.WindowType == ast.HOPPING_WINDOW {
+					fillStep = i
+				}
+			}
 			// TODO calculate limit
-			// TODO incremental aggregate
+			wp.paneAggs, wp.paneKeys = extractPaneAggs(stmt, w, opt)
+			if len(w.Rollup) > 0 {
+				if wp.paneAggs == nil {
+					return nil, errors.New("ROLLUP requires the rule to read a single stream without join and pivot, and to select only sum, count, avg, min, max and topn of the tuple values and the group by fields")
+				}
+				if err := validateRollup(wp, w.Rollup); err != nil {
+					return nil, err
+				}
+			}
 			wp.SetChildren(children)
 			children = []LogicalPlan{wp}
 			p = wp
 		}
 	}
 	if stmt.Joins != nil {
+		temporals, err := extractTemporals(stmt.Joins, streamStmts, w)
+		if err != nil {
+			return nil, err
+		}
 		if len(lookupTableChildren) == 0 && len(scanTableChildren) == 0 && w == nil {
-			return nil, errors.New("a time window or count window is required to join multiple streams")
+			// join two streams by the time bound without window
+			ip := IntervalJoinPlan{
+				from: stmt.Sources[0].(*ast.Table),
+			}
+			if len(stmt.Joins) == 1 && len(children) == 2 {
+				ip.join = stmt.Joins[0]
+			}
+			if ip.join.Name != "" && ip.join.Name == ip.from.Name {
+				return nil, fmt.Errorf("interval join of stream %s with itself is not supported", ip.from.Name)
+			}
+			if ip.join.Name == "" || !ip.validateAndExtractCondition() {
+				return nil, errors.New("a time window or count window is required to join multiple streams, or join two streams by the equi-join keys and the time bound like s1.ts BETWEEN (s2.ts - 10000) AND (s2.ts + 10000)")
+			}
+			p = ip.Init()
+			p.SetChildren(children)
+			children = []LogicalPlan{p}
+			// the joins are all done by the interval join
+			stmt.Joins = nil
 		}
 		if len(lookupTableChildren) > 0 {
 			var joins []ast.Join
@@ -454,7 +806,7 @@ func createLogicalPlan(stmt *ast.SelectStatement, opt *api.RuleOption, store kv.
 						options:  streamOpt,
 					}
 					if !lookupPlan.validateAndExtractCondition() {
-						return nil, fmt.Errorf("join condition %s is invalid, at least one equi-join predicate is required", join.Expr)
+						return nil, fmt.Errorf("join condition %s is invalid, at least one equi-join or range predicate is required", join.Expr)
 					}
 					p = lookupPlan.Init()
 					p.SetChildren(children)
@@ -473,7 +825,8 @@ func createLogicalPlan(stmt *ast.SelectStatement, opt *api.RuleOption, store kv.
 		if len(stmt.Joins) > 0 {
 			if len(scanTableChildren) > 0 {
 				p = JoinAlignPlan{
-					Emitters: scanTableEmitters,
+					Emitters:  scanTableEmitters,
+					Temporals: temporals,
 				}.Init()
 				p.SetChildren(append(children, scanTableChildren...))
 				children = []LogicalPlan{p}
@@ -493,11 +846,15 @@ func createLogicalPlan(stmt *ast.SelectStatement, opt *api.RuleOption, store kv.
 		p.SetChildren(children)
 		children = []LogicalPlan{p}
 	}
+	if stmt.Pivot != nil && w == nil {
+		return nil, errors.New("PIVOT must be used with a window")
+	}
 	if dimensions != nil {
 		ds = dimensions.GetGroups()
-		if ds != nil && len(ds) > 0 {
+		if len(ds) > 0 || stmt.Pivot != nil {
 			p = AggregatePlan{
 				dimensions: ds,
+				pivot:      stmt.Pivot,
 			}.Init()
 			p.SetChildren(children)
 			children = []LogicalPlan{p}
@@ -560,6 +917,11 @@ func createLogicalPlan(stmt *ast.SelectStatement, opt *api.RuleOption, store kv.
 			limitCount:  limitCount,
 		}.Init()
 		p.SetChildren(children)
+		children = []LogicalPlan{p}
+	}
+	if opt.GapFill != "" {
+		p = newFillPlan(opt.GapFill, fillStep, opt.GapFillMaxGap, stmt.Fields)
+		p.SetChildren(children)
 	}
 
 	return optimize(p)
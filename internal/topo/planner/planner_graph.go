@@ -180,12 +180,18 @@ func PlanByGraph(rule *api.Rule) (*topo.Topo, error) {
 									options:  streamOpt,
 								}
 								if !lookupPlan.validateAndExtractCondition() {
-									return nil, fmt.Errorf("parse join %s with %v error: join condition %s is invalid, at least one equi-join predicate is required", nodeName, gn.Props, join.Expr)
+									return nil, fmt.Errorf("parse join %s with %v error: join condition %s is invalid, at least one equi-join or range predicate is required", nodeName, gn.Props, join.Expr)
 								}
 								op, err := node.NewLookupNode(lookupPlan.joinExpr.Name, lookupPlan.fields, lookupPlan.keys, lookupPlan.joinExpr.JoinType, lookupPlan.valvars, lookupPlan.options, rule.Options)
 								if err != nil {
 									return nil, fmt.Errorf("parse join %s with %v error: fail to create lookup node", nodeName, gn.Props)
 								}
+								if err := op.SetRanges(lookupPlan.ranges); err != nil {
+									return nil, fmt.Errorf("parse join %s with %v error: %v", nodeName, gn.Props, err)
+								}
+								if err := op.ValidateEmitter(xsql.GetStreams(stmt)); err != nil {
+									return nil, fmt.Errorf("parse join %s with %v error: %v", nodeName, gn.Props, err)
+								}
 								nodeMap[nodeName] = op
 							} else {
 								joins = append(joins, join)
@@ -381,6 +387,20 @@ func PlanByGraph(rule *api.Rule) (*topo.Topo, error) {
 					switch sn := nodeMap[from].(type) {
 					case *node.SwitchNode:
 						inputs = append(inputs, sn.GetEmitter(i))
+					case *node.LookupNode:
+						switch i {
+						case 1:
+							inputs = append(inputs, sn.GetSideEmitter())
+						case 2:
+							inputs = append(inputs, sn.GetSummaryEmitter())
+						default:
+							return nil, fmt.Errorf("lookup join node %s only has the side outputs for the unmatched rows and the window summary", from)
+						}
+					case *node.WatermarkOp:
+						if i != 1 {
+							return nil, fmt.Errorf("watermark node %s only has the side output for the late events", from)
+						}
+						inputs = append(inputs, sn.GetLateEmitter())
 					default:
 						return nil, fmt.Errorf("node %s is not a switch node but have multiple output", from)
 					}
@@ -645,6 +665,11 @@ func parseWindow(props map[string]interface{}) (*node.WindowConfig, error) {
 		if n.Interval == 0 {
 			n.Interval = n.Size
 		}
+	case "countortimewindow":
+		wt = ast.COUNT_OR_TIME_WINDOW
+		if n.Interval <= 0 {
+			return nil, fmt.Errorf("count or time window interval must be greater than 0")
+		}
 	default:
 		return nil, fmt.Errorf("unknown window type %s", n.Type)
 	}
@@ -675,6 +700,10 @@ func parseWindow(props map[string]interface{}) (*node.WindowConfig, error) {
 		}
 		length = n.Size * unit
 		interval = n.Interval * unit
+		// the interval is the max count
+		if wt == ast.COUNT_OR_TIME_WINDOW {
+			interval = n.Interval
+		}
 	}
 	return &node.WindowConfig{
 		RawInterval: rawInterval,
@@ -858,6 +858,123 @@ func TestPlannerGraphWithStream(t *testing.T) {
 }`,
 			err: nil,
 		},
+		{
+			name: "stream and table with side output",
+			graph: `{
+    "nodes": {
+      "demo": {
+        "type": "source",
+        "nodeType": "mqtt",
+        "props": {
+          "sourceType": "stream",
+          "sourceName": "src1"
+        }
+      },
+      "lookupT":{
+        "type": "source",
+        "nodeType": "memory",
+        "props": {
+          "sourceType": "table",
+          "sourceName": "lookupT"
+        }
+      },
+      "joinop": {
+        "type": "operator",
+        "nodeType": "join",
+        "props": {
+          "from": "src1",
+          "joins": [
+            {
+              "name": "lookupT",
+              "type": "inner",
+              "on": "src1.deviceKind = lookupT.id"
+            }
+          ]
+        }
+      },
+      "log": {
+        "type": "sink",
+        "nodeType": "log",
+        "props": {}
+      },
+      "missLog": {
+        "type": "sink",
+        "nodeType": "log",
+        "props": {}
+      }
+    },
+    "topo": {
+      "sources": ["demo", "lookupT"],
+      "edges": {
+        "demo": ["joinop"],
+        "lookupT": ["joinop"],
+        "joinop": [["log"], ["missLog"]]
+      }
+    }
+}`,
+			err: nil,
+		},
+		{
+			name: "stream and table with too many side outputs",
+			graph: `{
+    "nodes": {
+      "demo": {
+        "type": "source",
+        "nodeType": "mqtt",
+        "props": {
+          "sourceType": "stream",
+          "sourceName": "src1"
+        }
+      },
+      "lookupT":{
+        "type": "source",
+        "nodeType": "memory",
+        "props": {
+          "sourceType": "table",
+          "sourceName": "lookupT"
+        }
+      },
+      "joinop": {
+        "type": "operator",
+        "nodeType": "join",
+        "props": {
+          "from": "src1",
+          "joins": [
+            {
+              "name": "lookupT",
+              "type": "inner",
+              "on": "src1.deviceKind = lookupT.id"
+            }
+          ]
+        }
+      },
+      "log": {
+        "type": "sink",
+        "nodeType": "log",
+        "props": {}
+      },
+      "missLog": {
+        "type": "sink",
+        "nodeType": "log",
+        "props": {}
+      },
+      "missLog2": {
+        "type": "sink",
+        "nodeType": "log",
+        "props": {}
+      }
+    },
+    "topo": {
+      "sources": ["demo", "lookupT"],
+      "edges": {
+        "demo": ["joinop"],
+        "lookupT": ["joinop"],
+        "joinop": [["log"], ["missLog"], [], ["missLog2"]]
+      }
+    }
+}`,
+			err: fmt.Errorf("lookup join node joinop only has the side outputs for the unmatched rows and the window summary"),
+		},
 		{
 			name: "wrong join stream name",
 			graph: `{
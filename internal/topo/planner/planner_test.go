@@ -2607,6 +2607,78 @@ func Test_createLogicalPlan(t *testing.T) {
 				sendMeta:    false,
 			}.Init(),
 		},
+		{
+			sql: `SELECT id1, r FROM src1 CROSS JOIN UNNEST(myarray) AS r WHERE r = "a"`,
+			p: ProjectPlan{
+				baseLogicalPlan: baseLogicalPlan{
+					children: []LogicalPlan{
+						FilterPlan{
+							baseLogicalPlan: baseLogicalPlan{
+								children: []LogicalPlan{
+									UnnestPlan{
+										baseLogicalPlan: baseLogicalPlan{
+											children: []LogicalPlan{
+												DataSourcePlan{
+													name: "src1",
+													streamFields: map[string]*ast.JsonStreamField{
+														"id1": {
+															Type: "bigint",
+														},
+														"myarray": {
+															Type: "array",
+															Items: &ast.JsonStreamField{
+																Type: "string",
+															},
+														},
+													},
+													streamStmt:  streams["src1"],
+													metaFields:  []string{},
+													pruneFields: []string{},
+												}.Init(),
+											},
+										},
+										unnest: &ast.Unnest{
+											Expr:  &ast.FieldRef{Name: "myarray", StreamName: "src1"},
+											Alias: "r",
+										},
+									}.Init(),
+								},
+							},
+							condition: &ast.BinaryExpr{
+								LHS: &ast.FieldRef{Name: "r", StreamName: "src1"},
+								OP:  ast.EQ,
+								RHS: &ast.StringLiteral{Val: "a"},
+							},
+						}.Init(),
+					},
+				},
+				fields: []ast.Field{
+					{
+						Name: "id1",
+						Expr: &ast.FieldRef{Name: "id1", StreamName: "src1"},
+					},
+					{
+						Name: "r",
+						Expr: &ast.FieldRef{Name: "r", StreamName: "src1"},
+					},
+				},
+				isAggregate: false,
+				allWildcard: false,
+				sendMeta:    false,
+			}.Init(),
+		},
+		{
+			sql: `SELECT temp FROM src1 UNION ALL src2`,
+			err: "stream src2 is not compatible with src1 in UNION ALL, they must have the same schema",
+		},
+		{
+			sql: `SELECT * FROM src1 PIVOT (max(temp) FOR name IN ('a', 'b'))`,
+			err: "PIVOT must be used with a window",
+		},
+		{
+			sql: `SELECT * FROM src1 UNPIVOT (v FOR n IN (temp, abc))`,
+			err: "column abc of UNPIVOT is not found in stream src1",
+		},
 	}
 	fmt.Printf("The test bucket size is %d.\n\n", len(tests))
 
@@ -4003,6 +4075,126 @@ func Test_createLogicalPlanSchemaless(t *testing.T) {
 				sendMeta:    false,
 			}.Init(),
 		},
+		{ // 19 read the CTE like a stream
+			sql: `WITH hot AS (SELECT name, temp FROM src1 WHERE temp > 30) SELECT name FROM hot`,
+			p: ProjectPlan{
+				baseLogicalPlan: baseLogicalPlan{
+					children: []LogicalPlan{
+						CTEPlan{
+							baseLogicalPlan: baseLogicalPlan{
+								children: []LogicalPlan{
+									ProjectPlan{
+										baseLogicalPlan: baseLogicalPlan{
+											children: []LogicalPlan{
+												FilterPlan{
+													baseLogicalPlan: baseLogicalPlan{
+														children: []LogicalPlan{
+															DataSourcePlan{
+																name: "src1",
+																streamFields: map[string]*ast.JsonStreamField{
+																	"name": nil,
+																	"temp": nil,
+																},
+																streamStmt:   streams["src1"],
+																metaFields:   []string{},
+																isSchemaless: true,
+																pruneFields:  []string{},
+															}.Init(),
+														},
+													},
+													condition: &ast.BinaryExpr{
+														LHS: &ast.FieldRef{Name: "temp", StreamName: "src1"},
+														OP:  ast.GT,
+														RHS: &ast.IntegerLiteral{Val: 30},
+													},
+												}.Init(),
+											},
+										},
+										fields: []ast.Field{
+											{
+												Expr:  &ast.FieldRef{Name: "name", StreamName: "src1"},
+												Name:  "name",
+												AName: "",
+											},
+											{
+												Expr:  &ast.FieldRef{Name: "temp", StreamName: "src1"},
+												Name:  "temp",
+												AName: "",
+											},
+										},
+										isAggregate: false,
+										sendMeta:    false,
+									}.Init(),
+								},
+							},
+							name: "hot",
+						}.Init(),
+					},
+				},
+				fields: []ast.Field{
+					{
+						Expr:  &ast.FieldRef{Name: "name", StreamName: "hot"},
+						Name:  "name",
+						AName: "",
+					},
+				},
+				isAggregate: false,
+				sendMeta:    false,
+			}.Init(),
+		},
+		{ // 20
+			sql: `WITH hot AS (SELECT name FROM nonexist) SELECT name FROM hot`,
+			err: "invalid CTE hot: fail to get stream nonexist, please check if stream is created",
+		},
+		{ // 21 merge the streams by UNION ALL
+			sql: `SELECT name FROM src1 UNION ALL src2`,
+			p: ProjectPlan{
+				baseLogicalPlan: baseLogicalPlan{
+					children: []LogicalPlan{
+						UnionPlan{
+							baseLogicalPlan: baseLogicalPlan{
+								children: []LogicalPlan{
+									DataSourcePlan{
+										name: "src1",
+										streamFields: map[string]*ast.JsonStreamField{
+											"name": nil,
+										},
+										streamStmt:   streams["src1"],
+										metaFields:   []string{},
+										isSchemaless: true,
+										pruneFields:  []string{},
+									}.Init(),
+									DataSourcePlan{
+										name: "src2",
+										streamFields: map[string]*ast.JsonStreamField{
+											"name": nil,
+										},
+										streamStmt:   streams["src2"],
+										metaFields:   []string{},
+										isSchemaless: true,
+										pruneFields:  []string{},
+									}.Init(),
+								},
+							},
+							emitter: "src1",
+						}.Init(),
+					},
+				},
+				fields: []ast.Field{
+					{
+						Expr:  &ast.FieldRef{Name: "name", StreamName: "src1"},
+						Name:  "name",
+						AName: "",
+					},
+				},
+				isAggregate: false,
+				sendMeta:    false,
+			}.Init(),
+		},
+		{ // 22
+			sql: `SELECT name FROM src1 UNION ALL tableInPlanner`,
+			err: "UNION ALL only supports streams, but tableInPlanner is a table",
+		},
 	}
 	fmt.Printf("The test bucket size is %d.\n\n", len(tests))
 
@@ -4258,6 +4450,9 @@ func Test_createLogicalPlan4Lookup(t *testing.T) {
 												RHS: &ast.IntegerLiteral{Val: 40},
 											},
 										},
+										ranges: []*node.LookupRangeKey{
+											{Field: "b", Op: ">", Val: &ast.IntegerLiteral{Val: 20}},
+										},
 									}.Init(),
 								},
 							},
@@ -4591,6 +4786,14 @@ func Test_createLogicalPlan4Lookup(t *testing.T) {
 				sendMeta:    false,
 			}.Init(),
 		},
+		{
+			sql: `SELECT (SELECT id FROM table1) AS m FROM src1`,
+			err: "only IN subquery is supported for lookup table table1",
+		},
+		{
+			sql: `SELECT * FROM src1 WHERE id IN (SELECT id FROM src1)`,
+			err: "subquery table src1 cannot be the source of the rule",
+		},
 	}
 	for _, tt := range tests {
 		t.Run(tt.sql, func(t *testing.T) {
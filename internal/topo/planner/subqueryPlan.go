@@ -0,0 +1,161 @@
+// Copyright 2023 EMQ Technologies Co., Ltd.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package planner
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/lf-edge/ekuiper/internal/topo/node"
+	"github.com/lf-edge/ekuiper/internal/xsql"
+	"github.com/lf-edge/ekuiper/pkg/api"
+	"github.com/lf-edge/ekuiper/pkg/ast"
+	"github.com/lf-edge/ekuiper/pkg/kv"
+)
+
+const subqueryFieldPrefix = "$$sq_"
+
+type SubqueryPlan struct {
+	baseLogicalPlan
+	subqueries []*node.Subquery
+}
+
+func (p SubqueryPlan) Init() *SubqueryPlan {
+	p.baseLogicalPlan.self = &p
+	p.baseLogicalPlan.setPlanType(SUBQUERY)
+	return &p
+}
+
+func (p *SubqueryPlan) BuildExplainInfo() {
+	info := make([]string, 0, len(p.subqueries))
+	for _, sq := range p.subqueries {
+		info = append(info, sq.Expr.String())
+	}
+	p.baseLogicalPlan.ExplainInfo.Info = "Subqueries:[ " + strings.Join(info, ", ") + " ]"
+}
+
+// PushDownPredicate the subquery results must be calculated before the filter which uses them
+func (p *SubqueryPlan) PushDownPredicate(condition ast.Expr) (ast.Expr, LogicalPlan) {
+	return condition, p
+}
+
+func (p *SubqueryPlan) PruneColumns(fields []ast.Expr) error {
+	for _, sq := range p.subqueries {
+		fields = append(fields, getFields(sq.Expr.Stmt.Fields)...)
+		if sq.Expr.Stmt.Condition != nil {
+			fields = append(fields, getFields(sq.Expr.Stmt.Condition)...)
+		}
+		if sq.Key != nil {
+			fields = append(fields, getFields(sq.Key)...)
+		}
+	}
+	return p.baseLogicalPlan.PruneColumns(fields)
+}
+
+// extractSubqueries collects the subqueries in the select fields and the WHERE clause. The subqueries on scan tables
+// read the table by the returned data source plans, while the subqueries on lookup tables look up by the left
+// expression of IN.
+func extractSubqueries(stmt *ast.SelectStatement, store kv.KeyValue, opt *api.RuleOption) ([]*node.Subquery, []LogicalPlan, error) {
+	var (
+		sqs  []*ast.SubqueryExpr
+		keys = make(map[*ast.SubqueryExpr]ast.Expr)
+	)
+	collect := func(n ast.Node) bool {
+		switch e := n.(type) {
+		case *ast.BinaryExpr:
+			if e.OP == ast.IN || e.OP == ast.NOTIN {
+				if vs, ok := e.RHS.(*ast.ValueSetExpr); ok {
+					if sq, ok := vs.ArrayExpr.(*ast.SubqueryExpr); ok {
+						keys[sq] = e.LHS
+					}
+				}
+			}
+		case *ast.SubqueryExpr:
+			sqs = append(sqs, e)
+		}
+		return true
+	}
+	ast.WalkFunc(stmt.Fields, collect)
+	ast.WalkFunc(stmt.Condition, collect)
+	if len(sqs) == 0 {
+		return nil, nil, nil
+	}
+	outer := xsql.GetStreams(stmt)
+	var (
+		result  []*node.Subquery
+		scans   []LogicalPlan
+		scanned = make(map[string]bool)
+	)
+	for i, e := range sqs {
+		table := e.Stmt.Sources[0].(*ast.Table).Name
+		for _, s := range outer {
+			if s == table {
+				return nil, nil, fmt.Errorf("subquery table %s cannot be the source of the rule", table)
+			}
+		}
+		streamStmt, err := xsql.GetDataSource(store, table)
+		if err != nil {
+			return nil, nil, fmt.Errorf("fail to get table %s, please check if table is created", table)
+		}
+		if streamStmt.StreamType != ast.TypeTable {
+			return nil, nil, fmt.Errorf("subquery only supports table, but %s is a stream", table)
+		}
+		// the inner fields are bound to the table
+		ast.WalkFunc(e.Stmt, func(n ast.Node) bool {
+			if f, ok := n.(*ast.FieldRef); ok && f.StreamName == ast.DefaultStream {
+				f.StreamName = streamStmt.Name
+			}
+			return true
+		})
+		e.CachedField = fmt.Sprintf("%s%d", subqueryFieldPrefix, i)
+		sq := &node.Subquery{Expr: e, Table: table}
+		if streamStmt.Options.KIND == ast.StreamKindLookup {
+			key, ok := keys[e]
+			if !ok {
+				return nil, nil, fmt.Errorf("only IN subquery is supported for lookup table %s", table)
+			}
+			f, ok := e.Stmt.Fields[0].Expr.(*ast.FieldRef)
+			if !ok || !f.IsColumn() {
+				return nil, nil, fmt.Errorf("the IN subquery on lookup table %s must select a field", table)
+			}
+			sq.Key = key
+			sq.KeyField = f.Name
+			sq.Fields = []string{f.Name}
+			if e.Stmt.Condition != nil {
+				for _, ff := range getFields(e.Stmt.Condition) {
+					if fr, ok := ff.(*ast.FieldRef); ok && fr.Name != f.Name {
+						sq.Fields = append(sq.Fields, fr.Name)
+					}
+				}
+			}
+		} else if !scanned[table] {
+			scanned[table] = true
+			si, err := convertStreamInfo(streamStmt)
+			if err != nil {
+				return nil, nil, err
+			}
+			scans = append(scans, DataSourcePlan{
+				name:         si.stmt.Name,
+				streamStmt:   si.stmt,
+				streamFields: si.schema.ToJsonSchema(),
+				isSchemaless: si.schema == nil,
+				iet:          opt.IsEventTime,
+				allMeta:      opt.SendMetaToSink,
+			}.Init())
+		}
+		result = append(result, sq)
+	}
+	return result, scans, nil
+}
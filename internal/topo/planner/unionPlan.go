@@ -0,0 +1,137 @@
+// Copyright 2023 EMQ Technologies Co., Ltd.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package planner
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+
+	"github.com/lf-edge/ekuiper/internal/xsql"
+	"github.com/lf-edge/ekuiper/pkg/api"
+	"github.com/lf-edge/ekuiper/pkg/ast"
+	"github.com/lf-edge/ekuiper/pkg/kv"
+)
+
+// UnionPlan merges the streams of UNION ALL into the first stream. Its children are the data sources in order
+type UnionPlan struct {
+	baseLogicalPlan
+	// emitter is the name of the first stream which the merged rows are from
+	emitter string
+}
+
+func (p UnionPlan) Init() *UnionPlan {
+	p.baseLogicalPlan.self = &p
+	p.baseLogicalPlan.setPlanType(UNION)
+	return &p
+}
+
+func (p *UnionPlan) BuildExplainInfo() {
+	names := make([]string, 0, len(p.children))
+	for _, c := range p.children {
+		names = append(names, string(c.(*DataSourcePlan).name))
+	}
+	p.baseLogicalPlan.ExplainInfo.Info = "Streams:[ " + strings.Join(names, ", ") + " ]"
+}
+
+// PushDownPredicate the condition refers to the first stream, it is not pushed down to the merged streams
+func (p *UnionPlan) PushDownPredicate(condition ast.Expr) (ast.Expr, LogicalPlan) {
+	return condition, p
+}
+
+// PruneColumns the fields of the first stream are pruned in each merged stream
+func (p *UnionPlan) PruneColumns(fields []ast.Expr) error {
+	for _, c := range p.children {
+		name := c.(*DataSourcePlan).name
+		cf := fields
+		if string(name) != p.emitter {
+			cf = make([]ast.Expr, 0, len(fields))
+			for _, field := range fields {
+				switch f := field.(type) {
+				case *ast.FieldRef:
+					if f.StreamName == ast.StreamName(p.emitter) {
+						field = &ast.FieldRef{StreamName: name, Name: f.Name}
+					}
+				case *ast.MetaRef:
+					if f.StreamName == ast.StreamName(p.emitter) {
+						field = &ast.MetaRef{StreamName: name, Name: f.Name}
+					}
+				case *ast.SortField:
+					if f.StreamName == ast.StreamName(p.emitter) {
+						field = &ast.SortField{StreamName: name, Name: f.Name, Uname: f.Uname, Ascending: f.Ascending, FieldExpr: f.FieldExpr}
+					}
+				}
+				cf = append(cf, field)
+			}
+		}
+		if err := c.PruneColumns(cf); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// createUnionPlan creates the data sources of the merged streams which must have the same schema as the first stream
+func createUnionPlan(first *streamInfo, union []string, firstPlan LogicalPlan, store kv.KeyValue, opt *api.RuleOption) (LogicalPlan, error) {
+	if first.stmt.StreamType != ast.TypeStream {
+		return nil, fmt.Errorf("UNION ALL only supports streams, but %s is a table", first.stmt.Name)
+	}
+	children := []LogicalPlan{firstPlan}
+	for _, s := range union {
+		streamStmt, err := xsql.GetDataSource(store, s)
+		if err != nil {
+			return nil, fmt.Errorf("fail to get stream %s, please check if stream is created", s)
+		}
+		if streamStmt.StreamType != ast.TypeStream {
+			return nil, fmt.Errorf("UNION ALL only supports streams, but %s is a table", s)
+		}
+		si, err := convertStreamInfo(streamStmt)
+		if err != nil {
+			return nil, err
+		}
+		if !compatibleSchema(first.schema, si.schema) {
+			return nil, fmt.Errorf("stream %s is not compatible with %s in UNION ALL, they must have the same schema", s, first.stmt.Name)
+		}
+		children = append(children, DataSourcePlan{
+			name:         si.stmt.Name,
+			streamStmt:   si.stmt,
+			streamFields: si.schema.ToJsonSchema(),
+			isSchemaless: si.schema == nil,
+			iet:          opt.IsEventTime,
+			allMeta:      opt.SendMetaToSink,
+		}.Init())
+	}
+	p := UnionPlan{emitter: string(first.stmt.Name)}.Init()
+	p.SetChildren(children)
+	return p, nil
+}
+
+// compatibleSchema checks if the schemas have the same fields regardless of the order. Schemaless is only compatible with schemaless
+func compatibleSchema(a, b ast.StreamFields) bool {
+	if (a == nil) != (b == nil) || len(a) != len(b) {
+		return false
+	}
+	fields := make(map[string]ast.FieldType, len(a))
+	for _, f := range a {
+		fields[strings.ToLower(f.Name)] = f.FieldType
+	}
+	for _, f := range b {
+		ft, ok := fields[strings.ToLower(f.Name)]
+		if !ok || !reflect.DeepEqual(ft, f.FieldType) {
+			return false
+		}
+	}
+	return true
+}
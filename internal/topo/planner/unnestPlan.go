@@ -0,0 +1,52 @@
+// Copyright 2023 EMQ Technologies Co., Ltd.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package planner
+
+import (
+	"github.com/lf-edge/ekuiper/pkg/ast"
+)
+
+type UnnestPlan struct {
+	baseLogicalPlan
+	unnest *ast.Unnest
+}
+
+func (p UnnestPlan) Init() *UnnestPlan {
+	p.baseLogicalPlan.self = &p
+	p.baseLogicalPlan.setPlanType(UNNEST)
+	return &p
+}
+
+func (p *UnnestPlan) BuildExplainInfo() {
+	p.baseLogicalPlan.ExplainInfo.Info = "Expr:" + p.unnest.Expr.String() + ", Alias:" + p.unnest.Alias
+}
+
+// PushDownPredicate the condition may refer to the element, so it cannot be pushed down
+func (p *UnnestPlan) PushDownPredicate(condition ast.Expr) (ast.Expr, LogicalPlan) {
+	return condition, p
+}
+
+// PruneColumns the element is not from the source, while the fields of the array expression are
+func (p *UnnestPlan) PruneColumns(fields []ast.Expr) error {
+	f := make([]ast.Expr, 0, len(fields))
+	for _, field := range fields {
+		if fr, ok := field.(*ast.FieldRef); ok && fr.Name == p.unnest.Alias {
+			continue
+		}
+		f = append(f, field)
+	}
+	f = append(f, getFields(p.unnest.Expr)...)
+	return p.baseLogicalPlan.PruneColumns(f)
+}
@@ -0,0 +1,54 @@
+// Copyright 2023 EMQ Technologies Co., Ltd.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package planner
+
+import (
+	"github.com/lf-edge/ekuiper/pkg/ast"
+)
+
+type UnpivotPlan struct {
+	baseLogicalPlan
+	unpivot *ast.Unpivot
+}
+
+func (p UnpivotPlan) Init() *UnpivotPlan {
+	p.baseLogicalPlan.self = &p
+	p.baseLogicalPlan.setPlanType(UNPIVOT)
+	return &p
+}
+
+func (p *UnpivotPlan) BuildExplainInfo() {
+	p.baseLogicalPlan.ExplainInfo.Info = p.unpivot.String()
+}
+
+// PushDownPredicate the condition may refer to the name and the value, so it cannot be pushed down
+func (p *UnpivotPlan) PushDownPredicate(condition ast.Expr) (ast.Expr, LogicalPlan) {
+	return condition, p
+}
+
+// PruneColumns the name and the value are not from the source, while the unpivot columns are
+func (p *UnpivotPlan) PruneColumns(fields []ast.Expr) error {
+	f := make([]ast.Expr, 0, len(fields)+len(p.unpivot.Columns))
+	for _, field := range fields {
+		if fr, ok := field.(*ast.FieldRef); ok && (fr.Name == p.unpivot.Name || fr.Name == p.unpivot.Value) {
+			continue
+		}
+		f = append(f, field)
+	}
+	for _, c := range p.unpivot.Columns {
+		f = append(f, &ast.FieldRef{StreamName: ast.DefaultStream, Name: c})
+	}
+	return p.baseLogicalPlan.PruneColumns(f)
+}
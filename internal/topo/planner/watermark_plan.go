@@ -17,6 +17,7 @@ package planner
 import (
 	"strconv"
 
+	"github.com/lf-edge/ekuiper/internal/topo/node"
 	"github.com/lf-edge/ekuiper/pkg/ast"
 )
 
@@ -24,6 +25,8 @@ type WatermarkPlan struct {
 	baseLogicalPlan
 	Emitters      []string
 	SendWatermark bool
+	// op is the built watermark node to attach the late output
+	op *node.WatermarkOp
 }
 
 func (p WatermarkPlan) Init() *WatermarkPlan {
@@ -59,3 +62,16 @@ func (p *WatermarkPlan) PushDownPredicate(condition ast.Expr) (ast.Expr, Logical
 	}
 	return nil, p.self
 }
+
+// findWatermarkPlan returns the watermark plan of the plan tree, nil if not in event time
+func findWatermarkPlan(lp LogicalPlan) *WatermarkPlan {
+	if wp, ok := lp.(*WatermarkPlan); ok {
+		return wp
+	}
+	for _, c := range lp.Children() {
+		if wp := findWatermarkPlan(c); wp != nil {
+			return wp
+		}
+	}
+	return nil
+}
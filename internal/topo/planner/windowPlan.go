@@ -16,6 +16,7 @@ package planner
 
 import (
 	"strconv"
+	"strings"
 
 	"github.com/lf-edge/ekuiper/internal/xsql"
 	"github.com/lf-edge/ekuiper/pkg/ast"
@@ -34,6 +35,13 @@ type WindowPlan struct {
 	isEventTime      bool
 
 	stateFuncs []*ast.Call
+	// partition is the partition keys of the session window
+	partition *ast.PartitionExpr
+	// paneAggs and paneKeys are the aggregate calls and group by fields to aggregate incrementally by panes
+	paneAggs []*ast.Call
+	paneKeys []*ast.FieldRef
+	// rollup is the time units of the tiers which aggregate the window results further
+	rollup []ast.Token
 }
 
 func (p WindowPlan) Init() *WindowPlan {
@@ -49,6 +57,16 @@ func (p *WindowPlan) BuildExplainInfo() {
 	if p.condition != nil {
 		info += ", condition:" + p.condition.String()
 	}
+	if p.partition != nil {
+		info += ", partition:" + p.partition.String()
+	}
+	if len(p.rollup) != 0 {
+		tiers := make([]string, 0, len(p.rollup))
+		for _, t := range p.rollup {
+			tiers = append(tiers, ast.Tokens[t])
+		}
+		info += ", rollup:[ " + strings.Join(tiers, ", ") + " ]"
+	}
 	if len(p.stateFuncs) != 0 {
 		info += ", stateFuncs:[ "
 		for _, stateFunc := range p.stateFuncs {
@@ -62,7 +80,7 @@ func (p *WindowPlan) BuildExplainInfo() {
 
 func (p *WindowPlan) PushDownPredicate(condition ast.Expr) (ast.Expr, LogicalPlan) {
 	// not time window depends on the event, so should not filter any
-	if p.wtype == ast.COUNT_WINDOW || p.wtype == ast.SLIDING_WINDOW {
+	if p.wtype == ast.COUNT_WINDOW || p.wtype == ast.SLIDING_WINDOW || p.wtype == ast.COUNT_OR_TIME_WINDOW {
 		return condition, p
 	} else if p.isEventTime {
 		// TODO event time filter, need event window op support
@@ -83,6 +101,11 @@ func (p *WindowPlan) PushDownPredicate(condition ast.Expr) (ast.Expr, LogicalPla
 func (p *WindowPlan) PruneColumns(fields []ast.Expr) error {
 	f := getFields(p.condition)
 	f = append(f, getFields(p.triggerCondition)...)
+	if p.partition != nil {
+		for _, e := range p.partition.Exprs {
+			f = append(f, getFields(e)...)
+		}
+	}
 	return p.baseLogicalPlan.PruneColumns(append(fields, f...))
 }
 
@@ -27,6 +27,8 @@ import (
 
 	"github.com/lf-edge/ekuiper/internal/conf"
 	"github.com/lf-edge/ekuiper/internal/topo"
+	"github.com/lf-edge/ekuiper/internal/topo/lookup"
+	"github.com/lf-edge/ekuiper/internal/topo/node"
 	"github.com/lf-edge/ekuiper/internal/topo/planner"
 	"github.com/lf-edge/ekuiper/pkg/api"
 	"github.com/lf-edge/ekuiper/pkg/infra"
@@ -123,6 +125,8 @@ func (rs *RuleState) UpdateTopo(rule *api.Rule) error {
 	if _, err := planner.Plan(rule); err != nil {
 		return err
 	}
+	// let the new lookup nodes take over the caches of the old ones if the lookup conf is unchanged
+	lookup.PrepareHandoff(rule.Id)
 	if err := rs.Stop(); err != nil {
 		return err
 	}
@@ -531,6 +535,18 @@ func (rs *RuleState) GetTopoGraph() *api.PrintableTopo {
 	}
 }
 
+// GetOperator returns the operator of the running topo by name. The returned running is false if the topo is not
+// created, and the operator is nil if not found
+func (rs *RuleState) GetOperator(name string) (op node.OperatorNode, running bool) {
+	rs.RLock()
+	defer rs.RUnlock()
+	if rs.Topology == nil {
+		return nil, false
+	}
+	op, _ = rs.Topology.GetOperator(name)
+	return op, true
+}
+
 func (rs *RuleState) isInRunningSchedule(now time.Time, d time.Duration) (bool, time.Duration, error) {
 	allowed, err := rs.isInAllowedTimeRange(now)
 	if err != nil {
@@ -252,6 +252,13 @@ func (s *Topo) GetMetrics() (keys []string, values []interface{}) {
 				values = append(values, v)
 			}
 		}
+		if en, ok := so.(node.ExtraMetricsNode); ok {
+			ks, vs := en.GetExtraMetrics()
+			for i, k := range ks {
+				keys = append(keys, "op_"+so.GetName()+"_0_"+k)
+				values = append(values, vs[i])
+			}
+		}
 	}
 	for _, sn := range s.sinks {
 		for ins, metrics := range sn.GetMetrics() {
@@ -276,6 +283,16 @@ func (s *Topo) RemoveMetrics() {
 	}
 }
 
+// GetOperator returns the operator node by its name
+func (s *Topo) GetOperator(name string) (node.OperatorNode, bool) {
+	for _, op := range s.ops {
+		if op.GetName() == name {
+			return op, true
+		}
+	}
+	return nil, false
+}
+
 func (s *Topo) GetTopo() *api.PrintableTopo {
 	return s.topo
 }
@@ -15,9 +15,15 @@
 package topotest
 
 import (
+	"encoding/json"
 	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
 
 	"github.com/lf-edge/ekuiper/internal/conf"
+	"github.com/lf-edge/ekuiper/internal/topo/planner"
+	"github.com/lf-edge/ekuiper/internal/topo/topotest/mockclock"
 	"github.com/lf-edge/ekuiper/pkg/api"
 )
 
@@ -218,3 +224,105 @@ func TestTableJoinCheckpoint(t *testing.T) {
 		DoCheckpointRuleTest(t, tests, j, opt)
 	}
 }
+
+// The barriers pass through the side output of the lookup join so that its downstream completes the checkpoint
+func TestLookupSideOutputCheckpoint(t *testing.T) {
+	conf.IsTesting = true
+	streamList := []string{"demo", "tableLookup"}
+	HandleStream(false, streamList, t)
+	HandleStream(true, streamList, t)
+	rg := &api.RuleGraph{}
+	err := json.Unmarshal([]byte(`{
+    "nodes": {
+      "demo": {
+        "type": "source",
+        "nodeType": "mock",
+        "props": {
+          "sourceType": "stream",
+          "sourceName": "demo"
+        }
+      },
+      "tableLookup": {
+        "type": "source",
+        "nodeType": "mockLookup",
+        "props": {
+          "sourceType": "table",
+          "sourceName": "tableLookup"
+        }
+      },
+      "joinop": {
+        "type": "operator",
+        "nodeType": "join",
+        "props": {
+          "from": "demo",
+          "joins": [
+            {
+              "name": "tableLookup",
+              "type": "inner",
+              "on": "demo.size = tableLookup.id"
+            }
+          ]
+        }
+      },
+      "matched": {
+        "type": "sink",
+        "nodeType": "nop",
+        "props": {}
+      },
+      "unmatched": {
+        "type": "sink",
+        "nodeType": "nop",
+        "props": {}
+      }
+    },
+    "topo": {
+      "sources": ["demo", "tableLookup"],
+      "edges": {
+        "demo": ["joinop"],
+        "tableLookup": ["joinop"],
+        "joinop": [["matched"], ["unmatched"]]
+      }
+    }
+}`), rg)
+	require.NoError(t, err)
+	mockclock.ResetClock(1541152486000)
+	tp, err := planner.PlanByGraph(&api.Rule{
+		Id:    "TestLookupSideOutputCheckpoint",
+		Graph: rg,
+		Options: &api.RuleOption{
+			BufferLength:       100,
+			Qos:                api.AtLeastOnce,
+			CheckpointInterval: 600,
+			SendError:          true,
+		},
+	})
+	require.NoError(t, err)
+	errCh := tp.Open()
+	defer tp.Cancel()
+	var retry int
+	for retry = 10; retry > 0; retry-- {
+		if tp.GetCoordinator() != nil && tp.GetCoordinator().IsActivated() {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	require.NotZero(t, retry, "coordinator timeout")
+	// move the time forward to send all the rows and trigger the checkpoints
+	mockClock := mockclock.GetMockClock()
+	for i := 0; i < 40; i++ {
+		mockClock.Add(100 * time.Millisecond)
+		time.Sleep(10 * time.Millisecond)
+		select {
+		case err := <-errCh:
+			t.Fatal(err)
+		default:
+		}
+	}
+	for retry = 10; retry > 0; retry-- {
+		if tp.GetCoordinator().GetCompleteCount() > 0 {
+			break
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+	require.NotZero(t, retry, "no checkpoint is completed")
+}
@@ -241,7 +241,7 @@ func createStream(t *testing.T, tt RuleTest, j int, opt *api.RuleOption, sinkPro
 		if selectStmt, ok := stmt.(*ast.SelectStatement); !ok {
 			t.Errorf("sql %s is not a select statement", tt.Sql)
 		} else {
-			streams := xsql.GetStreams(selectStmt)
+			streams := xsql.GetAllStreams(selectStmt)
 			for _, stream := range streams {
 				data, ok := mocknode.TestData[stream]
 				if !ok {
@@ -357,6 +357,8 @@ func HandleStream(createOrDrop bool, names []string, t *testing.T) {
 					size BIGINT,
 					id BIGINT
 				) WITH (DATASOURCE="lookup.json", FORMAT="json", CONF_KEY="test");`
+			case "tableLookup":
+				sql = `CREATE TABLE tableLookup () WITH (DATASOURCE="tableLookup", TYPE="mockLookup", KIND="lookup", KEY="id");`
 			case "helloStr":
 				sql = `CREATE STREAM helloStr (name string) WITH (DATASOURCE="helloStr", TYPE="mock", FORMAT="JSON")`
 			case "commands":
@@ -2150,3 +2150,162 @@ func TestAliasSQL(t *testing.T) {
 		DoRuleTest(t, tests, j, opt, 0)
 	}
 }
+
+func TestMatchRecognizeSQL(t *testing.T) {
+	// Reset
+	streamList := []string{"demo"}
+	HandleStream(false, streamList, t)
+	tests := []RuleTest{
+		{
+			Name: `TestMatchRecognizeRule1`,
+			Sql:  `SELECT color, startSize, endSize FROM demo MATCH_RECOGNIZE (PARTITION BY color MEASURES A.size AS startSize, B.size AS endSize PATTERN (A B) DEFINE B AS size < A.size)`,
+			R: [][]map[string]interface{}{
+				{{
+					"color":     "blue",
+					"startSize": float64(6),
+					"endSize":   float64(2),
+				}},
+				{{
+					"color":     "red",
+					"startSize": float64(3),
+					"endSize":   float64(1),
+				}},
+			},
+			M: map[string]interface{}{
+				"op_2_match_0_exceptions_total":  int64(0),
+				"op_2_match_0_records_in_total":  int64(5),
+				"op_2_match_0_records_out_total": int64(2),
+
+				"sink_mockSink_0_exceptions_total":  int64(0),
+				"sink_mockSink_0_records_in_total":  int64(2),
+				"sink_mockSink_0_records_out_total": int64(2),
+			},
+		},
+	}
+	// Data setup
+	HandleStream(true, streamList, t)
+	options := []*api.RuleOption{
+		{
+			BufferLength: 100,
+			SendError:    true,
+		},
+		{
+			BufferLength: 100,
+			SendError:    true,
+			Concurrency:  2,
+		},
+	}
+	for j, opt := range options {
+		DoRuleTest(t, tests, j, opt, 0)
+	}
+}
+
+func TestDedupSQL(t *testing.T) {
+	// Reset
+	streamList := []string{"demo"}
+	HandleStream(false, streamList, t)
+	tests := []RuleTest{
+		{
+			Name: `TestDedupRule1`,
+			Sql:  `SELECT color, size FROM demo DEDUP BY color WITHIN (ss, 10)`,
+			R: [][]map[string]interface{}{
+				{{
+					"color": "red",
+					"size":  float64(3),
+				}},
+				{{
+					"color": "blue",
+					"size":  float64(6),
+				}},
+				{{
+					"color": "yellow",
+					"size":  float64(4),
+				}},
+			},
+			M: map[string]interface{}{
+				"op_2_dedup_0_exceptions_total":  int64(0),
+				"op_2_dedup_0_records_in_total":  int64(5),
+				"op_2_dedup_0_records_out_total": int64(3),
+
+				"sink_mockSink_0_exceptions_total":  int64(0),
+				"sink_mockSink_0_records_in_total":  int64(3),
+				"sink_mockSink_0_records_out_total": int64(3),
+			},
+		},
+	}
+	// Data setup
+	HandleStream(true, streamList, t)
+	options := []*api.RuleOption{
+		{
+			BufferLength: 100,
+			SendError:    true,
+		},
+		{
+			BufferLength: 100,
+			SendError:    true,
+			Concurrency:  2,
+		},
+	}
+	for j, opt := range options {
+		DoRuleTest(t, tests, j, opt, 0)
+	}
+}
+
+func TestAnalyticFrameSQL(t *testing.T) {
+	// Reset
+	streamList := []string{"demo"}
+	HandleStream(false, streamList, t)
+	tests := []RuleTest{
+		{
+			Name: `TestAnalyticFrameRule1`,
+			Sql:  `SELECT color, sum(size) OVER (PARTITION BY color ROWS UNBOUNDED PRECEDING) AS total FROM demo`,
+			R: [][]map[string]interface{}{
+				{{
+					"color": "red",
+					"total": float64(3),
+				}},
+				{{
+					"color": "blue",
+					"total": float64(6),
+				}},
+				{{
+					"color": "blue",
+					"total": float64(8),
+				}},
+				{{
+					"color": "yellow",
+					"total": float64(4),
+				}},
+				{{
+					"color": "red",
+					"total": float64(4),
+				}},
+			},
+			M: map[string]interface{}{
+				"op_2_analytic_0_exceptions_total":  int64(0),
+				"op_2_analytic_0_records_in_total":  int64(5),
+				"op_2_analytic_0_records_out_total": int64(5),
+
+				"sink_mockSink_0_exceptions_total":  int64(0),
+				"sink_mockSink_0_records_in_total":  int64(5),
+				"sink_mockSink_0_records_out_total": int64(5),
+			},
+		},
+	}
+	// Data setup
+	HandleStream(true, streamList, t)
+	options := []*api.RuleOption{
+		{
+			BufferLength: 100,
+			SendError:    true,
+		},
+		{
+			BufferLength: 100,
+			SendError:    true,
+			Concurrency:  2,
+		},
+	}
+	for j, opt := range options {
+		DoRuleTest(t, tests, j, opt, 0)
+	}
+}
@@ -1755,3 +1755,131 @@ func TestEventSlidingWindow(t *testing.T) {
 		DoRuleTest(t, tests, j, opt, 10)
 	}
 }
+
+func TestWindowGapFill(t *testing.T) {
+	// Reset
+	streamList := []string{"demo"}
+	HandleStream(false, streamList, t)
+	tests := []RuleTest{
+		{
+			Name: `TestWindowGapFillRule1`,
+			Sql:  `SELECT color, sum(size) AS s FROM demo GROUP BY color, TUMBLINGWINDOW(ss, 1) ORDER BY color`,
+			R: [][]map[string]interface{}{
+				{{
+					"color": "blue",
+					"s":     float64(6),
+				}, {
+					"color": "red",
+					"s":     float64(3),
+				}},
+				{{
+					"color": "red",
+					"s":     float64(3),
+				}, {
+					"color": "blue",
+					"s":     float64(2),
+				}},
+				{{
+					"color": "blue",
+					"s":     float64(2),
+				}, {
+					"color": "red",
+					"s":     float64(3),
+				}, {
+					"color": "yellow",
+					"s":     float64(4),
+				}},
+				{{
+					"color": "blue",
+					"s":     float64(2),
+				}, {
+					"color": "yellow",
+					"s":     float64(4),
+				}, {
+					"color": "red",
+					"s":     float64(1),
+				}},
+			},
+			M: map[string]interface{}{
+				"op_6_fill_0_exceptions_total":  int64(0),
+				"op_6_fill_0_records_in_total":  int64(4),
+				"op_6_fill_0_records_out_total": int64(4),
+
+				"sink_mockSink_0_exceptions_total":  int64(0),
+				"sink_mockSink_0_records_in_total":  int64(4),
+				"sink_mockSink_0_records_out_total": int64(4),
+			},
+		},
+	}
+	// Data setup
+	HandleStream(true, streamList, t)
+	options := []*api.RuleOption{
+		{
+			BufferLength: 100,
+			SendError:    true,
+			GapFill:      "previous",
+		},
+		{
+			BufferLength: 100,
+			SendError:    true,
+			GapFill:      "previous",
+			Concurrency:  2,
+		},
+	}
+	for j, opt := range options {
+		DoRuleTest(t, tests, j, opt, 0)
+	}
+}
+
+func TestWindowTopN(t *testing.T) {
+	// Reset
+	streamList := []string{"demo"}
+	HandleStream(false, streamList, t)
+	tests := []RuleTest{
+		{
+			Name: `TestWindowTopNRule1`,
+			Sql:  `SELECT color, topn(size, 2) AS t FROM demo GROUP BY color, TUMBLINGWINDOW(ss, 2) ORDER BY color`,
+			R: [][]map[string]interface{}{
+				{{
+					"color": "blue",
+					"t":     []interface{}{float64(6), float64(2)},
+				}, {
+					"color": "red",
+					"t":     []interface{}{float64(3)},
+				}},
+				{{
+					"color": "red",
+					"t":     []interface{}{float64(1)},
+				}, {
+					"color": "yellow",
+					"t":     []interface{}{float64(4)},
+				}},
+			},
+			M: map[string]interface{}{
+				"op_2_window_0_exceptions_total":  int64(0),
+				"op_2_window_0_records_in_total":  int64(5),
+				"op_2_window_0_records_out_total": int64(2),
+
+				"sink_mockSink_0_exceptions_total":  int64(0),
+				"sink_mockSink_0_records_in_total":  int64(2),
+				"sink_mockSink_0_records_out_total": int64(2),
+			},
+		},
+	}
+	// Data setup
+	HandleStream(true, streamList, t)
+	options := []*api.RuleOption{
+		{
+			BufferLength: 100,
+			SendError:    true,
+		},
+		{
+			BufferLength: 100,
+			SendError:    true,
+			Concurrency:  2,
+		},
+	}
+	for j, opt := range options {
+		DoRuleTest(t, tests, j, opt, 0)
+	}
+}
@@ -24,7 +24,7 @@ func IsAggregate(expr ast.Expr) (r bool) {
 	ast.WalkFunc(expr, func(n ast.Node) bool {
 		switch f := n.(type) {
 		case *ast.Call:
-			if ok := function.IsAggFunc(f.Name); ok {
+			if ok := isAggCall(f); ok {
 				r = true
 				return false
 			}
@@ -64,7 +64,7 @@ func WithAggFields(stmt *ast.SelectStatement) bool {
 	ast.WalkFunc(stmt.Fields, func(n ast.Node) bool {
 		switch f := n.(type) {
 		case *ast.Call:
-			if ok := function.IsAggFunc(f.Name); ok {
+			if ok := isAggCall(f); ok {
 				r = true
 				return false
 			}
@@ -81,7 +81,7 @@ func HasAggFuncs(node ast.Node) bool {
 	r := false
 	ast.WalkFunc(node, func(n ast.Node) bool {
 		if f, ok := n.(*ast.Call); ok {
-			if ok := function.IsAggFunc(f.Name); ok {
+			if ok := isAggCall(f); ok {
 				r = true
 				return false
 			}
@@ -90,3 +90,9 @@ func HasAggFuncs(node ast.Node) bool {
 	})
 	return r
 }
+
+// isAggCall checks if the call is an aggregate function. The aggregate function over a ROWS frame is calculated
+// row by row like the analytic functions, so it is not an aggregate.
+func isAggCall(f *ast.Call) bool {
+	return f.Frame == nil && function.IsAggFunc(f.Name)
+}
@@ -532,6 +532,14 @@ func NewWindowRange(windowStart int64, windowEnd int64) *WindowRange {
 	return &WindowRange{windowStart, windowEnd}
 }
 
+func (r *WindowRange) WindowStart() int64 {
+	return r.windowStart
+}
+
+func (r *WindowRange) WindowEnd() int64 {
+	return r.windowEnd
+}
+
 func (r *WindowRange) FuncValue(key string) (interface{}, bool) {
 	switch key {
 	case "window_start":
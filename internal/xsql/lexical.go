@@ -146,6 +146,8 @@ func (s *Scanner) Scan() (tok ast.Token, lit string) {
 		return ast.HASH, ast.Tokens[ast.HASH]
 	case ';':
 		return ast.SEMICOLON, ast.Tokens[ast.SEMICOLON]
+	case '?':
+		return ast.QUESTION, ast.Tokens[ast.QUESTION]
 	}
 	return ast.ILLEGAL, ""
 }
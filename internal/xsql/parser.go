@@ -146,13 +146,90 @@ func (p *Parser) ParseQueries() ([]ast.SelectStatement, error) {
 }
 
 func (p *Parser) Parse() (*ast.SelectStatement, error) {
-	selects := &ast.SelectStatement{}
-
-	if tok, lit := p.scanIgnoreWhitespace(); tok == ast.EOF {
+	var ctes []*ast.CTE
+	tok, lit := p.scanIgnoreWhitespace()
+	if tok == ast.EOF {
 		return nil, nil
-	} else if tok != ast.SELECT {
+	} else if tok == ast.IDENT && strings.ToUpper(lit) == ast.WITH {
+		var err error
+		if ctes, err = p.parseCTEs(); err != nil {
+			return nil, err
+		}
+		tok, lit = p.scanIgnoreWhitespace()
+	}
+	if tok != ast.SELECT {
 		return nil, fmt.Errorf("Found %q, Expected SELECT.\n", lit)
 	}
+	selects, err := p.parseSelect()
+	if err != nil {
+		return nil, err
+	}
+	selects.With = ctes
+	if tok, lit := p.scanIgnoreWhitespace(); tok == ast.SEMICOLON {
+		validateFields(selects, p.sourceNames)
+		p.unscan()
+		return selects, nil
+	} else if tok != ast.EOF {
+		return nil, fmt.Errorf("found %q, expected EOF.", lit)
+	}
+
+	if err := Validate(selects); err != nil {
+		return nil, err
+	}
+	validateFields(selects, p.sourceNames)
+	return selects, nil
+}
+
+// parseCTEs parses the common table expressions after WITH, such as `WITH a AS (SELECT ...), b AS (SELECT ...)`
+func (p *Parser) parseCTEs() ([]*ast.CTE, error) {
+	var ctes []*ast.CTE
+	names := make(map[string]bool)
+	for {
+		tok, name := p.scanIgnoreWhitespace()
+		if tok != ast.IDENT {
+			return nil, fmt.Errorf("Found %q in WITH, expect the name of CTE.", name)
+		}
+		if names[name] {
+			return nil, fmt.Errorf("CTE %s is defined more than once.", name)
+		}
+		names[name] = true
+		if tok, lit := p.scanIgnoreWhitespace(); tok != ast.AS {
+			return nil, fmt.Errorf("Found %q after CTE %s, expect AS.", lit, name)
+		}
+		if tok, lit := p.scanIgnoreWhitespace(); tok != ast.LPAREN {
+			return nil, fmt.Errorf("Found %q after CTE %s AS, expect left parentheses.", lit, name)
+		}
+		if tok, lit := p.scanIgnoreWhitespace(); tok != ast.SELECT {
+			return nil, fmt.Errorf("Found %q in CTE %s, expect SELECT.", lit, name)
+		}
+		// the source names of the CTE are its own sources
+		sourceNames := p.sourceNames
+		p.sourceNames = nil
+		stmt, err := p.parseSelect()
+		cteSources := p.sourceNames
+		p.sourceNames = sourceNames
+		if err != nil {
+			return nil, err
+		}
+		if tok, lit := p.scanIgnoreWhitespace(); tok != ast.RPAREN {
+			return nil, fmt.Errorf("Found %q in CTE %s, expect right parentheses.", lit, name)
+		}
+		if err := Validate(stmt); err != nil {
+			return nil, err
+		}
+		validateFields(stmt, cteSources)
+		ctes = append(ctes, &ast.CTE{Name: name, Stmt: stmt})
+		if tok, _ := p.scanIgnoreWhitespace(); tok != ast.COMMA {
+			p.unscan()
+			break
+		}
+	}
+	return ctes, nil
+}
+
+// parseSelect parses the clauses of the select statement after SELECT
+func (p *Parser) parseSelect() (*ast.SelectStatement, error) {
+	selects := &ast.SelectStatement{}
 	p.clause = "select"
 	if fields, err := p.parseFields(); err != nil {
 		return nil, err
@@ -166,15 +243,35 @@ func (p *Parser) Parse() (*ast.SelectStatement, error) {
 		selects.Sources = src
 	}
 	p.clause = "join"
-	if joins, err := p.parseJoins(); err != nil {
+	if joins, unnest, err := p.parseJoins(); err != nil {
 		return nil, err
 	} else {
 		selects.Joins = joins
+		selects.Unnest = unnest
+	}
+	p.clause = "pivot"
+	if err := p.parsePivot(selects); err != nil {
+		return nil, err
+	}
+	p.clause = "match_recognize"
+	if m, err := p.parseMatchRecognize(); err != nil {
+		return nil, err
+	} else if m != nil {
+		if len(selects.Joins) > 0 {
+			return nil, fmt.Errorf("MATCH_RECOGNIZE does not support join.")
+		}
+		selects.MatchRecognize = m
 	}
 	// The source names may be injected from outside to parse part of the sql
 	if p.sourceNames == nil {
 		p.sourceNames = getStreamNames(selects)
 	}
+	p.clause = "dedup"
+	if d, err := p.parseDedup(); err != nil {
+		return nil, err
+	} else {
+		selects.Dedup = d
+	}
 	p.clause = "where"
 	if exp, err := p.ParseCondition(); err != nil {
 		return nil, err
@@ -211,18 +308,6 @@ func (p *Parser) Parse() (*ast.SelectStatement, error) {
 		}
 	}
 	p.clause = ""
-	if tok, lit := p.scanIgnoreWhitespace(); tok == ast.SEMICOLON {
-		validateFields(selects, p.sourceNames)
-		p.unscan()
-		return selects, nil
-	} else if tok != ast.EOF {
-		return nil, fmt.Errorf("found %q, expected EOF.", lit)
-	}
-
-	if err := Validate(selects); err != nil {
-		return nil, err
-	}
-	validateFields(selects, p.sourceNames)
 	return selects, nil
 }
 
@@ -235,28 +320,82 @@ func (p *Parser) parseSource() (ast.Sources, error) {
 	if src, alias, err := p.parseSourceLiteral(); err != nil {
 		return nil, err
 	} else {
-		sources = append(sources, &ast.Table{Name: src, Alias: alias})
+		t := &ast.Table{Name: src, Alias: alias}
+		if t.Union, err = p.parseUnion(src); err != nil {
+			return nil, err
+		}
+		sources = append(sources, t)
 	}
 
 	return sources, nil
 }
 
+// parseUnion parses the streams merged by UNION ALL after the first stream, such as `s1 UNION ALL s2 UNION ALL s3`
+func (p *Parser) parseUnion(first string) ([]string, error) {
+	var union []string
+	names := map[string]bool{first: true}
+	for {
+		if !p.scanSubClause("UNION") {
+			return union, nil
+		}
+		if tok, lit := p.scanIgnoreWhitespace(); tok != ast.IDENT || strings.ToUpper(lit) != "ALL" {
+			return nil, fmt.Errorf("Found %q after UNION, expect ALL.", lit)
+		}
+		src, alias, err := p.parseSourceLiteral()
+		if err != nil {
+			return nil, err
+		}
+		if src == "" {
+			return nil, fmt.Errorf("Cannot find the stream after UNION ALL.")
+		}
+		if alias != "" {
+			return nil, fmt.Errorf("Found alias %s of %s in UNION ALL, only the first stream can have alias.", alias, src)
+		}
+		if names[src] {
+			return nil, fmt.Errorf("Stream %s is merged by UNION ALL more than once.", src)
+		}
+		names[src] = true
+		union = append(union, src)
+	}
+}
+
+// sourceClauses are the names of the clauses which could follow the source. They are not reserved words so that they
+// can still be used as field names
+var sourceClauses = map[string]bool{
+	"MATCH_RECOGNIZE": true,
+	"FOR":             true,
+	"DEDUP":           true,
+	"UNION":           true,
+	"PIVOT":           true,
+	"UNPIVOT":         true,
+}
+
+// isSourceToken returns whether the token is a segment of the source literal. An identifier of the clause name after
+// another identifier starts the clause instead
+func isSourceToken(prev ast.Token, tok ast.Token, lit string) bool {
+	return tok.AllowedSourceToken() && !(prev == ast.IDENT && tok == ast.IDENT && sourceClauses[strings.ToUpper(lit)])
+}
+
 // TODO Current func has problems when the source includes white space.
 func (p *Parser) parseSourceLiteral() (string, string, error) {
 	var sourceSeg []string
 	var alias string
+	prev := ast.ILLEGAL
 	for {
 		// HASH, DIV & ADD token is specially support for MQTT topic name patterns.
-		if tok, lit := p.scanIgnoreWhitespace(); tok.AllowedSourceToken() {
+		if tok, lit := p.scanIgnoreWhitespace(); isSourceToken(prev, tok, lit) {
 			sourceSeg = append(sourceSeg, lit)
+			prev = tok
 			if tok1, lit1 := p.scanIgnoreWhitespace(); tok1 == ast.AS {
 				if tok2, lit2 := p.scanIgnoreWhitespace(); tok2 == ast.IDENT {
 					alias = lit2
+					prev = tok2
 				} else {
 					return "", "", fmt.Errorf("found %q, expected JOIN key word.", lit)
 				}
-			} else if tok1.AllowedSourceToken() {
+			} else if isSourceToken(prev, tok1, lit1) {
 				sourceSeg = append(sourceSeg, lit1)
+				prev = tok1
 			} else {
 				p.unscan()
 				break
@@ -293,8 +432,11 @@ func (p *Parser) parseFieldNameSections(isSubField bool) ([]string, error) {
 	return fieldNameSects, nil
 }
 
-func (p *Parser) parseJoins() (ast.Joins, error) {
-	var joins ast.Joins
+func (p *Parser) parseJoins() (ast.Joins, *ast.Unnest, error) {
+	var (
+		joins  ast.Joins
+		unnest *ast.Unnest
+	)
 	for {
 		if tok, lit := p.scanIgnoreWhitespace(); tok == ast.INNER || tok == ast.LEFT || tok == ast.RIGHT || tok == ast.FULL || tok == ast.CROSS {
 			if tok1, _ := p.scanIgnoreWhitespace(); tok1 == ast.JOIN {
@@ -310,26 +452,68 @@ func (p *Parser) parseJoins() (ast.Joins, error) {
 					jt = ast.FULL_JOIN
 				case ast.CROSS:
 					jt = ast.CROSS_JOIN
+					if p.scanUnnest() {
+						if unnest != nil || len(joins) > 0 {
+							return nil, nil, fmt.Errorf("UNNEST must be the first join and used only once.")
+						}
+						u, err := p.parseUnnest()
+						if err != nil {
+							return nil, nil, err
+						}
+						unnest = u
+						continue
+					}
 				}
 
 				if j, err := p.ParseJoin(jt); err != nil {
-					return nil, err
+					return nil, nil, err
 				} else {
 					joins = append(joins, *j)
 				}
 			} else {
-				return nil, fmt.Errorf("found %q, expected JOIN key word.", lit)
+				return nil, nil, fmt.Errorf("found %q, expected JOIN key word.", lit)
 			}
 		} else {
 			p.unscan()
 			if len(joins) > 0 {
-				return joins, nil
+				return joins, unnest, nil
 			}
-			return nil, nil
+			return nil, unnest, nil
 		}
 	}
 }
 
+// scanUnnest checks if the join is UNNEST followed by left parentheses
+func (p *Parser) scanUnnest() bool {
+	if tok, lit := p.scanIgnoreWhitespace(); tok == ast.IDENT && strings.ToUpper(lit) == "UNNEST" {
+		if tok1, _ := p.scanIgnoreWhitespace(); tok1 == ast.LPAREN {
+			return true
+		}
+		p.unscan()
+	}
+	p.unscan()
+	return false
+}
+
+// parseUnnest parses the array expression and the alias after `CROSS JOIN UNNEST(`, such as `UNNEST(readings) AS r`
+func (p *Parser) parseUnnest() (*ast.Unnest, error) {
+	expr, err := p.ParseExpr()
+	if err != nil {
+		return nil, err
+	}
+	if tok, lit := p.scanIgnoreWhitespace(); tok != ast.RPAREN {
+		return nil, fmt.Errorf("Found %q in UNNEST, expect right parentheses.", lit)
+	}
+	if tok, lit := p.scanIgnoreWhitespace(); tok != ast.AS {
+		return nil, fmt.Errorf("Found %q after UNNEST, expect AS.", lit)
+	}
+	tok, alias := p.scanIgnoreWhitespace()
+	if tok != ast.IDENT {
+		return nil, fmt.Errorf("Found %q after UNNEST AS, expect the alias of the element.", alias)
+	}
+	return &ast.Unnest{Expr: expr, Alias: alias}, nil
+}
+
 func (p *Parser) ParseJoin(joinType ast.JoinType) (*ast.Join, error) {
 	j := &ast.Join{JoinType: joinType}
 	if src, alias, err := p.parseSourceLiteral(); err != nil {
@@ -337,6 +521,24 @@ func (p *Parser) ParseJoin(joinType ast.JoinType) (*ast.Join, error) {
 	} else {
 		j.Name = src
 		j.Alias = alias
+		if p.scanSubClause("FOR") {
+			if !p.scanSubClause("SYSTEM_TIME") {
+				_, lit := p.scanIgnoreWhitespace()
+				return nil, fmt.Errorf("found %q, expected SYSTEM_TIME after FOR.", lit)
+			}
+			if tok1, lit1 := p.scanIgnoreWhitespace(); tok1 != ast.AS {
+				return nil, fmt.Errorf("found %q, expected AS OF after SYSTEM_TIME.", lit1)
+			}
+			if !p.scanSubClause("OF") {
+				_, lit := p.scanIgnoreWhitespace()
+				return nil, fmt.Errorf("found %q, expected AS OF after SYSTEM_TIME.", lit)
+			}
+			if exp, err := p.ParseExpr(); err != nil {
+				return nil, err
+			} else {
+				j.AsOf = exp
+			}
+		}
 		if tok1, _ := p.scanIgnoreWhitespace(); tok1 == ast.ON {
 			if ast.CROSS_JOIN == joinType {
 				return nil, fmt.Errorf("On expression is not required for cross join type.\n")
@@ -396,6 +598,11 @@ func (p *Parser) parseSorts() (ast.SortFields, error) {
 	if t, _ := p.scanIgnoreWhitespace(); t == ast.ORDER {
 		if t1, l1 := p.scanIgnoreWhitespace(); t1 == ast.BY {
 			for {
+				// the ROWS frame in the OVER clause ends the sort fields
+				if p.scanFrame() {
+					p.unscan()
+					break
+				}
 				if t1, _ = p.scanIgnoreWhitespace(); t1 == ast.IDENT {
 					s := ast.SortField{Ascending: true}
 
@@ -647,6 +854,11 @@ func (p *Parser) parseBetween(lhs ast.Expr, op ast.Token) (ast.Expr, error) {
 
 func (p *Parser) parseUnaryExpr(isSubField bool) (ast.Expr, error) {
 	if tok1, _ := p.scanIgnoreWhitespace(); tok1 == ast.LPAREN {
+		if tok2, _ := p.scanIgnoreWhitespace(); tok2 == ast.SELECT {
+			p.unscan()
+			return p.parseSubquery(true)
+		}
+		p.unscan()
 		expr, err := p.ParseExpr()
 		if err != nil {
 			return nil, err
@@ -745,6 +957,17 @@ func (p *Parser) parseValueSetExpr() (ast.Expr, error) {
 	// IN ("A", "B") or IN expression
 	tk, _ := p.scanIgnoreWhitespace()
 	if tk == ast.LPAREN {
+		// IN (SELECT id FROM table)
+		if tok1, _ := p.scanIgnoreWhitespace(); tok1 == ast.SELECT {
+			p.unscan()
+			sq, err := p.parseSubquery(false)
+			if err != nil {
+				return nil, err
+			}
+			valsetExpr.ArrayExpr = sq
+			return valsetExpr, nil
+		}
+		p.unscan()
 		for {
 			element, err := p.ParseExpr()
 			if err != nil {
@@ -775,6 +998,54 @@ func (p *Parser) parseValueSetExpr() (ast.Expr, error) {
 	}
 }
 
+// parseSubquery parses the subquery after the left parentheses until the right parentheses. The subquery only supports
+// a single field from a table with an optional WHERE clause and can only be used in the SELECT and WHERE clauses.
+func (p *Parser) parseSubquery(scalar bool) (ast.Expr, error) {
+	if p.clause != "select" && p.clause != "where" {
+		return nil, fmt.Errorf("subquery is only supported in SELECT and WHERE clause.")
+	}
+	clause, sourceNames, inFunc := p.clause, p.sourceNames, p.inFunc
+	defer func() {
+		p.clause, p.sourceNames, p.inFunc = clause, sourceNames, inFunc
+	}()
+	p.inFunc = ""
+	// the subquery can not be nested
+	p.clause = "subquery"
+	stmt := &ast.SelectStatement{}
+	if tok, lit := p.scanIgnoreWhitespace(); tok != ast.SELECT {
+		return nil, fmt.Errorf("Found %q, Expected SELECT.\n", lit)
+	}
+	fields, err := p.parseFields()
+	if err != nil {
+		return nil, err
+	}
+	if len(fields) != 1 {
+		return nil, fmt.Errorf("subquery must select exactly one field.")
+	}
+	if _, ok := fields[0].Expr.(*ast.Wildcard); ok {
+		return nil, fmt.Errorf("subquery must select exactly one field.")
+	}
+	stmt.Fields = fields
+	if stmt.Sources, err = p.parseSource(); err != nil {
+		return nil, err
+	}
+	p.sourceNames = getStreamNames(stmt)
+	if stmt.Condition, err = p.ParseCondition(); err != nil {
+		return nil, err
+	}
+	if tok, lit := p.scanIgnoreWhitespace(); tok != ast.RPAREN {
+		return nil, fmt.Errorf("Found %q in subquery, expect right parentheses.", lit)
+	}
+	if HasAggFuncs(stmt.Condition) {
+		return nil, fmt.Errorf("Not allowed to call aggregate functions in WHERE clause.")
+	}
+	if !scalar && HasAggFuncs(stmt.Fields[0].Expr) {
+		return nil, fmt.Errorf("Not allowed to call aggregate functions in IN subquery.")
+	}
+	validateFields(stmt, p.sourceNames)
+	return &ast.SubqueryExpr{Stmt: stmt, Scalar: scalar}, nil
+}
+
 func (p *Parser) parseBracketExpr() (ast.Expr, error) {
 	tok2, lit2 := p.scanIgnoreWhiteSpaceWithNegativeNum()
 	if tok2 == ast.RBRACKET {
@@ -863,11 +1134,12 @@ func (p *Parser) parseAs(f *ast.Field) (*ast.Field, error) {
 }
 
 var WindowFuncs = map[string]struct{}{
-	"tumblingwindow": {},
-	"hoppingwindow":  {},
-	"sessionwindow":  {},
-	"slidingwindow":  {},
-	"countwindow":    {},
+	"tumblingwindow":    {},
+	"hoppingwindow":     {},
+	"sessionwindow":     {},
+	"slidingwindow":     {},
+	"countwindow":       {},
+	"countortimewindow": {},
 }
 
 func convFuncName(n string) (string, bool) {
@@ -943,12 +1215,12 @@ func (p *Parser) parseCall(n string) (ast.Expr, error) {
 		} else if f != nil {
 			win.Filter = f
 		}
-		// parse over when clause
-		c, err := p.ParseOver4Window()
-		if err != nil {
+		// parse over clause
+		if err := p.ParseOver4Window(win); err != nil {
+			return nil, err
+		}
+		if err := p.parseRollup(win); err != nil {
 			return nil, err
-		} else if c != nil {
-			win.TriggerCondition = c
 		}
 
 		return win, nil
@@ -1064,7 +1336,14 @@ func validateWindows(fname string, args []ast.Expr) (ast.WindowType, error) {
 		} else {
 			return ast.COUNT_WINDOW, fmt.Errorf("Invalid parameter count.")
 		}
-
+	case "countortimewindow":
+		if err := validateWindow(fname, 3, args); err != nil {
+			return ast.COUNT_OR_TIME_WINDOW, err
+		}
+		if args[1].(*ast.IntegerLiteral).Val <= 0 || args[2].(*ast.IntegerLiteral).Val <= 0 {
+			return ast.COUNT_OR_TIME_WINDOW, fmt.Errorf("The duration and count for %s should be greater than 0.", fname)
+		}
+		return ast.COUNT_OR_TIME_WINDOW, nil
 	}
 	return ast.NOT_WINDOW, nil
 }
@@ -1506,6 +1785,12 @@ func (p *Parser) parseStreamOptions() (*ast.Options, error) {
 							} else {
 								opts.RETAIN_SIZE = val
 							}
+						case ast.HISTORY_SIZE:
+							if val, err := strconv.Atoi(lit3); err != nil || val < 0 {
+								return nil, fmt.Errorf("found %q, expect number value in %s option.", lit3, lit1)
+							} else {
+								opts.HISTORY_SIZE = val
+							}
 						case ast.SHARED:
 							if val := strings.ToUpper(lit3); (val != "TRUE") && (val != "FALSE") {
 								return nil, fmt.Errorf("found %q, expect TRUE/FALSE value in %s option.", lit3, lit1)
@@ -1549,25 +1834,77 @@ func (p *Parser) parseStreamOptions() (*ast.Options, error) {
 	return opts, nil
 }
 
-func (p *Parser) ParseOver4Window() (ast.Expr, error) {
+// ParseOver4Window parses the over clause of the window, which could have the trigger condition by WHEN. The session
+// window could also be partitioned by PARTITION BY to have a session for each key. The trigger condition of the
+// tumbling and session window could have aggregate functions to emit the window before it closes.
+func (p *Parser) ParseOver4Window(win *ast.Window) error {
 	if tok, _ := p.scanIgnoreWhitespace(); tok != ast.OVER {
 		p.unscan()
-		return nil, nil
+		return nil
 	}
 	if tok, lit := p.scanIgnoreWhitespace(); tok != ast.LPAREN {
-		return nil, fmt.Errorf("Found %q after OVER, expect parentheses.", lit)
+		return fmt.Errorf("Found %q after OVER, expect parentheses.", lit)
+	}
+	tok, lit := p.scanIgnoreWhitespace()
+	if tok == ast.PARTITION {
+		if win.WindowType != ast.SESSION_WINDOW {
+			return fmt.Errorf("PARTITION BY is only supported by session window.")
+		}
+		pe, err := p.parsePartitionBy()
+		if err != nil {
+			return err
+		}
+		win.Partition = pe
+		if tok, lit = p.scanIgnoreWhitespace(); tok == ast.RPAREN {
+			return nil
+		}
 	}
-	if tok, lit := p.scanIgnoreWhitespace(); tok != ast.WHEN {
-		return nil, fmt.Errorf("Found %q after OVER(, expect WHEN.", lit)
+	if tok != ast.WHEN {
+		return fmt.Errorf("Found %q after OVER(, expect WHEN.", lit)
+	}
+	switch win.WindowType {
+	case ast.SLIDING_WINDOW, ast.TUMBLING_WINDOW, ast.SESSION_WINDOW:
+	default:
+		return fmt.Errorf("WHEN is only supported by sliding, tumbling and session window.")
 	}
 	expr, err := p.ParseExpr()
 	if err != nil {
-		return nil, err
+		return err
 	}
 	if tok, lit := p.scanIgnoreWhitespace(); tok != ast.RPAREN {
-		return nil, fmt.Errorf("Found %q after OVER, expect right parentheses.", lit)
+		return fmt.Errorf("Found %q after OVER, expect right parentheses.", lit)
+	}
+	win.TriggerCondition = expr
+	return nil
+}
+
+// parseRollup parses the rollup tiers after the tumbling window, such as `ROLLUP(hh, dd)`. Each tier aggregates the
+// results of the finer tier by one unit of the natural time.
+func (p *Parser) parseRollup(win *ast.Window) error {
+	if tok, lit := p.scanIgnoreWhitespace(); tok != ast.IDENT || !strings.EqualFold(lit, "ROLLUP") {
+		p.unscan()
+		return nil
+	}
+	if win.WindowType != ast.TUMBLING_WINDOW {
+		return fmt.Errorf("ROLLUP is only supported by tumbling window.")
+	}
+	if tok, lit := p.scanIgnoreWhitespace(); tok != ast.LPAREN {
+		return fmt.Errorf("Found %q after ROLLUP, expect parentheses.", lit)
+	}
+	for {
+		tok, lit := p.scanIgnoreWhitespace()
+		if !tok.IsTimeLiteral() {
+			return fmt.Errorf("Found %q in ROLLUP, expect timer literal expression. One value of [dd|hh|mi|ss|ms].", lit)
+		}
+		win.Rollup = append(win.Rollup, &ast.TimeLiteral{Val: tok})
+		tok, lit = p.scanIgnoreWhitespace()
+		if tok == ast.RPAREN {
+			return nil
+		}
+		if tok != ast.COMMA {
+			return fmt.Errorf("Found %q in ROLLUP, expect comma or right parentheses.", lit)
+		}
 	}
-	return expr, nil
 }
 
 // Only support filter on window now
@@ -1668,34 +2005,41 @@ func (p *Parser) parseOver(c *ast.Call) error {
 	if tok, _ := p.scanIgnoreWhitespace(); tok != ast.OVER {
 		p.unscan()
 		return nil
-	} else if function.IsAnalyticFunc(c.Name) || function.IsWindowFunc(c.Name) {
+	} else if function.IsAnalyticFunc(c.Name) || function.IsWindowFunc(c.Name) || function.IsFrameFunc(c.Name) {
 		if tok1, _ := p.scanIgnoreWhitespace(); tok1 == ast.LPAREN {
 			if t, _ := p.scanIgnoreWhitespace(); t == ast.PARTITION {
-				if t1, l1 := p.scanIgnoreWhitespace(); t1 == ast.BY {
-					pe := &ast.PartitionExpr{}
-					for {
-						if exp, err := p.ParseExpr(); err != nil {
-							return err
-						} else {
-							pe.Exprs = append(pe.Exprs, exp)
-						}
-						if tok, _ := p.scanIgnoreWhitespace(); tok == ast.COMMA {
-							continue
-						}
-						p.unscan()
-						break
-					}
-					if len(pe.Exprs) == 0 {
-						return fmt.Errorf("PARTITION BY must have at least one expression.")
-					}
-					c.Partition = pe
-				} else {
-					return fmt.Errorf("found %q, expected by after partition.", l1)
+				pe, err := p.parsePartitionBy()
+				if err != nil {
+					return err
 				}
+				c.Partition = pe
 			} else {
 				p.unscan()
 			}
 
+			if function.IsFrameFunc(c.Name) {
+				if sorts, err := p.parseSorts(); err != nil {
+					return err
+				} else if len(sorts) > 0 {
+					c.OrderBy = sorts
+				}
+				if p.scanFrame() {
+					fe, err := p.parseFrame()
+					if err != nil {
+						return err
+					}
+					c.Frame = fe
+				} else {
+					// Without the ROWS frame, the function is over the rows from the start to the current row
+					if c.OrderBy != nil {
+						c.Frame = &ast.FrameExpr{Preceding: -1}
+					}
+				}
+				if c.Frame == nil {
+					return fmt.Errorf("Found OVER after non analytic function %s", c.Name)
+				}
+			}
+
 			if t, _ := p.scanIgnoreWhitespace(); t == ast.WHEN {
 				if exp, err := p.ParseExpr(); err != nil {
 					return err
@@ -1705,12 +2049,12 @@ func (p *Parser) parseOver(c *ast.Call) error {
 			} else {
 				p.unscan()
 			}
-			if c.Partition != nil || c.WhenExpr != nil {
+			if c.Partition != nil || c.WhenExpr != nil || c.Frame != nil {
 				if ttt, _ := p.scanIgnoreWhitespace(); ttt != ast.RPAREN {
 					return fmt.Errorf("Found %q, expect right parentheses after OVER ", ttt)
 				}
 			}
-			if c.Partition == nil && c.WhenExpr == nil {
+			if c.Partition == nil && c.WhenExpr == nil && c.Frame == nil {
 				ttt, _ := p.scanIgnoreWhitespace()
 				return fmt.Errorf("Found %q after OVER (, expect partition by or when.", ttt)
 			}
@@ -1722,3 +2066,404 @@ func (p *Parser) parseOver(c *ast.Call) error {
 		return fmt.Errorf("Found OVER after non analytic function %s", c.Name)
 	}
 }
+
+// scanFrame returns whether the next tokens start the ROWS frame and consumes ROWS if so. ROWS is not a reserved word so
+// that it can still be used as field name. It only starts the frame when followed by the frame size or BETWEEN
+func (p *Parser) scanFrame() bool {
+	if tok, lit := p.scanIgnoreWhitespace(); tok == ast.IDENT && strings.EqualFold(lit, "ROWS") {
+		tok1, lit1 := p.scanIgnoreWhitespace()
+		p.unscan()
+		if tok1 == ast.INTEGER || tok1 == ast.BETWEEN || tok1 == ast.IDENT && strings.EqualFold(lit1, "UNBOUNDED") {
+			return true
+		}
+	}
+	p.unscan()
+	return false
+}
+
+// parseFrame parses the frame after ROWS. The frame must end at the current row like
+// ROWS BETWEEN 2 PRECEDING AND CURRENT ROW or its short form ROWS 2 PRECEDING.
+func (p *Parser) parseFrame() (*ast.FrameExpr, error) {
+	between := false
+	if t, _ := p.scanIgnoreWhitespace(); t == ast.BETWEEN {
+		between = true
+	} else {
+		p.unscan()
+	}
+	fe := &ast.FrameExpr{}
+	t, lit := p.scanIgnoreWhitespace()
+	switch {
+	case t == ast.INTEGER:
+		n, err := strconv.Atoi(lit)
+		if err != nil {
+			return nil, fmt.Errorf("invalid frame size %s", lit)
+		}
+		fe.Preceding = n
+	case t == ast.IDENT && strings.EqualFold(lit, "UNBOUNDED"):
+		fe.Preceding = -1
+	default:
+		return nil, fmt.Errorf("Found %q after ROWS, expect UNBOUNDED or an integer.", lit)
+	}
+	if t, lit = p.scanIgnoreWhitespace(); t != ast.IDENT || !strings.EqualFold(lit, "PRECEDING") {
+		return nil, fmt.Errorf("Found %q in ROWS, expect PRECEDING.", lit)
+	}
+	if between {
+		if t, lit = p.scanIgnoreWhitespace(); t != ast.AND {
+			return nil, fmt.Errorf("Found %q in ROWS BETWEEN, expect AND.", lit)
+		}
+		t1, l1 := p.scanIgnoreWhitespace()
+		t2, l2 := p.scanIgnoreWhitespace()
+		if t1 != ast.IDENT || !strings.EqualFold(l1, "CURRENT") || t2 != ast.IDENT || !strings.EqualFold(l2, "ROW") {
+			return nil, fmt.Errorf("Found %q in ROWS BETWEEN, expect CURRENT ROW.", l1+" "+l2)
+		}
+	}
+	return fe, nil
+}
+
+// parsePartitionBy parses the expressions after PARTITION
+func (p *Parser) parsePartitionBy() (*ast.PartitionExpr, error) {
+	if t1, l1 := p.scanIgnoreWhitespace(); t1 != ast.BY {
+		return nil, fmt.Errorf("found %q, expected by after partition.", l1)
+	}
+	pe := &ast.PartitionExpr{}
+	for {
+		if exp, err := p.ParseExpr(); err != nil {
+			return nil, err
+		} else {
+			pe.Exprs = append(pe.Exprs, exp)
+		}
+		if tok, _ := p.scanIgnoreWhitespace(); tok == ast.COMMA {
+			continue
+		}
+		p.unscan()
+		break
+	}
+	if len(pe.Exprs) == 0 {
+		return nil, fmt.Errorf("PARTITION BY must have at least one expression.")
+	}
+	return pe, nil
+}
+
+// parseMatchRecognize parses the MATCH_RECOGNIZE clause. The clause and its sub clauses like PATTERN are matched by the
+// identifiers instead of keywords so that they can still be used as field names.
+func (p *Parser) parseMatchRecognize() (*ast.MatchRecognize, error) {
+	if !p.scanSubClause("MATCH_RECOGNIZE") {
+		return nil, nil
+	}
+	if tok, lit := p.scanIgnoreWhitespace(); tok != ast.LPAREN {
+		return nil, fmt.Errorf("Found %q after MATCH_RECOGNIZE, expect parentheses.", lit)
+	}
+	// The pattern variables like A.temp are parsed as the field refs of streams, and converted after the pattern is known
+	sourceNames := p.sourceNames
+	p.sourceNames = nil
+	defer func() {
+		p.sourceNames = sourceNames
+	}()
+	m := &ast.MatchRecognize{}
+	if tok, _ := p.scanIgnoreWhitespace(); tok == ast.PARTITION {
+		pe, err := p.parsePartitionBy()
+		if err != nil {
+			return nil, err
+		}
+		m.Partition = pe
+	} else {
+		p.unscan()
+	}
+	if p.scanSubClause("MEASURES") {
+		for {
+			exp, err := p.ParseExpr()
+			if err != nil {
+				return nil, err
+			}
+			if tok, lit := p.scanIgnoreWhitespace(); tok != ast.AS {
+				return nil, fmt.Errorf("found %q, expect AS alias for the measure.", lit)
+			}
+			tok, lit := p.scanIgnoreWhitespace()
+			if tok != ast.IDENT {
+				return nil, fmt.Errorf("found %q, expected as alias.", lit)
+			}
+			for _, f := range m.Measures {
+				if f.AName == lit {
+					return nil, fmt.Errorf("duplicate measure %s.", lit)
+				}
+			}
+			m.Measures = append(m.Measures, ast.Field{Name: lit, AName: lit, Expr: exp})
+			if tok, _ := p.scanIgnoreWhitespace(); tok != ast.COMMA {
+				p.unscan()
+				break
+			}
+		}
+	}
+	if !p.scanSubClause("PATTERN") {
+		_, lit := p.scanIgnoreWhitespace()
+		return nil, fmt.Errorf("Found %q in MATCH_RECOGNIZE, expect PATTERN.", lit)
+	}
+	if err := p.parsePattern(m); err != nil {
+		return nil, err
+	}
+	if p.scanSubClause("WITHIN") {
+		within, unit, err := p.parseWithin()
+		if err != nil {
+			return nil, err
+		}
+		m.Within, m.WithinUnit = within, unit
+	}
+	if p.scanSubClause("DEFINE") {
+		for {
+			tok, lit := p.scanIgnoreWhitespace()
+			if tok != ast.IDENT {
+				return nil, fmt.Errorf("Found %q in DEFINE, expect pattern variable.", lit)
+			}
+			found := false
+			for _, v := range m.Pattern {
+				if v.Name == lit {
+					found = true
+					break
+				}
+			}
+			if !found {
+				return nil, fmt.Errorf("pattern variable %s is defined but not in the pattern.", lit)
+			}
+			for _, d := range m.Defines {
+				if d.Name == lit {
+					return nil, fmt.Errorf("duplicate define of pattern variable %s.", lit)
+				}
+			}
+			if tok, lit := p.scanIgnoreWhitespace(); tok != ast.AS {
+				return nil, fmt.Errorf("found %q, expect AS after the pattern variable.", lit)
+			}
+			exp, err := p.ParseExpr()
+			if err != nil {
+				return nil, err
+			}
+			m.Defines = append(m.Defines, &ast.PatternDefine{Name: lit, Condition: exp})
+			if tok, _ := p.scanIgnoreWhitespace(); tok != ast.COMMA {
+				p.unscan()
+				break
+			}
+		}
+	}
+	if tok, lit := p.scanIgnoreWhitespace(); tok != ast.RPAREN {
+		return nil, fmt.Errorf("Found %q, expect right parentheses after MATCH_RECOGNIZE.", lit)
+	}
+	return m, nil
+}
+
+// parsePattern parses the variables of the pattern like (A B* C), which only supports the quantifiers *, + and ?
+func (p *Parser) parsePattern(m *ast.MatchRecognize) error {
+	if tok, lit := p.scanIgnoreWhitespace(); tok != ast.LPAREN {
+		return fmt.Errorf("Found %q after PATTERN, expect parentheses.", lit)
+	}
+	for {
+		tok, lit := p.scanIgnoreWhitespace()
+		if tok == ast.RPAREN {
+			break
+		}
+		if tok != ast.IDENT {
+			return fmt.Errorf("Found %q in PATTERN, expect pattern variable.", lit)
+		}
+		v := &ast.PatternVar{Name: lit, Min: 1, Max: 1}
+		switch tok, _ := p.scanIgnoreWhitespace(); tok {
+		case ast.ASTERISK:
+			v.Min, v.Max = 0, -1
+		case ast.ADD:
+			v.Max = -1
+		case ast.QUESTION:
+			v.Min = 0
+		default:
+			p.unscan()
+		}
+		m.Pattern = append(m.Pattern, v)
+	}
+	if len(m.Pattern) == 0 {
+		return fmt.Errorf("PATTERN must have at least one variable.")
+	}
+	return nil
+}
+
+// parseWithin parses the duration after WITHIN like (hh, 1)
+func (p *Parser) parseWithin() (*ast.IntegerLiteral, *ast.TimeLiteral, error) {
+	if tok, lit := p.scanIgnoreWhitespace(); tok != ast.LPAREN {
+		return nil, nil, fmt.Errorf("Found %q after WITHIN, expect parentheses.", lit)
+	}
+	tok, lit := p.scanIgnoreWhitespace()
+	if !tok.IsTimeLiteral() {
+		return nil, nil, fmt.Errorf("Found %q in WITHIN, expect timer literal expression. One value of [dd|hh|mi|ss|ms].", lit)
+	}
+	unit := &ast.TimeLiteral{Val: tok}
+	if tok, lit := p.scanIgnoreWhitespace(); tok != ast.COMMA {
+		return nil, nil, fmt.Errorf("Found %q in WITHIN, expect comma.", lit)
+	}
+	tok, lit = p.scanIgnoreWhitespace()
+	v, err := strconv.Atoi(lit)
+	if tok != ast.INTEGER || err != nil || v <= 0 {
+		return nil, nil, fmt.Errorf("Found %q in WITHIN, expect positive integer.", lit)
+	}
+	if tok, lit := p.scanIgnoreWhitespace(); tok != ast.RPAREN {
+		return nil, nil, fmt.Errorf("Found %q in WITHIN, expect right parentheses.", lit)
+	}
+	return &ast.IntegerLiteral{Val: v}, unit, nil
+}
+
+// parsePivot parses the PIVOT clause like PIVOT (avg(value) FOR metric IN ("temp", "hum" AS humidity)) or the
+// UNPIVOT clause like UNPIVOT (value FOR metric IN (temp, hum)). The clause names are matched by the identifiers so that
+// they can still be used as field names
+func (p *Parser) parsePivot(stmt *ast.SelectStatement) error {
+	tok, lit := p.scanIgnoreWhitespace()
+	clause := strings.ToUpper(lit)
+	if tok != ast.IDENT || clause != "PIVOT" && clause != "UNPIVOT" {
+		p.unscan()
+		return nil
+	}
+	pivot := clause == "PIVOT"
+	if tok1, lit1 := p.scanIgnoreWhitespace(); tok1 != ast.LPAREN {
+		return fmt.Errorf("Found %q after %s, expect parentheses.", lit1, clause)
+	}
+	var (
+		agg   ast.Expr
+		value string
+		err   error
+	)
+	if pivot {
+		if agg, err = p.ParseExpr(); err != nil {
+			return err
+		}
+	} else {
+		var t ast.Token
+		if t, value = p.scanIgnoreWhitespace(); t != ast.IDENT {
+			return fmt.Errorf("Found %q in UNPIVOT, expect the field name of the value.", value)
+		}
+	}
+	if !p.scanSubClause("FOR") {
+		_, l := p.scanIgnoreWhitespace()
+		return fmt.Errorf("Found %q in %s, expect FOR.", l, clause)
+	}
+	var (
+		forExpr ast.Expr
+		name    string
+	)
+	if pivot {
+		// parse a unary expression so that the following IN is not parsed as the operator
+		if forExpr, err = p.parseUnaryExpr(false); err != nil {
+			return err
+		}
+	} else {
+		var t ast.Token
+		if t, name = p.scanIgnoreWhitespace(); t != ast.IDENT {
+			return fmt.Errorf("Found %q after FOR in UNPIVOT, expect the field name of the column name.", name)
+		}
+	}
+	if t, l := p.scanIgnoreWhitespace(); t != ast.IN {
+		return fmt.Errorf("Found %q in %s, expect IN.", l, clause)
+	}
+	if t, l := p.scanIgnoreWhitespace(); t != ast.LPAREN {
+		return fmt.Errorf("Found %q after IN, expect parentheses.", l)
+	}
+	var (
+		values  []ast.Expr
+		columns []string
+		names   = make(map[string]bool)
+	)
+	for {
+		var col string
+		if pivot {
+			v, err := p.ParseExpr()
+			if err != nil {
+				return err
+			}
+			switch lv := v.(type) {
+			case *ast.StringLiteral:
+				col = lv.Val
+			case *ast.IntegerLiteral:
+				col = strconv.Itoa(lv.Val)
+			case *ast.BooleanLiteral:
+				col = strconv.FormatBool(lv.Val)
+			case *ast.NumberLiteral:
+				// the column name of a float value must be set by the alias
+			default:
+				return fmt.Errorf("Found %s in PIVOT IN, expect literal.", v)
+			}
+			if t, _ := p.scanIgnoreWhitespace(); t == ast.AS {
+				t1, alias := p.scanIgnoreWhitespace()
+				if t1 != ast.IDENT {
+					return fmt.Errorf("Found %q after AS in PIVOT, expect the column name.", alias)
+				}
+				col = alias
+			} else {
+				p.unscan()
+			}
+			if col == "" {
+				return fmt.Errorf("The column name of %s in PIVOT is required.", v)
+			}
+			values = append(values, v)
+		} else {
+			var t ast.Token
+			if t, col = p.scanIgnoreWhitespace(); t != ast.IDENT {
+				return fmt.Errorf("Found %q in UNPIVOT IN, expect the column name.", col)
+			}
+		}
+		if names[col] {
+			return fmt.Errorf("Column %s is defined more than once in %s.", col, clause)
+		}
+		names[col] = true
+		columns = append(columns, col)
+		if t, _ := p.scanIgnoreWhitespace(); t != ast.COMMA {
+			p.unscan()
+			break
+		}
+	}
+	if t, l := p.scanIgnoreWhitespace(); t != ast.RPAREN {
+		return fmt.Errorf("Found %q in %s IN, expect right parentheses.", l, clause)
+	}
+	if t, l := p.scanIgnoreWhitespace(); t != ast.RPAREN {
+		return fmt.Errorf("Found %q in %s, expect right parentheses.", l, clause)
+	}
+	if pivot {
+		stmt.Pivot = &ast.Pivot{Agg: agg, For: forExpr, Values: values, Names: columns}
+	} else {
+		stmt.Unpivot = &ast.Unpivot{Value: value, Name: name, Columns: columns}
+	}
+	return nil
+}
+
+// parseDedup parses the DEDUP BY clause like DEDUP BY deviceId, msgId WITHIN (hh, 1). DEDUP is matched by the
+// identifier so that it can still be used as field name
+func (p *Parser) parseDedup() (*ast.Dedup, error) {
+	if !p.scanSubClause("DEDUP") {
+		return nil, nil
+	}
+	if tok, lit := p.scanIgnoreWhitespace(); tok != ast.BY {
+		return nil, fmt.Errorf("Found %q after DEDUP, expect BY.", lit)
+	}
+	d := &ast.Dedup{}
+	for {
+		exp, err := p.ParseExpr()
+		if err != nil {
+			return nil, err
+		}
+		d.Keys = append(d.Keys, exp)
+		if tok, _ := p.scanIgnoreWhitespace(); tok != ast.COMMA {
+			p.unscan()
+			break
+		}
+	}
+	if !p.scanSubClause("WITHIN") {
+		_, lit := p.scanIgnoreWhitespace()
+		return nil, fmt.Errorf("Found %q in DEDUP BY, expect WITHIN.", lit)
+	}
+	within, unit, err := p.parseWithin()
+	if err != nil {
+		return nil, err
+	}
+	d.Within, d.WithinUnit = within, unit
+	return d, nil
+}
+
+// scanSubClause returns whether the next identifier is the sub clause name
+func (p *Parser) scanSubClause(name string) bool {
+	if tok, lit := p.scanIgnoreWhitespace(); tok == ast.IDENT && strings.EqualFold(lit, name) {
+		return true
+	}
+	p.unscan()
+	return false
+}
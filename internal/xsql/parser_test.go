@@ -3135,6 +3135,139 @@ func TestParser_ParseStatement(t *testing.T) {
 			s:   `SELECT avg(name) OVER (WHEN a > b) FROM tbl`,
 			err: `Found OVER after non analytic function avg`,
 		},
+		{
+			s: `SELECT avg(temp) OVER (PARTITION BY device ORDER BY ts ROWS BETWEEN 2 PRECEDING AND CURRENT ROW) AS a, sum(temp) OVER (ORDER BY ts DESC WHEN temp > 0) AS s FROM tbl`,
+			stmt: &ast.SelectStatement{
+				Fields: []ast.Field{
+					{
+						Expr: &ast.Call{
+							Name:     "avg",
+							FuncId:   0,
+							FuncType: ast.FuncTypeAgg,
+							Args: []ast.Expr{
+								&ast.FieldRef{Name: "temp", StreamName: ast.DefaultStream},
+							},
+							Partition: &ast.PartitionExpr{
+								Exprs: []ast.Expr{
+									&ast.FieldRef{Name: "device", StreamName: ast.DefaultStream},
+								},
+							},
+							OrderBy: ast.SortFields{{Uname: "ts", Name: "ts", Ascending: true, FieldExpr: &ast.FieldRef{Name: "ts", StreamName: ast.DefaultStream}}},
+							Frame:   &ast.FrameExpr{Preceding: 2},
+						},
+						Name:  "avg",
+						AName: "a",
+					},
+					{
+						Expr: &ast.Call{
+							Name:     "sum",
+							FuncId:   1,
+							FuncType: ast.FuncTypeAgg,
+							Args: []ast.Expr{
+								&ast.FieldRef{Name: "temp", StreamName: ast.DefaultStream},
+							},
+							OrderBy: ast.SortFields{{Uname: "ts", Name: "ts", Ascending: false, FieldExpr: &ast.FieldRef{Name: "ts", StreamName: ast.DefaultStream}}},
+							Frame:   &ast.FrameExpr{Preceding: -1},
+							WhenExpr: &ast.BinaryExpr{
+								LHS: &ast.FieldRef{Name: "temp", StreamName: ast.DefaultStream},
+								OP:  ast.GT,
+								RHS: &ast.IntegerLiteral{Val: 0},
+							},
+						},
+						Name:  "sum",
+						AName: "s",
+					},
+				},
+				Sources: []ast.Source{&ast.Table{Name: "tbl"}},
+			},
+		},
+		{
+			s: `SELECT count(*) OVER (PARTITION BY device ROWS 10 PRECEDING) FROM tbl`,
+			stmt: &ast.SelectStatement{
+				Fields: []ast.Field{
+					{
+						Expr: &ast.Call{
+							Name:     "count",
+							FuncId:   0,
+							FuncType: ast.FuncTypeAgg,
+							Args: []ast.Expr{
+								&ast.Wildcard{Token: ast.ASTERISK},
+							},
+							Partition: &ast.PartitionExpr{
+								Exprs: []ast.Expr{
+									&ast.FieldRef{Name: "device", StreamName: ast.DefaultStream},
+								},
+							},
+							Frame: &ast.FrameExpr{Preceding: 10},
+						},
+						Name:  "count",
+						AName: "",
+					},
+				},
+				Sources: []ast.Source{&ast.Table{Name: "tbl"}},
+			},
+		},
+		{
+			s:   `SELECT avg(temp) OVER (ORDER BY ts ROWS BETWEEN 2 PRECEDING AND 1 FOLLOWING) FROM tbl`,
+			err: `Found "1 FOLLOWING" in ROWS BETWEEN, expect CURRENT ROW.`,
+		},
+		{
+			s:   `SELECT avg(temp) OVER (ROWS 2) FROM tbl`,
+			err: `Found ")" in ROWS, expect PRECEDING.`,
+		},
+		{
+			s: `SELECT rows FROM demo WHERE rows > 1`,
+			stmt: &ast.SelectStatement{
+				Fields: []ast.Field{
+					{
+						Expr:  &ast.FieldRef{Name: "rows", StreamName: ast.DefaultStream},
+						Name:  "rows",
+						AName: "",
+					},
+				},
+				Sources:   []ast.Source{&ast.Table{Name: "demo"}},
+				Condition: &ast.BinaryExpr{OP: ast.GT, LHS: &ast.FieldRef{Name: "rows", StreamName: ast.DefaultStream}, RHS: &ast.IntegerLiteral{Val: 1}},
+			},
+		},
+		{
+			s: `SELECT a AS rows FROM demo`,
+			stmt: &ast.SelectStatement{
+				Fields: []ast.Field{
+					{
+						Expr:  &ast.FieldRef{Name: "a", StreamName: ast.DefaultStream},
+						Name:  "a",
+						AName: "rows",
+					},
+				},
+				Sources: []ast.Source{&ast.Table{Name: "demo"}},
+			},
+		},
+		{
+			s: `SELECT sum(rows) OVER (ORDER BY rows ROWS 2 PRECEDING) FROM tbl`,
+			stmt: &ast.SelectStatement{
+				Fields: []ast.Field{
+					{
+						Expr: &ast.Call{
+							Name:     "sum",
+							FuncId:   0,
+							FuncType: ast.FuncTypeAgg,
+							Args: []ast.Expr{
+								&ast.FieldRef{Name: "rows", StreamName: ast.DefaultStream},
+							},
+							OrderBy: ast.SortFields{{Uname: "rows", Name: "rows", Ascending: true, FieldExpr: &ast.FieldRef{Name: "rows", StreamName: ast.DefaultStream}}},
+							Frame:   &ast.FrameExpr{Preceding: 2},
+						},
+						Name:  "sum",
+						AName: "",
+					},
+				},
+				Sources: []ast.Source{&ast.Table{Name: "tbl"}},
+			},
+		},
+		{
+			s:   `SELECT lag(temp) OVER (ORDER BY ts) FROM tbl`,
+			err: `Found "ORDER" after OVER (, expect partition by or when.`,
+		},
 		{
 			s: `SELECT *, name, lower(name) as ln FROM tbl`,
 			stmt: &ast.SelectStatement{
@@ -3309,196 +3442,794 @@ func TestParser_ParseStatement(t *testing.T) {
 	}
 }
 
-func TestParser_ParseWindowsExpr(t *testing.T) {
-	tests := []struct {
-		s    string
-		stmt *ast.SelectStatement
-		err  string
-	}{
+func TestParser_ParseWindowsExpr(t *testing.T) {
+	tests := []struct {
+		s    string
+		stmt *ast.SelectStatement
+		err  string
+	}{
+		{
+			s: `SELECT f1 FROM tbl GROUP BY SLIDINGWINDOW(ms, 5) OVER (WHEN a > 5)`,
+			stmt: &ast.SelectStatement{
+				Fields: []ast.Field{
+					{
+						Expr:  &ast.FieldRef{Name: "f1", StreamName: ast.DefaultStream},
+						Name:  "f1",
+						AName: "",
+					},
+				},
+				Sources: []ast.Source{&ast.Table{Name: "tbl"}},
+				Dimensions: ast.Dimensions{
+					ast.Dimension{
+						Expr: &ast.Window{
+							WindowType: ast.SLIDING_WINDOW,
+							Length:     &ast.IntegerLiteral{Val: 5},
+							Interval:   &ast.IntegerLiteral{Val: 0},
+							TimeUnit:   &ast.TimeLiteral{Val: ast.MS},
+							TriggerCondition: &ast.BinaryExpr{
+								OP:  ast.GT,
+								LHS: &ast.FieldRef{Name: "a", StreamName: ast.DefaultStream},
+								RHS: &ast.IntegerLiteral{Val: 5},
+							},
+							Delay: &ast.IntegerLiteral{Val: 0},
+						},
+					},
+				},
+			},
+		},
+		{
+			s: `SELECT f1 FROM tbl GROUP BY TUMBLINGWINDOW(ss, 10) OVER (WHEN count(*) > 100)`,
+			stmt: &ast.SelectStatement{
+				Fields: []ast.Field{
+					{
+						Expr:  &ast.FieldRef{Name: "f1", StreamName: ast.DefaultStream},
+						Name:  "f1",
+						AName: "",
+					},
+				},
+				Sources: []ast.Source{&ast.Table{Name: "tbl"}},
+				Dimensions: ast.Dimensions{
+					ast.Dimension{
+						Expr: &ast.Window{
+							WindowType: ast.TUMBLING_WINDOW,
+							Length:     &ast.IntegerLiteral{Val: 10},
+							Interval:   &ast.IntegerLiteral{Val: 0},
+							TimeUnit:   &ast.TimeLiteral{Val: ast.SS},
+							TriggerCondition: &ast.BinaryExpr{
+								OP:  ast.GT,
+								LHS: &ast.Call{Name: "count", Args: []ast.Expr{&ast.Wildcard{Token: ast.ASTERISK}}, FuncType: ast.FuncTypeAgg},
+								RHS: &ast.IntegerLiteral{Val: 100},
+							},
+							Delay: &ast.IntegerLiteral{Val: 0},
+						},
+					},
+				},
+			},
+		},
+		{
+			s: `SELECT count(*) FROM tbl GROUP BY deviceId, TUMBLINGWINDOW(mi, 1) ROLLUP(hh, dd)`,
+			stmt: &ast.SelectStatement{
+				Fields: []ast.Field{
+					{
+						Expr:  &ast.Call{Name: "count", Args: []ast.Expr{&ast.Wildcard{Token: ast.ASTERISK}}, FuncType: ast.FuncTypeAgg},
+						Name:  "count",
+						AName: "",
+					},
+				},
+				Sources: []ast.Source{&ast.Table{Name: "tbl"}},
+				Dimensions: ast.Dimensions{
+					ast.Dimension{
+						Expr: &ast.FieldRef{Name: "deviceId", StreamName: ast.DefaultStream},
+					},
+					ast.Dimension{
+						Expr: &ast.Window{
+							WindowType: ast.TUMBLING_WINDOW,
+							Length:     &ast.IntegerLiteral{Val: 1},
+							Interval:   &ast.IntegerLiteral{Val: 0},
+							TimeUnit:   &ast.TimeLiteral{Val: ast.MI},
+							Rollup:     []*ast.TimeLiteral{{Val: ast.HH}, {Val: ast.DD}},
+							Delay:      &ast.IntegerLiteral{Val: 0},
+						},
+					},
+				},
+			},
+		},
+		{
+			s:   `SELECT count(*) FROM tbl GROUP BY HOPPINGWINDOW(mi, 10, 5) ROLLUP(hh)`,
+			err: "ROLLUP is only supported by tumbling window.",
+		},
+		{
+			s:   `SELECT count(*) FROM tbl GROUP BY TUMBLINGWINDOW(mi, 1) ROLLUP(hh, day)`,
+			err: "Found \"day\" in ROLLUP, expect timer literal expression. One value of [dd|hh|mi|ss|ms].",
+		},
+		{
+			s:   `SELECT count(*) FROM tbl GROUP BY TUMBLINGWINDOW(mi, 1) ROLLUP(hh dd)`,
+			err: "Found \"DD\" in ROLLUP, expect comma or right parentheses.",
+		},
+		{
+			s:   `SELECT f1 FROM tbl GROUP BY HOPPINGWINDOW(ss, 10, 5) OVER (WHEN a > 5)`,
+			err: "WHEN is only supported by sliding, tumbling and session window.",
+		},
+		{
+			s:   `SELECT f1 FROM tbl GROUP BY SLIDINGWINDOW(ss, 10) OVER (WHEN count(*) > 5)`,
+			err: "Not allowed to call aggregate functions in GROUP BY clause.",
+		},
+		{
+			s: `SELECT f1 FROM tbl GROUP BY SLIDINGWINDOW(ms, 5) FILTER (WHERE a > 4) OVER (WHEN a > 5)`,
+			stmt: &ast.SelectStatement{
+				Fields: []ast.Field{
+					{
+						Expr:  &ast.FieldRef{Name: "f1", StreamName: ast.DefaultStream},
+						Name:  "f1",
+						AName: "",
+					},
+				},
+				Sources: []ast.Source{&ast.Table{Name: "tbl"}},
+				Dimensions: ast.Dimensions{
+					ast.Dimension{
+						Expr: &ast.Window{
+							WindowType: ast.SLIDING_WINDOW,
+							Length:     &ast.IntegerLiteral{Val: 5},
+							Interval:   &ast.IntegerLiteral{Val: 0},
+							TimeUnit:   &ast.TimeLiteral{Val: ast.MS},
+							TriggerCondition: &ast.BinaryExpr{
+								OP:  ast.GT,
+								LHS: &ast.FieldRef{Name: "a", StreamName: ast.DefaultStream},
+								RHS: &ast.IntegerLiteral{Val: 5},
+							},
+							Filter: &ast.BinaryExpr{
+								OP:  ast.GT,
+								LHS: &ast.FieldRef{Name: "a", StreamName: ast.DefaultStream},
+								RHS: &ast.IntegerLiteral{Val: 4},
+							},
+							Delay: &ast.IntegerLiteral{Val: 0},
+						},
+					},
+				},
+			},
+		},
+		{
+			s: `SELECT f1 FROM tbl GROUP BY SLIDINGWINDOW(ms, 5)`,
+			stmt: &ast.SelectStatement{
+				Fields: []ast.Field{
+					{
+						Expr:  &ast.FieldRef{Name: "f1", StreamName: ast.DefaultStream},
+						Name:  "f1",
+						AName: "",
+					},
+				},
+				Sources: []ast.Source{&ast.Table{Name: "tbl"}},
+				Dimensions: ast.Dimensions{
+					ast.Dimension{
+						Expr: &ast.Window{
+							WindowType: ast.SLIDING_WINDOW,
+							Length:     &ast.IntegerLiteral{Val: 5},
+							Interval:   &ast.IntegerLiteral{Val: 0},
+							TimeUnit:   &ast.TimeLiteral{Val: ast.MS},
+							Delay:      &ast.IntegerLiteral{Val: 0},
+						},
+					},
+				},
+			},
+		},
+		{
+			s: `SELECT f1 FROM tbl GROUP BY TUMBLINGWINDOW(ss, 10)`,
+			stmt: &ast.SelectStatement{
+				Fields: []ast.Field{
+					{
+						Expr:  &ast.FieldRef{Name: "f1", StreamName: ast.DefaultStream},
+						Name:  "f1",
+						AName: "",
+					},
+				},
+				Sources: []ast.Source{&ast.Table{Name: "tbl"}},
+				Dimensions: ast.Dimensions{
+					ast.Dimension{
+						Expr: &ast.Window{
+							WindowType: ast.TUMBLING_WINDOW,
+							Length:     &ast.IntegerLiteral{Val: 10},
+							Interval:   &ast.IntegerLiteral{Val: 0},
+							TimeUnit:   &ast.TimeLiteral{Val: ast.SS},
+							Delay:      &ast.IntegerLiteral{Val: 0},
+						},
+					},
+				},
+			},
+		},
+
+		{
+			s: `SELECT f1 FROM tbl GROUP BY HOPPINGWINDOW(mi, 5, 1)`,
+			stmt: &ast.SelectStatement{
+				Fields: []ast.Field{
+					{
+						Expr:  &ast.FieldRef{Name: "f1", StreamName: ast.DefaultStream},
+						Name:  "f1",
+						AName: "",
+					},
+				},
+				Sources: []ast.Source{&ast.Table{Name: "tbl"}},
+				Dimensions: ast.Dimensions{
+					ast.Dimension{
+						Expr: &ast.Window{
+							WindowType: ast.HOPPING_WINDOW,
+							Length:     &ast.IntegerLiteral{Val: 5},
+							Interval:   &ast.IntegerLiteral{Val: 1},
+							TimeUnit:   &ast.TimeLiteral{Val: ast.MI},
+							Delay:      &ast.IntegerLiteral{Val: 0},
+						},
+					},
+				},
+			},
+		},
+
+		{
+			s: `SELECT f1 FROM tbl GROUP BY SESSIONWINDOW(hh, 5, 1)`,
+			stmt: &ast.SelectStatement{
+				Fields: []ast.Field{
+					{
+						Expr:  &ast.FieldRef{Name: "f1", StreamName: ast.DefaultStream},
+						Name:  "f1",
+						AName: "",
+					},
+				},
+				Sources: []ast.Source{&ast.Table{Name: "tbl"}},
+				Dimensions: ast.Dimensions{
+					ast.Dimension{
+						Expr: &ast.Window{
+							WindowType: ast.SESSION_WINDOW,
+							Length:     &ast.IntegerLiteral{Val: 5},
+							Interval:   &ast.IntegerLiteral{Val: 1},
+							TimeUnit:   &ast.TimeLiteral{Val: ast.HH},
+							Delay:      &ast.IntegerLiteral{Val: 0},
+						},
+					},
+				},
+			},
+		},
+
+		{
+			s: `SELECT f1 FROM tbl GROUP BY SLIDINGWINDOW(ms, 5)`,
+			stmt: &ast.SelectStatement{
+				Fields: []ast.Field{
+					{
+						Expr:  &ast.FieldRef{Name: "f1", StreamName: ast.DefaultStream},
+						Name:  "f1",
+						AName: "",
+					},
+				},
+				Sources: []ast.Source{&ast.Table{Name: "tbl"}},
+				Dimensions: ast.Dimensions{
+					ast.Dimension{
+						Expr: &ast.Window{
+							WindowType: ast.SLIDING_WINDOW,
+							Length:     &ast.IntegerLiteral{Val: 5},
+							Interval:   &ast.IntegerLiteral{Val: 0},
+							Delay:      &ast.IntegerLiteral{Val: 0},
+							TimeUnit:   &ast.TimeLiteral{Val: ast.MS},
+						},
+					},
+				},
+			},
+		},
+
+		{
+			s: `SELECT f1 FROM tbl GROUP BY SESSIONWINDOW(ss, 60, 10) OVER (PARTITION BY deviceId, line)`,
+			stmt: &ast.SelectStatement{
+				Fields: []ast.Field{
+					{
+						Expr:  &ast.FieldRef{Name: "f1", StreamName: ast.DefaultStream},
+						Name:  "f1",
+						AName: "",
+					},
+				},
+				Sources: []ast.Source{&ast.Table{Name: "tbl"}},
+				Dimensions: ast.Dimensions{
+					ast.Dimension{
+						Expr: &ast.Window{
+							WindowType: ast.SESSION_WINDOW,
+							Length:     &ast.IntegerLiteral{Val: 60},
+							Interval:   &ast.IntegerLiteral{Val: 10},
+							TimeUnit:   &ast.TimeLiteral{Val: ast.SS},
+							Delay:      &ast.IntegerLiteral{Val: 0},
+							Partition: &ast.PartitionExpr{Exprs: []ast.Expr{
+								&ast.FieldRef{Name: "deviceId", StreamName: ast.DefaultStream},
+								&ast.FieldRef{Name: "line", StreamName: ast.DefaultStream},
+							}},
+						},
+					},
+				},
+			},
+		},
+
+		{
+			s:    `SELECT f1 FROM tbl GROUP BY TUMBLINGWINDOW(ss, 10) OVER (PARTITION BY deviceId)`,
+			stmt: nil,
+			err:  "PARTITION BY is only supported by session window.",
+		},
+
+		{
+			s: `SELECT deviceId, startTemp FROM demo MATCH_RECOGNIZE (PARTITION BY deviceId MEASURES A.temp AS startTemp, B.temp AS endTemp PATTERN (A N* B+) WITHIN (ss, 10) DEFINE A AS temp > 30, B AS temp > A.temp)`,
+			stmt: &ast.SelectStatement{
+				Fields: []ast.Field{
+					{
+						Expr:  &ast.FieldRef{Name: "deviceId", StreamName: ast.DefaultStream},
+						Name:  "deviceId",
+						AName: "",
+					},
+					{
+						Expr:  &ast.FieldRef{Name: "startTemp", StreamName: ast.DefaultStream},
+						Name:  "startTemp",
+						AName: "",
+					},
+				},
+				Sources: []ast.Source{&ast.Table{Name: "demo"}},
+				MatchRecognize: &ast.MatchRecognize{
+					Partition: &ast.PartitionExpr{Exprs: []ast.Expr{
+						&ast.FieldRef{Name: "deviceId", StreamName: ast.DefaultStream},
+					}},
+					Measures: []ast.Field{
+						{Expr: &ast.FieldRef{Name: "temp", StreamName: "A"}, Name: "startTemp", AName: "startTemp"},
+						{Expr: &ast.FieldRef{Name: "temp", StreamName: "B"}, Name: "endTemp", AName: "endTemp"},
+					},
+					Pattern: []*ast.PatternVar{
+						{Name: "A", Min: 1, Max: 1},
+						{Name: "N", Min: 0, Max: -1},
+						{Name: "B", Min: 1, Max: -1},
+					},
+					Within:     &ast.IntegerLiteral{Val: 10},
+					WithinUnit: &ast.TimeLiteral{Val: ast.SS},
+					Defines: []*ast.PatternDefine{
+						{Name: "A", Condition: &ast.BinaryExpr{OP: ast.GT, LHS: &ast.FieldRef{Name: "temp", StreamName: ast.DefaultStream}, RHS: &ast.IntegerLiteral{Val: 30}}},
+						{Name: "B", Condition: &ast.BinaryExpr{OP: ast.GT, LHS: &ast.FieldRef{Name: "temp", StreamName: ast.DefaultStream}, RHS: &ast.FieldRef{Name: "temp", StreamName: "A"}}},
+					},
+				},
+			},
+		},
+
+		{
+			s:    `SELECT * FROM demo MATCH_RECOGNIZE (PATTERN (A B) DEFINE C AS temp > 30)`,
+			stmt: nil,
+			err:  "pattern variable C is defined but not in the pattern.",
+		},
+
+		{
+			s:    `SELECT * FROM demo MATCH_RECOGNIZE (MEASURES A.temp AS t DEFINE A AS temp > 30)`,
+			stmt: nil,
+			err:  "Found \"DEFINE\" in MATCH_RECOGNIZE, expect PATTERN.",
+		},
+
+		{
+			s:    `SELECT * FROM demo MATCH_RECOGNIZE (MEASURES avg(A.temp) AS t PATTERN (A+))`,
+			stmt: nil,
+			err:  "Not allowed to call aggregate functions in MATCH_RECOGNIZE.",
+		},
+
+		{
+			s: `SELECT match_recognize FROM demo WHERE match_recognize > 1`,
+			stmt: &ast.SelectStatement{
+				Fields: []ast.Field{
+					{
+						Expr:  &ast.FieldRef{Name: "match_recognize", StreamName: ast.DefaultStream},
+						Name:  "match_recognize",
+						AName: "",
+					},
+				},
+				Sources:   []ast.Source{&ast.Table{Name: "demo"}},
+				Condition: &ast.BinaryExpr{OP: ast.GT, LHS: &ast.FieldRef{Name: "match_recognize", StreamName: ast.DefaultStream}, RHS: &ast.IntegerLiteral{Val: 1}},
+			},
+		},
+
+		{
+			s: `SELECT a AS match_recognize FROM demo`,
+			stmt: &ast.SelectStatement{
+				Fields: []ast.Field{
+					{
+						Expr:  &ast.FieldRef{Name: "a", StreamName: ast.DefaultStream},
+						Name:  "a",
+						AName: "match_recognize",
+					},
+				},
+				Sources: []ast.Source{&ast.Table{Name: "demo"}},
+			},
+		},
+
+		{
+			s: `SELECT * FROM demo DEDUP BY deviceId, msgId WITHIN (hh, 1) WHERE temp > 20`,
+			stmt: &ast.SelectStatement{
+				Fields: []ast.Field{
+					{
+						Expr:  &ast.Wildcard{Token: ast.ASTERISK},
+						Name:  "*",
+						AName: "",
+					},
+				},
+				Sources: []ast.Source{&ast.Table{Name: "demo"}},
+				Dedup: &ast.Dedup{
+					Keys: []ast.Expr{
+						&ast.FieldRef{Name: "deviceId", StreamName: ast.DefaultStream},
+						&ast.FieldRef{Name: "msgId", StreamName: ast.DefaultStream},
+					},
+					Within:     &ast.IntegerLiteral{Val: 1},
+					WithinUnit: &ast.TimeLiteral{Val: ast.HH},
+				},
+				Condition: &ast.BinaryExpr{OP: ast.GT, LHS: &ast.FieldRef{Name: "temp", StreamName: ast.DefaultStream}, RHS: &ast.IntegerLiteral{Val: 20}},
+			},
+		},
+
+		{
+			s:    `SELECT * FROM demo DEDUP BY deviceId WHERE temp > 20`,
+			stmt: nil,
+			err:  "Found \"WHERE\" in DEDUP BY, expect WITHIN.",
+		},
+
+		{
+			s:    `SELECT * FROM demo DEDUP BY count(*) WITHIN (ss, 10)`,
+			stmt: nil,
+			err:  "Not allowed to call aggregate functions in DEDUP BY clause.",
+		},
+
+		{
+			s: `SELECT dedup FROM demo WHERE dedup > 1`,
+			stmt: &ast.SelectStatement{
+				Fields: []ast.Field{
+					{
+						Expr:  &ast.FieldRef{Name: "dedup", StreamName: ast.DefaultStream},
+						Name:  "dedup",
+						AName: "",
+					},
+				},
+				Sources:   []ast.Source{&ast.Table{Name: "demo"}},
+				Condition: &ast.BinaryExpr{OP: ast.GT, LHS: &ast.FieldRef{Name: "dedup", StreamName: ast.DefaultStream}, RHS: &ast.IntegerLiteral{Val: 1}},
+			},
+		},
+
+		{
+			s: `SELECT a AS dedup FROM demo`,
+			stmt: &ast.SelectStatement{
+				Fields: []ast.Field{
+					{
+						Expr:  &ast.FieldRef{Name: "a", StreamName: ast.DefaultStream},
+						Name:  "a",
+						AName: "dedup",
+					},
+				},
+				Sources: []ast.Source{&ast.Table{Name: "demo"}},
+			},
+		},
+
+		{
+			s: `SELECT * FROM demo WHERE deviceId IN (SELECT id FROM blacklist WHERE level > 1)`,
+			stmt: &ast.SelectStatement{
+				Fields: []ast.Field{
+					{
+						Expr:  &ast.Wildcard{Token: ast.ASTERISK},
+						Name:  "*",
+						AName: "",
+					},
+				},
+				Sources: []ast.Source{&ast.Table{Name: "demo"}},
+				Condition: &ast.BinaryExpr{
+					LHS: &ast.FieldRef{Name: "deviceId", StreamName: ast.DefaultStream},
+					OP:  ast.IN,
+					RHS: &ast.ValueSetExpr{ArrayExpr: &ast.SubqueryExpr{
+						Stmt: &ast.SelectStatement{
+							Fields:    []ast.Field{{Expr: &ast.FieldRef{Name: "id", StreamName: ast.DefaultStream}, Name: "id", AName: ""}},
+							Sources:   []ast.Source{&ast.Table{Name: "blacklist"}},
+							Condition: &ast.BinaryExpr{OP: ast.GT, LHS: &ast.FieldRef{Name: "level", StreamName: ast.DefaultStream}, RHS: &ast.IntegerLiteral{Val: 1}},
+						},
+					}},
+				},
+			},
+		},
+
+		{
+			s: `SELECT temp - (SELECT max(threshold) FROM limits) AS diff FROM demo WHERE temp > (SELECT avg(threshold) FROM limits)`,
+			stmt: &ast.SelectStatement{
+				Fields: []ast.Field{
+					{
+						Expr: &ast.BinaryExpr{
+							OP:  ast.SUB,
+							LHS: &ast.FieldRef{Name: "temp", StreamName: ast.DefaultStream},
+							RHS: &ast.SubqueryExpr{
+								Stmt: &ast.SelectStatement{
+									Fields:  []ast.Field{{Expr: &ast.Call{Name: "max", FuncType: ast.FuncTypeAgg, Args: []ast.Expr{&ast.FieldRef{Name: "threshold", StreamName: ast.DefaultStream}}}, Name: "max", AName: ""}},
+									Sources: []ast.Source{&ast.Table{Name: "limits"}},
+								},
+								Scalar: true,
+							},
+						},
+						Name:  "",
+						AName: "diff",
+					},
+				},
+				Sources: []ast.Source{&ast.Table{Name: "demo"}},
+				Condition: &ast.BinaryExpr{
+					OP:  ast.GT,
+					LHS: &ast.FieldRef{Name: "temp", StreamName: ast.DefaultStream},
+					RHS: &ast.SubqueryExpr{
+						Stmt: &ast.SelectStatement{
+							Fields:  []ast.Field{{Expr: &ast.Call{Name: "avg", FuncType: ast.FuncTypeAgg, Args: []ast.Expr{&ast.FieldRef{Name: "threshold", StreamName: ast.DefaultStream}}, FuncId: 1}, Name: "avg", AName: ""}},
+							Sources: []ast.Source{&ast.Table{Name: "limits"}},
+						},
+						Scalar: true,
+					},
+				},
+			},
+		},
+
+		{
+			s:    `SELECT * FROM demo WHERE deviceId IN (SELECT id, name FROM blacklist)`,
+			stmt: nil,
+			err:  "subquery must select exactly one field.",
+		},
+
+		{
+			s:    `SELECT * FROM demo WHERE deviceId IN (SELECT count(*) FROM blacklist)`,
+			stmt: nil,
+			err:  "Not allowed to call aggregate functions in IN subquery.",
+		},
+
+		{
+			s:    `SELECT * FROM demo WHERE deviceId IN (SELECT id FROM blacklist GROUP BY id)`,
+			stmt: nil,
+			err:  "Found \"GROUP\" in subquery, expect right parentheses.",
+		},
+
+		{
+			s:    `SELECT count(*) FROM demo GROUP BY deviceId HAVING count(*) > (SELECT max(c) FROM limits)`,
+			stmt: nil,
+			err:  "subquery is only supported in SELECT and WHERE clause.",
+		},
+
+		{
+			s: `WITH hot AS (SELECT deviceId, temp FROM demo WHERE temp > 30), top AS (SELECT deviceId FROM hot) SELECT deviceId FROM top`,
+			stmt: &ast.SelectStatement{
+				With: []*ast.CTE{
+					{
+						Name: "hot",
+						Stmt: &ast.SelectStatement{
+							Fields: []ast.Field{
+								{Expr: &ast.FieldRef{Name: "deviceId", StreamName: ast.DefaultStream}, Name: "deviceId", AName: ""},
+								{Expr: &ast.FieldRef{Name: "temp", StreamName: ast.DefaultStream}, Name: "temp", AName: ""},
+							},
+							Sources:   []ast.Source{&ast.Table{Name: "demo"}},
+							Condition: &ast.BinaryExpr{OP: ast.GT, LHS: &ast.FieldRef{Name: "temp", StreamName: ast.DefaultStream}, RHS: &ast.IntegerLiteral{Val: 30}},
+						},
+					},
+					{
+						Name: "top",
+						Stmt: &ast.SelectStatement{
+							Fields:  []ast.Field{{Expr: &ast.FieldRef{Name: "deviceId", StreamName: ast.DefaultStream}, Name: "deviceId", AName: ""}},
+							Sources: []ast.Source{&ast.Table{Name: "hot"}},
+						},
+					},
+				},
+				Fields:  []ast.Field{{Expr: &ast.FieldRef{Name: "deviceId", StreamName: ast.DefaultStream}, Name: "deviceId", AName: ""}},
+				Sources: []ast.Source{&ast.Table{Name: "top"}},
+			},
+		},
+
+		{
+			s:    `WITH hot AS (SELECT * FROM demo), hot AS (SELECT * FROM demo2) SELECT * FROM hot`,
+			stmt: nil,
+			err:  "CTE hot is defined more than once.",
+		},
+
+		{
+			s:    `WITH hot (SELECT * FROM demo) SELECT * FROM hot`,
+			stmt: nil,
+			err:  "Found \"(\" after CTE hot, expect AS.",
+		},
+
+		{
+			s:    `WITH hot AS (SELECT * FROM demo) DELETE FROM hot`,
+			stmt: nil,
+			err:  "Found \"DELETE\", Expected SELECT.\n",
+		},
+
+		{
+			s: `SELECT temp, meta(stream) AS src FROM s1 AS s UNION ALL s2 UNION ALL s3 WHERE temp > 20`,
+			stmt: &ast.SelectStatement{
+				Fields: []ast.Field{
+					{Expr: &ast.FieldRef{Name: "temp", StreamName: ast.DefaultStream}, Name: "temp", AName: ""},
+					{
+						Expr:  &ast.Call{Name: "meta", Args: []ast.Expr{&ast.MetaRef{Name: "stream", StreamName: ast.DefaultStream}}},
+						Name:  "meta",
+						AName: "src",
+					},
+				},
+				Sources:   []ast.Source{&ast.Table{Name: "s1", Alias: "s", Union: []string{"s2", "s3"}}},
+				Condition: &ast.BinaryExpr{OP: ast.GT, LHS: &ast.FieldRef{Name: "temp", StreamName: ast.DefaultStream}, RHS: &ast.IntegerLiteral{Val: 20}},
+			},
+		},
+
+		{
+			s:    `SELECT * FROM s1 UNION s2`,
+			stmt: nil,
+			err:  "Found \"s2\" after UNION, expect ALL.",
+		},
+
+		{
+			s:    `SELECT * FROM s1 UNION ALL s2 AS s`,
+			stmt: nil,
+			err:  "Found alias s of s2 in UNION ALL, only the first stream can have alias.",
+		},
+
+		{
+			s:    `SELECT * FROM s1 UNION ALL s2 UNION ALL s1`,
+			stmt: nil,
+			err:  "Stream s1 is merged by UNION ALL more than once.",
+		},
+
 		{
-			s: `SELECT f1 FROM tbl GROUP BY SLIDINGWINDOW(ms, 5) OVER (WHEN a > 5)`,
+			s: `SELECT union FROM demo WHERE union > 1`,
 			stmt: &ast.SelectStatement{
 				Fields: []ast.Field{
 					{
-						Expr:  &ast.FieldRef{Name: "f1", StreamName: ast.DefaultStream},
-						Name:  "f1",
+						Expr:  &ast.FieldRef{Name: "union", StreamName: ast.DefaultStream},
+						Name:  "union",
 						AName: "",
 					},
 				},
-				Sources: []ast.Source{&ast.Table{Name: "tbl"}},
-				Dimensions: ast.Dimensions{
-					ast.Dimension{
-						Expr: &ast.Window{
-							WindowType: ast.SLIDING_WINDOW,
-							Length:     &ast.IntegerLiteral{Val: 5},
-							Interval:   &ast.IntegerLiteral{Val: 0},
-							TimeUnit:   &ast.TimeLiteral{Val: ast.MS},
-							TriggerCondition: &ast.BinaryExpr{
-								OP:  ast.GT,
-								LHS: &ast.FieldRef{Name: "a", StreamName: ast.DefaultStream},
-								RHS: &ast.IntegerLiteral{Val: 5},
-							},
-							Delay: &ast.IntegerLiteral{Val: 0},
-						},
-					},
-				},
+				Sources:   []ast.Source{&ast.Table{Name: "demo"}},
+				Condition: &ast.BinaryExpr{OP: ast.GT, LHS: &ast.FieldRef{Name: "union", StreamName: ast.DefaultStream}, RHS: &ast.IntegerLiteral{Val: 1}},
 			},
 		},
+
 		{
-			s: `SELECT f1 FROM tbl GROUP BY SLIDINGWINDOW(ms, 5) FILTER (WHERE a > 4) OVER (WHEN a > 5)`,
+			s: `SELECT a AS union FROM demo`,
 			stmt: &ast.SelectStatement{
 				Fields: []ast.Field{
 					{
-						Expr:  &ast.FieldRef{Name: "f1", StreamName: ast.DefaultStream},
-						Name:  "f1",
-						AName: "",
+						Expr:  &ast.FieldRef{Name: "a", StreamName: ast.DefaultStream},
+						Name:  "a",
+						AName: "union",
 					},
 				},
-				Sources: []ast.Source{&ast.Table{Name: "tbl"}},
-				Dimensions: ast.Dimensions{
-					ast.Dimension{
-						Expr: &ast.Window{
-							WindowType: ast.SLIDING_WINDOW,
-							Length:     &ast.IntegerLiteral{Val: 5},
-							Interval:   &ast.IntegerLiteral{Val: 0},
-							TimeUnit:   &ast.TimeLiteral{Val: ast.MS},
-							TriggerCondition: &ast.BinaryExpr{
-								OP:  ast.GT,
-								LHS: &ast.FieldRef{Name: "a", StreamName: ast.DefaultStream},
-								RHS: &ast.IntegerLiteral{Val: 5},
-							},
-							Filter: &ast.BinaryExpr{
-								OP:  ast.GT,
-								LHS: &ast.FieldRef{Name: "a", StreamName: ast.DefaultStream},
-								RHS: &ast.IntegerLiteral{Val: 4},
-							},
-							Delay: &ast.IntegerLiteral{Val: 0},
-						},
-					},
+				Sources: []ast.Source{&ast.Table{Name: "demo"}},
+			},
+		},
+
+		{
+			s: `SELECT deviceId, r FROM demo CROSS JOIN UNNEST(readings) AS r WHERE r > 10`,
+			stmt: &ast.SelectStatement{
+				Fields: []ast.Field{
+					{Expr: &ast.FieldRef{Name: "deviceId", StreamName: ast.DefaultStream}, Name: "deviceId", AName: ""},
+					{Expr: &ast.FieldRef{Name: "r", StreamName: ast.DefaultStream}, Name: "r", AName: ""},
 				},
+				Sources:   []ast.Source{&ast.Table{Name: "demo"}},
+				Unnest:    &ast.Unnest{Expr: &ast.FieldRef{Name: "readings", StreamName: ast.DefaultStream}, Alias: "r"},
+				Condition: &ast.BinaryExpr{OP: ast.GT, LHS: &ast.FieldRef{Name: "r", StreamName: ast.DefaultStream}, RHS: &ast.IntegerLiteral{Val: 10}},
 			},
 		},
+
 		{
-			s: `SELECT f1 FROM tbl GROUP BY SLIDINGWINDOW(ms, 5)`,
+			s:    `SELECT * FROM demo CROSS JOIN UNNEST(readings)`,
+			stmt: nil,
+			err:  "Found \"EOF\" after UNNEST, expect AS.",
+		},
+
+		{
+			s:    `SELECT * FROM demo CROSS JOIN UNNEST(collect(readings)) AS r`,
+			stmt: nil,
+			err:  "Not allowed to call aggregate functions in UNNEST.",
+		},
+
+		{
+			s:    `SELECT * FROM demo CROSS JOIN UNNEST(a) AS r CROSS JOIN UNNEST(b) AS s`,
+			stmt: nil,
+			err:  "UNNEST must be the first join and used only once.",
+		},
+
+		{
+			s: `SELECT * FROM demo PIVOT (max(value) FOR metric IN ('temp', 'hum' AS humidity, 3))`,
 			stmt: &ast.SelectStatement{
 				Fields: []ast.Field{
-					{
-						Expr:  &ast.FieldRef{Name: "f1", StreamName: ast.DefaultStream},
-						Name:  "f1",
-						AName: "",
-					},
+					{Expr: &ast.Wildcard{Token: ast.ASTERISK}, Name: "*", AName: ""},
 				},
-				Sources: []ast.Source{&ast.Table{Name: "tbl"}},
-				Dimensions: ast.Dimensions{
-					ast.Dimension{
-						Expr: &ast.Window{
-							WindowType: ast.SLIDING_WINDOW,
-							Length:     &ast.IntegerLiteral{Val: 5},
-							Interval:   &ast.IntegerLiteral{Val: 0},
-							TimeUnit:   &ast.TimeLiteral{Val: ast.MS},
-							Delay:      &ast.IntegerLiteral{Val: 0},
-						},
-					},
+				Sources: []ast.Source{&ast.Table{Name: "demo"}},
+				Pivot: &ast.Pivot{
+					Agg:    &ast.Call{Name: "max", Args: []ast.Expr{&ast.FieldRef{Name: "value", StreamName: ast.DefaultStream}}, FuncType: ast.FuncTypeAgg},
+					For:    &ast.FieldRef{Name: "metric", StreamName: ast.DefaultStream},
+					Values: []ast.Expr{&ast.StringLiteral{Val: "temp"}, &ast.StringLiteral{Val: "hum"}, &ast.IntegerLiteral{Val: 3}},
+					Names:  []string{"temp", "humidity", "3"},
 				},
 			},
 		},
+
+		{
+			s:    `SELECT * FROM demo PIVOT (value FOR metric IN ('temp'))`,
+			stmt: nil,
+			err:  "PIVOT requires an aggregate function.",
+		},
+
 		{
-			s: `SELECT f1 FROM tbl GROUP BY TUMBLINGWINDOW(ss, 10)`,
+			s:    `SELECT * FROM demo PIVOT (max(value) FOR metric IN ('temp', 'temp'))`,
+			stmt: nil,
+			err:  "Column temp is defined more than once in PIVOT.",
+		},
+
+		{
+			s:    `SELECT * FROM demo PIVOT (max(value) FOR metric IN (1.5))`,
+			stmt: nil,
+			err:  "The column name of 1.500000 in PIVOT is required.",
+		},
+
+		{
+			s: `SELECT ts, metric, value FROM demo UNPIVOT (value FOR metric IN (temp, hum)) WHERE value > 10`,
 			stmt: &ast.SelectStatement{
 				Fields: []ast.Field{
-					{
-						Expr:  &ast.FieldRef{Name: "f1", StreamName: ast.DefaultStream},
-						Name:  "f1",
-						AName: "",
-					},
-				},
-				Sources: []ast.Source{&ast.Table{Name: "tbl"}},
-				Dimensions: ast.Dimensions{
-					ast.Dimension{
-						Expr: &ast.Window{
-							WindowType: ast.TUMBLING_WINDOW,
-							Length:     &ast.IntegerLiteral{Val: 10},
-							Interval:   &ast.IntegerLiteral{Val: 0},
-							TimeUnit:   &ast.TimeLiteral{Val: ast.SS},
-							Delay:      &ast.IntegerLiteral{Val: 0},
-						},
-					},
+					{Expr: &ast.FieldRef{Name: "ts", StreamName: ast.DefaultStream}, Name: "ts", AName: ""},
+					{Expr: &ast.FieldRef{Name: "metric", StreamName: ast.DefaultStream}, Name: "metric", AName: ""},
+					{Expr: &ast.FieldRef{Name: "value", StreamName: ast.DefaultStream}, Name: "value", AName: ""},
 				},
+				Sources:   []ast.Source{&ast.Table{Name: "demo"}},
+				Unpivot:   &ast.Unpivot{Value: "value", Name: "metric", Columns: []string{"temp", "hum"}},
+				Condition: &ast.BinaryExpr{OP: ast.GT, LHS: &ast.FieldRef{Name: "value", StreamName: ast.DefaultStream}, RHS: &ast.IntegerLiteral{Val: 10}},
 			},
 		},
 
 		{
-			s: `SELECT f1 FROM tbl GROUP BY HOPPINGWINDOW(mi, 5, 1)`,
+			s:    `SELECT * FROM demo UNPIVOT (value IN (temp, hum))`,
+			stmt: nil,
+			err:  "Found \"IN\" in UNPIVOT, expect FOR.",
+		},
+
+		{
+			s: `SELECT pivot FROM demo WHERE pivot > 1`,
 			stmt: &ast.SelectStatement{
 				Fields: []ast.Field{
 					{
-						Expr:  &ast.FieldRef{Name: "f1", StreamName: ast.DefaultStream},
-						Name:  "f1",
+						Expr:  &ast.FieldRef{Name: "pivot", StreamName: ast.DefaultStream},
+						Name:  "pivot",
 						AName: "",
 					},
 				},
-				Sources: []ast.Source{&ast.Table{Name: "tbl"}},
-				Dimensions: ast.Dimensions{
-					ast.Dimension{
-						Expr: &ast.Window{
-							WindowType: ast.HOPPING_WINDOW,
-							Length:     &ast.IntegerLiteral{Val: 5},
-							Interval:   &ast.IntegerLiteral{Val: 1},
-							TimeUnit:   &ast.TimeLiteral{Val: ast.MI},
-							Delay:      &ast.IntegerLiteral{Val: 0},
-						},
-					},
-				},
+				Sources:   []ast.Source{&ast.Table{Name: "demo"}},
+				Condition: &ast.BinaryExpr{OP: ast.GT, LHS: &ast.FieldRef{Name: "pivot", StreamName: ast.DefaultStream}, RHS: &ast.IntegerLiteral{Val: 1}},
 			},
 		},
 
 		{
-			s: `SELECT f1 FROM tbl GROUP BY SESSIONWINDOW(hh, 5, 1)`,
+			s: `SELECT a AS pivot FROM demo`,
 			stmt: &ast.SelectStatement{
 				Fields: []ast.Field{
 					{
-						Expr:  &ast.FieldRef{Name: "f1", StreamName: ast.DefaultStream},
-						Name:  "f1",
-						AName: "",
-					},
-				},
-				Sources: []ast.Source{&ast.Table{Name: "tbl"}},
-				Dimensions: ast.Dimensions{
-					ast.Dimension{
-						Expr: &ast.Window{
-							WindowType: ast.SESSION_WINDOW,
-							Length:     &ast.IntegerLiteral{Val: 5},
-							Interval:   &ast.IntegerLiteral{Val: 1},
-							TimeUnit:   &ast.TimeLiteral{Val: ast.HH},
-							Delay:      &ast.IntegerLiteral{Val: 0},
-						},
+						Expr:  &ast.FieldRef{Name: "a", StreamName: ast.DefaultStream},
+						Name:  "a",
+						AName: "pivot",
 					},
 				},
+				Sources: []ast.Source{&ast.Table{Name: "demo"}},
 			},
 		},
 
 		{
-			s: `SELECT f1 FROM tbl GROUP BY SLIDINGWINDOW(ms, 5)`,
+			s: `SELECT unpivot FROM demo WHERE unpivot > 1`,
 			stmt: &ast.SelectStatement{
 				Fields: []ast.Field{
 					{
-						Expr:  &ast.FieldRef{Name: "f1", StreamName: ast.DefaultStream},
-						Name:  "f1",
+						Expr:  &ast.FieldRef{Name: "unpivot", StreamName: ast.DefaultStream},
+						Name:  "unpivot",
 						AName: "",
 					},
 				},
-				Sources: []ast.Source{&ast.Table{Name: "tbl"}},
-				Dimensions: ast.Dimensions{
-					ast.Dimension{
-						Expr: &ast.Window{
-							WindowType: ast.SLIDING_WINDOW,
-							Length:     &ast.IntegerLiteral{Val: 5},
-							Interval:   &ast.IntegerLiteral{Val: 0},
-							Delay:      &ast.IntegerLiteral{Val: 0},
-							TimeUnit:   &ast.TimeLiteral{Val: ast.MS},
-						},
+				Sources:   []ast.Source{&ast.Table{Name: "demo"}},
+				Condition: &ast.BinaryExpr{OP: ast.GT, LHS: &ast.FieldRef{Name: "unpivot", StreamName: ast.DefaultStream}, RHS: &ast.IntegerLiteral{Val: 1}},
+			},
+		},
+
+		{
+			s: `SELECT a AS unpivot FROM demo`,
+			stmt: &ast.SelectStatement{
+				Fields: []ast.Field{
+					{
+						Expr:  &ast.FieldRef{Name: "a", StreamName: ast.DefaultStream},
+						Name:  "a",
+						AName: "unpivot",
 					},
 				},
+				Sources: []ast.Source{&ast.Table{Name: "demo"}},
 			},
 		},
 
@@ -3564,6 +4295,35 @@ func TestParser_ParseWindowsExpr(t *testing.T) {
 			stmt: nil,
 			err:  "The second parameter value 5 should be less than the first parameter 3.",
 		},
+		{
+			s: `SELECT f1 FROM tbl GROUP BY COUNTORTIMEWINDOW(ss, 10, 100)`,
+			stmt: &ast.SelectStatement{
+				Fields: []ast.Field{
+					{
+						Expr:  &ast.FieldRef{Name: "f1", StreamName: ast.DefaultStream},
+						Name:  "f1",
+						AName: "",
+					},
+				},
+				Sources: []ast.Source{&ast.Table{Name: "tbl"}},
+				Dimensions: ast.Dimensions{
+					ast.Dimension{
+						Expr: &ast.Window{
+							WindowType: ast.COUNT_OR_TIME_WINDOW,
+							Length:     &ast.IntegerLiteral{Val: 10},
+							Interval:   &ast.IntegerLiteral{Val: 100},
+							TimeUnit:   &ast.TimeLiteral{Val: ast.SS},
+							Delay:      &ast.IntegerLiteral{Val: 0},
+						},
+					},
+				},
+			},
+		},
+		{
+			s:    `SELECT f1 FROM tbl GROUP BY COUNTORTIMEWINDOW(ss, 10, 0)`,
+			stmt: nil,
+			err:  "The duration and count for countortimewindow should be greater than 0.",
+		},
 		{
 			s: `SELECT * FROM demo GROUP BY COUNTWINDOW(3,1) FILTER( where revenue > 100 )`,
 			stmt: &ast.SelectStatement{
@@ -4235,6 +4995,65 @@ func TestParser_ParseJoins(t *testing.T) {
 			},
 		},
 
+		{
+			s: `SELECT * FROM demo INNER JOIN tbl FOR SYSTEM_TIME AS OF demo.ts ON demo.id = tbl.id`,
+			stmt: &ast.SelectStatement{
+				Fields: []ast.Field{
+					{
+						Expr:  &ast.Wildcard{Token: ast.ASTERISK},
+						Name:  "*",
+						AName: "",
+					},
+				},
+				Sources: []ast.Source{&ast.Table{Name: "demo"}},
+				Joins: []ast.Join{
+					{
+						Name: "tbl", JoinType: ast.INNER_JOIN, Expr: &ast.BinaryExpr{
+							LHS: &ast.FieldRef{Name: "id", StreamName: "demo"},
+							OP:  ast.EQ,
+							RHS: &ast.FieldRef{Name: "id", StreamName: "tbl"},
+						},
+						AsOf: &ast.FieldRef{Name: "ts", StreamName: "demo"},
+					},
+				},
+			},
+		},
+
+		{
+			s:    `SELECT * FROM demo INNER JOIN tbl FOR SYSTEM AS OF demo.ts ON demo.id = tbl.id`,
+			stmt: nil,
+			err:  `found "SYSTEM", expected SYSTEM_TIME after FOR.`,
+		},
+
+		{
+			s: `SELECT for FROM demo WHERE for > 1`,
+			stmt: &ast.SelectStatement{
+				Fields: []ast.Field{
+					{
+						Expr:  &ast.FieldRef{Name: "for", StreamName: ast.DefaultStream},
+						Name:  "for",
+						AName: "",
+					},
+				},
+				Sources:   []ast.Source{&ast.Table{Name: "demo"}},
+				Condition: &ast.BinaryExpr{OP: ast.GT, LHS: &ast.FieldRef{Name: "for", StreamName: ast.DefaultStream}, RHS: &ast.IntegerLiteral{Val: 1}},
+			},
+		},
+
+		{
+			s: `SELECT a AS for FROM demo`,
+			stmt: &ast.SelectStatement{
+				Fields: []ast.Field{
+					{
+						Expr:  &ast.FieldRef{Name: "a", StreamName: ast.DefaultStream},
+						Name:  "a",
+						AName: "for",
+					},
+				},
+				Sources: []ast.Source{&ast.Table{Name: "demo"}},
+			},
+		},
+
 		{
 			s: `SELECT * FROM topic/sensor1 AS t1 LEFT JOIN topic1/sensor2 AS t2 ON f=k`,
 			stmt: &ast.SelectStatement{
@@ -28,6 +28,20 @@ func Validate(stmt *ast.SelectStatement) error {
 	}
 
 	for _, d := range stmt.Dimensions {
+		if w, ok := d.Expr.(*ast.Window); ok {
+			// the trigger condition of the tumbling and session window aggregates the window
+			if HasAggFuncs(w.Filter) || (w.WindowType == ast.SLIDING_WINDOW && HasAggFuncs(w.TriggerCondition)) {
+				return fmt.Errorf("Not allowed to call aggregate functions in GROUP BY clause.")
+			}
+			if w.Partition != nil {
+				for _, e := range w.Partition.Exprs {
+					if HasAggFuncs(e) {
+						return fmt.Errorf("Not allowed to call aggregate functions in GROUP BY clause.")
+					}
+				}
+			}
+			continue
+		}
 		if HasAggFuncs(d.Expr) {
 			return fmt.Errorf("Not allowed to call aggregate functions in GROUP BY clause.")
 		}
@@ -42,6 +56,36 @@ func Validate(stmt *ast.SelectStatement) error {
 	if err := validateWindowFunction(stmt); err != nil {
 		return err
 	}
+	if u := stmt.Unnest; u != nil && HasAggFuncs(u.Expr) {
+		return fmt.Errorf("Not allowed to call aggregate functions in UNNEST.")
+	}
+	if pv := stmt.Pivot; pv != nil {
+		if !HasAggFuncs(pv.Agg) {
+			return fmt.Errorf("PIVOT requires an aggregate function.")
+		}
+		if HasAggFuncs(pv.For) {
+			return fmt.Errorf("Not allowed to call aggregate functions in PIVOT FOR.")
+		}
+	}
+	if d := stmt.Dedup; d != nil {
+		for _, k := range d.Keys {
+			if HasAggFuncs(k) {
+				return fmt.Errorf("Not allowed to call aggregate functions in DEDUP BY clause.")
+			}
+		}
+	}
+	if m := stmt.MatchRecognize; m != nil {
+		for _, f := range m.Measures {
+			if HasAggFuncs(f.Expr) {
+				return fmt.Errorf("Not allowed to call aggregate functions in MATCH_RECOGNIZE.")
+			}
+		}
+		for _, d := range m.Defines {
+			if HasAggFuncs(d.Condition) {
+				return fmt.Errorf("Not allowed to call aggregate functions in MATCH_RECOGNIZE.")
+			}
+		}
+	}
 	return validateSRFForbidden(stmt)
 }
 
@@ -151,6 +195,34 @@ func validateFields(stmt *ast.SelectStatement, streamNames []string) {
 	}
 	for i, join := range stmt.Joins {
 		stmt.Joins[i].Expr = validateExpr(join.Expr, streamNames)
+		if join.AsOf != nil {
+			stmt.Joins[i].AsOf = validateExpr(join.AsOf, streamNames)
+		}
+	}
+	if u := stmt.Unnest; u != nil {
+		u.Expr = validateExpr(u.Expr, streamNames)
+	}
+	if pv := stmt.Pivot; pv != nil {
+		pv.Agg = validateExpr(pv.Agg, streamNames)
+		pv.For = validateExpr(pv.For, streamNames)
+	}
+	if d := stmt.Dedup; d != nil {
+		for i, k := range d.Keys {
+			d.Keys[i] = validateExpr(k, streamNames)
+		}
+	}
+	if m := stmt.MatchRecognize; m != nil {
+		// the pattern variables are like the streams in the match expressions
+		names := append([]string{}, streamNames...)
+		for _, v := range m.Pattern {
+			names = append(names, v.Name)
+		}
+		for i, f := range m.Measures {
+			m.Measures[i].Expr = validateExpr(f.Expr, names)
+		}
+		for _, d := range m.Defines {
+			d.Condition = validateExpr(d.Condition, names)
+		}
 	}
 }
 
@@ -42,6 +42,48 @@ func GetStreams(stmt *ast.SelectStatement) (result []string) {
 	return
 }
 
+// GetAllStreams returns all the streams and tables read by the statement, including the ones read by the CTEs and
+// subqueries and the ones merged by UNION ALL. The names of the CTEs are excluded.
+func GetAllStreams(stmt *ast.SelectStatement) (result []string) {
+	if stmt == nil {
+		return nil
+	}
+	var (
+		ctes = make(map[string]bool, len(stmt.With))
+		seen = make(map[string]bool)
+	)
+	add := func(names ...string) {
+		for _, n := range names {
+			if !ctes[n] && !seen[n] {
+				seen[n] = true
+				result = append(result, n)
+			}
+		}
+	}
+	collect := func(s *ast.SelectStatement) {
+		add(GetStreams(s)...)
+		for _, source := range s.Sources {
+			if t, ok := source.(*ast.Table); ok {
+				add(t.Union...)
+			}
+		}
+		subquery := func(n ast.Node) bool {
+			if sq, ok := n.(*ast.SubqueryExpr); ok {
+				add(GetStreams(sq.Stmt)...)
+			}
+			return true
+		}
+		ast.WalkFunc(s.Fields, subquery)
+		ast.WalkFunc(s.Condition, subquery)
+	}
+	for _, cte := range stmt.With {
+		collect(cte.Stmt)
+		ctes[cte.Name] = true
+	}
+	collect(stmt)
+	return
+}
+
 func GetStatementFromSql(sql string) (*ast.SelectStatement, error) {
 	parser := NewParser(strings.NewReader(sql))
 	if stmt, err := Language.Parse(parser); err != nil {
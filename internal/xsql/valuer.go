@@ -281,6 +281,10 @@ func (v *ValuerEval) Eval(expr ast.Expr) interface{} {
 			return fmt.Errorf("index %v is not int: %v", expr.Index, err)
 		}
 		return &BracketEvalResult{Start: ii, End: ii}
+	case *ast.SubqueryExpr:
+		// The subqueries are calculated by the subquery node, so just get the cached field value
+		val, _ := v.Valuer.Value(expr.CachedField, "")
+		return val
 	case *ast.Call:
 		// The analytic functions are calculated prior to all ops, so just get the cached field value
 		if expr.Cached && expr.CachedField != "" {
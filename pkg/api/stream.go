@@ -60,6 +60,30 @@ func (t *DefaultSourceTuple) Timestamp() time.Time {
 	return t.Time
 }
 
+// CacheTTLHinter is an optional interface of the lookup result tuple to hint how long it can be cached.
+// It overrides the cache ttl of the lookup table for the result.
+type CacheTTLHinter interface {
+	// CacheTTL returns the time to live of the tuple in the lookup cache. Zero or negative means no hint
+	CacheTTL() time.Duration
+}
+
+// DefaultTTLSourceTuple is a source tuple with cache ttl hint which can be returned by the lookup source
+type DefaultTTLSourceTuple struct {
+	*DefaultSourceTuple
+	TTL time.Duration `json:"ttl"`
+}
+
+func NewDefaultTTLSourceTuple(message map[string]interface{}, meta map[string]interface{}, ttl time.Duration) *DefaultTTLSourceTuple {
+	return &DefaultTTLSourceTuple{
+		DefaultSourceTuple: NewDefaultSourceTuple(message, meta),
+		TTL:                ttl,
+	}
+}
+
+func (t *DefaultTTLSourceTuple) CacheTTL() time.Duration {
+	return t.TTL
+}
+
 type Logger interface {
 	Debug(args ...interface{})
 	Info(args ...interface{})
@@ -107,6 +131,69 @@ type LookupSource interface {
 	Closable
 }
 
+// LookupSnapshotter is an optional interface of the lookup source which supports looking up a consistent version of the data
+type LookupSnapshotter interface {
+	// Snapshot pins the current version of the data. All lookups against the snapshot see the same data until it is closed
+	Snapshot(ctx StreamContext) (LookupSnapshot, error)
+}
+
+// LookupSnapshot is a pinned version of the lookup data
+type LookupSnapshot interface {
+	Lookup(ctx StreamContext, fields []string, keys []string, values []interface{}) ([]SourceTuple, error)
+	Closable
+}
+
+// LookupTemporal is an optional interface of the lookup source which supports looking up the time-versioned data such
+// as the slowly changing dimensions
+type LookupTemporal interface {
+	// LookupAsOf is like Lookup but returns the rows valid at the time asOf instead of the current rows
+	LookupAsOf(ctx StreamContext, fields []string, keys []string, values []interface{}, asOf time.Time) ([]SourceTuple, error)
+}
+
+// LookupBatcher is an optional interface of the lookup source which can look up multiple values in one call, such as
+// an IN query of a database, to save the round trips when looking up the rows of a window
+type LookupBatcher interface {
+	// LookupBatch is like Lookup for each of the values. It returns the results in the same order as the values
+	LookupBatch(ctx StreamContext, fields []string, keys []string, values [][]interface{}) ([][]SourceTuple, error)
+}
+
+// LookupScanner is an optional interface of the lookup source which can read all the rows, such as to preload the
+// cache of the lookup node when the rule starts
+type LookupScanner interface {
+	// Scan returns all the rows with the fields. If fields is empty, return all the fields
+	Scan(ctx StreamContext, fields []string) ([]SourceTuple, error)
+}
+
+// LookupRange is a range predicate of the lookup like "field >= value" where Op is one of "<", "<=", ">" and ">="
+type LookupRange struct {
+	Field string
+	Op    string
+	Value interface{}
+}
+
+// LookupRanger is an optional interface of the lookup source which can filter the rows by the range predicates of the
+// lookup join, such as a database which can push the comparisons down to the query. The sources without it are
+// looked up by the keys only and the rows are filtered after joining
+type LookupRanger interface {
+	// LookupRange is like Lookup with the rows also satisfying all the ranges. The keys may be empty if the join
+	// has only range predicates
+	LookupRange(ctx StreamContext, fields []string, keys []string, values []interface{}, ranges []LookupRange) ([]SourceTuple, error)
+}
+
+// LookupChangeNotifier is an optional interface of the lookup source which can notify the changes of the data
+type LookupChangeNotifier interface {
+	// Subscribe registers a handler which is called with the key field and the key value of each changed row after the source is opened.
+	// The key field is empty if the source is looked up by one key only such as the key of redis.
+	// The handler must not block. It returns a function to unsubscribe, or nil if the source is configured not to notify
+	Subscribe(handler func(key string, value interface{})) func()
+}
+
+// LookupIdleReleaser is an optional interface of the lookup source which can release the idle resources such as the
+// connections when no lookup node is attached. The released resources must be acquired again by the next Lookup
+type LookupIdleReleaser interface {
+	ReleaseIdle(ctx StreamContext) error
+}
+
 type Sink interface {
 	// Open Should be sync function for normal case. The container will run it in go func
 	Open(ctx StreamContext) error
@@ -145,6 +232,11 @@ type RuleOption struct {
 	LogFilename        string           `json:"logFilename" yaml:"logFilename"`
 	IsEventTime        bool             `json:"isEventTime" yaml:"isEventTime"`
 	LateTol            int64            `json:"lateTolerance" yaml:"lateTolerance"`
+	AllowedLateness    int64            `json:"allowedLateness,omitempty" yaml:"allowedLateness,omitempty"`
+	IdleTimeout        int64            `json:"idleTimeout,omitempty" yaml:"idleTimeout,omitempty"`
+	WatermarkPartition string           `json:"watermarkPartition,omitempty" yaml:"watermarkPartition,omitempty"`
+	GapFill            string           `json:"gapFill,omitempty" yaml:"gapFill,omitempty"`
+	GapFillMaxGap      int64            `json:"gapFillMaxGap,omitempty" yaml:"gapFillMaxGap,omitempty"`
 	Concurrency        int              `json:"concurrency" yaml:"concurrency"`
 	BufferLength       int              `json:"bufferLength" yaml:"bufferLength"`
 	SendMetaToSink     bool             `json:"sendMetaToSink" yaml:"sendMetaToSink"`
@@ -208,6 +208,10 @@ type Call struct {
 	Cached      bool
 	Partition   *PartitionExpr
 	WhenExpr    Expr
+	// OrderBy and Frame are only used by the aggregate functions over a ROWS frame like
+	// avg(a) OVER (PARTITION BY b ORDER BY ts ROWS BETWEEN 2 PRECEDING AND CURRENT ROW)
+	OrderBy SortFields
+	Frame   *FrameExpr
 }
 
 func (c *Call) expr()    {}
@@ -229,9 +233,27 @@ func (c *Call) String() string {
 	if c.WhenExpr != nil {
 		when += ", when:{ " + c.WhenExpr.String() + " }"
 	}
+	if c.Frame != nil {
+		when += ", frame:{ " + c.Frame.String() + " }"
+	}
 	return "Call:{ name:" + c.Name + args + when + " }"
 }
 
+// FrameExpr is the ROWS frame which ends at the current row
+type FrameExpr struct {
+	// Preceding is the number of rows before the current row in the frame, -1 means UNBOUNDED PRECEDING
+	Preceding int
+}
+
+func (fe *FrameExpr) expr() {}
+func (fe *FrameExpr) node() {}
+func (fe *FrameExpr) String() string {
+	if fe.Preceding < 0 {
+		return "ROWS BETWEEN UNBOUNDED PRECEDING AND CURRENT ROW"
+	}
+	return fmt.Sprintf("ROWS BETWEEN %d PRECEDING AND CURRENT ROW", fe.Preceding)
+}
+
 type PartitionExpr struct {
 	Exprs []Expr
 }
@@ -445,3 +467,36 @@ func (fr *ColFuncField) String() string {
 	}
 	return "colFuncField:{ " + e + " }"
 }
+
+// SubqueryExpr is a subquery against a table, such as `(SELECT max(limit) FROM limits)` or
+// `IN (SELECT id FROM blacklist)`. The subquery selects exactly one field. A scalar subquery evaluates to a single
+// value, otherwise it evaluates to the set of values for IN.
+type SubqueryExpr struct {
+	Stmt   *SelectStatement
+	Scalar bool
+	// CachedField is the field name to read the result which is calculated by the subquery node
+	CachedField string
+}
+
+func (s *SubqueryExpr) expr() {}
+func (s *SubqueryExpr) node() {}
+func (s *SubqueryExpr) String() string {
+	r := "subquery:{ "
+	if s.Stmt != nil {
+		if len(s.Stmt.Fields) > 0 && s.Stmt.Fields[0].Expr != nil {
+			r += "field:{ " + s.Stmt.Fields[0].Expr.String() + " }"
+		}
+		for _, src := range s.Stmt.Sources {
+			if t, ok := src.(*Table); ok {
+				r += ", from:" + t.Name
+			}
+		}
+		if s.Stmt.Condition != nil {
+			r += ", where:{ " + s.Stmt.Condition.String() + " }"
+		}
+	}
+	if s.Scalar {
+		r += ", scalar"
+	}
+	return r + " }"
+}
@@ -0,0 +1,75 @@
+// Copyright 2023 EMQ Technologies Co., Ltd.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ast
+
+import "strconv"
+
+// MatchRecognize is the MATCH_RECOGNIZE clause after FROM to detect the sequences of rows by a pattern
+type MatchRecognize struct {
+	Partition *PartitionExpr
+	// Measures are the fields of the output row of each match. The name of each measure is the AName
+	Measures []Field
+	Pattern  []*PatternVar
+	// Within limits the time from the first row to the last row of a match, nil means no limit
+	Within     *IntegerLiteral
+	WithinUnit *TimeLiteral
+	Defines    []*PatternDefine
+}
+
+func (m *MatchRecognize) node() {}
+func (m *MatchRecognize) String() string {
+	s := "MatchRecognize:{ pattern:("
+	for i, v := range m.Pattern {
+		if i > 0 {
+			s += " "
+		}
+		s += v.String()
+	}
+	s += ")"
+	if m.Partition != nil {
+		s += ", partition:" + m.Partition.String()
+	}
+	if m.Within != nil {
+		s += ", within:" + strconv.Itoa(m.Within.Val) + m.WithinUnit.Val.String()
+	}
+	return s + " }"
+}
+
+// PatternVar is a variable of the pattern with the quantifier
+type PatternVar struct {
+	Name string
+	// Min and Max are the repetitions of the variable. Max is -1 if unbounded
+	Min int
+	Max int
+}
+
+func (v *PatternVar) String() string {
+	switch {
+	case v.Min == 0 && v.Max == 1:
+		return v.Name + "?"
+	case v.Min == 0 && v.Max < 0:
+		return v.Name + "*"
+	case v.Min == 1 && v.Max < 0:
+		return v.Name + "+"
+	default:
+		return v.Name
+	}
+}
+
+// PatternDefine is the condition of a pattern variable. The variables without define match any row
+type PatternDefine struct {
+	Name      string
+	Condition Expr
+}
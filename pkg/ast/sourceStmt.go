@@ -231,6 +231,8 @@ type Options struct {
 	SCHEMAID          string `json:"schemaid,omitempty"`
 	// for scan table only
 	RETAIN_SIZE int `json:"retainSize,omitempty"`
+	// for scan table only, how many versions of the table to keep for the temporal join
+	HISTORY_SIZE int `json:"historySize,omitempty"`
 	// for table only, to distinguish lookup & scan
 	KIND string `json:"kind,omitempty"`
 	// for delimited format only
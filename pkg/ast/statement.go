@@ -14,7 +14,10 @@
 
 package ast
 
-import "strconv"
+import (
+	"strconv"
+	"strings"
+)
 
 type Statement interface {
 	stmt()
@@ -30,6 +33,18 @@ type SelectStatement struct {
 	Dimensions Dimensions
 	Having     Expr
 	SortFields SortFields
+	// MatchRecognize is nil if no MATCH_RECOGNIZE clause
+	MatchRecognize *MatchRecognize
+	// Dedup is nil if no DEDUP BY clause
+	Dedup *Dedup
+	// Unnest is nil if no CROSS JOIN UNNEST clause
+	Unnest *Unnest
+	// Pivot is nil if no PIVOT clause
+	Pivot *Pivot
+	// Unpivot is nil if no UNPIVOT clause
+	Unpivot *Unpivot
+	// With is the common table expressions defined in the WITH clause in order
+	With []*CTE
 
 	Statement
 }
@@ -108,6 +123,8 @@ type Source interface {
 type Table struct {
 	Name  string
 	Alias string
+	// Union is the streams merged into the source by UNION ALL
+	Union []string
 	Source
 }
 
@@ -143,6 +160,8 @@ type Join struct {
 	Alias    string
 	JoinType JoinType
 	Expr     Expr
+	// AsOf is the time of the stream row to join the version of the table valid at that time, nil if not a temporal join
+	AsOf Expr
 
 	Node
 }
@@ -189,6 +208,7 @@ const (
 	SLIDING_WINDOW
 	SESSION_WINDOW
 	COUNT_WINDOW
+	COUNT_OR_TIME_WINDOW
 )
 
 func (w WindowType) String() string {
@@ -205,6 +225,8 @@ func (w WindowType) String() string {
 		return "SESSION_WINDOW"
 	case COUNT_WINDOW:
 		return "COUNT_WINDOW"
+	case COUNT_OR_TIME_WINDOW:
+		return "COUNT_OR_TIME_WINDOW"
 	}
 	return ""
 }
@@ -217,6 +239,11 @@ type Window struct {
 	Interval         *IntegerLiteral
 	TimeUnit         *TimeLiteral
 	Filter           Expr
+	// Partition is only for session window to have a session for each partition key
+	Partition *PartitionExpr
+	// Rollup is only for tumbling window to aggregate the window results further by the coarser natural time units
+	// in order, such as ROLLUP(hh, dd)
+	Rollup []*TimeLiteral
 	Expr
 }
 
@@ -260,3 +287,74 @@ const (
 	RowkindUpsert = "upsert"
 	RowkindDelete = "delete"
 )
+
+// CTE is a common table expression which names the result of a query, such as `WITH hot AS (SELECT ...)`. The later
+// CTEs and the main query can read it like a stream by the name
+type CTE struct {
+	Name string
+	Stmt *SelectStatement
+}
+
+// Unnest is the CROSS JOIN UNNEST clause which expands each element of the array into a row. The element is the
+// field named by the alias
+type Unnest struct {
+	Expr  Expr
+	Alias string
+}
+
+func (u *Unnest) node() {}
+
+func (u *Unnest) String() string {
+	return "Unnest:{ expr:" + u.Expr.String() + ", alias:" + u.Alias + " }"
+}
+
+// Pivot is the PIVOT clause which turns the rows of each group into columns. Each column is the aggregate of the rows
+// of which the FOR expression equals to the value
+type Pivot struct {
+	Agg    Expr
+	For    Expr
+	Values []Expr
+	// Names are the column names of the values in order
+	Names []string
+}
+
+func (p *Pivot) node() {}
+
+func (p *Pivot) String() string {
+	return "Pivot:{ agg:" + p.Agg.String() + ", for:" + p.For.String() + ", columns:[" + strings.Join(p.Names, ", ") + "] }"
+}
+
+// Unpivot is the UNPIVOT clause which turns the columns of each row into rows of the name and the value
+type Unpivot struct {
+	// Value is the field name of the column value
+	Value string
+	// Name is the field name of the column name
+	Name    string
+	Columns []string
+}
+
+func (u *Unpivot) node() {}
+
+func (u *Unpivot) String() string {
+	return "Unpivot:{ value:" + u.Value + ", name:" + u.Name + ", columns:[" + strings.Join(u.Columns, ", ") + "] }"
+}
+
+// Dedup is the DEDUP BY clause to drop the rows whose keys have been seen within the duration
+type Dedup struct {
+	Keys       []Expr
+	Within     *IntegerLiteral
+	WithinUnit *TimeLiteral
+}
+
+func (d *Dedup) node() {}
+
+func (d *Dedup) String() string {
+	s := "Dedup:{ keys:["
+	for i, k := range d.Keys {
+		if i > 0 {
+			s += ", "
+		}
+		s += k.String()
+	}
+	return s + "], within:" + strconv.Itoa(d.Within.Val) + d.WithinUnit.Val.String() + " }"
+}
@@ -82,6 +82,7 @@ const (
 	COLON     //:
 	SEMICOLON //;
 	COLSEP    //\007
+	QUESTION  // ?
 
 	// Keywords
 	SELECT
@@ -163,6 +164,7 @@ var Tokens = []string{
 	SEMICOLON: ";",
 	COLON:     ":",
 	COLSEP:    "\007",
+	QUESTION:  "?",
 
 	SELECT:    "SELECT",
 	FROM:      "FROM",
@@ -228,6 +230,7 @@ const (
 	TIMESTAMP         = "TIMESTAMP"
 	TIMESTAMP_FORMAT  = "TIMESTAMP_FORMAT"
 	RETAIN_SIZE       = "RETAIN_SIZE"
+	HISTORY_SIZE      = "HISTORY_SIZE"
 	SHARED            = "SHARED"
 	SCHEMAID          = "SCHEMAID"
 	KIND              = "KIND"
@@ -253,6 +256,7 @@ var StreamTokens = map[string]struct{}{
 	TIMESTAMP:         {},
 	TIMESTAMP_FORMAT:  {},
 	RETAIN_SIZE:       {},
+	HISTORY_SIZE:      {},
 	SHARED:            {},
 	SCHEMAID:          {},
 	KIND:              {},
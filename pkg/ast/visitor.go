@@ -35,7 +35,16 @@ func Walk(v Visitor, node Node) {
 	case *SelectStatement:
 		Walk(v, n.Fields)
 		Walk(v, n.Sources)
+		if n.Unnest != nil {
+			Walk(v, n.Unnest)
+		}
 		Walk(v, n.Joins)
+		if n.Pivot != nil {
+			Walk(v, n.Pivot)
+		}
+		if n.Dedup != nil {
+			Walk(v, n.Dedup)
+		}
 		Walk(v, n.Condition)
 		Walk(v, n.Dimensions)
 		Walk(v, n.Having)
@@ -72,6 +81,22 @@ func Walk(v Visitor, node Node) {
 
 	case *Join:
 		Walk(v, n.Expr)
+		Walk(v, n.AsOf)
+
+	case *Unnest:
+		Walk(v, n.Expr)
+
+	case *Pivot:
+		Walk(v, n.Agg)
+		Walk(v, n.For)
+		for _, e := range n.Values {
+			Walk(v, e)
+		}
+
+	case *Dedup:
+		for _, k := range n.Keys {
+			Walk(v, k)
+		}
 
 	case Dimensions:
 		Walk(v, n.GetWindow())
@@ -84,6 +109,11 @@ func Walk(v Visitor, node Node) {
 		Walk(v, n.Interval)
 		Walk(v, n.Filter)
 		Walk(v, n.TriggerCondition)
+		if n.Partition != nil {
+			for _, expr := range n.Partition.Exprs {
+				Walk(v, expr)
+			}
+		}
 
 	case SortFields:
 		for _, sf := range n {
@@ -111,6 +141,10 @@ func Walk(v Visitor, node Node) {
 			Walk(v, n.WhenExpr)
 		}
 
+		if n.OrderBy != nil {
+			Walk(v, n.OrderBy)
+		}
+
 	case *ParenExpr:
 		Walk(v, n.Expr)
 